@@ -0,0 +1,211 @@
+// Package backup writes and reads logical backups of the record tables: gzipped
+// NDJSON files holding one record per line, followed by a manifest line that
+// records how many records precede it and their checksum.
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"tokenpagination/repository"
+)
+
+// Format names the file format in the manifest.
+const Format = "tokenpagination-backup"
+
+// maxLineSize bounds a single line of a backup, which holds one record.
+const maxLineSize = 64 << 20
+
+// maxReportedLines bounds the invalid lines Read reports, so that reading the
+// wrong file does not flood the output.
+const maxReportedLines = 100
+
+// Manifest describes a backup. It is written as the last line of the file.
+type Manifest struct {
+	Format        string    `json:"format"`
+	SchemaVersion int       `json:"schema_version"`
+	Records       int64     `json:"records"`
+	SHA256        string    `json:"sha256"` // of the record lines, before compression
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// record is the JSON form of a record line. Unlike the API it always writes the
+// context, so that a null context is distinguishable from a truncated line. A
+// record claimed by ClaimNext also carries its claimed_at, so that it is restored
+// claimed.
+type record struct {
+	ResourceID   string            `json:"resource_id"`
+	ResourceType string            `json:"resource_type"`
+	Context      *string           `json:"context"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+	ClaimedAt    *time.Time        `json:"claimed_at,omitempty"`
+}
+
+// line is a line of a backup: a record, or the manifest closing the file.
+type line struct {
+	Manifest *Manifest `json:"manifest"`
+	record
+}
+
+// Write streams every record forEach produces into w as a gzipped backup and
+// returns its manifest. forEach has the signature of RecordRepository.ForEach,
+// whose single SELECT reads a consistent snapshot of the tables.
+func Write(w io.Writer, forEach func(fn func(repository.Record) error) error) (Manifest, error) {
+	gz := gzip.NewWriter(w)
+	buffered := bufio.NewWriter(gz)
+	checksum := sha256.New()
+	out := io.MultiWriter(buffered, checksum)
+
+	manifest := Manifest{Format: Format, SchemaVersion: repository.SchemaVersion, CreatedAt: time.Now().UTC()}
+	err := forEach(func(r repository.Record) error {
+		var claimedAt *time.Time
+		if claimed := r.ClaimedAt(); claimed != nil {
+			utc := claimed.UTC()
+			claimedAt = &utc
+		}
+		encoded, err := json.Marshal(record{
+			ResourceID:   r.ResourceID,
+			ResourceType: r.ResourceType,
+			Context:      r.Context,
+			Metadata:     r.Metadata,
+			CreatedAt:    r.CreatedAt.UTC(),
+			UpdatedAt:    r.UpdatedAt.UTC(),
+			ClaimedAt:    claimedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := out.Write(append(encoded, '\n')); err != nil {
+			return err
+		}
+		manifest.Records++
+		return nil
+	})
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	manifest.SHA256 = hex.EncodeToString(checksum.Sum(nil))
+	encoded, err := json.Marshal(struct {
+		Manifest Manifest `json:"manifest"`
+	}{manifest})
+	if err != nil {
+		return Manifest{}, err
+	}
+	if _, err := buffered.Write(append(encoded, '\n')); err != nil {
+		return Manifest{}, err
+	}
+	if err := buffered.Flush(); err != nil {
+		return Manifest{}, err
+	}
+	return manifest, gz.Close()
+}
+
+// Read reads a backup written by Write. The manifest is verified before any
+// record is returned: the file must end with it, and the number and checksum of
+// the record lines must match, so that a truncated or altered backup is rejected
+// as a whole. Lines that are not valid records are then reported together, each
+// with its line number, which is also the position of the record in the backup.
+func Read(r io.Reader) ([]repository.Record, Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, Manifest{}, fmt.Errorf("not a gzipped backup: %w", err)
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	checksum := sha256.New()
+
+	var records []repository.Record
+	var manifest *Manifest
+	var lineErrs []error
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if manifest != nil {
+			return nil, Manifest{}, fmt.Errorf("line %d: unexpected data after the manifest", lineNumber)
+		}
+
+		var decoded line
+		err := json.Unmarshal(scanner.Bytes(), &decoded)
+		if err == nil && decoded.Manifest != nil {
+			manifest = decoded.Manifest
+			continue
+		}
+		checksum.Write(scanner.Bytes())
+		checksum.Write([]byte{'\n'})
+
+		if err == nil {
+			err = validate(decoded)
+		}
+		if err != nil {
+			if len(lineErrs) < maxReportedLines {
+				lineErrs = append(lineErrs, fmt.Errorf("line %d: %w", lineNumber, err))
+			}
+			continue
+		}
+		restored := repository.Record{
+			ResourceID:   decoded.ResourceID,
+			ResourceType: decoded.ResourceType,
+			Context:      decoded.Context,
+			Metadata:     decoded.Metadata,
+			CreatedAt:    decoded.CreatedAt,
+			UpdatedAt:    decoded.UpdatedAt,
+		}
+		restored.SetClaimedAt(decoded.ClaimedAt)
+		records = append(records, restored)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, Manifest{}, fmt.Errorf("line %d: %w", lineNumber+1, err)
+	}
+
+	if err := verify(manifest, int64(lineNumber-1), hex.EncodeToString(checksum.Sum(nil))); err != nil {
+		return nil, Manifest{}, err
+	}
+	if len(lineErrs) > 0 {
+		return nil, *manifest, errors.Join(lineErrs...)
+	}
+	return records, *manifest, nil
+}
+
+// verify checks the manifest against the record lines read before it.
+func verify(manifest *Manifest, records int64, checksum string) error {
+	switch {
+	case manifest == nil:
+		return errors.New("backup has no manifest, it is truncated or not a backup")
+	case manifest.Format != Format:
+		return fmt.Errorf("unknown backup format '%s'", manifest.Format)
+	case manifest.SchemaVersion > repository.SchemaVersion:
+		return fmt.Errorf("backup has schema version %d, newer than the supported version %d", manifest.SchemaVersion, repository.SchemaVersion)
+	case manifest.Records != records:
+		return fmt.Errorf("backup holds %d records, but its manifest lists %d", records, manifest.Records)
+	case manifest.SHA256 != checksum:
+		return fmt.Errorf("backup checksum %s does not match the manifest's %s", checksum, manifest.SHA256)
+	}
+	return nil
+}
+
+// validate checks the fields a record line must have.
+func validate(l line) error {
+	switch {
+	case l.ResourceID == "":
+		return errors.New("resource_id is required")
+	case l.ResourceType == "":
+		return errors.New("resource_type is required")
+	case l.CreatedAt.IsZero():
+		return errors.New("created_at is required")
+	case l.UpdatedAt.IsZero():
+		return errors.New("updated_at is required")
+	}
+	return nil
+}
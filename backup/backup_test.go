@@ -0,0 +1,157 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tokenpagination/repository"
+)
+
+// sampleRecords covers every field: null, empty and JSON contexts, metadata, a
+// claimed record, and timestamps in other zones and with sub-second precision.
+func sampleRecords() []repository.Record {
+	empty, ctx := "", `{"name": "Alice", "note": "line\nbreak"}`
+	created := time.Date(2024, 1, 15, 10, 30, 0, 123456000, time.UTC)
+	claimed := created.Add(2 * time.Hour).In(time.FixedZone("CEST", 2*60*60))
+	records := []repository.Record{
+		{ResourceID: "user-1", ResourceType: "user", Context: &ctx, Metadata: map[string]string{"tier": "gold"}, CreatedAt: created, UpdatedAt: created.Add(time.Hour)},
+		{ResourceID: "user-2", ResourceType: "user", Context: &empty, CreatedAt: created, UpdatedAt: created},
+		{ResourceID: "doc-1", ResourceType: "document", CreatedAt: created.In(time.FixedZone("CEST", 2*60*60)), UpdatedAt: created},
+	}
+	records[2].SetClaimedAt(&claimed)
+	return records
+}
+
+// forEachOf returns a forEach over records, like RecordRepository.ForEach.
+func forEachOf(records []repository.Record) func(fn func(repository.Record) error) error {
+	return func(fn func(repository.Record) error) error {
+		for _, record := range records {
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// gzipped compresses content, for hand-written backups.
+func gzipped(t *testing.T, content string) io.Reader {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return &buf
+}
+
+// gunzipped decompresses a backup into its lines.
+func gunzipped(t *testing.T, backup []byte) []string {
+	gz, err := gzip.NewReader(bytes.NewReader(backup))
+	require.NoError(t, err)
+	content, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+func TestRoundTrip(t *testing.T) {
+	records := sampleRecords()
+
+	var buf bytes.Buffer
+	written, err := Write(&buf, forEachOf(records))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), written.Records)
+	assert.Equal(t, repository.SchemaVersion, written.SchemaVersion)
+	assert.Len(t, written.SHA256, 64)
+	lines := gunzipped(t, buf.Bytes())
+
+	restored, read, err := Read(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, written, read)
+	require.Len(t, restored, len(records))
+	for i := range records {
+		assert.Equal(t, records[i].ResourceID, restored[i].ResourceID)
+		assert.Equal(t, records[i].ResourceType, restored[i].ResourceType)
+		assert.Equal(t, records[i].Context, restored[i].Context)
+		assert.Equal(t, records[i].Metadata, restored[i].Metadata)
+		assert.True(t, records[i].CreatedAt.Equal(restored[i].CreatedAt), "created_at of %s", records[i].ResourceID)
+		assert.True(t, records[i].UpdatedAt.Equal(restored[i].UpdatedAt), "updated_at of %s", records[i].ResourceID)
+	}
+
+	assert.Nil(t, restored[0].ClaimedAt())
+	require.NotNil(t, restored[2].ClaimedAt())
+	assert.True(t, records[2].ClaimedAt().Equal(*restored[2].ClaimedAt()))
+	assert.Contains(t, lines[2], `"claimed_at":"2024-01-15T12:30:00.123456Z"`)
+}
+
+func TestRoundTrip_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Write(&buf, forEachOf(nil))
+	require.NoError(t, err)
+
+	restored, manifest, err := Read(&buf)
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+	assert.Zero(t, manifest.Records)
+}
+
+func TestWrite_SourceError(t *testing.T) {
+	_, err := Write(io.Discard, func(func(repository.Record) error) error { return assert.AnError })
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestRead_RejectsDamagedBackups(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Write(&buf, forEachOf(sampleRecords()))
+	require.NoError(t, err)
+	lines := gunzipped(t, buf.Bytes())
+	join := func(lines ...string) string { return strings.Join(lines, "\n") + "\n" }
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "truncated", content: join(lines[:2]...), wantErr: "backup has no manifest, it is truncated or not a backup"},
+		{name: "record dropped", content: join(lines[0], lines[2], lines[3]), wantErr: "backup holds 2 records, but its manifest lists 3"},
+		{name: "record altered", content: join(strings.Replace(lines[0], "gold", "gilt", 1), lines[1], lines[2], lines[3]), wantErr: "does not match the manifest's"},
+		{name: "data after manifest", content: join(append(lines, lines[0])...), wantErr: "line 5: unexpected data after the manifest"},
+		{name: "other format", content: join(`{"manifest": {"format": "other"}}`), wantErr: "unknown backup format 'other'"},
+		{name: "newer schema", content: join(`{"manifest": {"format": "tokenpagination-backup", "schema_version": 99}}`), wantErr: "backup has schema version 99, newer than the supported version 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, _, err := Read(gzipped(t, tt.content))
+			assert.ErrorContains(t, err, tt.wantErr)
+			assert.Nil(t, records)
+		})
+	}
+}
+
+func TestRead_NotGzipped(t *testing.T) {
+	_, _, err := Read(strings.NewReader(`{"resource_id": "user-1"}`))
+	assert.ErrorContains(t, err, "not a gzipped backup")
+}
+
+func TestRead_ReportsEveryInvalidLine(t *testing.T) {
+	// A backup with a valid manifest whose records are invalid, as written by a
+	// buggy or foreign tool
+	var buf bytes.Buffer
+	_, err := Write(&buf, forEachOf([]repository.Record{
+		{ResourceID: "user-1", ResourceType: "user", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+		{ResourceType: "user", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+		{ResourceID: "user-3", ResourceType: "user", UpdatedAt: time.Now()},
+	}))
+	require.NoError(t, err)
+
+	records, manifest, err := Read(&buf)
+	assert.Nil(t, records)
+	assert.Equal(t, int64(3), manifest.Records)
+	assert.EqualError(t, err, "line 2: resource_id is required\nline 3: created_at is required")
+}
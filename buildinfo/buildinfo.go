@@ -0,0 +1,94 @@
+package buildinfo
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Build metadata, set at link time with -ldflags, e.g.
+//
+//	go build -ldflags "-X tokenpagination/buildinfo.Version=v1.2.0 -X tokenpagination/buildinfo.Commit=$(git rev-parse HEAD)"
+//
+// Binaries built without the flags fall back to what the Go toolchain embedded
+// in the binary: the module version when built with go install, and the commit
+// and commit time of the checkout when built with VCS stamping. Only when neither
+// is available are the defaults reported.
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// readBuildInfo is debug.ReadBuildInfo, replaced in tests.
+var readBuildInfo = debug.ReadBuildInfo
+
+// Get returns the build information of the running binary.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	embedded, ok := readBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "dev" && embedded.Main.Version != "" && embedded.Main.Version != "(devel)" {
+		info.Version = embedded.Main.Version
+	}
+
+	var modified bool
+	for _, setting := range embedded.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "unknown" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			if info.BuildTime == "unknown" {
+				info.BuildTime = setting.Value
+			}
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	// A commit read from a checkout with uncommitted changes does not describe the
+	// source the binary was built from
+	if modified && Commit == "unknown" && info.Commit != "unknown" {
+		info.Commit += "-dirty"
+	}
+	return info
+}
+
+// Handler handles GET /version and reports the build information as JSON.
+func Handler(c *gin.Context) {
+	c.JSON(http.StatusOK, Get())
+}
+
+// versionResponse is the build information with a description of the runtime
+// environment.
+type versionResponse struct {
+	Info
+	Environment any `json:"environment"`
+}
+
+// HandlerWithEnvironment works like Handler and also reports environment, such as
+// the configured mode and feature flags, under "environment".
+func HandlerWithEnvironment(environment any) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, versionResponse{Info: Get(), Environment: environment})
+	}
+}
@@ -0,0 +1,120 @@
+package buildinfo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveVersion(t *testing.T) map[string]string {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/version", nil)
+
+	Handler(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return body
+}
+
+// stubBuildInfo replaces the build information embedded by the toolchain for the
+// duration of the test.
+func stubBuildInfo(t *testing.T, info *debug.BuildInfo) {
+	original := readBuildInfo
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return info, info != nil }
+	t.Cleanup(func() { readBuildInfo = original })
+}
+
+func TestHandler_Defaults(t *testing.T) {
+	stubBuildInfo(t, nil)
+	body := serveVersion(t)
+
+	assert.Equal(t, "dev", body["version"])
+	assert.Equal(t, "unknown", body["commit"])
+	assert.Equal(t, "unknown", body["build_time"])
+	assert.Equal(t, runtime.Version(), body["go_version"])
+}
+
+func TestHandler_LinkedValues(t *testing.T) {
+	defer func(version, commit, buildTime string) {
+		Version, Commit, BuildTime = version, commit, buildTime
+	}(Version, Commit, BuildTime)
+
+	Version, Commit, BuildTime = "v1.2.0", "abc1234", "2024-01-15T10:30:00Z"
+	body := serveVersion(t)
+
+	assert.Equal(t, "v1.2.0", body["version"])
+	assert.Equal(t, "abc1234", body["commit"])
+	assert.Equal(t, "2024-01-15T10:30:00Z", body["build_time"])
+}
+
+func TestGet_EmbeddedFallback(t *testing.T) {
+	settings := []debug.BuildSetting{
+		{Key: "vcs.revision", Value: "0123abc"},
+		{Key: "vcs.time", Value: "2024-02-01T08:00:00Z"},
+		{Key: "vcs.modified", Value: "false"},
+	}
+
+	t.Run("unset flags use embedded values", func(t *testing.T) {
+		stubBuildInfo(t, &debug.BuildInfo{Main: debug.Module{Version: "v1.3.0"}, Settings: settings})
+
+		info := Get()
+		assert.Equal(t, "v1.3.0", info.Version)
+		assert.Equal(t, "0123abc", info.Commit)
+		assert.Equal(t, "2024-02-01T08:00:00Z", info.BuildTime)
+	})
+
+	t.Run("devel module version keeps the default", func(t *testing.T) {
+		stubBuildInfo(t, &debug.BuildInfo{Main: debug.Module{Version: "(devel)"}})
+
+		info := Get()
+		assert.Equal(t, "dev", info.Version)
+		assert.Equal(t, "unknown", info.Commit)
+	})
+
+	t.Run("modified checkout", func(t *testing.T) {
+		modified := append([]debug.BuildSetting{{Key: "vcs.modified", Value: "true"}}, settings[:2]...)
+		stubBuildInfo(t, &debug.BuildInfo{Settings: modified})
+
+		assert.Equal(t, "0123abc-dirty", Get().Commit)
+	})
+
+	t.Run("linked values win", func(t *testing.T) {
+		defer func(version, commit, buildTime string) {
+			Version, Commit, BuildTime = version, commit, buildTime
+		}(Version, Commit, BuildTime)
+		Version, Commit, BuildTime = "v1.2.0", "abc1234", "2024-01-15T10:30:00Z"
+		stubBuildInfo(t, &debug.BuildInfo{Main: debug.Module{Version: "v1.3.0"}, Settings: settings})
+
+		assert.Equal(t, Info{Version: "v1.2.0", Commit: "abc1234", BuildTime: "2024-01-15T10:30:00Z", GoVersion: runtime.Version()}, Get())
+	})
+}
+
+func TestHandlerWithEnvironment(t *testing.T) {
+	stubBuildInfo(t, nil)
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/version", nil)
+
+	HandlerWithEnvironment(map[string]any{"app_env": "prod", "seed_sample_data": false})(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"version": "dev",
+		"commit": "unknown",
+		"build_time": "unknown",
+		"go_version": "`+runtime.Version()+`",
+		"environment": {"app_env": "prod", "seed_sample_data": false}
+	}`, w.Body.String())
+}
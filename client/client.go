@@ -0,0 +1,259 @@
+// Package client is a Go client for the record API. Its methods map the API's
+// error responses to *APIError values, which match ErrNotFound, ErrConflict and
+// ErrInvalidToken with errors.Is.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is matched by errors for records or routes that do not exist.
+var ErrNotFound = errors.New("record not found")
+
+// ErrConflict is matched by errors creating a record whose composite key is
+// already stored.
+var ErrConflict = errors.New("record already exists")
+
+// ErrInvalidToken is matched by errors for a continuation token the server
+// cannot decode, refuses as too long, or that was issued for a different listing.
+var ErrInvalidToken = errors.New("invalid continuation token")
+
+// APIError is an error response of the API.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Field names the query parameter that failed validation, if any.
+	Field string
+}
+
+func (e *APIError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("api error %d: %s (field %s)", e.StatusCode, e.Message, e.Field)
+	}
+	return fmt.Sprintf("api error %d: %s", e.StatusCode, e.Message)
+}
+
+// Unwrap returns the sentinel error the response stands for, or nil.
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusConflict:
+		return ErrConflict
+	case e.StatusCode == http.StatusBadRequest && e.Field == "continuation_token":
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// Record is a record as returned by the API.
+type Record struct {
+	ResourceID   string            `json:"resource_id"`
+	ResourceType string            `json:"resource_type"`
+	Context      *string           `json:"context,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// CreateRecordRequest is the record to create. An empty ResourceID has the
+// server generate a UUID.
+type CreateRecordRequest struct {
+	ResourceID   string            `json:"resource_id,omitempty"`
+	ResourceType string            `json:"resource_type"`
+	Context      *string           `json:"context,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	GenerateID   bool              `json:"generate_id,omitempty"`
+}
+
+// ListOptions are the parameters of ListRecords. Zero values are left out, so
+// that the server defaults apply.
+type ListOptions struct {
+	ContinuationToken string
+	PageSize          int
+	ResourceType      string
+	MetadataKey       string
+	// OrderBy is a sort column such as created_at or seq, and Order is asc or desc.
+	OrderBy string
+	Order   string
+	// ContextFirst lists the records with a context before those without.
+	ContextFirst bool
+	// IncludeTotal asks for Page.Total, which costs the server a COUNT(*).
+	IncludeTotal bool
+}
+
+// Page is a page of ListRecords. NextContinuationToken is empty on the last page.
+type Page struct {
+	Records               []Record `json:"records"`
+	NextContinuationToken string   `json:"next_continuation_token,omitempty"`
+	PageDepth             int      `json:"page_depth"`
+	IsLastPage            bool     `json:"is_last_page"`
+	// Total is the number of records across all pages, set with IncludeTotal.
+	Total *int64 `json:"total,omitempty"`
+}
+
+// Client calls the record API at BaseURL, such as http://localhost:8080.
+type Client struct {
+	BaseURL string
+	// APIKey, when set, is sent as "Authorization: Bearer <key>".
+	APIKey string
+	// Timeout bounds every request on top of its context. Zero means no limit.
+	Timeout time.Duration
+	// HTTPClient sends the requests; nil uses http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// New returns a client for the API at baseURL, authenticating with apiKey
+// unless it is empty.
+func New(baseURL, apiKey string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), APIKey: apiKey}
+}
+
+// CreateRecord creates a record and returns it as stored, with its timestamps
+// and, when req.GenerateID is set, its generated resource_id. A record whose
+// composite key is already stored fails with ErrConflict.
+func (c *Client) CreateRecord(ctx context.Context, req CreateRecordRequest) (*Record, error) {
+	var record Record
+	if err := c.do(ctx, http.MethodPost, "/api/v1/records", url.Values{"return": {"representation"}}, req, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// GetRecord returns the record with the given composite key, or ErrNotFound.
+func (c *Client) GetRecord(ctx context.Context, resourceType, resourceID string) (*Record, error) {
+	var record Record
+	if err := c.do(ctx, http.MethodGet, recordPath(resourceType, resourceID), nil, nil, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ListRecords returns a page of the paginated listing. Pass the page's
+// NextContinuationToken in opts to get the next one; a rejected token fails with
+// ErrInvalidToken.
+func (c *Client) ListRecords(ctx context.Context, opts ListOptions) (*Page, error) {
+	query := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	set("continuation_token", opts.ContinuationToken)
+	set("resource_type", opts.ResourceType)
+	set("metadata_key", opts.MetadataKey)
+	set("order_by", opts.OrderBy)
+	set("order", opts.Order)
+	if opts.PageSize > 0 {
+		query.Set("page_size", strconv.Itoa(opts.PageSize))
+	}
+	if opts.ContextFirst {
+		query.Set("context_first", "true")
+	}
+	if opts.IncludeTotal {
+		query.Set("include_total", "true")
+	}
+
+	var page Page
+	if err := c.do(ctx, http.MethodGet, "/api/v1/records/paginated", query, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// DeleteRecord deletes the record with the given composite key, or fails with
+// ErrNotFound.
+func (c *Client) DeleteRecord(ctx context.Context, resourceType, resourceID string) error {
+	return c.do(ctx, http.MethodDelete, recordPath(resourceType, resourceID), nil, nil, nil)
+}
+
+// recordPath returns the path of a single record.
+func recordPath(resourceType, resourceID string) string {
+	return "/api/v1/records/" + url.PathEscape(resourceType) + "/" + url.PathEscape(resourceID)
+}
+
+// do sends a request with body, if not nil, encoded as JSON, and decodes a
+// successful response into out, if not nil. Error responses are returned as
+// *APIError.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return decodeError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+// decodeError reads the {"error": ..., "field": ...} body of an error response.
+// A body that is not such JSON, as sent by a proxy, becomes the message.
+func decodeError(resp *http.Response) error {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var body struct {
+		Error string `json:"error"`
+		Field string `json:"field"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil || body.Error == "" {
+		body.Error = strings.TrimSpace(string(raw))
+		if body.Error == "" {
+			body.Error = http.StatusText(resp.StatusCode)
+		}
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: body.Error, Field: body.Field}
+}
@@ -0,0 +1,289 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"tokenpagination/handler"
+	"tokenpagination/repository"
+)
+
+// mockRepository stubs the repository methods behind the endpoints the client
+// calls. The embedded interface is nil, so any other method panics.
+type mockRepository struct {
+	handler.RecordRepositoryInterface
+	mock.Mock
+}
+
+func (m *mockRepository) InsertReturning(resourceID, resourceType string, context *string, metadata map[string]string) (*repository.Record, error) {
+	args := m.Called(resourceID, resourceType, context, metadata)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.Record), args.Error(1)
+}
+
+func (m *mockRepository) GetByID(resourceID, resourceType string) (*repository.Record, error) {
+	args := m.Called(resourceID, resourceType)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.Record), args.Error(1)
+}
+
+func (m *mockRepository) GetPaginated(continuationToken string, pageSize int) (*repository.PaginatedResult, error) {
+	args := m.Called(continuationToken, pageSize)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.PaginatedResult), args.Error(1)
+}
+
+func (m *mockRepository) GetPaginatedByType(resourceType, continuationToken string, pageSize int) (*repository.PaginatedResult, error) {
+	args := m.Called(resourceType, continuationToken, pageSize)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.PaginatedResult), args.Error(1)
+}
+
+func (m *mockRepository) GetPaginatedSorted(order repository.SortOrder, filter repository.PaginationFilter, continuationToken string, pageSize int) (*repository.PaginatedResult, error) {
+	args := m.Called(order, filter, continuationToken, pageSize)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.PaginatedResult), args.Error(1)
+}
+
+func (m *mockRepository) Count() (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockRepository) Delete(resourceID, resourceType string) error {
+	args := m.Called(resourceID, resourceType)
+	return args.Error(0)
+}
+
+// setupTestServer serves the real record handlers, routed as in setupRoutes, and
+// returns a client for them.
+func setupTestServer(t *testing.T) (*Client, *mockRepository) {
+	gin.SetMode(gin.TestMode)
+	repo := &mockRepository{}
+	recordHandler := handler.NewRecordHandler(repo)
+
+	r := gin.New()
+	handler.RegisterFallbacks(r)
+	api := r.Group("/api/v1", handler.APIVersionMiddleware())
+	{
+		api.POST("/records", handler.RequireJSON(), recordHandler.CreateRecord)
+		api.GET("/records/paginated", recordHandler.GetRecordsPaginated)
+		api.GET("/records/:resource_type/:resource_id", recordHandler.GetRecord)
+		api.DELETE("/records/:resource_type/:resource_id", recordHandler.DeleteRecord)
+	}
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return New(server.URL, ""), repo
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestCreateRecord(t *testing.T) {
+	client, repo := setupTestServer(t)
+
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	repo.On("InsertReturning", "user-1", "user", stringPtr(`{"name":"Alice"}`), map[string]string{"tier": "gold"}).
+		Return(&repository.Record{ResourceID: "user-1", ResourceType: "user", Context: stringPtr(`{"name":"Alice"}`), Metadata: map[string]string{"tier": "gold"}, CreatedAt: created, UpdatedAt: created}, nil)
+
+	record, err := client.CreateRecord(context.Background(), CreateRecordRequest{
+		ResourceID:   "user-1",
+		ResourceType: "user",
+		Context:      stringPtr(`{"name":"Alice"}`),
+		Metadata:     map[string]string{"tier": "gold"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &Record{ResourceID: "user-1", ResourceType: "user", Context: stringPtr(`{"name":"Alice"}`), Metadata: map[string]string{"tier": "gold"}, CreatedAt: created, UpdatedAt: created}, record)
+	repo.AssertExpectations(t)
+}
+
+func TestCreateRecord_Conflict(t *testing.T) {
+	client, repo := setupTestServer(t)
+
+	repo.On("InsertReturning", "user-1", "user", (*string)(nil), map[string]string(nil)).
+		Return(nil, fmt.Errorf("%w: Duplicate entry", repository.ErrDuplicate))
+
+	_, err := client.CreateRecord(context.Background(), CreateRecordRequest{ResourceID: "user-1", ResourceType: "user"})
+	assert.ErrorIs(t, err, ErrConflict)
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusConflict, apiErr.StatusCode)
+	assert.Equal(t, "Record already exists", apiErr.Message)
+}
+
+func TestCreateRecord_ValidationError(t *testing.T) {
+	client, _ := setupTestServer(t)
+
+	_, err := client.CreateRecord(context.Background(), CreateRecordRequest{ResourceID: "user-1"})
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Contains(t, apiErr.Message, "ResourceType")
+	assert.NotErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestGetRecord(t *testing.T) {
+	client, repo := setupTestServer(t)
+
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	repo.On("GetByID", "user 1", "user").Return(&repository.Record{ResourceID: "user 1", ResourceType: "user", CreatedAt: created, UpdatedAt: created}, nil)
+
+	record, err := client.GetRecord(context.Background(), "user", "user 1")
+	require.NoError(t, err)
+	assert.Equal(t, "user 1", record.ResourceID)
+	assert.Equal(t, created, record.CreatedAt)
+	repo.AssertExpectations(t)
+}
+
+func TestGetRecord_NotFound(t *testing.T) {
+	client, repo := setupTestServer(t)
+
+	repo.On("GetByID", "missing", "user").Return(nil, repository.ErrNotFound)
+
+	_, err := client.GetRecord(context.Background(), "user", "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.EqualError(t, err, "api error 404: Record not found")
+}
+
+func TestListRecords(t *testing.T) {
+	client, repo := setupTestServer(t)
+
+	next := "next-token"
+	repo.On("GetPaginatedByType", "user", "token", 2).Return(&repository.PaginatedResult{
+		Records:               []repository.Record{{ResourceID: "user-2", ResourceType: "user"}, {ResourceID: "user-1", ResourceType: "user"}},
+		NextContinuationToken: &next,
+		PageDepth:             2,
+	}, nil)
+
+	page, err := client.ListRecords(context.Background(), ListOptions{ContinuationToken: "token", PageSize: 2, ResourceType: "user"})
+	require.NoError(t, err)
+	require.Len(t, page.Records, 2)
+	assert.Equal(t, "user-2", page.Records[0].ResourceID)
+	assert.Equal(t, "next-token", page.NextContinuationToken)
+	assert.Equal(t, 2, page.PageDepth)
+	assert.False(t, page.IsLastPage)
+	repo.AssertExpectations(t)
+}
+
+func TestListRecords_IncludeTotal(t *testing.T) {
+	client, repo := setupTestServer(t)
+
+	repo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{IsLastPage: true}, nil).Once()
+	repo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{IsLastPage: true}, nil).Once()
+	repo.On("Count").Return(int64(42), nil)
+
+	page, err := client.ListRecords(context.Background(), ListOptions{IncludeTotal: true})
+	require.NoError(t, err)
+	require.NotNil(t, page.Total)
+	assert.Equal(t, int64(42), *page.Total)
+
+	page, err = client.ListRecords(context.Background(), ListOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, page.Total)
+	repo.AssertNumberOfCalls(t, "Count", 1)
+}
+
+func TestListRecords_ContextFirst(t *testing.T) {
+	client, repo := setupTestServer(t)
+
+	order := repository.SortOrder{Column: "updated_at", ContextFirst: true}
+	repo.On("GetPaginatedSorted", order, repository.PaginationFilter{}, "", 5).Return(&repository.PaginatedResult{IsLastPage: true}, nil)
+
+	_, err := client.ListRecords(context.Background(), ListOptions{OrderBy: "updated_at", ContextFirst: true})
+	require.NoError(t, err)
+	repo.AssertExpectations(t)
+}
+
+func TestListRecords_InvalidToken(t *testing.T) {
+	client, repo := setupTestServer(t)
+
+	repo.On("GetPaginated", "bad", 5).Return(nil, fmt.Errorf("%w format", repository.ErrInvalidToken))
+
+	_, err := client.ListRecords(context.Background(), ListOptions{ContinuationToken: "bad"})
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "continuation_token", apiErr.Field)
+}
+
+func TestListRecords_InvalidParam(t *testing.T) {
+	client, _ := setupTestServer(t)
+
+	_, err := client.ListRecords(context.Background(), ListOptions{OrderBy: "context"})
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, "order_by", apiErr.Field)
+	assert.NotErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestDeleteRecord(t *testing.T) {
+	client, repo := setupTestServer(t)
+
+	repo.On("Delete", "user-1", "user").Return(nil).Once()
+	repo.On("Delete", "user-1", "user").Return(repository.ErrNotFound)
+
+	require.NoError(t, client.DeleteRecord(context.Background(), "user", "user-1"))
+	assert.ErrorIs(t, client.DeleteRecord(context.Background(), "user", "user-1"), ErrNotFound)
+	repo.AssertExpectations(t)
+}
+
+func TestClient_SendsAPIKey(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := New(server.URL+"/", "secret")
+	require.NoError(t, client.DeleteRecord(context.Background(), "user", "user-1"))
+	assert.Equal(t, "Bearer secret", authorization)
+}
+
+func TestClient_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "")
+	client.Timeout = 10 * time.Millisecond
+	_, err := client.GetRecord(context.Background(), "user", "user-1")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+}
+
+func TestClient_NonJSONError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream unavailable", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL, "").GetRecord(context.Background(), "user", "user-1")
+	assert.EqualError(t, err, "api error 502: upstream unavailable")
+}
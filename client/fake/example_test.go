@@ -0,0 +1,48 @@
+package fake_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"tokenpagination/client"
+	"tokenpagination/client/fake"
+)
+
+// countByType is consumer code under test: it pages through every record with
+// the client and counts them by resource_type.
+func countByType(ctx context.Context, c *client.Client) (map[string]int, error) {
+	counts := map[string]int{}
+	it := c.ListAll(ctx, client.ListOptions{PageSize: 4})
+	for {
+		record, err := it.Next()
+		if errors.Is(err, client.Done) {
+			return counts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		counts[record.ResourceType]++
+	}
+}
+
+func ExampleNewServer() {
+	server := fake.NewServer()
+	defer server.Close()
+
+	// Ten fixture records, one minute apart, so the walk spans three pages
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	var records []client.Record
+	for i := 0; i < 10; i++ {
+		resourceType := []string{"user", "task"}[i%3%2]
+		records = append(records, client.Record{ResourceID: fmt.Sprintf("res-%02d", i), ResourceType: resourceType, CreatedAt: start.Add(time.Duration(i) * time.Minute)})
+	}
+	if err := server.Load(records...); err != nil {
+		panic(err)
+	}
+
+	counts, err := countByType(context.Background(), server.APIClient())
+	fmt.Println(counts, err)
+	// Output: map[task:3 user:7] <nil>
+}
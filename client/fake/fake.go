@@ -0,0 +1,169 @@
+// Package fake runs the record API in-process for tests of code using the client
+// package, without MariaDB or a running service. NewServer serves the public
+// endpoints of the real handler package over a repository.MemoryRepository, so
+// the responses, errors and continuation tokens are the service's own and a
+// consumer's pagination logic is exercised for real. Faults can be injected to
+// test how a consumer copes with failures, slow responses and throttling.
+package fake
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tokenpagination/client"
+	"tokenpagination/handler"
+	"tokenpagination/repository"
+)
+
+// Faults are injected into the requests a Server answers. The zero value
+// injects none.
+type Faults struct {
+	// ErrorRate is the fraction of requests, from 0 to 1, answered with 500
+	// Internal Server Error instead of being served.
+	ErrorRate float64
+	// Latency delays every request before it is answered.
+	Latency time.Duration
+	// ThrottleRate is the fraction of requests, from 0 to 1, answered with 429
+	// Too Many Requests instead of being served.
+	ThrottleRate float64
+	// RetryAfter is sent in the Retry-After header of throttled requests, rounded
+	// up to whole seconds. Zero sends 1.
+	RetryAfter time.Duration
+}
+
+// Server is an httptest.Server serving the record API from memory. Close it when
+// done, like any httptest.Server.
+type Server struct {
+	*httptest.Server
+	repo *repository.MemoryRepository
+
+	mu        sync.Mutex
+	faults    Faults
+	throttled int // requests still to throttle, see Throttle
+	rng       *rand.Rand
+}
+
+// NewServer starts a Server holding no records and injecting no faults. The
+// fault rates are drawn from a fixed seed, so a test sending the same requests
+// sees the same faults on every run; SetSeed changes it.
+//
+// NewServer leaves Gin's global mode alone. In Gin's default debug mode every
+// route is logged to standard output when the server starts, so tests that want
+// quiet output, or examples checking it, call gin.SetMode(gin.TestMode) first.
+func NewServer() *Server {
+	s := &Server{repo: repository.NewMemoryRepository(), rng: rand.New(rand.NewSource(1))}
+
+	r := gin.New()
+	r.Use(gin.Recovery(), s.injectFaults)
+	handler.RegisterFallbacks(r)
+	api := r.Group("/api/v1", handler.APIVersionMiddleware(), handler.JSONNamingMiddleware(handler.NamingSnake))
+	handler.RegisterRecordRoutes(api, handler.NewRecordHandler(s.repo))
+
+	s.Server = httptest.NewServer(r)
+	return s
+}
+
+// APIClient returns a client of the API served by the server. Its HTTPClient
+// is the server's Client.
+func (s *Server) APIClient() *client.Client {
+	c := client.New(s.URL, "")
+	c.HTTPClient = s.Client()
+	return c
+}
+
+// Load stores fixture records with the timestamps they carry, so that a test can
+// lay out the listings before the code under test reads them. A zero CreatedAt
+// is set to the current time and a zero UpdatedAt to CreatedAt. Either every
+// record is stored or, when one has no key or a key already stored, none is.
+func (s *Server) Load(records ...client.Record) error {
+	fixtures := make([]repository.Record, len(records))
+	for i, record := range records {
+		fixtures[i] = repository.Record{
+			ResourceID:   record.ResourceID,
+			ResourceType: record.ResourceType,
+			Context:      record.Context,
+			Metadata:     record.Metadata,
+			CreatedAt:    record.CreatedAt,
+			UpdatedAt:    record.UpdatedAt,
+		}
+	}
+	return s.repo.Load(fixtures...)
+}
+
+// Repository returns the repository the server reads and writes, for checking
+// what the code under test stored.
+func (s *Server) Repository() *repository.MemoryRepository {
+	return s.repo
+}
+
+// SetFaults replaces the faults injected into the requests that follow.
+func (s *Server) SetFaults(faults Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = faults
+}
+
+// SetSeed reseeds the draws deciding which requests fail at the fault rates.
+func (s *Server) SetSeed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rng = rand.New(rand.NewSource(seed))
+}
+
+// Throttle answers the next n requests with 429 Too Many Requests, whatever the
+// fault rates, for testing a consumer's retries deterministically.
+func (s *Server) Throttle(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.throttled = n
+}
+
+// fault draws the fault of one request: the status to answer it with instead of
+// serving it, zero for none, and the faults in effect.
+func (s *Server) fault() (status int, faults Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	faults = s.faults
+	switch {
+	case s.throttled > 0:
+		s.throttled--
+		return http.StatusTooManyRequests, faults
+	case s.rng.Float64() < faults.ThrottleRate:
+		return http.StatusTooManyRequests, faults
+	case s.rng.Float64() < faults.ErrorRate:
+		return http.StatusInternalServerError, faults
+	}
+	return 0, faults
+}
+
+// injectFaults delays and fails the requests as the current faults say.
+func (s *Server) injectFaults(c *gin.Context) {
+	status, faults := s.fault()
+
+	if faults.Latency > 0 {
+		select {
+		case <-time.After(faults.Latency):
+		case <-c.Request.Context().Done():
+			c.Abort()
+			return
+		}
+	}
+
+	switch status {
+	case http.StatusTooManyRequests:
+		retryAfter := max(int(math.Ceil(faults.RetryAfter.Seconds())), 1)
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.AbortWithStatusJSON(status, gin.H{"error": fmt.Sprintf("Too many requests, retry after %ds (injected by the fake)", retryAfter)})
+	case http.StatusInternalServerError:
+		c.AbortWithStatusJSON(status, gin.H{"error": "Internal server error (injected by the fake)"})
+	}
+}
@@ -0,0 +1,161 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tokenpagination/client"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestServer starts a server holding n records created a second apart, the
+// newest last, and closes it when the test ends.
+func newTestServer(t *testing.T, n int) *Server {
+	t.Helper()
+	server := NewServer()
+	t.Cleanup(server.Close)
+
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	records := make([]client.Record, n)
+	for i := range records {
+		records[i] = client.Record{ResourceID: fmt.Sprintf("res-%02d", i), ResourceType: "user", CreatedAt: start.Add(time.Duration(i) * time.Second)}
+	}
+	require.NoError(t, server.Load(records...))
+	return server
+}
+
+func TestServer_Paginates(t *testing.T) {
+	server := newTestServer(t, 7)
+	c := server.APIClient()
+	ctx := context.Background()
+
+	first, err := c.ListRecords(ctx, client.ListOptions{PageSize: 3})
+	require.NoError(t, err)
+	require.Len(t, first.Records, 3)
+	assert.Equal(t, "res-06", first.Records[0].ResourceID)
+	assert.NotEmpty(t, first.NextContinuationToken)
+
+	var ids []string
+	require.NoError(t, c.Pages(ctx, client.ListOptions{PageSize: 3}, func(page []client.Record) error {
+		for _, record := range page {
+			ids = append(ids, record.ResourceID)
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"res-06", "res-05", "res-04", "res-03", "res-02", "res-01", "res-00"}, ids)
+
+	second, err := c.ListRecords(ctx, client.ListOptions{PageSize: 3, ContinuationToken: first.NextContinuationToken})
+	require.NoError(t, err)
+	assert.Equal(t, 2, second.PageDepth)
+	assert.Equal(t, "res-03", second.Records[0].ResourceID)
+
+	_, err = c.ListRecords(ctx, client.ListOptions{PageSize: 3, ContinuationToken: "not a token"})
+	assert.ErrorIs(t, err, client.ErrInvalidToken)
+}
+
+func TestServer_CreateAndGet(t *testing.T) {
+	server := newTestServer(t, 0)
+	c := server.APIClient()
+	ctx := context.Background()
+
+	created, err := c.CreateRecord(ctx, client.CreateRecordRequest{ResourceID: "user-1", ResourceType: "user"})
+	require.NoError(t, err)
+	assert.False(t, created.CreatedAt.IsZero())
+
+	_, err = c.CreateRecord(ctx, client.CreateRecordRequest{ResourceID: "user-1", ResourceType: "user"})
+	assert.ErrorIs(t, err, client.ErrConflict)
+
+	record, err := c.GetRecord(ctx, "user", "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, created, record)
+
+	require.NoError(t, c.DeleteRecord(ctx, "user", "user-1"))
+	count, err := server.Repository().Count()
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestServer_LoadIsAtomic(t *testing.T) {
+	server := newTestServer(t, 2)
+
+	err := server.Load(client.Record{ResourceID: "new", ResourceType: "user"}, client.Record{ResourceID: "res-01", ResourceType: "user"})
+	assert.Error(t, err)
+
+	count, err := server.Repository().Count()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestServer_Throttle(t *testing.T) {
+	server := newTestServer(t, 1)
+	server.SetFaults(Faults{RetryAfter: 1500 * time.Millisecond})
+	server.Throttle(2)
+
+	for i := 0; i < 2; i++ {
+		resp, err := server.Client().Get(server.URL + "/api/v1/records/user/res-00")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, "2", resp.Header.Get("Retry-After"), "rounded up to whole seconds")
+	}
+
+	_, err := server.APIClient().GetRecord(context.Background(), "user", "res-00")
+	assert.NoError(t, err, "only the next n requests are throttled")
+}
+
+func TestServer_FaultRates(t *testing.T) {
+	server := newTestServer(t, 1)
+	c := server.APIClient()
+
+	server.SetFaults(Faults{ErrorRate: 1})
+	_, err := c.GetRecord(context.Background(), "user", "res-00")
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusInternalServerError, apiErr.StatusCode)
+
+	server.SetFaults(Faults{ThrottleRate: 1, ErrorRate: 1})
+	_, err = c.GetRecord(context.Background(), "user", "res-00")
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode, "throttling is drawn first")
+
+	// The same seed fails the same requests
+	outcomes := func() []bool {
+		server.SetSeed(42)
+		failed := make([]bool, 20)
+		for i := range failed {
+			_, err := c.GetRecord(context.Background(), "user", "res-00")
+			failed[i] = err != nil
+		}
+		return failed
+	}
+	server.SetFaults(Faults{ErrorRate: 0.5})
+	first := outcomes()
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+	assert.Equal(t, first, outcomes())
+}
+
+func TestServer_Latency(t *testing.T) {
+	server := newTestServer(t, 1)
+	server.SetFaults(Faults{Latency: 50 * time.Millisecond})
+
+	start := time.Now()
+	_, err := server.APIClient().GetRecord(context.Background(), "user", "res-00")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = server.APIClient().GetRecord(ctx, "user", "res-00")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
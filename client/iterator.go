@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Done is returned by Iterator.Next once every record was returned.
+var Done = errors.New("no more records")
+
+// Iterator walks every page of a listing, following next_continuation_token,
+// and returns the records one at a time. Create one with Client.ListAll.
+type Iterator struct {
+	client *Client
+	ctx    context.Context
+	opts   ListOptions
+
+	records   []Record // the rest of the current page
+	pageToken string   // the token the current page was read with
+	nextToken string   // the token of the next page to read
+	done      bool     // no page follows the current one
+}
+
+// ListAll returns an iterator over the records of every page of the listing
+// selected by opts, starting at opts.ContinuationToken when it is set. Pages are
+// read as Next needs them, each with opts.PageSize records.
+func (c *Client) ListAll(ctx context.Context, opts ListOptions) *Iterator {
+	return &Iterator{client: c, ctx: ctx, opts: opts, pageToken: opts.ContinuationToken, nextToken: opts.ContinuationToken}
+}
+
+// Next returns the next record, or Done after the last one. Before reading a
+// page it returns the error of the iterator's context if it is done. A page that
+// cannot be read is returned as its error without moving the iterator, so that
+// calling Next again retries the same page.
+func (it *Iterator) Next() (Record, error) {
+	for len(it.records) == 0 {
+		if it.done {
+			return Record{}, Done
+		}
+		if err := it.ctx.Err(); err != nil {
+			return Record{}, err
+		}
+
+		opts := it.opts
+		opts.ContinuationToken = it.nextToken
+		page, err := it.client.ListRecords(it.ctx, opts)
+		if err != nil {
+			return Record{}, err
+		}
+
+		it.records, it.pageToken = page.Records, it.nextToken
+		it.nextToken, it.done = page.NextContinuationToken, page.NextContinuationToken == ""
+	}
+
+	record := it.records[0]
+	it.records = it.records[1:]
+	return record, nil
+}
+
+// Token returns a continuation token from which a new walk, passed as
+// ListOptions.ContinuationToken, returns every record Next has not returned yet.
+// After Next failed it is the token of the page that could not be read. In the
+// middle of a page it is the token of that page, so the records of the page
+// already returned are returned again. It is empty for a walk that starts at the
+// first page.
+func (it *Iterator) Token() string {
+	if len(it.records) > 0 {
+		return it.pageToken
+	}
+	return it.nextToken
+}
+
+// WalkError is returned by Pages when a page cannot be read. Token is the
+// continuation token of that page, from which a new walk resumes; it is empty
+// for the first page.
+type WalkError struct {
+	Token string
+	Err   error
+}
+
+func (e *WalkError) Error() string {
+	return fmt.Sprintf("reading page at continuation token %q: %v", e.Token, e.Err)
+}
+
+func (e *WalkError) Unwrap() error {
+	return e.Err
+}
+
+// Pages calls fn with the records of every page of the listing selected by
+// opts, starting at opts.ContinuationToken when it is set, and returns the first
+// error of fn unchanged. It checks ctx between pages. A page that cannot be read,
+// including because ctx is done, ends the walk with a *WalkError holding the
+// token to resume from.
+func (c *Client) Pages(ctx context.Context, opts ListOptions, fn func(page []Record) error) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return &WalkError{Token: opts.ContinuationToken, Err: err}
+		}
+
+		page, err := c.ListRecords(ctx, opts)
+		if err != nil {
+			return &WalkError{Token: opts.ContinuationToken, Err: err}
+		}
+		if err := fn(page.Records); err != nil {
+			return err
+		}
+
+		if page.NextContinuationToken == "" {
+			return nil
+		}
+		opts.ContinuationToken = page.NextContinuationToken
+	}
+}
@@ -0,0 +1,195 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePages serves three pages of two, two and one records, keyed by
+// continuation token, and fails the first request for the third page with 500.
+type fakePages struct {
+	mu       sync.Mutex
+	requests []string // the continuation token of every request
+	failed   bool
+}
+
+func (f *fakePages) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	token := r.URL.Query().Get("continuation_token")
+	f.requests = append(f.requests, token)
+
+	records := func(ids ...string) []gin.H {
+		page := []gin.H{}
+		for _, id := range ids {
+			page = append(page, gin.H{"resource_id": id, "resource_type": "user"})
+		}
+		return page
+	}
+
+	var body gin.H
+	switch token {
+	case "":
+		body = gin.H{"records": records("user-1", "user-2"), "next_continuation_token": "page-2", "page_depth": 1}
+	case "page-2":
+		body = gin.H{"records": records("user-3", "user-4"), "next_continuation_token": "page-3", "page_depth": 2}
+	case "page-3":
+		if !f.failed {
+			f.failed = true
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"Failed to retrieve records"}`))
+			return
+		}
+		body = gin.H{"records": records("user-5"), "page_depth": 3, "is_last_page": true}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid continuation token format","field":"continuation_token"}`))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoded, _ := json.Marshal(body)
+	w.Write(encoded)
+}
+
+// setupFakePages returns a client for a fakePages server.
+func setupFakePages(t *testing.T) (*Client, *fakePages) {
+	pages := &fakePages{}
+	server := httptest.NewServer(pages)
+	t.Cleanup(server.Close)
+	return New(server.URL, ""), pages
+}
+
+func TestIterator_ResumesAfterServerError(t *testing.T) {
+	client, pages := setupFakePages(t)
+
+	it := client.ListAll(context.Background(), ListOptions{PageSize: 2})
+	var ids []string
+	for i := 0; i < 4; i++ {
+		record, err := it.Next()
+		require.NoError(t, err)
+		ids = append(ids, record.ResourceID)
+	}
+	assert.Equal(t, []string{"user-1", "user-2", "user-3", "user-4"}, ids)
+
+	_, err := it.Next()
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusInternalServerError, apiErr.StatusCode)
+	assert.Equal(t, "page-3", it.Token(), "the failed page is where to resume")
+
+	// Calling Next again retries the failed page
+	record, err := it.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "user-5", record.ResourceID)
+
+	_, err = it.Next()
+	assert.ErrorIs(t, err, Done)
+	_, err = it.Next()
+	assert.ErrorIs(t, err, Done)
+	assert.Equal(t, []string{"", "page-2", "page-3", "page-3"}, pages.requests)
+}
+
+func TestIterator_Token(t *testing.T) {
+	client, _ := setupFakePages(t)
+
+	it := client.ListAll(context.Background(), ListOptions{ContinuationToken: "page-2"})
+	assert.Equal(t, "page-2", it.Token())
+
+	record, err := it.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "user-3", record.ResourceID)
+	assert.Equal(t, "page-2", it.Token(), "user-4 is still unread on page 2")
+
+	_, err = it.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "page-3", it.Token())
+}
+
+func TestIterator_ContextCanceledBetweenPages(t *testing.T) {
+	client, pages := setupFakePages(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	it := client.ListAll(ctx, ListOptions{})
+	for i := 0; i < 2; i++ {
+		_, err := it.Next()
+		require.NoError(t, err)
+	}
+
+	cancel()
+	_, err := it.Next()
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, "page-2", it.Token())
+	assert.Equal(t, []string{""}, pages.requests)
+}
+
+func TestIterator_InvalidToken(t *testing.T) {
+	client, _ := setupFakePages(t)
+
+	_, err := client.ListAll(context.Background(), ListOptions{ContinuationToken: "stale"}).Next()
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestPages_ServerErrorReportsResumeToken(t *testing.T) {
+	client, _ := setupFakePages(t)
+
+	var pageIDs [][]string
+	collect := func(page []Record) error {
+		var ids []string
+		for _, record := range page {
+			ids = append(ids, record.ResourceID)
+		}
+		pageIDs = append(pageIDs, ids)
+		return nil
+	}
+
+	err := client.Pages(context.Background(), ListOptions{}, collect)
+	var walkErr *WalkError
+	require.ErrorAs(t, err, &walkErr)
+	assert.Equal(t, "page-3", walkErr.Token)
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusInternalServerError, apiErr.StatusCode)
+	assert.Equal(t, [][]string{{"user-1", "user-2"}, {"user-3", "user-4"}}, pageIDs)
+
+	require.NoError(t, client.Pages(context.Background(), ListOptions{ContinuationToken: walkErr.Token}, collect))
+	assert.Equal(t, [][]string{{"user-1", "user-2"}, {"user-3", "user-4"}, {"user-5"}}, pageIDs)
+}
+
+func TestPages_ContextCanceledBetweenPages(t *testing.T) {
+	client, pages := setupFakePages(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := client.Pages(ctx, ListOptions{}, func(page []Record) error {
+		cancel()
+		return nil
+	})
+
+	var walkErr *WalkError
+	require.ErrorAs(t, err, &walkErr)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, "page-2", walkErr.Token)
+	assert.Equal(t, []string{""}, pages.requests)
+}
+
+func TestPages_CallbackErrorStopsWalk(t *testing.T) {
+	client, pages := setupFakePages(t)
+
+	stop := errors.New("stop")
+	err := client.Pages(context.Background(), ListOptions{}, func(page []Record) error {
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, []string{""}, pages.requests)
+}
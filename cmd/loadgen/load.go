@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tokenpagination/client"
+	"tokenpagination/seed"
+)
+
+// operation is a kind of request a worker sends.
+type operation string
+
+const (
+	opCreate   operation = "create"   // POST /api/v1/records with a generated resource_id
+	opPaginate operation = "paginate" // GET /api/v1/records/paginated, the next page of the worker's walk
+	opGet      operation = "get"      // GET /api/v1/records/:resource_type/:resource_id of a record seen before
+)
+
+// operations lists the operations in report order.
+var operations = []operation{opCreate, opPaginate, opGet}
+
+func parseOperation(s string) (operation, error) {
+	for _, op := range operations {
+		if string(op) == s {
+			return op, nil
+		}
+	}
+	return "", fmt.Errorf("unknown operation '%s'", s)
+}
+
+func parsePageSize(s string) (int, error) {
+	size, err := strconv.Atoi(s)
+	if err != nil || size < 1 {
+		return 0, fmt.Errorf("page size '%s' is not a positive integer", s)
+	}
+	return size, nil
+}
+
+// weighted picks among choices in proportion to their weights.
+type weighted[T any] struct {
+	choices    []T
+	cumulative []int // cumulative[i] is the sum of the weights of choices[:i+1]
+}
+
+// parseWeights parses a comma-separated list of value=weight pairs, such as
+// "create=1,paginate=8". A value without a weight weighs 1.
+func parseWeights[T any](s string, parse func(string) (T, error)) (weighted[T], error) {
+	var w weighted[T]
+	total := 0
+	for _, pair := range strings.Split(s, ",") {
+		name, weight, found := strings.Cut(strings.TrimSpace(pair), "=")
+		n := 1
+		if found {
+			var err error
+			if n, err = strconv.Atoi(weight); err != nil || n < 0 {
+				return w, fmt.Errorf("weight '%s' is not a non-negative integer", weight)
+			}
+		}
+		value, err := parse(name)
+		if err != nil {
+			return w, err
+		}
+		if n == 0 {
+			continue
+		}
+		total += n
+		w.choices = append(w.choices, value)
+		w.cumulative = append(w.cumulative, total)
+	}
+	if total == 0 {
+		return w, errors.New("no choice has a positive weight")
+	}
+	return w, nil
+}
+
+// pick returns a choice at random.
+func (w weighted[T]) pick(rng *rand.Rand) T {
+	n := rng.Intn(w.cumulative[len(w.cumulative)-1])
+	for i, c := range w.cumulative {
+		if n < c {
+			return w.choices[i]
+		}
+	}
+	return w.choices[len(w.choices)-1]
+}
+
+// warmUp creates generated records until the table holds cfg.minRecords, and
+// returns how many it created. Generated records already stored are skipped.
+func warmUp(ctx context.Context, c *client.Client, cfg config) (int, error) {
+	page, err := c.ListRecords(ctx, client.ListOptions{PageSize: 1, IncludeTotal: true})
+	if err != nil {
+		return 0, fmt.Errorf("counting records: %w", err)
+	}
+	if page.Total == nil {
+		return 0, errors.New("the server did not report the total")
+	}
+	missing := cfg.minRecords - int(*page.Total)
+	if missing <= 0 {
+		return 0, nil
+	}
+
+	// Keys taken by other records conflict, so the generator may be asked for
+	// more than missing records, created in rounds until enough are
+	records := seed.Generate(cfg.minRecords + missing)
+	created := 0
+	for created < missing && len(records) > 0 {
+		n := min(missing-created, len(records))
+		round, err := createAll(ctx, c, records[:n], cfg.concurrency)
+		created += round
+		if err != nil {
+			return created, err
+		}
+		records = records[n:]
+	}
+	return created, nil
+}
+
+// createAll creates records with as many concurrent requests, and returns how
+// many it created. Records already stored are skipped; any other failure stops
+// it.
+func createAll(ctx context.Context, c *client.Client, records []seed.SampleRecord, concurrency int) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pending := make(chan seed.SampleRecord)
+	var created atomic.Int64
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for record := range pending {
+				_, err := c.CreateRecord(ctx, client.CreateRecordRequest{ResourceID: record.ResourceID, ResourceType: record.ResourceType, Context: record.Context})
+				switch {
+				case err == nil:
+					created.Add(1)
+				case !errors.Is(err, client.ErrConflict):
+					once.Do(func() {
+						firstErr = fmt.Errorf("creating %s/%s: %w", record.ResourceType, record.ResourceID, err)
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, record := range records {
+		select {
+		case pending <- record:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(pending)
+	wg.Wait()
+
+	if firstErr != nil {
+		return int(created.Load()), firstErr
+	}
+	return int(created.Load()), ctx.Err()
+}
+
+// runLoad runs cfg.concurrency workers for cfg.duration, or until ctx is done,
+// and reports their requests.
+func runLoad(ctx context.Context, c *client.Client, cfg config) *Report {
+	ctx, cancel := context.WithTimeout(ctx, cfg.duration)
+	defer cancel()
+
+	rec := newRecorder()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.concurrency; i++ {
+		wg.Add(1)
+		w := &worker{client: c, cfg: cfg, rec: rec, rng: rand.New(rand.NewSource(cfg.seed + int64(i)))}
+		go func() {
+			defer wg.Done()
+			w.run(ctx)
+		}()
+	}
+	wg.Wait()
+	return rec.report(cfg, time.Since(start))
+}
+
+// maxKnownKeys bounds the records a worker remembers for get operations.
+const maxKnownKeys = 1000
+
+// worker sends requests one after another. Its paginate operations walk the
+// listing page by page with a page size picked at the start of each walk, the
+// way a client reading every record would.
+type worker struct {
+	client *client.Client
+	cfg    config
+	rec    *recorder
+	rng    *rand.Rand
+
+	token    string // the continuation token of the next page, empty to start a walk
+	pageSize int
+	keys     [][2]string // resource_type and resource_id of records seen
+}
+
+func (w *worker) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		op := w.cfg.mix.pick(w.rng)
+		if op == opGet && len(w.keys) == 0 {
+			op = opPaginate
+		}
+
+		start := time.Now()
+		err := w.do(ctx, op)
+		elapsed := time.Since(start)
+		// A request cut short by the end of the run measures nothing
+		if ctx.Err() != nil {
+			return
+		}
+		w.rec.observe(op, elapsed, err)
+	}
+}
+
+func (w *worker) do(ctx context.Context, op operation) error {
+	switch op {
+	case opCreate:
+		context := fmt.Sprintf(`{"loadgen": true, "at": %d}`, time.Now().UnixNano())
+		record, err := w.client.CreateRecord(ctx, client.CreateRecordRequest{ResourceType: w.cfg.resourceType, Context: &context, GenerateID: true})
+		if err == nil {
+			w.remember(*record)
+		}
+		return err
+	case opGet:
+		key := w.keys[w.rng.Intn(len(w.keys))]
+		_, err := w.client.GetRecord(ctx, key[0], key[1])
+		return err
+	default:
+		if w.token == "" {
+			w.pageSize = w.cfg.pageSizes.pick(w.rng)
+		}
+		page, err := w.client.ListRecords(ctx, client.ListOptions{ContinuationToken: w.token, PageSize: w.pageSize})
+		if err != nil {
+			w.token = ""
+			return err
+		}
+		for _, record := range page.Records {
+			w.remember(record)
+		}
+		w.token = page.NextContinuationToken
+		return nil
+	}
+}
+
+// remember adds a record to the keys get operations read, replacing a random
+// one when the worker knows maxKnownKeys already.
+func (w *worker) remember(record client.Record) {
+	key := [2]string{record.ResourceType, record.ResourceID}
+	if len(w.keys) < maxKnownKeys {
+		w.keys = append(w.keys, key)
+		return
+	}
+	w.keys[w.rng.Intn(len(w.keys))] = key
+}
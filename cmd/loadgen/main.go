@@ -0,0 +1,153 @@
+// Command loadgen drives the record API with a configurable mix of requests and
+// reports the latency percentiles, errors by status code and throughput it
+// achieved, to find the sustained RPS a deployment serves.
+//
+//	loadgen --url http://localhost:8080 --concurrency 16 --duration 1m
+//	loadgen --mix create=1,paginate=8,get=1 --page-sizes 10=1,20=2,100=1 --json results.json
+//
+// Before the run, a table holding fewer than --min-records records is filled up
+// with generated records, so that paginated reads walk more than a page or two.
+// The server URL and API key are taken from --url and --api-key, or from the
+// LOADGEN_URL and LOADGEN_API_KEY environment variables.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"tokenpagination/client"
+)
+
+// Exit codes.
+const (
+	exitOK      = 0
+	exitFailure = 1 // the warm-up failed or the report could not be written
+	exitUsage   = 2 // invalid flags
+)
+
+// defaultURL is used when neither --url nor LOADGEN_URL is set.
+const defaultURL = "http://localhost:8080"
+
+// env provides the environment variables read by loadgen; os.Getenv in
+// production.
+type env func(key string) string
+
+// config is the run described by the flags.
+type config struct {
+	concurrency  int
+	duration     time.Duration
+	mix          weighted[operation]
+	pageSizes    weighted[int]
+	minRecords   int
+	resourceType string
+	seed         int64
+	jsonPath     string
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Getenv, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run parses the flags, warms up the dataset, runs the load and reports it.
+// Interrupting the run stops it early and still reports what was measured.
+func run(ctx context.Context, args []string, getenv env, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: loadgen [flags]")
+		fmt.Fprintln(stderr)
+		fs.PrintDefaults()
+	}
+
+	var (
+		url, apiKey, mix, pageSizes string
+		timeout                     time.Duration
+		cfg                         config
+	)
+	fs.StringVar(&url, "url", "", "base URL of the API (default LOADGEN_URL, or "+defaultURL+")")
+	fs.StringVar(&apiKey, "api-key", "", "API key sent as a bearer token (default LOADGEN_API_KEY)")
+	fs.DurationVar(&timeout, "timeout", 10*time.Second, "limit for every request, 0 for none")
+	fs.IntVar(&cfg.concurrency, "concurrency", 8, "number of workers sending requests back to back")
+	fs.DurationVar(&cfg.duration, "duration", 30*time.Second, "how long to send requests, not counting the warm-up")
+	fs.StringVar(&mix, "mix", "create=1,paginate=8,get=1", "relative weights of the operations")
+	fs.StringVar(&pageSizes, "page-sizes", "10=1,20=2,100=1", "relative weights of the page sizes a walk of the listing uses")
+	fs.IntVar(&cfg.minRecords, "min-records", 1000, "records the table must hold before the run, created by the generator when short")
+	fs.StringVar(&cfg.resourceType, "type", "loadgen", "resource_type of the records created during the run")
+	fs.Int64Var(&cfg.seed, "seed", 1, "seed of the operation and page size choices")
+	fs.StringVar(&cfg.jsonPath, "json", "", "also write the report as JSON to this file")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		return usageError(stderr, "unexpected arguments: %v", fs.Args())
+	}
+
+	var err error
+	if cfg.mix, err = parseWeights(mix, parseOperation); err != nil {
+		return usageError(stderr, "invalid --mix '%s': %v", mix, err)
+	}
+	if cfg.pageSizes, err = parseWeights(pageSizes, parsePageSize); err != nil {
+		return usageError(stderr, "invalid --page-sizes '%s': %v", pageSizes, err)
+	}
+	switch {
+	case cfg.concurrency < 1:
+		return usageError(stderr, "--concurrency must be at least 1")
+	case cfg.duration <= 0:
+		return usageError(stderr, "--duration must be positive")
+	case cfg.minRecords < 0:
+		return usageError(stderr, "--min-records cannot be negative")
+	case cfg.resourceType == "":
+		return usageError(stderr, "--type cannot be empty")
+	}
+
+	if url == "" {
+		url = getenv("LOADGEN_URL")
+	}
+	if url == "" {
+		url = defaultURL
+	}
+	if apiKey == "" {
+		apiKey = getenv("LOADGEN_API_KEY")
+	}
+	c := client.New(url, apiKey)
+	c.Timeout = timeout
+
+	created, err := warmUp(ctx, c, cfg)
+	if err != nil {
+		fmt.Fprintln(stderr, "loadgen: warm-up:", err)
+		return exitFailure
+	}
+	if created > 0 {
+		fmt.Fprintf(stderr, "Created %d records to reach --min-records %d\n", created, cfg.minRecords)
+	}
+
+	report := runLoad(ctx, c, cfg)
+	report.WriteText(stdout)
+
+	if cfg.jsonPath != "" {
+		if err := report.WriteJSONFile(cfg.jsonPath); err != nil {
+			fmt.Fprintln(stderr, "loadgen:", err)
+			return exitFailure
+		}
+	}
+	return exitOK
+}
+
+// usageError reports an invalid flag value and returns exitUsage.
+func usageError(stderr io.Writer, format string, args ...any) int {
+	fmt.Fprintf(stderr, format+"\n", args...)
+	return exitUsage
+}
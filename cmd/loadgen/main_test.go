@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tokenpagination/client"
+)
+
+// fakeAPI serves the record endpoints loadgen uses from an in-memory list of
+// records. Its continuation tokens are "offset-N". When failStatus is set, every
+// paginated read but the warm-up's count fails with it.
+type fakeAPI struct {
+	mu         sync.Mutex
+	records    []client.Record
+	failStatus int
+	generated  int
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	reply := func(status int, body any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/records"), "/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/records/paginated":
+		f.list(r, reply)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/records":
+		var req client.CreateRecordRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.GenerateID {
+			f.generated++
+			req.ResourceID = "generated-" + strconv.Itoa(f.generated)
+		}
+		if f.find(req.ResourceType, req.ResourceID) >= 0 {
+			reply(http.StatusConflict, map[string]string{"error": "Record already exists"})
+			return
+		}
+		record := client.Record{ResourceID: req.ResourceID, ResourceType: req.ResourceType, Context: req.Context, CreatedAt: time.Now().UTC()}
+		f.records = append(f.records, record)
+		reply(http.StatusCreated, record)
+	case r.Method == http.MethodGet && len(parts) == 3:
+		i := f.find(parts[1], parts[2])
+		if i < 0 {
+			reply(http.StatusNotFound, map[string]string{"error": "Record not found"})
+			return
+		}
+		reply(http.StatusOK, f.records[i])
+	default:
+		reply(http.StatusNotFound, map[string]string{"error": "Not found"})
+	}
+}
+
+func (f *fakeAPI) list(r *http.Request, reply func(int, any)) {
+	query := r.URL.Query()
+	if query.Get("include_total") == "true" {
+		total := int64(len(f.records))
+		reply(http.StatusOK, client.Page{Records: []client.Record{}, Total: &total})
+		return
+	}
+	if f.failStatus != 0 {
+		reply(f.failStatus, map[string]string{"error": "Failed to retrieve records"})
+		return
+	}
+
+	offset, _ := strconv.Atoi(strings.TrimPrefix(query.Get("continuation_token"), "offset-"))
+	pageSize, _ := strconv.Atoi(query.Get("page_size"))
+	page := client.Page{Records: f.records[min(offset, len(f.records)):min(offset+pageSize, len(f.records))], PageDepth: offset/pageSize + 1}
+	if offset+pageSize < len(f.records) {
+		page.NextContinuationToken = "offset-" + strconv.Itoa(offset+pageSize)
+	} else {
+		page.IsLastPage = true
+	}
+	reply(http.StatusOK, page)
+}
+
+func (f *fakeAPI) find(resourceType, resourceID string) int {
+	for i, record := range f.records {
+		if record.ResourceType == resourceType && record.ResourceID == resourceID {
+			return i
+		}
+	}
+	return -1
+}
+
+// runLoadgen runs loadgen with args against api, passed through LOADGEN_URL, and
+// returns its exit code and output.
+func runLoadgen(t *testing.T, api *fakeAPI, args ...string) (int, string, string) {
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	var stdout, stderr bytes.Buffer
+	getenv := func(key string) string {
+		if key == "LOADGEN_URL" {
+			return server.URL
+		}
+		return ""
+	}
+	code := run(context.Background(), args, getenv, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_Smoke(t *testing.T) {
+	api := &fakeAPI{}
+	jsonPath := filepath.Join(t.TempDir(), "results.json")
+
+	code, stdout, stderr := runLoadgen(t, api, "--duration", "300ms", "--concurrency", "4", "--min-records", "50", "--page-sizes", "5=1,20=1", "--json", jsonPath)
+
+	require.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stderr, "Created 50 records to reach --min-records 50")
+	assert.Contains(t, stdout, "OPERATION")
+	assert.Contains(t, stdout, "paginate")
+
+	encoded, err := os.ReadFile(jsonPath)
+	require.NoError(t, err)
+	var report Report
+	require.NoError(t, json.Unmarshal(encoded, &report))
+	assert.Equal(t, 4, report.Concurrency)
+	assert.Positive(t, report.Requests)
+	assert.Positive(t, report.RPS)
+	assert.Zero(t, report.Errors)
+
+	ops := map[string]OperationStats{}
+	for _, op := range report.Operations {
+		ops[op.Operation] = op
+		assert.LessOrEqual(t, op.P50Ms, op.P95Ms)
+		assert.LessOrEqual(t, op.P95Ms, op.P99Ms)
+		assert.LessOrEqual(t, op.P99Ms, op.MaxMs)
+	}
+	require.Contains(t, ops, "paginate")
+	assert.Equal(t, report.Requests, ops["create"].Requests+ops["paginate"].Requests+ops["get"].Requests)
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	// A create cut short by the end of the run is not counted but may be stored
+	assert.GreaterOrEqual(t, len(api.records), 50+ops["create"].Requests, "the warm-up and every create stored a record")
+}
+
+func TestRun_WarmUpSkipsFullTable(t *testing.T) {
+	api := &fakeAPI{records: []client.Record{{ResourceType: "user", ResourceID: "user-1"}}}
+
+	code, _, stderr := runLoadgen(t, api, "--duration", "50ms", "--concurrency", "1", "--min-records", "1", "--mix", "paginate")
+
+	require.Equal(t, exitOK, code, stderr)
+	assert.NotContains(t, stderr, "Created")
+}
+
+func TestRun_CountsErrorsByStatus(t *testing.T) {
+	api := &fakeAPI{failStatus: http.StatusServiceUnavailable}
+
+	code, stdout, stderr := runLoadgen(t, api, "--duration", "100ms", "--concurrency", "2", "--min-records", "0", "--mix", "paginate")
+
+	require.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stdout, "503=")
+	assert.Contains(t, stdout, "(100.00%)")
+}
+
+func TestRun_InvalidFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"--mix", "create=1,delete=1"},
+		{"--mix", "create=0"},
+		{"--page-sizes", "ten"},
+		{"--concurrency", "0"},
+		{"--duration", "0s"},
+		{"extra"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			code, _, _ := runLoadgen(t, &fakeAPI{}, args...)
+			assert.Equal(t, exitUsage, code)
+		})
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	mix, err := parseWeights("create=1, paginate=3,get", parseOperation)
+	require.NoError(t, err)
+	assert.Equal(t, []operation{opCreate, opPaginate, opGet}, mix.choices)
+	assert.Equal(t, []int{1, 4, 5}, mix.cumulative)
+
+	counts := map[operation]int{}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		counts[mix.pick(rng)]++
+	}
+	assert.InDelta(t, 3000, counts[opPaginate], 150)
+	assert.InDelta(t, 1000, counts[opCreate], 150)
+
+	_, err = parseWeights("10=-1", parsePageSize)
+	assert.Error(t, err)
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	assert.Equal(t, 50*time.Millisecond, percentile(sorted, 50))
+	assert.Equal(t, 95*time.Millisecond, percentile(sorted, 95))
+	assert.Equal(t, 99*time.Millisecond, percentile(sorted, 99))
+	assert.Equal(t, 7*time.Millisecond, percentile([]time.Duration{7 * time.Millisecond}, 99))
+}
+
+func TestFormatErrors(t *testing.T) {
+	assert.Equal(t, "-", formatErrors(nil))
+	assert.Equal(t, fmt.Sprintf("404=2 500=1 %s=3", transportError), formatErrors(map[string]int{transportError: 3, "500": 1, "404": 2}))
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"tokenpagination/client"
+)
+
+// transportError is the status under which requests that got no response, or an
+// unreadable one, are counted.
+const transportError = "transport"
+
+// recorder collects the latency and outcome of every request of the workers.
+type recorder struct {
+	mu        sync.Mutex
+	latencies map[operation][]time.Duration
+	errors    map[operation]map[string]int // by status code, or transportError
+}
+
+func newRecorder() *recorder {
+	return &recorder{latencies: map[operation][]time.Duration{}, errors: map[operation]map[string]int{}}
+}
+
+// observe records a request of op that took elapsed and failed with err, or
+// succeeded when err is nil.
+func (r *recorder) observe(op operation, elapsed time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latencies[op] = append(r.latencies[op], elapsed)
+	if err == nil {
+		return
+	}
+
+	status := transportError
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		status = strconv.Itoa(apiErr.StatusCode)
+	}
+	if r.errors[op] == nil {
+		r.errors[op] = map[string]int{}
+	}
+	r.errors[op][status]++
+}
+
+// Report is the outcome of a run, written as text or as JSON for trend tracking.
+// Latencies are in milliseconds and include failed requests.
+type Report struct {
+	Concurrency int              `json:"concurrency"`
+	DurationSec float64          `json:"duration_seconds"`
+	Requests    int              `json:"requests"`
+	Errors      int              `json:"errors"`
+	RPS         float64          `json:"rps"`
+	ErrorRate   float64          `json:"error_rate"`
+	Operations  []OperationStats `json:"operations"`
+}
+
+// OperationStats are the requests of one operation.
+type OperationStats struct {
+	Operation      string         `json:"operation"`
+	Requests       int            `json:"requests"`
+	Errors         int            `json:"errors"`
+	ErrorsByStatus map[string]int `json:"errors_by_status,omitempty"`
+	RPS            float64        `json:"rps"`
+	P50Ms          float64        `json:"p50_ms"`
+	P95Ms          float64        `json:"p95_ms"`
+	P99Ms          float64        `json:"p99_ms"`
+	MaxMs          float64        `json:"max_ms"`
+}
+
+// report summarizes the requests recorded over elapsed.
+func (r *recorder) report(cfg config, elapsed time.Duration) *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &Report{Concurrency: cfg.concurrency, DurationSec: elapsed.Seconds(), Operations: []OperationStats{}}
+	for _, op := range operations {
+		latencies := r.latencies[op]
+		if len(latencies) == 0 {
+			continue
+		}
+		slices.Sort(latencies)
+
+		stats := OperationStats{
+			Operation: string(op),
+			Requests:  len(latencies),
+			RPS:       rate(len(latencies), elapsed),
+			P50Ms:     milliseconds(percentile(latencies, 50)),
+			P95Ms:     milliseconds(percentile(latencies, 95)),
+			P99Ms:     milliseconds(percentile(latencies, 99)),
+			MaxMs:     milliseconds(latencies[len(latencies)-1]),
+		}
+		if byStatus := r.errors[op]; len(byStatus) > 0 {
+			stats.ErrorsByStatus = byStatus
+			for _, n := range byStatus {
+				stats.Errors += n
+			}
+		}
+		report.Operations = append(report.Operations, stats)
+		report.Requests += stats.Requests
+		report.Errors += stats.Errors
+	}
+
+	report.RPS = rate(report.Requests, elapsed)
+	if report.Requests > 0 {
+		report.ErrorRate = float64(report.Errors) / float64(report.Requests)
+	}
+	return report
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func rate(n int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / elapsed.Seconds()
+}
+
+// WriteText writes the report as a table with a line per operation.
+func (r *Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "%d requests in %.1fs with %d workers: %.1f req/s, %d errors (%.2f%%)\n\n",
+		r.Requests, r.DurationSec, r.Concurrency, r.RPS, r.Errors, 100*r.ErrorRate)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPERATION\tREQUESTS\tREQ/S\tP50\tP95\tP99\tMAX\tERRORS")
+	for _, op := range r.Operations {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%s\n",
+			op.Operation, op.Requests, op.RPS, op.P50Ms, op.P95Ms, op.P99Ms, op.MaxMs, formatErrors(op.ErrorsByStatus))
+	}
+	tw.Flush()
+}
+
+// formatErrors lists errors by status as "500=3 transport=1", or "-" for none.
+func formatErrors(byStatus map[string]int) string {
+	if len(byStatus) == 0 {
+		return "-"
+	}
+	statuses := make([]string, 0, len(byStatus))
+	for status := range byStatus {
+		statuses = append(statuses, status)
+	}
+	slices.Sort(statuses)
+
+	s := ""
+	for i, status := range statuses {
+		if i > 0 {
+			s += " "
+		}
+		s += fmt.Sprintf("%s=%d", status, byStatus[status])
+	}
+	return s
+}
+
+// WriteJSONFile writes the report as indented JSON to path.
+func (r *Report) WriteJSONFile(path string) error {
+	encoded, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(encoded, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing the JSON report: %w", err)
+	}
+	return nil
+}
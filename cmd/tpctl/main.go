@@ -0,0 +1,209 @@
+// Command tpctl queries and manages records through the record API from a
+// terminal, following continuation tokens for you.
+//
+//	tpctl list --all --type user --output table
+//	tpctl get user user-42
+//	tpctl create --type task --context '{"priority":"low"}' --generate-id
+//	tpctl delete user user-42
+//	tpctl export --out records.ndjson
+//
+// The server URL and API key are taken from --url and --api-key, or from the
+// TPCTL_URL and TPCTL_API_KEY environment variables.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"tokenpagination/client"
+)
+
+// Exit codes, so that scripts can tell a missing record from a server outage
+// without parsing messages.
+const (
+	exitOK          = 0
+	exitFailure     = 1 // the server could not be reached or the response was unreadable
+	exitUsage       = 2 // unknown command, invalid flags or arguments
+	exitNotFound    = 3 // the record does not exist
+	exitConflict    = 4 // the record already exists
+	exitRejected    = 5 // the server rejected the request, e.g. an invalid parameter or token
+	exitServerError = 6 // the server failed with a 5xx status
+)
+
+// defaultURL is used when neither --url nor TPCTL_URL is set.
+const defaultURL = "http://localhost:8080"
+
+// env provides the environment variables read by the commands; os.Getenv in
+// production.
+type env func(key string) string
+
+// command is a subcommand of tpctl. run receives the arguments following the
+// command name and returns the process exit code.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string, getenv env, stdout, stderr io.Writer) int
+}
+
+var commands = []command{
+	{name: "list", summary: "list records, one page or with --all every page", run: runList},
+	{name: "get", summary: "show one record", run: runGet},
+	{name: "create", summary: "create a record", run: runCreate},
+	{name: "delete", summary: "delete one record", run: runDelete},
+	{name: "export", summary: "write every record to a file as NDJSON", run: runExport},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Getenv, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run runs the command named by args[0] with the remaining arguments.
+func run(ctx context.Context, args []string, getenv env, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		printUsage(stderr)
+		return exitUsage
+	}
+
+	name, args := args[0], args[1:]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		printUsage(stderr)
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(ctx, args, getenv, stdout, stderr)
+		}
+	}
+
+	fmt.Fprintf(stderr, "unknown command '%s'\n\n", name)
+	printUsage(stderr)
+	return exitUsage
+}
+
+// printUsage lists the commands.
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: tpctl <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-7s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'tpctl <command> -h' for the flags of a command.")
+}
+
+// newFlagSet returns a flag set for the command that reports errors to stderr
+// instead of exiting, with the --url, --api-key and --timeout flags every
+// command shares. usage describes the arguments after the command name.
+func newFlagSet(cmd, usage string, stderr io.Writer) (*flag.FlagSet, *clientFlags) {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: tpctl %s %s\n\n", cmd, usage)
+		fs.PrintDefaults()
+	}
+
+	var flags clientFlags
+	fs.StringVar(&flags.url, "url", "", "base URL of the API (default TPCTL_URL, or "+defaultURL+")")
+	fs.StringVar(&flags.apiKey, "api-key", "", "API key sent as a bearer token (default TPCTL_API_KEY)")
+	fs.DurationVar(&flags.timeout, "timeout", 30*time.Second, "limit for every request, 0 for none")
+	return fs, &flags
+}
+
+// clientFlags are the connection flags shared by every command.
+type clientFlags struct {
+	url     string
+	apiKey  string
+	timeout time.Duration
+}
+
+// client returns a client for the flags, falling back to the environment for
+// the URL and API key. The key is never a flag default, so that -h does not
+// print it.
+func (f *clientFlags) client(getenv env) *client.Client {
+	url, apiKey := f.url, f.apiKey
+	if url == "" {
+		url = getenv("TPCTL_URL")
+	}
+	if url == "" {
+		url = defaultURL
+	}
+	if apiKey == "" {
+		apiKey = getenv("TPCTL_API_KEY")
+	}
+
+	c := client.New(url, apiKey)
+	c.Timeout = f.timeout
+	return c
+}
+
+// parseArgs parses args into fs, allowing flags after the positional arguments,
+// and returns exactly want positional arguments. When ok is false parsing
+// failed or help was requested, and the command should exit with code.
+func parseArgs(fs *flag.FlagSet, args []string, want int) (positional []string, code int, ok bool) {
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, exitOK, false
+			}
+			return nil, exitUsage, false
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(positional) != want {
+		if len(positional) > want {
+			fmt.Fprintf(fs.Output(), "unexpected arguments: %s\n", strings.Join(positional[want:], " "))
+		} else {
+			fmt.Fprintf(fs.Output(), "expected %d arguments, got %d\n", want, len(positional))
+		}
+		fs.Usage()
+		return nil, exitUsage, false
+	}
+	return positional, exitOK, true
+}
+
+// usageError reports a flag value that is invalid in combination with others,
+// and returns exitUsage.
+func usageError(stderr io.Writer, format string, args ...any) int {
+	fmt.Fprintf(stderr, format+"\n", args...)
+	return exitUsage
+}
+
+// fail reports err and returns the exit code it maps to.
+func fail(stderr io.Writer, err error) int {
+	fmt.Fprintln(stderr, "tpctl:", err)
+	return exitCode(err)
+}
+
+// exitCode maps an error of the client to an exit code.
+func exitCode(err error) int {
+	var apiErr *client.APIError
+	switch {
+	case errors.Is(err, client.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, client.ErrConflict):
+		return exitConflict
+	case errors.As(err, &apiErr) && apiErr.StatusCode >= 500:
+		return exitServerError
+	case errors.As(err, &apiErr):
+		return exitRejected
+	}
+	return exitFailure
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tokenpagination/client"
+)
+
+// fakeAPI serves the record endpoints tpctl uses from an in-memory list of
+// records. Its continuation tokens are "offset-N", and a page read with the
+// token in failToken fails with 500.
+type fakeAPI struct {
+	mu        sync.Mutex
+	records   []client.Record
+	failToken string
+	auth      string // the Authorization header of the last request
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auth = r.Header.Get("Authorization")
+
+	reply := func(status int, body any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/records"), "/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/records/paginated":
+		f.list(r, reply)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/records":
+		var record client.Record
+		json.NewDecoder(r.Body).Decode(&record)
+		if f.find(record.ResourceType, record.ResourceID) >= 0 {
+			reply(http.StatusConflict, map[string]string{"error": "Record already exists"})
+			return
+		}
+		record.CreatedAt = time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+		record.UpdatedAt = record.CreatedAt
+		f.records = append(f.records, record)
+		reply(http.StatusCreated, record)
+	case len(parts) == 3 && (r.Method == http.MethodGet || r.Method == http.MethodDelete):
+		i := f.find(parts[1], parts[2])
+		if i < 0 {
+			reply(http.StatusNotFound, map[string]string{"error": "Record not found"})
+			return
+		}
+		if r.Method == http.MethodGet {
+			reply(http.StatusOK, f.records[i])
+			return
+		}
+		f.records = append(f.records[:i], f.records[i+1:]...)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		reply(http.StatusNotFound, map[string]string{"error": "Not found"})
+	}
+}
+
+func (f *fakeAPI) list(r *http.Request, reply func(int, any)) {
+	token := r.URL.Query().Get("continuation_token")
+	if token != "" && token == f.failToken {
+		reply(http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve records"})
+		return
+	}
+
+	offset := 0
+	if token != "" {
+		var err error
+		if offset, err = strconv.Atoi(strings.TrimPrefix(token, "offset-")); err != nil || !strings.HasPrefix(token, "offset-") {
+			reply(http.StatusBadRequest, map[string]string{"error": "invalid continuation token format", "field": "continuation_token"})
+			return
+		}
+	}
+	pageSize := 2
+	if size := r.URL.Query().Get("page_size"); size != "" {
+		pageSize, _ = strconv.Atoi(size)
+	}
+
+	matching := []client.Record{}
+	for _, record := range f.records {
+		if resourceType := r.URL.Query().Get("resource_type"); resourceType == "" || record.ResourceType == resourceType {
+			matching = append(matching, record)
+		}
+	}
+
+	page := client.Page{Records: matching[min(offset, len(matching)):min(offset+pageSize, len(matching))], PageDepth: offset/pageSize + 1}
+	if offset+pageSize < len(matching) {
+		page.NextContinuationToken = "offset-" + strconv.Itoa(offset+pageSize)
+	} else {
+		page.IsLastPage = true
+	}
+	reply(http.StatusOK, page)
+}
+
+func (f *fakeAPI) find(resourceType, resourceID string) int {
+	for i, record := range f.records {
+		if record.ResourceType == resourceType && record.ResourceID == resourceID {
+			return i
+		}
+	}
+	return -1
+}
+
+// setupFakeAPI starts a fakeAPI holding three users and two tasks, the first
+// user with a long context.
+func setupFakeAPI(t *testing.T) (*fakeAPI, string) {
+	long := `{"description": "a context far longer than the table column allows"}`
+	short := `{"a":1}`
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	api := &fakeAPI{records: []client.Record{
+		{ResourceType: "user", ResourceID: "user-1", Context: &long, CreatedAt: created},
+		{ResourceType: "user", ResourceID: "user-2", Context: &short, CreatedAt: created},
+		{ResourceType: "task", ResourceID: "task-1", CreatedAt: created},
+		{ResourceType: "user", ResourceID: "user-3", CreatedAt: created},
+		{ResourceType: "task", ResourceID: "task-2", CreatedAt: created},
+	}}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	return api, server.URL
+}
+
+// runTpctl runs tpctl with args against url, passed through TPCTL_URL, and
+// returns its exit code and output.
+func runTpctl(url string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	getenv := func(key string) string {
+		if key == "TPCTL_URL" {
+			return url
+		}
+		return ""
+	}
+	code := run(context.Background(), args, getenv, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// recordIDs returns the resource_ids of NDJSON output.
+func recordIDs(t *testing.T, ndjson string) []string {
+	var ids []string
+	for _, line := range strings.Split(strings.TrimSpace(ndjson), "\n") {
+		var record client.Record
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		ids = append(ids, record.ResourceID)
+	}
+	return ids
+}
+
+func TestList_OnePage(t *testing.T) {
+	_, url := setupFakeAPI(t)
+
+	code, stdout, stderr := runTpctl(url, "list")
+
+	assert.Equal(t, exitOK, code)
+	var records []client.Record
+	require.NoError(t, json.Unmarshal([]byte(stdout), &records))
+	require.Len(t, records, 2)
+	assert.Equal(t, "user-1", records[0].ResourceID)
+	assert.Equal(t, "More records follow: tpctl list --token offset-2\n", stderr)
+}
+
+func TestList_AllFollowsTokens(t *testing.T) {
+	_, url := setupFakeAPI(t)
+
+	code, stdout, stderr := runTpctl(url, "list", "--all", "--output", "ndjson", "--type", "user", "--page-size", "1")
+
+	assert.Equal(t, exitOK, code)
+	assert.Empty(t, stderr)
+	assert.Equal(t, []string{"user-1", "user-2", "user-3"}, recordIDs(t, stdout))
+}
+
+func TestList_AllReportsResumeToken(t *testing.T) {
+	api, url := setupFakeAPI(t)
+	api.failToken = "offset-4"
+
+	code, stdout, stderr := runTpctl(url, "list", "--all", "--output", "ndjson")
+
+	assert.Equal(t, exitServerError, code)
+	assert.Equal(t, []string{"user-1", "user-2", "task-1", "user-3"}, recordIDs(t, stdout), "the pages read before the failure are printed")
+	assert.Contains(t, stderr, "resume with: tpctl list --all --token offset-4")
+}
+
+func TestList_Table(t *testing.T) {
+	_, url := setupFakeAPI(t)
+
+	code, stdout, _ := runTpctl(url, "list", "--output", "table")
+
+	assert.Equal(t, exitOK, code)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"RESOURCE_TYPE", "RESOURCE_ID", "CREATED_AT", "CONTEXT"}, strings.Fields(lines[0]))
+	assert.True(t, strings.HasSuffix(lines[1], `{"description": "a context far longer t…`), lines[1])
+	assert.True(t, strings.HasSuffix(lines[2], `{"a":1}`), lines[2])
+
+	code, stdout, _ = runTpctl(url, "list", "--output", "table", "--full")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `{"description": "a context far longer than the table column allows"}`)
+}
+
+func TestList_InvalidToken(t *testing.T) {
+	_, url := setupFakeAPI(t)
+
+	code, _, stderr := runTpctl(url, "list", "--token", "stale")
+
+	assert.Equal(t, exitRejected, code)
+	assert.Contains(t, stderr, "invalid continuation token format")
+}
+
+func TestGet(t *testing.T) {
+	_, url := setupFakeAPI(t)
+
+	code, stdout, _ := runTpctl(url, "get", "user", "user-2")
+	assert.Equal(t, exitOK, code)
+	var record client.Record
+	require.NoError(t, json.Unmarshal([]byte(stdout), &record))
+	assert.Equal(t, "user-2", record.ResourceID)
+
+	// Flags may follow the arguments
+	code, stdout, _ = runTpctl(url, "get", "user", "user-2", "--output", "table")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "RESOURCE_TYPE")
+
+	code, _, stderr := runTpctl(url, "get", "user", "nope")
+	assert.Equal(t, exitNotFound, code)
+	assert.Contains(t, stderr, "Record not found")
+}
+
+func TestCreate(t *testing.T) {
+	api, url := setupFakeAPI(t)
+
+	code, stdout, _ := runTpctl(url, "create", "--type", "user", "--id", "user-9", "--context", `{"a":2}`, "--metadata", "tier=gold", "--metadata", "region=eu")
+	assert.Equal(t, exitOK, code)
+	var record client.Record
+	require.NoError(t, json.Unmarshal([]byte(stdout), &record))
+	assert.Equal(t, "user-9", record.ResourceID)
+	assert.Equal(t, map[string]string{"tier": "gold", "region": "eu"}, record.Metadata)
+	assert.Len(t, api.records, 6)
+
+	code, _, stderr := runTpctl(url, "create", "--type", "user", "--id", "user-9")
+	assert.Equal(t, exitConflict, code)
+	assert.Contains(t, stderr, "Record already exists")
+}
+
+func TestDelete(t *testing.T) {
+	api, url := setupFakeAPI(t)
+
+	code, stdout, _ := runTpctl(url, "delete", "task", "task-1")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "Deleted task/task-1\n", stdout)
+	assert.Len(t, api.records, 4)
+
+	code, _, _ = runTpctl(url, "delete", "task", "task-1")
+	assert.Equal(t, exitNotFound, code)
+}
+
+func TestExport(t *testing.T) {
+	_, url := setupFakeAPI(t)
+	out := filepath.Join(t.TempDir(), "records.ndjson")
+
+	code, stdout, _ := runTpctl(url, "export", "--out", out, "--page-size", "2")
+
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "Exported 5 records to "+out)
+	written, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user-1", "user-2", "task-1", "user-3", "task-2"}, recordIDs(t, string(written)))
+}
+
+func TestExport_FailureLeavesNoFile(t *testing.T) {
+	api, url := setupFakeAPI(t)
+	api.failToken = "offset-2"
+	dir := t.TempDir()
+
+	code, _, _ := runTpctl(url, "export", "--out", filepath.Join(dir, "records.ndjson"), "--page-size", "2")
+
+	assert.Equal(t, exitServerError, code)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestClientFlags(t *testing.T) {
+	api, url := setupFakeAPI(t)
+
+	// --url and --api-key take precedence over the environment
+	var stdout, stderr bytes.Buffer
+	getenv := func(key string) string {
+		return map[string]string{"TPCTL_URL": "http://127.0.0.1:1", "TPCTL_API_KEY": "from-env"}[key]
+	}
+	code := run(context.Background(), []string{"get", "user", "user-1", "--url", url, "--api-key", "secret"}, getenv, &stdout, &stderr)
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "Bearer secret", api.auth)
+
+	code = run(context.Background(), []string{"get", "user", "user-1", "--url", url}, getenv, &stdout, &stderr)
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "Bearer from-env", api.auth)
+
+	// An unreachable server is a plain failure
+	code = run(context.Background(), []string{"get", "user", "user-1"}, getenv, &stdout, &stderr)
+	assert.Equal(t, exitFailure, code)
+}
+
+func TestUsageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "no command", args: nil, want: "Usage: tpctl <command>"},
+		{name: "unknown command", args: []string{"lst"}, want: "unknown command 'lst'"},
+		{name: "unknown flag", args: []string{"list", "--color"}, want: "flag provided but not defined: -color"},
+		{name: "invalid output", args: []string{"list", "--output", "yaml"}, want: "invalid --output 'yaml'"},
+		{name: "missing argument", args: []string{"get", "user"}, want: "expected 2 arguments, got 1"},
+		{name: "extra argument", args: []string{"delete", "user", "user-1", "user-2"}, want: "unexpected arguments: user-2"},
+		{name: "create without type", args: []string{"create", "--id", "x"}, want: "--type is required"},
+		{name: "create with both ids", args: []string{"create", "--type", "user", "--id", "x", "--generate-id"}, want: "--id cannot be combined with --generate-id"},
+		{name: "invalid metadata", args: []string{"create", "--type", "user", "--id", "x", "--metadata", "tier"}, want: "must be key=value, got 'tier'"},
+		{name: "export without out", args: []string{"export"}, want: "--out is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runTpctl("http://127.0.0.1:1", tt.args...)
+
+			assert.Equal(t, exitUsage, code)
+			assert.Empty(t, stdout)
+			assert.Contains(t, stderr, tt.want)
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", truncate("short", 10))
+	assert.Equal(t, "exactly 10", truncate("exactly 10", 10))
+	assert.Equal(t, "one line…", truncate("one\nline that is long", 9))
+	assert.Equal(t, "äöü…", truncate("äöüßäöü", 4))
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"tokenpagination/client"
+)
+
+// Output formats of the commands printing records.
+const (
+	outputJSON   = "json"   // an indented JSON array, or object for a single record
+	outputTable  = "table"  // aligned columns with long contexts truncated
+	outputNDJSON = "ndjson" // one JSON record per line
+)
+
+// contextWidth is the most characters of a context shown in table output
+// without --full.
+const contextWidth = 40
+
+// outputFlags are the flags selecting how records are printed.
+type outputFlags struct {
+	format string
+	full   bool
+}
+
+func addOutputFlags(fs *flag.FlagSet) *outputFlags {
+	var flags outputFlags
+	fs.StringVar(&flags.format, "output", outputJSON, "output format: json, table or ndjson")
+	fs.BoolVar(&flags.full, "full", false, "show contexts in full in table output")
+	return &flags
+}
+
+func (f *outputFlags) validate() error {
+	switch f.format {
+	case outputJSON, outputTable, outputNDJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid --output '%s': must be json, table or ndjson", f.format)
+}
+
+// recordWriter prints records in an output format. NDJSON lines are written as
+// the records arrive; JSON output and the aligned table are written by close.
+type recordWriter struct {
+	format string
+	full   bool
+	w      io.Writer
+	table  *tabwriter.Writer
+	json   []client.Record
+}
+
+func newRecordWriter(w io.Writer, flags *outputFlags) *recordWriter {
+	rw := &recordWriter{format: flags.format, full: flags.full, w: w, json: []client.Record{}}
+	if rw.format == outputTable {
+		rw.table = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(rw.table, "RESOURCE_TYPE\tRESOURCE_ID\tCREATED_AT\tCONTEXT")
+	}
+	return rw
+}
+
+func (rw *recordWriter) write(record client.Record) error {
+	switch rw.format {
+	case outputTable:
+		shown := ""
+		if record.Context != nil {
+			shown = *record.Context
+			if !rw.full {
+				shown = truncate(shown, contextWidth)
+			}
+		}
+		_, err := fmt.Fprintf(rw.table, "%s\t%s\t%s\t%s\n", record.ResourceType, record.ResourceID, record.CreatedAt.Format(time.RFC3339), shown)
+		return err
+	case outputNDJSON:
+		return json.NewEncoder(rw.w).Encode(record)
+	default:
+		rw.json = append(rw.json, record)
+		return nil
+	}
+}
+
+func (rw *recordWriter) close() error {
+	switch rw.format {
+	case outputTable:
+		return rw.table.Flush()
+	case outputNDJSON:
+		return nil
+	default:
+		return writeJSON(rw.w, rw.json)
+	}
+}
+
+// writeRecord prints a single record, as an object in JSON output.
+func writeRecord(w io.Writer, flags *outputFlags, record client.Record) error {
+	if flags.format == outputJSON {
+		return writeJSON(w, record)
+	}
+	rw := newRecordWriter(w, flags)
+	if err := rw.write(record); err != nil {
+		return err
+	}
+	return rw.close()
+}
+
+// writeJSON prints v as indented JSON.
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// truncate shortens s to at most width characters, marking the cut with an
+// ellipsis. Newlines are shown as spaces so that a record stays on one row.
+func truncate(s string, width int) string {
+	s = strings.NewReplacer("\r\n", " ", "\n", " ", "\t", " ").Replace(s)
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
+
+// runList prints a page of records, or with --all every page. The token of the
+// next page is reported on stderr, so that stdout holds only records.
+func runList(ctx context.Context, args []string, getenv env, stdout, stderr io.Writer) int {
+	fs, conn := newFlagSet("list", "[flags]", stderr)
+	all := fs.Bool("all", false, "follow continuation tokens and list every page")
+	var opts client.ListOptions
+	fs.StringVar(&opts.ResourceType, "type", "", "only list records of this resource_type")
+	fs.IntVar(&opts.PageSize, "page-size", 0, "records per page (default the server's)")
+	fs.StringVar(&opts.ContinuationToken, "token", "", "continuation token of the page to start at")
+	output := addOutputFlags(fs)
+
+	if _, code, ok := parseArgs(fs, args, 0); !ok {
+		return code
+	}
+	if err := output.validate(); err != nil {
+		return usageError(stderr, "%v", err)
+	}
+	if opts.PageSize < 0 {
+		return usageError(stderr, "--page-size must not be negative")
+	}
+
+	c := conn.client(getenv)
+	rw := newRecordWriter(stdout, output)
+	if !*all {
+		page, err := c.ListRecords(ctx, opts)
+		if err != nil {
+			return fail(stderr, err)
+		}
+		for _, record := range page.Records {
+			if err := rw.write(record); err != nil {
+				return fail(stderr, err)
+			}
+		}
+		if err := rw.close(); err != nil {
+			return fail(stderr, err)
+		}
+		if page.NextContinuationToken != "" {
+			fmt.Fprintf(stderr, "More records follow: tpctl list --token %s\n", page.NextContinuationToken)
+		}
+		return exitOK
+	}
+
+	err := c.Pages(ctx, opts, func(page []client.Record) error {
+		for _, record := range page {
+			if err := rw.write(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	// Print what was read even when a later page failed
+	if closeErr := rw.close(); err == nil {
+		err = closeErr
+	}
+	var walkErr *client.WalkError
+	if errors.As(err, &walkErr) && walkErr.Token != "" {
+		fmt.Fprintf(stderr, "Listing stopped, resume with: tpctl list --all --token %s\n", walkErr.Token)
+	}
+	if err != nil {
+		return fail(stderr, err)
+	}
+	return exitOK
+}
+
+// runGet prints one record.
+func runGet(ctx context.Context, args []string, getenv env, stdout, stderr io.Writer) int {
+	fs, conn := newFlagSet("get", "[flags] <resource_type> <resource_id>", stderr)
+	output := addOutputFlags(fs)
+
+	key, code, ok := parseArgs(fs, args, 2)
+	if !ok {
+		return code
+	}
+	if err := output.validate(); err != nil {
+		return usageError(stderr, "%v", err)
+	}
+
+	record, err := conn.client(getenv).GetRecord(ctx, key[0], key[1])
+	if err != nil {
+		return fail(stderr, err)
+	}
+	if err := writeRecord(stdout, output, *record); err != nil {
+		return fail(stderr, err)
+	}
+	return exitOK
+}
+
+// metadataFlag collects repeated --metadata key=value flags.
+type metadataFlag map[string]string
+
+func (m metadataFlag) String() string {
+	pairs := make([]string, 0, len(m))
+	for key, value := range m {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m metadataFlag) Set(pair string) error {
+	key, value, ok := strings.Cut(pair, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("must be key=value, got '%s'", pair)
+	}
+	m[key] = value
+	return nil
+}
+
+// runCreate creates a record and prints it as stored.
+func runCreate(ctx context.Context, args []string, getenv env, stdout, stderr io.Writer) int {
+	fs, conn := newFlagSet("create", "[flags]", stderr)
+	var req client.CreateRecordRequest
+	var recordContext string
+	metadata := metadataFlag{}
+	fs.StringVar(&req.ResourceType, "type", "", "resource_type of the record (required)")
+	fs.StringVar(&req.ResourceID, "id", "", "resource_id of the record")
+	fs.BoolVar(&req.GenerateID, "generate-id", false, "have the server generate a UUID resource_id")
+	fs.StringVar(&recordContext, "context", "", "context of the record, usually JSON")
+	fs.Var(metadata, "metadata", "metadata entry as key=value, may be repeated")
+	output := addOutputFlags(fs)
+
+	if _, code, ok := parseArgs(fs, args, 0); !ok {
+		return code
+	}
+	if err := output.validate(); err != nil {
+		return usageError(stderr, "%v", err)
+	}
+	switch {
+	case req.ResourceType == "":
+		return usageError(stderr, "--type is required")
+	case req.ResourceID == "" && !req.GenerateID:
+		return usageError(stderr, "--id or --generate-id is required")
+	case req.ResourceID != "" && req.GenerateID:
+		return usageError(stderr, "--id cannot be combined with --generate-id")
+	}
+	if recordContext != "" {
+		req.Context = &recordContext
+	}
+	if len(metadata) > 0 {
+		req.Metadata = metadata
+	}
+
+	record, err := conn.client(getenv).CreateRecord(ctx, req)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	if err := writeRecord(stdout, output, *record); err != nil {
+		return fail(stderr, err)
+	}
+	return exitOK
+}
+
+// runDelete deletes one record.
+func runDelete(ctx context.Context, args []string, getenv env, stdout, stderr io.Writer) int {
+	fs, conn := newFlagSet("delete", "[flags] <resource_type> <resource_id>", stderr)
+
+	key, code, ok := parseArgs(fs, args, 2)
+	if !ok {
+		return code
+	}
+
+	if err := conn.client(getenv).DeleteRecord(ctx, key[0], key[1]); err != nil {
+		return fail(stderr, err)
+	}
+	fmt.Fprintf(stdout, "Deleted %s/%s\n", key[0], key[1])
+	return exitOK
+}
+
+// runExport writes every record, or every record of --type, to --out as NDJSON.
+// The file is written to a temporary file next to --out and renamed once
+// complete, so a failed export never leaves a partial file under the requested
+// name.
+func runExport(ctx context.Context, args []string, getenv env, stdout, stderr io.Writer) int {
+	fs, conn := newFlagSet("export", "--out <file> [flags]", stderr)
+	var out string
+	opts := client.ListOptions{}
+	fs.StringVar(&out, "out", "", "file to write the records to (required)")
+	fs.StringVar(&opts.ResourceType, "type", "", "only export records of this resource_type")
+	fs.IntVar(&opts.PageSize, "page-size", 100, "records per request")
+
+	if _, code, ok := parseArgs(fs, args, 0); !ok {
+		return code
+	}
+	if out == "" {
+		return usageError(stderr, "--out is required")
+	}
+	if opts.PageSize <= 0 {
+		return usageError(stderr, "--page-size must be positive")
+	}
+
+	start := time.Now()
+	count, err := exportRecords(ctx, conn.client(getenv), opts, out)
+	if err != nil {
+		return fail(stderr, fmt.Errorf("exporting records to %s: %w", out, err))
+	}
+	fmt.Fprintf(stdout, "Exported %d records to %s in %s\n", count, out, time.Since(start).Round(time.Millisecond))
+	return exitOK
+}
+
+// exportRecords writes the records of every page to path, atomically, and
+// returns how many were written.
+func exportRecords(ctx context.Context, c *client.Client, opts client.ListOptions, path string) (int, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	count := 0
+	encoder := json.NewEncoder(tmp)
+	err = c.Pages(ctx, opts, func(page []client.Record) error {
+		for _, record := range page {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return count, os.Rename(tmp.Name(), path)
+}
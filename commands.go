@@ -0,0 +1,541 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tokenpagination/backup"
+	"tokenpagination/config"
+	"tokenpagination/repository"
+	"tokenpagination/seed"
+)
+
+// Exit codes of the commands, so that scripts and CI jobs can tell a failed run
+// from a mistyped command line.
+const (
+	exitOK      = 0
+	exitFailure = 1 // the command ran and failed, e.g. the database was unreachable
+	exitUsage   = 2 // unknown command, invalid flags or arguments
+)
+
+// defaultCommand runs when the binary is started without a subcommand, preserving
+// the behavior from before subcommands existed.
+const defaultCommand = "all"
+
+// command is a subcommand of the binary. run receives the arguments following the
+// command name and returns the process exit code.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stderr io.Writer) int
+}
+
+var commands = []command{
+	{name: "all", summary: "migrate, seed when SEED_SAMPLE_DATA is set, and serve (the default)", run: runAll},
+	{name: "serve", summary: "serve the HTTP API without changing the schema or data", run: runServe},
+	{name: "migrate", summary: "apply the database schema and exit", run: runMigrate},
+	{name: "seed", summary: "load sample records and exit", run: runSeed},
+	{name: "backup", summary: "write every record to a gzipped NDJSON backup and exit", run: runBackup},
+	{name: "restore", summary: "verify a backup and insert its records and exit", run: runRestore},
+}
+
+// dispatch runs the command named by args[0] with the remaining arguments. Without
+// a command name, including when args start with a flag, defaultCommand runs.
+func dispatch(args []string, commands []command, stderr io.Writer) int {
+	name := defaultCommand
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		printUsage(stderr, commands)
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(args, stderr)
+		}
+	}
+
+	fmt.Fprintf(stderr, "unknown command '%s'\n\n", name)
+	printUsage(stderr, commands)
+	return exitUsage
+}
+
+// printUsage lists the commands.
+func printUsage(w io.Writer, commands []command) {
+	fmt.Fprintln(w, "Usage: tokenpagination [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'tokenpagination <command> -h' for the flags of a command.")
+}
+
+// parseFlags parses args into fs, rejecting positional arguments. When ok is false
+// parsing failed or help was requested, and the command should exit with code.
+func parseFlags(fs *flag.FlagSet, args []string) (code int, ok bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		fs.Usage()
+		return exitUsage, false
+	}
+
+	return exitOK, true
+}
+
+// newFlagSet returns a flag set for the named command that reports errors to
+// stderr instead of exiting.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// logLevel is the level of the process-wide logger.
+var logLevel = new(slog.LevelVar)
+
+// loadConfig loads the configuration, reporting problems to the log, and installs
+// the configured logger as the process-wide default, which the standard log
+// package writes through as well.
+func loadConfig() (*config.Config, bool) {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Println("Invalid configuration:\n", err)
+		return nil, false
+	}
+	slog.SetDefault(newLogger(cfg.Log, logLevel, os.Stderr))
+	slog.Info("configuration loaded", "environment", cfg.Environment())
+	return cfg, true
+}
+
+// runAll migrates the schema, populates sample data into an empty database when
+// SEED_SAMPLE_DATA is set, and serves the HTTP API, all in one process.
+func runAll(args []string, stderr io.Writer) int {
+	if code, ok := parseFlags(newFlagSet("all", stderr), args); !ok {
+		return code
+	}
+
+	cfg, ok := loadConfig()
+	if !ok {
+		return exitFailure
+	}
+
+	db, repo, err := openRepository(cfg)
+	if err != nil {
+		log.Println(err)
+		return exitFailure
+	}
+	defer db.Close()
+
+	if err := repo.CreateTable(); err != nil {
+		log.Println("Failed to create table:", err)
+		return exitFailure
+	}
+
+	if !checkSchema(repo, cfg.DB.SchemaCheck) {
+		return exitFailure
+	}
+
+	if err := seedOnStartup(repo, cfg.Features); err != nil {
+		log.Println("Failed to populate sample data:", err)
+		return exitFailure
+	}
+
+	if err := serveHTTP(cfg, db, repo); err != nil {
+		log.Println(err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// serveOptions are the flags of the serve command.
+type serveOptions struct {
+	verifySchema bool
+}
+
+func parseServeFlags(args []string, stderr io.Writer) (serveOptions, int, bool) {
+	var opts serveOptions
+	fs := newFlagSet("serve", stderr)
+	fs.BoolVar(&opts.verifySchema, "verify-schema", false, "exit with an error when the tables differ from the expected schema, even if SCHEMA_CHECK is warn or off")
+
+	code, ok := parseFlags(fs, args)
+	return opts, code, ok
+}
+
+// runServe serves the HTTP API without creating tables or inserting data, so that
+// restarting a server never migrates or changes the database. The tables are
+// checked against the expected schema first, as SCHEMA_CHECK configures.
+func runServe(args []string, stderr io.Writer) int {
+	opts, code, ok := parseServeFlags(args, stderr)
+	if !ok {
+		return code
+	}
+
+	cfg, ok := loadConfig()
+	if !ok {
+		return exitFailure
+	}
+
+	db, repo, err := openRepository(cfg)
+	if err != nil {
+		log.Println(err)
+		return exitFailure
+	}
+	defer db.Close()
+
+	schemaCheck := cfg.DB.SchemaCheck
+	if opts.verifySchema {
+		schemaCheck = config.SchemaCheckFail
+	}
+	if !checkSchema(repo, schemaCheck) {
+		return exitFailure
+	}
+
+	if err := serveHTTP(cfg, db, repo); err != nil {
+		log.Println(err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// schemaVerifier checks the database schema; *repository.RecordRepository
+// implements it.
+type schemaVerifier interface {
+	VerifySchema() error
+}
+
+// checkSchema runs the startup schema check in the given SCHEMA_CHECK mode and
+// reports whether serving may continue. In warn mode differences are logged and
+// serving continues; failing to inspect the schema at all is logged the same way.
+func checkSchema(repo schemaVerifier, mode string) bool {
+	if mode == config.SchemaCheckOff {
+		return true
+	}
+
+	err := repo.VerifySchema()
+	switch {
+	case err == nil:
+		return true
+	case mode == config.SchemaCheckWarn:
+		slog.Warn("schema verification failed, serving anyway", "error", err)
+		return true
+	default:
+		log.Println("Schema verification failed:", err)
+		return false
+	}
+}
+
+// migrateOptions are the flags of the migrate command.
+type migrateOptions struct {
+	dryRun bool
+}
+
+func parseMigrateFlags(args []string, stderr io.Writer) (migrateOptions, int, bool) {
+	var opts migrateOptions
+	fs := newFlagSet("migrate", stderr)
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "print the schema statements without executing them")
+
+	code, ok := parseFlags(fs, args)
+	return opts, code, ok
+}
+
+// runMigrate applies the database schema and exits. With --dry-run the statements
+// are printed as a SQL script instead, without connecting to the database.
+func runMigrate(args []string, stderr io.Writer) int {
+	opts, code, ok := parseMigrateFlags(args, stderr)
+	if !ok {
+		return code
+	}
+
+	cfg, ok := loadConfig()
+	if !ok {
+		return exitFailure
+	}
+
+	if opts.dryRun {
+		repo := repository.NewRecordRepository(nil)
+		if err := repo.SetTypeTables(cfg.DB.TypeTables); err != nil {
+			log.Println("Failed to configure repository:", err)
+			return exitFailure
+		}
+		for _, statement := range repo.SchemaStatements() {
+			fmt.Println(strings.TrimSpace(statement) + ";")
+		}
+		return exitOK
+	}
+
+	db, repo, err := openRepository(cfg)
+	if err != nil {
+		log.Println(err)
+		return exitFailure
+	}
+	defer db.Close()
+
+	if err := repo.CreateTable(); err != nil {
+		log.Println("Failed to create table:", err)
+		return exitFailure
+	}
+	fmt.Println("Schema applied")
+	return exitOK
+}
+
+// seedOptions are the flags of the seed command.
+type seedOptions struct {
+	file   string
+	format seed.Format
+	count  int
+}
+
+func parseSeedFlags(args []string, stderr io.Writer) (seedOptions, int, bool) {
+	var opts seedOptions
+	var format string
+	fs := newFlagSet("seed", stderr)
+	fs.StringVar(&opts.file, "file", "", "sample data file to load (default SEED_FILE, or the embedded sample data)")
+	fs.StringVar(&format, "format", "", "format of the file: pipe, json or csv (default SEED_FORMAT or the file extension)")
+	fs.IntVar(&opts.count, "count", 0, "generate this many synthetic records instead of loading a file")
+
+	if code, ok := parseFlags(fs, args); !ok {
+		return opts, code, false
+	}
+
+	var err error
+	if opts.format, err = seed.ParseFormat(format); err != nil {
+		fmt.Fprintln(stderr, err)
+		return opts, exitUsage, false
+	}
+	if opts.count < 0 {
+		fmt.Fprintln(stderr, "--count must not be negative")
+		return opts, exitUsage, false
+	}
+	if opts.count > 0 && (opts.file != "" || opts.format != "") {
+		fmt.Fprintln(stderr, "--count cannot be combined with --file or --format")
+		return opts, exitUsage, false
+	}
+
+	return opts, exitOK, true
+}
+
+// runSeed inserts sample records, loaded from a file, SEED_FILE or the embedded
+// sample data, or generated, and exits. Unlike the all-in-one mode it inserts into
+// a database that already holds records; all records are inserted in one
+// transaction, so a duplicate key inserts nothing.
+func runSeed(args []string, stderr io.Writer) int {
+	opts, code, ok := parseSeedFlags(args, stderr)
+	if !ok {
+		return code
+	}
+
+	cfg, ok := loadConfig()
+	if !ok {
+		return exitFailure
+	}
+
+	db, repo, err := openRepository(cfg)
+	if err != nil {
+		log.Println(err)
+		return exitFailure
+	}
+	defer db.Close()
+
+	var records []seed.SampleRecord
+	var source string
+	switch {
+	case opts.count > 0:
+		records, source = seed.Generate(opts.count), "generated records"
+	case opts.file != "":
+		// A file named on the command line must exist, there is no fallback
+		source = opts.file
+		if records, err = seed.LoadFile(opts.file, opts.format); err != nil {
+			log.Printf("Failed to load sample data from %s:\n%v", opts.file, err)
+			return exitFailure
+		}
+	default:
+		if records, source, err = loadSampleRecords(cfg.Features.SeedFile, cfg.Features.SeedFormat); err != nil {
+			log.Println(err)
+			return exitFailure
+		}
+	}
+
+	if err := insertSampleData(repo, records, source); err != nil {
+		log.Println("Failed to insert sample data:", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// backupOptions are the flags of the backup command.
+type backupOptions struct {
+	out string
+}
+
+func parseBackupFlags(args []string, stderr io.Writer) (backupOptions, int, bool) {
+	var opts backupOptions
+	fs := newFlagSet("backup", stderr)
+	fs.StringVar(&opts.out, "out", "", "file to write the backup to, e.g. records.ndjson.gz (required)")
+
+	if code, ok := parseFlags(fs, args); !ok {
+		return opts, code, false
+	}
+	if opts.out == "" {
+		fmt.Fprintln(stderr, "--out is required")
+		return opts, exitUsage, false
+	}
+	return opts, exitOK, true
+}
+
+// runBackup writes every record to a gzipped NDJSON backup closed by a manifest,
+// without involving mysqldump. The records are read with a single SELECT, a
+// consistent snapshot of the tables. The backup is written to a temporary file
+// next to --out and renamed once complete, so a failed run never leaves a
+// partial backup under the requested name.
+func runBackup(args []string, stderr io.Writer) int {
+	opts, code, ok := parseBackupFlags(args, stderr)
+	if !ok {
+		return code
+	}
+
+	cfg, ok := loadConfig()
+	if !ok {
+		return exitFailure
+	}
+
+	db, repo, err := openRepository(cfg)
+	if err != nil {
+		log.Println(err)
+		return exitFailure
+	}
+	defer db.Close()
+
+	start := time.Now()
+	manifest, err := writeBackup(opts.out, repo.ForEach)
+	if err != nil {
+		log.Printf("Failed to back up records to %s: %v", opts.out, err)
+		return exitFailure
+	}
+	fmt.Printf("Backed up %d records to %s in %s (sha256 %s)\n", manifest.Records, opts.out, time.Since(start).Round(time.Millisecond), manifest.SHA256)
+	return exitOK
+}
+
+// writeBackup writes the records of forEach to a backup at path, atomically.
+func writeBackup(path string, forEach func(fn func(repository.Record) error) error) (backup.Manifest, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return backup.Manifest{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	manifest, err := backup.Write(tmp, forEach)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return backup.Manifest{}, err
+	}
+	return manifest, os.Rename(tmp.Name(), path)
+}
+
+// restoreOptions are the flags of the restore command.
+type restoreOptions struct {
+	in   string
+	mode repository.ImportMode
+}
+
+func parseRestoreFlags(args []string, stderr io.Writer) (restoreOptions, int, bool) {
+	var opts restoreOptions
+	var mode string
+	fs := newFlagSet("restore", stderr)
+	fs.StringVar(&opts.in, "in", "", "backup file written by the backup command (required)")
+	fs.StringVar(&mode, "mode", string(repository.ImportSkip), "what to do with records that already exist: skip or overwrite")
+
+	if code, ok := parseFlags(fs, args); !ok {
+		return opts, code, false
+	}
+	if opts.in == "" {
+		fmt.Fprintln(stderr, "--in is required")
+		return opts, exitUsage, false
+	}
+	var err error
+	if opts.mode, err = repository.ParseImportMode(mode); err != nil {
+		fmt.Fprintln(stderr, err)
+		return opts, exitUsage, false
+	}
+	return opts, exitOK, true
+}
+
+// runRestore verifies a backup against its manifest and inserts its records in
+// one transaction, keeping their created_at and updated_at. Records that already
+// exist are skipped or overwritten as --mode selects. An invalid backup, or a
+// record the database rejects, restores nothing and is reported by line.
+func runRestore(args []string, stderr io.Writer) int {
+	opts, code, ok := parseRestoreFlags(args, stderr)
+	if !ok {
+		return code
+	}
+
+	cfg, ok := loadConfig()
+	if !ok {
+		return exitFailure
+	}
+
+	records, err := readBackup(opts.in)
+	if err != nil {
+		log.Printf("Backup %s is invalid, nothing was restored:\n%v", opts.in, err)
+		return exitFailure
+	}
+
+	db, repo, err := openRepository(cfg)
+	if err != nil {
+		log.Println(err)
+		return exitFailure
+	}
+	defer db.Close()
+
+	start := time.Now()
+	if err := repo.ImportBatch(records, opts.mode, nil); err != nil {
+		log.Printf("Failed to restore %s, nothing was restored: %v", opts.in, restoreError(err))
+		return exitFailure
+	}
+	fmt.Printf("Restored %d records from %s in %s (mode %s)\n", len(records), opts.in, time.Since(start).Round(time.Millisecond), opts.mode)
+	return exitOK
+}
+
+// readBackup reads and verifies the backup at path.
+func readBackup(path string) ([]repository.Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, _, err := backup.Read(f)
+	return records, err
+}
+
+// restoreError names the line of the backup holding the record that failed to
+// restore; record i of a backup is on line i+1.
+func restoreError(err error) error {
+	var batchErr *repository.BatchInsertError
+	if !errors.As(err, &batchErr) {
+		return err
+	}
+	return fmt.Errorf("line %d (%s/%s): %w", batchErr.Index+1, batchErr.Key.ResourceType, batchErr.Key.ResourceID, batchErr.Err)
+}
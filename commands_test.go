@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tokenpagination/config"
+	"tokenpagination/repository"
+	"tokenpagination/seed"
+)
+
+// recordingCommands returns a command table whose commands record the arguments
+// they were run with and exit with their index.
+func recordingCommands(calls map[string][]string) []command {
+	var commands []command
+	for i, name := range []string{"all", "serve", "migrate", "seed", "backup", "restore"} {
+		name, code := name, i
+		commands = append(commands, command{name: name, summary: name + " summary", run: func(args []string, _ io.Writer) int {
+			calls[name] = args
+			return code
+		}})
+	}
+	return commands
+}
+
+func TestDispatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantCmd  string
+		wantArgs []string
+		wantCode int
+	}{
+		{name: "no command", args: nil, wantCmd: "all", wantArgs: nil, wantCode: 0},
+		{name: "flags without command", args: []string{"-v"}, wantCmd: "all", wantArgs: []string{"-v"}, wantCode: 0},
+		{name: "serve", args: []string{"serve", "--verify-schema"}, wantCmd: "serve", wantArgs: []string{"--verify-schema"}, wantCode: 1},
+		{name: "migrate", args: []string{"migrate"}, wantCmd: "migrate", wantArgs: []string{}, wantCode: 2},
+		{name: "seed", args: []string{"seed", "--count", "10"}, wantCmd: "seed", wantArgs: []string{"--count", "10"}, wantCode: 3},
+		{name: "backup", args: []string{"backup", "--out", "records.ndjson.gz"}, wantCmd: "backup", wantArgs: []string{"--out", "records.ndjson.gz"}, wantCode: 4},
+		{name: "restore", args: []string{"restore", "--in", "records.ndjson.gz"}, wantCmd: "restore", wantArgs: []string{"--in", "records.ndjson.gz"}, wantCode: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := map[string][]string{}
+			var stderr bytes.Buffer
+
+			code := dispatch(tt.args, recordingCommands(calls), &stderr)
+
+			assert.Equal(t, tt.wantCode, code)
+			assert.Len(t, calls, 1)
+			assert.Contains(t, calls, tt.wantCmd)
+			assert.Equal(t, tt.wantArgs, calls[tt.wantCmd])
+			assert.Empty(t, stderr.String())
+		})
+	}
+}
+
+func TestDispatch_UnknownCommand(t *testing.T) {
+	calls := map[string][]string{}
+	var stderr bytes.Buffer
+
+	code := dispatch([]string{"migrat"}, recordingCommands(calls), &stderr)
+
+	assert.Equal(t, exitUsage, code)
+	assert.Empty(t, calls)
+	assert.Contains(t, stderr.String(), "unknown command 'migrat'")
+	assert.Contains(t, stderr.String(), "migrate  migrate summary")
+}
+
+func TestDispatch_Help(t *testing.T) {
+	calls := map[string][]string{}
+	var stderr bytes.Buffer
+
+	code := dispatch([]string{"help"}, recordingCommands(calls), &stderr)
+
+	assert.Equal(t, exitOK, code)
+	assert.Empty(t, calls)
+	assert.Contains(t, stderr.String(), "Usage: tokenpagination [command] [flags]")
+}
+
+func TestCommands_FlagErrorsExitWithUsage(t *testing.T) {
+	for _, cmd := range commands {
+		t.Run(cmd.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			assert.Equal(t, exitUsage, cmd.run([]string{"--no-such-flag"}, &stderr))
+			assert.Contains(t, stderr.String(), "flag provided but not defined")
+
+			stderr.Reset()
+			assert.Equal(t, exitUsage, cmd.run([]string{"extra"}, &stderr))
+			assert.Contains(t, stderr.String(), "unexpected arguments: extra")
+
+			stderr.Reset()
+			assert.Equal(t, exitOK, cmd.run([]string{"-h"}, &stderr))
+			assert.Contains(t, stderr.String(), "Usage of "+cmd.name)
+		})
+	}
+}
+
+func TestParseServeFlags(t *testing.T) {
+	opts, _, ok := parseServeFlags(nil, io.Discard)
+	assert.True(t, ok)
+	assert.False(t, opts.verifySchema)
+
+	opts, _, ok = parseServeFlags([]string{"--verify-schema"}, io.Discard)
+	assert.True(t, ok)
+	assert.True(t, opts.verifySchema)
+}
+
+// stubVerifier is a schemaVerifier returning err and counting its calls.
+type stubVerifier struct {
+	err   error
+	calls int
+}
+
+func (s *stubVerifier) VerifySchema() error {
+	s.calls++
+	return s.err
+}
+
+func TestCheckSchema(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		err       error
+		wantOK    bool
+		wantCalls int
+	}{
+		{name: "fail, matching", mode: config.SchemaCheckFail, wantOK: true, wantCalls: 1},
+		{name: "fail, drifted", mode: config.SchemaCheckFail, err: assert.AnError, wantOK: false, wantCalls: 1},
+		{name: "empty means fail", mode: "", err: assert.AnError, wantOK: false, wantCalls: 1},
+		{name: "warn, drifted", mode: config.SchemaCheckWarn, err: assert.AnError, wantOK: true, wantCalls: 1},
+		{name: "off", mode: config.SchemaCheckOff, err: assert.AnError, wantOK: true, wantCalls: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &stubVerifier{err: tt.err}
+
+			assert.Equal(t, tt.wantOK, checkSchema(repo, tt.mode))
+			assert.Equal(t, tt.wantCalls, repo.calls)
+		})
+	}
+}
+
+func TestParseMigrateFlags(t *testing.T) {
+	opts, _, ok := parseMigrateFlags([]string{"--dry-run"}, io.Discard)
+	assert.True(t, ok)
+	assert.True(t, opts.dryRun)
+}
+
+func TestParseSeedFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    seedOptions
+		wantErr string
+	}{
+		{name: "defaults", args: nil, want: seedOptions{}},
+		{name: "file and format", args: []string{"--file", "records.export", "--format", "csv"}, want: seedOptions{file: "records.export", format: seed.FormatCSV}},
+		{name: "count", args: []string{"--count", "500"}, want: seedOptions{count: 500}},
+		{name: "invalid format", args: []string{"--format", "xml"}, wantErr: "invalid sample data format 'xml'"},
+		{name: "negative count", args: []string{"--count", "-1"}, wantErr: "--count must not be negative"},
+		{name: "count and file", args: []string{"--count", "5", "--file", "sample_data.txt"}, wantErr: "--count cannot be combined with --file or --format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			opts, code, ok := parseSeedFlags(tt.args, &stderr)
+
+			if tt.wantErr != "" {
+				assert.False(t, ok)
+				assert.Equal(t, exitUsage, code)
+				assert.Contains(t, stderr.String(), tt.wantErr)
+				return
+			}
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, opts)
+		})
+	}
+}
+
+func TestParseBackupFlags(t *testing.T) {
+	opts, _, ok := parseBackupFlags([]string{"--out", "records.ndjson.gz"}, io.Discard)
+	assert.True(t, ok)
+	assert.Equal(t, backupOptions{out: "records.ndjson.gz"}, opts)
+
+	var stderr bytes.Buffer
+	_, code, ok := parseBackupFlags(nil, &stderr)
+	assert.False(t, ok)
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr.String(), "--out is required")
+}
+
+func TestParseRestoreFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    restoreOptions
+		wantErr string
+	}{
+		{name: "default mode", args: []string{"--in", "records.ndjson.gz"}, want: restoreOptions{in: "records.ndjson.gz", mode: repository.ImportSkip}},
+		{name: "overwrite", args: []string{"--in", "records.ndjson.gz", "--mode", "overwrite"}, want: restoreOptions{in: "records.ndjson.gz", mode: repository.ImportOverwrite}},
+		{name: "missing file", args: nil, wantErr: "--in is required"},
+		{name: "invalid mode", args: []string{"--in", "records.ndjson.gz", "--mode", "merge"}, wantErr: "invalid import mode 'merge'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			opts, code, ok := parseRestoreFlags(tt.args, &stderr)
+
+			if tt.wantErr != "" {
+				assert.False(t, ok)
+				assert.Equal(t, exitUsage, code)
+				assert.Contains(t, stderr.String(), tt.wantErr)
+				return
+			}
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, opts)
+		})
+	}
+}
+
+// TestBackupRestore_RoundTrip backs up the rows of one database and restores them
+// into another, empty one, checking that every value is inserted exactly as it
+// was read, timestamps and claims included.
+func TestBackupRestore_RoundTrip(t *testing.T) {
+	ctx := `{"name": "Alice"}`
+	created := time.Date(2023, 5, 1, 8, 0, 0, 0, time.UTC)
+	updated := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	claimed := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+
+	source, sourceMock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer source.Close()
+	sourceMock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata, claimed_at FROM resource_context ORDER BY resource_type, resource_id`).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata", "claimed_at"}).
+			AddRow("doc-1", "document", nil, created, created, nil, nil).
+			AddRow("user-1", "user", ctx, created, updated, []byte(`{"tier":"gold"}`), claimed))
+
+	path := filepath.Join(t.TempDir(), "records.ndjson.gz")
+	manifest, err := writeBackup(path, repository.NewRecordRepository(source).ForEach)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), manifest.Records)
+	require.NoError(t, sourceMock.ExpectationsWereMet())
+
+	target, targetMock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer target.Close()
+	targetMock.ExpectBegin()
+	targetMock.ExpectExec(`INSERT INTO resource_context \(resource_id, resource_type, context, created_at, updated_at, metadata, claimed_at\) VALUES \(\?, \?, \?, \?, \?, \?, \?\), \(\?, \?, \?, \?, \?, \?, \?\) ON DUPLICATE KEY UPDATE`).
+		WithArgs("doc-1", "document", nil, created, created, nil, nil,
+			"user-1", "user", &ctx, created, updated, `{"tier":"gold"}`, &claimed).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	targetMock.ExpectCommit()
+
+	records, err := readBackup(path)
+	require.NoError(t, err)
+	require.NoError(t, repository.NewRecordRepository(target).ImportBatch(records, repository.ImportSkip, nil))
+	assert.NoError(t, targetMock.ExpectationsWereMet())
+}
+
+func TestWriteBackup_FailureLeavesNoFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "records.ndjson.gz")
+
+	_, err := writeBackup(path, func(func(repository.Record) error) error { return assert.AnError })
+	assert.ErrorIs(t, err, assert.AnError)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRestoreError(t *testing.T) {
+	err := restoreError(&repository.BatchInsertError{Index: 41, Key: repository.RecordKey{ResourceType: "user", ResourceID: "user-42"}, Err: assert.AnError})
+	assert.EqualError(t, err, "line 42 (user/user-42): "+assert.AnError.Error())
+	assert.ErrorIs(t, err, assert.AnError)
+
+	other := errors.New("connection refused")
+	assert.Equal(t, other, restoreError(other))
+}
@@ -0,0 +1,825 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	// Embedded so DB_LOC resolves in minimal images without system zoneinfo.
+	_ "time/tzdata"
+
+	"github.com/go-sql-driver/mysql"
+	"tokenpagination/repository"
+	"tokenpagination/seed"
+)
+
+// Database TLS modes accepted by DB_TLS_MODE.
+const (
+	TLSDisabled = "disabled"
+	TLSRequired = "required"
+	TLSCustom   = "custom"
+)
+
+// Environment modes accepted by APP_ENV.
+const (
+	EnvDev  = "dev"
+	EnvProd = "prod"
+)
+
+// Gin modes accepted by GIN_MODE.
+const (
+	GinModeDebug   = "debug"
+	GinModeRelease = "release"
+	GinModeTest    = "test"
+)
+
+// Log formats accepted by LOG_FORMAT.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// JSON key namings accepted by JSON_NAMING.
+const (
+	JSONNamingSnake = "snake"
+	JSONNamingCamel = "camel"
+)
+
+// Keys of the record array of the listings accepted by RECORDS_KEY.
+const (
+	RecordsKeyRecords = "records"
+	RecordsKeyData    = "data"
+	RecordsKeyItems   = "items"
+)
+
+// Startup schema check modes accepted by SCHEMA_CHECK.
+const (
+	SchemaCheckFail = "fail"
+	SchemaCheckWarn = "warn"
+	SchemaCheckOff  = "off"
+)
+
+// customTLSConfigName is the name under which the TLS configuration built from
+// DB_TLS_CA_FILE is registered with the MySQL driver.
+const customTLSConfigName = "tokenpagination-custom-ca"
+
+// reservedDBParams are DSN parameters that have a dedicated setting or that the
+// repository relies on, so they may not be overridden through DB_PARAMS.
+var reservedDBParams = map[string]string{
+	"tls":               "DB_TLS_MODE",
+	"charset":           "DB_CHARSET",
+	"collation":         "DB_COLLATION",
+	"loc":               "DB_LOC",
+	"time_zone":         "DB_LOC",
+	"parseTime":         "",
+	"clientFoundRows":   "",
+	"interpolateParams": "DB_INTERPOLATE_PARAMS",
+}
+
+// interpolationUnsafeCharsets are the multibyte character sets in which the MySQL
+// driver cannot escape interpolated parameters safely; it refuses to connect when
+// interpolateParams is combined with any of them.
+var interpolationUnsafeCharsets = []string{"big5", "cp932", "gb2312", "gbk", "sjis"}
+
+// Config holds every setting the service reads from its environment.
+type Config struct {
+	// Env is the APP_ENV mode, dev (default) or prod. It selects the defaults of
+	// GIN_MODE, SEED_SAMPLE_DATA and LOG_FORMAT, each of which can still be set
+	// explicitly.
+	Env string
+
+	DB         DBConfig
+	Server     ServerConfig
+	Pagination PaginationConfig
+	Tokens     TokenConfig
+	Features   FeatureConfig
+	Log        LogConfig
+
+	// loadErrs collects values that could not be parsed while loading, so that
+	// Validate can report them together with the semantic checks.
+	loadErrs []error
+}
+
+// DBConfig holds the database connection settings.
+type DBConfig struct {
+	Host     string // DB_HOST, required
+	Port     int    // DB_PORT, default 3306
+	User     string // DB_USER, required
+	Password string // DB_PASSWORD
+	Name     string // DB_NAME, required
+
+	TLSMode   string // DB_TLS_MODE: disabled (default), required, or custom
+	TLSCAFile string // DB_TLS_CA_FILE, PEM CA bundle used when TLSMode is custom
+
+	Charset   string         // DB_CHARSET, driver default when empty
+	Collation string         // DB_COLLATION, driver default when empty
+	Loc       *time.Location // DB_LOC, default UTC
+
+	// InterpolateParams makes the driver substitute query arguments client-side
+	// instead of preparing each parameterized statement on the server, saving two
+	// round trips per query (DB_INTERPOLATE_PARAMS, default false).
+	InterpolateParams bool
+
+	// Params holds extra DSN parameters from DB_PARAMS, given as a URL query
+	// string such as "timeout=5s&readTimeout=30s".
+	Params map[string]string
+
+	// Connection pool limits applied to the sql.DB. Idle connections beyond
+	// MaxIdleConns are closed when released, so it must not exceed MaxOpenConns.
+	MaxOpenConns    int           // DB_MAX_OPEN_CONNS, default 25 (0 is unlimited)
+	MaxIdleConns    int           // DB_MAX_IDLE_CONNS, default 25 (0 keeps no idle connections)
+	ConnMaxLifetime time.Duration // DB_CONN_MAX_LIFETIME, default 5m (0 reuses connections forever)
+	ConnMaxIdleTime time.Duration // DB_CONN_MAX_IDLE_TIME, default 0 (idle connections live up to ConnMaxLifetime)
+
+	// TypeTables routes resource types to shard tables (RESOURCE_TYPE_TABLES).
+	TypeTables map[string]string
+
+	// SchemaCheck is what serving does when the tables differ from the expected
+	// schema (SCHEMA_CHECK): fail (default, also when empty) refuses to start,
+	// warn logs the differences and serves anyway, and off skips the check.
+	SchemaCheck string
+}
+
+// ServerConfig holds the HTTP server settings.
+type ServerConfig struct {
+	Addr            string        // SERVER_ADDR or HTTP_ADDR, else ":" + PORT, default ":8080"
+	ReadTimeout     time.Duration // SERVER_READ_TIMEOUT, default 0 (no timeout)
+	WriteTimeout    time.Duration // SERVER_WRITE_TIMEOUT, default 0 (no timeout)
+	ShutdownTimeout time.Duration // SERVER_SHUTDOWN_TIMEOUT, default 15s (0 waits indefinitely)
+
+	TLSCertFile  string // TLS_CERT_FILE, PEM certificate chain; enables HTTPS together with TLSKeyFile
+	TLSKeyFile   string // TLS_KEY_FILE, PEM private key
+	RedirectAddr string // TLS_REDIRECT_ADDR, optional plain HTTP listener redirecting to HTTPS
+
+	Socket     string      // LISTEN_SOCKET, optional Unix domain socket path served alongside SERVER_ADDR
+	SocketMode os.FileMode // LISTEN_SOCKET_MODE, octal permissions of the socket file, default 0660
+	SocketOnly bool        // LISTEN_SOCKET_ONLY, default false; serve on the socket without the TCP listener
+
+	AdminToken string // ADMIN_TOKEN, bearer token for the admin endpoints; empty disables them
+	AdminAddr  string // ADMIN_ADDR, optional plain HTTP listener for the admin and debug endpoints; empty disables it
+
+	GinMode string // GIN_MODE: debug, release or test; default debug in dev and release in prod
+
+	JSONNaming string // JSON_NAMING: snake (default) or camel, the key naming of responses without ?naming=
+	RecordsKey string // RECORDS_KEY: records (default), data or items, the key of the record array of the listings without ?records_key=
+
+	RedirectTrailingSlash bool // REDIRECT_TRAILING_SLASH, default true; redirect /api/v1/records/ to /api/v1/records
+	CaseInsensitiveRoutes bool // CASE_INSENSITIVE_ROUTES, default true; redirect /API/v1/Records to /api/v1/records
+}
+
+// TLSEnabled reports whether the server terminates TLS itself.
+func (c ServerConfig) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// PaginationConfig holds the pagination limits applied by the repository.
+type PaginationConfig struct {
+	MaxPageDepth    int                        // MAX_PAGE_DEPTH, 0 disables the limit
+	GetAllLimit     int                        // MAX_GETALL_ROWS or GETALL_MAX_ROWS, default 1000, 0 removes the cap
+	HasMoreStrategy repository.HasMoreStrategy // HAS_MORE_STRATEGY, fetch_extra or exists
+}
+
+// TokenConfig holds continuation token secrets and limits.
+type TokenConfig struct {
+	// EncryptionKey is the decoded TOKEN_ENCRYPTION_KEY. When empty, tokens
+	// are issued in plaintext mode.
+	EncryptionKey []byte
+	// MaxLength is MAX_TOKEN_LENGTH, the longest continuation token in bytes that
+	// is accepted, default 512. 0 disables the check.
+	MaxLength int
+}
+
+// FeatureConfig holds optional features that can be switched on or off.
+type FeatureConfig struct {
+	SeedSampleData   bool                    // SEED_SAMPLE_DATA, default true in dev and false in prod
+	SeedFile         string                  // SEED_FILE, default empty for the sample data embedded in the binary
+	SeedFormat       seed.Format             // SEED_FORMAT, empty detects it from SEED_FILE's extension
+	SeedStrategy     repository.SeedStrategy // SEED_STRATEGY, missing (default) or refresh
+	ContextSchemaDir string                  // CONTEXT_SCHEMA_DIR, empty disables validation
+	DegradedMode     bool                    // DEGRADED_MODE, default false
+	DegradedCacheTTL time.Duration           // DEGRADED_CACHE_TTL, default 30s
+	DebugExplain     bool                    // DEBUG_EXPLAIN, default false; return the page query plan in X-Query-Plan
+	RetentionDays    int                     // RETENTION_DAYS, default 0 keeps records forever; purge records created longer ago
+}
+
+// LogConfig holds the settings of the process-wide logger.
+type LogConfig struct {
+	Level  slog.Level // LOG_LEVEL: debug, info (default), warn or error
+	Format string     // LOG_FORMAT: text or json; default text in dev and json in prod, text when empty
+}
+
+// Environment summarizes the APP_ENV mode and the effective settings it selects
+// the defaults of, together with the diagnostic features, for logging at startup
+// and reporting on /version.
+type Environment struct {
+	AppEnv         string `json:"app_env"`
+	GinMode        string `json:"gin_mode"`
+	SeedSampleData bool   `json:"seed_sample_data"`
+	LogLevel       string `json:"log_level"`
+	LogFormat      string `json:"log_format"`
+	DebugExplain   bool   `json:"debug_explain"`
+	DegradedMode   bool   `json:"degraded_mode"`
+}
+
+// Environment returns the mode and effective settings of the configuration.
+func (c *Config) Environment() Environment {
+	return Environment{
+		AppEnv:         c.Env,
+		GinMode:        c.Server.GinMode,
+		SeedSampleData: c.Features.SeedSampleData,
+		LogLevel:       strings.ToLower(c.Log.Level.String()),
+		LogFormat:      c.Log.Format,
+		DebugExplain:   c.Features.DebugExplain,
+		DegradedMode:   c.Features.DegradedMode,
+	}
+}
+
+// LogValue logs the environment as a group of its settings.
+func (e Environment) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("app_env", e.AppEnv),
+		slog.String("gin_mode", e.GinMode),
+		slog.Bool("seed_sample_data", e.SeedSampleData),
+		slog.String("log_level", e.LogLevel),
+		slog.String("log_format", e.LogFormat),
+		slog.Bool("debug_explain", e.DebugExplain),
+		slog.Bool("degraded_mode", e.DegradedMode),
+	)
+}
+
+// DSN returns the MariaDB data source name for the connection settings, formatted
+// by the driver so that passwords containing special characters survive intact.
+// The session time zone follows the driver location, UTC by default, so stored and
+// returned timestamps do not depend on the server's time zone. clientFoundRows is
+// enabled so that UPDATE statements report matched rows, letting the repository
+// tell "not found" apart from "unchanged".
+func (c DBConfig) DSN() string {
+	cfg := mysql.NewConfig()
+	cfg.User = c.User
+	cfg.Passwd = c.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	cfg.DBName = c.Name
+	cfg.ParseTime = true
+	cfg.ClientFoundRows = true
+	cfg.Collation = c.Collation
+	cfg.InterpolateParams = c.InterpolateParams
+
+	cfg.Loc = time.UTC
+	if c.Loc != nil {
+		cfg.Loc = c.Loc
+	}
+
+	switch c.TLSMode {
+	case TLSRequired:
+		cfg.TLSConfig = "true"
+	case TLSCustom:
+		cfg.TLSConfig = customTLSConfigName
+	}
+
+	cfg.Params = make(map[string]string, len(c.Params)+2)
+	for key, value := range c.Params {
+		cfg.Params[key] = value
+	}
+	if c.Charset != "" {
+		cfg.Params["charset"] = c.Charset
+	}
+	if cfg.Loc == time.UTC {
+		cfg.Params["time_zone"] = "'+00:00'"
+	} else {
+		cfg.Params["time_zone"] = "'" + cfg.Loc.String() + "'"
+	}
+
+	return cfg.FormatDSN()
+}
+
+// RegisterTLS registers the TLS configuration for DB_TLS_MODE=custom with the
+// MySQL driver, trusting the CA certificates in DB_TLS_CA_FILE. It must be called
+// before connecting with the DSN and does nothing for the other modes.
+func (c DBConfig) RegisterTLS() error {
+	if c.TLSMode != TLSCustom {
+		return nil
+	}
+
+	pem, err := os.ReadFile(c.TLSCAFile)
+	if err != nil {
+		return fmt.Errorf("cannot read CA file %s: %v", c.TLSCAFile, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("CA file %s contains no PEM-encoded certificates", c.TLSCAFile)
+	}
+
+	return mysql.RegisterTLSConfig(customTLSConfigName, &tls.Config{
+		RootCAs:    pool,
+		ServerName: c.Host,
+		MinVersion: tls.VersionTLS12,
+	})
+}
+
+// Load reads the configuration from environment variables, and from CONFIG_FILE
+// for variables that are not set, applying defaults for unset values, and
+// validates it. The returned error lists every missing or invalid value at once.
+func Load() (*Config, error) {
+	lookup, err := configLookup()
+	if err != nil {
+		return nil, err
+	}
+	env := &envReader{lookup: lookup}
+
+	appEnv := env.string("APP_ENV", EnvDev)
+	ginMode, seedSampleData, logFormat := GinModeDebug, true, LogFormatText
+	if appEnv == EnvProd {
+		ginMode, seedSampleData, logFormat = GinModeRelease, false, LogFormatJSON
+	}
+
+	cfg := &Config{
+		Env: appEnv,
+		DB: DBConfig{
+			Host:              env.string("DB_HOST", ""),
+			Port:              env.int("DB_PORT", 3306),
+			User:              env.string("DB_USER", ""),
+			Password:          env.string("DB_PASSWORD", ""),
+			Name:              env.string("DB_NAME", ""),
+			TLSMode:           env.string("DB_TLS_MODE", TLSDisabled),
+			TLSCAFile:         env.string("DB_TLS_CA_FILE", ""),
+			Charset:           env.string("DB_CHARSET", ""),
+			Collation:         env.string("DB_COLLATION", ""),
+			Loc:               env.location("DB_LOC", time.UTC),
+			InterpolateParams: env.bool("DB_INTERPOLATE_PARAMS", false),
+			Params:            env.params("DB_PARAMS"),
+			MaxOpenConns:      env.int("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:      env.int("DB_MAX_IDLE_CONNS", 25),
+			ConnMaxLifetime:   env.duration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+			ConnMaxIdleTime:   env.duration("DB_CONN_MAX_IDLE_TIME", 0),
+			TypeTables:        env.typeTables("RESOURCE_TYPE_TABLES"),
+			SchemaCheck:       env.string("SCHEMA_CHECK", SchemaCheckFail),
+		},
+		Server: ServerConfig{
+			Addr:            env.listenAddr(),
+			ReadTimeout:     env.duration("SERVER_READ_TIMEOUT", 0),
+			WriteTimeout:    env.duration("SERVER_WRITE_TIMEOUT", 0),
+			ShutdownTimeout: env.duration("SERVER_SHUTDOWN_TIMEOUT", 15*time.Second),
+			TLSCertFile:     env.string("TLS_CERT_FILE", ""),
+			TLSKeyFile:      env.string("TLS_KEY_FILE", ""),
+			RedirectAddr:    env.string("TLS_REDIRECT_ADDR", ""),
+			Socket:          env.string("LISTEN_SOCKET", ""),
+			SocketMode:      env.fileMode("LISTEN_SOCKET_MODE", 0o660),
+			SocketOnly:      env.bool("LISTEN_SOCKET_ONLY", false),
+			AdminToken:      env.string("ADMIN_TOKEN", ""),
+			AdminAddr:       env.string("ADMIN_ADDR", ""),
+			GinMode:         env.string("GIN_MODE", ginMode),
+			JSONNaming:      env.string("JSON_NAMING", JSONNamingSnake),
+			RecordsKey:      env.string("RECORDS_KEY", RecordsKeyRecords),
+
+			RedirectTrailingSlash: env.bool("REDIRECT_TRAILING_SLASH", true),
+			CaseInsensitiveRoutes: env.bool("CASE_INSENSITIVE_ROUTES", true),
+		},
+		Pagination: PaginationConfig{
+			MaxPageDepth:    env.int("MAX_PAGE_DEPTH", repository.DefaultMaxPageDepth),
+			GetAllLimit:     env.getAllLimit(),
+			HasMoreStrategy: env.hasMoreStrategy("HAS_MORE_STRATEGY"),
+		},
+		Tokens: TokenConfig{
+			EncryptionKey: env.base64("TOKEN_ENCRYPTION_KEY"),
+			MaxLength:     env.int("MAX_TOKEN_LENGTH", repository.DefaultMaxTokenLength),
+		},
+		Features: FeatureConfig{
+			SeedSampleData:   env.bool("SEED_SAMPLE_DATA", seedSampleData),
+			SeedFile:         env.string("SEED_FILE", ""),
+			SeedFormat:       env.seedFormat("SEED_FORMAT"),
+			SeedStrategy:     env.seedStrategy("SEED_STRATEGY"),
+			ContextSchemaDir: env.string("CONTEXT_SCHEMA_DIR", ""),
+			DegradedMode:     env.bool("DEGRADED_MODE", false),
+			DegradedCacheTTL: env.duration("DEGRADED_CACHE_TTL", 30*time.Second),
+			DebugExplain:     env.bool("DEBUG_EXPLAIN", false),
+			RetentionDays:    env.int("RETENTION_DAYS", 0),
+		},
+		Log: LogConfig{
+			Level:  env.logLevel("LOG_LEVEL"),
+			Format: env.string("LOG_FORMAT", logFormat),
+		},
+		loadErrs: env.errs,
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate checks the configuration and reports every problem found, including
+// values that could not be parsed by Load, joined into a single error.
+func (c *Config) Validate() error {
+	errs := append([]error{}, c.loadErrs...)
+
+	switch c.Env {
+	case "", EnvDev, EnvProd:
+	default:
+		errs = append(errs, fmt.Errorf("APP_ENV must be 'dev' or 'prod', got '%s'", c.Env))
+	}
+
+	if c.DB.Host == "" {
+		errs = append(errs, errors.New("DB_HOST is required"))
+	}
+	if c.DB.User == "" {
+		errs = append(errs, errors.New("DB_USER is required"))
+	}
+	if c.DB.Name == "" {
+		errs = append(errs, errors.New("DB_NAME is required"))
+	}
+	if c.DB.Port < 1 || c.DB.Port > 65535 {
+		errs = append(errs, fmt.Errorf("DB_PORT must be between 1 and 65535, got %d", c.DB.Port))
+	}
+	switch c.DB.TLSMode {
+	case "", TLSDisabled, TLSRequired:
+		if c.DB.TLSCAFile != "" {
+			errs = append(errs, errors.New("DB_TLS_CA_FILE is only used with DB_TLS_MODE=custom"))
+		}
+	case TLSCustom:
+		if c.DB.TLSCAFile == "" {
+			errs = append(errs, errors.New("DB_TLS_CA_FILE is required when DB_TLS_MODE=custom"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("DB_TLS_MODE must be 'disabled', 'required', or 'custom', got '%s'", c.DB.TLSMode))
+	}
+	for key := range c.DB.Params {
+		if setting, ok := reservedDBParams[key]; ok {
+			if setting == "" {
+				errs = append(errs, fmt.Errorf("DB_PARAMS must not set %s, it is always configured by the service", key))
+			} else {
+				errs = append(errs, fmt.Errorf("DB_PARAMS must not set %s, use %s instead", key, setting))
+			}
+		}
+	}
+
+	if c.DB.MaxOpenConns < 0 {
+		errs = append(errs, fmt.Errorf("DB_MAX_OPEN_CONNS must be a non-negative integer, got %d", c.DB.MaxOpenConns))
+	}
+	if c.DB.MaxIdleConns < 0 {
+		errs = append(errs, fmt.Errorf("DB_MAX_IDLE_CONNS must be a non-negative integer, got %d", c.DB.MaxIdleConns))
+	} else if c.DB.MaxOpenConns > 0 && c.DB.MaxIdleConns > c.DB.MaxOpenConns {
+		errs = append(errs, fmt.Errorf("DB_MAX_IDLE_CONNS must not exceed DB_MAX_OPEN_CONNS, got %d and %d", c.DB.MaxIdleConns, c.DB.MaxOpenConns))
+	}
+	if c.DB.ConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("DB_CONN_MAX_LIFETIME must not be negative"))
+	}
+	if c.DB.ConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("DB_CONN_MAX_IDLE_TIME must not be negative"))
+	}
+
+	if c.DB.InterpolateParams {
+		for _, charset := range strings.Split(c.DB.Charset, ",") {
+			if slices.Contains(interpolationUnsafeCharsets, strings.ToLower(strings.TrimSpace(charset))) {
+				errs = append(errs, fmt.Errorf("DB_INTERPOLATE_PARAMS cannot be used with DB_CHARSET=%s: the driver cannot escape multibyte charset %s safely", c.DB.Charset, charset))
+			}
+		}
+	}
+
+	switch c.DB.SchemaCheck {
+	case "", SchemaCheckFail, SchemaCheckWarn, SchemaCheckOff:
+	default:
+		errs = append(errs, fmt.Errorf("SCHEMA_CHECK must be 'fail', 'warn' or 'off', got '%s'", c.DB.SchemaCheck))
+	}
+
+	if c.Server.Addr == "" && !c.Server.SocketOnly {
+		errs = append(errs, errors.New("SERVER_ADDR must not be empty"))
+	} else if c.Server.Addr != "" {
+		if err := validateListenAddr(c.Server.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("SERVER_ADDR %v", err))
+		}
+	}
+	if c.Server.ReadTimeout < 0 {
+		errs = append(errs, errors.New("SERVER_READ_TIMEOUT must not be negative"))
+	}
+	if c.Server.WriteTimeout < 0 {
+		errs = append(errs, errors.New("SERVER_WRITE_TIMEOUT must not be negative"))
+	}
+	if c.Server.ShutdownTimeout < 0 {
+		errs = append(errs, errors.New("SERVER_SHUTDOWN_TIMEOUT must not be negative"))
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		errs = append(errs, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+	if c.Server.SocketOnly {
+		if c.Server.Socket == "" {
+			errs = append(errs, errors.New("LISTEN_SOCKET_ONLY requires LISTEN_SOCKET"))
+		}
+		if c.Server.TLSEnabled() {
+			errs = append(errs, errors.New("TLS_CERT_FILE and TLS_KEY_FILE apply to the TCP listener, which LISTEN_SOCKET_ONLY disables"))
+		}
+	}
+	if c.Server.RedirectAddr != "" {
+		if !c.Server.TLSEnabled() {
+			errs = append(errs, errors.New("TLS_REDIRECT_ADDR requires TLS_CERT_FILE and TLS_KEY_FILE"))
+		}
+		if err := validateListenAddr(c.Server.RedirectAddr); err != nil {
+			errs = append(errs, fmt.Errorf("TLS_REDIRECT_ADDR %v", err))
+		}
+		if c.Server.RedirectAddr == c.Server.Addr {
+			errs = append(errs, errors.New("TLS_REDIRECT_ADDR must differ from SERVER_ADDR"))
+		}
+	}
+	switch c.Server.GinMode {
+	case "", GinModeDebug, GinModeRelease, GinModeTest:
+	default:
+		errs = append(errs, fmt.Errorf("GIN_MODE must be 'debug', 'release' or 'test', got '%s'", c.Server.GinMode))
+	}
+	switch c.Server.JSONNaming {
+	case "", JSONNamingSnake, JSONNamingCamel:
+	default:
+		errs = append(errs, fmt.Errorf("JSON_NAMING must be 'snake' or 'camel', got '%s'", c.Server.JSONNaming))
+	}
+	switch c.Server.RecordsKey {
+	case "", RecordsKeyRecords, RecordsKeyData, RecordsKeyItems:
+	default:
+		errs = append(errs, fmt.Errorf("RECORDS_KEY must be 'records', 'data' or 'items', got '%s'", c.Server.RecordsKey))
+	}
+	if c.Server.AdminAddr != "" {
+		if err := validateListenAddr(c.Server.AdminAddr); err != nil {
+			errs = append(errs, fmt.Errorf("ADMIN_ADDR %v", err))
+		}
+		if c.Server.AdminAddr == c.Server.Addr || c.Server.AdminAddr == c.Server.RedirectAddr {
+			errs = append(errs, errors.New("ADMIN_ADDR must differ from SERVER_ADDR and TLS_REDIRECT_ADDR"))
+		}
+	}
+
+	if c.Pagination.MaxPageDepth < 0 {
+		errs = append(errs, fmt.Errorf("MAX_PAGE_DEPTH must be a non-negative integer, got %d", c.Pagination.MaxPageDepth))
+	}
+	if c.Pagination.GetAllLimit < 0 {
+		errs = append(errs, fmt.Errorf("MAX_GETALL_ROWS must be a non-negative integer, got %d", c.Pagination.GetAllLimit))
+	}
+
+	switch len(c.Tokens.EncryptionKey) {
+	case 0, 16, 24, 32:
+	default:
+		errs = append(errs, fmt.Errorf("TOKEN_ENCRYPTION_KEY must decode to 16, 24, or 32 bytes, got %d", len(c.Tokens.EncryptionKey)))
+	}
+	if c.Tokens.MaxLength < 0 {
+		errs = append(errs, fmt.Errorf("MAX_TOKEN_LENGTH must be a non-negative integer, got %d", c.Tokens.MaxLength))
+	}
+
+	if c.Features.DegradedMode && c.Features.DegradedCacheTTL <= 0 {
+		errs = append(errs, errors.New("DEGRADED_CACHE_TTL must be positive when DEGRADED_MODE is enabled"))
+	}
+	if c.Features.RetentionDays < 0 {
+		errs = append(errs, fmt.Errorf("RETENTION_DAYS must be a non-negative integer, got %d", c.Features.RetentionDays))
+	}
+
+	switch c.Log.Format {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be 'text' or 'json', got '%s'", c.Log.Format))
+	}
+
+	return errors.Join(errs...)
+}
+
+// envReader reads typed values from the environment, recording a parse error for
+// each malformed value instead of stopping at the first one.
+type envReader struct {
+	lookup func(string) (string, bool)
+	errs   []error
+}
+
+func (e *envReader) string(key, def string) string {
+	if value, ok := e.lookup(key); ok && value != "" {
+		return value
+	}
+	return def
+}
+
+func (e *envReader) int(key string, def int) int {
+	value := e.string(key, "")
+	if value == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be an integer, got '%s'", key, value))
+		return def
+	}
+	return n
+}
+
+func (e *envReader) bool(key string, def bool) bool {
+	value := e.string(key, "")
+	if value == "" {
+		return def
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be a boolean, got '%s'", key, value))
+		return def
+	}
+	return b
+}
+
+func (e *envReader) duration(key string, def time.Duration) time.Duration {
+	value := e.string(key, "")
+	if value == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be a duration such as '30s', got '%s'", key, value))
+		return def
+	}
+	return d
+}
+
+// listenAddr reads the HTTP listen address from SERVER_ADDR or its alias
+// HTTP_ADDR. Platforms that only inject a port set PORT instead, which listens on
+// that port on all interfaces. The default is ":8080".
+func (e *envReader) listenAddr() string {
+	addr, alias := e.string("SERVER_ADDR", ""), e.string("HTTP_ADDR", "")
+	if addr != "" && alias != "" && addr != alias {
+		e.errs = append(e.errs, fmt.Errorf("SERVER_ADDR and HTTP_ADDR are set to different addresses, '%s' and '%s'", addr, alias))
+	}
+	if addr == "" {
+		addr = alias
+	}
+	if addr != "" {
+		return addr
+	}
+
+	if port := e.string("PORT", ""); port != "" {
+		return ":" + port
+	}
+	return ":8080"
+}
+
+// getAllLimit reads the row cap of GET /api/v1/records from MAX_GETALL_ROWS or
+// its alias GETALL_MAX_ROWS.
+func (e *envReader) getAllLimit() int {
+	limit, alias := e.string("MAX_GETALL_ROWS", ""), e.string("GETALL_MAX_ROWS", "")
+	if limit != "" && alias != "" && limit != alias {
+		e.errs = append(e.errs, fmt.Errorf("MAX_GETALL_ROWS and GETALL_MAX_ROWS are set to different values, '%s' and '%s'", limit, alias))
+	}
+	if limit == "" && alias != "" {
+		return e.int("GETALL_MAX_ROWS", repository.DefaultGetAllLimit)
+	}
+	return e.int("MAX_GETALL_ROWS", repository.DefaultGetAllLimit)
+}
+
+// validateListenAddr checks that addr is a host:port address with a numeric port,
+// where the host may be empty to listen on all interfaces.
+func validateListenAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("must be a host:port address such as '127.0.0.1:9090' or ':8080', got '%s'", addr)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("must have a port between 1 and 65535, got '%s'", addr)
+	}
+	return nil
+}
+
+// fileMode parses octal file permissions such as "0660".
+func (e *envReader) fileMode(key string, def os.FileMode) os.FileMode {
+	value := e.string(key, "")
+	if value == "" {
+		return def
+	}
+
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0o777 {
+		e.errs = append(e.errs, fmt.Errorf("%s must be octal permissions such as '0660', got '%s'", key, value))
+		return def
+	}
+	return os.FileMode(mode)
+}
+
+func (e *envReader) location(key string, def *time.Location) *time.Location {
+	value := e.string(key, "")
+	if value == "" {
+		return def
+	}
+
+	loc, err := time.LoadLocation(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be a time zone name such as 'UTC', got '%s'", key, value))
+		return def
+	}
+	return loc
+}
+
+// params parses extra DSN parameters given as a URL query string.
+func (e *envReader) params(key string) map[string]string {
+	value := e.string(key, "")
+	if value == "" {
+		return nil
+	}
+
+	query, err := url.ParseQuery(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be a query string such as 'timeout=5s&readTimeout=30s': %v", key, err))
+		return nil
+	}
+
+	params := make(map[string]string, len(query))
+	for name, values := range query {
+		params[name] = values[len(values)-1]
+	}
+	return params
+}
+
+func (e *envReader) base64(key string) []byte {
+	value := e.string(key, "")
+	if value == "" {
+		return nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be base64-encoded: %v", key, err))
+		return nil
+	}
+	return decoded
+}
+
+func (e *envReader) hasMoreStrategy(key string) repository.HasMoreStrategy {
+	switch value := e.string(key, ""); value {
+	case "", "fetch_extra":
+		return repository.HasMoreFetchExtra
+	case "exists":
+		return repository.HasMoreExists
+	default:
+		e.errs = append(e.errs, fmt.Errorf("%s must be 'fetch_extra' or 'exists', got '%s'", key, value))
+		return repository.HasMoreFetchExtra
+	}
+}
+
+// logLevel parses a log level name, defaulting to info. Offsets such as
+// "debug+2" are accepted as well.
+func (e *envReader) logLevel(key string) slog.Level {
+	level := slog.LevelInfo
+	value := e.string(key, "")
+	if value == "" {
+		return level
+	}
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be 'debug', 'info', 'warn' or 'error', got '%s'", key, value))
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// seedFormat parses a sample data format name; empty means detect it from the file
+// extension.
+func (e *envReader) seedFormat(key string) seed.Format {
+	format, err := seed.ParseFormat(e.string(key, ""))
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %v", key, err))
+	}
+	return format
+}
+
+// seedStrategy parses what reseeding does with stored sample records, defaulting
+// to adding only the missing ones.
+func (e *envReader) seedStrategy(key string) repository.SeedStrategy {
+	switch value := e.string(key, ""); value {
+	case "", string(repository.SeedMissing):
+		return repository.SeedMissing
+	case string(repository.SeedRefresh):
+		return repository.SeedRefresh
+	default:
+		e.errs = append(e.errs, fmt.Errorf("%s must be 'missing' or 'refresh', got '%s'", key, value))
+		return repository.SeedMissing
+	}
+}
+
+// typeTables parses a comma-separated list of resource_type=table pairs such as
+// "user=resource_context_user".
+func (e *envReader) typeTables(key string) map[string]string {
+	value := e.string(key, "")
+	if value == "" {
+		return nil
+	}
+
+	tables := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			e.errs = append(e.errs, fmt.Errorf("invalid %s entry '%s': expected resource_type=table", key, pair))
+			continue
+		}
+		tables[parts[0]] = parts[1]
+	}
+	return tables
+}
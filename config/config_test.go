@@ -0,0 +1,628 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tokenpagination/repository"
+	"tokenpagination/seed"
+)
+
+var configKeys = []string{
+	"DB_HOST", "DB_PORT", "DB_USER", "DB_PASSWORD", "DB_NAME", "RESOURCE_TYPE_TABLES",
+	"DB_TLS_MODE", "DB_TLS_CA_FILE", "DB_CHARSET", "DB_COLLATION", "DB_LOC", "DB_PARAMS",
+	"DB_INTERPOLATE_PARAMS", "DB_MAX_OPEN_CONNS", "DB_MAX_IDLE_CONNS", "DB_CONN_MAX_LIFETIME", "DB_CONN_MAX_IDLE_TIME",
+	"SCHEMA_CHECK",
+	"SERVER_ADDR", "HTTP_ADDR", "PORT", "GETALL_MAX_ROWS", "SERVER_READ_TIMEOUT", "SERVER_WRITE_TIMEOUT", "SERVER_SHUTDOWN_TIMEOUT",
+	"TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_REDIRECT_ADDR",
+	"LISTEN_SOCKET", "LISTEN_SOCKET_MODE", "LISTEN_SOCKET_ONLY", "ADMIN_TOKEN", "ADMIN_ADDR",
+	"MAX_PAGE_DEPTH", "MAX_GETALL_ROWS", "HAS_MORE_STRATEGY",
+	"TOKEN_ENCRYPTION_KEY", "MAX_TOKEN_LENGTH", "SEED_SAMPLE_DATA", "CONTEXT_SCHEMA_DIR",
+	"DEGRADED_MODE", "DEGRADED_CACHE_TTL", "SEED_FILE", "SEED_FORMAT", "SEED_STRATEGY", "DEBUG_EXPLAIN", "RETENTION_DAYS",
+	"LOG_LEVEL", "LOG_FORMAT", "APP_ENV", "GIN_MODE", "JSON_NAMING", "RECORDS_KEY", "REDIRECT_TRAILING_SLASH", "CASE_INSENSITIVE_ROUTES", "CONFIG_FILE",
+}
+
+// setEnv clears every configuration variable and then sets the given ones.
+func setEnv(t *testing.T, values map[string]string) {
+	for _, key := range configKeys {
+		t.Setenv(key, "")
+	}
+	for key, value := range values {
+		t.Setenv(key, value)
+	}
+}
+
+func requiredEnv() map[string]string {
+	return map[string]string{"DB_HOST": "db", "DB_USER": "root", "DB_NAME": "tokenpagination"}
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	setEnv(t, requiredEnv())
+
+	cfg, err := Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, 3306, cfg.DB.Port)
+	assert.Empty(t, cfg.DB.Password)
+	assert.Nil(t, cfg.DB.TypeTables)
+	assert.Equal(t, TLSDisabled, cfg.DB.TLSMode)
+	assert.Equal(t, time.UTC, cfg.DB.Loc)
+	assert.Nil(t, cfg.DB.Params)
+	assert.Equal(t, 25, cfg.DB.MaxOpenConns)
+	assert.Equal(t, 25, cfg.DB.MaxIdleConns)
+	assert.Equal(t, 5*time.Minute, cfg.DB.ConnMaxLifetime)
+	assert.Zero(t, cfg.DB.ConnMaxIdleTime)
+	assert.Equal(t, SchemaCheckFail, cfg.DB.SchemaCheck)
+	assert.Equal(t, ":8080", cfg.Server.Addr)
+	assert.Zero(t, cfg.Server.ReadTimeout)
+	assert.Zero(t, cfg.Server.WriteTimeout)
+	assert.Equal(t, 15*time.Second, cfg.Server.ShutdownTimeout)
+	assert.False(t, cfg.Server.TLSEnabled())
+	assert.Empty(t, cfg.Server.Socket)
+	assert.Equal(t, os.FileMode(0o660), cfg.Server.SocketMode)
+	assert.False(t, cfg.Server.SocketOnly)
+	assert.Empty(t, cfg.Server.AdminToken)
+	assert.Empty(t, cfg.Server.AdminAddr)
+	assert.Equal(t, repository.DefaultMaxPageDepth, cfg.Pagination.MaxPageDepth)
+	assert.Equal(t, repository.DefaultGetAllLimit, cfg.Pagination.GetAllLimit)
+	assert.Equal(t, repository.HasMoreFetchExtra, cfg.Pagination.HasMoreStrategy)
+	assert.Equal(t, repository.DefaultMaxTokenLength, cfg.Tokens.MaxLength)
+	assert.Nil(t, cfg.Tokens.EncryptionKey)
+	assert.True(t, cfg.Features.SeedSampleData)
+	assert.Empty(t, cfg.Features.SeedFile)
+	assert.Empty(t, cfg.Features.SeedFormat)
+	assert.Equal(t, repository.SeedMissing, cfg.Features.SeedStrategy)
+	assert.Empty(t, cfg.Features.ContextSchemaDir)
+	assert.False(t, cfg.Features.DegradedMode)
+	assert.Equal(t, 30*time.Second, cfg.Features.DegradedCacheTTL)
+	assert.False(t, cfg.Features.DebugExplain)
+	assert.Zero(t, cfg.Features.RetentionDays)
+	assert.Equal(t, slog.LevelInfo, cfg.Log.Level)
+	assert.Equal(t, LogFormatText, cfg.Log.Format)
+	assert.Equal(t, EnvDev, cfg.Env)
+	assert.Equal(t, GinModeDebug, cfg.Server.GinMode)
+	assert.Equal(t, JSONNamingSnake, cfg.Server.JSONNaming)
+	assert.Equal(t, RecordsKeyRecords, cfg.Server.RecordsKey)
+	assert.True(t, cfg.Server.RedirectTrailingSlash)
+	assert.True(t, cfg.Server.CaseInsensitiveRoutes)
+}
+
+func TestLoad_ExplicitValues(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	env := requiredEnv()
+	env["DB_PORT"] = "3307"
+	env["DB_PASSWORD"] = "secret"
+	env["RESOURCE_TYPE_TABLES"] = "user=resource_context_user, task=resource_context_task"
+	env["SCHEMA_CHECK"] = "warn"
+	env["SERVER_ADDR"] = "127.0.0.1:9090"
+	env["SERVER_READ_TIMEOUT"] = "5s"
+	env["SERVER_WRITE_TIMEOUT"] = "1m"
+	env["SERVER_SHUTDOWN_TIMEOUT"] = "30s"
+	env["TLS_CERT_FILE"] = "/etc/ssl/server.pem"
+	env["TLS_KEY_FILE"] = "/etc/ssl/server-key.pem"
+	env["TLS_REDIRECT_ADDR"] = ":8081"
+	env["LISTEN_SOCKET"] = "/run/tokenpagination.sock"
+	env["LISTEN_SOCKET_MODE"] = "0600"
+	env["ADMIN_TOKEN"] = "admin-secret"
+	env["ADMIN_ADDR"] = "127.0.0.1:9091"
+	env["MAX_PAGE_DEPTH"] = "0"
+	env["MAX_GETALL_ROWS"] = "250"
+	env["HAS_MORE_STRATEGY"] = "exists"
+	env["TOKEN_ENCRYPTION_KEY"] = base64.StdEncoding.EncodeToString(key)
+	env["MAX_TOKEN_LENGTH"] = "1024"
+	env["SEED_SAMPLE_DATA"] = "false"
+	env["SEED_FILE"] = "fixtures/records.export"
+	env["SEED_FORMAT"] = "csv"
+	env["SEED_STRATEGY"] = "refresh"
+	env["CONTEXT_SCHEMA_DIR"] = "schemas"
+	env["DEGRADED_MODE"] = "true"
+	env["DEGRADED_CACHE_TTL"] = "2m"
+	env["DEBUG_EXPLAIN"] = "true"
+	env["RETENTION_DAYS"] = "90"
+	env["LOG_LEVEL"] = "debug"
+	env["LOG_FORMAT"] = "json"
+	env["APP_ENV"] = "prod"
+	env["GIN_MODE"] = "test"
+	env["JSON_NAMING"] = "camel"
+	env["RECORDS_KEY"] = "items"
+	env["REDIRECT_TRAILING_SLASH"] = "false"
+	env["CASE_INSENSITIVE_ROUTES"] = "false"
+	setEnv(t, env)
+
+	cfg, err := Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, 3307, cfg.DB.Port)
+	assert.Equal(t, "secret", cfg.DB.Password)
+	assert.Equal(t, map[string]string{"user": "resource_context_user", "task": "resource_context_task"}, cfg.DB.TypeTables)
+	assert.Equal(t, SchemaCheckWarn, cfg.DB.SchemaCheck)
+	assert.Equal(t, "127.0.0.1:9090", cfg.Server.Addr)
+	assert.Equal(t, 5*time.Second, cfg.Server.ReadTimeout)
+	assert.Equal(t, time.Minute, cfg.Server.WriteTimeout)
+	assert.Equal(t, 30*time.Second, cfg.Server.ShutdownTimeout)
+	assert.True(t, cfg.Server.TLSEnabled())
+	assert.Equal(t, "/etc/ssl/server.pem", cfg.Server.TLSCertFile)
+	assert.Equal(t, "/etc/ssl/server-key.pem", cfg.Server.TLSKeyFile)
+	assert.Equal(t, ":8081", cfg.Server.RedirectAddr)
+	assert.Equal(t, "/run/tokenpagination.sock", cfg.Server.Socket)
+	assert.Equal(t, os.FileMode(0o600), cfg.Server.SocketMode)
+	assert.Equal(t, "admin-secret", cfg.Server.AdminToken)
+	assert.Equal(t, "127.0.0.1:9091", cfg.Server.AdminAddr)
+	assert.Equal(t, 0, cfg.Pagination.MaxPageDepth)
+	assert.Equal(t, 250, cfg.Pagination.GetAllLimit)
+	assert.Equal(t, repository.HasMoreExists, cfg.Pagination.HasMoreStrategy)
+	assert.Equal(t, key, cfg.Tokens.EncryptionKey)
+	assert.Equal(t, 1024, cfg.Tokens.MaxLength)
+	assert.False(t, cfg.Features.SeedSampleData)
+	assert.Equal(t, "fixtures/records.export", cfg.Features.SeedFile)
+	assert.Equal(t, seed.FormatCSV, cfg.Features.SeedFormat)
+	assert.Equal(t, repository.SeedRefresh, cfg.Features.SeedStrategy)
+	assert.Equal(t, "schemas", cfg.Features.ContextSchemaDir)
+	assert.True(t, cfg.Features.DegradedMode)
+	assert.Equal(t, 2*time.Minute, cfg.Features.DegradedCacheTTL)
+	assert.True(t, cfg.Features.DebugExplain)
+	assert.Equal(t, 90, cfg.Features.RetentionDays)
+	assert.Equal(t, slog.LevelDebug, cfg.Log.Level)
+	assert.Equal(t, LogFormatJSON, cfg.Log.Format)
+	assert.Equal(t, EnvProd, cfg.Env)
+	assert.Equal(t, GinModeTest, cfg.Server.GinMode)
+	assert.Equal(t, JSONNamingCamel, cfg.Server.JSONNaming)
+	assert.Equal(t, RecordsKeyItems, cfg.Server.RecordsKey)
+	assert.False(t, cfg.Server.RedirectTrailingSlash)
+	assert.False(t, cfg.Server.CaseInsensitiveRoutes)
+}
+
+func TestLoad_AppEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		wantGinMode   string
+		wantSeed      bool
+		wantLogFormat string
+		wantEnv       string
+	}{
+		{name: "dev", env: map[string]string{"APP_ENV": "dev"}, wantGinMode: GinModeDebug, wantSeed: true, wantLogFormat: LogFormatText, wantEnv: EnvDev},
+		{name: "prod", env: map[string]string{"APP_ENV": "prod"}, wantGinMode: GinModeRelease, wantSeed: false, wantLogFormat: LogFormatJSON, wantEnv: EnvProd},
+		{
+			name:        "prod with overrides",
+			env:         map[string]string{"APP_ENV": "prod", "GIN_MODE": "debug", "SEED_SAMPLE_DATA": "true", "LOG_FORMAT": "text"},
+			wantGinMode: GinModeDebug, wantSeed: true, wantLogFormat: LogFormatText, wantEnv: EnvProd,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := requiredEnv()
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			setEnv(t, env)
+
+			cfg, err := Load()
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantEnv, cfg.Env)
+			assert.Equal(t, tt.wantGinMode, cfg.Server.GinMode)
+			assert.Equal(t, tt.wantSeed, cfg.Features.SeedSampleData)
+			assert.Equal(t, tt.wantLogFormat, cfg.Log.Format)
+		})
+	}
+}
+
+func TestConfig_Environment(t *testing.T) {
+	cfg := Config{
+		Env:      EnvProd,
+		Server:   ServerConfig{GinMode: GinModeRelease},
+		Features: FeatureConfig{DebugExplain: true},
+		Log:      LogConfig{Level: slog.LevelWarn, Format: LogFormatJSON},
+	}
+
+	assert.Equal(t, Environment{
+		AppEnv:       EnvProd,
+		GinMode:      GinModeRelease,
+		LogLevel:     "warn",
+		LogFormat:    LogFormatJSON,
+		DebugExplain: true,
+	}, cfg.Environment())
+}
+
+func TestLoad_ListenAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    string
+		wantErr string
+	}{
+		{name: "default", want: ":8080"},
+		{name: "server addr", env: map[string]string{"SERVER_ADDR": "127.0.0.1:9090"}, want: "127.0.0.1:9090"},
+		{name: "http addr", env: map[string]string{"HTTP_ADDR": "127.0.0.1:9090"}, want: "127.0.0.1:9090"},
+		{name: "same address twice", env: map[string]string{"SERVER_ADDR": ":9090", "HTTP_ADDR": ":9090"}, want: ":9090"},
+		{name: "port", env: map[string]string{"PORT": "5000"}, want: ":5000"},
+		{name: "address wins over port", env: map[string]string{"HTTP_ADDR": "127.0.0.1:9090", "PORT": "5000"}, want: "127.0.0.1:9090"},
+		{name: "conflicting addresses", env: map[string]string{"SERVER_ADDR": ":9090", "HTTP_ADDR": ":9091"}, wantErr: "SERVER_ADDR and HTTP_ADDR are set to different addresses, ':9090' and ':9091'"},
+		{name: "invalid port", env: map[string]string{"PORT": "web"}, wantErr: "SERVER_ADDR must have a port between 1 and 65535, got ':web'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := requiredEnv()
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			setEnv(t, env)
+
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg.Server.Addr)
+		})
+	}
+}
+
+func TestLoad_GetAllLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    int
+		wantErr string
+	}{
+		{name: "default", want: 1000},
+		{name: "max getall rows", env: map[string]string{"MAX_GETALL_ROWS": "250"}, want: 250},
+		{name: "getall max rows", env: map[string]string{"GETALL_MAX_ROWS": "250"}, want: 250},
+		{name: "same value twice", env: map[string]string{"MAX_GETALL_ROWS": "250", "GETALL_MAX_ROWS": "250"}, want: 250},
+		{name: "cap disabled", env: map[string]string{"GETALL_MAX_ROWS": "0"}, want: 0},
+		{name: "conflicting values", env: map[string]string{"MAX_GETALL_ROWS": "250", "GETALL_MAX_ROWS": "500"}, wantErr: "MAX_GETALL_ROWS and GETALL_MAX_ROWS are set to different values, '250' and '500'"},
+		{name: "negative alias", env: map[string]string{"GETALL_MAX_ROWS": "-1"}, wantErr: "MAX_GETALL_ROWS must be a non-negative integer, got -1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := requiredEnv()
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			setEnv(t, env)
+
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg.Pagination.GetAllLimit)
+		})
+	}
+}
+
+func TestLoad_ReportsAllProblemsAtOnce(t *testing.T) {
+	setEnv(t, map[string]string{
+		"DB_PORT":              "not-a-port",
+		"SERVER_READ_TIMEOUT":  "10",
+		"MAX_PAGE_DEPTH":       "-1",
+		"HAS_MORE_STRATEGY":    "guess",
+		"TOKEN_ENCRYPTION_KEY": base64.StdEncoding.EncodeToString([]byte("short")),
+		"SEED_SAMPLE_DATA":     "maybe",
+		"SEED_FORMAT":          "xml",
+		"SEED_STRATEGY":        "replace",
+		"LISTEN_SOCKET_MODE":   "rw-rw----",
+		"RESOURCE_TYPE_TABLES": "user",
+		"LOG_LEVEL":            "verbose",
+	})
+
+	cfg, err := Load()
+	require.Error(t, err)
+	assert.Nil(t, cfg)
+
+	for _, want := range []string{
+		"DB_HOST is required",
+		"DB_USER is required",
+		"DB_NAME is required",
+		"DB_PORT must be an integer, got 'not-a-port'",
+		"SERVER_READ_TIMEOUT must be a duration",
+		"MAX_PAGE_DEPTH must be a non-negative integer, got -1",
+		"HAS_MORE_STRATEGY must be 'fetch_extra' or 'exists', got 'guess'",
+		"TOKEN_ENCRYPTION_KEY must decode to 16, 24, or 32 bytes, got 5",
+		"SEED_SAMPLE_DATA must be a boolean, got 'maybe'",
+		"SEED_FORMAT: invalid sample data format 'xml'",
+		"SEED_STRATEGY must be 'missing' or 'refresh', got 'replace'",
+		"LISTEN_SOCKET_MODE must be octal permissions such as '0660', got 'rw-rw----'",
+		"invalid RESOURCE_TYPE_TABLES entry 'user'",
+		"LOG_LEVEL must be 'debug', 'info', 'warn' or 'error', got 'verbose'",
+	} {
+		assert.ErrorContains(t, err, want)
+	}
+
+	var joined interface{ Unwrap() []error }
+	require.True(t, errors.As(err, &joined))
+	assert.Len(t, joined.Unwrap(), 14)
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		return Config{
+			DB:     DBConfig{Host: "db", Port: 3306, User: "root", Name: "tokenpagination"},
+			Server: ServerConfig{Addr: ":8080"},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(c *Config)
+		wantErr string
+	}{
+		{name: "valid", mutate: func(c *Config) {}},
+		{name: "port out of range", mutate: func(c *Config) { c.DB.Port = 70000 }, wantErr: "DB_PORT must be between 1 and 65535"},
+		{name: "negative max open conns", mutate: func(c *Config) { c.DB.MaxOpenConns = -1 }, wantErr: "DB_MAX_OPEN_CONNS must be a non-negative integer, got -1"},
+		{name: "negative max idle conns", mutate: func(c *Config) { c.DB.MaxIdleConns = -1 }, wantErr: "DB_MAX_IDLE_CONNS must be a non-negative integer, got -1"},
+		{name: "more idle than open conns", mutate: func(c *Config) { c.DB.MaxOpenConns, c.DB.MaxIdleConns = 10, 20 }, wantErr: "DB_MAX_IDLE_CONNS must not exceed DB_MAX_OPEN_CONNS, got 20 and 10"},
+		{name: "idle conns with unlimited open conns", mutate: func(c *Config) { c.DB.MaxOpenConns, c.DB.MaxIdleConns = 0, 20 }},
+		{name: "negative conn lifetime", mutate: func(c *Config) { c.DB.ConnMaxLifetime = -time.Minute }, wantErr: "DB_CONN_MAX_LIFETIME must not be negative"},
+		{name: "negative conn idle time", mutate: func(c *Config) { c.DB.ConnMaxIdleTime = -time.Minute }, wantErr: "DB_CONN_MAX_IDLE_TIME must not be negative"},
+		{name: "empty address", mutate: func(c *Config) { c.Server.Addr = "" }, wantErr: "SERVER_ADDR must not be empty"},
+		{name: "address without port", mutate: func(c *Config) { c.Server.Addr = "localhost" }, wantErr: "SERVER_ADDR must be a host:port address such as '127.0.0.1:9090' or ':8080', got 'localhost'"},
+		{name: "address port out of range", mutate: func(c *Config) { c.Server.Addr = ":70000" }, wantErr: "SERVER_ADDR must have a port between 1 and 65535, got ':70000'"},
+		{name: "named port", mutate: func(c *Config) { c.Server.Addr = "127.0.0.1:http" }, wantErr: "SERVER_ADDR must have a port between 1 and 65535"},
+		{name: "ipv6 address", mutate: func(c *Config) { c.Server.Addr = "[::1]:9090" }},
+		{name: "negative write timeout", mutate: func(c *Config) { c.Server.WriteTimeout = -time.Second }, wantErr: "SERVER_WRITE_TIMEOUT must not be negative"},
+		{name: "negative shutdown timeout", mutate: func(c *Config) { c.Server.ShutdownTimeout = -time.Second }, wantErr: "SERVER_SHUTDOWN_TIMEOUT must not be negative"},
+		{name: "tls cert without key", mutate: func(c *Config) { c.Server.TLSCertFile = "server.pem" }, wantErr: "TLS_CERT_FILE and TLS_KEY_FILE must be set together"},
+		{name: "redirect without tls", mutate: func(c *Config) { c.Server.RedirectAddr = ":8081" }, wantErr: "TLS_REDIRECT_ADDR requires TLS_CERT_FILE and TLS_KEY_FILE"},
+		{name: "invalid redirect address", mutate: func(c *Config) {
+			c.Server.TLSCertFile, c.Server.TLSKeyFile = "server.pem", "server-key.pem"
+			c.Server.RedirectAddr = "80"
+		}, wantErr: "TLS_REDIRECT_ADDR must be a host:port address"},
+		{name: "redirect on server address", mutate: func(c *Config) {
+			c.Server.TLSCertFile, c.Server.TLSKeyFile = "server.pem", "server-key.pem"
+			c.Server.RedirectAddr = c.Server.Addr
+		}, wantErr: "TLS_REDIRECT_ADDR must differ from SERVER_ADDR"},
+		{name: "admin address", mutate: func(c *Config) { c.Server.AdminAddr = "127.0.0.1:9091" }},
+		{name: "invalid admin address", mutate: func(c *Config) { c.Server.AdminAddr = "9091" }, wantErr: "ADMIN_ADDR must be a host:port address"},
+		{name: "admin on server address", mutate: func(c *Config) { c.Server.AdminAddr = c.Server.Addr }, wantErr: "ADMIN_ADDR must differ from SERVER_ADDR and TLS_REDIRECT_ADDR"},
+		{name: "socket only", mutate: func(c *Config) {
+			c.Server.Addr, c.Server.Socket, c.Server.SocketOnly = "", "/run/tokenpagination.sock", true
+		}},
+		{name: "socket only without socket", mutate: func(c *Config) { c.Server.SocketOnly = true }, wantErr: "LISTEN_SOCKET_ONLY requires LISTEN_SOCKET"},
+		{name: "socket only with tls", mutate: func(c *Config) {
+			c.Server.Socket, c.Server.SocketOnly = "/run/tokenpagination.sock", true
+			c.Server.TLSCertFile, c.Server.TLSKeyFile = "server.pem", "server-key.pem"
+		}, wantErr: "TLS_CERT_FILE and TLS_KEY_FILE apply to the TCP listener, which LISTEN_SOCKET_ONLY disables"},
+		{name: "negative getall limit", mutate: func(c *Config) { c.Pagination.GetAllLimit = -5 }, wantErr: "MAX_GETALL_ROWS must be a non-negative integer"},
+		{name: "negative token length", mutate: func(c *Config) { c.Tokens.MaxLength = -1 }, wantErr: "MAX_TOKEN_LENGTH must be a non-negative integer"},
+		{name: "32 byte key", mutate: func(c *Config) { c.Tokens.EncryptionKey = make([]byte, 32) }},
+		{name: "negative retention", mutate: func(c *Config) { c.Features.RetentionDays = -30 }, wantErr: "RETENTION_DAYS must be a non-negative integer, got -30"},
+		{name: "degraded mode without ttl", mutate: func(c *Config) { c.Features.DegradedMode = true }, wantErr: "DEGRADED_CACHE_TTL must be positive"},
+		{name: "unknown app env", mutate: func(c *Config) { c.Env = "staging" }, wantErr: "APP_ENV must be 'dev' or 'prod', got 'staging'"},
+		{name: "unknown gin mode", mutate: func(c *Config) { c.Server.GinMode = "verbose" }, wantErr: "GIN_MODE must be 'debug', 'release' or 'test', got 'verbose'"},
+		{name: "unknown schema check", mutate: func(c *Config) { c.DB.SchemaCheck = "strict" }, wantErr: "SCHEMA_CHECK must be 'fail', 'warn' or 'off', got 'strict'"},
+		{name: "unknown json naming", mutate: func(c *Config) { c.Server.JSONNaming = "kebab" }, wantErr: "JSON_NAMING must be 'snake' or 'camel', got 'kebab'"},
+		{name: "unknown records key", mutate: func(c *Config) { c.Server.RecordsKey = "rows" }, wantErr: "RECORDS_KEY must be 'records', 'data' or 'items', got 'rows'"},
+		{name: "unknown log format", mutate: func(c *Config) { c.Log.Format = "logfmt" }, wantErr: "LOG_FORMAT must be 'text' or 'json', got 'logfmt'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.mutate(&cfg)
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLoad_DatabaseOptions(t *testing.T) {
+	env := requiredEnv()
+	env["DB_TLS_MODE"] = "custom"
+	env["DB_TLS_CA_FILE"] = "/etc/ssl/db-ca.pem"
+	env["DB_CHARSET"] = "utf8mb4"
+	env["DB_COLLATION"] = "utf8mb4_unicode_ci"
+	env["DB_LOC"] = "Europe/Rome"
+	env["DB_PARAMS"] = "timeout=5s&readTimeout=30s"
+	env["DB_INTERPOLATE_PARAMS"] = "true"
+	env["DB_MAX_OPEN_CONNS"] = "50"
+	env["DB_MAX_IDLE_CONNS"] = "10"
+	env["DB_CONN_MAX_LIFETIME"] = "30m"
+	env["DB_CONN_MAX_IDLE_TIME"] = "2m"
+	setEnv(t, env)
+
+	cfg, err := Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, TLSCustom, cfg.DB.TLSMode)
+	assert.Equal(t, "/etc/ssl/db-ca.pem", cfg.DB.TLSCAFile)
+	assert.Equal(t, "utf8mb4", cfg.DB.Charset)
+	assert.Equal(t, "utf8mb4_unicode_ci", cfg.DB.Collation)
+	assert.Equal(t, "Europe/Rome", cfg.DB.Loc.String())
+	assert.Equal(t, map[string]string{"timeout": "5s", "readTimeout": "30s"}, cfg.DB.Params)
+	assert.True(t, cfg.DB.InterpolateParams)
+	assert.Equal(t, 50, cfg.DB.MaxOpenConns)
+	assert.Equal(t, 10, cfg.DB.MaxIdleConns)
+	assert.Equal(t, 30*time.Minute, cfg.DB.ConnMaxLifetime)
+	assert.Equal(t, 2*time.Minute, cfg.DB.ConnMaxIdleTime)
+}
+
+func TestLoad_InvalidDatabaseOptions(t *testing.T) {
+	env := requiredEnv()
+	env["DB_TLS_MODE"] = "custom"
+	env["DB_LOC"] = "Mars/Olympus_Mons"
+	env["DB_PARAMS"] = "parseTime=false&tls=skip-verify&bad=%zz"
+	setEnv(t, env)
+
+	_, err := Load()
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "DB_TLS_CA_FILE is required when DB_TLS_MODE=custom")
+	assert.ErrorContains(t, err, "DB_LOC must be a time zone name")
+	assert.ErrorContains(t, err, "DB_PARAMS must be a query string")
+
+	env["DB_TLS_MODE"] = "verify"
+	env["DB_TLS_CA_FILE"] = "/etc/ssl/db-ca.pem"
+	env["DB_LOC"] = ""
+	env["DB_PARAMS"] = "parseTime=false&tls=skip-verify"
+	setEnv(t, env)
+
+	_, err = Load()
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "DB_TLS_MODE must be 'disabled', 'required', or 'custom', got 'verify'")
+	assert.ErrorContains(t, err, "DB_PARAMS must not set parseTime, it is always configured by the service")
+	assert.ErrorContains(t, err, "DB_PARAMS must not set tls, use DB_TLS_MODE instead")
+
+	env["DB_TLS_MODE"] = ""
+	env["DB_TLS_CA_FILE"] = ""
+	env["DB_CHARSET"] = "utf8mb4,SJIS"
+	env["DB_PARAMS"] = "interpolateParams=false"
+	env["DB_INTERPOLATE_PARAMS"] = "true"
+	setEnv(t, env)
+
+	_, err = Load()
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "DB_INTERPOLATE_PARAMS cannot be used with DB_CHARSET=utf8mb4,SJIS: the driver cannot escape multibyte charset SJIS safely")
+	assert.ErrorContains(t, err, "DB_PARAMS must not set interpolateParams, use DB_INTERPOLATE_PARAMS instead")
+}
+
+func TestDBConfig_DSN(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	require.NoError(t, err)
+
+	base := DBConfig{Host: "db", Port: 3306, User: "root", Password: "pw", Name: "tokenpagination"}
+
+	tests := []struct {
+		name   string
+		mutate func(c *DBConfig)
+		want   string
+	}{
+		{
+			name:   "defaults",
+			mutate: func(c *DBConfig) {},
+			want:   "root:pw@tcp(db:3306)/tokenpagination?clientFoundRows=true&parseTime=true&time_zone=%27%2B00%3A00%27",
+		},
+		{
+			name:   "tls required",
+			mutate: func(c *DBConfig) { c.TLSMode = TLSRequired },
+			want:   "root:pw@tcp(db:3306)/tokenpagination?clientFoundRows=true&parseTime=true&tls=true&time_zone=%27%2B00%3A00%27",
+		},
+		{
+			name:   "tls custom",
+			mutate: func(c *DBConfig) { c.TLSMode = TLSCustom; c.TLSCAFile = "ca.pem" },
+			want:   "root:pw@tcp(db:3306)/tokenpagination?clientFoundRows=true&parseTime=true&tls=tokenpagination-custom-ca&time_zone=%27%2B00%3A00%27",
+		},
+		{
+			name: "charset, collation, and location",
+			mutate: func(c *DBConfig) {
+				c.Charset = "utf8mb4"
+				c.Collation = "utf8mb4_unicode_ci"
+				c.Loc = rome
+			},
+			want: "root:pw@tcp(db:3306)/tokenpagination?clientFoundRows=true&collation=utf8mb4_unicode_ci&loc=Europe%2FRome&parseTime=true&charset=utf8mb4&time_zone=%27Europe%2FRome%27",
+		},
+		{
+			name:   "extra params",
+			mutate: func(c *DBConfig) { c.Params = map[string]string{"timeout": "5s", "readTimeout": "30s"} },
+			want:   "root:pw@tcp(db:3306)/tokenpagination?clientFoundRows=true&parseTime=true&readTimeout=30s&time_zone=%27%2B00%3A00%27&timeout=5s",
+		},
+		{
+			name:   "interpolate params",
+			mutate: func(c *DBConfig) { c.InterpolateParams = true },
+			want:   "root:pw@tcp(db:3306)/tokenpagination?clientFoundRows=true&interpolateParams=true&parseTime=true&time_zone=%27%2B00%3A00%27",
+		},
+		{
+			name:   "ipv6 host",
+			mutate: func(c *DBConfig) { c.Host = "::1" },
+			want:   "root:pw@tcp([::1]:3306)/tokenpagination?clientFoundRows=true&parseTime=true&time_zone=%27%2B00%3A00%27",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			tt.mutate(&cfg)
+			assert.Equal(t, tt.want, cfg.DSN())
+		})
+	}
+}
+
+func TestDBConfig_DSN_PasswordWithSpecialCharacters(t *testing.T) {
+	cfg := DBConfig{Host: "db", Port: 3306, User: "app", Password: `p@ss:w/rd?&=%"`, Name: "tokenpagination"}
+
+	parsed, err := mysql.ParseDSN(cfg.DSN())
+	require.NoError(t, err)
+	assert.Equal(t, "app", parsed.User)
+	assert.Equal(t, `p@ss:w/rd?&=%"`, parsed.Passwd)
+	assert.Equal(t, "db:3306", parsed.Addr)
+	assert.Equal(t, "tokenpagination", parsed.DBName)
+	assert.True(t, parsed.ParseTime)
+	assert.True(t, parsed.ClientFoundRows)
+}
+
+// writeTestCA writes a self-signed CA certificate in PEM format and returns its path.
+func writeTestCA(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	return path
+}
+
+func TestDBConfig_RegisterTLS(t *testing.T) {
+	t.Run("disabled is a no-op", func(t *testing.T) {
+		assert.NoError(t, DBConfig{TLSMode: TLSDisabled, TLSCAFile: "/does/not/exist"}.RegisterTLS())
+	})
+
+	t.Run("missing CA file", func(t *testing.T) {
+		err := DBConfig{TLSMode: TLSCustom, TLSCAFile: "/does/not/exist.pem"}.RegisterTLS()
+		assert.ErrorContains(t, err, "cannot read CA file /does/not/exist.pem")
+	})
+
+	t.Run("CA file without certificates", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "empty.pem")
+		require.NoError(t, os.WriteFile(path, []byte("not a certificate"), 0o600))
+
+		err := DBConfig{TLSMode: TLSCustom, TLSCAFile: path}.RegisterTLS()
+		assert.ErrorContains(t, err, "contains no PEM-encoded certificates")
+	})
+
+	t.Run("valid CA file", func(t *testing.T) {
+		defer mysql.DeregisterTLSConfig(customTLSConfigName)
+
+		cfg := DBConfig{Host: "db", Port: 3306, User: "root", Name: "tokenpagination", TLSMode: TLSCustom, TLSCAFile: writeTestCA(t)}
+		require.NoError(t, cfg.RegisterTLS())
+
+		parsed, err := mysql.ParseDSN(cfg.DSN())
+		require.NoError(t, err)
+		require.NotNil(t, parsed.TLS)
+		assert.Equal(t, "db", parsed.TLS.ServerName)
+	})
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readConfigFile reads the KEY=VALUE lines of a CONFIG_FILE, in the format of
+// docker's --env-file: blank lines and lines starting with # are skipped, and
+// values are taken literally, without removing quotes. Every malformed line is
+// reported.
+func readConfigFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	var errs []error
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			errs = append(errs, fmt.Errorf("%s:%d: expected KEY=VALUE", path, line))
+			continue
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return values, nil
+}
+
+// configLookup returns the lookup of configuration values: the environment,
+// falling back to the CONFIG_FILE named in the environment, if any. The file is
+// read anew on every Load, so a reload picks up its changes, whereas the
+// environment of a running process cannot change.
+func configLookup() (func(string) (string, bool), error) {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return os.LookupEnv, nil
+	}
+
+	values, err := readConfigFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("CONFIG_FILE: %w", err)
+	}
+
+	return func(key string) (string, bool) {
+		if value := os.Getenv(key); value != "" {
+			return value, true
+		}
+		value, ok := values[key]
+		return value, ok
+	}, nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfigFile writes content to a config file in a temporary directory and
+// returns its path.
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "tokenpagination.env")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestReadConfigFile(t *testing.T) {
+	path := writeConfigFile(t, "# database\nDB_HOST=db\n\n  DB_USER = root\nDB_PASSWORD=p=ss\"word\"\nADMIN_TOKEN=\n")
+
+	values, err := readConfigFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"DB_HOST": "db", "DB_USER": " root", "DB_PASSWORD": `p=ss"word"`, "ADMIN_TOKEN": ""}, values)
+}
+
+func TestReadConfigFile_Malformed(t *testing.T) {
+	path := writeConfigFile(t, "DB_HOST=db\nDB_USER\n=root\n")
+
+	_, err := readConfigFile(path)
+	assert.ErrorContains(t, err, path+":2: expected KEY=VALUE")
+	assert.ErrorContains(t, err, path+":3: expected KEY=VALUE")
+}
+
+func TestLoad_ConfigFile(t *testing.T) {
+	env := requiredEnv()
+	env["CONFIG_FILE"] = writeConfigFile(t, "DB_HOST=file-db\nADMIN_TOKEN=from-file\nLOG_LEVEL=debug\n")
+	setEnv(t, env)
+
+	cfg, err := Load()
+	require.NoError(t, err)
+
+	// The environment takes precedence over the file
+	assert.Equal(t, "db", cfg.DB.Host)
+	assert.Equal(t, "from-file", cfg.Server.AdminToken)
+	assert.Equal(t, "DEBUG", cfg.Log.Level.String())
+}
+
+func TestLoad_ConfigFileMissing(t *testing.T) {
+	env := requiredEnv()
+	env["CONFIG_FILE"] = filepath.Join(t.TempDir(), "missing.env")
+	setEnv(t, env)
+
+	_, err := Load()
+	assert.ErrorContains(t, err, "CONFIG_FILE: open ")
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// setting is one configuration value as compared by Changes.
+type setting struct {
+	name string
+	// reloadable settings take effect when the configuration is reloaded; all
+	// others are only read at startup.
+	reloadable bool
+	// secret settings are never reported with their values.
+	secret bool
+	value  func(c *Config) any
+}
+
+// settings lists every configuration value, named after its environment variable.
+var settings = []setting{
+	{name: "APP_ENV", value: func(c *Config) any { return c.Env }},
+	{name: "DB_HOST", value: func(c *Config) any { return c.DB.Host }},
+	{name: "DB_PORT", value: func(c *Config) any { return c.DB.Port }},
+	{name: "DB_USER", value: func(c *Config) any { return c.DB.User }},
+	{name: "DB_PASSWORD", secret: true, value: func(c *Config) any { return c.DB.Password }},
+	{name: "DB_NAME", value: func(c *Config) any { return c.DB.Name }},
+	{name: "DB_TLS_MODE", value: func(c *Config) any { return c.DB.TLSMode }},
+	{name: "DB_TLS_CA_FILE", value: func(c *Config) any { return c.DB.TLSCAFile }},
+	{name: "DB_CHARSET", value: func(c *Config) any { return c.DB.Charset }},
+	{name: "DB_COLLATION", value: func(c *Config) any { return c.DB.Collation }},
+	{name: "DB_LOC", value: func(c *Config) any { return c.DB.Loc.String() }},
+	{name: "DB_INTERPOLATE_PARAMS", value: func(c *Config) any { return c.DB.InterpolateParams }},
+	{name: "DB_PARAMS", value: func(c *Config) any { return c.DB.Params }},
+	{name: "DB_MAX_OPEN_CONNS", value: func(c *Config) any { return c.DB.MaxOpenConns }},
+	{name: "DB_MAX_IDLE_CONNS", value: func(c *Config) any { return c.DB.MaxIdleConns }},
+	{name: "DB_CONN_MAX_LIFETIME", value: func(c *Config) any { return c.DB.ConnMaxLifetime }},
+	{name: "DB_CONN_MAX_IDLE_TIME", value: func(c *Config) any { return c.DB.ConnMaxIdleTime }},
+	{name: "RESOURCE_TYPE_TABLES", value: func(c *Config) any { return c.DB.TypeTables }},
+	{name: "SCHEMA_CHECK", value: func(c *Config) any { return c.DB.SchemaCheck }},
+	{name: "SERVER_ADDR", value: func(c *Config) any { return c.Server.Addr }},
+	{name: "SERVER_READ_TIMEOUT", value: func(c *Config) any { return c.Server.ReadTimeout }},
+	{name: "SERVER_WRITE_TIMEOUT", value: func(c *Config) any { return c.Server.WriteTimeout }},
+	{name: "SERVER_SHUTDOWN_TIMEOUT", value: func(c *Config) any { return c.Server.ShutdownTimeout }},
+	{name: "TLS_CERT_FILE", value: func(c *Config) any { return c.Server.TLSCertFile }},
+	{name: "TLS_KEY_FILE", value: func(c *Config) any { return c.Server.TLSKeyFile }},
+	{name: "TLS_REDIRECT_ADDR", value: func(c *Config) any { return c.Server.RedirectAddr }},
+	{name: "LISTEN_SOCKET", value: func(c *Config) any { return c.Server.Socket }},
+	{name: "LISTEN_SOCKET_MODE", value: func(c *Config) any { return c.Server.SocketMode }},
+	{name: "LISTEN_SOCKET_ONLY", value: func(c *Config) any { return c.Server.SocketOnly }},
+	{name: "ADMIN_TOKEN", reloadable: true, secret: true, value: func(c *Config) any { return c.Server.AdminToken }},
+	{name: "ADMIN_ADDR", value: func(c *Config) any { return c.Server.AdminAddr }},
+	{name: "GIN_MODE", value: func(c *Config) any { return c.Server.GinMode }},
+	{name: "JSON_NAMING", value: func(c *Config) any { return c.Server.JSONNaming }},
+	{name: "RECORDS_KEY", value: func(c *Config) any { return c.Server.RecordsKey }},
+	{name: "REDIRECT_TRAILING_SLASH", value: func(c *Config) any { return c.Server.RedirectTrailingSlash }},
+	{name: "CASE_INSENSITIVE_ROUTES", value: func(c *Config) any { return c.Server.CaseInsensitiveRoutes }},
+	{name: "MAX_PAGE_DEPTH", reloadable: true, value: func(c *Config) any { return c.Pagination.MaxPageDepth }},
+	{name: "MAX_GETALL_ROWS", reloadable: true, value: func(c *Config) any { return c.Pagination.GetAllLimit }},
+	{name: "HAS_MORE_STRATEGY", value: func(c *Config) any { return c.Pagination.HasMoreStrategy }},
+	{name: "TOKEN_ENCRYPTION_KEY", reloadable: true, secret: true, value: func(c *Config) any { return c.Tokens.EncryptionKey }},
+	{name: "MAX_TOKEN_LENGTH", reloadable: true, value: func(c *Config) any { return c.Tokens.MaxLength }},
+	{name: "SEED_SAMPLE_DATA", value: func(c *Config) any { return c.Features.SeedSampleData }},
+	{name: "SEED_FILE", value: func(c *Config) any { return c.Features.SeedFile }},
+	{name: "SEED_FORMAT", value: func(c *Config) any { return c.Features.SeedFormat }},
+	{name: "SEED_STRATEGY", value: func(c *Config) any { return c.Features.SeedStrategy }},
+	{name: "CONTEXT_SCHEMA_DIR", value: func(c *Config) any { return c.Features.ContextSchemaDir }},
+	{name: "DEGRADED_MODE", value: func(c *Config) any { return c.Features.DegradedMode }},
+	{name: "DEGRADED_CACHE_TTL", value: func(c *Config) any { return c.Features.DegradedCacheTTL }},
+	{name: "DEBUG_EXPLAIN", value: func(c *Config) any { return c.Features.DebugExplain }},
+	{name: "RETENTION_DAYS", value: func(c *Config) any { return c.Features.RetentionDays }},
+	{name: "LOG_LEVEL", reloadable: true, value: func(c *Config) any { return c.Log.Level }},
+	{name: "LOG_FORMAT", value: func(c *Config) any { return c.Log.Format }},
+}
+
+// Change is a setting whose value differs between two configurations.
+type Change struct {
+	Name string // the environment variable
+	// Old and New are the values, or "(set)" and "(unset)" for secrets.
+	Old, New string
+	// Reloadable reports whether the change takes effect on reload; other
+	// settings need a restart.
+	Reloadable bool
+}
+
+// Changes lists the settings whose values differ between c and next.
+func (c *Config) Changes(next *Config) []Change {
+	var changes []Change
+	for _, s := range settings {
+		old, new := s.value(c), s.value(next)
+		if reflect.DeepEqual(old, new) {
+			continue
+		}
+		changes = append(changes, Change{Name: s.name, Old: s.format(old), New: s.format(new), Reloadable: s.reloadable})
+	}
+	return changes
+}
+
+// format returns the value for reporting, hiding secrets.
+func (s setting) format(value any) string {
+	if !s.secret {
+		return fmt.Sprint(value)
+	}
+	if reflect.ValueOf(value).Len() == 0 {
+		return "(unset)"
+	}
+	return "(set)"
+}
+
+// Reloaded returns a copy of c with the reloadable settings taken from next: the
+// log level, the admin token, the pagination limits and the continuation token
+// key. All other settings keep the values of c, since they only take effect at
+// startup.
+func (c *Config) Reloaded(next *Config) *Config {
+	reloaded := *c
+	reloaded.Log.Level = next.Log.Level
+	reloaded.Server.AdminToken = next.Server.AdminToken
+	reloaded.Pagination.MaxPageDepth = next.Pagination.MaxPageDepth
+	reloaded.Pagination.GetAllLimit = next.Pagination.GetAllLimit
+	reloaded.Tokens = next.Tokens
+	return &reloaded
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettings_CoverEveryVariable(t *testing.T) {
+	var names []string
+	for _, s := range settings {
+		names = append(names, s.name)
+	}
+
+	for _, key := range configKeys {
+		switch key {
+		case "HTTP_ADDR", "PORT":
+			// Alternatives to SERVER_ADDR
+		case "GETALL_MAX_ROWS":
+			// Alias of MAX_GETALL_ROWS
+		case "CONFIG_FILE":
+			// Read anew on every reload
+		default:
+			assert.Contains(t, names, key)
+		}
+	}
+}
+
+func TestConfig_Changes(t *testing.T) {
+	setEnv(t, requiredEnv())
+	current, err := Load()
+	require.NoError(t, err)
+
+	env := requiredEnv()
+	env["ADMIN_TOKEN"] = "rotated"
+	env["LOG_LEVEL"] = "warn"
+	env["DB_HOST"] = "other-db"
+	env["SERVER_ADDR"] = ":9090"
+	setEnv(t, env)
+	next, err := Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, []Change{
+		{Name: "DB_HOST", Old: "db", New: "other-db"},
+		{Name: "SERVER_ADDR", Old: ":8080", New: ":9090"},
+		{Name: "ADMIN_TOKEN", Old: "(unset)", New: "(set)", Reloadable: true},
+		{Name: "LOG_LEVEL", Old: "INFO", New: "WARN", Reloadable: true},
+	}, current.Changes(next))
+	assert.Empty(t, next.Changes(next))
+}
+
+func TestConfig_Reloaded(t *testing.T) {
+	current := &Config{
+		DB:     DBConfig{Host: "db"},
+		Server: ServerConfig{Addr: ":8080", AdminToken: "old"},
+		Log:    LogConfig{Level: slog.LevelInfo, Format: LogFormatText},
+	}
+	next := &Config{
+		DB:         DBConfig{Host: "other-db"},
+		Server:     ServerConfig{Addr: ":9090", AdminToken: "new"},
+		Pagination: PaginationConfig{MaxPageDepth: 7, GetAllLimit: 70},
+		Tokens:     TokenConfig{EncryptionKey: []byte("0123456789abcdef"), MaxLength: 700},
+		Log:        LogConfig{Level: slog.LevelDebug, Format: LogFormatJSON},
+	}
+
+	reloaded := current.Reloaded(next)
+
+	// Every reloadable setting is taken from next, every other one is kept
+	for _, s := range settings {
+		want := current
+		if s.reloadable {
+			want = next
+		}
+		assert.Equal(t, s.value(want), s.value(reloaded), s.name)
+	}
+	assert.Equal(t, "old", current.Server.AdminToken, "the current configuration is not modified")
+
+	var reloadable []string
+	for _, change := range current.Changes(next) {
+		if change.Reloadable {
+			reloadable = append(reloadable, change.Name)
+		}
+	}
+	assert.Equal(t, []string{"ADMIN_TOKEN", "MAX_PAGE_DEPTH", "MAX_GETALL_ROWS", "TOKEN_ENCRYPTION_KEY", "MAX_TOKEN_LENGTH", "LOG_LEVEL"}, reloadable)
+}
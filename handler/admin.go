@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuthMiddleware guards administrative endpoints, which expose internals such
+// as the SQL the repository runs. Requests must send the token as
+// "Authorization: Bearer <token>". Without a bearer token they are rejected with
+// 401 Unauthorized, and with a wrong one with 403 Forbidden, as retrying without
+// another token cannot succeed. With an empty token the admin endpoints are
+// disabled and answer 404 Not Found, as if they did not exist.
+func AdminAuthMiddleware(token string) gin.HandlerFunc {
+	return AdminAuthMiddlewareFunc(func() string { return token })
+}
+
+// AdminAuthMiddlewareFunc works like AdminAuthMiddleware but asks token for the
+// token on every request, so that it can be rotated while the server runs.
+func AdminAuthMiddlewareFunc(token func() string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := token()
+		if token == "" {
+			NotFound(c)
+			c.Abort()
+			return
+		}
+
+		given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer realm="admin"`)
+			respond(c, http.StatusUnauthorized, gin.H{"error": "admin authorization required"})
+			c.Abort()
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			respond(c, http.StatusForbidden, gin.H{"error": "invalid admin token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// purgeConfirmation is the confirm value PurgeRecords requires.
+const purgeConfirmation = "DELETE_ALL"
+
+// EnablePurge allows PurgeRecords to delete every record. It is meant for test
+// environments only.
+func (h *RecordHandler) EnablePurge() {
+	h.purge = true
+}
+
+// PurgeRecords handles DELETE requests deleting every record, for wiping test
+// environments, and returns the number of records deleted. It is an admin endpoint
+// and must be registered behind AdminAuthMiddleware, which refuses a wrong admin
+// token with 403 Forbidden. Unless purging was enabled with EnablePurge the
+// request is refused with 403 Forbidden too, and without the confirm=DELETE_ALL
+// query parameter it is rejected with 400.
+func (h *RecordHandler) PurgeRecords(c *gin.Context) {
+	if !h.purge {
+		respond(c, http.StatusForbidden, gin.H{"error": "purging records is disabled in this environment"})
+		return
+	}
+	if confirm := c.Query("confirm"); confirm != purgeConfirmation {
+		respondBadRequest(c, &ParamError{Param: "confirm", Value: confirm, Reason: "must be " + purgeConfirmation + " to delete every record"})
+		return
+	}
+
+	deleted, err := h.repo.DeleteAll()
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to purge records"})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{"message": "All records purged", "deleted": deleted})
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// adminRouter serves a route guarded by the admin middleware with the given token.
+func adminRouter(token string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/admin", AdminAuthMiddleware(token), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+	return r
+}
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		wantStatus    int
+		wantBody      string
+	}{
+		{name: "valid token", token: "s3cret", authorization: "Bearer s3cret", wantStatus: http.StatusOK, wantBody: `{"ok":true}`},
+		{name: "missing header", token: "s3cret", wantStatus: http.StatusUnauthorized, wantBody: `{"error":"admin authorization required"}`},
+		{name: "wrong token", token: "s3cret", authorization: "Bearer guess", wantStatus: http.StatusForbidden, wantBody: `{"error":"invalid admin token"}`},
+		{name: "wrong scheme", token: "s3cret", authorization: "Basic s3cret", wantStatus: http.StatusUnauthorized, wantBody: `{"error":"admin authorization required"}`},
+		{name: "disabled", token: "", authorization: "Bearer ", wantStatus: http.StatusNotFound, wantBody: `{"error":"not found","path":"/admin"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			adminRouter(tt.token).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+			if tt.wantStatus == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer realm="admin"`, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAdminAuthMiddlewareFunc_RotatesToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	token := "old"
+	r := gin.New()
+	r.GET("/admin", AdminAuthMiddlewareFunc(func() string { return token }), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	status := func(authorization string) int {
+		req := httptest.NewRequest("GET", "/admin", nil)
+		req.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, status("Bearer old"))
+
+	token = "new"
+	assert.Equal(t, http.StatusForbidden, status("Bearer old"))
+	assert.Equal(t, http.StatusOK, status("Bearer new"))
+
+	token = ""
+	assert.Equal(t, http.StatusNotFound, status("Bearer new"))
+}
+
+// purgeRouter serves PurgeRecords behind the admin middleware with the token
+// "s3cret", with purging enabled as given.
+func purgeRouter(enabled bool) (*gin.Engine, *MockRecordRepository) {
+	handler, mockRepo := setupTestHandler()
+	if enabled {
+		handler.EnablePurge()
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.DELETE("/api/v1/admin/records", AdminAuthMiddleware("s3cret"), handler.PurgeRecords)
+	return r, mockRepo
+}
+
+func TestPurgeRecords(t *testing.T) {
+	tests := []struct {
+		name          string
+		enabled       bool
+		authorization string
+		query         string
+		deleted       int64
+		err           error
+		wantStatus    int
+		wantBody      string
+	}{
+		{
+			name: "authorized and confirmed", enabled: true, authorization: "Bearer s3cret", query: "?confirm=DELETE_ALL", deleted: 42,
+			wantStatus: http.StatusOK, wantBody: `{"message":"All records purged","deleted":42}`,
+		},
+		{
+			name: "missing confirmation", enabled: true, authorization: "Bearer s3cret",
+			wantStatus: http.StatusBadRequest, wantBody: `{"error":"invalid confirm '': must be DELETE_ALL to delete every record","field":"confirm"}`,
+		},
+		{
+			name: "wrong confirmation", enabled: true, authorization: "Bearer s3cret", query: "?confirm=delete_all",
+			wantStatus: http.StatusBadRequest, wantBody: `{"error":"invalid confirm 'delete_all': must be DELETE_ALL to delete every record","field":"confirm"}`,
+		},
+		{
+			name: "unauthenticated", enabled: true, query: "?confirm=DELETE_ALL",
+			wantStatus: http.StatusUnauthorized, wantBody: `{"error":"admin authorization required"}`,
+		},
+		{
+			name: "unauthorized", enabled: true, authorization: "Bearer guess", query: "?confirm=DELETE_ALL",
+			wantStatus: http.StatusForbidden, wantBody: `{"error":"invalid admin token"}`,
+		},
+		{
+			name: "disabled", authorization: "Bearer s3cret", query: "?confirm=DELETE_ALL",
+			wantStatus: http.StatusForbidden, wantBody: `{"error":"purging records is disabled in this environment"}`,
+		},
+		{
+			name: "repository error", enabled: true, authorization: "Bearer s3cret", query: "?confirm=DELETE_ALL", err: assert.AnError,
+			wantStatus: http.StatusInternalServerError, wantBody: `{"error":"Failed to purge records"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, mockRepo := purgeRouter(tt.enabled)
+			if tt.deleted != 0 || tt.err != nil {
+				mockRepo.On("DeleteAll").Return(tt.deleted, tt.err)
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/records"+tt.query, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+			mockRepo.AssertExpectations(t)
+			if tt.deleted == 0 && tt.err == nil {
+				mockRepo.AssertNotCalled(t, "DeleteAll")
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"tokenpagination/repository"
+)
+
+// maxStreamedRecords bounds the records a single all-pages request streams, so
+// that one request cannot walk an arbitrarily large table. The stream stops at the
+// end of the page that reaches it.
+const maxStreamedRecords = 10000
+
+// streamTrailer is the last line of an all-pages stream that ended before the
+// last page. NextContinuationToken, when set, resumes the walk with another
+// request.
+type streamTrailer struct {
+	Error                 string  `json:"error"`
+	NextContinuationToken *string `json:"next_continuation_token,omitempty"`
+}
+
+// StreamAllPages handles GET /api/v1/records/all-pages for clients that cannot
+// follow continuation tokens. It walks the pages of the paginated endpoint
+// server-side, starting at continuation_token when given, and streams every record
+// as one JSON object per line (NDJSON), flushing after each page. page_size sets
+// the size of the internal pages, the ordering and filter parameters select the
+// listing, and timestamps and null_context format the records as on the paginated
+// endpoint.
+//
+// A stream that ends early, on maxStreamedRecords, the maximum page depth or a
+// failed read, ends with a trailer line carrying an error and, when the limit was
+// reached, the next_continuation_token to resume the walk from.
+// The walk stops without a trailer when the client goes away.
+func (h *RecordHandler) StreamAllPages(c *gin.Context) {
+	format, ok := parseRecordFormat(c)
+	if !ok {
+		return
+	}
+
+	params, err := ParsePaginationParams(c, h.pagination)
+	if err != nil {
+		respondBadRequest(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	encoder := json.NewEncoder(c.Writer)
+	token, streamed, started := params.ContinuationToken, 0, false
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		result, err := h.getPage(params, token)
+		if err != nil && !started {
+			// Nothing was sent yet, so the failure can still be reported as JSON
+			if errors.Is(err, repository.ErrPaginationTooDeep) {
+				respondTooDeep(c)
+				return
+			}
+			respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, repository.ErrPaginationTooDeep) {
+			encoder.Encode(streamTrailer{Error: "pagination too deep"})
+			return
+		}
+		if err != nil {
+			encoder.Encode(streamTrailer{Error: "failed to read records"})
+			return
+		}
+
+		if !started {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+			started = true
+		}
+
+		formatRecords(result.Records, format)
+		for _, record := range result.Records {
+			if err := encoder.Encode(record); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+
+		streamed += len(result.Records)
+		if result.NextContinuationToken == nil {
+			return
+		}
+		token = *result.NextContinuationToken
+		if streamed >= maxStreamedRecords {
+			encoder.Encode(streamTrailer{
+				Error:                 fmt.Sprintf("stream limit of %d records reached", maxStreamedRecords),
+				NextContinuationToken: &token,
+			})
+			return
+		}
+	}
+}
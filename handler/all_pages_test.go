@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"tokenpagination/repository"
+)
+
+// streamedLines decodes every NDJSON line of body.
+func streamedLines(t *testing.T, body string) []map[string]any {
+	var lines []map[string]any
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
+
+// pagedRecords returns n records split into pages of pageSize, as GetPaginated
+// would return them, with the token of page i+1 being "page-<i+1>".
+func pagedRecords(n, pageSize int) []*repository.PaginatedResult {
+	var pages []*repository.PaginatedResult
+	for start := 0; start < n; start += pageSize {
+		page := &repository.PaginatedResult{PageDepth: len(pages) + 1}
+		for i := start; i < min(start+pageSize, n); i++ {
+			page.Records = append(page.Records, repository.Record{ResourceID: fmt.Sprintf("r-%d", i), ResourceType: "user"})
+		}
+		if start+pageSize < n {
+			page.NextContinuationToken = stringPtr(fmt.Sprintf("page-%d", len(pages)+1))
+		}
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// expectPages sets up GetPaginated to serve pages, the first without a token.
+func expectPages(mockRepo *MockRecordRepository, pages []*repository.PaginatedResult, pageSize int) {
+	token := ""
+	for i, page := range pages {
+		mockRepo.On("GetPaginated", token, pageSize).Return(page, nil).Once()
+		token = fmt.Sprintf("page-%d", i+1)
+	}
+}
+
+func TestStreamAllPages(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	expectPages(mockRepo, pagedRecords(7, 3), 3)
+
+	c, w := setupGinContext("GET", "/api/v1/records/all-pages?page_size=3", nil)
+	handler.StreamAllPages(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	var ids []string
+	for _, line := range streamedLines(t, w.Body.String()) {
+		ids = append(ids, line["resource_id"].(string))
+	}
+	assert.Equal(t, []string{"r-0", "r-1", "r-2", "r-3", "r-4", "r-5", "r-6"}, ids)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestStreamAllPages_OrderAndFilter(t *testing.T) {
+	t.Run("resource type", func(t *testing.T) {
+		handler, mockRepo := setupTestHandler()
+		pages := pagedRecords(4, 2)
+		mockRepo.On("GetPaginatedByType", "user", "", 2).Return(pages[0], nil)
+		mockRepo.On("GetPaginatedByType", "user", "page-1", 2).Return(pages[1], nil)
+
+		c, w := setupGinContext("GET", "/api/v1/records/all-pages?resource_type=user&page_size=2", nil)
+		handler.StreamAllPages(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, streamedLines(t, w.Body.String()), 4)
+		mockRepo.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "GetPaginated", mock.Anything, mock.Anything)
+	})
+
+	t.Run("order", func(t *testing.T) {
+		handler, mockRepo := setupTestHandler()
+		pages := pagedRecords(4, 2)
+		order := repository.SortOrder{Column: "updated_at", Ascending: true}
+		filter := repository.PaginationFilter{MetadataKey: "tier"}
+		mockRepo.On("GetPaginatedSorted", order, filter, "", 2).Return(pages[0], nil)
+		mockRepo.On("GetPaginatedSorted", order, filter, "page-1", 2).Return(pages[1], nil)
+
+		c, w := setupGinContext("GET", "/api/v1/records/all-pages?order_by=updated_at&order=asc&metadata_key=tier&page_size=2", nil)
+		handler.StreamAllPages(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, streamedLines(t, w.Body.String()), 4)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestStreamAllPages_Empty(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	mockRepo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{PageDepth: 1}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/all-pages", nil)
+	handler.StreamAllPages(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestStreamAllPages_Limit(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	pages := pagedRecords(maxStreamedRecords+150, 100)
+	expectPages(mockRepo, pages[:maxStreamedRecords/100], 100)
+
+	c, w := setupGinContext("GET", "/api/v1/records/all-pages?page_size=100", nil)
+	handler.StreamAllPages(c)
+
+	lines := streamedLines(t, w.Body.String())
+	require.Len(t, lines, maxStreamedRecords+1)
+	assert.Equal(t, map[string]any{
+		"error":                   "stream limit of 10000 records reached",
+		"next_continuation_token": "page-100",
+	}, lines[maxStreamedRecords])
+	mockRepo.AssertExpectations(t)
+}
+
+func TestStreamAllPages_Errors(t *testing.T) {
+	t.Run("first page fails", func(t *testing.T) {
+		handler, mockRepo := setupTestHandler()
+		mockRepo.On("GetPaginated", "bad", 5).Return(nil, fmt.Errorf("invalid continuation token"))
+
+		c, w := setupGinContext("GET", "/api/v1/records/all-pages?continuation_token=bad", nil)
+		handler.StreamAllPages(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error": "invalid continuation token"}`, w.Body.String())
+	})
+
+	t.Run("later page fails", func(t *testing.T) {
+		handler, mockRepo := setupTestHandler()
+		pages := pagedRecords(6, 3)
+		mockRepo.On("GetPaginated", "", 3).Return(pages[0], nil)
+		mockRepo.On("GetPaginated", "page-1", 3).Return(nil, fmt.Errorf("connection reset"))
+
+		c, w := setupGinContext("GET", "/api/v1/records/all-pages?page_size=3", nil)
+		handler.StreamAllPages(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		lines := streamedLines(t, w.Body.String())
+		require.Len(t, lines, 4)
+		assert.Equal(t, map[string]any{"error": "failed to read records"}, lines[3])
+	})
+
+	t.Run("too deep", func(t *testing.T) {
+		handler, mockRepo := setupTestHandler()
+		pages := pagedRecords(6, 3)
+		mockRepo.On("GetPaginated", "", 3).Return(pages[0], nil)
+		mockRepo.On("GetPaginated", "page-1", 3).Return(nil, repository.ErrPaginationTooDeep)
+
+		c, w := setupGinContext("GET", "/api/v1/records/all-pages?page_size=3", nil)
+		handler.StreamAllPages(c)
+
+		lines := streamedLines(t, w.Body.String())
+		require.Len(t, lines, 4)
+		assert.Equal(t, map[string]any{"error": "pagination too deep"}, lines[3])
+	})
+
+	t.Run("invalid page size", func(t *testing.T) {
+		handler, mockRepo := setupTestHandler()
+
+		c, w := setupGinContext("GET", "/api/v1/records/all-pages?page_size=0", nil)
+		handler.StreamAllPages(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockRepo.AssertNotCalled(t, "GetPaginated", mock.Anything, mock.Anything)
+	})
+}
+
+func TestStreamAllPages_Canceled(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	pages := pagedRecords(6, 3)
+
+	c, w := setupGinContext("GET", "/api/v1/records/all-pages?page_size=3", nil)
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	c.Request = c.Request.WithContext(ctx)
+	// The client goes away while the first page is read
+	mockRepo.On("GetPaginated", "", 3).Return(pages[0], nil).Run(func(mock.Arguments) { cancel() })
+
+	handler.StreamAllPages(c)
+
+	assert.Len(t, streamedLines(t, w.Body.String()), 3)
+	mockRepo.AssertNotCalled(t, "GetPaginated", "page-1", 3)
+}
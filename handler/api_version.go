@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultAPIVersion is the response shape served to clients that do not send an
+// Accept-Version header.
+const DefaultAPIVersion = "1"
+
+// SupportedAPIVersions lists the values accepted in the Accept-Version header.
+var SupportedAPIVersions = []string{"1"}
+
+// apiVersionKey is the gin context key holding the negotiated API version.
+const apiVersionKey = "api_version"
+
+// APIVersionMiddleware negotiates the response shape from the Accept-Version
+// request header. A missing header selects DefaultAPIVersion; a leading "v" is
+// ignored, so "v1" and "1" are equivalent. Unsupported versions are rejected with
+// 406 Not Acceptable. The negotiated version is echoed in the API-Version response
+// header and available to handlers through APIVersion.
+func APIVersionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		version := strings.TrimPrefix(strings.TrimSpace(c.GetHeader("Accept-Version")), "v")
+		if version == "" {
+			version = DefaultAPIVersion
+		}
+
+		if !slices.Contains(SupportedAPIVersions, version) {
+			respond(c, http.StatusNotAcceptable, gin.H{
+				"error":              fmt.Sprintf("unsupported API version '%s'", c.GetHeader("Accept-Version")),
+				"supported_versions": SupportedAPIVersions,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set(apiVersionKey, version)
+		c.Header("API-Version", version)
+		c.Next()
+	}
+}
+
+// APIVersion returns the API version negotiated for the request, or
+// DefaultAPIVersion when the middleware did not run.
+func APIVersion(c *gin.Context) string {
+	if version := c.GetString(apiVersionKey); version != "" {
+		return version
+	}
+	return DefaultAPIVersion
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// versionedRouter serves a route that echoes the negotiated API version.
+func versionedRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(APIVersionMiddleware())
+	r.GET("/api/v1/records", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"version": APIVersion(c)})
+	})
+	return r
+}
+
+func TestAPIVersionMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		wantStatus  int
+		wantVersion string
+		wantBody    string
+	}{
+		{name: "default", wantStatus: http.StatusOK, wantVersion: "1", wantBody: `{"version":"1"}`},
+		{name: "explicit", header: "1", wantStatus: http.StatusOK, wantVersion: "1", wantBody: `{"version":"1"}`},
+		{name: "v prefix", header: "v1", wantStatus: http.StatusOK, wantVersion: "1", wantBody: `{"version":"1"}`},
+		{name: "unsupported", header: "2", wantStatus: http.StatusNotAcceptable, wantBody: `{"error":"unsupported API version '2'","supported_versions":["1"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/records", nil)
+			if tt.header != "" {
+				req.Header.Set("Accept-Version", tt.header)
+			}
+			w := httptest.NewRecorder()
+			versionedRouter().ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantVersion, w.Header().Get("API-Version"))
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestAPIVersion_WithoutMiddleware(t *testing.T) {
+	c, _ := setupGinContext("GET", "/api/v1/records", nil)
+	assert.Equal(t, DefaultAPIVersion, APIVersion(c))
+}
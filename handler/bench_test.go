@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tokenpagination/repository"
+)
+
+// benchPage returns a page of 100 records whose contexts are JSON documents of
+// about contextSize bytes.
+func benchPage(contextSize int) *repository.PaginatedResult {
+	context := fmt.Sprintf(`{"note":"%s"}`, strings.Repeat("x", contextSize-len(`{"note":""}`)))
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	token := "eyJ0IjoidXNlciIsImkiOiJ1c2VyLTEwMCIsImMiOjE3MDUzMTQ2MDAsInAiOjF9"
+
+	records := make([]repository.Record, 100)
+	for i := range records {
+		records[i] = repository.Record{
+			ResourceID:   fmt.Sprintf("user-%03d", i),
+			ResourceType: "user",
+			Context:      &context,
+			Metadata:     map[string]string{"source": "import"},
+			CreatedAt:    created.Add(-time.Duration(i) * time.Second),
+			UpdatedAt:    created,
+		}
+	}
+	return &repository.PaginatedResult{Records: records, NextContinuationToken: &token, PageDepth: 1}
+}
+
+// BenchmarkGetRecordsPaginated measures serving a page of 100 records through the
+// router, from parsing the query to writing the JSON body, with the repository
+// mocked out.
+func BenchmarkGetRecordsPaginated(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+
+	for _, contextSize := range []int{256, 4096, 65536} {
+		handler, mockRepo := setupTestHandler()
+		mockRepo.On("GetPaginated", "", 100).Return(benchPage(contextSize), nil)
+
+		r := gin.New()
+		r.GET("/api/v1/records/paginated", handler.GetRecordsPaginated)
+
+		b.Run(fmt.Sprintf("context=%dB", contextSize), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/records/paginated?page_size=100", nil))
+				if w.Code != http.StatusOK {
+					b.Fatalf("status %d: %s", w.Code, w.Body.String())
+				}
+				b.SetBytes(int64(w.Body.Len()))
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireJSON rejects requests whose Content-Type is not application/json with
+// 415 Unsupported Media Type, before the handler tries to bind the body. Parameters
+// such as "; charset=utf-8" are allowed. Apply it to the endpoints taking a JSON
+// body; endpoints reading only the path or query string do not need it.
+func RequireJSON() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		contentType := c.GetHeader("Content-Type")
+		if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != gin.MIMEJSON {
+			message := "Content-Type must be application/json"
+			if contentType != "" {
+				message = fmt.Sprintf("Content-Type must be application/json, got '%s'", contentType)
+			}
+			respond(c, http.StatusUnsupportedMediaType, gin.H{"error": message})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
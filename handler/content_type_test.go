@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// jsonOnlyRouter serves a route guarded by RequireJSON that accepts any body.
+func jsonOnlyRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/records", RequireJSON(), func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{"ok": true})
+	})
+	return r
+}
+
+func TestRequireJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		wantStatus  int
+		wantBody    string
+	}{
+		{name: "json", contentType: "application/json", wantStatus: http.StatusCreated, wantBody: `{"ok":true}`},
+		{name: "json with charset", contentType: "application/json; charset=utf-8", wantStatus: http.StatusCreated, wantBody: `{"ok":true}`},
+		{name: "mixed case", contentType: "Application/JSON", wantStatus: http.StatusCreated, wantBody: `{"ok":true}`},
+		{name: "missing", wantStatus: http.StatusUnsupportedMediaType, wantBody: `{"error":"Content-Type must be application/json"}`},
+		{name: "plain text", contentType: "text/plain", wantStatus: http.StatusUnsupportedMediaType, wantBody: `{"error":"Content-Type must be application/json, got 'text/plain'"}`},
+		{name: "form", contentType: "application/x-www-form-urlencoded", wantStatus: http.StatusUnsupportedMediaType, wantBody: `{"error":"Content-Type must be application/json, got 'application/x-www-form-urlencoded'"}`},
+		{name: "malformed", contentType: "application/json; charset", wantStatus: http.StatusUnsupportedMediaType, wantBody: `{"error":"Content-Type must be application/json, got 'application/json; charset'"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/records", strings.NewReader(`{"resource_id":"user-1","resource_type":"user"}`))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			jsonOnlyRouter().ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
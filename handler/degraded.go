@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pinger reports whether the database is reachable. *sql.DB satisfies it.
+type Pinger interface {
+	Ping() error
+}
+
+// maxCachedReads bounds the responses the degraded-mode cache holds, so that
+// clients requesting many distinct URLs cannot grow it without limit.
+const maxCachedReads = 1000
+
+// readCache keeps the last successful response of each read request for a short
+// time, so that it can be served while the database is unreachable. It holds at
+// most maxCachedReads responses and evicts the least recently used one first.
+type readCache struct {
+	db  Pinger
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // of *cachedRead, in recency
+	recency *list.List               // most recently used first
+}
+
+type cachedRead struct {
+	key     string
+	body    any
+	expires time.Time
+}
+
+// EnableDegradedMode makes the read endpoints fall back to the last successful
+// response for the same request, if it is younger than ttl, when a read fails and
+// the database does not answer a ping. Responses served from the cache carry the
+// header X-Served-From: cache.
+func (h *RecordHandler) EnableDegradedMode(db Pinger, ttl time.Duration) {
+	h.cache = &readCache{db: db, ttl: ttl, now: time.Now, entries: make(map[string]*list.Element), recency: list.New()}
+}
+
+// respondRead writes a successful read response and, in degraded mode, remembers
+// it for the request.
+func (h *RecordHandler) respondRead(c *gin.Context, obj any) {
+	if h.cache != nil {
+		h.cache.store(c.Request.URL.RequestURI(), obj)
+	}
+	respond(c, http.StatusOK, obj)
+}
+
+// serveCached answers a failed read from the cache when degraded mode is enabled,
+// the database is unreachable, and a fresh response for the request exists. It
+// reports whether a response was written.
+func (h *RecordHandler) serveCached(c *gin.Context) bool {
+	if h.cache == nil || h.cache.db.Ping() == nil {
+		return false
+	}
+
+	body, ok := h.cache.load(c.Request.URL.RequestURI())
+	if !ok {
+		return false
+	}
+
+	c.Header("X-Served-From", "cache")
+	respond(c, http.StatusOK, body)
+	return true
+}
+
+// store remembers body under key, evicting the least recently used entry when
+// the cache is full.
+func (rc *readCache) store(key string, body any) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	expires := rc.now().Add(rc.ttl)
+	if element, ok := rc.entries[key]; ok {
+		*element.Value.(*cachedRead) = cachedRead{key: key, body: body, expires: expires}
+		rc.recency.MoveToFront(element)
+		return
+	}
+
+	if rc.recency.Len() >= maxCachedReads {
+		rc.remove(rc.recency.Back())
+	}
+	rc.entries[key] = rc.recency.PushFront(&cachedRead{key: key, body: body, expires: expires})
+}
+
+// load returns the body stored under key if it has not expired. An expired entry
+// is dropped.
+func (rc *readCache) load(key string) (any, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	element, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cachedRead)
+	if !rc.now().Before(entry.expires) {
+		rc.remove(element)
+		return nil, false
+	}
+	rc.recency.MoveToFront(element)
+	return entry.body, true
+}
+
+// remove drops an entry. The caller holds rc.mu.
+func (rc *readCache) remove(element *list.Element) {
+	rc.recency.Remove(element)
+	delete(rc.entries, element.Value.(*cachedRead).key)
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tokenpagination/repository"
+)
+
+// fakePinger fails its pings while down is set.
+type fakePinger struct {
+	down bool
+}
+
+func (p *fakePinger) Ping() error {
+	if p.down {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestDegradedMode_ServesCachedResponseWhenDatabaseIsDown(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	db := &fakePinger{}
+	handler.EnableDegradedMode(db, time.Minute)
+
+	mockResult := &repository.PaginatedResult{
+		Records:    []repository.Record{{ResourceID: "user-1", ResourceType: "user"}},
+		PageDepth:  1,
+		IsLastPage: true,
+	}
+	mockRepo.On("GetPaginated", "", 5).Return(mockResult, nil).Once()
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated", nil)
+	handler.GetRecordsPaginated(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-Served-From"))
+
+	// The database goes away
+	db.down = true
+	mockRepo.On("GetPaginated", "", 5).Return(nil, errors.New("dial tcp: connection refused")).Once()
+
+	c, w = setupGinContext("GET", "/api/v1/records/paginated", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "cache", w.Header().Get("X-Served-From"))
+
+	var response repository.PaginatedResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Records, 1)
+	assert.Equal(t, "user-1", response.Records[0].ResourceID)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDegradedMode_ErrorsWhenDatabaseIsUp(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	handler.EnableDegradedMode(&fakePinger{}, time.Minute)
+
+	mockRepo.On("GetAll").Return([]repository.Record{{ResourceID: "user-1", ResourceType: "user"}}, false, nil).Once()
+	c, w := setupGinContext("GET", "/api/v1/records", nil)
+	handler.GetRecords(c)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// A failure the database can still answer pings through is a real error
+	mockRepo.On("GetAll").Return([]repository.Record(nil), false, errors.New("query failed")).Once()
+	c, w = setupGinContext("GET", "/api/v1/records", nil)
+	handler.GetRecords(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, w.Header().Get("X-Served-From"))
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDegradedMode_ExpiredEntryIsNotServed(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	handler.EnableDegradedMode(&fakePinger{down: true}, time.Minute)
+
+	now := time.Unix(1705312800, 0)
+	handler.cache.now = func() time.Time { return now }
+
+	mockResult := &repository.PaginatedResult{Records: []repository.Record{{ResourceID: "user-1", ResourceType: "user"}}}
+	mockRepo.On("GetActivityFeed", 5, "").Return(mockResult, nil).Once()
+	c, w := setupGinContext("GET", "/api/v1/records/activity", nil)
+	handler.GetActivityFeed(c)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	now = now.Add(time.Minute)
+	mockRepo.On("GetActivityFeed", 5, "").Return(nil, errors.New("dial tcp: connection refused")).Once()
+	c, w = setupGinContext("GET", "/api/v1/records/activity", nil)
+	handler.GetActivityFeed(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, w.Header().Get("X-Served-From"))
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestReadCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	handler, _ := setupTestHandler()
+	handler.EnableDegradedMode(&fakePinger{down: true}, time.Minute)
+	cache := handler.cache
+
+	for i := 0; i < maxCachedReads; i++ {
+		cache.store(fmt.Sprintf("/api/v1/records?page=%d", i), i)
+	}
+	// Reading the oldest entry makes the second oldest the least recently used
+	_, ok := cache.load("/api/v1/records?page=0")
+	require.True(t, ok)
+
+	cache.store("/api/v1/records?page=new", "new")
+
+	assert.Equal(t, maxCachedReads, cache.recency.Len())
+	assert.Len(t, cache.entries, maxCachedReads)
+	_, ok = cache.load("/api/v1/records?page=1")
+	assert.False(t, ok)
+	for _, key := range []string{"/api/v1/records?page=0", "/api/v1/records?page=2", "/api/v1/records?page=new"} {
+		_, ok := cache.load(key)
+		assert.True(t, ok, key)
+	}
+}
+
+func TestReadCache_DropsExpiredEntryOnLoad(t *testing.T) {
+	handler, _ := setupTestHandler()
+	handler.EnableDegradedMode(&fakePinger{down: true}, time.Minute)
+	cache := handler.cache
+	now := time.Unix(1705312800, 0)
+	cache.now = func() time.Time { return now }
+
+	cache.store("/api/v1/records", "body")
+	now = now.Add(time.Minute)
+
+	_, ok := cache.load("/api/v1/records")
+	assert.False(t, ok)
+	assert.Empty(t, cache.entries)
+	assert.Zero(t, cache.recency.Len())
+}
+
+func TestDegradedMode_DisabledByDefault(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetAll").Return([]repository.Record(nil), false, errors.New("dial tcp: connection refused"))
+	c, w := setupGinContext("GET", "/api/v1/records", nil)
+	handler.GetRecords(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, w.Header().Get("X-Served-From"))
+}
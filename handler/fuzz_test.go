@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+
+	"tokenpagination/repository"
+)
+
+// FuzzGetRecordsPaginatedParams sends arbitrary page_size and continuation_token
+// values to the paginated endpoint, backed by a real repository over an empty
+// sqlmock table, and checks that none of them is answered with a server error:
+// every malformed parameter is the client's fault.
+func FuzzGetRecordsPaginatedParams(f *testing.F) {
+	token := base64.URLEncoding.EncodeToString([]byte(`{"t":"user","i":"user-1","c":1705314600,"p":1}`))
+	for _, seed := range []struct{ pageSize, token string }{
+		{"", ""},
+		{"10", token},
+		{"0", ""},
+		{"-1", ""},
+		{"99999999999999999999", ""},
+		{"1e3", ""},
+		{"10", token[:len(token)/2]},
+		{"10", token + "=="},
+		{"10", strings.Repeat("A", 4096)},
+		{"10", base64.URLEncoding.EncodeToString([]byte("ユーザー|ü-🙂|1705314600|2"))},
+		{"10", base64.URLEncoding.EncodeToString([]byte(`{"t":"user","i":"user-1","c":1705314600,"p":9223372036854775807}`))},
+		{"１０", "\xff\xfe"},
+	} {
+		f.Add(seed.pageSize, seed.token)
+	}
+
+	gin.SetMode(gin.TestMode)
+	f.Fuzz(func(t *testing.T, pageSize, token string) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		mock.ExpectQuery(".").WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}))
+
+		r := gin.New()
+		r.GET("/api/v1/records/paginated", NewRecordHandler(repository.NewRecordRepository(db)).GetRecordsPaginated)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/records/paginated", nil)
+		req.URL.RawQuery = url.Values{"page_size": {pageSize}, "continuation_token": {token}}.Encode()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code >= http.StatusInternalServerError {
+			t.Errorf("page_size %q, continuation_token %q: status %d: %s", pageSize, token, w.Code, w.Body.String())
+		}
+	})
+}
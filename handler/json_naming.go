@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JSON key namings accepted by the naming query parameter and JSON_NAMING.
+const (
+	NamingSnake = "snake"
+	NamingCamel = "camel"
+)
+
+// jsonNamingKey is the gin context key holding the key naming of the response.
+const jsonNamingKey = "json_naming"
+
+// JSONNamingMiddleware selects the key naming of JSON responses from the naming
+// query parameter, falling back to defaultNaming, which is NamingSnake when empty.
+// With NamingCamel respond renames keys such as resource_id to resourceId. Unknown
+// namings are rejected with 400.
+func JSONNamingMiddleware(defaultNaming string) gin.HandlerFunc {
+	if defaultNaming == "" {
+		defaultNaming = NamingSnake
+	}
+
+	return func(c *gin.Context) {
+		naming := c.Query("naming")
+		switch naming {
+		case "":
+			naming = defaultNaming
+		case NamingSnake, NamingCamel:
+		default:
+			respond(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid naming '%s': must be snake or camel", naming), "field": "naming"})
+			c.Abort()
+			return
+		}
+
+		c.Set(jsonNamingKey, naming)
+		c.Next()
+	}
+}
+
+// camelCaseKeys returns obj as a JSON value whose object keys are camelCase. The
+// keys of metadata objects and of the groups of the grouped listing, which are
+// resource types, are client data and kept as they are.
+func camelCaseKeys(obj any) (any, error) {
+	encoded, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	// Numbers are kept as written, so large integers do not lose precision
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return renameKeys(value), nil
+}
+
+// renameKeys converts the object keys in value to camelCase, recursively.
+func renameKeys(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		renamed := make(map[string]any, len(value))
+		for key, nested := range value {
+			switch key {
+			case "metadata":
+				renamed[key] = nested
+			case "groups":
+				renamed[key] = renameValues(nested)
+			default:
+				renamed[camelCase(key)] = renameKeys(nested)
+			}
+		}
+		return renamed
+	case []any:
+		for i := range value {
+			value[i] = renameKeys(value[i])
+		}
+	}
+	return value
+}
+
+// renameValues converts the object keys inside the values of the object value to
+// camelCase, keeping its own keys.
+func renameValues(value any) any {
+	object, ok := value.(map[string]any)
+	if !ok {
+		return renameKeys(value)
+	}
+	for key, nested := range object {
+		object[key] = renameKeys(nested)
+	}
+	return object
+}
+
+// camelCase converts a snake_case name such as next_continuation_token to
+// nextContinuationToken.
+func camelCase(name string) string {
+	first, rest, found := strings.Cut(name, "_")
+	if !found {
+		return name
+	}
+
+	var b strings.Builder
+	b.WriteString(first)
+	for _, part := range strings.Split(rest, "_") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
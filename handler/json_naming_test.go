@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tokenpagination/repository"
+)
+
+// namingRouter serves the paginated endpoint of handler behind the naming
+// middleware.
+func namingRouter(handler *RecordHandler, defaultNaming string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(JSONNamingMiddleware(defaultNaming))
+	r.GET("/api/v1/records/paginated", handler.GetRecordsPaginated)
+	return r
+}
+
+func TestJSONNamingMiddleware_CamelCase(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	token := "next-token"
+	mockRepo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{
+		Records: []repository.Record{{
+			ResourceID:   "user-1",
+			ResourceType: "user",
+			Metadata:     map[string]string{"account_tier": "gold"},
+			CreatedAt:    created,
+			UpdatedAt:    created,
+		}},
+		NextContinuationToken: &token,
+		PageDepth:             1,
+	}, nil)
+
+	w := httptest.NewRecorder()
+	namingRouter(handler, "").ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/records/paginated?naming=camel", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"records": [{
+			"resourceId": "user-1",
+			"resourceType": "user",
+			"metadata": {"account_tier": "gold"},
+			"createdAt": "2024-01-15T10:30:00Z",
+			"updatedAt": "2024-01-15T10:30:00Z"
+		}],
+		"nextContinuationToken": "next-token",
+		"pageDepth": 1,
+		"isLastPage": false,
+		"requestedPageSize": 5
+	}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestJSONNamingMiddleware_DefaultNaming(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaultNaming string
+		query         string
+		wantKey       string
+	}{
+		{name: "snake by default", wantKey: `"page_depth"`},
+		{name: "configured camel", defaultNaming: NamingCamel, wantKey: `"pageDepth"`},
+		{name: "request overrides configuration", defaultNaming: NamingCamel, query: "?naming=snake", wantKey: `"page_depth"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, mockRepo := setupTestHandler()
+			mockRepo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{Records: []repository.Record{}, PageDepth: 1, IsLastPage: true}, nil)
+
+			w := httptest.NewRecorder()
+			namingRouter(handler, tt.defaultNaming).ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/records/paginated"+tt.query, nil))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantKey)
+		})
+	}
+}
+
+func TestJSONNamingMiddleware_InvalidNaming(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	w := httptest.NewRecorder()
+	namingRouter(handler, "").ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/records/paginated?naming=kebab", nil))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"invalid naming 'kebab': must be snake or camel","field":"naming"}`, w.Body.String())
+	mockRepo.AssertNotCalled(t, "GetPaginated", "", 5)
+}
+
+func TestJSONNamingMiddleware_KeepsGroupKeys(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	mockRepo.On("GetGroupedByType", 0).Return(map[string][]repository.Record{
+		"audit_log": {{ResourceID: "log-1", ResourceType: "audit_log"}},
+	}, nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(JSONNamingMiddleware(NamingCamel))
+	r.GET("/api/v1/records/grouped", handler.GetGroupedRecords)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/records/grouped", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"groups":{"audit_log":[{"resourceId":"log-1","resourceType":"audit_log","createdAt":"0001-01-01T00:00:00Z","updatedAt":"0001-01-01T00:00:00Z"}]}}`, w.Body.String())
+}
+
+func TestCamelCase(t *testing.T) {
+	tests := map[string]string{
+		"resource_id":             "resourceId",
+		"next_continuation_token": "nextContinuationToken",
+		"records":                 "records",
+		"error":                   "error",
+		"trailing_":               "trailing",
+	}
+	for name, want := range tests {
+		assert.Equal(t, want, camelCase(name), name)
+	}
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"tokenpagination/repository"
+)
+
+// defaultLivePollInterval is how often StreamLive polls for new records while
+// none are waiting.
+const defaultLivePollInterval = time.Second
+
+// StreamLive handles GET /api/v1/records/stream/live, which holds the connection
+// open and pushes newly created records as Server-Sent Events. It polls GetNewer
+// every poll interval, or right away while more records are waiting, and sends
+// each record, oldest first, as a record event whose data is the record as on the
+// paginated endpoint. The last event of every batch carries the since token
+// after it as its id, so an EventSource that reconnects resumes where it left off
+// with the Last-Event-ID header; since_token does the same for other clients.
+// Without either the stream starts after the newest stored record. page_size
+// bounds the records read per poll, and timestamps and null_context format them.
+//
+// A failed poll ends the stream with an error event. The stream ends without
+// one when the client goes away.
+func (h *RecordHandler) StreamLive(c *gin.Context) {
+	format, ok := parseRecordFormat(c)
+	if !ok {
+		return
+	}
+
+	params, err := ParsePaginationParams(c, h.pagination)
+	if err == nil {
+		err = params.requireDefaultOrder(c)
+	}
+	if err != nil {
+		respondBadRequest(c, err)
+		return
+	}
+
+	since := c.Query("since_token")
+	if since == "" {
+		since = c.GetHeader("Last-Event-ID")
+	}
+	if since == "" {
+		newest, err := h.repo.GetPaginated("", 1)
+		if err != nil {
+			respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to start stream"})
+			return
+		}
+		if newest.SinceToken != nil {
+			since = *newest.SinceToken
+		} else {
+			since = h.repo.SinceStart()
+		}
+	}
+
+	// The first poll runs before the response starts, so that a rejected token is
+	// still answered with a JSON 400
+	result, err := h.repo.GetNewer(since, params.PageSize)
+	if errors.Is(err, repository.ErrInvalidToken) || errors.Is(err, repository.ErrTokenTooLong) {
+		respondBadRequest(c, err)
+		return
+	}
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to start stream"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ctx := c.Request.Context()
+	ticker := time.NewTicker(h.livePollInterval)
+	defer ticker.Stop()
+	for {
+		for i := len(result.Records) - 1; i >= 0; i-- {
+			format.apply(&result.Records[i])
+			data, err := json.Marshal(result.Records[i])
+			if err != nil {
+				writeEvent(c.Writer, "error", "", `{"error":"failed to encode record"}`)
+				return
+			}
+			id := ""
+			if i == 0 {
+				id = result.SinceToken
+			}
+			writeEvent(c.Writer, "record", id, string(data))
+		}
+		c.Writer.Flush()
+
+		if !result.HasMore {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if result, err = h.repo.GetNewer(result.SinceToken, params.PageSize); err != nil {
+			writeEvent(c.Writer, "error", "", `{"error":"failed to read records"}`)
+			c.Writer.Flush()
+			return
+		}
+	}
+}
+
+// writeEvent writes a Server-Sent Event. data must not contain newlines, which
+// holds for compact JSON.
+func writeEvent(w io.Writer, event, id, data string) {
+	fmt.Fprintf(w, "event: %s\n", event)
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
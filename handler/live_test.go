@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tokenpagination/repository"
+)
+
+// liveEvent is a Server-Sent Event read back from the live stream.
+type liveEvent struct {
+	event, id, data string
+}
+
+// startLiveStream serves StreamLive of handler and opens the stream at url. The
+// stream is closed when the test ends.
+func startLiveStream(t *testing.T, handler *RecordHandler, url string, header http.Header) (*http.Response, *bufio.Reader) {
+	handler.livePollInterval = 5 * time.Millisecond
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/v1/records/stream/live", handler.StreamLive)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL+url, nil)
+	require.NoError(t, err)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// readEvent reads the next event of a live stream.
+func readEvent(t *testing.T, reader *bufio.Reader) liveEvent {
+	var event liveEvent
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return event
+		}
+
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "event":
+			event.event = value
+		case "id":
+			event.id = value
+		case "data":
+			event.data = value
+		}
+	}
+}
+
+func TestStreamLive_PushesCreatedRecord(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	since := "since-0"
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	mockRepo.On("GetPaginated", "", 1).Return(&repository.PaginatedResult{Records: []repository.Record{{ResourceID: "user-0", ResourceType: "user"}}, SinceToken: &since}, nil)
+	// Nothing is new when the stream starts; the record is created before the second poll
+	mockRepo.On("GetNewer", "since-0", 5).Return(&repository.NewerResult{Records: []repository.Record{}, SinceToken: "since-0"}, nil).Once()
+	mockRepo.On("GetNewer", "since-0", 5).Return(&repository.NewerResult{
+		Records:    []repository.Record{{ResourceID: "user-1", ResourceType: "user", CreatedAt: created, UpdatedAt: created}},
+		SinceToken: "since-1",
+	}, nil).Once()
+	mockRepo.On("GetNewer", "since-1", 5).Return(&repository.NewerResult{Records: []repository.Record{}, SinceToken: "since-1"}, nil)
+
+	resp, reader := startLiveStream(t, handler, "/api/v1/records/stream/live", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	event := readEvent(t, reader)
+	assert.Equal(t, "record", event.event)
+	assert.Equal(t, "since-1", event.id)
+	assert.JSONEq(t, `{"resource_id":"user-1","resource_type":"user","created_at":"2024-01-15T10:30:00Z","updated_at":"2024-01-15T10:30:00Z"}`, event.data)
+}
+
+func TestStreamLive_SendsBatchOldestFirst(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetNewer", "resume", 5).Return(&repository.NewerResult{
+		Records:    []repository.Record{{ResourceID: "user-3", ResourceType: "user"}, {ResourceID: "user-2", ResourceType: "user"}},
+		SinceToken: "since-3",
+	}, nil)
+	mockRepo.On("GetNewer", "since-3", 5).Return(&repository.NewerResult{Records: []repository.Record{}, SinceToken: "since-3"}, nil)
+
+	_, reader := startLiveStream(t, handler, "/api/v1/records/stream/live", http.Header{"Last-Event-Id": {"resume"}})
+
+	first, second := readEvent(t, reader), readEvent(t, reader)
+	assert.Contains(t, first.data, `"user-2"`)
+	assert.Empty(t, first.id, "only the newest record of a batch carries the since token")
+	assert.Contains(t, second.data, `"user-3"`)
+	assert.Equal(t, "since-3", second.id)
+	mockRepo.AssertNotCalled(t, "GetPaginated", "", 1)
+}
+
+func TestStreamLive_EmptyTableStartsAtTheBeginning(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetPaginated", "", 1).Return(&repository.PaginatedResult{Records: []repository.Record{}, IsLastPage: true}, nil)
+	mockRepo.On("SinceStart").Return("start")
+	mockRepo.On("GetNewer", "start", 5).Return(&repository.NewerResult{Records: []repository.Record{{ResourceID: "user-1", ResourceType: "user"}}, SinceToken: "since-1"}, nil)
+	mockRepo.On("GetNewer", "since-1", 5).Return(&repository.NewerResult{Records: []repository.Record{}, SinceToken: "since-1"}, nil)
+
+	_, reader := startLiveStream(t, handler, "/api/v1/records/stream/live", nil)
+
+	event := readEvent(t, reader)
+	assert.Equal(t, "since-1", event.id)
+	assert.Contains(t, event.data, `"user-1"`)
+}
+
+func TestStreamLive_InvalidToken(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetNewer", "bad", 5).Return(nil, fmt.Errorf("%w format", repository.ErrInvalidToken))
+
+	c, w := setupGinContext("GET", "/api/v1/records/stream/live?since_token=bad", nil)
+	handler.StreamLive(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"invalid continuation token format","field":"continuation_token"}`, w.Body.String())
+}
+
+func TestStreamLive_PollFailureEndsStream(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetNewer", "resume", 5).Return(&repository.NewerResult{Records: []repository.Record{}, SinceToken: "resume"}, nil).Once()
+	mockRepo.On("GetNewer", "resume", 5).Return(nil, assert.AnError)
+
+	_, reader := startLiveStream(t, handler, "/api/v1/records/stream/live?since_token=resume", nil)
+
+	event := readEvent(t, reader)
+	assert.Equal(t, "error", event.event)
+	assert.JSONEq(t, `{"error":"failed to read records"}`, event.data)
+}
@@ -0,0 +1,270 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"tokenpagination/repository"
+)
+
+// PaginationConfig holds the page size limits of the paginated endpoints.
+type PaginationConfig struct {
+	DefaultPageSize int // used when page_size is missing
+	MaxPageSize     int // larger page sizes are capped to it
+}
+
+// DefaultPaginationConfig returns pages of 5 records by default and at most 100.
+var DefaultPaginationConfig = PaginationConfig{DefaultPageSize: 5, MaxPageSize: 100}
+
+// maxExcludeTypes is the most resource types exclude_types may list.
+const maxExcludeTypes = 20
+
+// PaginationQuery is the query string shared by the paginated endpoints, bound
+// with c.ShouldBindQuery. Adding a parameter means adding a field with its form
+// name and validation rules here. page_size is bound as a string so that a
+// non-numeric value is reported against the parameter by the page_size validator
+// rather than as a bare strconv error.
+type PaginationQuery struct {
+	ContinuationToken string `form:"continuation_token" binding:"omitempty,continuation_token"`
+	PageSize          string `form:"page_size" binding:"omitempty,page_size"`
+	OrderBy           string `form:"order_by" binding:"omitempty,sort_column"`
+	Order             string `form:"order" binding:"omitempty,oneof=asc desc"`
+	ContextFirst      string `form:"context_first" binding:"omitempty,oneof=true false"`
+	ResourceType      string `form:"resource_type"`
+	ExcludeTypes      string `form:"exclude_types"`
+	MetadataKey       string `form:"metadata_key"`
+}
+
+func init() {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	if err := engine.RegisterValidation("page_size", validPageSize); err != nil {
+		panic(err)
+	}
+	if err := engine.RegisterValidation("sort_column", validSortColumn); err != nil {
+		panic(err)
+	}
+	if err := engine.RegisterValidation("continuation_token", validContinuationToken); err != nil {
+		panic(err)
+	}
+}
+
+// validPageSize accepts positive integers. The maximum is not a validation rule:
+// larger page sizes are capped to the handler's configured maximum instead.
+func validPageSize(fl validator.FieldLevel) bool {
+	pageSize, err := strconv.Atoi(fl.Field().String())
+	return err == nil && pageSize > 0
+}
+
+// validContinuationToken accepts values that look like a continuation token; the
+// repository decides whether they are one.
+func validContinuationToken(fl validator.FieldLevel) bool {
+	return isLikelyToken(fl.Field().String())
+}
+
+// isLikelyToken reports whether s is made only of the base64url alphabet and its
+// padding, as every continuation token is. It catches the common client mistakes,
+// a blank value or a token mangled by an unencoded '+' or '/', before the token
+// is decoded.
+func isLikelyToken(s string) bool {
+	if strings.TrimSpace(s) == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validSortColumn accepts the columns of repository.SortColumns.
+func validSortColumn(fl validator.FieldLevel) bool {
+	return slices.Contains(repository.SortColumns, fl.Field().String())
+}
+
+// PaginationParams are the query parameters shared by the paginated endpoints.
+type PaginationParams struct {
+	ContinuationToken string
+	PageSize          int
+	Order             *repository.SortOrder // nil keeps the endpoint's default order
+	Filter            repository.PaginationFilter
+}
+
+// echo records in a page the effective page size and the continuation token it
+// was requested with. The first page has no request token.
+func (p PaginationParams) echo(result *repository.PaginatedResult) {
+	result.RequestedPageSize = p.PageSize
+	if p.ContinuationToken != "" {
+		token := p.ContinuationToken
+		result.RequestToken = &token
+	}
+}
+
+// requireDefaultOrder returns a *ParamError naming the first ordering or filter
+// parameter set, for endpoints that list records in a fixed order and cannot
+// filter them, so that the parameter is rejected rather than silently ignored.
+func (p PaginationParams) requireDefaultOrder(c *gin.Context) error {
+	params := []struct {
+		name string
+		set  bool
+	}{
+		{"order_by", p.Order != nil && c.Query("order_by") != ""},
+		{"order", p.Order != nil && c.Query("order") != ""},
+		{"context_first", p.Order != nil && p.Order.ContextFirst},
+		{"resource_type", p.Filter.ResourceType != ""},
+		{"exclude_types", len(p.Filter.ExcludeTypes) > 0},
+		{"metadata_key", p.Filter.MetadataKey != ""},
+	}
+	for _, param := range params {
+		if param.set {
+			return &ParamError{Param: param.name, Value: c.Query(param.name), Reason: "is not supported by this endpoint"}
+		}
+	}
+	return nil
+}
+
+// ParamError is a query parameter that failed validation, answered with 400 and
+// the parameter's name in the field attribute of the response.
+type ParamError struct {
+	Param  string
+	Value  string
+	Reason string
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("invalid %s '%s': %s", e.Param, e.Value, e.Reason)
+}
+
+// ParsePaginationParams binds the continuation_token, page_size, order_by, order,
+// context_first, resource_type, exclude_types and metadata_key query parameters
+// of a paginated endpoint into a PaginationQuery. A missing page_size uses the
+// default and larger values than the maximum are capped. An invalid page_size,
+// order_by, order or context_first, context_first=true with order_by=claimed_at,
+// or an exclude_types list that is too long, is returned as a *ParamError, to be
+// answered with 400.
+func ParsePaginationParams(c *gin.Context, cfg PaginationConfig) (PaginationParams, error) {
+	var query PaginationQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		return PaginationParams{}, paramError(query, err)
+	}
+
+	pageSize := cfg.DefaultPageSize
+	if query.PageSize != "" {
+		// Already validated as a positive integer
+		pageSize, _ = strconv.Atoi(query.PageSize)
+		pageSize = min(pageSize, cfg.MaxPageSize)
+	}
+
+	order := query.sortOrder()
+	if order != nil && order.ContextFirst && order.Column == "claimed_at" {
+		return PaginationParams{}, &ParamError{Param: "context_first", Value: query.ContextFirst, Reason: "cannot be combined with order_by=claimed_at, which already lists unclaimed records last"}
+	}
+
+	excludeTypes := query.excludeTypes()
+	if len(excludeTypes) > maxExcludeTypes {
+		return PaginationParams{}, &ParamError{Param: "exclude_types", Value: query.ExcludeTypes, Reason: fmt.Sprintf("must list at most %d resource types", maxExcludeTypes)}
+	}
+
+	return PaginationParams{
+		ContinuationToken: query.ContinuationToken,
+		PageSize:          pageSize,
+		Order:             order,
+		Filter: repository.PaginationFilter{
+			ResourceType: query.ResourceType,
+			ExcludeTypes: excludeTypes,
+			MetadataKey:  query.MetadataKey,
+		},
+	}, nil
+}
+
+// sortOrder returns the order selected by order_by, order and context_first, or
+// nil when none is given, keeping the default order.
+func (q PaginationQuery) sortOrder() *repository.SortOrder {
+	contextFirst := q.ContextFirst == "true"
+	if q.OrderBy == "" && q.Order == "" && !contextFirst {
+		return nil
+	}
+
+	order := repository.SortOrder{Column: q.OrderBy, Ascending: q.Order == "asc", ContextFirst: contextFirst}
+	if order.Column == "" {
+		order.Column = "created_at"
+	}
+	return &order
+}
+
+// excludeTypes splits the comma-separated exclude_types list, dropping blank
+// entries. It returns nil when no type is listed.
+func (q PaginationQuery) excludeTypes() []string {
+	var types []string
+	for _, resourceType := range strings.Split(q.ExcludeTypes, ",") {
+		if resourceType = strings.TrimSpace(resourceType); resourceType != "" {
+			types = append(types, resourceType)
+		}
+	}
+	return types
+}
+
+// paramError converts the first validation error of a bound query into a
+// *ParamError naming the query parameter. Other errors are returned unchanged.
+func paramError(query any, err error) error {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) || len(errs) == 0 {
+		return err
+	}
+
+	fe := errs[0]
+	param := fe.Field()
+	if field, ok := reflect.TypeOf(query).FieldByName(fe.StructField()); ok {
+		param, _, _ = strings.Cut(field.Tag.Get("form"), ",")
+	}
+
+	var reason string
+	switch fe.Tag() {
+	case "page_size":
+		reason = "must be a positive integer"
+	case "sort_column":
+		reason = "must be one of " + strings.Join(repository.SortColumns, ", ")
+	case "continuation_token":
+		reason = "must be the base64url next_continuation_token of a previous page"
+	case "oneof":
+		reason = "must be " + strings.Join(strings.Fields(fe.Param()), " or ")
+	default:
+		reason = fmt.Sprintf("failed the %s rule", fe.Tag())
+	}
+
+	return &ParamError{Param: param, Value: fmt.Sprint(fe.Value()), Reason: reason}
+}
+
+// respondTooDeep answers a request for a page deeper than the repository allows,
+// repository.ErrPaginationTooDeep, with 400, pointing the client at the export.
+func respondTooDeep(c *gin.Context) {
+	respond(c, http.StatusBadRequest, gin.H{"error": "pagination too deep: use " + exportURL + " to retrieve large result sets"})
+}
+
+// respondBadRequest answers a request whose parameters failed validation with
+// 400, adding the offending parameter as field when err is a *ParamError or a
+// continuation token the repository rejected.
+func respondBadRequest(c *gin.Context, err error) {
+	body := gin.H{"error": err.Error()}
+	var paramErr *ParamError
+	switch {
+	case errors.As(err, &paramErr):
+		body["field"] = paramErr.Param
+	case errors.Is(err, repository.ErrInvalidToken), errors.Is(err, repository.ErrTokenTooLong):
+		body["field"] = "continuation_token"
+	}
+	respond(c, http.StatusBadRequest, body)
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tokenpagination/repository"
+)
+
+func TestParsePaginationParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		cfg     PaginationConfig
+		want    PaginationParams
+		wantErr string
+	}{
+		{name: "defaults", query: "", cfg: DefaultPaginationConfig, want: PaginationParams{PageSize: 5}},
+		{name: "page size", query: "page_size=20", cfg: DefaultPaginationConfig, want: PaginationParams{PageSize: 20}},
+		{name: "page size capped", query: "page_size=150", cfg: DefaultPaginationConfig, want: PaginationParams{PageSize: 100}},
+		{name: "page size at maximum", query: "page_size=100", cfg: DefaultPaginationConfig, want: PaginationParams{PageSize: 100}},
+		{name: "custom limits", query: "page_size=30", cfg: PaginationConfig{DefaultPageSize: 10, MaxPageSize: 25}, want: PaginationParams{PageSize: 25}},
+		{name: "custom default", query: "", cfg: PaginationConfig{DefaultPageSize: 10, MaxPageSize: 25}, want: PaginationParams{PageSize: 10}},
+		{name: "non-numeric page size", query: "page_size=ten", cfg: DefaultPaginationConfig, wantErr: "invalid page_size 'ten': must be a positive integer"},
+		{name: "zero page size", query: "page_size=0", cfg: DefaultPaginationConfig, wantErr: "invalid page_size '0': must be a positive integer"},
+		{name: "negative page size", query: "page_size=-3", cfg: DefaultPaginationConfig, wantErr: "invalid page_size '-3': must be a positive integer"},
+		{
+			name:  "token and filters",
+			query: "continuation_token=abc&resource_type=user&metadata_key=source",
+			cfg:   DefaultPaginationConfig,
+			want: PaginationParams{
+				ContinuationToken: "abc",
+				PageSize:          5,
+				Filter:            repository.PaginationFilter{ResourceType: "user", MetadataKey: "source"},
+			},
+		},
+		{name: "exclude one type", query: "exclude_types=audit", cfg: DefaultPaginationConfig, want: PaginationParams{PageSize: 5, Filter: repository.PaginationFilter{ExcludeTypes: []string{"audit"}}}},
+		{name: "exclude several types", query: "exclude_types=audit,%20internal,,", cfg: DefaultPaginationConfig, want: PaginationParams{PageSize: 5, Filter: repository.PaginationFilter{ExcludeTypes: []string{"audit", "internal"}}}},
+		{name: "empty exclusion list", query: "exclude_types=,", cfg: DefaultPaginationConfig, want: PaginationParams{PageSize: 5}},
+		{name: "too many excluded types", query: "exclude_types=a,b,c,d,e,f,g,h,i,j,k,l,m,n,o,p,q,r,s,t,u", cfg: DefaultPaginationConfig, wantErr: "invalid exclude_types 'a,b,c,d,e,f,g,h,i,j,k,l,m,n,o,p,q,r,s,t,u': must list at most 20 resource types"},
+		{name: "order by", query: "order_by=updated_at", cfg: DefaultPaginationConfig, want: PaginationParams{PageSize: 5, Order: &repository.SortOrder{Column: "updated_at"}}},
+		{name: "ascending", query: "order_by=resource_id&order=asc", cfg: DefaultPaginationConfig, want: PaginationParams{PageSize: 5, Order: &repository.SortOrder{Column: "resource_id", Ascending: true}}},
+		{name: "direction only", query: "order=asc", cfg: DefaultPaginationConfig, want: PaginationParams{PageSize: 5, Order: &repository.SortOrder{Column: "created_at", Ascending: true}}},
+		{name: "invalid direction", query: "order_by=created_at&order=sideways", cfg: DefaultPaginationConfig, wantErr: "invalid order 'sideways': must be asc or desc"},
+		{name: "invalid column", query: "order_by=context", cfg: DefaultPaginationConfig, wantErr: "invalid order_by 'context': must be one of created_at, updated_at, resource_type, resource_id, seq, claimed_at"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := setupGinContext("GET", "/api/v1/records/paginated?"+tt.query, nil)
+
+			params, err := ParsePaginationParams(c, tt.cfg)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, params)
+		})
+	}
+}
+
+func TestParsePaginationParams_ParamError(t *testing.T) {
+	c, _ := setupGinContext("GET", "/api/v1/records/paginated?page_size=ten", nil)
+
+	_, err := ParsePaginationParams(c, DefaultPaginationConfig)
+
+	var paramErr *ParamError
+	require.ErrorAs(t, err, &paramErr)
+	assert.Equal(t, ParamError{Param: "page_size", Value: "ten", Reason: "must be a positive integer"}, *paramErr)
+}
+
+func TestRequireDefaultOrder(t *testing.T) {
+	tests := []struct {
+		query string
+		want  *ParamError
+	}{
+		{query: "page_size=10&context_first=false"},
+		{query: "order_by=updated_at", want: &ParamError{Param: "order_by", Value: "updated_at", Reason: "is not supported by this endpoint"}},
+		{query: "order=asc", want: &ParamError{Param: "order", Value: "asc", Reason: "is not supported by this endpoint"}},
+		{query: "context_first=true", want: &ParamError{Param: "context_first", Value: "true", Reason: "is not supported by this endpoint"}},
+		{query: "resource_type=user", want: &ParamError{Param: "resource_type", Value: "user", Reason: "is not supported by this endpoint"}},
+		{query: "context_first=false&exclude_types=user", want: &ParamError{Param: "exclude_types", Value: "user", Reason: "is not supported by this endpoint"}},
+		{query: "metadata_key=tier", want: &ParamError{Param: "metadata_key", Value: "tier", Reason: "is not supported by this endpoint"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			c, _ := setupGinContext("GET", "/api/v1/records/activity?"+tt.query, nil)
+			params, err := ParsePaginationParams(c, DefaultPaginationConfig)
+			require.NoError(t, err)
+
+			err = params.requireDefaultOrder(c)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var paramErr *ParamError
+			require.ErrorAs(t, err, &paramErr)
+			assert.Equal(t, *tt.want, *paramErr)
+		})
+	}
+}
+
+func TestFixedOrderEndpoints_RejectOrderAndFilter(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	endpoints := map[string]gin.HandlerFunc{
+		"/api/v1/records/activity?resource_type=user":                       handler.GetActivityFeed,
+		"/api/v1/records/missing-context?order_by=updated_at":               handler.GetRecordsMissingContext,
+		"/api/v1/records/newer?since_token=since-5&metadata_key=tier":       handler.GetNewerRecords,
+		"/api/v1/records/stream/live?since_token=since-5&exclude_types=doc": handler.StreamLive,
+	}
+
+	for url, serve := range endpoints {
+		t.Run(url, func(t *testing.T) {
+			c, w := setupGinContext("GET", url, nil)
+			serve(c)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), "is not supported by this endpoint")
+		})
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestIsLikelyToken(t *testing.T) {
+	for token, want := range map[string]bool{
+		"eyJ0IjoidXNlciJ9":    true,
+		"eyJ0IjoidXNlciJ9-_=": true,
+		"":                    false,
+		"   ":                 false,
+		"eyJ0 IjoidXNlciJ9":   false,
+		"eyJ0+IjoidXNlciJ9/":  false,
+		"ユーザー":                false,
+	} {
+		assert.Equal(t, want, isLikelyToken(token), "%q", token)
+	}
+}
+
+func TestRespondBadRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want map[string]string
+	}{
+		{
+			name: "param error",
+			err:  &ParamError{Param: "order", Value: "up", Reason: "must be asc or desc"},
+			want: map[string]string{"error": "invalid order 'up': must be asc or desc", "field": "order"},
+		},
+		{name: "other error", err: assert.AnError, want: map[string]string{"error": assert.AnError.Error()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := setupGinContext("GET", "/api/v1/records/paginated", nil)
+
+			respondBadRequest(c, tt.err)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var body map[string]string
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, tt.want, body)
+		})
+	}
+}
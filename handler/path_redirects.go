@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterPathRedirects sets how r answers a path that differs from a route only
+// by a trailing slash or by the letter case of its fixed segments. With
+// trailingSlash, gin redirects /api/v1/records/ to /api/v1/records; with
+// ignoreCase, /API/v1/Records is redirected to /api/v1/records, keeping the path
+// parameters and query as sent. Without either such paths get the JSON 404.
+//
+// GET requests are redirected with 301 Moved Permanently and every other method
+// with 307 Temporary Redirect, which clients follow with the same method and
+// body, so a POST is never turned into a GET. Call it after RegisterFallbacks;
+// the routes are read per request, so they may be registered before or after.
+func RegisterPathRedirects(r *gin.Engine, trailingSlash, ignoreCase bool) {
+	r.RedirectTrailingSlash = trailingSlash
+	if ignoreCase {
+		r.NoRoute(redirectCase(r, trailingSlash), NotFound)
+	}
+}
+
+// redirectCase returns a NoRoute handler redirecting to the route matching the
+// request path regardless of case. Gin's RedirectFixedPath does the same but
+// panics on routers with catch-all routes such as /debug/pprof/*name.
+func redirectCase(r *gin.Engine, trailingSlash bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.EscapedPath()
+		if trailingSlash && len(path) > 1 {
+			path = strings.TrimSuffix(path, "/")
+		}
+
+		target, ok := matchRoute(r.Routes(), c.Request.Method, path)
+		if !ok || target == c.Request.URL.EscapedPath() {
+			return
+		}
+		if c.Request.URL.RawQuery != "" {
+			target += "?" + c.Request.URL.RawQuery
+		}
+
+		code := http.StatusMovedPermanently
+		if c.Request.Method != http.MethodGet {
+			code = http.StatusTemporaryRedirect
+		}
+		c.Redirect(code, target)
+		c.Abort()
+	}
+}
+
+// matchRoute returns the path of the route for method that matches path when
+// letter case is ignored, spelled as the route spells its fixed segments. When
+// several routes match, the one with the most fixed segments wins, as in gin's
+// own routing.
+func matchRoute(routes gin.RoutesInfo, method, path string) (string, bool) {
+	segments := strings.Split(path, "/")
+	best, bestStatic := "", -1
+	for _, route := range routes {
+		if route.Method != method {
+			continue
+		}
+		target, static, ok := matchSegments(strings.Split(route.Path, "/"), segments)
+		if ok && static > bestStatic {
+			best, bestStatic = target, static
+		}
+	}
+	return best, bestStatic >= 0
+}
+
+// matchSegments matches the segments of a request path against those of a route,
+// returning the matched path and the number of fixed segments matched.
+func matchSegments(route, path []string) (string, int, bool) {
+	matched := make([]string, 0, len(path))
+	static := 0
+	for i, segment := range route {
+		switch {
+		case strings.HasPrefix(segment, "*"):
+			if i >= len(path) {
+				return "", 0, false
+			}
+			return strings.Join(append(matched, path[i:]...), "/"), static, true
+		case i >= len(path):
+			return "", 0, false
+		case strings.HasPrefix(segment, ":"):
+			if path[i] == "" {
+				return "", 0, false
+			}
+			matched = append(matched, path[i])
+		case strings.EqualFold(segment, path[i]):
+			matched = append(matched, segment)
+			static++
+		default:
+			return "", 0, false
+		}
+	}
+	if len(route) != len(path) {
+		return "", 0, false
+	}
+	return strings.Join(matched, "/"), static, true
+}
@@ -1,95 +1,1070 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"tokenpagination/repository"
+	"tokenpagination/schema"
 )
 
 // RecordRepositoryInterface defines the interface for record repository operations
 type RecordRepositoryInterface interface {
 	CreateTable() error
 	Insert(resourceID, resourceType string, context *string) error
-	GetAll() ([]repository.Record, error)
+	InsertWithMetadata(resourceID, resourceType string, context *string, metadata map[string]string) error
+	InsertReturning(resourceID, resourceType string, context *string, metadata map[string]string) (*repository.Record, error)
+	GetAll() ([]repository.Record, bool, error)
+	GetAllLenient() ([]repository.Record, bool, []string, error)
+	GetAllContextFirst() ([]repository.Record, bool, error)
+	GetGroupedByType(perTypeLimit int) (map[string][]repository.Record, error)
+	Count() (int64, error)
+	CountApproximate() (int64, error)
+	CountByDay(from, to time.Time) ([]repository.DayCount, error)
+	LastModified() (time.Time, error)
+	ForEach(fn func(repository.Record) error) error
+	GetByID(resourceID, resourceType string) (*repository.Record, error)
+	GetByIDFields(resourceID, resourceType string, fields []string) (*repository.Record, error)
 	GetPaginated(continuationToken string, pageSize int) (*repository.PaginatedResult, error)
+	GetPaginatedLenient(continuationToken string, pageSize int) (*repository.PaginatedResult, error)
+	GetPaginatedByType(resourceType, continuationToken string, pageSize int) (*repository.PaginatedResult, error)
+	GetPaginatedFiltered(filter repository.PaginationFilter, continuationToken string, pageSize int) (*repository.PaginatedResult, error)
+	GetPaginatedSorted(order repository.SortOrder, filter repository.PaginationFilter, continuationToken string, pageSize int) (*repository.PaginatedResult, error)
+	GetActivityFeed(pageSize int, continuationToken string) (*repository.PaginatedResult, error)
+	GetWithoutContext(continuationToken string, pageSize int) (*repository.PaginatedResult, error)
+	GetLastPage(pageSize int) (*repository.PaginatedResult, error)
+	GetNewer(sinceToken string, pageSize int) (*repository.NewerResult, error)
+	SinceStart() string
+	ExplainPaginated(continuationToken string, pageSize int) (*repository.ExplainedQuery, error)
+	Explain(query *repository.ExplainedQuery) ([]repository.PlanRow, error)
+	GetByKeys(keys []repository.RecordKey) ([]repository.Record, []repository.RecordKey, error)
+	ExistingKeys(keys []repository.RecordKey) ([]repository.RecordKey, error)
+	Touch(resourceID, resourceType string) error
+	TouchIfUnmodifiedSince(resourceID, resourceType string, since time.Time) error
+	Delete(resourceID, resourceType string) error
+	DeleteAll() (int64, error)
+	ReplaceByType(resourceType string, records []repository.Record) error
+}
+
+// ContextValidator validates a record's context payload for its resource_type
+type ContextValidator interface {
+	Validate(resourceType string, context *string) error
 }
 
 type RecordHandler struct {
-	repo RecordRepositoryInterface
+	repo         RecordRepositoryInterface
+	validator    ContextValidator
+	cache        *readCache
+	debugExplain bool
+	purge        bool
+	recordsKey   string
+	pagination   PaginationConfig
+	// livePollInterval is how often StreamLive polls while no records are waiting.
+	livePollInterval time.Duration
 }
 
 // NewRecordHandler creates and returns a new RecordHandler instance.
 // It takes a RecordRepositoryInterface and returns a handler for managing HTTP
 // requests related to record operations including creation and retrieval.
 func NewRecordHandler(repo RecordRepositoryInterface) *RecordHandler {
-	return &RecordHandler{repo: repo}
+	return &RecordHandler{repo: repo, pagination: DefaultPaginationConfig, livePollInterval: defaultLivePollInterval}
+}
+
+// SetContextValidator enables validation of the context field on record creation.
+// Records whose context fails validation are rejected with 422 Unprocessable Entity.
+func (h *RecordHandler) SetContextValidator(validator ContextValidator) {
+	h.validator = validator
+}
+
+// validateContext runs the configured context validator, if any, and writes a 422
+// response with the validation details when the context is rejected. It returns
+// false when the request has already been answered and the caller should stop.
+func (h *RecordHandler) validateContext(c *gin.Context, resourceType string, context *string) bool {
+	if h.validator == nil {
+		return true
+	}
+
+	err := h.validator.Validate(resourceType, context)
+	if err == nil {
+		return true
+	}
+
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		respond(c, http.StatusUnprocessableEntity, gin.H{"error": "context failed schema validation", "details": validationErr.Details})
+		return false
+	}
+
+	respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to validate context"})
+	return false
 }
 
 type CreateRecordRequest struct {
-	ResourceID   string  `json:"resource_id" binding:"required"`
-	ResourceType string  `json:"resource_type" binding:"required"`
-	Context      *string `json:"context,omitempty"`
+	ResourceID   string            `json:"resource_id" binding:"required_unless=GenerateID true"`
+	ResourceType string            `json:"resource_type" binding:"required"`
+	Context      *string           `json:"context,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	GenerateID   bool              `json:"generate_id,omitempty"`
 }
 
 // CreateRecord handles POST requests to create a new record from JSON payload.
-// It expects a JSON body with resource_id, resource_type, and optional context fields
-// and validates the input before inserting the record into the database. Returns 201
-// on success or appropriate error status codes for validation or database failures.
+// It expects a JSON body with resource_id, resource_type, and optional context and
+// metadata fields, where metadata is a flat object of string values. It validates the
+// input, including the context against any JSON Schema registered for the
+// resource_type, before inserting the record into the database. resource_id may be
+// omitted when generate_id is true, in which case a random UUID is generated and
+// returned; supplying both is rejected. Returns 201 on success or appropriate error
+// status codes for validation or database failures.
 func (h *RecordHandler) CreateRecord(c *gin.Context) {
 	var req CreateRecordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.GenerateID && req.ResourceID != "" {
+		respond(c, http.StatusBadRequest, gin.H{"error": "resource_id cannot be combined with generate_id"})
+		return
+	}
+
+	if !h.validateContext(c, req.ResourceType, req.Context) {
+		return
+	}
+
+	if req.GenerateID {
+		id, ok := generateResourceID(c)
+		if !ok {
+			return
+		}
+		req.ResourceID = id
+	}
+
+	h.createRecord(c, req.ResourceID, req.ResourceType, req.Context, req.Metadata)
+}
+
+type CreateAutoRecordRequest struct {
+	ResourceID   string  `json:"resource_id,omitempty"`
+	ResourceType string  `json:"resource_type" binding:"required"`
+	Context      *string `json:"context,omitempty"`
+}
+
+// CreateRecordAuto handles POST requests to create a record whose resource_id may be
+// generated by the server. It expects a JSON body with a required resource_type and
+// optional resource_id and context. When resource_id is omitted a random UUID is
+// generated, and the effective resource_id is returned in the 201 response.
+func (h *RecordHandler) CreateRecordAuto(c *gin.Context) {
+	var req CreateAutoRecordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.validateContext(c, req.ResourceType, req.Context) {
+		return
+	}
+
+	if req.ResourceID == "" {
+		id, ok := generateResourceID(c)
+		if !ok {
+			return
+		}
+		req.ResourceID = id
+	}
+
+	h.createRecord(c, req.ResourceID, req.ResourceType, req.Context, nil)
+}
+
+// createRecord inserts a record for the create endpoints and responds with 201.
+// By default the response only echoes the composite key; with
+// ?return=representation the record is read back in the same transaction and
+// returned as stored, including its timestamps. A record whose composite key is
+// already stored is answered with 409.
+func (h *RecordHandler) createRecord(c *gin.Context, resourceID, resourceType string, context *string, metadata map[string]string) {
+	representation := false
+	switch value := c.Query("return"); value {
+	case "", "minimal":
+	case "representation":
+		representation = true
+	default:
+		respond(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid return '%s': must be minimal or representation", value)})
+		return
+	}
+
+	if representation {
+		record, err := h.repo.InsertReturning(resourceID, resourceType, context, metadata)
+		if errors.Is(err, repository.ErrDuplicate) {
+			respond(c, http.StatusConflict, gin.H{"error": "Record already exists"})
+			return
+		}
+		if err != nil {
+			respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to create record"})
+			return
+		}
+		respond(c, http.StatusCreated, record)
 		return
 	}
 
-	if err := h.repo.Insert(req.ResourceID, req.ResourceType, req.Context); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create record"})
+	var err error
+	if len(metadata) > 0 {
+		err = h.repo.InsertWithMetadata(resourceID, resourceType, context, metadata)
+	} else {
+		err = h.repo.Insert(resourceID, resourceType, context)
+	}
+	if errors.Is(err, repository.ErrDuplicate) {
+		respond(c, http.StatusConflict, gin.H{"error": "Record already exists"})
+		return
+	}
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to create record"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Record created successfully", "resource_id": req.ResourceID, "resource_type": req.ResourceType})
+	respond(c, http.StatusCreated, gin.H{"message": "Record created successfully", "resource_id": resourceID, "resource_type": resourceType})
+}
+
+// generateResourceID returns a random UUID for a record created without a
+// resource_id. When generation fails it responds with 500 and returns false.
+func generateResourceID(c *gin.Context) (string, bool) {
+	id, err := repository.GenerateResourceID()
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to generate resource_id"})
+		return "", false
+	}
+	return id, true
 }
 
+// exportURL is the path of the SQL export, where clients are sent for result sets
+// too large for the listings.
+const exportURL = "/api/v1/records/export.sql"
+
+// getAllSunset is the date after which the unbounded GET /api/v1/records endpoint
+// may be removed, advertised to clients through the Sunset header.
+const getAllSunset = "Wed, 30 Jun 2027 23:59:59 GMT"
+
 // GetRecords handles GET requests to retrieve all records from the database.
-// This endpoint returns all records without pagination and is useful for
-// getting the complete dataset. Results are ordered by created_at descending.
+// This endpoint returns all records without pagination and is deprecated in favour
+// of the paginated and export endpoints, which it advertises through Deprecation and
+// Sunset headers and a Link to the paginated endpoint. Results are ordered by
+// created_at descending and capped by the repository; a capped result is flagged
+// with truncated: true and the X-Result-Truncated and Warning headers, and points
+// the client at the alternatives. records_key=data or items returns the records
+// under that key instead, as does a default set with SetRecordsKey. With
+// lenient=true rows that cannot be read are skipped instead of failing the
+// request, and described under warnings. context_first=true lists the records
+// with a context before those without; it cannot be combined with lenient.
 func (h *RecordHandler) GetRecords(c *gin.Context) {
-	records, err := h.repo.GetAll()
+	c.Header("Deprecation", "true")
+	c.Header("Sunset", getAllSunset)
+	c.Header("Link", `</api/v1/records/paginated>; rel="successor-version"`)
+
+	format, ok := parseRecordFormat(c)
+	if !ok {
+		return
+	}
+	recordsKey, ok := h.parseRecordsKey(c)
+	if !ok {
+		return
+	}
+
+	lenient, contextFirst := c.Query("lenient") == "true", c.Query("context_first") == "true"
+	if lenient && contextFirst {
+		respond(c, http.StatusBadRequest, gin.H{"error": "lenient=true cannot be combined with context_first"})
+		return
+	}
+
+	var records []repository.Record
+	var truncated bool
+	var warnings []string
+	var err error
+	switch {
+	case lenient:
+		records, truncated, warnings, err = h.repo.GetAllLenient()
+	case contextFirst:
+		records, truncated, err = h.repo.GetAllContextFirst()
+	default:
+		records, truncated, err = h.repo.GetAll()
+	}
+	if err != nil {
+		if h.serveCached(c) {
+			return
+		}
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to retrieve records"})
+		return
+	}
+	formatRecords(records, format)
+
+	response := gin.H{recordsKey: records, "truncated": truncated}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	if truncated {
+		c.Header("X-Result-Truncated", "true")
+		c.Header("Warning", fmt.Sprintf(`299 - "Result truncated at %d rows; use /api/v1/records/paginated"`, len(records)))
+		response["message"] = "Result truncated: use the paginated or export endpoints to retrieve every record"
+		response["paginated_url"] = "/api/v1/records/paginated"
+		response["export_url"] = exportURL
+	}
+
+	h.respondRead(c, response)
+}
+
+// GetGroupedRecords handles GET /api/v1/records/grouped, which returns every
+// record under groups, keyed by resource_type. Each group is ordered newest
+// first. per_type_limit, a positive integer, keeps only that many of the newest
+// records of each type, for tables too large to return whole.
+func (h *RecordHandler) GetGroupedRecords(c *gin.Context) {
+	format, ok := parseRecordFormat(c)
+	if !ok {
+		return
+	}
+
+	perTypeLimit := 0
+	if value := c.Query("per_type_limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			respondBadRequest(c, &ParamError{Param: "per_type_limit", Value: value, Reason: "must be a positive integer"})
+			return
+		}
+		perTypeLimit = limit
+	}
+
+	groups, err := h.repo.GetGroupedByType(perTypeLimit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve records"})
+		if h.serveCached(c) {
+			return
+		}
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to retrieve records"})
 		return
 	}
+	for _, records := range groups {
+		formatRecords(records, format)
+	}
 
-	c.JSON(http.StatusOK, gin.H{"records": records})
+	h.respondRead(c, gin.H{"groups": groups})
+}
+
+// CursorProbeResponse is returned by the paginated endpoint when cursor_only=true:
+// it says whether more data exists and where it starts, without the records.
+type CursorProbeResponse struct {
+	HasMore               bool    `json:"has_more"`
+	NextContinuationToken *string `json:"next_continuation_token,omitempty"`
 }
 
 // GetRecordsPaginated handles GET requests for paginated record retrieval.
 // It supports continuation_token and page_size query parameters for cursor-based
-// pagination. Page size is limited to 1-100 records with a default of 5.
-// Returns records with an optional next_continuation_token for subsequent pages.
+// pagination, plus optional resource_type and metadata_key parameters restricting the
+// listing to one type and to records carrying the given metadata key. Page size is limited to 1-100 records with a default of 5.
+// exclude_types takes a comma-separated list of up to 20 resource types to leave out.
+// order_by selects an allowlisted sort column (created_at, updated_at, resource_type,
+// resource_id, seq or claimed_at) and order=asc|desc its direction; other columns
+// are rejected with 400.
+// Returns records with an optional next_continuation_token for subsequent pages
+// and the current page_depth; paging past the maximum depth is rejected with 400.
+// page=last returns the oldest records instead, with a prev_continuation_token for
+// walking backward; it cannot be combined with a token, filters or ordering.
+// With cursor_only=true only has_more and the next token are returned, and
+// timestamps=epoch_ms emits timestamps as epoch milliseconds. include_total=true
+// adds the total number of records, counted exactly or, with approximate=true,
+// estimated from table statistics and flagged with total_approximate.
+// A first-page request with If-Modified-Since is answered with 304 Not Modified
+// when no record changed since then, and otherwise carries Last-Modified.
+// records_key renames the records key and lenient=true skips unreadable rows as
+// they do for GetRecords; lenient cannot be combined with page=last, filters or
+// order_by. context_first=true lists the records with a context first, each group
+// in the requested order; its continuation tokens only resume a context first
+// listing.
 func (h *RecordHandler) GetRecordsPaginated(c *gin.Context) {
-	continuationToken := c.Query("continuation_token")
-	pageSize := 5
-
-	if pageSizeStr := c.Query("page_size"); pageSizeStr != "" {
-		if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 {
-			if ps > 100 {
-				pageSize = 100 // Cap at 100
-			} else {
-				pageSize = ps
+	format, ok := parseRecordFormat(c)
+	if !ok {
+		return
+	}
+	recordsKey, ok := h.parseRecordsKey(c)
+	if !ok {
+		return
+	}
+
+	params, err := ParsePaginationParams(c, h.pagination)
+	if err != nil {
+		respondBadRequest(c, err)
+		return
+	}
+
+	includeTotal, approximate := c.Query("include_total") == "true", c.Query("approximate") == "true"
+	if approximate && !includeTotal {
+		respond(c, http.StatusBadRequest, gin.H{"error": "approximate requires include_total=true"})
+		return
+	}
+	if includeTotal && !params.Filter.IsZero() {
+		respond(c, http.StatusBadRequest, gin.H{"error": "include_total counts all records and cannot be combined with resource_type, exclude_types or metadata_key"})
+		return
+	}
+
+	if header := c.GetHeader("If-Modified-Since"); header != "" && params.ContinuationToken == "" {
+		if !h.checkModifiedSince(c, header) {
+			return
+		}
+	}
+
+	lastPage := false
+	switch page := c.Query("page"); page {
+	case "":
+	case "last":
+		if params.ContinuationToken != "" || params.Order != nil || !params.Filter.IsZero() {
+			respond(c, http.StatusBadRequest, gin.H{"error": "page=last cannot be combined with continuation_token, resource_type, exclude_types, metadata_key, order_by or context_first"})
+			return
+		}
+		lastPage = true
+	default:
+		respond(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid page '%s': only 'last' is supported", page)})
+		return
+	}
+
+	lenient := c.Query("lenient") == "true"
+	if lenient && (lastPage || params.Order != nil || !params.Filter.IsZero()) {
+		respond(c, http.StatusBadRequest, gin.H{"error": "lenient=true cannot be combined with page=last, resource_type, exclude_types, metadata_key, order_by or context_first"})
+		return
+	}
+
+	var result *repository.PaginatedResult
+	switch {
+	case lastPage:
+		result, err = h.repo.GetLastPage(params.PageSize)
+	case params.Order != nil, !params.Filter.IsZero():
+		result, err = h.getPage(params, params.ContinuationToken)
+	case lenient:
+		result, err = h.repo.GetPaginatedLenient(params.ContinuationToken, params.PageSize)
+	default:
+		result, err = h.repo.GetPaginated(params.ContinuationToken, params.PageSize)
+		if err == nil && h.debugExplain {
+			h.attachQueryPlan(c, params.ContinuationToken, params.PageSize)
+		}
+	}
+	if errors.Is(err, repository.ErrPaginationTooDeep) {
+		respondTooDeep(c)
+		return
+	}
+	if err != nil {
+		if h.serveCached(c) {
+			return
+		}
+		respondBadRequest(c, err)
+		return
+	}
+
+	if c.Query("cursor_only") == "true" {
+		h.respondRead(c, CursorProbeResponse{
+			HasMore:               result.NextContinuationToken != nil,
+			NextContinuationToken: result.NextContinuationToken,
+		})
+		return
+	}
+
+	if includeTotal {
+		total, err := h.countRecords(approximate)
+		if err != nil {
+			if h.serveCached(c) {
+				return
+			}
+			respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to count records"})
+			return
+		}
+		result.Total, result.TotalApproximate = &total, approximate
+	}
+
+	params.echo(result)
+	formatRecords(result.Records, format)
+	response, err := renameRecordsKey(result, recordsKey)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to encode records"})
+		return
+	}
+	h.respondRead(c, response)
+}
+
+// getPage reads the page after token of the listing selected by the order and
+// filter of params.
+func (h *RecordHandler) getPage(params PaginationParams, token string) (*repository.PaginatedResult, error) {
+	switch {
+	case params.Order != nil:
+		return h.repo.GetPaginatedSorted(*params.Order, params.Filter, token, params.PageSize)
+	case params.Filter.MetadataKey != "", len(params.Filter.ExcludeTypes) > 0:
+		return h.repo.GetPaginatedFiltered(params.Filter, token, params.PageSize)
+	case params.Filter.ResourceType != "":
+		return h.repo.GetPaginatedByType(params.Filter.ResourceType, token, params.PageSize)
+	default:
+		return h.repo.GetPaginated(token, params.PageSize)
+	}
+}
+
+// checkModifiedSince answers a first-page request carrying the If-Modified-Since
+// header with 304 Not Modified when no record was inserted or touched after the
+// header's time, checked with a MAX(updated_at) lookup rather than the page query.
+// Otherwise it sets Last-Modified for the client's next poll and reports true, and
+// the page is served as usual. A header that is not an HTTP date is rejected with
+// 400. Deleting a record does not count as a modification.
+func (h *RecordHandler) checkModifiedSince(c *gin.Context, header string) bool {
+	since, err := http.ParseTime(header)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid If-Modified-Since header '%s': must be an HTTP date", header)})
+		return false
+	}
+
+	lastModified, err := h.repo.LastModified()
+	if err != nil {
+		if h.serveCached(c) {
+			return false
+		}
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to check for modified records"})
+		return false
+	}
+
+	// HTTP dates have whole seconds
+	lastModified = lastModified.Truncate(time.Second)
+	if !lastModified.After(since) {
+		if !lastModified.IsZero() {
+			c.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+		}
+		c.Status(http.StatusNotModified)
+		return false
+	}
+
+	c.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+	return true
+}
+
+// countRecords counts all records, exactly with COUNT(*) or, when approximate is
+// set, from the table statistics, which is instant on large tables.
+func (h *RecordHandler) countRecords(approximate bool) (int64, error) {
+	if approximate {
+		return h.repo.CountApproximate()
+	}
+	return h.repo.Count()
+}
+
+// EnableDebugExplain makes the paginated endpoint run EXPLAIN on the query behind
+// each unfiltered page and return the plan as compact JSON in the X-Query-Plan
+// response header, so that DBAs can check index use on deep pages. It costs an
+// extra query per request and is meant for diagnostics only.
+func (h *RecordHandler) EnableDebugExplain() {
+	h.debugExplain = true
+}
+
+// attachQueryPlan sets the X-Query-Plan header to the plan of the page query for
+// the token and page size. A failure to explain does not fail the request; it is
+// reported in the X-Query-Plan-Error header instead.
+func (h *RecordHandler) attachQueryPlan(c *gin.Context, continuationToken string, pageSize int) {
+	plan, err := h.queryPlan(continuationToken, pageSize)
+	if err != nil {
+		c.Header("X-Query-Plan-Error", err.Error())
+		return
+	}
+	c.Header("X-Query-Plan", string(plan))
+}
+
+// queryPlan explains the page query for the token and page size and encodes the
+// plan as JSON.
+func (h *RecordHandler) queryPlan(continuationToken string, pageSize int) ([]byte, error) {
+	query, err := h.repo.ExplainPaginated(continuationToken, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := h.repo.Explain(query)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(plan)
+}
+
+// ExplainPaginated handles GET requests returning the SQL statement and arguments
+// the paginated endpoint would run for the same continuation_token and page_size,
+// without running it, so that it can be analyzed with EXPLAIN. It is an admin
+// endpoint and must be registered behind AdminAuthMiddleware.
+func (h *RecordHandler) ExplainPaginated(c *gin.Context) {
+	params, err := ParsePaginationParams(c, h.pagination)
+	if err != nil {
+		respondBadRequest(c, err)
+		return
+	}
+
+	result, err := h.repo.ExplainPaginated(params.ContinuationToken, params.PageSize)
+	if errors.Is(err, repository.ErrPaginationTooDeep) {
+		respondTooDeep(c)
+		return
+	}
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	respond(c, http.StatusOK, result)
+}
+
+// searchControlParams are the non-filter query parameters accepted by the search
+// endpoint.
+var searchControlParams = map[string]bool{
+	"continuation_token": true,
+	"page_size":          true,
+	"pretty":             true,
+	"timestamps":         true,
+}
+
+// parseSearchFilter builds a pagination filter from the allowlisted search query
+// parameters. Unknown parameters and malformed values are rejected so that typos
+// do not silently widen the result set.
+func parseSearchFilter(c *gin.Context) (repository.PaginationFilter, error) {
+	var filter repository.PaginationFilter
+
+	query := c.Request.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := query.Get(key)
+
+		var err error
+		switch key {
+		case "resource_type":
+			filter.ResourceType = value
+		case "metadata_key":
+			filter.MetadataKey = value
+		case "id_prefix":
+			filter.IDPrefix = value
+		case "created_after":
+			filter.CreatedAfter, err = parseSearchTime(key, value)
+		case "created_before":
+			filter.CreatedBefore, err = parseSearchTime(key, value)
+		case "updated_after":
+			filter.UpdatedAfter, err = parseSearchTime(key, value)
+		case "updated_before":
+			filter.UpdatedBefore, err = parseSearchTime(key, value)
+		default:
+			if !searchControlParams[key] {
+				err = fmt.Errorf("unknown search parameter '%s'", key)
 			}
 		}
+		if err != nil {
+			return repository.PaginationFilter{}, err
+		}
+	}
+
+	return filter, nil
+}
+
+// parseSearchTime parses an RFC 3339 timestamp search parameter.
+func parseSearchTime(key, value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp, got '%s'", key, value)
+	}
+	return t, nil
+}
+
+// SearchRecords handles GET requests that page through records matching a
+// combination of filters given as query parameters: resource_type, metadata_key,
+// id_prefix, and created_after/created_before/updated_after/updated_before as
+// RFC 3339 timestamps. All filters are ANDed together and paginated with the usual
+// continuation_token and page_size parameters. Unknown parameters are rejected
+// with 400.
+func (h *RecordHandler) SearchRecords(c *gin.Context) {
+	filter, err := parseSearchFilter(c)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params, err := ParsePaginationParams(c, h.pagination)
+	if err != nil {
+		respondBadRequest(c, err)
+		return
+	}
+
+	format, ok := parseRecordFormat(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.repo.GetPaginatedFiltered(filter, params.ContinuationToken, params.PageSize)
+	if errors.Is(err, repository.ErrPaginationTooDeep) {
+		respondTooDeep(c)
+		return
+	}
+	if err != nil {
+		if h.serveCached(c) {
+			return
+		}
+		respondBadRequest(c, err)
+		return
+	}
+
+	params.echo(result)
+	formatRecords(result.Records, format)
+	h.respondRead(c, result)
+}
+
+// GetActivityFeed handles GET requests for the recent activity feed, which lists
+// records by the later of created_at and updated_at so recently updated records
+// surface next to new ones. It accepts the same continuation_token, page_size, and
+// timestamps parameters as the paginated endpoint; tokens from one are not valid
+// for the other.
+func (h *RecordHandler) GetActivityFeed(c *gin.Context) {
+	format, ok := parseRecordFormat(c)
+	if !ok {
+		return
+	}
+
+	params, err := ParsePaginationParams(c, h.pagination)
+	if err == nil {
+		err = params.requireDefaultOrder(c)
+	}
+	if err != nil {
+		respondBadRequest(c, err)
+		return
+	}
+
+	result, err := h.repo.GetActivityFeed(params.PageSize, params.ContinuationToken)
+	if errors.Is(err, repository.ErrPaginationTooDeep) {
+		respondTooDeep(c)
+		return
+	}
+	if err != nil {
+		if h.serveCached(c) {
+			return
+		}
+		respondBadRequest(c, err)
+		return
+	}
+
+	params.echo(result)
+	formatRecords(result.Records, format)
+	h.respondRead(c, result)
+}
+
+// GetNewerRecords handles GET requests polling for records created after the
+// since_token returned by the first page of the paginated endpoint or by a previous
+// poll, newest first. It accepts the same page_size and timestamps parameters as
+// the paginated endpoint and returns the since_token for the next poll, and
+// has_more when more newer records are waiting.
+func (h *RecordHandler) GetNewerRecords(c *gin.Context) {
+	format, ok := parseRecordFormat(c)
+	if !ok {
+		return
+	}
+
+	sinceToken := c.Query("since_token")
+	if sinceToken == "" {
+		respond(c, http.StatusBadRequest, gin.H{"error": "since_token is required"})
+		return
 	}
 
-	result, err := h.repo.GetPaginated(continuationToken, pageSize)
+	params, err := ParsePaginationParams(c, h.pagination)
+	if err == nil {
+		err = params.requireDefaultOrder(c)
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBadRequest(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, result)
+	result, err := h.repo.GetNewer(sinceToken, params.PageSize)
+	if errors.Is(err, repository.ErrInvalidToken) || errors.Is(err, repository.ErrTokenTooLong) {
+		respondBadRequest(c, err)
+		return
+	}
+	if err != nil {
+		if h.serveCached(c) {
+			return
+		}
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to retrieve records"})
+		return
+	}
+
+	formatRecords(result.Records, format)
+	h.respondRead(c, result)
+}
+
+// GetRecordsMissingContext handles GET requests listing the records whose context is
+// null, for data-quality sweeps. It accepts the same continuation_token, page_size,
+// and timestamps parameters as the paginated endpoint.
+func (h *RecordHandler) GetRecordsMissingContext(c *gin.Context) {
+	format, ok := parseRecordFormat(c)
+	if !ok {
+		return
+	}
+
+	params, err := ParsePaginationParams(c, h.pagination)
+	if err == nil {
+		err = params.requireDefaultOrder(c)
+	}
+	if err != nil {
+		respondBadRequest(c, err)
+		return
+	}
+
+	result, err := h.repo.GetWithoutContext(params.ContinuationToken, params.PageSize)
+	if errors.Is(err, repository.ErrPaginationTooDeep) {
+		respondTooDeep(c)
+		return
+	}
+	if err != nil {
+		if h.serveCached(c) {
+			return
+		}
+		respondBadRequest(c, err)
+		return
+	}
+
+	params.echo(result)
+	formatRecords(result.Records, format)
+	h.respondRead(c, result)
+}
+
+// maxMultiGetKeys is the maximum number of keys accepted by a single multi-get request.
+const maxMultiGetKeys = 500
+
+type GetRecordsByKeysRequest struct {
+	Keys []repository.RecordKey `json:"keys" binding:"required,min=1,dive"`
+}
+
+// GetRecordsByKeys handles POST requests to fetch many records by composite key at once.
+// It expects a JSON body with a keys array of up to 500 resource_type/resource_id pairs,
+// de-duplicates repeated keys, and returns the found records in request order together
+// with a missing array listing the keys that do not exist.
+func (h *RecordHandler) GetRecordsByKeys(c *gin.Context) {
+	var req GetRecordsByKeysRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Keys) > maxMultiGetKeys {
+		respond(c, http.StatusBadRequest, gin.H{"error": "at most 500 keys may be requested at once"})
+		return
+	}
+
+	format, ok := parseRecordFormat(c)
+	if !ok {
+		return
+	}
+
+	records, missing, err := h.repo.GetByKeys(req.Keys)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to retrieve records"})
+		return
+	}
+	formatRecords(records, format)
+
+	respond(c, http.StatusOK, gin.H{"records": records, "missing": missing})
+}
+
+// GetRecord handles GET requests for a single record identified by the
+// resource_type and resource_id path parameters. An optional fields parameter
+// selects a comma-separated subset of the record's fields, such as
+// fields=resource_id,context; only those columns are read and returned, and unknown
+// names are rejected with 400. It accepts the timestamps parameter of the listings.
+// Returns 404 if the record does not exist.
+func (h *RecordHandler) GetRecord(c *gin.Context) {
+	format, ok := parseRecordFormat(c)
+	if !ok {
+		return
+	}
+
+	resourceType := c.Param("resource_type")
+	resourceID := c.Param("resource_id")
+
+	var fields []string
+	if value, ok := c.GetQuery("fields"); ok {
+		var err error
+		if fields, err = repository.ParseFields(value); err != nil {
+			respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var record *repository.Record
+	var err error
+	if fields == nil {
+		record, err = h.repo.GetByID(resourceID, resourceType)
+	} else {
+		record, err = h.repo.GetByIDFields(resourceID, resourceType, fields)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		respond(c, http.StatusNotFound, gin.H{"error": "Record not found"})
+		return
+	}
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to get record"})
+		return
+	}
+
+	format.apply(record)
+	if fields == nil {
+		respond(c, http.StatusOK, record)
+		return
+	}
+
+	projected, err := record.Project(fields)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to get record"})
+		return
+	}
+	respond(c, http.StatusOK, projected)
+}
+
+// TouchRecord handles POST requests that mark a record as recently seen by bumping
+// its updated_at timestamp without changing its content. The record is identified
+// by the resource_type and resource_id path parameters. Returns 200 on success and
+// 404 if the record does not exist. With an If-Unmodified-Since header the record
+// is only touched if its updated_at is not after the header's time, and 412
+// Precondition Failed is returned otherwise; a header that is not an HTTP date is
+// rejected with 400.
+func (h *RecordHandler) TouchRecord(c *gin.Context) {
+	resourceType := c.Param("resource_type")
+	resourceID := c.Param("resource_id")
+
+	var err error
+	if header := c.GetHeader("If-Unmodified-Since"); header != "" {
+		since, parseErr := http.ParseTime(header)
+		if parseErr != nil {
+			respond(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid If-Unmodified-Since header '%s': must be an HTTP date", header)})
+			return
+		}
+		err = h.repo.TouchIfUnmodifiedSince(resourceID, resourceType, since)
+	} else {
+		err = h.repo.Touch(resourceID, resourceType)
+	}
+	if errors.Is(err, repository.ErrModified) {
+		respond(c, http.StatusPreconditionFailed, gin.H{"error": "Record was modified after If-Unmodified-Since"})
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		respond(c, http.StatusNotFound, gin.H{"error": "Record not found"})
+		return
+	}
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to touch record"})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{"message": "Record touched successfully", "resource_id": resourceID, "resource_type": resourceType})
+}
+
+// DeleteRecord handles DELETE requests for the record identified by the
+// resource_type and resource_id path parameters. Returns 200 on success and 404 if
+// the record does not exist.
+func (h *RecordHandler) DeleteRecord(c *gin.Context) {
+	resourceType := c.Param("resource_type")
+	resourceID := c.Param("resource_id")
+
+	err := h.repo.Delete(resourceID, resourceType)
+	if errors.Is(err, repository.ErrNotFound) {
+		respond(c, http.StatusNotFound, gin.H{"error": "Record not found"})
+		return
+	}
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to delete record"})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{"message": "Record deleted successfully", "resource_id": resourceID, "resource_type": resourceType})
+}
+
+// maxReplaceRecords is the maximum number of records accepted by a single replace request.
+const maxReplaceRecords = 10000
+
+// ReplaceRecord is one record of a replace request; its resource_type is taken
+// from the request path.
+type ReplaceRecord struct {
+	ResourceID string            `json:"resource_id" binding:"required"`
+	Context    *string           `json:"context,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+type ReplaceRecordsRequest struct {
+	Records []ReplaceRecord `json:"records" binding:"required,dive"`
+}
+
+// ReplaceRecordsOfType handles PUT requests that replace every record of the
+// resource_type path parameter with the records in the JSON body, atomically, so
+// that readers never see a partial set. It expects a records array of up to 10000
+// entries with unique resource_ids; an empty array deletes every record of the
+// type. Each context is validated against any JSON Schema registered for the type.
+// Returns 200 with the number of records stored. With check_only=true the records
+// are validated and the keys that already exist, which the replace would
+// overwrite, are returned as conflicts without writing anything.
+func (h *RecordHandler) ReplaceRecordsOfType(c *gin.Context) {
+	resourceType := c.Param("resource_type")
+
+	var req ReplaceRecordsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Records) > maxReplaceRecords {
+		respond(c, http.StatusBadRequest, gin.H{"error": "at most 10000 records may be replaced at once"})
+		return
+	}
+
+	records := make([]repository.Record, len(req.Records))
+	seen := make(map[string]bool, len(req.Records))
+	for i, item := range req.Records {
+		if seen[item.ResourceID] {
+			respond(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("duplicate resource_id '%s'", item.ResourceID)})
+			return
+		}
+		seen[item.ResourceID] = true
+
+		if !h.validateContext(c, resourceType, item.Context) {
+			return
+		}
+
+		records[i] = repository.Record{ResourceID: item.ResourceID, ResourceType: resourceType, Context: item.Context, Metadata: item.Metadata}
+	}
+
+	if c.Query("check_only") == "true" {
+		h.checkReplaceConflicts(c, resourceType, records)
+		return
+	}
+
+	if err := h.repo.ReplaceByType(resourceType, records); err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to replace records"})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{"message": "Records replaced successfully", "resource_type": resourceType, "count": len(records)})
+}
+
+// checkReplaceConflicts answers a check_only replace request with the keys of
+// records that already exist, looked up with a single query.
+func (h *RecordHandler) checkReplaceConflicts(c *gin.Context, resourceType string, records []repository.Record) {
+	keys := make([]repository.RecordKey, len(records))
+	for i, record := range records {
+		keys[i] = repository.RecordKey{ResourceType: record.ResourceType, ResourceID: record.ResourceID}
+	}
+
+	conflicts, err := h.repo.ExistingKeys(keys)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to check for existing records"})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"message":       "Records are valid, nothing was written",
+		"check_only":    true,
+		"resource_type": resourceType,
+		"count":         len(records),
+		"conflicts":     conflicts,
+	})
 }
 
 // CreateRecordFromQuery handles POST requests to create a record using query parameters.
@@ -102,12 +1077,12 @@ func (h *RecordHandler) CreateRecordFromQuery(c *gin.Context) {
 	contextStr := c.Query("context")
 
 	if resourceID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "resource_id query parameter is required"})
+		respond(c, http.StatusBadRequest, gin.H{"error": "resource_id query parameter is required"})
 		return
 	}
 
 	if resourceType == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "resource_type query parameter is required"})
+		respond(c, http.StatusBadRequest, gin.H{"error": "resource_type query parameter is required"})
 		return
 	}
 
@@ -116,10 +1091,9 @@ func (h *RecordHandler) CreateRecordFromQuery(c *gin.Context) {
 		context = &contextStr
 	}
 
-	if err := h.repo.Insert(resourceID, resourceType, context); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create record"})
+	if !h.validateContext(c, resourceType, context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Record created successfully", "resource_id": resourceID, "resource_type": resourceType})
-}
\ No newline at end of file
+	h.createRecord(c, resourceID, resourceType, context, nil)
+}
@@ -4,15 +4,25 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"tokenpagination/repository"
+	"tokenpagination/schema"
+	"tokenpagination/testutil"
 )
 
 // MockRecordRepository is a mock implementation of RecordRepositoryInterface for testing
@@ -30,9 +40,76 @@ func (m *MockRecordRepository) Insert(resourceID, resourceType string, context *
 	return args.Error(0)
 }
 
-func (m *MockRecordRepository) GetAll() ([]repository.Record, error) {
+func (m *MockRecordRepository) InsertWithMetadata(resourceID, resourceType string, context *string, metadata map[string]string) error {
+	args := m.Called(resourceID, resourceType, context, metadata)
+	return args.Error(0)
+}
+
+func (m *MockRecordRepository) InsertReturning(resourceID, resourceType string, context *string, metadata map[string]string) (*repository.Record, error) {
+	args := m.Called(resourceID, resourceType, context, metadata)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.Record), args.Error(1)
+}
+
+func (m *MockRecordRepository) GetAll() ([]repository.Record, bool, error) {
+	args := m.Called()
+	return args.Get(0).([]repository.Record), args.Bool(1), args.Error(2)
+}
+
+func (m *MockRecordRepository) GetAllLenient() ([]repository.Record, bool, []string, error) {
+	args := m.Called()
+	warnings, _ := args.Get(2).([]string)
+	return args.Get(0).([]repository.Record), args.Bool(1), warnings, args.Error(3)
+}
+
+func (m *MockRecordRepository) GetAllContextFirst() ([]repository.Record, bool, error) {
+	args := m.Called()
+	return args.Get(0).([]repository.Record), args.Bool(1), args.Error(2)
+}
+
+func (m *MockRecordRepository) GetGroupedByType(perTypeLimit int) (map[string][]repository.Record, error) {
+	args := m.Called(perTypeLimit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string][]repository.Record), args.Error(1)
+}
+
+func (m *MockRecordRepository) Count() (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRecordRepository) CountApproximate() (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRecordRepository) LastModified() (time.Time, error) {
+	args := m.Called()
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *MockRecordRepository) CountByDay(from, to time.Time) ([]repository.DayCount, error) {
+	args := m.Called(from, to)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repository.DayCount), args.Error(1)
+}
+
+// ForEach passes the records given to On("ForEach", records, err) to fn one by one
+// and then returns err.
+func (m *MockRecordRepository) ForEach(fn func(repository.Record) error) error {
 	args := m.Called()
-	return args.Get(0).([]repository.Record), args.Error(1)
+	for _, record := range args.Get(0).([]repository.Record) {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
 }
 
 func (m *MockRecordRepository) GetPaginated(continuationToken string, pageSize int) (*repository.PaginatedResult, error) {
@@ -43,6 +120,148 @@ func (m *MockRecordRepository) GetPaginated(continuationToken string, pageSize i
 	return args.Get(0).(*repository.PaginatedResult), args.Error(1)
 }
 
+func (m *MockRecordRepository) GetPaginatedLenient(continuationToken string, pageSize int) (*repository.PaginatedResult, error) {
+	args := m.Called(continuationToken, pageSize)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.PaginatedResult), args.Error(1)
+}
+
+func (m *MockRecordRepository) GetPaginatedByType(resourceType, continuationToken string, pageSize int) (*repository.PaginatedResult, error) {
+	args := m.Called(resourceType, continuationToken, pageSize)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.PaginatedResult), args.Error(1)
+}
+
+func (m *MockRecordRepository) GetPaginatedFiltered(filter repository.PaginationFilter, continuationToken string, pageSize int) (*repository.PaginatedResult, error) {
+	args := m.Called(filter, continuationToken, pageSize)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.PaginatedResult), args.Error(1)
+}
+
+func (m *MockRecordRepository) GetPaginatedSorted(order repository.SortOrder, filter repository.PaginationFilter, continuationToken string, pageSize int) (*repository.PaginatedResult, error) {
+	args := m.Called(order, filter, continuationToken, pageSize)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.PaginatedResult), args.Error(1)
+}
+
+func (m *MockRecordRepository) GetWithoutContext(continuationToken string, pageSize int) (*repository.PaginatedResult, error) {
+	args := m.Called(continuationToken, pageSize)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.PaginatedResult), args.Error(1)
+}
+
+func (m *MockRecordRepository) GetLastPage(pageSize int) (*repository.PaginatedResult, error) {
+	args := m.Called(pageSize)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.PaginatedResult), args.Error(1)
+}
+
+func (m *MockRecordRepository) GetNewer(sinceToken string, pageSize int) (*repository.NewerResult, error) {
+	args := m.Called(sinceToken, pageSize)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.NewerResult), args.Error(1)
+}
+
+func (m *MockRecordRepository) ExplainPaginated(continuationToken string, pageSize int) (*repository.ExplainedQuery, error) {
+	args := m.Called(continuationToken, pageSize)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.ExplainedQuery), args.Error(1)
+}
+
+func (m *MockRecordRepository) Explain(query *repository.ExplainedQuery) ([]repository.PlanRow, error) {
+	args := m.Called(query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repository.PlanRow), args.Error(1)
+}
+
+func (m *MockRecordRepository) GetActivityFeed(pageSize int, continuationToken string) (*repository.PaginatedResult, error) {
+	args := m.Called(pageSize, continuationToken)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.PaginatedResult), args.Error(1)
+}
+
+func (m *MockRecordRepository) GetByKeys(keys []repository.RecordKey) ([]repository.Record, []repository.RecordKey, error) {
+	args := m.Called(keys)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).([]repository.Record), args.Get(1).([]repository.RecordKey), args.Error(2)
+}
+
+func (m *MockRecordRepository) ExistingKeys(keys []repository.RecordKey) ([]repository.RecordKey, error) {
+	args := m.Called(keys)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repository.RecordKey), args.Error(1)
+}
+
+func (m *MockRecordRepository) GetByID(resourceID, resourceType string) (*repository.Record, error) {
+	args := m.Called(resourceID, resourceType)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.Record), args.Error(1)
+}
+
+func (m *MockRecordRepository) GetByIDFields(resourceID, resourceType string, fields []string) (*repository.Record, error) {
+	args := m.Called(resourceID, resourceType, fields)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.Record), args.Error(1)
+}
+
+func (m *MockRecordRepository) Touch(resourceID, resourceType string) error {
+	args := m.Called(resourceID, resourceType)
+	return args.Error(0)
+}
+
+func (m *MockRecordRepository) TouchIfUnmodifiedSince(resourceID, resourceType string, since time.Time) error {
+	args := m.Called(resourceID, resourceType, since)
+	return args.Error(0)
+}
+
+func (m *MockRecordRepository) SinceStart() string {
+	args := m.Called()
+	return args.String(0)
+}
+
+func (m *MockRecordRepository) Delete(resourceID, resourceType string) error {
+	args := m.Called(resourceID, resourceType)
+	return args.Error(0)
+}
+
+func (m *MockRecordRepository) DeleteAll() (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRecordRepository) ReplaceByType(resourceType string, records []repository.Record) error {
+	args := m.Called(resourceType, records)
+	return args.Error(0)
+}
+
 // setupTestHandler creates a test handler with mock repository
 func setupTestHandler() (*RecordHandler, *MockRecordRepository) {
 	mockRepo := &MockRecordRepository{}
@@ -69,271 +288,2015 @@ func setupGinContext(method, url string, body any) (*gin.Context, *httptest.Resp
 	return c, w
 }
 
-func TestNewRecordHandler(t *testing.T) {
+func TestNewRecordHandler(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	assert.NotNil(t, handler)
+	assert.Equal(t, mockRepo, handler.repo)
+}
+
+func TestCreateRecord_Success(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	requestBody := CreateRecordRequest{
+		ResourceID:   "user-123",
+		ResourceType: "user",
+		Context:      stringPtr(`{"action": "login"}`),
+	}
+
+	mockRepo.On("Insert", "user-123", "user", stringPtr(`{"action": "login"}`)).Return(nil)
+
+	c, w := setupGinContext("POST", "/api/v1/records", requestBody)
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response map[string]any
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "Record created successfully", response["message"])
+	assert.Equal(t, "user-123", response["resource_id"])
+	assert.Equal(t, "user", response["resource_type"])
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateRecord_WithMetadata(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	requestBody := CreateRecordRequest{
+		ResourceID:   "user-123",
+		ResourceType: "user",
+		Metadata:     map[string]string{"tier": "gold"},
+	}
+
+	mockRepo.On("InsertWithMetadata", "user-123", "user", (*string)(nil), map[string]string{"tier": "gold"}).Return(nil)
+
+	c, w := setupGinContext("POST", "/api/v1/records", requestBody)
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "Insert", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCreateRecord_ReturnRepresentation(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	stored := &repository.Record{
+		ResourceID:   "user-123",
+		ResourceType: "user",
+		Context:      stringPtr("test context"),
+		Metadata:     map[string]string{"tier": "gold"},
+		CreatedAt:    created,
+		UpdatedAt:    created,
+	}
+	mockRepo.On("InsertReturning", "user-123", "user", stringPtr("test context"), map[string]string{"tier": "gold"}).Return(stored, nil)
+
+	c, w := setupGinContext("POST", "/api/v1/records?return=representation", CreateRecordRequest{
+		ResourceID:   "user-123",
+		ResourceType: "user",
+		Context:      stringPtr("test context"),
+		Metadata:     map[string]string{"tier": "gold"},
+	})
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "user-123", response["resource_id"])
+	assert.Equal(t, "test context", response["context"])
+	assert.Equal(t, "2024-01-15T10:30:00Z", response["created_at"])
+	assert.NotContains(t, response, "message")
+
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "InsertWithMetadata", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCreateRecord_ReturnMinimal(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("Insert", "user-123", "user", (*string)(nil)).Return(nil)
+
+	c, w := setupGinContext("POST", "/api/v1/records?return=minimal", CreateRecordRequest{ResourceID: "user-123", ResourceType: "user"})
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Record created successfully", response["message"])
+	assert.NotContains(t, response, "created_at")
+
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "InsertReturning", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCreateRecord_ReturnRepresentationError(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("InsertReturning", "user-123", "user", (*string)(nil), map[string]string(nil)).Return(nil, errors.New("duplicate key"))
+
+	c, w := setupGinContext("POST", "/api/v1/records?return=representation", CreateRecordRequest{ResourceID: "user-123", ResourceType: "user"})
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateRecord_Duplicate(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("Insert", "user-123", "user", (*string)(nil)).Return(fmt.Errorf("%w: Duplicate entry", repository.ErrDuplicate))
+
+	c, w := setupGinContext("POST", "/api/v1/records", CreateRecordRequest{ResourceID: "user-123", ResourceType: "user"})
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.JSONEq(t, `{"error":"Record already exists"}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateRecord_ReturnRepresentationDuplicate(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("InsertReturning", "user-123", "user", (*string)(nil), map[string]string(nil)).Return(nil, fmt.Errorf("%w: Duplicate entry", repository.ErrDuplicate))
+
+	c, w := setupGinContext("POST", "/api/v1/records?return=representation", CreateRecordRequest{ResourceID: "user-123", ResourceType: "user"})
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateRecord_InvalidReturn(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("POST", "/api/v1/records?return=everything", CreateRecordRequest{ResourceID: "user-123", ResourceType: "user"})
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid return 'everything'")
+	mockRepo.AssertNotCalled(t, "Insert", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCreateRecord_InvalidJSON(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("POST", "/api/v1/records", nil)
+	c.Request = httptest.NewRequest("POST", "/api/v1/records", bytes.NewBufferString("invalid json"))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateRecord_MissingRequiredFields(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	requestBody := CreateRecordRequest{
+		ResourceID: "user-123",
+		// Missing ResourceType
+	}
+
+	c, w := setupGinContext("POST", "/api/v1/records", requestBody)
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateRecord_MissingResourceID(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("POST", "/api/v1/records", CreateRecordRequest{ResourceType: "user"})
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "ResourceID")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateRecord_GeneratesID(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("InsertWithMetadata", mock.AnythingOfType("string"), "task", (*string)(nil), map[string]string{"source": "import"}).Return(nil)
+
+	c, w := setupGinContext("POST", "/api/v1/records", CreateRecordRequest{ResourceType: "task", Metadata: map[string]string{"source": "import"}, GenerateID: true})
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	generatedID, _ := response["resource_id"].(string)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, generatedID)
+
+	// The id returned to the client must be the one that was inserted
+	mockRepo.AssertCalled(t, "InsertWithMetadata", generatedID, "task", (*string)(nil), map[string]string{"source": "import"})
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateRecord_GenerateIDWithResourceID(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("POST", "/api/v1/records", CreateRecordRequest{ResourceID: "task-42", ResourceType: "task", GenerateID: true})
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"resource_id cannot be combined with generate_id"}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateRecord_RepositoryError(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	requestBody := CreateRecordRequest{
+		ResourceID:   "user-123",
+		ResourceType: "user",
+	}
+
+	mockRepo.On("Insert", "user-123", "user", (*string)(nil)).Return(errors.New("database error"))
+
+	c, w := setupGinContext("POST", "/api/v1/records", requestBody)
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	var response map[string]any
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "Failed to create record", response["error"])
+
+	mockRepo.AssertExpectations(t)
+}
+
+// setupSchemaValidator loads a context schema for the user type from a temp directory
+func setupSchemaValidator(t *testing.T) *schema.ContextValidator {
+	dir := t.TempDir()
+	userSchema := `{"type": "object", "properties": {"action": {"type": "string"}}, "required": ["action"]}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "user.json"), []byte(userSchema), 0o644))
+
+	validator, err := schema.LoadDir(dir)
+	require.NoError(t, err)
+	return validator
+}
+
+func TestCreateRecord_ContextMatchesSchema(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	handler.SetContextValidator(setupSchemaValidator(t))
+
+	requestBody := CreateRecordRequest{
+		ResourceID:   "user-123",
+		ResourceType: "user",
+		Context:      stringPtr(`{"action": "login"}`),
+	}
+
+	mockRepo.On("Insert", "user-123", "user", stringPtr(`{"action": "login"}`)).Return(nil)
+
+	c, w := setupGinContext("POST", "/api/v1/records", requestBody)
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateRecord_ContextViolatesSchema(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	handler.SetContextValidator(setupSchemaValidator(t))
+
+	requestBody := CreateRecordRequest{
+		ResourceID:   "user-123",
+		ResourceType: "user",
+		Context:      stringPtr(`{"ip": "10.0.0.1"}`),
+	}
+
+	c, w := setupGinContext("POST", "/api/v1/records", requestBody)
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	var response map[string]any
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "context failed schema validation", response["error"])
+	assert.NotEmpty(t, response["details"])
+
+	mockRepo.AssertNotCalled(t, "Insert", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCreateRecord_NoSchemaForType(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	handler.SetContextValidator(setupSchemaValidator(t))
+
+	requestBody := CreateRecordRequest{
+		ResourceID:   "doc-1",
+		ResourceType: "document",
+		Context:      stringPtr(`free-form text`),
+	}
+
+	mockRepo.On("Insert", "doc-1", "document", stringPtr(`free-form text`)).Return(nil)
+
+	c, w := setupGinContext("POST", "/api/v1/records", requestBody)
+	handler.CreateRecord(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateRecordFromQuery_ContextViolatesSchema(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	handler.SetContextValidator(setupSchemaValidator(t))
+
+	c, w := setupGinContext("POST", "/api/v1/records/create?resource_id=user-1&resource_type=user&context=not-json", nil)
+	handler.CreateRecordFromQuery(c)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	mockRepo.AssertNotCalled(t, "Insert", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCreateRecordAuto_GeneratesUUID(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("Insert", mock.AnythingOfType("string"), "task", (*string)(nil)).Return(nil)
+
+	c, w := setupGinContext("POST", "/api/v1/records/auto", CreateAutoRecordRequest{ResourceType: "task"})
+	handler.CreateRecordAuto(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response map[string]any
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	generatedID, _ := response["resource_id"].(string)
+	assert.Regexp(t, uuidPattern, generatedID)
+	assert.Equal(t, "task", response["resource_type"])
+
+	// The id returned to the client must be the one that was inserted
+	mockRepo.AssertCalled(t, "Insert", generatedID, "task", (*string)(nil))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateRecordAuto_RespectsSuppliedID(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("Insert", "task-42", "task", (*string)(nil)).Return(nil)
+
+	c, w := setupGinContext("POST", "/api/v1/records/auto", CreateAutoRecordRequest{ResourceID: "task-42", ResourceType: "task"})
+	handler.CreateRecordAuto(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response map[string]any
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "task-42", response["resource_id"])
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateRecordAuto_MissingResourceType(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("POST", "/api/v1/records/auto", CreateAutoRecordRequest{ResourceID: "task-42"})
+	handler.CreateRecordAuto(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecords_Success(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	now := time.Now()
+	mockRecords := []repository.Record{
+		{
+			ResourceID:   "user-123",
+			ResourceType: "user",
+			Context:      stringPtr(`{"action": "login"}`),
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ResourceID:   "doc-456",
+			ResourceType: "document",
+			Context:      nil,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+
+	mockRepo.On("GetAll").Return(mockRecords, false, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records", nil)
+	handler.GetRecords(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.NotEmpty(t, w.Header().Get("Sunset"))
+	assert.Empty(t, w.Header().Get("X-Result-Truncated"))
+	assert.Empty(t, w.Header().Get("Warning"))
+	assert.Equal(t, `</api/v1/records/paginated>; rel="successor-version"`, w.Header().Get("Link"))
+
+	var response map[string]any
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Contains(t, response, "records")
+	assert.Equal(t, false, response["truncated"])
+
+	records := response["records"].([]any)
+	assert.Len(t, records, 2)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecords_Truncated(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetAll").Return([]repository.Record{{ResourceID: "user-1", ResourceType: "user"}}, true, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records", nil)
+	handler.GetRecords(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("X-Result-Truncated"))
+	assert.Equal(t, `299 - "Result truncated at 1 rows; use /api/v1/records/paginated"`, w.Header().Get("Warning"))
+	assert.Equal(t, `</api/v1/records/paginated>; rel="successor-version"`, w.Header().Get("Link"))
+
+	var response map[string]any
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, true, response["truncated"])
+	assert.Equal(t, "/api/v1/records/paginated", response["paginated_url"])
+	assert.Equal(t, "/api/v1/records/export.sql", response["export_url"])
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetGroupedRecords(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	mockRepo.On("GetGroupedByType", 0).Return(map[string][]repository.Record{
+		"user":     {{ResourceID: "user-2", ResourceType: "user", CreatedAt: created, UpdatedAt: created}, {ResourceID: "user-1", ResourceType: "user", CreatedAt: created, UpdatedAt: created}},
+		"document": {{ResourceID: "doc-1", ResourceType: "document", CreatedAt: created, UpdatedAt: created}},
+	}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/grouped?timestamps=epoch_ms", nil)
+	handler.GetGroupedRecords(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Groups map[string][]map[string]any `json:"groups"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Groups, 2)
+	require.Len(t, response.Groups["user"], 2)
+	assert.Equal(t, "user-2", response.Groups["user"][0]["resource_id"])
+	assert.Equal(t, "user-1", response.Groups["user"][1]["resource_id"])
+	assert.Equal(t, float64(created.UnixMilli()), response.Groups["document"][0]["created_at"])
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetGroupedRecords_PerTypeLimit(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetGroupedByType", 3).Return(map[string][]repository.Record{}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/grouped?per_type_limit=3", nil)
+	handler.GetGroupedRecords(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"groups":{}}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetGroupedRecords_InvalidPerTypeLimit(t *testing.T) {
+	for _, value := range []string{"0", "-1", "ten"} {
+		handler, mockRepo := setupTestHandler()
+
+		c, w := setupGinContext("GET", "/api/v1/records/grouped?per_type_limit="+value, nil)
+		handler.GetGroupedRecords(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, value)
+		assert.JSONEq(t, `{"error":"invalid per_type_limit '`+value+`': must be a positive integer","field":"per_type_limit"}`, w.Body.String())
+		mockRepo.AssertNotCalled(t, "GetGroupedByType", mock.Anything)
+	}
+}
+
+func TestGetGroupedRecords_RepositoryError(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetGroupedByType", 0).Return(nil, errors.New("database error"))
+
+	c, w := setupGinContext("GET", "/api/v1/records/grouped", nil)
+	handler.GetGroupedRecords(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error":"Failed to retrieve records"}`, w.Body.String())
+}
+
+func TestGetRecords_RepositoryError(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetAll").Return([]repository.Record{}, false, errors.New("database error"))
+
+	c, w := setupGinContext("GET", "/api/v1/records", nil)
+	handler.GetRecords(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	var response map[string]any
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "Failed to retrieve records", response["error"])
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecords_Lenient(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	now := time.Now()
+	warnings := []string{"row 2 skipped: sql: Scan error on column index 3"}
+	mockRepo.On("GetAllLenient").Return([]repository.Record{{ResourceID: "user-1", ResourceType: "user", CreatedAt: now, UpdatedAt: now}}, false, warnings, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records?lenient=true", nil)
+	handler.GetRecords(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Records  []repository.Record `json:"records"`
+		Warnings []string            `json:"warnings"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Records, 1)
+	assert.Equal(t, warnings, response.Warnings)
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "GetAll")
+}
+
+func TestGetRecords_ContextFirst(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	now := time.Now()
+	context := `{"action": "login"}`
+	mockRepo.On("GetAllContextFirst").Return([]repository.Record{
+		{ResourceID: "user-1", ResourceType: "user", Context: &context, CreatedAt: now, UpdatedAt: now},
+		{ResourceID: "user-2", ResourceType: "user", CreatedAt: now, UpdatedAt: now},
+	}, false, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records?context_first=true", nil)
+	handler.GetRecords(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Records []repository.Record `json:"records"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Records, 2)
+	assert.Equal(t, "user-1", response.Records[0].ResourceID)
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "GetAll")
+}
+
+func TestGetRecords_ContextFirstLenient(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("GET", "/api/v1/records?context_first=true&lenient=true", nil)
+	handler.GetRecords(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "lenient=true cannot be combined with context_first")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_Lenient(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	token := "next-token"
+	mockRepo.On("GetPaginatedLenient", "", 5).Return(&repository.PaginatedResult{
+		Records:               []repository.Record{{ResourceID: "user-1", ResourceType: "user"}},
+		NextContinuationToken: &token,
+		Warnings:              []string{"row 2 skipped: invalid metadata for user/user-2"},
+	}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?lenient=true", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"warnings":["row 2 skipped: invalid metadata for user/user-2"]`)
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "GetPaginated", mock.Anything, mock.Anything)
+
+	// Strict reads carry no warnings field
+	mockRepo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{Records: []repository.Record{}, IsLastPage: true}, nil)
+	c, w = setupGinContext("GET", "/api/v1/records/paginated", nil)
+	handler.GetRecordsPaginated(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "warnings")
+}
+
+func TestGetRecordsPaginated_LenientWithFilters(t *testing.T) {
+	for _, query := range []string{"resource_type=user", "order_by=seq", "page=last", "metadata_key=source", "context_first=true"} {
+		t.Run(query, func(t *testing.T) {
+			handler, mockRepo := setupTestHandler()
+
+			c, w := setupGinContext("GET", "/api/v1/records/paginated?lenient=true&"+query, nil)
+			handler.GetRecordsPaginated(c)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), "lenient=true cannot be combined")
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetRecordsPaginated_Success(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	now := time.Now()
+	mockRecords := []repository.Record{
+		{
+			ResourceID:   "user-123",
+			ResourceType: "user",
+			Context:      nil,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+
+	token := "next-token"
+	mockResult := &repository.PaginatedResult{
+		Records:               mockRecords,
+		NextContinuationToken: &token,
+	}
+
+	mockRepo.On("GetPaginated", "", 5).Return(mockResult, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response repository.PaginatedResult
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Len(t, response.Records, 1)
+	assert.NotNil(t, response.NextContinuationToken)
+	assert.Equal(t, "next-token", *response.NextContinuationToken)
+	assert.Contains(t, w.Body.String(), `"is_last_page":false`)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_WithCustomPageSize(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockResult := &repository.PaginatedResult{
+		Records:               []repository.Record{},
+		NextContinuationToken: nil,
+	}
+
+	mockRepo.On("GetPaginated", "", 10).Return(mockResult, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?page_size=10", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_IncludeTotal(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		countMethod     string
+		wantApproximate bool
+	}{
+		{name: "exact", query: "include_total=true", countMethod: "Count"},
+		{name: "approximate", query: "include_total=true&approximate=true", countMethod: "CountApproximate", wantApproximate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, mockRepo := setupTestHandler()
+			mockRepo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{Records: []repository.Record{}}, nil)
+			mockRepo.On(tt.countMethod).Return(int64(1234), nil)
+
+			c, w := setupGinContext("GET", "/api/v1/records/paginated?"+tt.query, nil)
+			handler.GetRecordsPaginated(c)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			var response repository.PaginatedResult
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.NotNil(t, response.Total)
+			assert.Equal(t, int64(1234), *response.Total)
+			assert.Equal(t, tt.wantApproximate, response.TotalApproximate)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetRecordsPaginated_TotalOmittedByDefault(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	mockRepo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{Records: []repository.Record{}}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "total")
+	mockRepo.AssertNotCalled(t, "Count")
+	mockRepo.AssertNotCalled(t, "CountApproximate")
+}
+
+func TestGetRecordsPaginated_IncludeTotalInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{name: "approximate without include_total", query: "approximate=true", wantErr: "approximate requires include_total=true"},
+		{name: "with filter", query: "include_total=true&resource_type=user", wantErr: "include_total counts all records and cannot be combined with resource_type, exclude_types or metadata_key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, mockRepo := setupTestHandler()
+
+			c, w := setupGinContext("GET", "/api/v1/records/paginated?"+tt.query, nil)
+			handler.GetRecordsPaginated(c)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.JSONEq(t, `{"error":"`+tt.wantErr+`"}`, w.Body.String())
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetRecordsPaginated_IncludeTotalError(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	mockRepo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{Records: []repository.Record{}}, nil)
+	mockRepo.On("Count").Return(int64(0), assert.AnError)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?include_total=true", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error":"Failed to count records"}`, w.Body.String())
+}
+
+func TestGetRecordsPaginated_WithContinuationToken(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	token := "test-token"
+	mockResult := &repository.PaginatedResult{
+		Records:               []repository.Record{},
+		NextContinuationToken: nil,
+	}
+
+	mockRepo.On("GetPaginated", token, 5).Return(mockResult, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?continuation_token="+token, nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_EchoesRequest(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		token        string
+		pageSize     int
+		wantPageSize float64
+		wantToken    string
+		wantNoToken  bool
+	}{
+		{name: "first page", query: "", pageSize: 5, wantPageSize: 5, wantNoToken: true},
+		{name: "with token", query: "continuation_token=test-token&page_size=20", token: "test-token", pageSize: 20, wantPageSize: 20, wantToken: "test-token"},
+		{name: "capped page size", query: "page_size=250", pageSize: 100, wantPageSize: 100, wantNoToken: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, mockRepo := setupTestHandler()
+			mockRepo.On("GetPaginated", tt.token, tt.pageSize).Return(&repository.PaginatedResult{Records: []repository.Record{}}, nil)
+
+			c, w := setupGinContext("GET", "/api/v1/records/paginated?"+tt.query, nil)
+			handler.GetRecordsPaginated(c)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			var response map[string]any
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.wantPageSize, response["requested_page_size"])
+			if tt.wantNoToken {
+				assert.NotContains(t, response, "request_token")
+			} else {
+				assert.Equal(t, tt.wantToken, response["request_token"])
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetActivityFeed_EchoesRequest(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	mockRepo.On("GetActivityFeed", 10, "feed-token").Return(&repository.PaginatedResult{Records: []repository.Record{}}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/activity?continuation_token=feed-token&page_size=10", nil)
+	handler.GetActivityFeed(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response repository.PaginatedResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 10, response.RequestedPageSize)
+	require.NotNil(t, response.RequestToken)
+	assert.Equal(t, "feed-token", *response.RequestToken)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_DebugExplain(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	handler.EnableDebugExplain()
+
+	query := &repository.ExplainedQuery{SQL: "SELECT resource_id FROM resource_context LIMIT ?", Args: []any{6}}
+	plan := []repository.PlanRow{{"table": "resource_context", "type": "range", "key": "idx_created"}}
+	mockRepo.On("GetPaginated", "test-token", 5).Return(&repository.PaginatedResult{Records: []repository.Record{}}, nil)
+	mockRepo.On("ExplainPaginated", "test-token", 5).Return(query, nil)
+	mockRepo.On("Explain", query).Return(plan, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?continuation_token=test-token", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"key":"idx_created","table":"resource_context","type":"range"}]`, w.Header().Get("X-Query-Plan"))
+	assert.Empty(t, w.Header().Get("X-Query-Plan-Error"))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_DebugExplainError(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	handler.EnableDebugExplain()
+
+	query := &repository.ExplainedQuery{SQL: "SELECT resource_id FROM resource_context LIMIT ?", Args: []any{6}}
+	mockRepo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{Records: []repository.Record{}}, nil)
+	mockRepo.On("ExplainPaginated", "", 5).Return(query, nil)
+	mockRepo.On("Explain", query).Return(nil, errors.New("EXPLAIN denied"))
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-Query-Plan"))
+	assert.Equal(t, "EXPLAIN denied", w.Header().Get("X-Query-Plan-Error"))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_NoPlanWithoutDebugExplain(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{Records: []repository.Record{}}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-Query-Plan"))
+	mockRepo.AssertNotCalled(t, "ExplainPaginated", mock.Anything, mock.Anything)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_WithResourceType(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockResult := &repository.PaginatedResult{
+		Records:               []repository.Record{},
+		NextContinuationToken: nil,
+	}
+
+	mockRepo.On("GetPaginatedByType", "user", "", 5).Return(mockResult, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?resource_type=user", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_WithMetadataKey(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockResult := &repository.PaginatedResult{
+		Records: []repository.Record{
+			{ResourceID: "user-1", ResourceType: "user", Metadata: map[string]string{"tier": "gold"}},
+		},
+	}
+
+	filter := repository.PaginationFilter{ResourceType: "user", MetadataKey: "tier"}
+	mockRepo.On("GetPaginatedFiltered", filter, "", 5).Return(mockResult, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?resource_type=user&metadata_key=tier", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response repository.PaginatedResult
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	require.Len(t, response.Records, 1)
+	assert.Equal(t, map[string]string{"tier": "gold"}, response.Records[0].Metadata)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_ExcludeTypes(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	next := "next-token"
+	filter := repository.PaginationFilter{ExcludeTypes: []string{"audit", "internal"}}
+	mockRepo.On("GetPaginatedFiltered", filter, "", 5).Return(&repository.PaginatedResult{
+		Records:               []repository.Record{{ResourceID: "user-1", ResourceType: "user"}},
+		NextContinuationToken: &next,
+	}, nil)
+	mockRepo.On("GetPaginatedFiltered", filter, next, 5).Return(&repository.PaginatedResult{
+		Records:    []repository.Record{{ResourceID: "task-1", ResourceType: "task"}},
+		IsLastPage: true,
+	}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?exclude_types=audit,internal", nil)
+	handler.GetRecordsPaginated(c)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var first repository.PaginatedResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+	require.NotNil(t, first.NextContinuationToken)
+
+	// The next page is requested with the same exclusions and the returned token
+	c, w = setupGinContext("GET", "/api/v1/records/paginated?exclude_types=audit,internal&continuation_token="+*first.NextContinuationToken, nil)
+	handler.GetRecordsPaginated(c)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var second repository.PaginatedResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &second))
+	require.Len(t, second.Records, 1)
+	assert.Equal(t, "task-1", second.Records[0].ResourceID)
+	assert.True(t, second.IsLastPage)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_TooManyExcludedTypes(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?exclude_types=a,b,c,d,e,f,g,h,i,j,k,l,m,n,o,p,q,r,s,t,u", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"exclude_types"`)
+	mockRepo.AssertNotCalled(t, "GetPaginatedFiltered", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetRecordsPaginated_OrderBy(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockResult := &repository.PaginatedResult{
+		Records: []repository.Record{
+			{ResourceID: "doc-1", ResourceType: "document"},
+			{ResourceID: "user-1", ResourceType: "user"},
+		},
+	}
+
+	order := repository.SortOrder{Column: "resource_type", Ascending: true}
+	filter := repository.PaginationFilter{}
+	mockRepo.On("GetPaginatedSorted", order, filter, "", 2).Return(mockResult, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?order_by=resource_type&order=asc&page_size=2", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response repository.PaginatedResult
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	require.Len(t, response.Records, 2)
+	assert.Equal(t, "document", response.Records[0].ResourceType)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_ContextFirst(t *testing.T) {
+	tests := []struct {
+		query string
+		order repository.SortOrder
+	}{
+		{query: "context_first=true", order: repository.SortOrder{Column: "created_at", ContextFirst: true}},
+		{query: "context_first=true&order_by=updated_at&order=asc", order: repository.SortOrder{Column: "updated_at", Ascending: true, ContextFirst: true}},
+		{query: "context_first=true&resource_type=user", order: repository.SortOrder{Column: "created_at", ContextFirst: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			handler, mockRepo := setupTestHandler()
+
+			params, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+			filter := repository.PaginationFilter{ResourceType: params.Get("resource_type")}
+			mockRepo.On("GetPaginatedSorted", tt.order, filter, "", 5).Return(&repository.PaginatedResult{Records: []repository.Record{}, IsLastPage: true}, nil)
+
+			c, w := setupGinContext("GET", "/api/v1/records/paginated?"+tt.query, nil)
+			handler.GetRecordsPaginated(c)
+
+			assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetRecordsPaginated_ContextFirstInvalid(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{query: "context_first=yes", wantErr: "invalid context_first 'yes'"},
+		{query: "context_first=true&order_by=claimed_at", wantErr: "invalid context_first 'true': cannot be combined with order_by=claimed_at"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			handler, mockRepo := setupTestHandler()
+
+			c, w := setupGinContext("GET", "/api/v1/records/paginated?"+tt.query, nil)
+			handler.GetRecordsPaginated(c)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantErr)
+			assert.Contains(t, w.Body.String(), `"field":"context_first"`)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetRecordsPaginated_OrderByInvalidColumn(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?order_by=context", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid order_by 'context'")
+	assert.Contains(t, w.Body.String(), `"field":"order_by"`)
+
+	mockRepo.AssertNotCalled(t, "GetPaginatedSorted", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetRecordsPaginated_RepositoryRejectsColumn(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	order := repository.SortOrder{Column: "updated_at"}
+	mockRepo.On("GetPaginatedSorted", order, repository.PaginationFilter{}, "", 5).
+		Return(nil, fmt.Errorf("%w 'updated_at': not indexed", repository.ErrInvalidSortColumn))
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?order_by=updated_at", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid sort column 'updated_at'")
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_InvalidOrderDirection(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?order_by=created_at&order=sideways", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid order 'sideways'")
+
+	mockRepo.AssertNotCalled(t, "GetPaginatedSorted", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetRecordsPaginated_InvalidPageSize(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?page_size=invalid", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "invalid page_size 'invalid': must be a positive integer", "field": "page_size"}`, w.Body.String())
+	mockRepo.AssertNotCalled(t, "GetPaginated", mock.Anything, mock.Anything)
+}
+
+func TestGetRecordsPaginated_PageSizeLimit(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockResult := &repository.PaginatedResult{
+		Records:               []repository.Record{},
+		NextContinuationToken: nil,
+	}
+
+	// Should cap at 100 when page size exceeds limit
+	mockRepo.On("GetPaginated", "", 100).Return(mockResult, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?page_size=150", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_RepositoryError(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetPaginated", "", 5).Return((*repository.PaginatedResult)(nil), errors.New("invalid token"))
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response map[string]any
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Contains(t, response["error"], "invalid token")
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_CursorOnly(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	token := "next-token"
+	mockResult := &repository.PaginatedResult{
+		Records:               []repository.Record{{ResourceID: "user-1", ResourceType: "user"}},
+		NextContinuationToken: &token,
+		PageDepth:             1,
+	}
+
+	mockRepo.On("GetPaginated", "", 5).Return(mockResult, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?cursor_only=true", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]any
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.NotContains(t, response, "records")
+	assert.Equal(t, true, response["has_more"])
+	assert.Equal(t, "next-token", response["next_continuation_token"])
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_CursorOnlyLastPage(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockResult := &repository.PaginatedResult{
+		Records: []repository.Record{{ResourceID: "user-1", ResourceType: "user"}},
+	}
+
+	mockRepo.On("GetPaginated", "", 5).Return(mockResult, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?cursor_only=true", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]any
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"has_more": false}, response)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_TooDeep(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetPaginated", "deep-token", 5).Return(nil, repository.ErrPaginationTooDeep)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?continuation_token=deep-token", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response map[string]any
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "pagination too deep: use /api/v1/records/export.sql to retrieve large result sets", response["error"])
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsMissingContext(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	token := "next-token"
+	mockResult := &repository.PaginatedResult{
+		Records:               []repository.Record{{ResourceID: "user-1", ResourceType: "user"}},
+		NextContinuationToken: &token,
+		PageDepth:             2,
+	}
+	mockRepo.On("GetWithoutContext", "page-token", 10).Return(mockResult, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/missing-context?continuation_token=page-token&page_size=10", nil)
+	handler.GetRecordsMissingContext(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response repository.PaginatedResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Records, 1)
+	assert.Nil(t, response.Records[0].Context)
+	assert.Equal(t, &token, response.NextContinuationToken)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetNewerRecords(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockResult := &repository.NewerResult{
+		Records: []repository.Record{
+			{ResourceID: "user-7", ResourceType: "user"},
+			{ResourceID: "user-6", ResourceType: "user"},
+		},
+		SinceToken: "since-7",
+		HasMore:    true,
+	}
+	mockRepo.On("GetNewer", "since-5", 2).Return(mockResult, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/newer?since_token=since-5&page_size=2", nil)
+	handler.GetNewerRecords(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response repository.NewerResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Records, 2)
+	assert.Equal(t, "user-7", response.Records[0].ResourceID)
+	assert.Equal(t, "since-7", response.SinceToken)
+	assert.True(t, response.HasMore)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetNewerRecords_MissingSinceToken(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("GET", "/api/v1/records/newer", nil)
+	handler.GetNewerRecords(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"since_token is required"}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetNewerRecords_InvalidToken(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetNewer", "bad", 5).Return(nil, fmt.Errorf("%w format", repository.ErrInvalidToken))
+
+	c, w := setupGinContext("GET", "/api/v1/records/newer?since_token=bad", nil)
+	handler.GetNewerRecords(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"invalid continuation token format","field":"continuation_token"}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetNewerRecords_DatabaseError(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetNewer", "since-5", 5).Return(nil, errors.New("connection refused"))
+
+	c, w := setupGinContext("GET", "/api/v1/records/newer?since_token=since-5", nil)
+	handler.GetNewerRecords(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error":"Failed to retrieve records"}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsMissingContext_InvalidToken(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetWithoutContext", "bad", 5).Return(nil, errors.New("invalid continuation token format"))
+
+	c, w := setupGinContext("GET", "/api/v1/records/missing-context?continuation_token=bad", nil)
+	handler.GetRecordsMissingContext(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid continuation token format")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_LastPage(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	prev := "prev-token"
+	mockResult := &repository.PaginatedResult{
+		Records: []repository.Record{
+			{ResourceID: "user-2", ResourceType: "user"},
+			{ResourceID: "user-1", ResourceType: "user"},
+		},
+		PrevContinuationToken: &prev,
+		PageDepth:             1,
+		IsLastPage:            true,
+	}
+	mockRepo.On("GetLastPage", 2).Return(mockResult, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?page=last&page_size=2", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response repository.PaginatedResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Records, 2)
+	assert.Equal(t, "user-2", response.Records[0].ResourceID)
+	assert.Equal(t, &prev, response.PrevContinuationToken)
+	assert.Nil(t, response.NextContinuationToken)
+	assert.True(t, response.IsLastPage)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_LastPageInvalid(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{query: "page=first", wantErr: "invalid page 'first': only 'last' is supported"},
+		{query: "page=last&continuation_token=abc", wantErr: "page=last cannot be combined"},
+		{query: "page=last&resource_type=user", wantErr: "page=last cannot be combined"},
+		{query: "page=last&order_by=updated_at", wantErr: "page=last cannot be combined"},
+		{query: "page=last&context_first=true", wantErr: "page=last cannot be combined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			handler, mockRepo := setupTestHandler()
+
+			c, w := setupGinContext("GET", "/api/v1/records/paginated?"+tt.query, nil)
+			handler.GetRecordsPaginated(c)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantErr)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetRecordsPaginated_TokenTooLong(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	token := strings.Repeat("A", repository.DefaultMaxTokenLength+1)
+	mockRepo.On("GetPaginated", token, 5).Return(nil, fmt.Errorf("%w: %d bytes, the limit is %d", repository.ErrTokenTooLong, len(token), repository.DefaultMaxTokenLength))
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?continuation_token="+token, nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"continuation token too long: 513 bytes, the limit is 512","field":"continuation_token"}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+// fixtureRecords converts generated records to repository records.
+func fixtureRecords(records []testutil.Record) []repository.Record {
+	converted := make([]repository.Record, len(records))
+	for i, r := range records {
+		converted[i] = repository.Record{ResourceID: r.ResourceID, ResourceType: r.ResourceType, Context: r.Context, CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt}
+	}
+	return converted
+}
+
+func TestGetRecordsPaginated_Golden(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	// Two pairs of records share a created_at, and one record has no context
+	factory := testutil.NewRecordFactory(1)
+	factory.GroupSize = 2
+	factory.NullContextEvery = 3
+	records := factory.Records(4)
+	slices.Reverse(records)
+	next := testutil.TokenAfter(records[3], 1, testutil.DefaultStart.Add(time.Hour)).Encode()
+
+	mockRepo.On("GetPaginated", "", 4).Return(&repository.PaginatedResult{Records: fixtureRecords(records), NextContinuationToken: &next, PageDepth: 1}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?page_size=4", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	testutil.Golden(t, "paginated_first_page", w.Body.Bytes())
+}
+
+func TestGetRecordsPaginated_ModifiedSince(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	updated := time.Date(2024, 1, 15, 10, 30, 0, 500, time.UTC)
+	mockRepo.On("LastModified").Return(updated, nil)
+	mockRepo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{Records: []repository.Record{{ResourceID: "user-1", ResourceType: "user"}}}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated", nil)
+	c.Request.Header.Set("If-Modified-Since", "Mon, 15 Jan 2024 10:29:59 GMT")
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Mon, 15 Jan 2024 10:30:00 GMT", w.Header().Get("Last-Modified"))
+	assert.Contains(t, w.Body.String(), "user-1")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_NotModifiedSince(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	// updated_at within the header's second counts as not modified
+	mockRepo.On("LastModified").Return(time.Date(2024, 1, 15, 10, 30, 0, 500, time.UTC), nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated", nil)
+	c.Request.Header.Set("If-Modified-Since", "Mon, 15 Jan 2024 10:30:00 GMT")
+	handler.GetRecordsPaginated(c)
+	c.Writer.WriteHeaderNow()
+
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, "Mon, 15 Jan 2024 10:30:00 GMT", w.Header().Get("Last-Modified"))
+	mockRepo.AssertNotCalled(t, "GetPaginated", mock.Anything, mock.Anything)
+}
+
+func TestGetRecordsPaginated_ModifiedSinceInvalidDate(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated", nil)
+	c.Request.Header.Set("If-Modified-Since", "yesterday")
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"invalid If-Modified-Since header 'yesterday': must be an HTTP date"}`, w.Body.String())
+	mockRepo.AssertNotCalled(t, "LastModified")
+}
+
+func TestGetRecordsPaginated_ModifiedSinceIgnoredWithToken(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetPaginated", "abc", 5).Return(&repository.PaginatedResult{Records: []repository.Record{}}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?continuation_token=abc", nil)
+	c.Request.Header.Set("If-Modified-Since", "Mon, 15 Jan 2024 10:30:00 GMT")
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockRepo.AssertNotCalled(t, "LastModified")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_ModifiedSinceError(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("LastModified").Return(time.Time{}, assert.AnError)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated", nil)
+	c.Request.Header.Set("If-Modified-Since", "Mon, 15 Jan 2024 10:30:00 GMT")
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error":"Failed to check for modified records"}`, w.Body.String())
+}
+
+func TestGetRecordsPaginated_InvalidTokenNamesField(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetPaginated", "bad", 5).Return(nil, fmt.Errorf("%w format", repository.ErrInvalidToken))
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?continuation_token=bad", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"invalid continuation token format","field":"continuation_token"}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsPaginated_GarbageToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "not base64url",
+			query: "continuation_token=%7Bnot-a-token%7D",
+			want:  `{"error":"invalid continuation_token '{not-a-token}': must be the base64url next_continuation_token of a previous page","field":"continuation_token"}`,
+		},
+		{
+			name:  "blank",
+			query: "continuation_token=%20%20",
+			want:  `{"error":"invalid continuation_token '  ': must be the base64url next_continuation_token of a previous page","field":"continuation_token"}`,
+		},
+		{
+			name:  "unencoded plus",
+			query: "continuation_token=ab+cd",
+			want:  `{"error":"invalid continuation_token 'ab cd': must be the base64url next_continuation_token of a previous page","field":"continuation_token"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, mockRepo := setupTestHandler()
+
+			c, w := setupGinContext("GET", "/api/v1/records/paginated?"+tt.query, nil)
+			handler.GetRecordsPaginated(c)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.JSONEq(t, tt.want, w.Body.String())
+			mockRepo.AssertNotCalled(t, "GetPaginated", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestSearchRecords_CombinedFilters(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	token := "next-token"
+	mockResult := &repository.PaginatedResult{
+		Records:               []repository.Record{{ResourceID: "user-1", ResourceType: "user"}},
+		NextContinuationToken: &token,
+		PageDepth:             1,
+	}
+
+	filter := repository.PaginationFilter{
+		ResourceType: "user",
+		IDPrefix:     "user-",
+		CreatedAfter: time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+	}
+	mockRepo.On("GetPaginatedFiltered", mock.MatchedBy(func(f repository.PaginationFilter) bool {
+		return f.ResourceType == filter.ResourceType && f.IDPrefix == filter.IDPrefix &&
+			f.CreatedAfter.Equal(filter.CreatedAfter) && f.CreatedBefore.IsZero() && f.MetadataKey == ""
+	}), "", 2).Return(mockResult, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/search?resource_type=user&id_prefix=user-&created_after=2024-01-15T10:00:00Z&page_size=2", nil)
+	handler.SearchRecords(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response repository.PaginatedResult
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Len(t, response.Records, 1)
+	assert.Equal(t, "next-token", *response.NextContinuationToken)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestSearchRecords_WithContinuationToken(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetPaginatedFiltered", mock.MatchedBy(func(f repository.PaginationFilter) bool {
+		return f.MetadataKey == "tier" && f.UpdatedBefore.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC))
+	}), "prev-token", 5).Return(&repository.PaginatedResult{Records: []repository.Record{}, PageDepth: 2, IsLastPage: true}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/search?metadata_key=tier&updated_before=2024-02-01T01:00:00%2B01:00&continuation_token=prev-token", nil)
+	handler.SearchRecords(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestSearchRecords_RejectsUnknownParameter(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("GET", "/api/v1/records/search?resource_type=user&context=x", nil)
+	handler.SearchRecords(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown search parameter 'context'")
+	mockRepo.AssertNotCalled(t, "GetPaginatedFiltered", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSearchRecords_RejectsMalformedTime(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("GET", "/api/v1/records/search?created_before=yesterday", nil)
+	handler.SearchRecords(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "created_before must be an RFC 3339 timestamp")
+	mockRepo.AssertNotCalled(t, "GetPaginatedFiltered", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetActivityFeed_Success(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	token := "next-token"
+	mockResult := &repository.PaginatedResult{
+		Records:               []repository.Record{{ResourceID: "user-1", ResourceType: "user"}},
+		NextContinuationToken: &token,
+		PageDepth:             2,
+	}
+
+	mockRepo.On("GetActivityFeed", 10, "prev-token").Return(mockResult, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/activity?page_size=10&continuation_token=prev-token", nil)
+	handler.GetActivityFeed(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response repository.PaginatedResult
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Len(t, response.Records, 1)
+	assert.Equal(t, "next-token", *response.NextContinuationToken)
+	assert.Equal(t, 2, response.PageDepth)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetActivityFeed_InvalidToken(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetActivityFeed", 5, "bad").Return(nil, errors.New("invalid continuation token format"))
+
+	c, w := setupGinContext("GET", "/api/v1/records/activity?continuation_token=bad", nil)
+	handler.GetActivityFeed(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetActivityFeed_TooDeep(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("GetActivityFeed", 5, "deep").Return(nil, repository.ErrPaginationTooDeep)
+
+	c, w := setupGinContext("GET", "/api/v1/records/activity?continuation_token=deep", nil)
+	handler.GetActivityFeed(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "pagination too deep")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecord(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	now := time.Unix(1234567890, 0).UTC()
+	record := &repository.Record{ResourceID: "user-123", ResourceType: "user", Context: stringPtr(`{"a": 1}`), CreatedAt: now, UpdatedAt: now}
+	mockRepo.On("GetByID", "user-123", "user").Return(record, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/user/user-123", nil)
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}, {Key: "resource_id", Value: "user-123"}}
+	handler.GetRecord(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"resource_id":"user-123","resource_type":"user","context":"{\"a\": 1}","created_at":"2009-02-13T23:31:30Z","updated_at":"2009-02-13T23:31:30Z"}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecord_Fields(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	record := &repository.Record{ResourceID: "user-123", Context: stringPtr(`{"a": 1}`)}
+	mockRepo.On("GetByIDFields", "user-123", "user", []string{"resource_id", "context"}).Return(record, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/user/user-123?fields=resource_id,context", nil)
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}, {Key: "resource_id", Value: "user-123"}}
+	handler.GetRecord(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, map[string]any{"resource_id": "user-123", "context": `{"a": 1}`}, response)
+	for _, omitted := range []string{"resource_type", "metadata", "created_at", "updated_at"} {
+		assert.NotContains(t, response, omitted)
+	}
+	mockRepo.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecord_UnknownField(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("GET", "/api/v1/records/user/user-123?fields=context,password", nil)
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}, {Key: "resource_id", Value: "user-123"}}
+	handler.GetRecord(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown field 'password'")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecord_NotFound(t *testing.T) {
 	handler, mockRepo := setupTestHandler()
 
-	assert.NotNil(t, handler)
-	assert.Equal(t, mockRepo, handler.repo)
+	mockRepo.On("GetByIDFields", "missing", "user", []string{"context"}).Return(nil, repository.ErrNotFound)
+
+	c, w := setupGinContext("GET", "/api/v1/records/user/missing?fields=context", nil)
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}, {Key: "resource_id", Value: "missing"}}
+	handler.GetRecord(c)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error":"Record not found"}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
 }
 
-func TestCreateRecord_Success(t *testing.T) {
+func TestTouchRecord_Success(t *testing.T) {
 	handler, mockRepo := setupTestHandler()
 
-	requestBody := CreateRecordRequest{
-		ResourceID:   "user-123",
-		ResourceType: "user",
-		Context:      stringPtr(`{"action": "login"}`),
-	}
-
-	mockRepo.On("Insert", "user-123", "user", stringPtr(`{"action": "login"}`)).Return(nil)
+	mockRepo.On("Touch", "user-123", "user").Return(nil)
 
-	c, w := setupGinContext("POST", "/api/v1/records", requestBody)
-	handler.CreateRecord(c)
+	c, w := setupGinContext("POST", "/api/v1/records/user/user-123/touch", nil)
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}, {Key: "resource_id", Value: "user-123"}}
+	handler.TouchRecord(c)
 
-	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusOK, w.Code)
 
 	var response map[string]any
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
-	assert.Equal(t, "Record created successfully", response["message"])
 	assert.Equal(t, "user-123", response["resource_id"])
 	assert.Equal(t, "user", response["resource_type"])
 
 	mockRepo.AssertExpectations(t)
 }
 
-func TestCreateRecord_InvalidJSON(t *testing.T) {
+func TestTouchRecord_NotFound(t *testing.T) {
 	handler, mockRepo := setupTestHandler()
 
-	c, w := setupGinContext("POST", "/api/v1/records", nil)
-	c.Request = httptest.NewRequest("POST", "/api/v1/records", bytes.NewBufferString("invalid json"))
-	c.Request.Header.Set("Content-Type", "application/json")
+	mockRepo.On("Touch", "missing", "user").Return(repository.ErrNotFound)
 
-	handler.CreateRecord(c)
+	c, w := setupGinContext("POST", "/api/v1/records/user/missing/touch", nil)
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}, {Key: "resource_id", Value: "missing"}}
+	handler.TouchRecord(c)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var response map[string]any
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "Record not found", response["error"])
 
-	assert.Equal(t, http.StatusBadRequest, w.Code)
 	mockRepo.AssertExpectations(t)
 }
 
-func TestCreateRecord_MissingRequiredFields(t *testing.T) {
+func TestTouchRecord_RepositoryError(t *testing.T) {
 	handler, mockRepo := setupTestHandler()
 
-	requestBody := CreateRecordRequest{
-		ResourceID: "user-123",
-		// Missing ResourceType
-	}
+	mockRepo.On("Touch", "user-123", "user").Return(errors.New("database error"))
 
-	c, w := setupGinContext("POST", "/api/v1/records", requestBody)
-	handler.CreateRecord(c)
+	c, w := setupGinContext("POST", "/api/v1/records/user/user-123/touch", nil)
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}, {Key: "resource_id", Value: "user-123"}}
+	handler.TouchRecord(c)
 
-	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	mockRepo.AssertExpectations(t)
 }
 
-func TestCreateRecord_RepositoryError(t *testing.T) {
+func TestTouchRecord_IfUnmodifiedSince_Unmodified(t *testing.T) {
 	handler, mockRepo := setupTestHandler()
 
-	requestBody := CreateRecordRequest{
-		ResourceID:   "user-123",
-		ResourceType: "user",
-	}
-
-	mockRepo.On("Insert", "user-123", "user", (*string)(nil)).Return(errors.New("database error"))
-
-	c, w := setupGinContext("POST", "/api/v1/records", requestBody)
-	handler.CreateRecord(c)
+	since := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	mockRepo.On("TouchIfUnmodifiedSince", "user-123", "user", since).Return(nil)
 
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
-
-	var response map[string]any
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.Equal(t, "Failed to create record", response["error"])
+	c, w := setupGinContext("POST", "/api/v1/records/user/user-123/touch", nil)
+	c.Request.Header.Set("If-Unmodified-Since", "Mon, 15 Jan 2024 10:30:00 GMT")
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}, {Key: "resource_id", Value: "user-123"}}
+	handler.TouchRecord(c)
 
+	assert.Equal(t, http.StatusOK, w.Code)
 	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "Touch", mock.Anything, mock.Anything)
 }
 
-func TestGetRecords_Success(t *testing.T) {
+func TestTouchRecord_IfUnmodifiedSince_Modified(t *testing.T) {
 	handler, mockRepo := setupTestHandler()
 
-	now := time.Now()
-	mockRecords := []repository.Record{
-		{
-			ResourceID:   "user-123",
-			ResourceType: "user",
-			Context:      stringPtr(`{"action": "login"}`),
-			CreatedAt:    now,
-			UpdatedAt:    now,
-		},
-		{
-			ResourceID:   "doc-456",
-			ResourceType: "document",
-			Context:      nil,
-			CreatedAt:    now,
-			UpdatedAt:    now,
-		},
-	}
-
-	mockRepo.On("GetAll").Return(mockRecords, nil)
+	since := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	mockRepo.On("TouchIfUnmodifiedSince", "user-123", "user", since).Return(repository.ErrModified)
 
-	c, w := setupGinContext("GET", "/api/v1/records", nil)
-	handler.GetRecords(c)
+	c, w := setupGinContext("POST", "/api/v1/records/user/user-123/touch", nil)
+	c.Request.Header.Set("If-Unmodified-Since", "Mon, 15 Jan 2024 10:30:00 GMT")
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}, {Key: "resource_id", Value: "user-123"}}
+	handler.TouchRecord(c)
 
-	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
 
 	var response map[string]any
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
-	assert.Contains(t, response, "records")
+	assert.Equal(t, "Record was modified after If-Unmodified-Since", response["error"])
+	mockRepo.AssertExpectations(t)
+}
 
-	records := response["records"].([]any)
-	assert.Len(t, records, 2)
+func TestTouchRecord_IfUnmodifiedSince_NotFound(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("TouchIfUnmodifiedSince", "missing", "user", mock.Anything).Return(repository.ErrNotFound)
 
+	c, w := setupGinContext("POST", "/api/v1/records/user/missing/touch", nil)
+	c.Request.Header.Set("If-Unmodified-Since", "Mon, 15 Jan 2024 10:30:00 GMT")
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}, {Key: "resource_id", Value: "missing"}}
+	handler.TouchRecord(c)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
 	mockRepo.AssertExpectations(t)
 }
 
-func TestGetRecords_RepositoryError(t *testing.T) {
+func TestTouchRecord_IfUnmodifiedSince_Invalid(t *testing.T) {
 	handler, mockRepo := setupTestHandler()
 
-	mockRepo.On("GetAll").Return([]repository.Record{}, errors.New("database error"))
+	c, w := setupGinContext("POST", "/api/v1/records/user/user-123/touch", nil)
+	c.Request.Header.Set("If-Unmodified-Since", "yesterday")
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}, {Key: "resource_id", Value: "user-123"}}
+	handler.TouchRecord(c)
 
-	c, w := setupGinContext("GET", "/api/v1/records", nil)
-	handler.GetRecords(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "If-Unmodified-Since")
+	mockRepo.AssertNotCalled(t, "Touch", mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "TouchIfUnmodifiedSince", mock.Anything, mock.Anything, mock.Anything)
+}
 
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+func TestDeleteRecord_Success(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
 
-	var response map[string]any
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.Equal(t, "Failed to retrieve records", response["error"])
+	mockRepo.On("Delete", "user-123", "user").Return(nil)
 
+	c, w := setupGinContext("DELETE", "/api/v1/records/user/user-123", nil)
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}, {Key: "resource_id", Value: "user-123"}}
+	handler.DeleteRecord(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"message":"Record deleted successfully","resource_id":"user-123","resource_type":"user"}`, w.Body.String())
 	mockRepo.AssertExpectations(t)
 }
 
-func TestGetRecordsPaginated_Success(t *testing.T) {
+func TestDeleteRecord_NotFound(t *testing.T) {
 	handler, mockRepo := setupTestHandler()
 
-	now := time.Now()
-	mockRecords := []repository.Record{
-		{
-			ResourceID:   "user-123",
-			ResourceType: "user",
-			Context:      nil,
-			CreatedAt:    now,
-			UpdatedAt:    now,
-		},
-	}
+	mockRepo.On("Delete", "missing", "user").Return(repository.ErrNotFound)
 
-	token := "next-token"
-	mockResult := &repository.PaginatedResult{
-		Records:               mockRecords,
-		NextContinuationToken: &token,
-	}
+	c, w := setupGinContext("DELETE", "/api/v1/records/user/missing", nil)
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}, {Key: "resource_id", Value: "missing"}}
+	handler.DeleteRecord(c)
 
-	mockRepo.On("GetPaginated", "", 5).Return(mockResult, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error":"Record not found"}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
 
-	c, w := setupGinContext("GET", "/api/v1/records/paginated", nil)
-	handler.GetRecordsPaginated(c)
+func TestDeleteRecord_RepositoryError(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
 
-	assert.Equal(t, http.StatusOK, w.Code)
+	mockRepo.On("Delete", "user-123", "user").Return(errors.New("database error"))
 
-	var response repository.PaginatedResult
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.Len(t, response.Records, 1)
-	assert.NotNil(t, response.NextContinuationToken)
-	assert.Equal(t, "next-token", *response.NextContinuationToken)
+	c, w := setupGinContext("DELETE", "/api/v1/records/user/user-123", nil)
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}, {Key: "resource_id", Value: "user-123"}}
+	handler.DeleteRecord(c)
 
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	mockRepo.AssertExpectations(t)
 }
 
-func TestGetRecordsPaginated_WithCustomPageSize(t *testing.T) {
+func TestReplaceRecordsOfType_Success(t *testing.T) {
 	handler, mockRepo := setupTestHandler()
 
-	mockResult := &repository.PaginatedResult{
-		Records:               []repository.Record{},
-		NextContinuationToken: nil,
+	ctx := `{"name":"Alice"}`
+	expected := []repository.Record{
+		{ResourceID: "user-1", ResourceType: "user", Context: &ctx},
+		{ResourceID: "user-2", ResourceType: "user", Metadata: map[string]string{"tier": "gold"}},
 	}
+	mockRepo.On("ReplaceByType", "user", expected).Return(nil)
 
-	mockRepo.On("GetPaginated", "", 10).Return(mockResult, nil)
-
-	c, w := setupGinContext("GET", "/api/v1/records/paginated?page_size=10", nil)
-	handler.GetRecordsPaginated(c)
+	body := map[string]any{"records": []map[string]any{
+		{"resource_id": "user-1", "context": ctx},
+		{"resource_id": "user-2", "metadata": map[string]string{"tier": "gold"}},
+	}}
+	c, w := setupGinContext("PUT", "/api/v1/types/user/records", body)
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}}
+	handler.ReplaceRecordsOfType(c)
 
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"message":"Records replaced successfully","resource_type":"user","count":2}`, w.Body.String())
+
 	mockRepo.AssertExpectations(t)
 }
 
-func TestGetRecordsPaginated_WithContinuationToken(t *testing.T) {
+func TestReplaceRecordsOfType_EmptySet(t *testing.T) {
 	handler, mockRepo := setupTestHandler()
 
-	token := "test-token"
-	mockResult := &repository.PaginatedResult{
-		Records:               []repository.Record{},
-		NextContinuationToken: nil,
-	}
-
-	mockRepo.On("GetPaginated", token, 5).Return(mockResult, nil)
+	mockRepo.On("ReplaceByType", "user", []repository.Record{}).Return(nil)
 
-	c, w := setupGinContext("GET", "/api/v1/records/paginated?continuation_token="+token, nil)
-	handler.GetRecordsPaginated(c)
+	c, w := setupGinContext("PUT", "/api/v1/types/user/records", map[string]any{"records": []any{}})
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}}
+	handler.ReplaceRecordsOfType(c)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 	mockRepo.AssertExpectations(t)
 }
 
-func TestGetRecordsPaginated_InvalidPageSize(t *testing.T) {
-	handler, mockRepo := setupTestHandler()
+func TestReplaceRecordsOfType_InvalidBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body any
+		want string
+	}{
+		{name: "missing records", body: map[string]any{}, want: "Records"},
+		{name: "missing resource_id", body: map[string]any{"records": []map[string]any{{"context": "x"}}}, want: "ResourceID"},
+		{name: "duplicate resource_id", body: map[string]any{"records": []map[string]any{{"resource_id": "user-1"}, {"resource_id": "user-1"}}}, want: "duplicate resource_id 'user-1'"},
+	}
 
-	mockResult := &repository.PaginatedResult{
-		Records:               []repository.Record{},
-		NextContinuationToken: nil,
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, mockRepo := setupTestHandler()
+
+			c, w := setupGinContext("PUT", "/api/v1/types/user/records", tt.body)
+			c.Params = gin.Params{{Key: "resource_type", Value: "user"}}
+			handler.ReplaceRecordsOfType(c)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tt.want)
+			mockRepo.AssertNotCalled(t, "ReplaceByType", mock.Anything, mock.Anything)
+		})
 	}
+}
 
-	// Should default to 5 when invalid page size is provided
-	mockRepo.On("GetPaginated", "", 5).Return(mockResult, nil)
+func TestReplaceRecordsOfType_RepositoryError(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
 
-	c, w := setupGinContext("GET", "/api/v1/records/paginated?page_size=invalid", nil)
-	handler.GetRecordsPaginated(c)
+	mockRepo.On("ReplaceByType", "user", mock.Anything).Return(errors.New("database error"))
 
-	assert.Equal(t, http.StatusOK, w.Code)
+	body := map[string]any{"records": []map[string]any{{"resource_id": "user-1"}}}
+	c, w := setupGinContext("PUT", "/api/v1/types/user/records", body)
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}}
+	handler.ReplaceRecordsOfType(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "Failed to replace records")
 	mockRepo.AssertExpectations(t)
 }
 
-func TestGetRecordsPaginated_PageSizeLimit(t *testing.T) {
+func TestReplaceRecordsOfType_CheckOnly(t *testing.T) {
 	handler, mockRepo := setupTestHandler()
 
-	mockResult := &repository.PaginatedResult{
-		Records:               []repository.Record{},
-		NextContinuationToken: nil,
+	keys := []repository.RecordKey{
+		{ResourceType: "user", ResourceID: "user-1"},
+		{ResourceType: "user", ResourceID: "user-2"},
+		{ResourceType: "user", ResourceID: "user-3"},
 	}
+	mockRepo.On("ExistingKeys", keys).Return([]repository.RecordKey{keys[0], keys[2]}, nil)
 
-	// Should cap at 100 when page size exceeds limit
-	mockRepo.On("GetPaginated", "", 100).Return(mockResult, nil)
-
-	c, w := setupGinContext("GET", "/api/v1/records/paginated?page_size=150", nil)
-	handler.GetRecordsPaginated(c)
+	body := map[string]any{"records": []map[string]any{{"resource_id": "user-1"}, {"resource_id": "user-2"}, {"resource_id": "user-3"}}}
+	c, w := setupGinContext("PUT", "/api/v1/types/user/records?check_only=true", body)
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}}
+	handler.ReplaceRecordsOfType(c)
 
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"message": "Records are valid, nothing was written",
+		"check_only": true,
+		"resource_type": "user",
+		"count": 3,
+		"conflicts": [
+			{"resource_type": "user", "resource_id": "user-1"},
+			{"resource_type": "user", "resource_id": "user-3"}
+		]
+	}`, w.Body.String())
 	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "ReplaceByType", mock.Anything, mock.Anything)
 }
 
-func TestGetRecordsPaginated_RepositoryError(t *testing.T) {
+func TestReplaceRecordsOfType_CheckOnlyValidates(t *testing.T) {
 	handler, mockRepo := setupTestHandler()
 
-	mockRepo.On("GetPaginated", "", 5).Return((*repository.PaginatedResult)(nil), errors.New("invalid token"))
-
-	c, w := setupGinContext("GET", "/api/v1/records/paginated", nil)
-	handler.GetRecordsPaginated(c)
+	body := map[string]any{"records": []map[string]any{{"resource_id": "user-1"}, {"resource_id": "user-1"}}}
+	c, w := setupGinContext("PUT", "/api/v1/types/user/records?check_only=true", body)
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}}
+	handler.ReplaceRecordsOfType(c)
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "duplicate resource_id 'user-1'")
+	mockRepo.AssertNotCalled(t, "ExistingKeys", mock.Anything)
+}
 
-	var response map[string]any
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.Contains(t, response["error"], "invalid token")
+func TestReplaceRecordsOfType_CheckOnlyError(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
 
-	mockRepo.AssertExpectations(t)
+	mockRepo.On("ExistingKeys", mock.Anything).Return(nil, errors.New("database error"))
+
+	body := map[string]any{"records": []map[string]any{{"resource_id": "user-1"}}}
+	c, w := setupGinContext("PUT", "/api/v1/types/user/records?check_only=true", body)
+	c.Params = gin.Params{{Key: "resource_type", Value: "user"}}
+	handler.ReplaceRecordsOfType(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "Failed to check for existing records")
+	mockRepo.AssertNotCalled(t, "ReplaceByType", mock.Anything, mock.Anything)
 }
 
 func TestCreateRecordFromQuery_Success(t *testing.T) {
@@ -418,7 +2381,114 @@ func TestCreateRecordFromQuery_RepositoryError(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestGetRecordsByKeys_Success(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	keys := []repository.RecordKey{
+		{ResourceType: "user", ResourceID: "u1"},
+		{ResourceType: "user", ResourceID: "u2"},
+	}
+	found := []repository.Record{{ResourceID: "u1", ResourceType: "user"}}
+	missing := []repository.RecordKey{{ResourceType: "user", ResourceID: "u2"}}
+
+	mockRepo.On("GetByKeys", keys).Return(found, missing, nil)
+
+	c, w := setupGinContext("POST", "/api/v1/records/get", GetRecordsByKeysRequest{Keys: keys})
+	handler.GetRecordsByKeys(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Records []repository.Record    `json:"records"`
+		Missing []repository.RecordKey `json:"missing"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Len(t, response.Records, 1)
+	assert.Equal(t, "u1", response.Records[0].ResourceID)
+	assert.Equal(t, missing, response.Missing)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsByKeys_EmptyKeys(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("POST", "/api/v1/records/get", GetRecordsByKeysRequest{Keys: []repository.RecordKey{}})
+	handler.GetRecordsByKeys(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsByKeys_TooManyKeys(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	keys := make([]repository.RecordKey, maxMultiGetKeys+1)
+	for i := range keys {
+		keys[i] = repository.RecordKey{ResourceType: "user", ResourceID: "u"}
+	}
+
+	c, w := setupGinContext("POST", "/api/v1/records/get", GetRecordsByKeysRequest{Keys: keys})
+	handler.GetRecordsByKeys(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsByKeys_KeyMissingField(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	body := GetRecordsByKeysRequest{Keys: []repository.RecordKey{{ResourceType: "user"}}}
+
+	c, w := setupGinContext("POST", "/api/v1/records/get", body)
+	handler.GetRecordsByKeys(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetRecordsByKeys_RepositoryError(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	keys := []repository.RecordKey{{ResourceType: "user", ResourceID: "u1"}}
+	mockRepo.On("GetByKeys", keys).Return(nil, nil, errors.New("database error"))
+
+	c, w := setupGinContext("POST", "/api/v1/records/get", GetRecordsByKeysRequest{Keys: keys})
+	handler.GetRecordsByKeys(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
 // Helper function to create string pointers
 func stringPtr(s string) *string {
 	return &s
-}
\ No newline at end of file
+}
+
+func TestExplainPaginated(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	explained := &repository.ExplainedQuery{SQL: "SELECT resource_id FROM resource_context LIMIT ?", Args: []any{3}}
+	mockRepo.On("ExplainPaginated", "token-1", 2).Return(explained, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated/explain?continuation_token=token-1&page_size=2", nil)
+	handler.ExplainPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"sql":"SELECT resource_id FROM resource_context LIMIT ?","args":[3]}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestExplainPaginated_InvalidToken(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	mockRepo.On("ExplainPaginated", "bad", 5).Return(nil, errors.New("invalid continuation token format"))
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated/explain?continuation_token=bad", nil)
+	handler.ExplainPaginated(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid continuation token format")
+	mockRepo.AssertExpectations(t)
+}
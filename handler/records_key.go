@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Keys of the record array of the listings, accepted by the records_key query
+// parameter and SetRecordsKey.
+const (
+	RecordsKeyRecords = "records"
+	RecordsKeyData    = "data"
+	RecordsKeyItems   = "items"
+)
+
+// SetRecordsKey sets the key under which GetRecords and GetRecordsPaginated
+// return the record array when a request has no records_key query parameter, so
+// that client libraries expecting data or items work unchanged. Empty selects
+// RecordsKeyRecords.
+func (h *RecordHandler) SetRecordsKey(key string) {
+	h.recordsKey = key
+}
+
+// parseRecordsKey returns the key of the record array for the request, from the
+// records_key query parameter or the handler's default. When the parameter is
+// invalid a 400 response has already been written and ok is false.
+func (h *RecordHandler) parseRecordsKey(c *gin.Context) (key string, ok bool) {
+	key = c.Query("records_key")
+	switch key {
+	case "":
+		if h.recordsKey == "" {
+			return RecordsKeyRecords, true
+		}
+		return h.recordsKey, true
+	case RecordsKeyRecords, RecordsKeyData, RecordsKeyItems:
+		return key, true
+	}
+	respondBadRequest(c, &ParamError{Param: "records_key", Value: key, Reason: "must be records, data or items"})
+	return "", false
+}
+
+// renameRecordsKey returns obj as a JSON value whose top-level records key is
+// renamed to key. obj is returned as it is when key is RecordsKeyRecords.
+func renameRecordsKey(obj any, key string) (any, error) {
+	if key == RecordsKeyRecords {
+		return obj, nil
+	}
+
+	encoded, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	// Numbers are kept as written, so large integers do not lose precision
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+	if records, found := object[RecordsKeyRecords]; found {
+		delete(object, RecordsKeyRecords)
+		object[key] = records
+	}
+	return object, nil
+}
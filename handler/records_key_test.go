@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tokenpagination/repository"
+)
+
+// recordsKeyRouter serves both listings of handler behind the naming middleware.
+func recordsKeyRouter(handler *RecordHandler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(JSONNamingMiddleware(NamingSnake))
+	r.GET("/api/v1/records", handler.GetRecords)
+	r.GET("/api/v1/records/paginated", handler.GetRecordsPaginated)
+	return r
+}
+
+// recordsKeyRecords returns the records of a listing, one of them with metadata
+// under a records key.
+func recordsKeyRecords() []repository.Record {
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	return []repository.Record{{ResourceID: "user-1", ResourceType: "user", Metadata: map[string]string{"records": "kept"}, CreatedAt: created, UpdatedAt: created}}
+}
+
+func TestRecordsKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		defaultKey string
+		query      string
+		wantKey    string
+	}{
+		{name: "default", wantKey: "records"},
+		{name: "configured", defaultKey: RecordsKeyData, wantKey: "data"},
+		{name: "query parameter", query: "records_key=items", wantKey: "items"},
+		{name: "query parameter overrides configured", defaultKey: RecordsKeyData, query: "records_key=records", wantKey: "records"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, mockRepo := setupTestHandler()
+			handler.SetRecordsKey(tt.defaultKey)
+			mockRepo.On("GetAll").Return(recordsKeyRecords(), false, nil)
+			total := int64(1000)
+			mockRepo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{Records: recordsKeyRecords(), IsLastPage: true, Total: &total}, nil)
+			r := recordsKeyRouter(handler)
+
+			// Both listings use the same key
+			for _, path := range []string{"/api/v1/records", "/api/v1/records/paginated"} {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?"+tt.query, nil))
+				require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+				var response map[string]json.RawMessage
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				require.Contains(t, response, tt.wantKey, path)
+				for _, key := range []string{"records", "data", "items"} {
+					if key != tt.wantKey {
+						assert.NotContains(t, response, key, path)
+					}
+				}
+
+				var records []repository.Record
+				require.NoError(t, json.Unmarshal(response[tt.wantKey], &records))
+				require.Len(t, records, 1)
+				assert.Equal(t, "user-1", records[0].ResourceID)
+				assert.Equal(t, map[string]string{"records": "kept"}, records[0].Metadata, "keys inside records are not renamed")
+			}
+		})
+	}
+}
+
+func TestRecordsKey_PaginatedKeepsOtherFields(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	token := "next-token"
+	total := int64(12345678901234567)
+	mockRepo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{Records: recordsKeyRecords(), NextContinuationToken: &token, PageDepth: 1, Total: &total}, nil)
+
+	w := httptest.NewRecorder()
+	recordsKeyRouter(handler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/records/paginated?records_key=data&naming=camel", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"data":[`)
+	assert.Contains(t, w.Body.String(), `"nextContinuationToken":"next-token"`)
+	assert.Contains(t, w.Body.String(), `"pageDepth":1`)
+	assert.Contains(t, w.Body.String(), `"total":12345678901234567`, "large totals keep their precision")
+}
+
+func TestRecordsKey_Invalid(t *testing.T) {
+	handler, _ := setupTestHandler()
+	r := recordsKeyRouter(handler)
+
+	for _, path := range []string{"/api/v1/records", "/api/v1/records/paginated"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?records_key=rows", nil))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		assert.JSONEq(t, `{"error":"invalid records_key 'rows': must be records, data or items","field":"records_key"}`, w.Body.String())
+	}
+}
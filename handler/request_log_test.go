@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLogger(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantLevel string
+	}{
+		{name: "success", status: http.StatusOK, wantLevel: "INFO"},
+		{name: "client error", status: http.StatusNotFound, wantLevel: "WARN"},
+		{name: "server error", status: http.StatusInternalServerError, wantLevel: "ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(RequestLogger(logger))
+			r.GET("/api/v1/records/paginated", func(c *gin.Context) {
+				c.String(tt.status, "body")
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/records/paginated?continuation_token=secret", nil)
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			var entry map[string]any
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+			assert.Equal(t, tt.wantLevel, entry["level"])
+			assert.Equal(t, "request", entry["msg"])
+			assert.Equal(t, "GET", entry["method"])
+			assert.Equal(t, "/api/v1/records/paginated", entry["path"])
+			assert.Equal(t, float64(tt.status), entry["status"])
+			assert.Equal(t, float64(len("body")), entry["bytes"])
+			assert.Contains(t, entry, "latency")
+			assert.Contains(t, entry, "client_ip")
+			assert.NotContains(t, buf.String(), "secret")
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"cmp"
+	"database/sql"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"tokenpagination/repository"
+)
+
+// respond writes obj as the JSON response body with the given status code.
+// When the request carries ?pretty=true the JSON is indented for humans reading
+// it with curl; otherwise the compact form is used. When JSONNamingMiddleware
+// selected NamingCamel the keys are renamed to camelCase.
+func respond(c *gin.Context, status int, obj any) {
+	if c.GetString(jsonNamingKey) == NamingCamel {
+		if renamed, err := camelCaseKeys(obj); err == nil {
+			obj = renamed
+		}
+	}
+
+	if c.Query("pretty") == "true" {
+		c.IndentedJSON(status, obj)
+		return
+	}
+
+	c.JSON(status, obj)
+}
+
+// recordFormat is how a read endpoint serializes records.
+type recordFormat struct {
+	timestamps  repository.TimestampFormat
+	nullContext repository.NullContext
+}
+
+// apply sets the format on a record before serialization.
+func (f recordFormat) apply(record *repository.Record) {
+	record.SetTimestampFormat(f.timestamps)
+	record.SetNullContext(f.nullContext)
+}
+
+// parseRecordFormat reads the ?timestamps= and ?null_context= query parameters of a
+// read endpoint. When a value is invalid a 400 response has already been written
+// and ok is false.
+func parseRecordFormat(c *gin.Context) (format recordFormat, ok bool) {
+	var err error
+	if format.timestamps, err = repository.ParseTimestampFormat(c.Query("timestamps")); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return format, false
+	}
+	if format.nullContext, err = repository.ParseNullContext(c.Query("null_context")); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return format, false
+	}
+	return format, true
+}
+
+// formatRecords applies the format to every record before serialization.
+func formatRecords(records []repository.Record, format recordFormat) {
+	for i := range records {
+		format.apply(&records[i])
+	}
+}
+
+// HealthCheck handles GET /health and reports that the service is up. Probes that
+// accept text/plain but not JSON get a plain "ok" line; everyone else, including
+// clients without an Accept header, gets the JSON status.
+func HealthCheck(c *gin.Context) {
+	healthCheck(c, nil)
+}
+
+// PoolStatser reports connection pool statistics; *sql.DB implements it.
+type PoolStatser interface {
+	Stats() sql.DBStats
+}
+
+// PoolStats is the connection pool section of the health payload.
+type PoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMillis int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+// NewPoolStats converts the statistics reported by database/sql.
+func NewPoolStats(stats sql.DBStats) PoolStats {
+	return PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMillis: stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+}
+
+// HealthCheckWithPool works like HealthCheck but adds the database connection pool
+// statistics to the JSON status under db_pool, so that the pool settings can be
+// checked under load: a growing wait_count means DB_MAX_OPEN_CONNS is too low, and
+// growing max_idle_closed means DB_MAX_IDLE_CONNS causes connection churn.
+func HealthCheckWithPool(db PoolStatser) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		healthCheck(c, db)
+	}
+}
+
+// healthCheck writes the health status, with the pool statistics of db if it is
+// not nil.
+func healthCheck(c *gin.Context, db PoolStatser) {
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEPlain) == gin.MIMEPlain {
+		c.String(http.StatusOK, "ok\n")
+		return
+	}
+
+	status := gin.H{"status": "healthy"}
+	if db != nil {
+		status["db_pool"] = NewPoolStats(db.Stats())
+	}
+	respond(c, http.StatusOK, status)
+}
+
+// NotFound answers requests for unknown paths with a JSON 404, so clients get the
+// same error shape as from the API endpoints. Register it with Engine.NoRoute.
+func NotFound(c *gin.Context) {
+	respond(c, http.StatusNotFound, gin.H{"error": "not found", "path": c.Request.URL.Path})
+}
+
+// MethodNotAllowed answers requests for a known path with an unsupported method
+// with a JSON 405. Register it with Engine.NoMethod and enable
+// Engine.HandleMethodNotAllowed; gin sets the Allow header before calling it.
+func MethodNotAllowed(c *gin.Context) {
+	respond(c, http.StatusMethodNotAllowed, gin.H{"error": "method not allowed", "path": c.Request.URL.Path})
+}
+
+// Endpoint is one route listed by the root index.
+type Endpoint struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// RouteIndex returns a handler listing every route registered on r, sorted by
+// path and method, so that someone opening the service root in a browser can
+// discover the API. The list is read from the router on each request, so it
+// always matches what is served.
+func RouteIndex(r *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		routes := r.Routes()
+		endpoints := make([]Endpoint, len(routes))
+		for i, route := range routes {
+			endpoints[i] = Endpoint{Method: route.Method, Path: route.Path}
+		}
+		slices.SortFunc(endpoints, func(a, b Endpoint) int {
+			if a.Path != b.Path {
+				return cmp.Compare(a.Path, b.Path)
+			}
+			return cmp.Compare(a.Method, b.Method)
+		})
+
+		respond(c, http.StatusOK, gin.H{"endpoints": endpoints})
+	}
+}
+
+// RegisterFallbacks makes r answer unknown paths and unsupported methods with the
+// JSON NotFound and MethodNotAllowed responses instead of gin's plain-text defaults.
+func RegisterFallbacks(r *gin.Engine) {
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(NotFound)
+	r.NoMethod(MethodNotAllowed)
+}
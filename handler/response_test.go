@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"tokenpagination/repository"
+)
+
+func TestRespond_PrettyAndCompactMatch(t *testing.T) {
+	now := time.Unix(1234567890, 0).UTC()
+	records := []repository.Record{
+		{ResourceID: "user-1", ResourceType: "user", Context: stringPtr(`{"a": 1}`), CreatedAt: now, UpdatedAt: now},
+	}
+
+	handler, mockRepo := setupTestHandler()
+	mockRepo.On("GetAll").Return(records, false, nil)
+
+	c, compact := setupGinContext("GET", "/api/v1/records", nil)
+	handler.GetRecords(c)
+
+	c, pretty := setupGinContext("GET", "/api/v1/records?pretty=true", nil)
+	handler.GetRecords(c)
+
+	assert.Equal(t, http.StatusOK, compact.Code)
+	assert.Equal(t, http.StatusOK, pretty.Code)
+
+	assert.NotContains(t, compact.Body.String(), "\n")
+	assert.True(t, strings.Contains(pretty.Body.String(), "\n    "), "pretty output should be indented")
+
+	var compactBody, prettyBody map[string]any
+	require.NoError(t, json.Unmarshal(compact.Body.Bytes(), &compactBody))
+	require.NoError(t, json.Unmarshal(pretty.Body.Bytes(), &prettyBody))
+	assert.Equal(t, compactBody, prettyBody)
+}
+
+func TestRespond_PrettyPaginated(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	mockRepo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{Records: []repository.Record{}, PageDepth: 1}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?pretty=true", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "{\n    \"records\": []")
+}
+
+func TestGetRecordsPaginated_EpochMillisTimestamps(t *testing.T) {
+	created := time.UnixMilli(1705311900123).In(time.FixedZone("odd", 5*3600+45*60))
+	handler, mockRepo := setupTestHandler()
+	mockRepo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{
+		Records:   []repository.Record{{ResourceID: "user-1", ResourceType: "user", CreatedAt: created, UpdatedAt: created}},
+		PageDepth: 1,
+	}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?timestamps=epoch_ms", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"created_at":1705311900123,"updated_at":1705311900123`)
+}
+
+func TestGetRecords_TimestampsDefaultToUTC(t *testing.T) {
+	created := time.Date(2024, 1, 15, 15, 30, 0, 0, time.FixedZone("odd", 5*3600+45*60))
+	handler, mockRepo := setupTestHandler()
+	mockRepo.On("GetAll").Return([]repository.Record{{ResourceID: "user-1", ResourceType: "user", CreatedAt: created, UpdatedAt: created}}, false, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records", nil)
+	handler.GetRecords(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"created_at":"2024-01-15T09:45:00Z"`)
+}
+
+func TestGetRecordsPaginated_InvalidTimestamps(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?timestamps=unix", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "must be rfc3339 or epoch_ms")
+	mockRepo.AssertNotCalled(t, "GetPaginated", mock.Anything, mock.Anything)
+}
+
+func TestGetRecordsPaginated_NullContext(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{name: "default omits", query: "", want: false},
+		{name: "omit", query: "?null_context=omit", want: false},
+		{name: "explicit", query: "?null_context=explicit", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, mockRepo := setupTestHandler()
+			mockRepo.On("GetPaginated", "", 5).Return(&repository.PaginatedResult{
+				Records:   []repository.Record{{ResourceID: "user-1", ResourceType: "user"}},
+				PageDepth: 1,
+			}, nil)
+
+			c, w := setupGinContext("GET", "/api/v1/records/paginated"+tt.query, nil)
+			handler.GetRecordsPaginated(c)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			if tt.want {
+				assert.Contains(t, w.Body.String(), `"context":null`)
+			} else {
+				assert.NotContains(t, w.Body.String(), `"context"`)
+			}
+		})
+	}
+}
+
+func TestGetRecordsPaginated_InvalidNullContext(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	c, w := setupGinContext("GET", "/api/v1/records/paginated?null_context=always", nil)
+	handler.GetRecordsPaginated(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "must be explicit or omit")
+	mockRepo.AssertNotCalled(t, "GetPaginated", mock.Anything, mock.Anything)
+}
+
+func TestHealthCheck(t *testing.T) {
+	c, w := setupGinContext("GET", "/health", nil)
+	HealthCheck(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status": "healthy"}`, w.Body.String())
+
+	c, w = setupGinContext("GET", "/health?pretty=true", nil)
+	HealthCheck(c)
+
+	assert.Equal(t, "{\n    \"status\": \"healthy\"\n}", w.Body.String())
+}
+
+// fixedPoolStats reports the same pool statistics on every call.
+type fixedPoolStats sql.DBStats
+
+func (s fixedPoolStats) Stats() sql.DBStats { return sql.DBStats(s) }
+
+func TestHealthCheckWithPool(t *testing.T) {
+	stats := fixedPoolStats{
+		MaxOpenConnections: 25,
+		OpenConnections:    7,
+		InUse:              5,
+		Idle:               2,
+		WaitCount:          3,
+		WaitDuration:       1500 * time.Millisecond,
+		MaxIdleClosed:      4,
+		MaxLifetimeClosed:  9,
+	}
+
+	c, w := setupGinContext("GET", "/health", nil)
+	HealthCheckWithPool(stats)(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"status": "healthy",
+		"db_pool": {
+			"max_open_connections": 25, "open_connections": 7, "in_use": 5, "idle": 2,
+			"wait_count": 3, "wait_duration_ms": 1500,
+			"max_idle_closed": 4, "max_idle_time_closed": 0, "max_lifetime_closed": 9
+		}
+	}`, w.Body.String())
+
+	c, w = setupGinContext("GET", "/health", nil)
+	c.Request.Header.Set("Accept", "text/plain")
+	HealthCheckWithPool(stats)(c)
+	assert.Equal(t, "ok\n", w.Body.String())
+}
+
+func TestHealthCheck_AcceptHeader(t *testing.T) {
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{accept: "text/plain", contentType: "text/plain; charset=utf-8", body: "ok\n"},
+		{accept: "text/plain;q=0.9, */*;q=0.1", contentType: "text/plain; charset=utf-8", body: "ok\n"},
+		{accept: "application/json", contentType: "application/json; charset=utf-8", body: `{"status":"healthy"}`},
+		{accept: "*/*", contentType: "application/json; charset=utf-8", body: `{"status":"healthy"}`},
+		{accept: "", contentType: "application/json; charset=utf-8", body: `{"status":"healthy"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			c, w := setupGinContext("GET", "/health", nil)
+			if tt.accept != "" {
+				c.Request.Header.Set("Accept", tt.accept)
+			}
+			HealthCheck(c)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.body, w.Body.String())
+		})
+	}
+}
+
+func TestRouteIndex(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", RouteIndex(r))
+	r.POST("/api/v1/records", func(c *gin.Context) {})
+	r.GET("/api/v1/records/paginated", func(c *gin.Context) {})
+	r.GET("/api/v1/records", func(c *gin.Context) {})
+	r.GET("/health", func(c *gin.Context) {})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"endpoints": [
+		{"method": "GET", "path": "/"},
+		{"method": "GET", "path": "/api/v1/records"},
+		{"method": "POST", "path": "/api/v1/records"},
+		{"method": "GET", "path": "/api/v1/records/paginated"},
+		{"method": "GET", "path": "/health"}
+	]}`, w.Body.String())
+}
+
+func TestRegisterFallbacks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterFallbacks(r)
+	r.GET("/api/v1/records", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/api/v1/records", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	t.Run("unknown path", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/nope?pretty=false", nil))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"error":"not found","path":"/api/v1/nope"}`, w.Body.String())
+	})
+
+	t.Run("wrong method", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/records", nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "GET, POST", w.Header().Get("Allow"))
+		assert.JSONEq(t, `{"error":"method not allowed","path":"/api/v1/records"}`, w.Body.String())
+	})
+}
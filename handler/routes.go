@@ -0,0 +1,28 @@
+package handler
+
+import "github.com/gin-gonic/gin"
+
+// RegisterRecordRoutes adds the public record endpoints of h to api, the group
+// serving /api/v1, so that the service and client/fake serve the same routes.
+// The admin endpoints are not included.
+func RegisterRecordRoutes(api *gin.RouterGroup, h *RecordHandler) {
+	api.POST("/records", RequireJSON(), h.CreateRecord)
+	api.GET("/records", h.GetRecords)
+	api.GET("/records/paginated", h.GetRecordsPaginated)
+	api.GET("/records/export.sql", h.ExportSQL)
+	api.GET("/records/all-pages", h.StreamAllPages)
+	api.GET("/records/grouped", h.GetGroupedRecords)
+	api.GET("/records/activity", h.GetActivityFeed)
+	api.GET("/records/search", h.SearchRecords)
+	api.GET("/records/missing-context", h.GetRecordsMissingContext)
+	api.GET("/records/newer", h.GetNewerRecords)
+	api.GET("/records/stream/live", h.StreamLive)
+	api.GET("/records/stats/daily", h.GetDailyStats)
+	api.POST("/records/create", h.CreateRecordFromQuery)
+	api.POST("/records/get", RequireJSON(), h.GetRecordsByKeys)
+	api.POST("/records/auto", RequireJSON(), h.CreateRecordAuto)
+	api.GET("/records/:resource_type/:resource_id", h.GetRecord)
+	api.DELETE("/records/:resource_type/:resource_id", h.DeleteRecord)
+	api.POST("/records/:resource_type/:resource_id/touch", h.TouchRecord)
+	api.PUT("/types/:resource_type/records", RequireJSON(), h.ReplaceRecordsOfType)
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"tokenpagination/repository"
+)
+
+// sqlDumpTimeFormat formats timestamps as MySQL DATETIME literals with
+// microsecond precision.
+const sqlDumpTimeFormat = "2006-01-02 15:04:05.000000"
+
+// sqlDumpPreamble sets the session up for the statements that follow: the string
+// literals are UTF-8 and the timestamps, written in UTC, are read as UTC. Without
+// it a session in another time zone would shift every timestamp on restore,
+// reordering the records and invalidating the continuation tokens issued for them.
+const sqlDumpPreamble = "SET NAMES utf8mb4;\nSET time_zone = '+00:00';\n"
+
+// sqlStringEscaper escapes the characters that are special inside a MySQL string
+// literal with the default sql_mode.
+var sqlStringEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"'", "\\'",
+	"\"", "\\\"",
+	"\x00", "\\0",
+	"\n", "\\n",
+	"\r", "\\r",
+	"\x1a", "\\Z",
+)
+
+// ExportSQL handles GET /api/v1/records/export.sql, streaming every record as an
+// INSERT INTO resource_context statement for restoring into another MySQL or
+// MariaDB instance. Records are written as they are read, so the table is never
+// held in memory. The INSERT statements are preceded by the session settings of
+// sqlDumpPreamble. Records of types routed to shard tables are exported into
+// resource_context as well. If reading fails after the dump has started, the
+// status can no longer change, so the dump ends with an "-- export incomplete"
+// comment instead.
+func (h *RecordHandler) ExportSQL(c *gin.Context) {
+	c.Header("Content-Type", "application/sql; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="records.sql"`)
+
+	w := bufio.NewWriter(c.Writer)
+	err := h.repo.ForEach(func(record repository.Record) error {
+		// Written with the first record, so that a failure before any can still be
+		// reported as JSON
+		if w.Buffered() == 0 && !c.Writer.Written() {
+			if _, err := w.WriteString(sqlDumpPreamble); err != nil {
+				return err
+			}
+		}
+		_, err := w.WriteString(sqlInsertStatement(record))
+		return err
+	})
+	if err != nil && !c.Writer.Written() && w.Buffered() == 0 {
+		// Nothing was sent yet, so the failure can still be reported as JSON
+		c.Header("Content-Type", "")
+		c.Header("Content-Disposition", "")
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to export records"})
+		return
+	}
+	if err != nil {
+		w.WriteString("-- export incomplete: failed to read records\n")
+	}
+	w.Flush()
+}
+
+// sqlInsertStatement returns the INSERT statement restoring record, terminated by a
+// newline.
+func sqlInsertStatement(record repository.Record) string {
+	var b strings.Builder
+	b.WriteString("INSERT INTO resource_context (resource_id, resource_type, context, created_at, updated_at, metadata) VALUES (")
+	b.WriteString(sqlString(record.ResourceID))
+	b.WriteString(", ")
+	b.WriteString(sqlString(record.ResourceType))
+	b.WriteString(", ")
+	b.WriteString(sqlNullableString(record.Context))
+	b.WriteString(", ")
+	b.WriteString(sqlTime(record.CreatedAt))
+	b.WriteString(", ")
+	b.WriteString(sqlTime(record.UpdatedAt))
+	b.WriteString(", ")
+	b.WriteString(sqlMetadata(record.Metadata))
+	b.WriteString(");\n")
+	return b.String()
+}
+
+// sqlString quotes value as a MySQL string literal.
+func sqlString(value string) string {
+	return "'" + sqlStringEscaper.Replace(value) + "'"
+}
+
+// sqlNullableString quotes value as a MySQL string literal, or NULL when nil.
+func sqlNullableString(value *string) string {
+	if value == nil {
+		return "NULL"
+	}
+	return sqlString(*value)
+}
+
+// sqlTime formats t in UTC as a MySQL DATETIME literal.
+func sqlTime(t time.Time) string {
+	return "'" + t.UTC().Format(sqlDumpTimeFormat) + "'"
+}
+
+// sqlMetadata encodes metadata as a JSON string literal, or NULL when empty, as
+// the repository stores it.
+func sqlMetadata(metadata map[string]string) string {
+	if len(metadata) == 0 {
+		return "NULL"
+	}
+	// Marshaling a map[string]string cannot fail
+	encoded, _ := json.Marshal(metadata)
+	return sqlString(string(encoded))
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"tokenpagination/repository"
+)
+
+func TestExportSQL(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+
+	created := time.Date(2024, 3, 1, 12, 30, 45, 123456000, time.UTC)
+	context := `{"note":"it's a \"quoted\" value\n"}`
+	mockRepo.On("ForEach").Return([]repository.Record{
+		{ResourceID: "user-1", ResourceType: "user", Context: &context, Metadata: map[string]string{"source": "import"}, CreatedAt: created, UpdatedAt: created},
+		{ResourceID: "user-2", ResourceType: "user", CreatedAt: created, UpdatedAt: created},
+	}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/export.sql", nil)
+	handler.ExportSQL(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/sql; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="records.sql"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t,
+		"SET NAMES utf8mb4;\n"+
+			"SET time_zone = '+00:00';\n"+
+			`INSERT INTO resource_context (resource_id, resource_type, context, created_at, updated_at, metadata) VALUES ('user-1', 'user', '{\"note\":\"it\'s a \\\"quoted\\\" value\\n\"}', '2024-03-01 12:30:45.123456', '2024-03-01 12:30:45.123456', '{\"source\":\"import\"}');`+"\n"+
+			`INSERT INTO resource_context (resource_id, resource_type, context, created_at, updated_at, metadata) VALUES ('user-2', 'user', NULL, '2024-03-01 12:30:45.123456', '2024-03-01 12:30:45.123456', NULL);`+"\n",
+		w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestExportSQL_Empty(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	mockRepo.On("ForEach").Return([]repository.Record{}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/export.sql", nil)
+	handler.ExportSQL(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestExportSQL_Error(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	mockRepo.On("ForEach").Return([]repository.Record{}, assert.AnError)
+
+	c, w := setupGinContext("GET", "/api/v1/records/export.sql", nil)
+	handler.ExportSQL(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
+	assert.JSONEq(t, `{"error":"Failed to export records"}`, w.Body.String())
+}
+
+func TestExportSQL_ErrorAfterRecords(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	mockRepo.On("ForEach").Return([]repository.Record{{ResourceID: "user-1", ResourceType: "user"}}, assert.AnError)
+
+	c, w := setupGinContext("GET", "/api/v1/records/export.sql", nil)
+	handler.ExportSQL(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "VALUES ('user-1', 'user', NULL")
+	assert.Contains(t, w.Body.String(), "-- export incomplete: failed to read records\n")
+}
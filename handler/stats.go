@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"tokenpagination/repository"
+)
+
+// maxStatsDays is the longest range, in days, that the daily statistics cover in
+// one request.
+const maxStatsDays = 366
+
+// DailyStats is the response of GET /api/v1/records/stats/daily.
+type DailyStats struct {
+	From string                `json:"from"`
+	To   string                `json:"to"`
+	Days []repository.DayCount `json:"days"`
+}
+
+// parseStatsRange reads the from and to query parameters, dates in YYYY-MM-DD form
+// that both belong to the range. from may not be after to, and the range may not
+// span more than maxStatsDays days.
+func parseStatsRange(c *gin.Context) (from, to time.Time, err error) {
+	parse := func(key string) (time.Time, error) {
+		value := c.Query(key)
+		if value == "" {
+			return time.Time{}, fmt.Errorf("%s is required", key)
+		}
+		date, err := time.Parse(repository.DateFormat, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s must be a date in YYYY-MM-DD form, got '%s'", key, value)
+		}
+		return date, nil
+	}
+
+	if from, err = parse("from"); err != nil {
+		return from, to, err
+	}
+	if to, err = parse("to"); err != nil {
+		return from, to, err
+	}
+
+	if to.Before(from) {
+		return from, to, fmt.Errorf("from must not be after to")
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > maxStatsDays {
+		return from, to, fmt.Errorf("the range spans %d days, the limit is %d", days, maxStatsDays)
+	}
+	return from, to, nil
+}
+
+// GetDailyStats handles GET /api/v1/records/stats/daily?from=2024-01-01&to=2024-01-31,
+// counting the records created on each day of the range, both dates included, for
+// trend charts. Days are ordered by date and days without records are omitted.
+func (h *RecordHandler) GetDailyStats(c *gin.Context) {
+	from, to, err := parseStatsRange(c)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	days, err := h.repo.CountByDay(from, to.AddDate(0, 0, 1))
+	if err != nil {
+		if h.serveCached(c) {
+			return
+		}
+		respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to count records"})
+		return
+	}
+
+	h.respondRead(c, DailyStats{From: from.Format(repository.DateFormat), To: to.Format(repository.DateFormat), Days: days})
+}
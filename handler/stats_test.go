@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"tokenpagination/repository"
+)
+
+func TestGetDailyStats(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC)
+	mockRepo.On("CountByDay", from, to).Return([]repository.DayCount{{Date: "2024-01-01", Count: 3}, {Date: "2024-01-03", Count: 12}}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/stats/daily?from=2024-01-01&to=2024-01-03", nil)
+	handler.GetDailyStats(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"from":"2024-01-01","to":"2024-01-03","days":[{"date":"2024-01-01","count":3},{"date":"2024-01-03","count":12}]}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetDailyStats_NoRecords(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	mockRepo.On("CountByDay", mock.Anything, mock.Anything).Return([]repository.DayCount{}, nil)
+
+	c, w := setupGinContext("GET", "/api/v1/records/stats/daily?from=2024-01-01&to=2024-01-01", nil)
+	handler.GetDailyStats(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"from":"2024-01-01","to":"2024-01-01","days":[]}`, w.Body.String())
+}
+
+func TestGetDailyStats_InvalidRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{name: "missing from", query: "to=2024-01-31", wantErr: "from is required"},
+		{name: "missing to", query: "from=2024-01-01", wantErr: "to is required"},
+		{name: "timestamp", query: "from=2024-01-01T00:00:00Z&to=2024-01-31", wantErr: "from must be a date in YYYY-MM-DD form, got '2024-01-01T00:00:00Z'"},
+		{name: "invalid date", query: "from=2024-01-01&to=2024-02-30", wantErr: "to must be a date in YYYY-MM-DD form, got '2024-02-30'"},
+		{name: "reversed", query: "from=2024-02-01&to=2024-01-31", wantErr: "from must not be after to"},
+		{name: "too long", query: "from=2023-01-01&to=2024-01-02", wantErr: "the range spans 367 days, the limit is 366"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, mockRepo := setupTestHandler()
+
+			c, w := setupGinContext("GET", "/api/v1/records/stats/daily?"+tt.query, nil)
+			handler.GetDailyStats(c)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.JSONEq(t, `{"error":"`+tt.wantErr+`"}`, w.Body.String())
+			mockRepo.AssertNotCalled(t, "CountByDay", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestGetDailyStats_RepositoryError(t *testing.T) {
+	handler, mockRepo := setupTestHandler()
+	mockRepo.On("CountByDay", mock.Anything, mock.Anything).Return(nil, assert.AnError)
+
+	c, w := setupGinContext("GET", "/api/v1/records/stats/daily?from=2024-01-01&to=2024-01-31", nil)
+	handler.GetDailyStats(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error":"Failed to count records"}`, w.Body.String())
+}
@@ -0,0 +1,130 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"testing"
+
+	"tokenpagination/repository"
+	"tokenpagination/testutil"
+)
+
+// Benchmarks against MariaDB, run without the tests with
+//
+//	go test -tags integration -run '^$' -bench . -benchmem ./integration/
+//
+// BenchmarkGetPaginated grows the table to a million records, which takes a few
+// minutes to insert.
+
+// benchTableSizes are the table sizes BenchmarkGetPaginated reads pages from.
+var benchTableSizes = []int{10000, 100000, 1000000}
+
+// benchPageSize is the page size of the paginated reads, the largest the API
+// serves.
+const benchPageSize = 100
+
+// growTable imports the next records of factory until the table holds rows
+// records, given that it holds stored.
+func growTable(b *testing.B, repo *repository.RecordRepository, factory *testutil.RecordFactory, stored, rows int) {
+	b.Helper()
+	for from := stored; from < rows; from += 10000 {
+		if err := repo.ImportBatch(generate(factory, min(10000, rows-from)), repository.ImportSkip, nil); err != nil {
+			b.Fatalf("seeding %d records: %v", rows, err)
+		}
+	}
+}
+
+// tokenAt returns the continuation token of the page starting after offset
+// records, found by walking the listing in large pages.
+func tokenAt(b *testing.B, repo *repository.RecordRepository, offset int) string {
+	b.Helper()
+	token := ""
+	for walked := 0; walked < offset; {
+		result, err := repo.GetPaginated(token, min(10000, offset-walked))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if result.NextContinuationToken == nil {
+			b.Fatalf("the listing ended before offset %d", offset)
+		}
+		walked += len(result.Records)
+		token = *result.NextContinuationToken
+	}
+	return token
+}
+
+// BenchmarkGetPaginated reads the first page and a page 90% into the listing at
+// every table size. With keyset pagination both should cost about the same,
+// whatever the size.
+func BenchmarkGetPaginated(b *testing.B) {
+	repo := setupRepo(b)
+	repo.SetMaxPageDepth(0)
+
+	factory := newFactory()
+	stored := 0
+	for _, rows := range benchTableSizes {
+		growTable(b, repo, factory, stored, rows)
+		stored = rows
+
+		pages := map[string]string{"first": "", "deep": tokenAt(b, repo, rows*9/10)}
+		for _, page := range []string{"first", "deep"} {
+			token := pages[page]
+			b.Run(fmt.Sprintf("rows=%d/%s", rows, page), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					result, err := repo.GetPaginated(token, benchPageSize)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if len(result.Records) != benchPageSize {
+						b.Fatalf("read %d records, want %d", len(result.Records), benchPageSize)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkInsert compares storing records one INSERT at a time with InsertBatch.
+// An operation is one record in both.
+func BenchmarkInsert(b *testing.B) {
+	repo := setupRepo(b)
+
+	// next numbers the records across runs, so that no key is inserted twice
+	next := 0
+	records := func(n int) []repository.Record {
+		batch := make([]repository.Record, n)
+		for i := range batch {
+			batch[i] = repository.Record{ResourceID: fmt.Sprintf("bench-%09d", next), ResourceType: "bench"}
+			next++
+		}
+		return batch
+	}
+
+	b.Run("single", func(b *testing.B) {
+		b.ReportAllocs()
+		pending := records(b.N)
+		b.ResetTimer()
+		for _, record := range pending {
+			if err := repo.Insert(record.ResourceID, record.ResourceType, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	for _, batchSize := range []int{100, 1000} {
+		b.Run(fmt.Sprintf("batch=%d", batchSize), func(b *testing.B) {
+			b.ReportAllocs()
+			pending := records(b.N)
+			b.ResetTimer()
+			for len(pending) > 0 {
+				n := min(batchSize, len(pending))
+				if err := repo.InsertBatch(pending[:n], nil); err != nil {
+					b.Fatal(err)
+				}
+				pending = pending[n:]
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+//go:build integration
+
+package integration
+
+import (
+	"testing"
+
+	"tokenpagination/handler"
+	"tokenpagination/repository/repositorytest"
+)
+
+func TestContract(t *testing.T) {
+	repositorytest.RunContract(t, func(t *testing.T) handler.RecordRepositoryInterface {
+		return setupRepo(t)
+	})
+}
@@ -0,0 +1,170 @@
+//go:build integration
+
+// Package integration runs the repository against a real MariaDB server, so
+// that what the sqlmock tests only assert as SQL strings is checked as behavior:
+// timestamps as the server rounds them, duplicate keys as the server reports
+// them, and concurrent writers.
+//
+//	go test -tags integration ./integration/
+//
+// One MariaDB container is started with the docker CLI for the whole run and
+// removed afterwards. Set INTEGRATION_DSN to use an existing server instead; its
+// database is emptied by every test. Without either the tests are skipped.
+package integration
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"tokenpagination/config"
+	"tokenpagination/repository"
+)
+
+const (
+	// mariadbImage matches the image of docker-compose.yml.
+	mariadbImage    = "mariadb:10.11"
+	mariadbPassword = "integration"
+	mariadbDatabase = "tokenpagination"
+
+	// startupTimeout bounds how long the container may take to accept
+	// connections, including the first-start initialization of MariaDB.
+	startupTimeout = 90 * time.Second
+)
+
+var (
+	// testDB is the database shared by every test, nil when skipReason is set.
+	testDB     *sql.DB
+	skipReason string
+)
+
+func TestMain(m *testing.M) {
+	cleanup, err := openDatabase()
+	if err != nil {
+		skipReason = err.Error()
+	}
+	code := m.Run()
+	cleanup()
+	os.Exit(code)
+}
+
+// openDatabase connects testDB to INTEGRATION_DSN or to a new container, and
+// returns a function releasing both.
+func openDatabase() (func(), error) {
+	if dsn := os.Getenv("INTEGRATION_DSN"); dsn != "" {
+		db, err := connect(dsn)
+		if err != nil {
+			return func() {}, fmt.Errorf("connecting to INTEGRATION_DSN: %w", err)
+		}
+		testDB = db
+		return func() { db.Close() }, nil
+	}
+
+	if _, err := exec.LookPath("docker"); err != nil {
+		return func() {}, fmt.Errorf("docker is not installed and INTEGRATION_DSN is not set")
+	}
+	if _, err := docker("info"); err != nil {
+		return func() {}, fmt.Errorf("docker is not available: %w", err)
+	}
+
+	id, err := docker("run", "--detach", "--rm",
+		"--env", "MARIADB_ROOT_PASSWORD="+mariadbPassword,
+		"--env", "MARIADB_DATABASE="+mariadbDatabase,
+		"--publish", "127.0.0.1::3306",
+		mariadbImage)
+	if err != nil {
+		return func() {}, fmt.Errorf("starting %s: %w", mariadbImage, err)
+	}
+	remove := func() { docker("rm", "--force", id) }
+
+	addr, err := docker("port", id, "3306/tcp")
+	if err != nil {
+		remove()
+		return func() {}, fmt.Errorf("reading the published port: %w", err)
+	}
+	// docker port may list an address per line, one per IP family
+	host, port, err := net.SplitHostPort(strings.SplitN(addr, "\n", 2)[0])
+	if err != nil {
+		remove()
+		return func() {}, fmt.Errorf("parsing the published address '%s': %w", addr, err)
+	}
+	portNumber, _ := strconv.Atoi(port)
+
+	dsn := config.DBConfig{Host: host, Port: portNumber, User: "root", Password: mariadbPassword, Name: mariadbDatabase}.DSN()
+	db, err := connect(dsn)
+	if err != nil {
+		remove()
+		return func() {}, fmt.Errorf("connecting to the container: %w", err)
+	}
+	testDB = db
+	return func() {
+		db.Close()
+		remove()
+	}, nil
+}
+
+// connect opens dsn and waits until the server accepts connections.
+func connect(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), startupTimeout)
+	defer cancel()
+	for {
+		err = db.PingContext(ctx)
+		if err == nil {
+			return db, nil
+		}
+		select {
+		case <-ctx.Done():
+			db.Close()
+			return nil, err
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// docker runs the docker CLI and returns its trimmed output.
+func docker(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// setupRepo returns a repository on an empty resource_context table, skipping
+// the test or benchmark when no database is available.
+func setupRepo(t testing.TB) *repository.RecordRepository {
+	t.Helper()
+	if testDB == nil {
+		t.Skip(skipReason)
+	}
+
+	repo := repository.NewRecordRepository(testDB)
+	if err := repo.CreateTable(); err != nil {
+		t.Fatalf("creating the schema: %v", err)
+	}
+	if _, err := testDB.Exec("TRUNCATE TABLE resource_context"); err != nil {
+		t.Fatalf("emptying resource_context: %v", err)
+	}
+	return repo
+}
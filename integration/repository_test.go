@@ -0,0 +1,351 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tokenpagination/repository"
+	"tokenpagination/testutil"
+)
+
+// seedCount is the number of records seedRecords stores.
+const seedCount = 3000
+
+// seedRecords stores seedCount records made by newFactory.
+func seedRecords(t *testing.T, repo *repository.RecordRepository) {
+	t.Helper()
+	require.NoError(t, repo.ImportBatch(generate(newFactory(), seedCount), repository.ImportSkip, nil))
+}
+
+// newFactory returns a generator of records of three resource types. Every seven
+// consecutive records share a second of created_at and differ only in the
+// fraction the column drops, so each page boundary falls among records whose
+// stored timestamps collide and only the tiebreakers order them.
+func newFactory() *testutil.RecordFactory {
+	factory := testutil.NewRecordFactory(1)
+	factory.Start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	factory.GroupSize = 7
+	factory.Fractions = true
+	return factory
+}
+
+// generate returns the next n records of factory.
+func generate(factory *testutil.RecordFactory, n int) []repository.Record {
+	records := make([]repository.Record, n)
+	for i, r := range factory.Records(n) {
+		records[i] = repository.Record{ResourceID: r.ResourceID, ResourceType: r.ResourceType, Context: r.Context, CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt}
+	}
+	return records
+}
+
+// keyOf returns the primary key of a record as one string.
+func keyOf(record repository.Record) string {
+	return record.ResourceType + "/" + record.ResourceID
+}
+
+// requireListingOrder checks records are ordered by created_at, resource_type
+// and resource_id, all descending, with no key listed twice.
+func requireListingOrder(t *testing.T, records []repository.Record) {
+	t.Helper()
+
+	seen := make(map[string]bool, len(records))
+	for i, record := range records {
+		require.False(t, seen[keyOf(record)], "%s listed twice", keyOf(record))
+		seen[keyOf(record)] = true
+		if i == 0 {
+			continue
+		}
+
+		prev := records[i-1]
+		switch {
+		case !prev.CreatedAt.Equal(record.CreatedAt):
+			require.True(t, prev.CreatedAt.After(record.CreatedAt), "%s listed before older %s", keyOf(record), keyOf(prev))
+		case prev.ResourceType != record.ResourceType:
+			require.Greater(t, prev.ResourceType, record.ResourceType, "%s out of order after %s", keyOf(record), keyOf(prev))
+		default:
+			require.Greater(t, prev.ResourceID, record.ResourceID, "%s out of order after %s", keyOf(record), keyOf(prev))
+		}
+	}
+}
+
+func TestInsert(t *testing.T) {
+	repo := setupRepo(t)
+
+	context := `{"name":"Alice"}`
+	before := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, repo.Insert("user-1", "user", &context))
+
+	record, err := repo.GetByID("user-1", "user")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", record.ResourceID)
+	assert.Equal(t, "user", record.ResourceType)
+	require.NotNil(t, record.Context)
+	assert.Equal(t, context, *record.Context)
+	assert.False(t, record.CreatedAt.Before(before), "created_at %s is before the insert at %s", record.CreatedAt, before)
+	assert.Equal(t, time.UTC, record.CreatedAt.Location())
+
+	_, err = repo.GetByID("user-2", "user")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestInsert_DuplicateKey(t *testing.T) {
+	repo := setupRepo(t)
+
+	first, second := `{"v":1}`, `{"v":2}`
+	require.NoError(t, repo.Insert("user-1", "user", &first))
+
+	err := repo.Insert("user-1", "user", &second)
+	assert.ErrorIs(t, err, repository.ErrDuplicate)
+
+	// The same resource_id under another type is a different record
+	require.NoError(t, repo.Insert("user-1", "admin", &second))
+
+	record, err := repo.GetByID("user-1", "user")
+	require.NoError(t, err)
+	assert.Equal(t, first, *record.Context, "the stored record is kept")
+}
+
+func TestGetAll(t *testing.T) {
+	repo := setupRepo(t)
+	seedRecords(t, repo)
+
+	repo.SetGetAllLimit(0)
+	all, truncated, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.False(t, truncated)
+	require.Len(t, all, seedCount)
+	requireListingOrder(t, all)
+
+	repo.SetGetAllLimit(1000)
+	capped, truncated, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.True(t, truncated)
+	assert.Equal(t, all[:1000], capped)
+}
+
+func TestGetPaginated_Walk(t *testing.T) {
+	repo := setupRepo(t)
+	seedRecords(t, repo)
+
+	repo.SetGetAllLimit(0)
+	all, _, err := repo.GetAll()
+	require.NoError(t, err)
+
+	// 7 matches the records sharing a second, 6 and 50 cut through them
+	for _, pageSize := range []int{6, 7, 50, 1000} {
+		t.Run(fmt.Sprintf("page size %d", pageSize), func(t *testing.T) {
+			var walked []repository.Record
+			token := ""
+			for pages := 1; ; pages++ {
+				result, err := repo.GetPaginated(token, pageSize)
+				require.NoError(t, err)
+				require.LessOrEqual(t, len(result.Records), pageSize)
+				walked = append(walked, result.Records...)
+
+				if result.NextContinuationToken == nil {
+					assert.True(t, result.IsLastPage)
+					break
+				}
+				require.Len(t, result.Records, pageSize, "only the last page may be short")
+				require.Less(t, pages, seedCount, "the walk does not end")
+				token = *result.NextContinuationToken
+			}
+
+			require.Len(t, walked, seedCount)
+			requireListingOrder(t, walked)
+			assert.Equal(t, all, walked, "the pages concatenate to the full listing")
+		})
+	}
+}
+
+func TestInsert_Concurrent(t *testing.T) {
+	repo := setupRepo(t)
+
+	const writers, perWriter = 20, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				errs <- repo.Insert(fmt.Sprintf("res-%02d-%02d", w, i), "task", nil)
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	count, err := repo.Count()
+	require.NoError(t, err)
+	assert.Equal(t, int64(writers*perWriter), count)
+}
+
+func TestInsert_ConcurrentSameKey(t *testing.T) {
+	repo := setupRepo(t)
+
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			context := fmt.Sprintf(`{"writer":%d}`, w)
+			errs <- repo.Insert("shared", "task", &context)
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	inserted := 0
+	for err := range errs {
+		if err == nil {
+			inserted++
+			continue
+		}
+		assert.ErrorIs(t, err, repository.ErrDuplicate)
+	}
+	assert.Equal(t, 1, inserted, "exactly one writer stores the record")
+
+	count, err := repo.Count()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestClaimNext_Concurrent(t *testing.T) {
+	repo := setupRepo(t)
+
+	const jobs, workers = 200, 8
+	for i := 0; i < jobs; i++ {
+		require.NoError(t, repo.Insert(fmt.Sprintf("job-%03d", i), "job", nil))
+	}
+	require.NoError(t, repo.Insert("user-1", "user", nil))
+
+	var wg sync.WaitGroup
+	claimed := make(chan string, jobs)
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				record, err := repo.ClaimNext("job")
+				if err != nil {
+					errs <- err
+					return
+				}
+				claimed <- record.ResourceID
+			}
+		}()
+	}
+	wg.Wait()
+	close(claimed)
+	close(errs)
+
+	// Every worker stops at the empty queue, after claiming each job once
+	for err := range errs {
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	}
+	seen := map[string]bool{}
+	for id := range claimed {
+		assert.False(t, seen[id], "%s claimed twice", id)
+		seen[id] = true
+	}
+	assert.Len(t, seen, jobs)
+
+	// Records of other types are not claimed
+	_, err := repo.ClaimNext("user")
+	assert.NoError(t, err)
+}
+
+func TestGetPaginatedSorted_ClaimedAtWithNulls(t *testing.T) {
+	repo := setupRepo(t)
+	require.NoError(t, repo.ImportBatch(generate(newFactory(), 300), repository.ImportSkip, nil))
+	// Claims made within a second or two share their claimed_at
+	for i := 0; i < 120; i++ {
+		_, err := repo.ClaimNext("task")
+		require.NoError(t, err)
+	}
+
+	for _, ascending := range []bool{false, true} {
+		for _, pageSize := range []int{1, 7, 50} {
+			t.Run(fmt.Sprintf("ascending=%t/page size %d", ascending, pageSize), func(t *testing.T) {
+				order := repository.SortOrder{Column: "claimed_at", Ascending: ascending}
+				seen := map[string]bool{}
+				token := ""
+				for {
+					result, err := repo.GetPaginatedSorted(order, repository.PaginationFilter{}, token, pageSize)
+					require.NoError(t, err)
+					for _, record := range result.Records {
+						require.False(t, seen[keyOf(record)], "%s listed twice", keyOf(record))
+						seen[keyOf(record)] = true
+					}
+					if result.NextContinuationToken == nil {
+						break
+					}
+					token = *result.NextContinuationToken
+				}
+				assert.Len(t, seen, 300, "no record is skipped at the NULL boundary")
+			})
+		}
+	}
+}
+
+func TestGetPaginatedSorted_SeqWalkWithSameSecondInserts(t *testing.T) {
+	repo := setupRepo(t)
+	// Seven records share every second of created_at, so only seq tells their
+	// insertion order apart
+	seedRecords(t, repo)
+
+	for _, pageSize := range []int{7, 50} {
+		t.Run(fmt.Sprintf("page size %d", pageSize), func(t *testing.T) {
+			order := repository.SortOrder{Column: "seq", Ascending: true}
+			var ids []string
+			seen := map[string]bool{}
+			token := ""
+			for pages := 1; ; pages++ {
+				result, err := repo.GetPaginatedSorted(order, repository.PaginationFilter{}, token, pageSize)
+				require.NoError(t, err)
+				for _, record := range result.Records {
+					require.False(t, seen[keyOf(record)], "%s listed twice", keyOf(record))
+					seen[keyOf(record)] = true
+					ids = append(ids, record.ResourceID)
+				}
+
+				// Records inserted in the same second mid-walk are numbered after
+				// every record listed so far and come last
+				if pages == 2 {
+					for i := 0; i < 3; i++ {
+						require.NoError(t, repo.Insert(fmt.Sprintf("late-%d-%d", pageSize, i), "task", nil))
+					}
+				}
+
+				if result.NextContinuationToken == nil {
+					break
+				}
+				require.Less(t, pages, seedCount, "the walk does not end")
+				token = *result.NextContinuationToken
+			}
+
+			count, err := repo.Count()
+			require.NoError(t, err)
+			require.Len(t, ids, int(count), "every record is listed once")
+			// seedRecords imports in resource_id order, then the late inserts follow
+			for i := 1; i < seedCount; i++ {
+				require.Less(t, ids[i-1], ids[i], "listed out of insertion order")
+			}
+			assert.Equal(t, fmt.Sprintf("late-%d-2", pageSize), ids[len(ids)-1])
+		})
+	}
+}
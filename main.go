@@ -1,37 +1,50 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net/http/pprof"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
+	"tokenpagination/buildinfo"
+	"tokenpagination/config"
 	"tokenpagination/handler"
 	"tokenpagination/repository"
+	"tokenpagination/schema"
+	"tokenpagination/seed"
+	"tokenpagination/server"
 )
 
-// connectDB establishes a connection to the MariaDB database using environment variables.
-// It reads database configuration from DB_HOST, DB_PORT, DB_USER, DB_PASSWORD, and DB_NAME
-// environment variables and returns a database connection with parseTime enabled for
-// proper time handling.
-func connectDB() (*sql.DB, error) {
-	host := os.Getenv("DB_HOST")
-	port := os.Getenv("DB_PORT")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
-
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", user, password, host, port, dbName)
+// connectDB establishes a connection to the MariaDB database described by the
+// database configuration, registering its custom TLS settings first, applies the
+// connection pool limits, and verifies it with a ping.
+func connectDB(cfg config.DBConfig) (*sql.DB, error) {
+	if err := cfg.RegisterTLS(); err != nil {
+		return nil, err
+	}
 
-	db, err := sql.Open("mysql", dsn)
+	db, err := sql.Open("mysql", cfg.DSN())
 	if err != nil {
 		return nil, err
 	}
 
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
 	if err := db.Ping(); err != nil {
 		return nil, err
 	}
@@ -39,146 +52,342 @@ func connectDB() (*sql.DB, error) {
 	return db, nil
 }
 
-// setupRoutes configures and returns a Gin router with all API endpoints.
-// It sets up the API routes for record management with the new schema,
-// health checks, and enables release mode for production. The router includes
-// both paginated and non-paginated endpoints for backward compatibility.
-func setupRoutes(recordHandler *handler.RecordHandler) *gin.Engine {
-	gin.SetMode(gin.ReleaseMode)
-	r := gin.Default()
+// newLogger returns the process-wide logger writing to w at the configured level,
+// as JSON lines for LOG_FORMAT=json and as key=value text otherwise. The level is
+// set on level, through which a configuration reload can change it later.
+func newLogger(cfg config.LogConfig, level *slog.LevelVar, w io.Writer) *slog.Logger {
+	level.Set(cfg.Level)
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.Format == config.LogFormatJSON {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
 
-	api := r.Group("/api/v1")
-	{
-		api.POST("/records", recordHandler.CreateRecord)
-		api.GET("/records", recordHandler.GetRecords)
-		api.GET("/records/paginated", recordHandler.GetRecordsPaginated)
-		api.POST("/records/create", recordHandler.CreateRecordFromQuery)
+// configureRepository applies the pagination limits, continuation token encryption,
+// and shard table routing from the configuration to the repository. Without an
+// encryption key, tokens remain in plaintext mode, which is convenient for debugging.
+func configureRepository(repo *repository.RecordRepository, cfg *config.Config) error {
+	repo.SetHasMoreStrategy(cfg.Pagination.HasMoreStrategy)
+	if err := repo.Reconfigure(repositorySettings(cfg)); err != nil {
+		return err
 	}
 
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "healthy"})
-	})
+	if len(cfg.Tokens.EncryptionKey) > 0 {
+		fmt.Println("Continuation tokens are encrypted")
+	} else {
+		fmt.Println("Continuation tokens are in plaintext mode")
+	}
 
-	return r
+	if len(cfg.DB.TypeTables) > 0 {
+		if err := repo.SetTypeTables(cfg.DB.TypeTables); err != nil {
+			return err
+		}
+		fmt.Printf("Routing %d resource types to shard tables\n", len(cfg.DB.TypeTables))
+	}
+
+	return nil
 }
 
-// SampleRecord represents a sample record to be loaded from the data file.
-type SampleRecord struct {
-	ResourceID   string
-	ResourceType string
-	Context      *string
+// repositorySettings returns the repository settings of the configuration, the
+// ones that a configuration reload applies to the running repository as well.
+func repositorySettings(cfg *config.Config) repository.Settings {
+	return repository.Settings{
+		MaxPageDepth:       cfg.Pagination.MaxPageDepth,
+		MaxTokenLength:     cfg.Tokens.MaxLength,
+		GetAllLimit:        cfg.Pagination.GetAllLimit,
+		TokenEncryptionKey: cfg.Tokens.EncryptionKey,
+	}
 }
 
-// loadSampleData reads sample records from a text file and returns them as a slice.
-// Each line in the file should contain resource_id|resource_type|context format.
-// Empty lines are skipped, and parsing errors for individual lines are logged
-// but don't stop the process.
-func loadSampleData(filename string) ([]SampleRecord, error) {
-	file, err := os.Open(filename)
+// configureContextSchemas loads per-resource_type JSON Schemas for the context
+// field from the given directory, one <resource_type>.json file per type. When no
+// directory is configured, context validation is disabled.
+func configureContextSchemas(recordHandler *handler.RecordHandler, dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	validator, err := schema.LoadDir(dir)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer file.Close()
 
-	var records []SampleRecord
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-		parts := strings.Split(line, "|")
-		if len(parts) < 2 {
-			log.Printf("Warning: Invalid format '%s': expected resource_id|resource_type|context", line)
-			continue
-		}
+	recordHandler.SetContextValidator(validator)
+	fmt.Printf("Loaded context schemas for resource types: %s\n", strings.Join(validator.ResourceTypes(), ", "))
+	return nil
+}
 
-		record := SampleRecord{
-			ResourceID:   parts[0],
-			ResourceType: parts[1],
-		}
+// newRouter returns a Gin router that logs every request through logger and
+// answers unknown routes with JSON errors.
+func newRouter(logger *slog.Logger) *gin.Engine {
+	r := gin.New()
+	r.Use(handler.RequestLogger(logger), gin.Recovery())
+	handler.RegisterFallbacks(r)
+	return r
+}
 
-		if len(parts) >= 3 && parts[2] != "" {
-			record.Context = &parts[2]
-		}
+// setupRoutes configures and returns a Gin router with all API endpoints.
+// It sets up the API routes for record management with the new schema,
+// health checks, and enables release mode for production. The router includes
+// both paginated and non-paginated endpoints for backward compatibility. /version
+// reports the environment of the live configuration next to the build information.
+// Admin endpoints require the live ADMIN_TOKEN and are disabled while it is
+// empty; when the admin listener is enabled with ADMIN_ADDR they are only served
+// by setupAdminRoutes and are not registered here. The health check reports the
+// connection pool statistics of db, and every request is logged through logger.
+func setupRoutes(recordHandler *handler.RecordHandler, db *sql.DB, live *liveConfig, logger *slog.Logger) *gin.Engine {
+	r := newRouter(logger)
+	handler.RegisterPathRedirects(r, live.Load().Server.RedirectTrailingSlash, live.Load().Server.CaseInsensitiveRoutes)
 
-		records = append(records, record)
+	api := r.Group("/api/v1", handler.APIVersionMiddleware(), handler.JSONNamingMiddleware(live.Load().Server.JSONNaming))
+	handler.RegisterRecordRoutes(api, recordHandler)
+
+	if live.Load().Server.AdminAddr == "" {
+		registerAdminRoutes(r, recordHandler, live.adminToken)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	r.GET("/", handler.RouteIndex(r))
+	r.GET("/health", handler.HealthCheckWithPool(db))
+	r.GET("/version", buildinfo.HandlerWithEnvironment(liveEnvironment{live}))
+
+	return r
+}
+
+// setupAdminRoutes returns the router of the admin listener: the admin endpoints,
+// guarded by the live ADMIN_TOKEN, the pprof profiles under /debug/pprof, and the health
+// check. It is only served on ADMIN_ADDR, which should not be reachable from the
+// public network.
+func setupAdminRoutes(recordHandler *handler.RecordHandler, db *sql.DB, live *liveConfig, logger *slog.Logger) *gin.Engine {
+	r := newRouter(logger)
+	registerAdminRoutes(r, recordHandler, live.adminToken)
+
+	debug := r.Group("/debug/pprof")
+	{
+		debug.GET("/", gin.WrapF(pprof.Index))
+		debug.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+		debug.GET("/profile", gin.WrapF(pprof.Profile))
+		debug.GET("/symbol", gin.WrapF(pprof.Symbol))
+		debug.POST("/symbol", gin.WrapF(pprof.Symbol))
+		debug.GET("/trace", gin.WrapF(pprof.Trace))
+		// Named profiles such as heap and goroutine
+		debug.GET("/:profile", gin.WrapF(pprof.Index))
 	}
 
-	return records, nil
+	r.GET("/", handler.RouteIndex(r))
+	r.GET("/health", handler.HealthCheckWithPool(db))
+
+	return r
+}
+
+// registerAdminRoutes adds the admin endpoints, which require the token returned by
+// adminToken, to r.
+func registerAdminRoutes(r *gin.Engine, recordHandler *handler.RecordHandler, adminToken func() string) {
+	admin := r.Group("/api/v1", handler.APIVersionMiddleware(), handler.AdminAuthMiddlewareFunc(adminToken))
+	{
+		admin.GET("/records/paginated/explain", recordHandler.ExplainPaginated)
+		admin.DELETE("/admin/records", recordHandler.PurgeRecords)
+	}
 }
 
-// populateSampleData inserts sample records into the database if it's empty.
-// This function checks if any records already exist, and if not, loads sample
-// data from 'sample_data.txt' and inserts each record with all required fields.
+// seedProgressInterval is how many sample records are inserted between progress
+// messages.
+const seedProgressInterval = 10000
+
+// sampleDataSeed names the sample data in the seed_state table.
+const sampleDataSeed = "sample_data"
+
+// populateSampleData loads sample records from the given file, or the embedded
+// sample data when filename is empty or does not exist, and stores them unless
+// the same records were already loaded completely, as recorded by a hash of them
+// in the seed_state table. Changing the sample data therefore takes effect at the
+// next startup: records with new keys are added, and stored ones are kept or
+// refreshed as strategy selects. All records are written in a single transaction,
+// so a failure stores nothing, is retried at the next startup, and names the
+// record that broke the batch. Replicas starting together load the data once.
+// Malformed entries in the file abort the insertion and are all reported.
 // This ensures the database has test data available immediately after startup.
-func populateSampleData(repo *repository.RecordRepository) error {
-	existingRecords, err := repo.GetAll()
+func populateSampleData(repo *repository.RecordRepository, filename string, format seed.Format, strategy repository.SeedStrategy) error {
+	records, source, err := loadSampleRecords(filename, format)
 	if err != nil {
 		return err
 	}
 
-	if len(existingRecords) > 0 {
-		fmt.Printf("Database already contains %d records, skipping sample data insertion\n", len(existingRecords))
+	fmt.Printf("Loading %d sample records from %s...\n", len(records), source)
+	start := time.Now()
+	seeded, err := repo.Seed(sampleDataSeed, sampleDataHash(records), sampleBatch(records), strategy, seedProgress(len(records)))
+	if err != nil {
+		return fmt.Errorf("failed to load sample data from %s, no records were inserted: %w", source, err)
+	}
+	if !seeded {
+		fmt.Println("Sample data is already loaded, skipping sample data insertion")
 		return nil
 	}
 
-	records, err := loadSampleData("sample_data.txt")
-	if err != nil {
-		return fmt.Errorf("failed to load sample data: %v", err)
-	}
+	fmt.Printf("Sample data loaded in %s\n", time.Since(start).Round(time.Millisecond))
+	return nil
+}
 
-	fmt.Printf("Inserting %d sample records...\n", len(records))
+// sampleDataHash returns the SHA-256 of the sample records, independent of the
+// format of the file they were loaded from.
+func sampleDataHash(records []seed.SampleRecord) string {
+	hash := sha256.New()
 	for _, record := range records {
-		if err := repo.Insert(record.ResourceID, record.ResourceType, record.Context); err != nil {
-			log.Printf("Warning: Failed to insert record %s/%s: %v", record.ResourceType, record.ResourceID, err)
+		encoded, _ := json.Marshal(record)
+		hash.Write(append(encoded, '\n'))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// sampleBatch converts sample records to the records to insert.
+func sampleBatch(records []seed.SampleRecord) []repository.Record {
+	batch := make([]repository.Record, len(records))
+	for i, record := range records {
+		batch[i] = repository.Record{ResourceID: record.ResourceID, ResourceType: record.ResourceType, Context: record.Context}
+	}
+	return batch
+}
+
+// seedProgress returns a progress callback printing a message every
+// seedProgressInterval of total sample records.
+func seedProgress(total int) func(inserted int) {
+	reported := 0
+	return func(inserted int) {
+		if inserted-reported >= seedProgressInterval {
+			fmt.Printf("Inserted %d/%d sample records\n", inserted, total)
+			reported = inserted
 		}
 	}
+}
 
-	fmt.Println("Sample data insertion completed")
+// insertSampleData inserts records in a single transaction, printing progress as it
+// goes. source names where the records came from in error messages.
+func insertSampleData(repo *repository.RecordRepository, records []seed.SampleRecord, source string) error {
+	fmt.Printf("Inserting %d sample records...\n", len(records))
+	start := time.Now()
+	if err := repo.InsertBatch(sampleBatch(records), seedProgress(len(records))); err != nil {
+		return fmt.Errorf("failed to insert sample data from %s, no records were inserted: %w", source, err)
+	}
+
+	fmt.Printf("Sample data insertion completed in %s\n", time.Since(start).Round(time.Millisecond))
 	return nil
 }
 
-// main is the entry point of the application.
-// It establishes database connection, creates tables with the new schema,
-// populates sample data, sets up HTTP routes, and starts the Gin web server
-// on port 8080. The server provides REST API endpoints for record management
-// with support for resource_id, resource_type, context fields and both
-// traditional and paginated data retrieval.
-func main() {
-	fmt.Println("Starting application...")
-
-	db, err := connectDB()
+// openRepository connects to the configured database and returns a repository
+// configured from cfg. The caller must close the returned database handle.
+func openRepository(cfg *config.Config) (*sql.DB, *repository.RecordRepository, error) {
+	db, err := connectDB(cfg.DB)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		return nil, nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
-	defer db.Close()
 
-	recordRepo := repository.NewRecordRepository(db)
-	if err := recordRepo.CreateTable(); err != nil {
-		log.Fatal("Failed to create table:", err)
+	repo := repository.NewRecordRepository(db)
+	if err := configureRepository(repo, cfg); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to configure repository: %w", err)
 	}
 
-	if err := populateSampleData(recordRepo); err != nil {
-		log.Fatal("Failed to populate sample data:", err)
+	return db, repo, nil
+}
+
+// serveHTTP sets up the HTTP routes and runs the Gin web server on the configured
+// listeners until the process receives an interrupt or SIGTERM. The server provides
+// REST API endpoints for record management with support for resource_id,
+// resource_type, context fields and both traditional and paginated data retrieval.
+func serveHTTP(cfg *config.Config, db *sql.DB, repo *repository.RecordRepository) error {
+	recordHandler := handler.NewRecordHandler(repo)
+	if err := configureContextSchemas(recordHandler, cfg.Features.ContextSchemaDir); err != nil {
+		return fmt.Errorf("failed to load context schemas: %w", err)
+	}
+	recordHandler.SetRecordsKey(cfg.Server.RecordsKey)
+	if cfg.Features.DegradedMode {
+		recordHandler.EnableDegradedMode(db, cfg.Features.DegradedCacheTTL)
+	}
+	if cfg.Features.DebugExplain {
+		recordHandler.EnableDebugExplain()
+		fmt.Println("Debug explain is enabled: paginated responses carry their query plan")
+	}
+	// Wiping every record is for test environments only
+	if cfg.Env != config.EnvProd {
+		recordHandler.EnablePurge()
 	}
 
-	recordHandler := handler.NewRecordHandler(recordRepo)
-	router := setupRoutes(recordHandler)
+	live := newLiveConfig(cfg)
+	gin.SetMode(cfg.Server.GinMode)
+	router := setupRoutes(recordHandler, db, live, slog.Default())
+	var adminRouter *gin.Engine
+	if cfg.Server.AdminAddr != "" {
+		adminRouter = setupAdminRoutes(recordHandler, db, live, slog.Default())
+	}
 
-	fmt.Println("Server starting on port 8080...")
+	scheme := "http"
+	if cfg.Server.TLSEnabled() {
+		scheme = "https"
+	}
+	if !cfg.Server.SocketOnly {
+		fmt.Printf("Server starting on %s://%s...\n", scheme, cfg.Server.Addr)
+		if cfg.Server.RedirectAddr != "" {
+			fmt.Printf("Redirecting http://%s to HTTPS\n", cfg.Server.RedirectAddr)
+		}
+	}
+	if cfg.Server.Socket != "" {
+		fmt.Printf("Server starting on unix:%s...\n", cfg.Server.Socket)
+	}
+	if cfg.Server.AdminAddr != "" {
+		fmt.Printf("Admin endpoints and /debug/pprof on http://%s\n", cfg.Server.AdminAddr)
+	}
 	fmt.Println("API endpoints:")
 	fmt.Println("  POST /api/v1/records - Create record (JSON body)")
-	fmt.Println("  GET  /api/v1/records - Get all records")
-	fmt.Println("  GET  /api/v1/records/paginated - Get paginated records")
+	fmt.Println("  GET  /api/v1/records - Get all records (deprecated, capped)")
+	fmt.Println("  GET  /api/v1/records/paginated - Get paginated records (optionally ?resource_type=user&order_by=updated_at&order=asc or ?page=last)")
+	fmt.Println("  GET  /api/v1/records/paginated/explain - Show the SQL a paginated request would run (admin)")
+	fmt.Println("  DELETE /api/v1/admin/records?confirm=DELETE_ALL - Delete every record, for test environments (admin)")
+	fmt.Println("  GET  /api/v1/records/export.sql - Download every record as SQL INSERT statements")
+	fmt.Println("  GET  /api/v1/records/all-pages - Stream every page as NDJSON in one response")
+	fmt.Println("  GET  /api/v1/records/grouped - Get every record grouped by resource_type (optional per_type_limit)")
+	fmt.Println("  GET  /api/v1/records/activity - Get records ordered by most recent activity")
+	fmt.Println("  GET  /api/v1/records/search?resource_type=user&id_prefix=user- - Search records with combined filters")
+	fmt.Println("  GET  /api/v1/records/missing-context - Get paginated records whose context is null")
+	fmt.Println("  GET  /api/v1/records/newer?since_token=... - Poll for records created since the newest one seen")
+	fmt.Println("  GET  /api/v1/records/stream/live - Push newly created records as Server-Sent Events")
+	fmt.Println("  GET  /api/v1/records/stats/daily?from=2024-01-01&to=2024-01-31 - Count records created per day")
 	fmt.Println("  POST /api/v1/records/create?resource_id=123&resource_type=user - Create record (query param)")
+	fmt.Println("  POST /api/v1/records/get - Get records by composite keys (JSON body)")
+	fmt.Println("  POST /api/v1/records/auto - Create record with generated resource_id (JSON body)")
+	fmt.Println("  GET  /api/v1/records/:resource_type/:resource_id?fields=context - Get one record, optionally only some fields")
+	fmt.Println("  DELETE /api/v1/records/:resource_type/:resource_id - Delete one record")
+	fmt.Println("  POST /api/v1/records/:resource_type/:resource_id/touch - Bump a record's updated_at")
+	fmt.Println("  PUT  /api/v1/types/:resource_type/records - Atomically replace all records of a type (JSON body)")
+	fmt.Println("  GET  / - List the registered endpoints")
 	fmt.Println("  GET  /health - Health check")
+	fmt.Println("  GET  /version - Build version information")
+
+	// Interrupts and SIGTERM stop accepting connections and let in-flight requests finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// SIGHUP reloads the settings that can change without a restart
+	reload := &reloader{live: live, repo: repo, level: logLevel, load: config.Load, logger: slog.Default()}
+	go reload.watch(ctx)
 
-	if err := router.Run(":8080"); err != nil {
-		log.Fatal("Failed to start server:", err)
+	if days := cfg.Features.RetentionDays; days > 0 {
+		fmt.Printf("Purging records created more than %d days ago every %s\n", days, retentionInterval)
+		purger := &retention{purge: repo.PurgeOlderThan, days: days, interval: retentionInterval, now: time.Now, logger: slog.Default()}
+		go purger.run(ctx)
 	}
-}
\ No newline at end of file
+
+	if err := server.Run(ctx, cfg.Server, router, adminRouter); err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+	fmt.Println("Server stopped")
+	return nil
+}
+
+// main is the entry point of the application. It runs the subcommand named on the
+// command line, or the all-in-one mode without one, and exits with its exit code.
+func main() {
+	info := buildinfo.Get()
+	slog.Info("starting application", "version", info.Version, "commit", info.Commit, "build_time", info.BuildTime, "go_version", info.GoVersion)
+
+	os.Exit(dispatch(os.Args[1:], commands, os.Stderr))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"tokenpagination/config"
+	"tokenpagination/handler"
+	"tokenpagination/repository"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// statusOf returns the status of a GET request to path served by r.
+func statusOf(r *gin.Engine, path string) int {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w.Code
+}
+
+func TestSetupRoutes_AdminRoutesOnPublicListener(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	r := setupRoutes(handler.NewRecordHandler(nil), nil, newLiveConfig(&config.Config{Server: config.ServerConfig{AdminToken: "secret"}}), logger)
+
+	// Without an admin listener the admin endpoints are served publicly, behind the token
+	assert.Equal(t, http.StatusUnauthorized, statusOf(r, "/api/v1/records/paginated/explain"))
+	assert.Equal(t, http.StatusNotFound, statusOf(r, "/debug/pprof/cmdline"))
+}
+
+func TestSetupRoutes_AdminListener(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	live := newLiveConfig(&config.Config{Server: config.ServerConfig{AdminToken: "secret", AdminAddr: "127.0.0.1:9091"}})
+	recordHandler := handler.NewRecordHandler(repository.NewMemoryRepository())
+
+	public := setupRoutes(recordHandler, nil, live, logger)
+	admin := setupAdminRoutes(recordHandler, nil, live, logger)
+
+	// The admin endpoints are not registered publicly: explain is read as the
+	// lookup of a record that does not exist
+	assert.Equal(t, http.StatusNotFound, statusOf(public, "/api/v1/records/paginated/explain"))
+	assert.Equal(t, http.StatusNotFound, statusOf(public, "/debug/pprof/cmdline"))
+	for _, route := range public.Routes() {
+		assert.NotEqual(t, "/api/v1/admin/records", route.Path)
+		assert.NotEqual(t, "/api/v1/records/paginated/explain", route.Path)
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, statusOf(admin, "/api/v1/records/paginated/explain"))
+	assert.Equal(t, http.StatusOK, statusOf(admin, "/debug/pprof/cmdline"))
+	assert.Equal(t, http.StatusOK, statusOf(admin, "/debug/pprof/goroutine"))
+	assert.Equal(t, http.StatusNotFound, statusOf(admin, "/api/v1/records"))
+}
+
+func TestSetupRoutes_VersionReportsEnvironment(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	r := setupRoutes(handler.NewRecordHandler(nil), nil, newLiveConfig(&config.Config{Env: config.EnvProd, Server: config.ServerConfig{GinMode: config.GinModeRelease}}), logger)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"environment":{"app_env":"prod","gin_mode":"release","seed_sample_data":false,`)
+}
+
+func TestSetupRoutes_PathRedirects(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	live := newLiveConfig(&config.Config{Server: config.ServerConfig{RedirectTrailingSlash: true, CaseInsensitiveRoutes: true}})
+	r := setupRoutes(handler.NewRecordHandler(nil), nil, live, logger)
+
+	tests := []struct {
+		method, path string
+		wantStatus   int
+		wantLocation string
+	}{
+		{http.MethodGet, "/api/v1/records/", http.StatusMovedPermanently, "/api/v1/records"},
+		{http.MethodGet, "/api/v1/records/paginated/?page_size=3", http.StatusMovedPermanently, "/api/v1/records/paginated?page_size=3"},
+		{http.MethodGet, "/API/v1/Records/Paginated?page_size=3", http.StatusMovedPermanently, "/api/v1/records/paginated?page_size=3"},
+		{http.MethodGet, "/Api/V1/Records/", http.StatusMovedPermanently, "/api/v1/records"},
+		// Path parameters keep their case, and fixed segments win over parameters
+		{http.MethodGet, "/API/V1/RECORDS/User/User-1", http.StatusMovedPermanently, "/api/v1/records/User/User-1"},
+		{http.MethodGet, "/API/v1/records/STATS/Daily", http.StatusMovedPermanently, "/api/v1/records/stats/daily"},
+		// Other methods keep their method and body through a 307
+		{http.MethodPost, "/api/v1/records/", http.StatusTemporaryRedirect, "/api/v1/records"},
+		{http.MethodPost, "/API/v1/RECORDS", http.StatusTemporaryRedirect, "/api/v1/records"},
+		{http.MethodDelete, "/api/v1/Records/user/user-1", http.StatusTemporaryRedirect, "/api/v1/records/user/user-1"},
+		{http.MethodGet, "/api/v1/nothing", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantLocation, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestSetupRoutes_PathRedirectsDisabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	r := setupRoutes(handler.NewRecordHandler(nil), nil, newLiveConfig(&config.Config{}), logger)
+
+	assert.Equal(t, http.StatusNotFound, statusOf(r, "/api/v1/records/"))
+	assert.Equal(t, http.StatusNotFound, statusOf(r, "/API/v1/Records"))
+}
+
+func TestSetupRoutes_DailyStatsIsNotARecordKey(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	r := setupRoutes(handler.NewRecordHandler(nil), nil, newLiveConfig(&config.Config{}), logger)
+
+	// Answered by the stats handler, which rejects the missing range
+	assert.Equal(t, http.StatusBadRequest, statusOf(r, "/api/v1/records/stats/daily"))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"tokenpagination/config"
+	"tokenpagination/repository"
+)
+
+// liveConfig holds the configuration in effect. A reload stores a new
+// *config.Config instead of modifying the one requests are reading, so every
+// request sees either the old or the new configuration, never a mix.
+type liveConfig struct {
+	current atomic.Pointer[config.Config]
+}
+
+func newLiveConfig(cfg *config.Config) *liveConfig {
+	live := &liveConfig{}
+	live.current.Store(cfg)
+	return live
+}
+
+// Load returns the configuration in effect.
+func (l *liveConfig) Load() *config.Config {
+	return l.current.Load()
+}
+
+// adminToken returns the token the admin endpoints currently require.
+func (l *liveConfig) adminToken() string {
+	return l.Load().Server.AdminToken
+}
+
+// liveEnvironment encodes the environment of the configuration in effect, so that
+// /version reports a reloaded log level.
+type liveEnvironment struct {
+	live *liveConfig
+}
+
+func (e liveEnvironment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.live.Load().Environment())
+}
+
+// reloader applies a reloaded configuration to the running server.
+type reloader struct {
+	live   *liveConfig
+	repo   *repository.RecordRepository
+	level  *slog.LevelVar
+	load   func() (*config.Config, error)
+	logger *slog.Logger
+}
+
+// reload loads the configuration again and applies its reloadable settings: the
+// log level, the admin token, the pagination limits and the continuation token
+// key. Every changed setting is logged; changes to settings that are only read at
+// startup, such as the database connection and the listen addresses, are logged
+// as warnings because they need a restart. An invalid configuration is logged and
+// leaves the running configuration unchanged.
+func (r *reloader) reload() {
+	next, err := r.load()
+	if err != nil {
+		r.logger.Error("configuration reload failed, keeping the current configuration", "error", err)
+		return
+	}
+
+	current := r.live.Load()
+	reloaded := current.Reloaded(next)
+	if err := r.repo.Reconfigure(repositorySettings(reloaded)); err != nil {
+		r.logger.Error("configuration reload failed, keeping the current configuration", "error", err)
+		return
+	}
+	r.level.Set(reloaded.Log.Level)
+	r.live.current.Store(reloaded)
+
+	changes := current.Changes(next)
+	for _, change := range changes {
+		if change.Reloadable {
+			r.logger.Info("configuration setting changed", "setting", change.Name, "old", change.Old, "new", change.New)
+		} else {
+			r.logger.Warn("configuration setting changed, restart required to apply it", "setting", change.Name, "old", change.Old, "new", change.New)
+		}
+	}
+	r.logger.Info("configuration reloaded", "changes", len(changes))
+}
+
+// watch reloads the configuration on every SIGHUP until ctx is done.
+func (r *reloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.reload()
+		}
+	}
+}
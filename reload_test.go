@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tokenpagination/config"
+	"tokenpagination/handler"
+	"tokenpagination/repository"
+)
+
+// testReloader returns a reloader for current whose load returns next and err, and
+// the buffer its log is written to.
+func testReloader(t *testing.T, current, next *config.Config, err error) (*reloader, *bytes.Buffer) {
+	var logs bytes.Buffer
+	repo := repository.NewRecordRepository(nil)
+	require.NoError(t, repo.Reconfigure(repositorySettings(current)))
+
+	return &reloader{
+		live:   newLiveConfig(current),
+		repo:   repo,
+		level:  new(slog.LevelVar),
+		load:   func() (*config.Config, error) { return next, err },
+		logger: slog.New(slog.NewTextHandler(&logs, nil)),
+	}, &logs
+}
+
+// adminStatus returns the status of an explain request to r with the bearer token.
+func adminStatus(r http.Handler, token string) int {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/records/paginated/explain", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestReloader_Reload(t *testing.T) {
+	current := &config.Config{
+		DB:     config.DBConfig{Host: "db"},
+		Server: config.ServerConfig{Addr: ":8080", AdminToken: "old"},
+		Log:    config.LogConfig{Level: slog.LevelInfo},
+	}
+	next := &config.Config{
+		DB:     config.DBConfig{Host: "other-db"},
+		Server: config.ServerConfig{Addr: ":9090", AdminToken: "new"},
+		Log:    config.LogConfig{Level: slog.LevelDebug},
+	}
+	reload, logs := testReloader(t, current, next, nil)
+	router := setupRoutes(handler.NewRecordHandler(reload.repo), nil, reload.live, slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)))
+	assert.Equal(t, http.StatusForbidden, adminStatus(router, "new"))
+
+	reload.reload()
+
+	// The router serving requests picks up the rotated token
+	assert.Equal(t, http.StatusForbidden, adminStatus(router, "old"))
+	assert.Equal(t, http.StatusOK, adminStatus(router, "new"))
+
+	assert.Equal(t, slog.LevelDebug, reload.level.Level())
+	assert.Equal(t, "db", reload.live.Load().DB.Host, "settings read at startup are kept")
+	assert.Equal(t, "old", current.Server.AdminToken, "the previous configuration is not modified")
+
+	assert.Contains(t, logs.String(), `level=WARN msg="configuration setting changed, restart required to apply it" setting=DB_HOST old=db new=other-db`)
+	assert.Contains(t, logs.String(), `level=WARN msg="configuration setting changed, restart required to apply it" setting=SERVER_ADDR`)
+	assert.Contains(t, logs.String(), `level=INFO msg="configuration setting changed" setting=ADMIN_TOKEN old=(set) new=(set)`)
+	assert.Contains(t, logs.String(), `msg="configuration reloaded" changes=4`)
+	assert.NotContains(t, logs.String(), "new=new")
+}
+
+func TestReloader_ReloadInvalidConfigKeepsCurrent(t *testing.T) {
+	current := &config.Config{Server: config.ServerConfig{AdminToken: "old"}}
+	reload, logs := testReloader(t, current, nil, errors.New("DB_PORT must be an integer, got 'x'"))
+
+	reload.reload()
+
+	assert.Same(t, current, reload.live.Load())
+	assert.Contains(t, logs.String(), `level=ERROR msg="configuration reload failed, keeping the current configuration" error="DB_PORT must be an integer, got 'x'"`)
+}
+
+func TestReloader_ReloadInvalidKeyKeepsCurrent(t *testing.T) {
+	current := &config.Config{Log: config.LogConfig{Level: slog.LevelWarn}}
+	next := &config.Config{Tokens: config.TokenConfig{EncryptionKey: []byte("short")}, Log: config.LogConfig{Level: slog.LevelDebug}}
+	reload, logs := testReloader(t, current, next, nil)
+	reload.level.Set(slog.LevelWarn)
+
+	reload.reload()
+
+	assert.Same(t, current, reload.live.Load())
+	assert.Equal(t, slog.LevelWarn, reload.level.Level())
+	assert.Contains(t, logs.String(), "invalid token encryption key")
+}
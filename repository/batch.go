@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// batchInsertRows is the number of rows written by each multi-row INSERT of a
+// batch insert.
+const batchInsertRows = 500
+
+// BatchInsertError reports the record that made a batch insert fail.
+type BatchInsertError struct {
+	// Index is the position of the failing record in the batch, starting at 0.
+	Index int
+	Key   RecordKey
+	Err   error
+}
+
+func (e *BatchInsertError) Error() string {
+	return fmt.Sprintf("record %d (%s/%s): %v", e.Index+1, e.Key.ResourceType, e.Key.ResourceID, e.Err)
+}
+
+func (e *BatchInsertError) Unwrap() error {
+	return e.Err
+}
+
+// InsertBatch inserts all records in a single transaction, so that either every
+// record is stored or none is. Rows are written with multi-row INSERT statements
+// of up to 500 rows, routed to the shard table of their resource_type, and both
+// timestamps of every record are set to the current time in UTC. When the insert
+// fails, the transaction is rolled back and the error is a *BatchInsertError
+// naming the record that could not be inserted. If progress is not nil it is
+// called with the number of records written so far after every statement.
+func (r *RecordRepository) InsertBatch(records []Record, progress func(inserted int)) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := r.insertRecords(tx, records, insertBatch, progress); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ImportMode selects what ImportBatch does with a record whose key is already
+// stored.
+type ImportMode string
+
+const (
+	// ImportSkip keeps the stored record and drops the imported one.
+	ImportSkip ImportMode = "skip"
+	// ImportOverwrite replaces the stored record with the imported one.
+	ImportOverwrite ImportMode = "overwrite"
+)
+
+// importDuplicateClauses resolve the duplicate keys of an import as each mode
+// selects.
+var importDuplicateClauses = map[ImportMode]string{
+	ImportSkip:      " ON DUPLICATE KEY UPDATE resource_id = resource_id",
+	ImportOverwrite: " ON DUPLICATE KEY UPDATE context = VALUES(context), created_at = VALUES(created_at), updated_at = VALUES(updated_at), metadata = VALUES(metadata), claimed_at = VALUES(claimed_at)",
+}
+
+// ParseImportMode parses an import mode name.
+func ParseImportMode(value string) (ImportMode, error) {
+	mode := ImportMode(value)
+	if _, ok := importDuplicateClauses[mode]; !ok {
+		return "", fmt.Errorf("invalid import mode '%s': must be skip or overwrite", value)
+	}
+	return mode, nil
+}
+
+// ImportBatch works like InsertBatch, but every record keeps its own created_at,
+// updated_at and claimed_at, and records whose key is already stored are skipped or
+// overwritten as mode selects instead of failing the batch. It restores records
+// exported from this or another database without losing their history.
+func (r *RecordRepository) ImportBatch(records []Record, mode ImportMode, progress func(inserted int)) error {
+	if _, err := ParseImportMode(string(mode)); err != nil {
+		return err
+	}
+	write := batchWrite{name: "import_batch", keepTimestamps: true, keepClaims: true, onDuplicate: importDuplicateClauses[mode]}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := r.insertRecords(tx, records, write, progress); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceByType atomically replaces every record of resourceType with the given
+// records: the existing records are deleted and the new ones inserted, as with
+// InsertBatch, in a single transaction, so readers see either the old or the new
+// set and never a partial one. Every record must have the given resource_type. On
+// any error the transaction is rolled back and the old records are kept.
+func (r *RecordRepository) ReplaceByType(resourceType string, records []Record) error {
+	for i, record := range records {
+		if record.ResourceType != resourceType {
+			return fmt.Errorf("record %d has resource_type '%s', expected '%s'", i+1, record.ResourceType, resourceType)
+		}
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.exec(tx, "replace_delete", "DELETE FROM "+r.tableFor(resourceType)+" WHERE resource_type = ?", resourceType); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := r.insertRecords(tx, records, insertBatch, nil); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteAll deletes every record from every table in one transaction and returns
+// the number of records deleted. It is meant for wiping test environments; DELETE
+// is used rather than TRUNCATE so that the count is known and a failure deletes
+// nothing.
+func (r *RecordRepository) DeleteAll() (int64, error) {
+	return r.deleteFromTables("delete_all", "")
+}
+
+// PurgeOlderThan deletes every record created before cutoff from every table in
+// one transaction and returns the number of records deleted, for enforcing a
+// retention period. Records are deleted for good: the table has no soft-delete
+// flag to honor. A cutoff older than every record deletes nothing and returns 0.
+func (r *RecordRepository) PurgeOlderThan(cutoff time.Time) (int64, error) {
+	return r.deleteFromTables("purge_older_than", "created_at < ?", cutoff.UTC())
+}
+
+// deleteFromTables deletes the records matching condition, or every record when
+// it is empty, from every table in one transaction, logging the statements under
+// name, and returns the number of records deleted.
+func (r *RecordRepository) deleteFromTables(name, condition string, args ...any) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	for _, table := range r.tables() {
+		query := "DELETE FROM " + table
+		if condition != "" {
+			query += " WHERE " + condition
+		}
+		result, err := r.exec(tx, name, query, args...)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		deleted += affected
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// batchWrite describes the INSERT statements writing a batch.
+type batchWrite struct {
+	name           string // query name the statements are logged under
+	keepTimestamps bool   // write the records' own timestamps instead of the current time
+	keepClaims     bool   // also write the records' claimed_at, leaving them unclaimed otherwise
+	onDuplicate    string // clause appended to every statement, empty to fail on duplicate keys
+}
+
+// insertBatch writes new records stamped with the current time.
+var insertBatch = batchWrite{name: "insert_batch"}
+
+// insertRecords writes records inside tx, grouping consecutive records stored in
+// the same table into multi-row statements.
+func (r *RecordRepository) insertRecords(tx *sql.Tx, records []Record, write batchWrite, progress func(inserted int)) error {
+	now := time.Now().UTC()
+
+	for start := 0; start < len(records); {
+		table := r.tableFor(records[start].ResourceType)
+		end := start + 1
+		for end < len(records) && end-start < batchInsertRows && r.tableFor(records[end].ResourceType) == table {
+			end++
+		}
+
+		statementStart := time.Now()
+		err := insertRows(tx, table, records[start:end], now, write)
+		r.logQuery(write.name, statementStart, int64(end-start), err)
+		if err != nil {
+			return findFailingRecord(tx, table, records[start:end], start, now, write, err)
+		}
+
+		start = end
+		if progress != nil {
+			progress(start)
+		}
+	}
+
+	return nil
+}
+
+// insertRows writes records into table with a single INSERT statement.
+func insertRows(tx *sql.Tx, table string, records []Record, now time.Time, write batchWrite) error {
+	columns, placeholder := recordColumns, "(?, ?, ?, ?, ?, ?)"
+	if write.keepClaims {
+		columns, placeholder = recordColumns+", "+claimedColumn, "(?, ?, ?, ?, ?, ?, ?)"
+	}
+
+	placeholders := make([]string, len(records))
+	args := make([]any, 0, len(records)*7)
+	for i, record := range records {
+		metadataJSON, err := marshalMetadata(record.Metadata)
+		if err != nil {
+			return err
+		}
+
+		createdAt, updatedAt := now, now
+		if write.keepTimestamps {
+			createdAt, updatedAt = record.CreatedAt.UTC(), record.UpdatedAt.UTC()
+		}
+
+		placeholders[i] = placeholder
+		args = append(args, record.ResourceID, record.ResourceType, record.Context, createdAt, updatedAt, metadataJSON)
+		if write.keepClaims {
+			var claimedAt *time.Time
+			if record.claimedAt != nil {
+				claimed := record.claimedAt.UTC()
+				claimedAt = &claimed
+			}
+			args = append(args, claimedAt)
+		}
+	}
+
+	query := "INSERT INTO " + table + " (" + columns + ") VALUES " + strings.Join(placeholders, ", ") + write.onDuplicate
+	_, err := tx.Exec(query, args...)
+	return err
+}
+
+// findFailingRecord replays a failed multi-row statement one row at a time to find
+// the record that broke it. MySQL only undoes the failed statement, so the rows
+// replayed here are still discarded when the caller rolls the transaction back.
+func findFailingRecord(tx *sql.Tx, table string, records []Record, offset int, now time.Time, write batchWrite, statementErr error) error {
+	for i := range records {
+		if err := insertRows(tx, table, records[i:i+1], now, write); err != nil {
+			return &BatchInsertError{Index: offset + i, Key: RecordKey{ResourceType: records[i].ResourceType, ResourceID: records[i].ResourceID}, Err: err}
+		}
+	}
+
+	return fmt.Errorf("insert records %d to %d: %w", offset+1, offset+len(records), statementErr)
+}
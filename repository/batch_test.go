@@ -0,0 +1,346 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchOf returns n user records with distinct ids.
+func batchOf(n int) []Record {
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = Record{ResourceID: fmt.Sprintf("user-%d", i), ResourceType: "user"}
+	}
+	return records
+}
+
+func TestInsertBatch_SingleTransaction(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	ctx := `{"plan":"pro"}`
+	records := []Record{
+		{ResourceID: "user-1", ResourceType: "user", Context: &ctx},
+		{ResourceID: "doc-1", ResourceType: "document", Metadata: map[string]string{"tier": "gold"}},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO resource_context \(resource_id, resource_type, context, created_at, updated_at, metadata\) VALUES \(\?, \?, \?, \?, \?, \?\), \(\?, \?, \?, \?, \?, \?\)$`).
+		WithArgs("user-1", "user", &ctx, sqlmock.AnyArg(), sqlmock.AnyArg(), nil,
+			"doc-1", "document", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), `{"tier":"gold"}`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	var progress []int
+	err := repo.InsertBatch(records, func(inserted int) { progress = append(progress, inserted) })
+	require.NoError(t, err)
+	assert.Equal(t, []int{2}, progress)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertBatch_LargeBatchUsesFewStatements(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	// 100k rows are written with 200 statements instead of 100k round trips
+	const total = 100000
+	mock.ExpectBegin()
+	for i := 0; i < total/batchInsertRows; i++ {
+		mock.ExpectExec(`INSERT INTO resource_context`).WillReturnResult(sqlmock.NewResult(0, batchInsertRows))
+	}
+	mock.ExpectCommit()
+
+	calls := 0
+	last := 0
+	err := repo.InsertBatch(batchOf(total), func(inserted int) {
+		calls++
+		last = inserted
+	})
+	require.NoError(t, err)
+	assert.Equal(t, total/batchInsertRows, calls)
+	assert.Equal(t, total, last)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertBatch_RoutesToShardTables(t *testing.T) {
+	mock, repo := setupShardedTestDB(t)
+
+	records := []Record{
+		{ResourceID: "user-1", ResourceType: "user"},
+		{ResourceID: "user-2", ResourceType: "user"},
+		{ResourceID: "doc-1", ResourceType: "document"},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO resource_context_user \(.*\) VALUES \(\?, \?, \?, \?, \?, \?\), \(\?, \?, \?, \?, \?, \?\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO resource_context \(.*\) VALUES \(\?, \?, \?, \?, \?, \?\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.InsertBatch(records, nil))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertBatch_ReportsFailingRecordAndRollsBack(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	duplicate := errors.New("Error 1062: Duplicate entry 'user-user-1' for key 'PRIMARY'")
+	records := batchOf(3)
+	records[2].ResourceID = "user-1"
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO resource_context`).WillReturnError(duplicate)
+	// The failed statement is replayed row by row to find the culprit
+	mock.ExpectExec(`INSERT INTO resource_context`).WithArgs("user-0", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO resource_context`).WithArgs("user-1", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO resource_context`).WithArgs("user-1", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).WillReturnError(duplicate)
+	mock.ExpectRollback()
+
+	err := repo.InsertBatch(records, nil)
+
+	var batchErr *BatchInsertError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 2, batchErr.Index)
+	assert.Equal(t, RecordKey{ResourceType: "user", ResourceID: "user-1"}, batchErr.Key)
+	assert.ErrorIs(t, err, duplicate)
+	assert.EqualError(t, err, "record 3 (user/user-1): Error 1062: Duplicate entry 'user-user-1' for key 'PRIMARY'")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertBatch_StatementFailsAsAWhole(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	tooLarge := errors.New("Error 1153: Got a packet bigger than 'max_allowed_packet' bytes")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO resource_context`).WillReturnError(tooLarge)
+	mock.ExpectExec(`INSERT INTO resource_context`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO resource_context`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	err := repo.InsertBatch(batchOf(2), nil)
+	assert.ErrorIs(t, err, tooLarge)
+	assert.ErrorContains(t, err, "insert records 1 to 2")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReplaceByType_DeletesAndInsertsInOneTransaction(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM resource_context WHERE resource_type = \?`).
+		WithArgs("user").
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectExec(`INSERT INTO resource_context \(.*\) VALUES \(\?, \?, \?, \?, \?, \?\), \(\?, \?, \?, \?, \?, \?\)$`).
+		WithArgs("user-0", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil,
+			"user-1", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.ReplaceByType("user", batchOf(2)))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReplaceByType_EmptySetDeletesAll(t *testing.T) {
+	mock, repo := setupShardedTestDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM resource_context_user WHERE resource_type = \?`).
+		WithArgs("user").
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.ReplaceByType("user", nil))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteAll(t *testing.T) {
+	mock, repo := setupShardedTestDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^DELETE FROM resource_context$`).WillReturnResult(sqlmock.NewResult(0, 7))
+	mock.ExpectExec(`^DELETE FROM resource_context_user$`).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	deleted, err := repo.DeleteAll()
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteAll_RollsBackOnError(t *testing.T) {
+	mock, repo := setupShardedTestDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^DELETE FROM resource_context$`).WillReturnResult(sqlmock.NewResult(0, 7))
+	mock.ExpectExec(`^DELETE FROM resource_context_user$`).WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	deleted, err := repo.DeleteAll()
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Zero(t, deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeOlderThan(t *testing.T) {
+	mock, repo := setupShardedTestDB(t)
+	cutoff := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^DELETE FROM resource_context WHERE created_at < \?$`).WithArgs(cutoff).WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec(`^DELETE FROM resource_context_user WHERE created_at < \?$`).WithArgs(cutoff).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	deleted, err := repo.PurgeOlderThan(cutoff.In(time.FixedZone("CET", 3600)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeOlderThan_NothingToPurge(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+	cutoff := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^DELETE FROM resource_context WHERE created_at < \?$`).WithArgs(cutoff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	deleted, err := repo.PurgeOlderThan(cutoff)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeOlderThan_RollsBackOnError(t *testing.T) {
+	mock, repo := setupShardedTestDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^DELETE FROM resource_context WHERE`).WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec(`^DELETE FROM resource_context_user WHERE`).WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	deleted, err := repo.PurgeOlderThan(time.Now())
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Zero(t, deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReplaceByType_RollsBackOnInsertError(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	failure := errors.New("Error 1406: Data too long for column 'resource_id'")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM resource_context WHERE resource_type = \?`).
+		WithArgs("user").
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectExec(`INSERT INTO resource_context`).WillReturnError(failure)
+	mock.ExpectExec(`INSERT INTO resource_context`).WillReturnError(failure)
+	mock.ExpectRollback()
+
+	err := repo.ReplaceByType("user", batchOf(1))
+
+	var batchErr *BatchInsertError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 0, batchErr.Index)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReplaceByType_RollsBackOnDeleteError(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM resource_context`).WillReturnError(errors.New("lock wait timeout"))
+	mock.ExpectRollback()
+
+	assert.ErrorContains(t, repo.ReplaceByType("user", batchOf(1)), "lock wait timeout")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReplaceByType_RejectsOtherTypes(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	records := batchOf(2)
+	records[1].ResourceType = "document"
+
+	err := repo.ReplaceByType("user", records)
+	assert.EqualError(t, err, "record 2 has resource_type 'document', expected 'user'")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImportBatch_KeepsTimestamps(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	created := time.Date(2023, 5, 1, 8, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	updated := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	records := []Record{{ResourceID: "user-1", ResourceType: "user", CreatedAt: created, UpdatedAt: updated}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO resource_context \(resource_id, resource_type, context, created_at, updated_at, metadata, claimed_at\) VALUES \(\?, \?, \?, \?, \?, \?, \?\) ON DUPLICATE KEY UPDATE resource_id = resource_id$`).
+		WithArgs("user-1", "user", nil, created.UTC(), updated, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.ImportBatch(records, ImportSkip, nil))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImportBatch_Overwrite(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`VALUES \(\?, \?, \?, \?, \?, \?, \?\) ON DUPLICATE KEY UPDATE context = VALUES\(context\), created_at = VALUES\(created_at\), updated_at = VALUES\(updated_at\), metadata = VALUES\(metadata\), claimed_at = VALUES\(claimed_at\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.ImportBatch(batchOf(1), ImportOverwrite, nil))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImportBatch_ReportsFailingRecord(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO resource_context`).WillReturnError(errors.New("Data too long for column 'resource_id'"))
+	mock.ExpectExec(`INSERT INTO resource_context`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO resource_context`).WillReturnError(errors.New("Data too long for column 'resource_id'"))
+	mock.ExpectRollback()
+
+	err := repo.ImportBatch(batchOf(3), ImportSkip, nil)
+	var batchErr *BatchInsertError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 1, batchErr.Index)
+	assert.Equal(t, RecordKey{ResourceType: "user", ResourceID: "user-1"}, batchErr.Key)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestParseImportMode(t *testing.T) {
+	mode, err := ParseImportMode("overwrite")
+	require.NoError(t, err)
+	assert.Equal(t, ImportOverwrite, mode)
+
+	_, err = ParseImportMode("merge")
+	assert.EqualError(t, err, "invalid import mode 'merge': must be skip or overwrite")
+
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+	assert.EqualError(t, repo.ImportBatch(batchOf(1), "merge", nil), "invalid import mode 'merge': must be skip or overwrite")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The benchmarks of the paths that do not touch the database: continuation
+// tokens, which every page request decodes and every page response encodes, and
+// the JSON of a page of records. Benchmarks against MariaDB, of paginated reads
+// at several table sizes and of inserts, are in the integration package.
+
+// benchCursor is the cursor of a page deep into a listing ordered by created_at.
+var benchCursor = cursor{
+	ResourceType: "user",
+	ResourceID:   "user-8c2f4e1a-93b7-4d0e-a5f6-1b2c3d4e5f60",
+	CreatedAt:    time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+	Page:         42,
+	Snapshot:     time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC),
+}
+
+// benchTokenRepos returns a repository issuing plain tokens and one issuing
+// encrypted tokens.
+func benchTokenRepos(b *testing.B) map[string]*RecordRepository {
+	encrypted := NewRecordRepository(nil)
+	if err := encrypted.EnableTokenEncryption([]byte("0123456789abcdef0123456789abcdef")); err != nil {
+		b.Fatal(err)
+	}
+	return map[string]*RecordRepository{"plain": NewRecordRepository(nil), "encrypted": encrypted}
+}
+
+func BenchmarkEncodeContinuationToken(b *testing.B) {
+	repos := benchTokenRepos(b)
+	for _, name := range []string{"plain", "encrypted"} {
+		repo := repos[name]
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				repo.encodeContinuationToken(benchCursor)
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeContinuationToken(b *testing.B) {
+	repos := benchTokenRepos(b)
+	for _, name := range []string{"plain", "encrypted"} {
+		repo := repos[name]
+		token := repo.encodeContinuationToken(benchCursor)
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.decodeContinuationToken(token); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// benchPage returns a page of 100 records whose contexts are JSON documents of
+// about contextSize bytes, with metadata.
+func benchPage(contextSize int) *PaginatedResult {
+	context := fmt.Sprintf(`{"note":"%s"}`, strings.Repeat("x", contextSize-len(`{"note":""}`)))
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	token := "eyJ0IjoidXNlciIsImkiOiJ1c2VyLTEwMCIsImMiOjE3MDUzMTQ2MDAsInAiOjF9"
+
+	records := make([]Record, 100)
+	for i := range records {
+		records[i] = Record{
+			ResourceID:   fmt.Sprintf("user-%03d", i),
+			ResourceType: "user",
+			Context:      &context,
+			Metadata:     map[string]string{"source": "import", "region": "eu-west-1"},
+			CreatedAt:    created.Add(-time.Duration(i) * time.Second),
+			UpdatedAt:    created,
+		}
+	}
+	return &PaginatedResult{Records: records, NextContinuationToken: &token, PageDepth: 1}
+}
+
+func BenchmarkPaginatedResultJSON(b *testing.B) {
+	for _, contextSize := range []int{256, 4096, 65536} {
+		page := benchPage(contextSize)
+		encoded, err := json.Marshal(page)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("context=%dB", contextSize), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(encoded)))
+			for i := 0; i < b.N; i++ {
+				if _, err := json.Marshal(page); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ClaimNext claims the oldest unclaimed record of resourceType and returns it, for
+// workers using the table as a simple work queue. The record's claimed_at is set
+// to the current time by a single UPDATE that picks the record, so concurrent
+// callers always claim distinct records: a worker blocked on a record another one
+// is claiming skips it once that claim commits. The claimed record is read back
+// by its seq in the same transaction. Returns ErrNotFound when every record of
+// the type is claimed.
+func (r *RecordRepository) ClaimNext(resourceType string) (*Record, error) {
+	table := r.tableFor(resourceType)
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	// LAST_INSERT_ID(seq) reports the seq of the updated row, which identifies it
+	// within the table
+	query := "UPDATE " + table + " SET claimed_at = ?, seq = LAST_INSERT_ID(seq) WHERE resource_type = ? AND claimed_at IS NULL ORDER BY created_at, resource_id LIMIT 1"
+	result, err := r.exec(tx, "claim_next", query, time.Now().UTC(), resourceType)
+	if err := requireAffected(result, err); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	seq, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	start := time.Now()
+	record, err := scanRecord(tx.QueryRow("SELECT "+recordColumns+" FROM "+table+" WHERE seq = ?", seq).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNotFound
+	}
+	r.logQuery("claim_next_read", start, 1, err)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ClaimedAt returns when the record was claimed by ClaimNext, or nil while it is
+// unclaimed or was read by a query that does not select claimed_at.
+func (r Record) ClaimedAt() *time.Time {
+	return r.claimedAt
+}
+
+// SetClaimedAt sets when the record was claimed, for records written by
+// ImportBatch; nil leaves the record unclaimed.
+func (r *Record) SetClaimedAt(claimedAt *time.Time) {
+	r.claimedAt = claimedAt
+}
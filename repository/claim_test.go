@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimNext(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE resource_context SET claimed_at = \?, seq = LAST_INSERT_ID\(seq\) WHERE resource_type = \? AND claimed_at IS NULL ORDER BY created_at, resource_id LIMIT 1`).
+		WithArgs(sqlmock.AnyArg(), "job").
+		WillReturnResult(sqlmock.NewResult(42, 1))
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context WHERE seq = \?`).
+		WithArgs(42).
+		WillReturnRows(sqlmock.NewRows(recordColumnNames).AddRow("job-1", "job", `{"task":"resize"}`, created, created, nil))
+	mock.ExpectCommit()
+
+	record, err := repo.ClaimNext("job")
+	require.NoError(t, err)
+	assert.Equal(t, "job-1", record.ResourceID)
+	assert.Equal(t, "job", record.ResourceType)
+	assert.Equal(t, `{"task":"resize"}`, *record.Context)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClaimNext_NothingToClaim(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE resource_context SET claimed_at`).
+		WithArgs(sqlmock.AnyArg(), "job").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	_, err := repo.ClaimNext("job")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClaimNext_UpdateError(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE resource_context SET claimed_at`).WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	_, err := repo.ClaimNext("job")
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClaimNext_ConcurrentClaimsGetDistinctRecords(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	// The second UPDATE runs once the first claim committed and, finding job-1
+	// claimed, picks job-2
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	for seq, id := range map[int64]string{1: "job-1", 2: "job-2"} {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE resource_context SET claimed_at`).
+			WithArgs(sqlmock.AnyArg(), "job").
+			WillReturnResult(sqlmock.NewResult(seq, 1))
+		mock.ExpectQuery(`SELECT .* FROM resource_context WHERE seq = \?`).
+			WithArgs(seq).
+			WillReturnRows(sqlmock.NewRows(recordColumnNames).AddRow(id, "job", nil, created, created, nil))
+		mock.ExpectCommit()
+	}
+	mock.MatchExpectationsInOrder(false)
+
+	claimed := make(chan string, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			record, err := repo.ClaimNext("job")
+			if err != nil {
+				claimed <- err.Error()
+				return
+			}
+			claimed <- record.ResourceID
+		}()
+	}
+
+	ids := []string{<-claimed, <-claimed}
+	assert.ElementsMatch(t, []string{"job-1", "job-2"}, ids)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// FuzzDecodeContinuationToken feeds arbitrary strings to the token decoder, both
+// as the token and base64-encoded as its payload, and checks that decoding never
+// panics, fails only with ErrInvalidToken or ErrTokenTooLong, and that every
+// token it accepts re-encodes to a token decoding to the same cursor.
+func FuzzDecodeContinuationToken(f *testing.F) {
+	encode := func(payload string) string { return base64.URLEncoding.EncodeToString([]byte(payload)) }
+
+	issuer := NewRecordRepository(nil)
+	valid := issuer.encodeContinuationToken(cursor{
+		ResourceType: "user",
+		ResourceID:   "user-123",
+		CreatedAt:    time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+		Page:         3,
+		Order:        "updated_at.asc",
+		Snapshot:     time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC),
+	})
+	for _, seed := range []string{
+		valid,
+		valid[:len(valid)/2],
+		valid + "==",
+		encode("user|user-123|1705314600"),
+		encode("user|user-123|1705314600|3"),
+		encode(`{"t":"ユーザー","i":"ü-🙂-é","c":1705314600,"p":2,"n":true}`),
+		encode(`{"t":"user","i":"user-1","c":9223372036854775807,"p":1,"s":-9223372036854775808}`),
+		encode(`{"t":"user","i":"user-1","c":1705314600,"p":9223372036854775807}`),
+		encode(`{"t":"` + strings.Repeat("x", 4096) + `","i":"user-1","c":1705314600,"p":1}`),
+		encode(`{"t":"\xff\xfe","i":"user-1","c":1705314600,"p":1}`),
+		"",
+		"!!!",
+	} {
+		f.Add(seed)
+	}
+
+	// Tokens of any length are decoded, so that the round trip is checked even for
+	// keys whose JSON outgrows the default limit
+	repo := NewRecordRepository(nil)
+	repo.SetMaxTokenLength(0)
+	limited := NewRecordRepository(nil)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		for _, token := range []string{input, encode(input)} {
+			if _, err := limited.decodeContinuationToken(token); err != nil && !errors.Is(err, ErrTokenTooLong) {
+				require.ErrorIs(t, err, ErrInvalidToken)
+			}
+
+			decoded, err := repo.decodeContinuationToken(token)
+			if err != nil {
+				require.ErrorIs(t, err, ErrInvalidToken)
+				continue
+			}
+
+			again, err := repo.decodeContinuationToken(repo.encodeContinuationToken(decoded))
+			require.NoError(t, err, "re-encoding %+v", decoded)
+			assert.Equal(t, decoded.ResourceType, again.ResourceType)
+			assert.Equal(t, decoded.ResourceID, again.ResourceID)
+			assert.True(t, decoded.CreatedAt.Equal(again.CreatedAt), "created_at %s became %s", decoded.CreatedAt, again.CreatedAt)
+			assert.Equal(t, decoded.Seq, again.Seq)
+			assert.Equal(t, decoded.Page, again.Page)
+			assert.Equal(t, decoded.Order, again.Order)
+			assert.True(t, decoded.Snapshot.Equal(again.Snapshot), "snapshot %s became %s", decoded.Snapshot, again.Snapshot)
+			assert.Equal(t, decoded.Backward, again.Backward)
+			assert.Equal(t, decoded.Null, again.Null)
+		}
+	})
+}
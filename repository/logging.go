@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// SetLogger sets the logger receiving a debug message for every query the
+// repository runs, with the query name, its duration and the number of rows read
+// or written. Query arguments are never logged, as they carry record content.
+func (r *RecordRepository) SetLogger(logger *slog.Logger) {
+	r.logger = logger
+}
+
+// logQuery logs a finished query at debug level.
+func (r *RecordRepository) logQuery(name string, start time.Time, rows int64, err error) {
+	ctx := context.Background()
+	if !r.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("query", name),
+		slog.Duration("duration", time.Since(start)),
+		slog.Int64("rows", rows),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	r.logger.LogAttrs(ctx, slog.LevelDebug, "database query", attrs...)
+}
+
+// queryRecords runs a query selecting the standard recordColumns and returns the
+// records, logging it under name.
+func (r *RecordRepository) queryRecords(name, query string, args ...any) ([]Record, error) {
+	start := time.Now()
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		r.logQuery(name, start, 0, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	records, err := scanRecords(rows)
+	r.logQuery(name, start, int64(len(records)), err)
+	return records, err
+}
+
+// queryRecordsLenient works like queryRecords, but skips the rows that cannot be
+// scanned and returns a warning describing each of them. The rows read are the
+// records plus the warnings.
+func (r *RecordRepository) queryRecordsLenient(name, query string, args ...any) ([]Record, []string, error) {
+	start := time.Now()
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		r.logQuery(name, start, 0, err)
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var warnings []string
+	records, err := scanRows(rows, func(row int, err error) {
+		warnings = append(warnings, fmt.Sprintf("row %d skipped: %v", row, err))
+	})
+	r.logQuery(name, start, int64(len(records)), err)
+	if len(warnings) > 0 {
+		r.logger.Warn("skipped rows that could not be scanned", slog.String("query", name), slog.Int("skipped", len(warnings)))
+	}
+	return records, warnings, err
+}
+
+// exec runs a statement on exec, logging it under name with the number of rows it
+// affected.
+func (r *RecordRepository) exec(exec execer, name, query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	result, err := exec.Exec(query, args...)
+
+	var affected int64
+	if err == nil {
+		affected, _ = result.RowsAffected()
+	}
+	r.logQuery(name, start, affected, err)
+	return result, err
+}
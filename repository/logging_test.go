@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logEntries decodes the JSON lines written by a slog JSON handler.
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestQueryLogging(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	repo.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	now := time.Now()
+	mock.ExpectExec(`INSERT INTO resource_context`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context WHERE`).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+			AddRow("user-1", "user", `{"secret":"value"}`, now, now, nil))
+
+	context := `{"secret":"value"}`
+	require.NoError(t, repo.Insert("user-1", "user", &context))
+	_, _, err := repo.GetByKeys([]RecordKey{{ResourceType: "user", ResourceID: "user-1"}})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	entries := logEntries(t, &buf)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "DEBUG", entries[0]["level"])
+	assert.Equal(t, "insert", entries[0]["query"])
+	assert.Equal(t, float64(1), entries[0]["rows"])
+	assert.Equal(t, "get_by_keys", entries[1]["query"])
+	assert.Equal(t, float64(1), entries[1]["rows"])
+	assert.Contains(t, entries[1], "duration")
+	assert.NotContains(t, buf.String(), "secret")
+}
+
+func TestQueryLogging_DisabledAboveDebug(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	repo.SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM resource_context`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	count, err := repo.Count()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+	assert.Empty(t, buf.String())
+}
+
+func TestQueryLogging_Error(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	repo.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	mock.ExpectExec(`DELETE FROM resource_context`).WillReturnError(assert.AnError)
+
+	err := repo.Delete("user-1", "user")
+	require.Error(t, err)
+
+	entries := logEntries(t, &buf)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "delete", entries[0]["query"])
+	assert.Equal(t, assert.AnError.Error(), entries[0]["error"])
+}
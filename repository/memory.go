@@ -0,0 +1,657 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryRepository keeps records in memory and implements the same reads and
+// writes as RecordRepository, for tests and fakes that should not need MariaDB.
+// Its listings are ordered, filtered and paginated like the SQL queries, and its
+// continuation tokens are encoded exactly like RecordRepository's, so a client
+// walking its pages follows real tokens. Timestamps are truncated to the second,
+// as the TIMESTAMP columns store them. Strings are compared byte by byte, which
+// may order letter case differently from the server's collation.
+//
+// It is safe for concurrent use. It has no SQL to explain, so Explain and
+// ExplainPaginated fail with errors.ErrUnsupported.
+type MemoryRepository struct {
+	mu      sync.Mutex
+	records map[RecordKey]Record
+	seq     int64
+
+	// tokens encodes and decodes the continuation tokens and holds the settings;
+	// it has no database.
+	tokens *RecordRepository
+}
+
+// NewMemoryRepository returns an empty MemoryRepository with the default
+// settings of NewRecordRepository.
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{records: map[RecordKey]Record{}, tokens: NewRecordRepository(nil)}
+}
+
+// SetGetAllLimit sets the hard cap on rows returned by GetAll. A value of 0
+// removes the cap.
+func (m *MemoryRepository) SetGetAllLimit(limit int) {
+	m.tokens.SetGetAllLimit(limit)
+}
+
+// SetMaxPageDepth sets how many pages deep a client may paginate before
+// ErrPaginationTooDeep is returned. A value of 0 disables the limit.
+func (m *MemoryRepository) SetMaxPageDepth(maxPageDepth int) {
+	m.tokens.SetMaxPageDepth(maxPageDepth)
+}
+
+// Load stores fixture records with the timestamps they carry, so that tests can
+// lay out a listing in advance. A zero CreatedAt is set to the current time and
+// a zero UpdatedAt to CreatedAt. Either every record is stored or, when a record
+// has no key or its key is taken, none is and the error is a *BatchInsertError
+// naming it.
+func (m *MemoryRepository) Load(records ...Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := memoryNow()
+	stored := make([]Record, len(records))
+	for i, record := range records {
+		if record.CreatedAt.IsZero() {
+			record.CreatedAt = now
+		}
+		if record.UpdatedAt.IsZero() {
+			record.UpdatedAt = record.CreatedAt
+		}
+		stored[i] = newMemoryRecord(record.ResourceID, record.ResourceType, record.Context, record.Metadata, record.CreatedAt, record.UpdatedAt)
+	}
+	return m.insertAll(stored)
+}
+
+// memoryNow returns the current time as a TIMESTAMP column stores it.
+func memoryNow() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// newMemoryRecord returns a record as the repository stores it, with copies of
+// the caller's context and metadata so that later changes to them do not leak
+// in, and an empty metadata map stored as none, like a NULL column.
+func newMemoryRecord(resourceID, resourceType string, context *string, metadata map[string]string, createdAt, updatedAt time.Time) Record {
+	record := Record{
+		ResourceID:   resourceID,
+		ResourceType: resourceType,
+		CreatedAt:    createdAt.UTC().Truncate(time.Second),
+		UpdatedAt:    updatedAt.UTC().Truncate(time.Second),
+	}
+	if context != nil {
+		value := *context
+		record.Context = &value
+	}
+	if len(metadata) > 0 {
+		record.Metadata = maps.Clone(metadata)
+	}
+	return record
+}
+
+// clone returns a copy of a stored record that the caller may modify.
+func (record Record) clone() Record {
+	clone := newMemoryRecord(record.ResourceID, record.ResourceType, record.Context, record.Metadata, record.CreatedAt, record.UpdatedAt)
+	clone.seq = record.seq
+	return clone
+}
+
+// insertAll stores records numbered in order, or none of them when one has no key
+// or a taken one. The caller holds m.mu.
+func (m *MemoryRepository) insertAll(records []Record) error {
+	seen := make(map[RecordKey]bool, len(records))
+	for i, record := range records {
+		key := RecordKey{ResourceType: record.ResourceType, ResourceID: record.ResourceID}
+		var err error
+		switch {
+		case key.ResourceType == "" || key.ResourceID == "":
+			err = errors.New("resource_id and resource_type are required")
+		case seen[key]:
+			err = fmt.Errorf("%w: listed twice", ErrDuplicate)
+		default:
+			if _, found := m.records[key]; found {
+				err = ErrDuplicate
+			}
+		}
+		if err != nil {
+			return &BatchInsertError{Index: i, Key: key, Err: err}
+		}
+		seen[key] = true
+	}
+
+	for _, record := range records {
+		m.seq++
+		record.seq = m.seq
+		m.records[RecordKey{ResourceType: record.ResourceType, ResourceID: record.ResourceID}] = record
+	}
+	return nil
+}
+
+// CreateTable does nothing: the records need no table.
+func (m *MemoryRepository) CreateTable() error {
+	return nil
+}
+
+// Insert adds a new record with both timestamps set to the current time. Returns
+// an error wrapping ErrDuplicate if a record with the same composite key exists.
+func (m *MemoryRepository) Insert(resourceID, resourceType string, context *string) error {
+	return m.InsertWithMetadata(resourceID, resourceType, context, nil)
+}
+
+// InsertWithMetadata works like Insert but also stores the given metadata.
+func (m *MemoryRepository) InsertWithMetadata(resourceID, resourceType string, context *string, metadata map[string]string) error {
+	_, err := m.InsertReturning(resourceID, resourceType, context, metadata)
+	return err
+}
+
+// InsertReturning works like InsertWithMetadata and returns the record as stored.
+func (m *MemoryRepository) InsertReturning(resourceID, resourceType string, context *string, metadata map[string]string) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := RecordKey{ResourceType: resourceType, ResourceID: resourceID}
+	if _, found := m.records[key]; found {
+		return nil, fmt.Errorf("%w: %s/%s", ErrDuplicate, resourceType, resourceID)
+	}
+
+	now := memoryNow()
+	record := newMemoryRecord(resourceID, resourceType, context, metadata, now, now)
+	m.seq++
+	record.seq = m.seq
+	m.records[key] = record
+
+	stored := record.clone()
+	return &stored, nil
+}
+
+// GetByID retrieves a single record by its composite key. Returns ErrNotFound if
+// no such record exists.
+func (m *MemoryRepository) GetByID(resourceID, resourceType string) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, found := m.records[RecordKey{ResourceType: resourceType, ResourceID: resourceID}]
+	if !found {
+		return nil, ErrNotFound
+	}
+	record = record.clone()
+	return &record, nil
+}
+
+// GetByIDFields works like GetByID but leaves the fields that are not selected
+// empty, like RecordRepository.GetByIDFields.
+func (m *MemoryRepository) GetByIDFields(resourceID, resourceType string, fields []string) (*Record, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: no fields selected", ErrUnknownField)
+	}
+	for _, field := range fields {
+		if !slices.Contains(RecordFields, field) {
+			return nil, fmt.Errorf("%w '%s'", ErrUnknownField, field)
+		}
+	}
+
+	stored, err := m.GetByID(resourceID, resourceType)
+	if err != nil {
+		return nil, err
+	}
+
+	var record Record
+	for _, field := range fields {
+		switch field {
+		case "resource_id":
+			record.ResourceID = stored.ResourceID
+		case "resource_type":
+			record.ResourceType = stored.ResourceType
+		case "context":
+			record.Context = stored.Context
+		case "metadata":
+			record.Metadata = stored.Metadata
+		case "created_at":
+			record.CreatedAt = stored.CreatedAt
+		case "updated_at":
+			record.UpdatedAt = stored.UpdatedAt
+		}
+	}
+	return &record, nil
+}
+
+// GetByKeys retrieves the records matching the given composite keys, like
+// RecordRepository.GetByKeys.
+func (m *MemoryRepository) GetByKeys(keys []RecordKey) ([]Record, []RecordKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	records := []Record{}
+	missing := []RecordKey{}
+	seen := make(map[RecordKey]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if record, found := m.records[key]; found {
+			records = append(records, record.clone())
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	return records, missing, nil
+}
+
+// ExistingKeys returns the keys that are stored, in the order of keys and without
+// duplicates.
+func (m *MemoryRepository) ExistingKeys(keys []RecordKey) ([]RecordKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing := []RecordKey{}
+	seen := make(map[RecordKey]bool, len(keys))
+	for _, key := range keys {
+		if _, found := m.records[key]; found && !seen[key] {
+			seen[key] = true
+			existing = append(existing, key)
+		}
+	}
+	return existing, nil
+}
+
+// Touch bumps the updated_at timestamp of a record to the current time. Returns
+// ErrNotFound if no record matches the composite key.
+func (m *MemoryRepository) Touch(resourceID, resourceType string) error {
+	return m.touch(resourceID, resourceType, time.Time{})
+}
+
+// TouchIfUnmodifiedSince works like Touch, but only while the record's updated_at
+// is not after since. Returns ErrModified if the record was updated after since.
+func (m *MemoryRepository) TouchIfUnmodifiedSince(resourceID, resourceType string, since time.Time) error {
+	return m.touch(resourceID, resourceType, since)
+}
+
+// touch bumps updated_at of a record not updated after since, or of any record
+// when since is zero.
+func (m *MemoryRepository) touch(resourceID, resourceType string, since time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := RecordKey{ResourceType: resourceType, ResourceID: resourceID}
+	record, found := m.records[key]
+	if !found {
+		return ErrNotFound
+	}
+	if !since.IsZero() && record.UpdatedAt.After(since) {
+		return ErrModified
+	}
+
+	record.UpdatedAt = memoryNow()
+	m.records[key] = record
+	return nil
+}
+
+// Delete removes the record with the given composite key. Returns ErrNotFound if
+// no record matches the composite key.
+func (m *MemoryRepository) Delete(resourceID, resourceType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := RecordKey{ResourceType: resourceType, ResourceID: resourceID}
+	if _, found := m.records[key]; !found {
+		return ErrNotFound
+	}
+	delete(m.records, key)
+	return nil
+}
+
+// DeleteAll deletes every record and returns the number of records deleted.
+func (m *MemoryRepository) DeleteAll() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := int64(len(m.records))
+	clear(m.records)
+	return deleted, nil
+}
+
+// PurgeOlderThan deletes every record created before cutoff and returns the
+// number of records deleted.
+func (m *MemoryRepository) PurgeOlderThan(cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.records)
+	maps.DeleteFunc(m.records, func(_ RecordKey, record Record) bool { return record.CreatedAt.Before(cutoff) })
+	return int64(before - len(m.records)), nil
+}
+
+// ReplaceByType atomically replaces every record of resourceType with the given
+// records, stamped with the current time. On any error the old records are kept.
+func (m *MemoryRepository) ReplaceByType(resourceType string, records []Record) error {
+	now := memoryNow()
+	replacements := make([]Record, len(records))
+	for i, record := range records {
+		if record.ResourceType != resourceType {
+			return fmt.Errorf("record %d has resource_type '%s', expected '%s'", i+1, record.ResourceType, resourceType)
+		}
+		replacements[i] = newMemoryRecord(record.ResourceID, record.ResourceType, record.Context, record.Metadata, now, now)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := maps.Clone(m.records)
+	maps.DeleteFunc(m.records, func(key RecordKey, _ Record) bool { return key.ResourceType == resourceType })
+	if err := m.insertAll(replacements); err != nil {
+		m.records = old
+		return err
+	}
+	return nil
+}
+
+// Count returns the number of records.
+func (m *MemoryRepository) Count() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.records)), nil
+}
+
+// CountApproximate returns the number of records, which the repository always
+// knows exactly.
+func (m *MemoryRepository) CountApproximate() (int64, error) {
+	return m.Count()
+}
+
+// CountByDay returns the number of records created on each UTC day with records
+// between from, inclusive, and to, exclusive, ordered by date.
+func (m *MemoryRepository) CountByDay(from, to time.Time) ([]DayCount, error) {
+	byDay := map[string]int64{}
+	for _, record := range m.all() {
+		if !record.CreatedAt.Before(from) && record.CreatedAt.Before(to) {
+			byDay[record.CreatedAt.Format(DateFormat)]++
+		}
+	}
+
+	counts := make([]DayCount, 0, len(byDay))
+	for day, count := range byDay {
+		counts = append(counts, DayCount{Date: day, Count: count})
+	}
+	slices.SortFunc(counts, func(a, b DayCount) int { return strings.Compare(a.Date, b.Date) })
+	return counts, nil
+}
+
+// LastModified returns the newest updated_at, the zero time when there are no
+// records.
+func (m *MemoryRepository) LastModified() (time.Time, error) {
+	var last time.Time
+	for _, record := range m.all() {
+		if record.UpdatedAt.After(last) {
+			last = record.UpdatedAt
+		}
+	}
+	return last, nil
+}
+
+// all returns copies of every record, in no particular order.
+func (m *MemoryRepository) all() []Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	records := make([]Record, 0, len(m.records))
+	for _, record := range m.records {
+		records = append(records, record.clone())
+	}
+	return records
+}
+
+// sorted returns copies of the records matching match, or of every record when
+// match is nil, in the order scan lists them.
+func (m *MemoryRepository) sorted(scan ordering, match func(Record) bool) []Record {
+	var records []Record
+	for _, record := range m.all() {
+		if match == nil || match(record) {
+			records = append(records, record)
+		}
+	}
+	slices.SortFunc(records, func(a, b Record) int {
+		return scan.compare(scan.position(a), scan.position(b))
+	})
+	return records
+}
+
+// ForEach calls fn for every record, ordered by the composite key. It stops at
+// the first error returned by fn and returns it. fn may use the repository.
+func (m *MemoryRepository) ForEach(fn func(Record) error) error {
+	for _, record := range m.sorted(ordering{expr: "resource_type", asc: true}, nil) {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAll retrieves all records ordered like GetPaginated, at most the configured
+// GetAll limit of them; the boolean result reports whether the result was
+// truncated.
+func (m *MemoryRepository) GetAll() ([]Record, bool, error) {
+	records := m.sorted(byCreated, nil)
+	if limit := m.tokens.current().getAllLimit; limit > 0 && len(records) > limit {
+		return records[:limit], true, nil
+	}
+	return records, false, nil
+}
+
+// GetAllContextFirst works like GetAll, but lists the records with a context
+// before those without.
+func (m *MemoryRepository) GetAllContextFirst() ([]Record, bool, error) {
+	records := m.sorted(byContextFirst, nil)
+	if limit := m.tokens.current().getAllLimit; limit > 0 && len(records) > limit {
+		return records[:limit], true, nil
+	}
+	return records, false, nil
+}
+
+// GetAllLenient works like GetAll. Every stored record can be read, so it never
+// returns warnings.
+func (m *MemoryRepository) GetAllLenient() ([]Record, bool, []string, error) {
+	records, truncated, err := m.GetAll()
+	return records, truncated, nil, err
+}
+
+// GetGroupedByType returns every record keyed by resource_type, each group ordered
+// like the default listing. A positive perTypeLimit keeps only the newest
+// perTypeLimit records of each type.
+func (m *MemoryRepository) GetGroupedByType(perTypeLimit int) (map[string][]Record, error) {
+	groups := make(map[string][]Record)
+	for _, record := range m.sorted(byCreated, nil) {
+		if perTypeLimit > 0 && len(groups[record.ResourceType]) >= perTypeLimit {
+			continue
+		}
+		groups[record.ResourceType] = append(groups[record.ResourceType], record)
+	}
+	return groups, nil
+}
+
+// GetPaginated retrieves a page of the listing ordered by created_at,
+// resource_type and resource_id, all descending, like
+// RecordRepository.GetPaginated. The first page carries a SinceToken.
+func (m *MemoryRepository) GetPaginated(continuationToken string, pageSize int) (*PaginatedResult, error) {
+	result, err := m.paginate(byCreated, nil, continuationToken, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if continuationToken == "" && len(result.Records) > 0 {
+		since := m.tokens.sinceToken(result.Records[0])
+		result.SinceToken = &since
+	}
+	return result, nil
+}
+
+// GetPaginatedLenient works like GetPaginated. Every stored record can be read,
+// so its pages never carry warnings.
+func (m *MemoryRepository) GetPaginatedLenient(continuationToken string, pageSize int) (*PaginatedResult, error) {
+	return m.GetPaginated(continuationToken, pageSize)
+}
+
+// GetPaginatedByType works like GetPaginated but only returns records of the given
+// resource_type.
+func (m *MemoryRepository) GetPaginatedByType(resourceType, continuationToken string, pageSize int) (*PaginatedResult, error) {
+	return m.GetPaginatedFiltered(PaginationFilter{ResourceType: resourceType}, continuationToken, pageSize)
+}
+
+// GetWithoutContext works like GetPaginated but only returns records whose context
+// is nil.
+func (m *MemoryRepository) GetWithoutContext(continuationToken string, pageSize int) (*PaginatedResult, error) {
+	return m.GetPaginatedFiltered(PaginationFilter{MissingContext: true}, continuationToken, pageSize)
+}
+
+// GetPaginatedFiltered works like GetPaginated but only returns the records
+// matching every non-empty field of the filter.
+func (m *MemoryRepository) GetPaginatedFiltered(filter PaginationFilter, continuationToken string, pageSize int) (*PaginatedResult, error) {
+	return m.paginate(byCreated, filter.matches, continuationToken, pageSize)
+}
+
+// GetPaginatedSorted works like GetPaginatedFiltered but orders the records by the
+// given sort order, which must be one of SortColumns. Every record is unclaimed,
+// so ordering by claimed_at orders by the key alone.
+func (m *MemoryRepository) GetPaginatedSorted(sort SortOrder, filter PaginationFilter, continuationToken string, pageSize int) (*PaginatedResult, error) {
+	order, err := sort.ordering()
+	if err != nil {
+		return nil, err
+	}
+	return m.paginate(order, filter.matches, continuationToken, pageSize)
+}
+
+// GetActivityFeed pages through every record ordered by the later of created_at
+// and updated_at.
+func (m *MemoryRepository) GetActivityFeed(pageSize int, continuationToken string) (*PaginatedResult, error) {
+	return m.paginate(byActivity, nil, continuationToken, pageSize)
+}
+
+// GetLastPage returns the final page of the GetPaginated listing, with a
+// PrevContinuationToken when newer records exist.
+func (m *MemoryRepository) GetLastPage(pageSize int) (*PaginatedResult, error) {
+	return m.fetchPage(byCreated, nil, pageRequest{backward: true, page: 1, snapshot: time.Now().UTC()}, pageSize), nil
+}
+
+// GetNewer returns the records newer than the one the since token marks, oldest
+// of them first when more than pageSize exist, like RecordRepository.GetNewer.
+func (m *MemoryRepository) GetNewer(sinceToken string, pageSize int) (*NewerResult, error) {
+	since, err := m.tokens.decodeContinuationToken(sinceToken)
+	if err != nil {
+		return nil, err
+	}
+	if since.Order != byCreated.name {
+		return nil, fmt.Errorf("%w: since token issued for a different listing", ErrInvalidToken)
+	}
+
+	page := m.fetchPage(byCreated, nil, pageRequest{after: &since, backward: true, page: 1}, pageSize)
+	result := &NewerResult{Records: page.Records, SinceToken: sinceToken, HasMore: page.PrevContinuationToken != nil}
+	if len(page.Records) > 0 {
+		result.SinceToken = m.tokens.sinceToken(page.Records[0])
+	}
+	return result, nil
+}
+
+// SinceStart returns a since token preceding every record.
+func (m *MemoryRepository) SinceStart() string {
+	return m.tokens.SinceStart()
+}
+
+// ExplainPaginated fails with errors.ErrUnsupported: no query is run.
+func (m *MemoryRepository) ExplainPaginated(continuationToken string, pageSize int) (*ExplainedQuery, error) {
+	return nil, fmt.Errorf("%w: the in-memory repository runs no SQL", errors.ErrUnsupported)
+}
+
+// Explain fails with errors.ErrUnsupported: no query is run.
+func (m *MemoryRepository) Explain(query *ExplainedQuery) ([]PlanRow, error) {
+	return nil, fmt.Errorf("%w: the in-memory repository runs no SQL", errors.ErrUnsupported)
+}
+
+// paginate returns the page a continuation token leads to in the listing with the
+// given order, restricted to the records matching match, or every record when
+// match is nil.
+func (m *MemoryRepository) paginate(order ordering, match func(Record) bool, continuationToken string, pageSize int) (*PaginatedResult, error) {
+	req, err := m.tokens.resumePage(order, continuationToken)
+	if err != nil {
+		return nil, err
+	}
+	return m.fetchPage(order, match, req, pageSize), nil
+}
+
+// fetchPage reads one page of the listing like RecordRepository.fetchPage, with
+// the snapshot and keyset predicates applied to the records in memory.
+func (m *MemoryRepository) fetchPage(order ordering, match func(Record) bool, req pageRequest, pageSize int) *PaginatedResult {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	scan := order
+	if req.backward {
+		scan.asc = !order.asc
+		scan.nullsFirst = !order.nullsFirst
+	}
+
+	records := m.sorted(scan, func(record Record) bool {
+		if match != nil && !match(record) {
+			return false
+		}
+		if req.after == nil {
+			return true
+		}
+		if !req.snapshot.IsZero() && record.CreatedAt.After(req.snapshot) {
+			return false
+		}
+		return scan.compare(scan.position(record), *req.after) > 0
+	})
+
+	hasMore := len(records) > pageSize
+	if hasMore {
+		records = records[:pageSize]
+	}
+	return m.tokens.pageResult(order, req, records, nil, hasMore)
+}
+
+// matches reports whether the record passes every non-empty field of the filter,
+// as the predicates of RecordRepository.filterClauses select it.
+func (f PaginationFilter) matches(record Record) bool {
+	if f.ResourceType != "" && record.ResourceType != f.ResourceType {
+		return false
+	}
+	if slices.Contains(f.ExcludeTypes, record.ResourceType) {
+		return false
+	}
+	if f.MetadataKey != "" {
+		if _, found := record.Metadata[f.MetadataKey]; !found {
+			return false
+		}
+	}
+	if f.IDPrefix != "" && !strings.HasPrefix(record.ResourceID, f.IDPrefix) {
+		return false
+	}
+	if f.MissingContext && record.Context != nil {
+		return false
+	}
+
+	timeBounds := []struct {
+		value, after, before time.Time
+	}{
+		{record.CreatedAt, f.CreatedAfter, f.CreatedBefore},
+		{record.UpdatedAt, f.UpdatedAfter, f.UpdatedBefore},
+	}
+	for _, bound := range timeBounds {
+		if !bound.after.IsZero() && !bound.value.After(bound.after) {
+			return false
+		}
+		if !bound.before.IsZero() && !bound.value.Before(bound.before) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,15 @@
+package repository_test
+
+import (
+	"testing"
+
+	"tokenpagination/handler"
+	"tokenpagination/repository"
+	"tokenpagination/repository/repositorytest"
+)
+
+func TestMemoryRepository_Contract(t *testing.T) {
+	repositorytest.RunContract(t, func(t *testing.T) handler.RecordRepositoryInterface {
+		return repository.NewMemoryRepository()
+	})
+}
@@ -0,0 +1,299 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryFixtures returns n records of alternating types created a minute apart,
+// the newest last, with every third one lacking a context.
+func memoryFixtures(n int) []Record {
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	context := `{"v":1}`
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = Record{
+			ResourceID:   fmt.Sprintf("res-%02d", i),
+			ResourceType: []string{"user", "task"}[i%2],
+			CreatedAt:    start.Add(time.Duration(i) * time.Minute),
+		}
+		if i%3 != 0 {
+			records[i].Context = &context
+		}
+	}
+	return records
+}
+
+// walkMemory follows the next tokens of fetch from the first page and returns the
+// resource_ids of every page.
+func walkMemory(t *testing.T, fetch func(token string) (*PaginatedResult, error)) []string {
+	t.Helper()
+
+	var ids []string
+	token := ""
+	for pages := 0; pages < 100; pages++ {
+		result, err := fetch(token)
+		require.NoError(t, err)
+		for _, record := range result.Records {
+			ids = append(ids, record.ResourceID)
+		}
+		if result.NextContinuationToken == nil {
+			return ids
+		}
+		token = *result.NextContinuationToken
+	}
+	t.Fatal("the walk does not end")
+	return nil
+}
+
+func TestMemoryRepository_LoadKeepsTimestamps(t *testing.T) {
+	repo := NewMemoryRepository()
+	require.NoError(t, repo.Load(memoryFixtures(3)...))
+
+	record, err := repo.GetByID("res-01", "task")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 15, 10, 1, 0, 0, time.UTC), record.CreatedAt)
+	assert.Equal(t, record.CreatedAt, record.UpdatedAt, "a zero updated_at is the created_at")
+
+	result, err := repo.GetPaginated("", 10)
+	require.NoError(t, err)
+	require.Len(t, result.Records, 3)
+	assert.Equal(t, "res-02", result.Records[0].ResourceID, "newest first")
+}
+
+func TestMemoryRepository_LoadIsAtomic(t *testing.T) {
+	repo := NewMemoryRepository()
+	require.NoError(t, repo.Insert("res-01", "task", nil))
+
+	err := repo.Load(memoryFixtures(3)...)
+	assert.ErrorIs(t, err, ErrDuplicate)
+	var batchErr *BatchInsertError
+	require.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, 1, batchErr.Index)
+
+	count, err := repo.Count()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count, "no fixture was stored")
+}
+
+func TestMemoryRepository_ReturnsCopies(t *testing.T) {
+	repo := NewMemoryRepository()
+	context := "original"
+	metadata := map[string]string{"source": "import"}
+	require.NoError(t, repo.InsertWithMetadata("user-1", "user", &context, metadata))
+	context, metadata["source"] = "changed", "changed"
+
+	record, err := repo.GetByID("user-1", "user")
+	require.NoError(t, err)
+	*record.Context = "changed again"
+	record.Metadata["source"] = "changed again"
+
+	record, err = repo.GetByID("user-1", "user")
+	require.NoError(t, err)
+	assert.Equal(t, "original", *record.Context)
+	assert.Equal(t, map[string]string{"source": "import"}, record.Metadata)
+}
+
+func TestMemoryRepository_TokensAreRepositoryTokens(t *testing.T) {
+	repo := NewMemoryRepository()
+	require.NoError(t, repo.Load(memoryFixtures(5)...))
+
+	result, err := repo.GetPaginated("", 2)
+	require.NoError(t, err)
+	require.NotNil(t, result.NextContinuationToken)
+
+	last, err := NewRecordRepository(nil).decodeContinuationToken(*result.NextContinuationToken)
+	require.NoError(t, err)
+	assert.Equal(t, "res-03", last.ResourceID)
+	assert.Equal(t, 1, last.Page)
+	assert.False(t, last.Snapshot.IsZero(), "the first page starts a snapshot")
+
+	_, err = repo.GetActivityFeed(2, *result.NextContinuationToken)
+	assert.ErrorIs(t, err, ErrInvalidToken, "tokens are bound to their listing")
+
+	repo.SetMaxPageDepth(1)
+	_, err = repo.GetPaginated(*result.NextContinuationToken, 2)
+	assert.ErrorIs(t, err, ErrPaginationTooDeep)
+}
+
+func TestMemoryRepository_SnapshotHidesNewRecords(t *testing.T) {
+	repo := NewMemoryRepository()
+	require.NoError(t, repo.Load(memoryFixtures(4)...))
+
+	first, err := repo.GetPaginated("", 2)
+	require.NoError(t, err)
+	require.NoError(t, repo.Load(Record{ResourceID: "later", ResourceType: "user", CreatedAt: time.Now().Add(time.Hour)}))
+
+	second, err := repo.GetPaginated(*first.NextContinuationToken, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"res-01", "res-00"}, []string{second.Records[0].ResourceID, second.Records[1].ResourceID})
+	assert.True(t, second.IsLastPage)
+}
+
+func TestMemoryRepository_Filtered(t *testing.T) {
+	repo := NewMemoryRepository()
+	require.NoError(t, repo.Load(memoryFixtures(10)...))
+
+	ids := walkMemory(t, func(token string) (*PaginatedResult, error) {
+		return repo.GetWithoutContext(token, 2)
+	})
+	assert.Equal(t, []string{"res-09", "res-06", "res-03", "res-00"}, ids)
+
+	filter := PaginationFilter{ResourceType: "user", CreatedAfter: time.Date(2024, 1, 15, 10, 2, 0, 0, time.UTC)}
+	ids = walkMemory(t, func(token string) (*PaginatedResult, error) {
+		return repo.GetPaginatedFiltered(filter, token, 2)
+	})
+	assert.Equal(t, []string{"res-08", "res-06", "res-04"}, ids, "created_after is exclusive")
+}
+
+func TestMemoryRepository_Sorted(t *testing.T) {
+	repo := NewMemoryRepository()
+	require.NoError(t, repo.Load(memoryFixtures(5)...))
+
+	tests := []struct {
+		sort SortOrder
+		want []string
+	}{
+		{SortOrder{Column: "resource_id", Ascending: true}, []string{"res-00", "res-01", "res-02", "res-03", "res-04"}},
+		{SortOrder{Column: seqColumn}, []string{"res-04", "res-03", "res-02", "res-01", "res-00"}},
+		{SortOrder{Column: "resource_type", Ascending: true}, []string{"res-01", "res-03", "res-00", "res-02", "res-04"}},
+		// Unclaimed records share a NULL claimed_at and are ordered by the key
+		{SortOrder{Column: claimedColumn}, []string{"res-04", "res-02", "res-00", "res-03", "res-01"}},
+		// res-00 and res-03 have no context
+		{SortOrder{Column: "created_at", ContextFirst: true}, []string{"res-04", "res-02", "res-01", "res-03", "res-00"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort.Column, func(t *testing.T) {
+			ids := walkMemory(t, func(token string) (*PaginatedResult, error) {
+				return repo.GetPaginatedSorted(tt.sort, PaginationFilter{}, token, 2)
+			})
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+
+	_, err := repo.GetPaginatedSorted(SortOrder{Column: "context"}, PaginationFilter{}, "", 2)
+	assert.ErrorIs(t, err, ErrInvalidSortColumn)
+
+	all, truncated, err := repo.GetAllContextFirst()
+	require.NoError(t, err)
+	assert.False(t, truncated)
+	assert.Equal(t, []string{"task/res-03", "user/res-00"}, recordKeys(all[3:]))
+}
+
+func TestMemoryRepository_LastPageWalksBackward(t *testing.T) {
+	repo := NewMemoryRepository()
+	require.NoError(t, repo.Load(memoryFixtures(5)...))
+
+	last, err := repo.GetLastPage(2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"res-01", "res-00"}, []string{last.Records[0].ResourceID, last.Records[1].ResourceID})
+	assert.True(t, last.IsLastPage)
+	require.NotNil(t, last.PrevContinuationToken)
+
+	prev, err := repo.GetPaginated(*last.PrevContinuationToken, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"res-03", "res-02"}, []string{prev.Records[0].ResourceID, prev.Records[1].ResourceID})
+	require.NotNil(t, prev.NextContinuationToken)
+
+	next, err := repo.GetPaginated(*prev.NextContinuationToken, 2)
+	require.NoError(t, err)
+	assert.Equal(t, last.Records, next.Records)
+}
+
+func TestMemoryRepository_GetNewer(t *testing.T) {
+	repo := NewMemoryRepository()
+	require.NoError(t, repo.Load(memoryFixtures(3)...))
+
+	first, err := repo.GetPaginated("", 10)
+	require.NoError(t, err)
+	require.NotNil(t, first.SinceToken)
+
+	newer, err := repo.GetNewer(*first.SinceToken, 10)
+	require.NoError(t, err)
+	assert.Empty(t, newer.Records)
+	assert.Equal(t, *first.SinceToken, newer.SinceToken)
+
+	require.NoError(t, repo.Insert("res-new", "user", nil))
+	newer, err = repo.GetNewer(*first.SinceToken, 10)
+	require.NoError(t, err)
+	require.Len(t, newer.Records, 1)
+	assert.Equal(t, "res-new", newer.Records[0].ResourceID)
+
+	newer, err = repo.GetNewer(repo.SinceStart(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"res-01", "res-00"}, []string{newer.Records[0].ResourceID, newer.Records[1].ResourceID}, "the oldest newer records come first")
+	assert.True(t, newer.HasMore)
+}
+
+func TestMemoryRepository_TouchIfUnmodifiedSince(t *testing.T) {
+	repo := NewMemoryRepository()
+	require.NoError(t, repo.Load(memoryFixtures(1)...))
+	created := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	assert.ErrorIs(t, repo.TouchIfUnmodifiedSince("res-00", "user", created.Add(-time.Second)), ErrModified)
+	require.NoError(t, repo.TouchIfUnmodifiedSince("res-00", "user", created))
+	assert.ErrorIs(t, repo.TouchIfUnmodifiedSince("missing", "user", created), ErrNotFound)
+
+	modified, err := repo.LastModified()
+	require.NoError(t, err)
+	assert.True(t, modified.After(created))
+}
+
+func TestMemoryRepository_ReplaceByType(t *testing.T) {
+	repo := NewMemoryRepository()
+	require.NoError(t, repo.Load(memoryFixtures(4)...))
+
+	err := repo.ReplaceByType("task", []Record{{ResourceID: "new-1", ResourceType: "task"}, {ResourceID: "new-1", ResourceType: "task"}})
+	assert.ErrorIs(t, err, ErrDuplicate)
+	groups, err := repo.GetGroupedByType(0)
+	require.NoError(t, err)
+	assert.Len(t, groups["task"], 2, "a failed replace keeps the old records")
+
+	require.NoError(t, repo.ReplaceByType("task", []Record{{ResourceID: "new-1", ResourceType: "task"}}))
+	groups, err = repo.GetGroupedByType(0)
+	require.NoError(t, err)
+	require.Len(t, groups["task"], 1)
+	assert.Equal(t, "new-1", groups["task"][0].ResourceID)
+	assert.Len(t, groups["user"], 2)
+}
+
+func TestMemoryRepository_PurgeOlderThan(t *testing.T) {
+	repo := NewMemoryRepository()
+	require.NoError(t, repo.Load(memoryFixtures(5)...))
+
+	deleted, err := repo.PurgeOlderThan(time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Zero(t, deleted, "created_at equal to the cutoff is kept")
+
+	deleted, err = repo.PurgeOlderThan(time.Date(2024, 1, 15, 10, 2, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	count, err := repo.Count()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestMemoryRepository_CountByDay(t *testing.T) {
+	repo := NewMemoryRepository()
+	require.NoError(t, repo.Load(
+		Record{ResourceID: "a", ResourceType: "user", CreatedAt: time.Date(2024, 1, 2, 23, 0, 0, 0, time.UTC)},
+		Record{ResourceID: "b", ResourceType: "user", CreatedAt: time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)},
+		Record{ResourceID: "c", ResourceType: "user", CreatedAt: time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)},
+		Record{ResourceID: "d", ResourceType: "user", CreatedAt: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+	))
+
+	counts, err := repo.CountByDay(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, []DayCount{{Date: "2024-01-01", Count: 2}, {Date: "2024-01-02", Count: 1}}, counts)
+}
+
+func TestMemoryRepository_Explain(t *testing.T) {
+	_, err := NewMemoryRepository().ExplainPaginated("", 10)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+}
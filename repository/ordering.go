@@ -0,0 +1,336 @@
+package repository
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSortColumn is returned when a paginated read is asked to order by a
+// column that is not in SortColumns.
+var ErrInvalidSortColumn = errors.New("invalid sort column")
+
+// SortColumns lists the columns clients may order paginated reads by. Each one is
+// backed by the primary key or an index created by CreateTable.
+var SortColumns = []string{"created_at", "updated_at", "resource_type", "resource_id", seqColumn, claimedColumn}
+
+// seqColumn is the auto-increment column numbering the records of a table in
+// insertion order. Being unique, it orders a listing on its own, with a
+// single-column keyset that no clock skew or shared timestamp can disturb.
+const seqColumn = "seq"
+
+// claimedColumn is the column ClaimNext sets, NULL while a record is unclaimed.
+// Being nullable, it is listed with the NULLs last in either direction, an order
+// MySQL has no NULLS LAST for, so its ORDER BY leads with ISNULL(claimed_at).
+const claimedColumn = "claimed_at"
+
+// contextColumn is the nullable context column. A listing ordered with
+// SortOrder.ContextFirst leads with ISNULL(context), so the records with a context
+// come first and those without follow, each group in the sort order.
+const contextColumn = "context"
+
+// SortOrder selects the leading column and direction of a paginated listing. The
+// primary key columns follow as tiebreakers in the same direction.
+type SortOrder struct {
+	Column    string
+	Ascending bool
+	// ContextFirst lists the records with a context before those without. It
+	// cannot be combined with claimed_at, which already leads with its NULLs.
+	ContextFirst bool
+}
+
+// ordering describes the sort order of a paginated listing. Records are ordered
+// by expr, then by whichever primary key columns are not already expr, all in the
+// same direction.
+type ordering struct {
+	// name identifies the ordering inside continuation tokens; it is empty for the
+	// created_at ordering so tokens issued before orderings existed stay valid.
+	name string
+	expr string
+	asc  bool
+	// nullsFirst lists the records with a NULL expr before the others; it is only
+	// set when a listing with its NULLs last is scanned in reverse.
+	nullsFirst bool
+	// contextFirst groups the records by whether their context is NULL before
+	// ordering them by expr, the NULLs last unless nullsFirst.
+	contextFirst bool
+}
+
+var (
+	byCreated      = ordering{expr: "created_at"}
+	byActivity     = ordering{name: "activity", expr: "GREATEST(created_at, updated_at)"}
+	byContextFirst = ordering{name: "context_first", expr: "created_at", contextFirst: true}
+)
+
+// ordering validates the sort order against SortColumns and returns the matching
+// ordering.
+func (s SortOrder) ordering() (ordering, error) {
+	valid := false
+	for _, column := range SortColumns {
+		if s.Column == column {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return ordering{}, fmt.Errorf("%w '%s': must be one of %s", ErrInvalidSortColumn, s.Column, strings.Join(SortColumns, ", "))
+	}
+
+	if s.ContextFirst && s.Column == claimedColumn {
+		return ordering{}, fmt.Errorf("%w '%s': cannot be combined with context first", ErrInvalidSortColumn, s.Column)
+	}
+
+	var order ordering
+	if s.Column == "created_at" && !s.Ascending {
+		order = byCreated
+	} else {
+		direction := "desc"
+		if s.Ascending {
+			direction = "asc"
+		}
+		order = ordering{name: s.Column + "." + direction, expr: s.Column, asc: s.Ascending}
+	}
+
+	if s.ContextFirst {
+		// The name keeps tokens of the plain ordering from resuming this one
+		order.contextFirst = true
+		order.name = strings.TrimPrefix(order.name+".context_first", ".")
+	}
+	return order, nil
+}
+
+// columns returns the full ORDER BY column list: the sort expression followed by
+// the primary key tiebreakers.
+func (o ordering) columns() []string {
+	switch o.expr {
+	case "resource_type":
+		return []string{"resource_type", "resource_id"}
+	case "resource_id":
+		return []string{"resource_id", "resource_type"}
+	case seqColumn:
+		return []string{seqColumn}
+	default:
+		return []string{o.expr, "resource_type", "resource_id"}
+	}
+}
+
+// selectColumns returns the columns a page query in the ordering selects: the
+// record columns, followed by seq when the cursor carries it.
+func (o ordering) selectColumns() string {
+	switch o.expr {
+	case seqColumn, claimedColumn:
+		return recordColumns + ", " + o.expr
+	}
+	return recordColumns
+}
+
+// nullColumn returns the nullable column the ordering groups its records by,
+// listing those with a NULL after the others unless nullsFirst: the sort column
+// when it is claimed_at, context for a context first ordering, and empty when the
+// ordering groups by none.
+func (o ordering) nullColumn() string {
+	switch {
+	case o.expr == claimedColumn:
+		return claimedColumn
+	case o.contextFirst:
+		return contextColumn
+	}
+	return ""
+}
+
+// nullable reports whether the ordering groups its records by a nullable column.
+func (o ordering) nullable() bool {
+	return o.nullColumn() != ""
+}
+
+// isNull reports whether the record's value of the ordering's nullable column is
+// NULL.
+func (o ordering) isNull(record Record) bool {
+	switch o.nullColumn() {
+	case claimedColumn:
+		return record.claimedAt == nil
+	case contextColumn:
+		return record.Context == nil
+	}
+	return false
+}
+
+// snapshots reports whether the listing hides records created after its first
+// page. A seq ordering needs no snapshot, as records inserted later are numbered
+// after every existing one and never land between the pages already served.
+func (o ordering) snapshots() bool {
+	return o.expr != seqColumn
+}
+
+// orderBy returns the ORDER BY clause body for the ordering.
+func (o ordering) orderBy() string {
+	direction := " DESC"
+	if o.asc {
+		direction = " ASC"
+	}
+
+	var terms []string
+	if o.nullable() {
+		// ISNULL is 0 for values and 1 for NULLs, so ascending lists the NULLs last
+		nulls := " ASC"
+		if o.nullsFirst {
+			nulls = " DESC"
+		}
+		terms = append(terms, "ISNULL("+o.nullColumn()+")"+nulls)
+	}
+	for _, column := range o.columns() {
+		terms = append(terms, column+direction)
+	}
+	return strings.Join(terms, ", ")
+}
+
+// value returns the record's value of the ordering's sort column when that column
+// is a timestamp. Orderings led by a key column carry their value in the cursor's
+// resource_type and resource_id instead, and the seq ordering in its Seq.
+func (o ordering) value(record Record) time.Time {
+	switch o.expr {
+	case "updated_at":
+		return record.UpdatedAt
+	case claimedColumn:
+		if record.claimedAt == nil {
+			return time.Time{}
+		}
+		return *record.claimedAt
+	case byActivity.expr:
+		if record.UpdatedAt.After(record.CreatedAt) {
+			return record.UpdatedAt
+		}
+	}
+	return record.CreatedAt
+}
+
+// position returns a cursor at the record's position in the ordering, with no
+// page or snapshot.
+func (o ordering) position(record Record) cursor {
+	return cursor{ResourceType: record.ResourceType, ResourceID: record.ResourceID, CreatedAt: o.value(record), Seq: record.seq, Null: o.isNull(record)}
+}
+
+// compare orders two cursors as the ordering's ORDER BY lists them, returning a
+// negative number when a is listed before b, a positive one when it is listed
+// after b, and zero at the same position. Strings are compared byte by byte,
+// which the server's collation may not do for letter case.
+func (o ordering) compare(a, b cursor) int {
+	columns := o.columns()
+	if o.nullable() {
+		if a.Null != b.Null {
+			// NULLs are listed last unless nullsFirst
+			if a.Null != o.nullsFirst {
+				return 1
+			}
+			return -1
+		}
+		if a.Null && o.nullColumn() == columns[0] {
+			// The records sharing a NULL sort column are ordered by the tiebreakers
+			columns = columns[1:]
+		}
+	}
+
+	for _, column := range columns {
+		var c int
+		switch value := cursorValue(a, column).(type) {
+		case string:
+			c = strings.Compare(value, cursorValue(b, column).(string))
+		case int64:
+			c = cmp.Compare(value, cursorValue(b, column).(int64))
+		case time.Time:
+			c = value.Compare(cursorValue(b, column).(time.Time))
+		}
+		if c != 0 {
+			if !o.asc {
+				return -c
+			}
+			return c
+		}
+	}
+	return 0
+}
+
+// cursorValue returns the cursor's value for one of the ordering's columns.
+func cursorValue(last cursor, column string) any {
+	switch column {
+	case "resource_type":
+		return last.ResourceType
+	case "resource_id":
+		return last.ResourceID
+	case seqColumn:
+		return last.Seq
+	default:
+		return last.CreatedAt
+	}
+}
+
+// keysetAfter returns the predicate selecting records that sort strictly after the
+// cursor in the ordering, with its args. For the default ordering this is
+// created_at < ? OR (created_at = ? AND resource_type < ?) OR (... AND resource_id < ?).
+//
+// Comparisons with NULL are never true, so for a nullable column the records with
+// a NULL value are selected explicitly: after a cursor with a value they follow
+// when the NULLs are listed last, and after a NULL cursor the records sharing its
+// NULL are ordered by the tiebreakers alone. When the nullable column is not the
+// sort column, as for context first, both groups are ordered by every column and
+// the group of the cursor is part of the predicate.
+func keysetAfter(order ordering, last cursor) (string, []any) {
+	op := " < ?"
+	if order.asc {
+		op = " > ?"
+	}
+
+	columns := order.columns()
+	if !order.nullable() {
+		return keysetOver(columns, op, last)
+	}
+
+	column := order.nullColumn()
+	grouped := column != columns[0]
+	if last.Null {
+		within := columns
+		if !grouped {
+			within = columns[1:]
+		}
+		keyset, args := keysetOver(within, op, last)
+		after := "(" + column + " IS NULL AND " + keyset + ")"
+		if order.nullsFirst {
+			after = "(" + after + " OR " + column + " IS NOT NULL)"
+		}
+		return after, args
+	}
+
+	keyset, args := keysetOver(columns, op, last)
+	if grouped {
+		keyset = "(" + column + " IS NOT NULL AND " + keyset + ")"
+	}
+	if order.nullsFirst {
+		return keyset, args
+	}
+	return "(" + keyset + " OR " + column + " IS NULL)", args
+}
+
+// keysetOver returns the predicate selecting records that sort strictly after the
+// cursor by columns, all compared with op.
+func keysetOver(columns []string, op string, last cursor) (string, []any) {
+	terms := make([]string, len(columns))
+	var args []any
+	for i, column := range columns {
+		parts := make([]string, 0, i+1)
+		for _, equal := range columns[:i] {
+			parts = append(parts, equal+" = ?")
+			args = append(args, cursorValue(last, equal))
+		}
+		parts = append(parts, column+op)
+		args = append(args, cursorValue(last, column))
+
+		terms[i] = strings.Join(parts, " AND ")
+		if i > 0 {
+			terms[i] = "(" + terms[i] + ")"
+		}
+	}
+
+	return "(" + strings.Join(terms, " OR ") + ")", args
+}
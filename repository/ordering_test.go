@@ -0,0 +1,376 @@
+package repository
+
+import (
+	"cmp"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// walkRecords returns a fixed data set in which many records share created_at,
+// updated_at, resource_type or resource_id, so every listing depends on its
+// tiebreakers to order them. Their seq follows neither created_at nor the keys,
+// as after a bulk import. Unclaimed records, with a NULL claimed_at, are mixed in
+// among claimed ones, several of which share a claim time, and records without a
+// context among those with one.
+func walkRecords() []Record {
+	base := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+	types := []string{"user", "order", "team"}
+
+	var records []Record
+	for i := 0; i < 17; i++ {
+		created := base.Add(time.Duration(i/3) * time.Second)
+		record := Record{
+			ResourceID:   fmt.Sprintf("r-%d", i/2),
+			ResourceType: types[i%3],
+			CreatedAt:    created,
+			UpdatedAt:    created.Add(time.Duration(i*5%4) * time.Second),
+			seq:          int64(i*7%17 + 1),
+		}
+		if i%3 != 1 {
+			claimed := base.Add(time.Duration(i%4) * time.Minute)
+			record.claimedAt = &claimed
+		}
+		if i%5 < 2 {
+			context := fmt.Sprintf(`{"step": %d}`, i)
+			record.Context = &context
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// compareListing compares two records by the listing's leading column followed by
+// the primary key tiebreakers, in ascending order. It is written independently of
+// ordering so that the walk checks the SQL the repository generates against what
+// the listing promises.
+func compareListing(column string, a, b Record) int {
+	switch column {
+	case "resource_type":
+		return firstNonZero(cmp.Compare(a.ResourceType, b.ResourceType), cmp.Compare(a.ResourceID, b.ResourceID))
+	case "resource_id":
+		return firstNonZero(cmp.Compare(a.ResourceID, b.ResourceID), cmp.Compare(a.ResourceType, b.ResourceType))
+	case "seq":
+		return cmp.Compare(a.seq, b.seq)
+	}
+
+	value := func(r Record) time.Time {
+		switch column {
+		case "updated_at":
+			return r.UpdatedAt
+		case "claimed_at":
+			if r.claimedAt == nil {
+				return time.Time{}
+			}
+			return *r.claimedAt
+		case "activity":
+			if r.UpdatedAt.After(r.CreatedAt) {
+				return r.UpdatedAt
+			}
+		}
+		return r.CreatedAt
+	}
+	return firstNonZero(value(a).Compare(value(b)), cmp.Compare(a.ResourceType, b.ResourceType), cmp.Compare(a.ResourceID, b.ResourceID))
+}
+
+// firstNonZero returns the first non-zero comparison result, or 0.
+func firstNonZero(comparisons ...int) int {
+	for _, c := range comparisons {
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// walkListing is a listing under test: how to fetch a page and how its records
+// are expected to be ordered.
+type walkListing struct {
+	name         string
+	column       string
+	ascending    bool
+	contextFirst bool
+	fetch        func(repo *RecordRepository, token string, pageSize int) (*PaginatedResult, error)
+}
+
+// less reports whether a is listed before b. Records without a claimed_at are
+// listed after all others, in either direction, as are records without a context
+// in a context first listing.
+func (l walkListing) less(a, b Record) bool {
+	if l.contextFirst && (a.Context == nil) != (b.Context == nil) {
+		return b.Context == nil
+	}
+	if l.column == "claimed_at" && (a.claimedAt == nil) != (b.claimedAt == nil) {
+		return b.claimedAt == nil
+	}
+	c := compareListing(l.column, a, b)
+	if l.ascending {
+		return c < 0
+	}
+	return c > 0
+}
+
+// sorted returns the records in listing order.
+func (l walkListing) sorted(records []Record) []Record {
+	sorted := slices.Clone(records)
+	slices.SortFunc(sorted, func(a, b Record) int {
+		if l.less(a, b) {
+			return -1
+		}
+		if l.less(b, a) {
+			return 1
+		}
+		return 0
+	})
+	return sorted
+}
+
+func walkListings() []walkListing {
+	var listings []walkListing
+	for _, column := range SortColumns {
+		for _, ascending := range []bool{true, false} {
+			for _, contextFirst := range []bool{false, true} {
+				if contextFirst && column == claimedColumn {
+					continue
+				}
+				sort := SortOrder{Column: column, Ascending: ascending, ContextFirst: contextFirst}
+				listings = append(listings, walkListing{
+					name:         fmt.Sprintf("%s ascending=%t context_first=%t", column, ascending, contextFirst),
+					column:       column,
+					ascending:    ascending,
+					contextFirst: contextFirst,
+					fetch: func(repo *RecordRepository, token string, pageSize int) (*PaginatedResult, error) {
+						return repo.GetPaginatedSorted(sort, PaginationFilter{}, token, pageSize)
+					},
+				})
+			}
+		}
+	}
+	return append(listings, walkListing{
+		name:   "activity",
+		column: "activity",
+		fetch: func(repo *RecordRepository, token string, pageSize int) (*PaginatedResult, error) {
+			return repo.GetActivityFeed(pageSize, token)
+		},
+	})
+}
+
+// pageEmulator answers the page queries of a walk the way the database would: it
+// decodes the continuation token the repository is about to resume from and
+// returns the records following its cursor in the expected order.
+type pageEmulator struct {
+	t        *testing.T
+	mock     sqlmock.Sqlmock
+	repo     *RecordRepository
+	listing  walkListing
+	expected []Record
+}
+
+// expectPage expects the queries fetching the page after token, or the first or
+// last page when token is empty.
+func (e pageEmulator) expectPage(token string, backward bool, pageSize int) {
+	var after *Record
+	if token != "" {
+		last, err := e.repo.decodeContinuationToken(token)
+		require.NoError(e.t, err)
+		backward = last.Backward
+		// The cursor's timestamp stands in for whichever timestamp leads the listing
+		after = &Record{ResourceType: last.ResourceType, ResourceID: last.ResourceID, CreatedAt: last.CreatedAt, UpdatedAt: last.CreatedAt, seq: last.Seq}
+		switch {
+		case e.listing.contextFirst:
+			// The cursor only tells whether its record has a context
+			if !last.Null {
+				context := ""
+				after.Context = &context
+			}
+		case !last.Null:
+			after.claimedAt = &last.CreatedAt
+		}
+	}
+
+	scan := slices.Clone(e.expected)
+	follows := func(r Record) bool { return after == nil || e.listing.less(*after, r) }
+	if backward {
+		slices.Reverse(scan)
+		follows = func(r Record) bool { return after == nil || e.listing.less(r, *after) }
+	}
+
+	var page []Record
+	for _, record := range scan {
+		if follows(record) {
+			page = append(page, record)
+		}
+	}
+
+	limit := pageSize + 1
+	if e.repo.hasMoreStrategy == HasMoreExists {
+		limit = pageSize
+	}
+	remaining := len(page)
+	page = page[:min(limit, len(page))]
+
+	// Listings ordered by seq or claimed_at select it for their cursor
+	columns := recordColumnNames
+	switch e.listing.column {
+	case seqColumn, claimedColumn:
+		columns = append(slices.Clone(recordColumnNames), e.listing.column)
+	}
+	rows := sqlmock.NewRows(columns)
+	for _, record := range page {
+		var context driver.Value
+		if record.Context != nil {
+			context = *record.Context
+		}
+		values := []driver.Value{record.ResourceID, record.ResourceType, context, record.CreatedAt, record.UpdatedAt, nil}
+		switch e.listing.column {
+		case seqColumn:
+			values = append(values, record.seq)
+		case claimedColumn:
+			var claimedAt driver.Value
+			if record.claimedAt != nil {
+				claimedAt = *record.claimedAt
+			}
+			values = append(values, claimedAt)
+		}
+		rows.AddRow(values...)
+	}
+	e.mock.ExpectQuery(`SELECT ` + regexp.QuoteMeta(strings.Join(columns, ", ")) + ` FROM .* ORDER BY`).WillReturnRows(rows)
+
+	if e.repo.hasMoreStrategy == HasMoreExists && len(page) == pageSize {
+		e.mock.ExpectQuery(`SELECT EXISTS`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(remaining > pageSize))
+	}
+}
+
+// recordKeys returns the records' keys, which read better than records in a diff.
+func recordKeys(records []Record) []string {
+	keys := make([]string, len(records))
+	for i, record := range records {
+		keys[i] = record.ResourceType + "/" + record.ResourceID
+	}
+	return keys
+}
+
+// walkForward follows next tokens from the first page to the last and returns the
+// records of all pages in the order they were served.
+func walkForward(t *testing.T, e pageEmulator, pageSize int) []Record {
+	var walked []Record
+	token := ""
+	for depth := 1; depth <= len(e.expected)+1; depth++ {
+		e.expectPage(token, false, pageSize)
+		result, err := e.listing.fetch(e.repo, token, pageSize)
+		require.NoError(t, err)
+
+		assert.Equal(t, depth, result.PageDepth)
+		assert.LessOrEqual(t, len(result.Records), pageSize)
+		assert.Equal(t, result.NextContinuationToken == nil, result.IsLastPage)
+		walked = append(walked, result.Records...)
+
+		if result.NextContinuationToken == nil {
+			return walked
+		}
+		assert.Len(t, result.Records, pageSize, "only the last page may be short")
+		token = *result.NextContinuationToken
+	}
+	t.Fatalf("walk did not end after %d pages", len(e.expected)+1)
+	return nil
+}
+
+// walkBackward starts at the last page and follows previous tokens to the first,
+// returning the records of all pages in listing order.
+func walkBackward(t *testing.T, e pageEmulator, pageSize int) []Record {
+	var walked []Record
+	token := ""
+	for depth := 1; depth <= len(e.expected)+1; depth++ {
+		e.expectPage(token, true, pageSize)
+		var result *PaginatedResult
+		var err error
+		if token == "" {
+			result, err = e.repo.GetLastPage(pageSize)
+		} else {
+			result, err = e.repo.GetPaginated(token, pageSize)
+		}
+		require.NoError(t, err)
+
+		assert.Equal(t, depth, result.PageDepth)
+		walked = append(slices.Clone(result.Records), walked...)
+
+		if result.PrevContinuationToken == nil {
+			return walked
+		}
+		token = *result.PrevContinuationToken
+	}
+	t.Fatalf("walk did not end after %d pages", len(e.expected)+1)
+	return nil
+}
+
+// TestPaginationWalk walks every page of each listing, with page sizes around the
+// edges of the data set and both has-more strategies, and checks that the pages
+// concatenate to exactly the listing's order, without duplicates or gaps. New sort
+// modes added to SortColumns are covered automatically.
+func TestPaginationWalk(t *testing.T) {
+	records := walkRecords()
+	pageSizes := []int{1, 2, 3, 5, len(records) - 1, len(records), len(records) + 1}
+	strategies := map[string]HasMoreStrategy{"fetch extra": HasMoreFetchExtra, "exists": HasMoreExists}
+
+	for _, listing := range walkListings() {
+		expected := listing.sorted(records)
+		for strategyName, strategy := range strategies {
+			for _, pageSize := range pageSizes {
+				t.Run(fmt.Sprintf("%s/%s/page_size=%d", listing.name, strategyName, pageSize), func(t *testing.T) {
+					db, mock, repo := setupTestDB(t)
+					defer db.Close()
+					repo.SetHasMoreStrategy(strategy)
+
+					e := pageEmulator{t: t, mock: mock, repo: repo, listing: listing, expected: expected}
+					walked := walkForward(t, e, pageSize)
+
+					assert.Equal(t, recordKeys(expected), recordKeys(walked))
+					assert.NoError(t, mock.ExpectationsWereMet())
+				})
+			}
+		}
+	}
+}
+
+func TestPaginationWalk_Backward(t *testing.T) {
+	records := walkRecords()
+	listing := walkListing{name: "created_at", column: "created_at"}
+	expected := listing.sorted(records)
+
+	for _, pageSize := range []int{1, 2, 3, 5, len(records), len(records) + 1} {
+		t.Run(fmt.Sprintf("page_size=%d", pageSize), func(t *testing.T) {
+			db, mock, repo := setupTestDB(t)
+			defer db.Close()
+
+			e := pageEmulator{t: t, mock: mock, repo: repo, listing: listing, expected: expected}
+			walked := walkBackward(t, e, pageSize)
+
+			assert.Equal(t, recordKeys(expected), recordKeys(walked))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestPaginationWalk_MatchesGetAll checks that GetAll orders by the same columns as
+// the default listing, so the pages of GetPaginated concatenate to GetAll's result.
+func TestPaginationWalk_MatchesGetAll(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	query, _, _ := repo.pageQuery(byCreated, repo.readSource(), nil, nil, pageRequest{page: 1}, DefaultPageSize)
+	orderBy := regexp.MustCompile(`ORDER BY .* LIMIT \?$`).FindString(query)
+	require.NotEmpty(t, orderBy)
+
+	mock.ExpectQuery(regexp.QuoteMeta(orderBy)).WillReturnRows(sqlmock.NewRows(recordColumnNames))
+	_, _, err := repo.GetAll()
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
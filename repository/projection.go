@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RecordFields lists the fields a projection can select, by their JSON names,
+// which are also their column names.
+var RecordFields = []string{"resource_id", "resource_type", "context", "metadata", "created_at", "updated_at"}
+
+// ErrUnknownField is returned for a field mask naming a field outside RecordFields.
+var ErrUnknownField = errors.New("unknown field")
+
+// ParseFields parses a comma-separated field mask such as "resource_id,context".
+// Surrounding spaces are ignored and duplicates collapsed; empty and unknown names
+// are rejected with ErrUnknownField.
+func ParseFields(value string) ([]string, error) {
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if !slices.Contains(RecordFields, field) {
+			return nil, fmt.Errorf("%w '%s': must be one of %s", ErrUnknownField, field, strings.Join(RecordFields, ", "))
+		}
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// GetByIDFields works like GetByID but only reads the given fields, so that a
+// large context or metadata column is not transferred when it is not wanted. The
+// other fields of the returned record are left empty; use Project to serialize
+// just the selected ones.
+func (r *RecordRepository) GetByIDFields(resourceID, resourceType string, fields []string) (*Record, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: no fields selected", ErrUnknownField)
+	}
+
+	var record Record
+	var metadata sql.NullString
+	dest := make([]any, len(fields))
+	for i, field := range fields {
+		switch field {
+		case "resource_id":
+			dest[i] = &record.ResourceID
+		case "resource_type":
+			dest[i] = &record.ResourceType
+		case "context":
+			dest[i] = &record.Context
+		case "metadata":
+			dest[i] = &metadata
+		case "created_at":
+			dest[i] = &record.CreatedAt
+		case "updated_at":
+			dest[i] = &record.UpdatedAt
+		default:
+			return nil, fmt.Errorf("%w '%s'", ErrUnknownField, field)
+		}
+	}
+
+	query := "SELECT " + strings.Join(fields, ", ") + " FROM " + r.tableFor(resourceType) + " WHERE resource_type = ? AND resource_id = ?"
+	start := time.Now()
+	err := r.db.QueryRow(query, resourceType, resourceID).Scan(dest...)
+	if errors.Is(err, sql.ErrNoRows) {
+		r.logQuery("get_by_id_fields", start, 0, nil)
+		return nil, ErrNotFound
+	}
+	r.logQuery("get_by_id_fields", start, 1, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata.Valid {
+		if err := json.Unmarshal([]byte(metadata.String), &record.Metadata); err != nil {
+			return nil, fmt.Errorf("invalid metadata for %s/%s: %v", resourceType, resourceID, err)
+		}
+	}
+
+	return &record, nil
+}
+
+// Project serializes only the given fields of the record, in its usual JSON form
+// including the timestamp format. Selected fields that are empty, such as a NULL
+// context, are included as null rather than omitted.
+func (r Record) Project(fields []string) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	projected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		value, ok := all[field]
+		if !ok {
+			value = json.RawMessage("null")
+		}
+		projected[field] = value
+	}
+	return projected, nil
+}
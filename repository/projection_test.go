@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFields(t *testing.T) {
+	fields, err := ParseFields(" resource_id,context , resource_id")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"resource_id", "context"}, fields)
+
+	_, err = ParseFields("resource_id,secret")
+	assert.ErrorIs(t, err, ErrUnknownField)
+	assert.ErrorContains(t, err, "unknown field 'secret'")
+
+	_, err = ParseFields("resource_id,")
+	assert.ErrorIs(t, err, ErrUnknownField)
+}
+
+func TestGetByIDFields_SkipsUnselectedColumns(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Unix(1234567890, 0).UTC()
+	mock.ExpectQuery(`^SELECT resource_id, created_at FROM resource_context WHERE resource_type = \? AND resource_id = \?$`).
+		WithArgs("user", "user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "created_at"}).AddRow("user-1", now))
+
+	record, err := repo.GetByIDFields("user-1", "user", []string{"resource_id", "created_at"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", record.ResourceID)
+	assert.Equal(t, now, record.CreatedAt)
+	assert.Nil(t, record.Context)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetByIDFields_ReadsMetadata(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT context, metadata FROM resource_context`).
+		WithArgs("user", "user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"context", "metadata"}).AddRow(nil, `{"tier":"gold"}`))
+
+	record, err := repo.GetByIDFields("user-1", "user", []string{"context", "metadata"})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tier": "gold"}, record.Metadata)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetByIDFields_NotFound(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT context FROM resource_context`).
+		WithArgs("user", "missing").
+		WillReturnRows(sqlmock.NewRows([]string{"context"}))
+
+	_, err := repo.GetByIDFields("missing", "user", []string{"context"})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestGetByIDFields_RejectsUnknownFields(t *testing.T) {
+	repo := NewRecordRepository(nil)
+
+	_, err := repo.GetByIDFields("user-1", "user", []string{"context; DROP TABLE resource_context"})
+	assert.ErrorIs(t, err, ErrUnknownField)
+
+	_, err = repo.GetByIDFields("user-1", "user", nil)
+	assert.ErrorIs(t, err, ErrUnknownField)
+}
+
+func TestRecord_Project(t *testing.T) {
+	record := Record{ResourceID: "user-1", ResourceType: "user", CreatedAt: time.UnixMilli(1234567890123)}
+	record.SetTimestampFormat(TimestampsEpochMillis)
+
+	projected, err := record.Project([]string{"resource_id", "context", "created_at"})
+	require.NoError(t, err)
+
+	data, err := json.Marshal(projected)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"resource_id":"user-1","context":null,"created_at":1234567890123}`, string(data))
+}
@@ -0,0 +1,59 @@
+package repository
+
+// Equal reports whether the two records hold the same data. Context is compared by
+// value, nil and empty metadata are treated alike, and timestamps are compared as
+// instants so records read back in different time zones still compare equal. The
+// JSON timestamp and null context formats are presentation settings and are ignored.
+func (r Record) Equal(other Record) bool {
+	return len(r.Diff(other)) == 0
+}
+
+// Diff returns the JSON names of the fields that differ between the two records,
+// in field order, or nil when the records are equal. Fields are compared as
+// described on Equal.
+func (r Record) Diff(other Record) []string {
+	var changed []string
+
+	if r.ResourceID != other.ResourceID {
+		changed = append(changed, "resource_id")
+	}
+	if r.ResourceType != other.ResourceType {
+		changed = append(changed, "resource_type")
+	}
+	if !equalContext(r.Context, other.Context) {
+		changed = append(changed, "context")
+	}
+	if !equalMetadata(r.Metadata, other.Metadata) {
+		changed = append(changed, "metadata")
+	}
+	if !r.CreatedAt.Equal(other.CreatedAt) {
+		changed = append(changed, "created_at")
+	}
+	if !r.UpdatedAt.Equal(other.UpdatedAt) {
+		changed = append(changed, "updated_at")
+	}
+
+	return changed
+}
+
+// equalContext compares two optional context values. A nil context differs from
+// an empty one, since the column distinguishes NULL from "".
+func equalContext(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// equalMetadata compares two metadata maps by their entries.
+func equalMetadata(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
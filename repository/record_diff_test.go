@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordDiff(t *testing.T) {
+	instant := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	later := instant.Add(time.Second)
+	ctx := `{"name":"Alice"}`
+	sameCtx := `{"name":"Alice"}`
+	otherCtx := `{"name":"Bob"}`
+	empty := ""
+
+	base := Record{ResourceID: "user-1", ResourceType: "user", Context: &ctx, Metadata: map[string]string{"tier": "gold"}, CreatedAt: instant, UpdatedAt: instant}
+
+	tests := []struct {
+		name   string
+		modify func(r *Record)
+		want   []string
+	}{
+		{name: "identical", modify: func(r *Record) {}},
+		{name: "context same value different pointer", modify: func(r *Record) { r.Context = &sameCtx }},
+		{name: "context changed", modify: func(r *Record) { r.Context = &otherCtx }, want: []string{"context"}},
+		{name: "context set to nil", modify: func(r *Record) { r.Context = nil }, want: []string{"context"}},
+		{name: "context nil vs empty", modify: func(r *Record) { r.Context = &empty }, want: []string{"context"}},
+		{name: "metadata changed", modify: func(r *Record) { r.Metadata = map[string]string{"tier": "silver"} }, want: []string{"metadata"}},
+		{name: "metadata key removed", modify: func(r *Record) { r.Metadata = nil }, want: []string{"metadata"}},
+		{name: "updated_at changed", modify: func(r *Record) { r.UpdatedAt = later }, want: []string{"updated_at"}},
+		{name: "same instant other zone", modify: func(r *Record) {
+			r.CreatedAt = instant.In(time.FixedZone("CHAST", 13*3600+45*60))
+		}},
+		{name: "timestamp format ignored", modify: func(r *Record) { r.SetTimestampFormat(TimestampsEpochMillis) }},
+		{name: "several fields", modify: func(r *Record) {
+			r.ResourceID = "user-2"
+			r.Context = nil
+			r.CreatedAt = later
+		}, want: []string{"resource_id", "context", "created_at"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := base
+			tt.modify(&other)
+
+			assert.Equal(t, tt.want, base.Diff(other))
+			assert.Equal(t, tt.want, other.Diff(base))
+			assert.Equal(t, len(tt.want) == 0, base.Equal(other))
+		})
+	}
+}
+
+func TestRecordEqual_NilAndEmptyMetadata(t *testing.T) {
+	a := Record{ResourceID: "user-1", ResourceType: "user"}
+	b := Record{ResourceID: "user-1", ResourceType: "user", Metadata: map[string]string{}}
+
+	assert.True(t, a.Equal(b))
+	assert.Nil(t, a.Diff(b))
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TimestampFormat selects how a Record's created_at and updated_at are serialized.
+type TimestampFormat int
+
+const (
+	// TimestampsRFC3339 emits RFC 3339 strings in UTC. This is the default.
+	TimestampsRFC3339 TimestampFormat = iota
+	// TimestampsEpochMillis emits integer milliseconds since the Unix epoch.
+	TimestampsEpochMillis
+)
+
+// ParseTimestampFormat parses the value of a timestamps query parameter. An empty
+// value selects the default RFC 3339 format.
+func ParseTimestampFormat(value string) (TimestampFormat, error) {
+	switch value {
+	case "", "rfc3339":
+		return TimestampsRFC3339, nil
+	case "epoch_ms":
+		return TimestampsEpochMillis, nil
+	default:
+		return TimestampsRFC3339, fmt.Errorf("invalid timestamps format %q: must be rfc3339 or epoch_ms", value)
+	}
+}
+
+// NullContext selects how a Record without context is serialized.
+type NullContext int
+
+const (
+	// NullContextOmit leaves the context field out. This is the default.
+	NullContextOmit NullContext = iota
+	// NullContextExplicit emits "context": null.
+	NullContextExplicit
+)
+
+// ParseNullContext parses the value of a null_context query parameter. An empty
+// value selects the default of omitting the field.
+func ParseNullContext(value string) (NullContext, error) {
+	switch value {
+	case "", "omit":
+		return NullContextOmit, nil
+	case "explicit":
+		return NullContextExplicit, nil
+	default:
+		return NullContextOmit, fmt.Errorf("invalid null_context %q: must be explicit or omit", value)
+	}
+}
+
+// SetNullContext selects whether a nil context is serialized as null or omitted.
+func (r *Record) SetNullContext(mode NullContext) {
+	r.nullContext = mode
+}
+
+// SetTimestampFormat selects how the record's timestamps are serialized to JSON.
+func (r *Record) SetTimestampFormat(format TimestampFormat) {
+	r.timestampFormat = format
+}
+
+// MarshalJSON serializes the record with its timestamps normalized to UTC, so the
+// output does not depend on the time zone of the server or database session.
+func (r Record) MarshalJSON() ([]byte, error) {
+	type plainRecord Record
+	return json.Marshal(struct {
+		plainRecord
+		Context   any `json:"context,omitempty"`
+		CreatedAt any `json:"created_at"`
+		UpdatedAt any `json:"updated_at"`
+	}{
+		plainRecord: plainRecord(r),
+		Context:     r.nullContext.value(r.Context),
+		CreatedAt:   r.timestampFormat.format(r.CreatedAt),
+		UpdatedAt:   r.timestampFormat.format(r.UpdatedAt),
+	})
+}
+
+// value returns the JSON value for context in this mode. A nil *string wrapped in
+// the interface is not empty and encodes as null, while a nil interface is omitted.
+func (m NullContext) value(context *string) any {
+	if context == nil && m == NullContextOmit {
+		return nil
+	}
+	return context
+}
+
+// format returns the JSON value for t in this format.
+func (f TimestampFormat) format(t time.Time) any {
+	if f == TimestampsEpochMillis {
+		return t.UnixMilli()
+	}
+	return t.UTC()
+}
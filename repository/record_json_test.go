@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useExoticTimeZone switches the process-local time zone to a zone with a
+// non-hour UTC offset for the duration of the test.
+func useExoticTimeZone(t *testing.T) *time.Location {
+	loc, err := time.LoadLocation("Pacific/Chatham")
+	require.NoError(t, err)
+
+	previous := time.Local
+	time.Local = loc
+	t.Cleanup(func() { time.Local = previous })
+
+	return loc
+}
+
+// utcTime matches a time.Time argument in UTC and remembers its value.
+type utcTime struct {
+	got *time.Time
+}
+
+func (m utcTime) Match(v driver.Value) bool {
+	ts, ok := v.(time.Time)
+	if !ok || ts.Location() != time.UTC {
+		return false
+	}
+	*m.got = ts
+	return true
+}
+
+func TestParseTimestampFormat(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    TimestampFormat
+		wantErr bool
+	}{
+		{value: "", want: TimestampsRFC3339},
+		{value: "rfc3339", want: TimestampsRFC3339},
+		{value: "epoch_ms", want: TimestampsEpochMillis},
+		{value: "epoch", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTimestampFormat(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRecordMarshalJSON_NormalizesToUTC(t *testing.T) {
+	loc := useExoticTimeZone(t)
+
+	instant := time.Date(2024, 1, 15, 23, 30, 0, 0, loc)
+	record := Record{ResourceID: "user-1", ResourceType: "user", CreatedAt: instant, UpdatedAt: instant}
+
+	data, err := json.Marshal(record)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"resource_id":"user-1","resource_type":"user","created_at":"2024-01-15T09:45:00Z","updated_at":"2024-01-15T09:45:00Z"}`, string(data))
+}
+
+func TestRecordMarshalJSON_EpochMillis(t *testing.T) {
+	loc := useExoticTimeZone(t)
+
+	instant := time.Date(2024, 1, 15, 23, 30, 0, 123000000, loc)
+	record := Record{ResourceID: "user-1", ResourceType: "user", Metadata: map[string]string{"tier": "gold"}, CreatedAt: instant, UpdatedAt: instant}
+	record.SetTimestampFormat(TimestampsEpochMillis)
+
+	data, err := json.Marshal(record)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"resource_id":"user-1","resource_type":"user","metadata":{"tier":"gold"},"created_at":1705311900123,"updated_at":1705311900123}`, string(data))
+}
+
+func TestRecordMarshalJSON_NullContext(t *testing.T) {
+	instant := time.Date(2024, 1, 15, 9, 45, 0, 0, time.UTC)
+	context := "Test context"
+
+	record := Record{ResourceID: "user-1", ResourceType: "user", CreatedAt: instant, UpdatedAt: instant}
+	data, err := json.Marshal(record)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"context"`)
+
+	record.SetNullContext(NullContextExplicit)
+	data, err = json.Marshal(record)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"context":null`)
+
+	record.Context = &context
+	data, err = json.Marshal(record)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"context":"Test context"`)
+}
+
+func TestParseNullContext(t *testing.T) {
+	for value, want := range map[string]NullContext{"": NullContextOmit, "omit": NullContextOmit, "explicit": NullContextExplicit} {
+		got, err := ParseNullContext(value)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	_, err := ParseNullContext("null")
+	assert.EqualError(t, err, `invalid null_context "null": must be explicit or omit`)
+}
+
+func TestInsert_RoundTripKeepsInstant(t *testing.T) {
+	loc := useExoticTimeZone(t)
+
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	var createdAt, updatedAt time.Time
+	mock.ExpectExec(`INSERT INTO resource_context`).
+		WithArgs("user-1", "user", nil, utcTime{&createdAt}, utcTime{&updatedAt}, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	require.NoError(t, repo.Insert("user-1", "user", nil))
+
+	// The driver may hand the stored value back in any location
+	stored := createdAt.In(loc)
+	mock.ExpectQuery(`FROM resource_context WHERE resource_type = \? AND resource_id = \?`).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+			AddRow("user-1", "user", nil, stored, stored, nil))
+
+	record, err := repo.GetByID("user-1", "user")
+	require.NoError(t, err)
+
+	data, err := json.Marshal(record)
+	require.NoError(t, err)
+
+	var decoded struct {
+		CreatedAt time.Time `json:"created_at"`
+	}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.True(t, decoded.CreatedAt.Equal(createdAt))
+	assert.Equal(t, time.UTC, decoded.CreatedAt.Location())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,134 +1,959 @@
 package repository
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
 	"database/sql"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 type Record struct {
-	ResourceID   string    `json:"resource_id"`
-	ResourceType string    `json:"resource_type"`
-	Context      *string   `json:"context,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ResourceID   string            `json:"resource_id"`
+	ResourceType string            `json:"resource_type"`
+	Context      *string           `json:"context,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+
+	// seq is the record's seq column, only read by listings ordered by it.
+	seq int64
+	// claimedAt is the record's claimed_at column, nil while unclaimed, only read
+	// by listings ordered by it.
+	claimedAt       *time.Time
+	timestampFormat TimestampFormat
+	nullContext     NullContext
+}
+
+// RecordKey identifies a single record by its composite primary key.
+type RecordKey struct {
+	ResourceType string `json:"resource_type" binding:"required"`
+	ResourceID   string `json:"resource_id" binding:"required"`
+}
+
+// PaginationFilter restricts a paginated listing. Empty fields do not filter;
+// all set fields must match.
+type PaginationFilter struct {
+	// ResourceType limits the listing to a single resource_type.
+	ResourceType string
+	// ExcludeTypes leaves the listed resource_types out of the listing.
+	ExcludeTypes []string
+	// MetadataKey limits the listing to records whose metadata contains the key.
+	MetadataKey string
+	// IDPrefix limits the listing to resource_ids starting with the prefix.
+	IDPrefix string
+	// MissingContext limits the listing to records whose context is NULL.
+	MissingContext bool
+	// CreatedAfter and CreatedBefore bound created_at exclusively.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// UpdatedAfter and UpdatedBefore bound updated_at exclusively.
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+}
+
+// IsZero reports whether the filter leaves the listing unrestricted.
+func (f PaginationFilter) IsZero() bool {
+	return f.ResourceType == "" && len(f.ExcludeTypes) == 0 && f.MetadataKey == "" && f.IDPrefix == "" && !f.MissingContext &&
+		f.CreatedAfter.IsZero() && f.CreatedBefore.IsZero() && f.UpdatedAfter.IsZero() && f.UpdatedBefore.IsZero()
 }
 
 type PaginatedResult struct {
-	Records           []Record `json:"records"`
+	Records               []Record `json:"records"`
 	NextContinuationToken *string  `json:"next_continuation_token,omitempty"`
+	// PrevContinuationToken leads to the preceding page. It is only set on pages
+	// reached by walking backward from the end with GetLastPage.
+	PrevContinuationToken *string `json:"prev_continuation_token,omitempty"`
+	// SinceToken is set on the first page of GetPaginated and marks its newest
+	// record, for polling GetNewer.
+	SinceToken *string `json:"since_token,omitempty"`
+	PageDepth  int     `json:"page_depth"`
+	// IsLastPage is true when no further records follow this page, which may
+	// therefore hold fewer than page_size records.
+	IsLastPage bool `json:"is_last_page"`
+	// Warnings describe the rows a lenient read skipped because they could not be
+	// scanned.
+	Warnings []string `json:"warnings,omitempty"`
+	// Total is the number of records across all pages, only set when requested.
+	// TotalApproximate marks a total estimated from table statistics.
+	Total            *int64 `json:"total,omitempty"`
+	TotalApproximate bool   `json:"total_approximate,omitempty"`
+	// RequestedPageSize and RequestToken echo the effective page size and the
+	// continuation token the page was requested with, so that clients can log
+	// what they asked for. They are set by the API, not by the repository.
+	RequestedPageSize int     `json:"requested_page_size,omitempty"`
+	RequestToken      *string `json:"request_token,omitempty"`
 }
 
 const DefaultPageSize = 5
 
+// DefaultGetAllLimit is the maximum number of rows GetAll returns before truncating.
+const DefaultGetAllLimit = 1000
+
+// HasMoreStrategy selects how GetPaginated decides whether another page exists.
+type HasMoreStrategy int
+
+const (
+	// HasMoreFetchExtra fetches pageSize+1 rows and checks for the extra row.
+	// This is the default and needs a single query.
+	HasMoreFetchExtra HasMoreStrategy = iota
+	// HasMoreExists fetches exactly pageSize rows and, when the page is full,
+	// runs a separate EXISTS query. This avoids over-fetching wide rows on
+	// datasets that are known to be large.
+	HasMoreExists
+)
+
+// DefaultMaxPageDepth is the deepest page a client may request by following
+// continuation tokens before GetPaginated returns ErrPaginationTooDeep.
+const DefaultMaxPageDepth = 1000
+
+// DefaultMaxTokenLength is the longest continuation token, in bytes, that is
+// decoded. Tokens issued by the repository for ASCII resource keys stay well below it.
+const DefaultMaxTokenLength = 512
+
+// ErrNotFound is returned when the requested record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// ErrPaginationTooDeep is returned when following a continuation token would go
+// past the configured maximum page depth.
+var ErrPaginationTooDeep = errors.New("pagination too deep")
+
+// ErrTokenTooLong is returned when a continuation token exceeds the configured
+// maximum length. Such tokens are rejected before any decoding work is done.
+var ErrTokenTooLong = errors.New("continuation token too long")
+
+// ErrInvalidToken is returned, wrapped with the reason, when a continuation
+// token cannot be decoded or was issued for a different listing.
+var ErrInvalidToken = errors.New("invalid continuation token")
+
+// ErrDuplicate is returned when an insert conflicts with a stored record of the
+// same composite key.
+var ErrDuplicate = errors.New("record already exists")
+
+// ErrModified is returned by a conditional update when the record was modified
+// after the time the update was conditioned on.
+var ErrModified = errors.New("record modified")
+
 type RecordRepository struct {
-	db *sql.DB
+	db         *sql.DB
+	typeTables map[string]string
+
+	// settings are swapped as a whole by Reconfigure and the setters; settingsMu
+	// serializes the writers.
+	settings   atomic.Pointer[settings]
+	settingsMu sync.Mutex
+
+	hasMoreStrategy HasMoreStrategy
+	logger          *slog.Logger
 }
 
 // NewRecordRepository creates and returns a new RecordRepository instance.
 // It takes a database connection and returns a repository for managing
 // record operations including CRUD and pagination functionality.
 func NewRecordRepository(db *sql.DB) *RecordRepository {
-	return &RecordRepository{db: db}
+	r := &RecordRepository{db: db, logger: slog.Default()}
+	r.settings.Store(&settings{maxPageDepth: DefaultMaxPageDepth, maxTokenLen: DefaultMaxTokenLength, getAllLimit: DefaultGetAllLimit})
+	return r
+}
+
+// SetGetAllLimit sets the hard cap on rows returned by GetAll. A value of 0
+// removes the cap, which should only be done for small tables.
+func (r *RecordRepository) SetGetAllLimit(limit int) {
+	r.update(func(s *settings) { s.getAllLimit = limit })
+}
+
+// SetHasMoreStrategy selects how paginated reads detect whether another page exists.
+func (r *RecordRepository) SetHasMoreStrategy(strategy HasMoreStrategy) {
+	r.hasMoreStrategy = strategy
+}
+
+// SetMaxPageDepth sets how many pages deep a client may paginate before
+// ErrPaginationTooDeep is returned. A value of 0 disables the limit.
+func (r *RecordRepository) SetMaxPageDepth(maxPageDepth int) {
+	r.update(func(s *settings) { s.maxPageDepth = maxPageDepth })
+}
+
+// SetMaxTokenLength sets the longest continuation token, in bytes, that paginated
+// reads accept; longer tokens fail with ErrTokenTooLong. A value of 0 disables the
+// check.
+func (r *RecordRepository) SetMaxTokenLength(maxTokenLength int) {
+	r.update(func(s *settings) { s.maxTokenLen = maxTokenLength })
 }
 
 // CreateTable creates the resource_context table if it doesn't already exist.
 // The table includes resource_id (varchar), resource_type (varchar), context (longtext),
-// created_at and updated_at (timestamp) columns with a composite primary key on
-// (resource_type, resource_id). If the old table structure exists, it drops and recreates it.
+// created_at and updated_at (timestamp) and an optional metadata (json) column
+// with a composite primary key on (resource_type, resource_id). Existing tables
+// keep their records: columns missing from a table created by an older version
+// are added, so the service never runs against a stale schema. It is safe to call
+// on every start. Any shard tables configured with SetTypeTables are created and
+// upgraded with the same schema.
 func (r *RecordRepository) CreateTable() error {
-	// Drop the old table if it exists to handle schema migration
-	dropQuery := "DROP TABLE IF EXISTS resource_context"
-	if _, err := r.db.Exec(dropQuery); err != nil {
-		return err
+	for _, statement := range r.SchemaStatements() {
+		if _, err := r.db.Exec(statement); err != nil {
+			return err
+		}
 	}
 
-	// Create the new table with updated schema
-	createQuery := `
-	CREATE TABLE resource_context (
-		resource_id varchar(128) not null,
-		resource_type varchar(128) not null,
-		context longtext default null,
-		created_at timestamp not null,
-		updated_at timestamp not null,
-		PRIMARY KEY (resource_type, resource_id)
-	)`
+	for _, table := range r.tables() {
+		if err := r.upgradeTable(table); err != nil {
+			return fmt.Errorf("failed to upgrade table %s: %w", table, err)
+		}
+	}
 
-	_, err := r.db.Exec(createQuery)
-	return err
+	return nil
+}
+
+// SchemaStatements returns the CREATE TABLE statements CreateTable executes, in
+// order, so they can be reviewed before being applied. The columns and indexes
+// CreateTable adds to outdated tables depend on the database and are not included.
+func (r *RecordRepository) SchemaStatements() []string {
+	var statements []string
+	for _, table := range r.tables() {
+		statements = append(statements, createTableStatement(table))
+	}
+
+	return statements
+}
+
+// VerifySchema compares every table the repository reads and writes with the
+// schema CreateTable creates, as reported by information_schema, without touching
+// any rows. It lets a server that does not create the schema itself fail fast
+// when migrations have not been applied or a table has drifted, instead of
+// failing at query time. Discrepancies are returned together as a *SchemaError;
+// other errors mean the schema could not be inspected.
+func (r *RecordRepository) VerifySchema() error {
+	var discrepancies []string
+	for _, table := range r.tables() {
+		found, err := r.schemaDiscrepancies(table)
+		if err != nil {
+			return fmt.Errorf("failed to inspect table %s: %w", table, err)
+		}
+		discrepancies = append(discrepancies, found...)
+	}
+
+	if len(discrepancies) > 0 {
+		return &SchemaError{Discrepancies: discrepancies}
+	}
+	return nil
 }
 
 // Insert adds a new record to the database with the specified fields.
-// Both created_at and updated_at are set to the current time.
-// Returns an error if the insertion fails or if a record with the same
-// composite key (resource_type, resource_id) already exists.
+// Both created_at and updated_at are set to the current time in UTC.
+// Returns an error if the insertion fails, wrapping ErrDuplicate if a record with
+// the same composite key (resource_type, resource_id) already exists. The record is
+// written to the shard table configured for its resource_type, if any.
 func (r *RecordRepository) Insert(resourceID, resourceType string, context *string) error {
-	now := time.Now()
-	query := "INSERT INTO resource_context (resource_id, resource_type, context, created_at, updated_at) VALUES (?, ?, ?, ?, ?)"
-	_, err := r.db.Exec(query, resourceID, resourceType, context, now, now)
+	return r.InsertWithMetadata(resourceID, resourceType, context, nil)
+}
+
+// InsertWithMetadata works like Insert but also stores the given key/value
+// metadata, marshaled as a JSON object into the metadata column. A nil or empty
+// map leaves the column NULL.
+func (r *RecordRepository) InsertWithMetadata(resourceID, resourceType string, context *string, metadata map[string]string) error {
+	return r.insert(r.db, resourceID, resourceType, context, metadata)
+}
+
+// InsertReturning works like InsertWithMetadata and returns the record as stored,
+// with the timestamps and metadata the database holds. The INSERT and the SELECT
+// reading it back run in one transaction, so the result is exactly what was
+// written even if the record is changed right after.
+func (r *RecordRepository) InsertReturning(resourceID, resourceType string, context *string, metadata map[string]string) (*Record, error) {
+	tx, err := r.BeginTx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := tx.InsertWithMetadata(resourceID, resourceType, context, metadata); err != nil {
+		return nil, err
+	}
+	record, err := tx.GetByID(resourceID, resourceType)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// insert runs the INSERT of InsertWithMetadata on exec.
+func (r *RecordRepository) insert(exec execer, resourceID, resourceType string, context *string, metadata map[string]string) error {
+	metadataJSON, err := marshalMetadata(metadata)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	query := "INSERT INTO " + r.tableFor(resourceType) + " (resource_id, resource_type, context, created_at, updated_at, metadata) VALUES (?, ?, ?, ?, ?, ?)"
+	_, err = r.exec(exec, "insert", query, resourceID, resourceType, context, now, now, metadataJSON)
+	return duplicateKey(err)
+}
+
+// erDupEntry is the MySQL error number of a statement violating a unique key.
+const erDupEntry = 1062
+
+// duplicateKey wraps a duplicate key error of MySQL with ErrDuplicate and returns
+// other errors unchanged.
+func duplicateKey(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == erDupEntry {
+		return fmt.Errorf("%w: %v", ErrDuplicate, err)
+	}
 	return err
 }
 
-// GetAll retrieves all records from the database ordered by created_at descending.
-// This method returns all records without pagination and is useful for
-// getting a complete dataset or when pagination is not needed.
-func (r *RecordRepository) GetAll() ([]Record, error) {
-	query := "SELECT resource_id, resource_type, context, created_at, updated_at FROM resource_context ORDER BY created_at DESC"
-	rows, err := r.db.Query(query)
+// marshalMetadata encodes metadata for the metadata column, returning nil for a
+// nil or empty map so that the column stays NULL.
+func marshalMetadata(metadata map[string]string) (*string, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(metadata)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	value := string(encoded)
+	return &value, nil
+}
+
+// Touch bumps the updated_at timestamp of a record to the current time without
+// changing its content, for sync protocols that mark records as recently seen.
+// Returns ErrNotFound if no record matches the composite key.
+func (r *RecordRepository) Touch(resourceID, resourceType string) error {
+	return r.touch(r.db, resourceID, resourceType)
+}
+
+// touch runs the UPDATE of Touch on exec.
+func (r *RecordRepository) touch(exec execer, resourceID, resourceType string) error {
+	query := "UPDATE " + r.tableFor(resourceType) + " SET updated_at = ? WHERE resource_type = ? AND resource_id = ?"
+	result, err := r.exec(exec, "touch", query, time.Now().UTC(), resourceType, resourceID)
+	return requireAffected(result, err)
+}
+
+// TouchIfUnmodifiedSince works like Touch, but only while the record's updated_at
+// is not after since, so a client never bumps a record changed since it last read
+// it. The guard is part of the UPDATE, so no concurrent write can slip between
+// the check and the update. Returns ErrModified if the record was updated after
+// since and ErrNotFound if no record matches the composite key.
+func (r *RecordRepository) TouchIfUnmodifiedSince(resourceID, resourceType string, since time.Time) error {
+	query := "UPDATE " + r.tableFor(resourceType) + " SET updated_at = ? WHERE resource_type = ? AND resource_id = ? AND updated_at <= ?"
+	result, err := r.exec(r.db, "touch_if_unmodified", query, time.Now().UTC(), resourceType, resourceID, since.UTC())
+	if err := requireAffected(result, err); !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	// No row matched: either the record is missing or the guard failed
+	if _, err := r.getByID(r.db, resourceID, resourceType); err != nil {
+		return err
+	}
+	return ErrModified
+}
+
+// Delete removes the record with the given composite key.
+// Returns ErrNotFound if no record matches the composite key.
+func (r *RecordRepository) Delete(resourceID, resourceType string) error {
+	return r.delete(r.db, resourceID, resourceType)
+}
+
+// delete runs the DELETE of Delete on exec.
+func (r *RecordRepository) delete(exec execer, resourceID, resourceType string) error {
+	query := "DELETE FROM " + r.tableFor(resourceType) + " WHERE resource_type = ? AND resource_id = ?"
+	result, err := r.exec(exec, "delete", query, resourceType, resourceID)
+	return requireAffected(result, err)
+}
+
+// requireAffected passes through the error of a single-record statement and
+// returns ErrNotFound when the statement matched no row.
+func requireAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetByID retrieves a single record by its composite key from the table that
+// stores its resource_type. Returns ErrNotFound if no such record exists.
+func (r *RecordRepository) GetByID(resourceID, resourceType string) (*Record, error) {
+	return r.getByID(r.db, resourceID, resourceType)
+}
+
+// getByID runs the SELECT of GetByID on q.
+func (r *RecordRepository) getByID(q rowQueryer, resourceID, resourceType string) (*Record, error) {
+	query := "SELECT " + recordColumns + " FROM " + r.tableFor(resourceType) + " WHERE resource_type = ? AND resource_id = ?"
+
+	start := time.Now()
+	record, err := scanRecord(q.QueryRow(query, resourceType, resourceID).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		r.logQuery("get_by_id", start, 0, nil)
+		return nil, ErrNotFound
+	}
+	r.logQuery("get_by_id", start, 1, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// GetAll retrieves all records from the database ordered by created_at descending,
+// with the same tiebreakers as GetPaginated, so walking every page of GetPaginated
+// yields the same sequence. This method returns all records without pagination and is useful for
+// getting a complete dataset or when pagination is not needed. At most the
+// configured GetAll limit of rows is returned; the boolean result reports whether
+// the table held more rows than that and the result was truncated.
+func (r *RecordRepository) GetAll() ([]Record, bool, error) {
+	records, truncated, _, err := r.getAll(byCreated, false)
+	return records, truncated, err
+}
+
+// GetAllLenient works like GetAll, but skips the rows that cannot be scanned, such
+// as a row whose column holds a value of the wrong type, instead of failing. It
+// also returns a warning describing each skipped row. Skipped rows count towards
+// the GetAll limit.
+func (r *RecordRepository) GetAllLenient() ([]Record, bool, []string, error) {
+	return r.getAll(byCreated, true)
+}
+
+// GetAllContextFirst works like GetAll, but lists the records with a context
+// before those without, each group ordered by created_at descending like GetAll.
+// It matches walking every page of GetPaginatedSorted with ContextFirst.
+func (r *RecordRepository) GetAllContextFirst() ([]Record, bool, error) {
+	records, truncated, _, err := r.getAll(byContextFirst, false)
+	return records, truncated, err
+}
+
+func (r *RecordRepository) getAll(order ordering, lenient bool) ([]Record, bool, []string, error) {
+	limit := r.current().getAllLimit
+	query := "SELECT " + recordColumns + " FROM " + r.readSource() + " ORDER BY " + order.orderBy()
+	args := []any{}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit+1)
+	}
 
 	var records []Record
+	var warnings []string
+	var err error
+	if lenient {
+		records, warnings, err = r.queryRecordsLenient("get_all", query, args...)
+	} else {
+		records, err = r.queryRecords("get_all", query, args...)
+	}
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	if limit > 0 && len(records)+len(warnings) > limit {
+		r.logger.Warn("get_all result truncated", slog.Int("limit", limit))
+		return records[:min(limit, len(records))], true, warnings, nil
+	}
+
+	return records, false, warnings, nil
+}
+
+// GetGroupedByType returns every record keyed by resource_type. Within a group the
+// records are ordered like the default listing, newest first with ties broken by
+// resource_id descending. A positive perTypeLimit keeps only the newest
+// perTypeLimit records of each type, ranked in the database with ROW_NUMBER so
+// that the rest are never read; zero returns every record.
+func (r *RecordRepository) GetGroupedByType(perTypeLimit int) (map[string][]Record, error) {
+	query := "SELECT " + recordColumns + " FROM " + r.readSource() + " ORDER BY resource_type, created_at DESC, resource_id DESC"
+	args := []any{}
+	if perTypeLimit > 0 {
+		ranked := "SELECT " + recordColumns + ", ROW_NUMBER() OVER (PARTITION BY resource_type ORDER BY created_at DESC, resource_id DESC) AS type_rank FROM " + r.readSource()
+		query = "SELECT " + recordColumns + " FROM (" + ranked + ") AS ranked WHERE type_rank <= ? ORDER BY resource_type, created_at DESC, resource_id DESC"
+		args = append(args, perTypeLimit)
+	}
+
+	records, err := r.queryRecords("get_grouped_by_type", query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]Record)
+	for _, record := range records {
+		groups[record.ResourceType] = append(groups[record.ResourceType], record)
+	}
+	return groups, nil
+}
+
+// ForEach calls fn for every record across all tables, ordered by the composite
+// key, reading them one row at a time so that the table is never held in memory.
+// It stops at the first error returned by fn and returns it.
+func (r *RecordRepository) ForEach(fn func(Record) error) error {
+	start := time.Now()
+	var count int64
+	err := r.forEach(fn, &count)
+	r.logQuery("for_each", start, count, err)
+	return err
+}
+
+func (r *RecordRepository) forEach(fn func(Record) error, count *int64) error {
+	columns := recordColumns + ", " + claimedColumn
+	rows, err := r.db.Query("SELECT " + columns + " FROM " + r.readSourceOf(columns) + " ORDER BY resource_type, resource_id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var claimedAt sql.NullTime
+	scan := func(dest ...any) error { return rows.Scan(append(dest, &claimedAt)...) }
 	for rows.Next() {
-		var record Record
-		err := rows.Scan(&record.ResourceID, &record.ResourceType, &record.Context, &record.CreatedAt, &record.UpdatedAt)
+		record, err := scanRecord(scan)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if claimedAt.Valid {
+			claimed := claimedAt.Time
+			record.claimedAt = &claimed
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+		*count++
+	}
+	return rows.Err()
+}
+
+// Count returns the total number of records across all tables.
+func (r *RecordRepository) Count() (int64, error) {
+	var count int64
+	start := time.Now()
+	err := r.db.QueryRow("SELECT COUNT(*) FROM " + r.readSource()).Scan(&count)
+	r.logQuery("count", start, 1, err)
+	return count, err
+}
+
+// CountApproximate returns the number of records across all tables as estimated
+// by the storage engine in information_schema.tables. It answers instantly on
+// tables of any size, but InnoDB's estimate can be off by tens of percent, so it
+// suits progress bars rather than exact totals.
+func (r *RecordRepository) CountApproximate() (int64, error) {
+	tables := r.tables()
+	placeholders := make([]string, len(tables))
+	args := make([]any, len(tables))
+	for i, table := range tables {
+		placeholders[i] = "?"
+		args[i] = table
+	}
+
+	query := "SELECT COALESCE(SUM(table_rows), 0) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name IN (" + strings.Join(placeholders, ", ") + ")"
+	var count int64
+	start := time.Now()
+	err := r.db.QueryRow(query, args...).Scan(&count)
+	r.logQuery("count_approximate", start, 1, err)
+	return count, err
+}
+
+// scanRecord reads a single row selecting the standard recordColumns into a
+// record, decoding the metadata JSON object when it is present.
+func scanRecord(scan func(dest ...any) error) (Record, error) {
+	var record Record
+	var metadata sql.NullString
+	if err := scan(&record.ResourceID, &record.ResourceType, &record.Context, &record.CreatedAt, &record.UpdatedAt, &metadata); err != nil {
+		return Record{}, err
+	}
+
+	if metadata.Valid {
+		if err := json.Unmarshal([]byte(metadata.String), &record.Metadata); err != nil {
+			return Record{}, fmt.Errorf("invalid metadata for %s/%s: %v", record.ResourceType, record.ResourceID, err)
+		}
+	}
+
+	return record, nil
+}
+
+// scanRecords reads every row from a result set selecting the standard
+// recordColumns, optionally followed by seq or claimed_at, and returns them as
+// records.
+func scanRecords(rows *sql.Rows) ([]Record, error) {
+	return scanRows(rows, nil)
+}
+
+// scanRows works like scanRecords. When skip is nil, the first row that cannot be
+// scanned fails the read; otherwise skip is called with its 1-based position and
+// the error, and the row is left out.
+func scanRows(rows *sql.Rows, skip func(row int, err error)) ([]Record, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	scan := rows.Scan
+	var seq int64
+	var claimedAt sql.NullTime
+	switch {
+	case slices.Contains(columns, seqColumn):
+		scan = func(dest ...any) error { return rows.Scan(append(dest, &seq)...) }
+	case slices.Contains(columns, claimedColumn):
+		scan = func(dest ...any) error { return rows.Scan(append(dest, &claimedAt)...) }
+	}
+
+	var records []Record
+	for row := 1; rows.Next(); row++ {
+		record, err := scanRecord(scan)
+		if err != nil {
+			if skip == nil {
+				return nil, err
+			}
+			skip(row, err)
+			continue
+		}
+		record.seq = seq
+		if claimedAt.Valid {
+			claimed := claimedAt.Time
+			record.claimedAt = &claimed
 		}
 		records = append(records, record)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return records, nil
 }
 
+// GetByKeys retrieves the records matching the given composite keys in a single
+// query using a tuple IN clause. Duplicate keys are collapsed, found records are
+// returned in the order their keys were requested, and keys without a matching
+// record are returned separately as missing.
+func (r *RecordRepository) GetByKeys(keys []RecordKey) ([]Record, []RecordKey, error) {
+	uniqueKeys := make([]RecordKey, 0, len(keys))
+	seen := make(map[RecordKey]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		uniqueKeys = append(uniqueKeys, key)
+	}
+
+	records := []Record{}
+	missing := []RecordKey{}
+	if len(uniqueKeys) == 0 {
+		return records, missing, nil
+	}
+
+	placeholders := make([]string, len(uniqueKeys))
+	args := make([]any, 0, len(uniqueKeys)*2)
+	for i, key := range uniqueKeys {
+		placeholders[i] = "(?, ?)"
+		args = append(args, key.ResourceType, key.ResourceID)
+	}
+
+	query := "SELECT " + recordColumns + " FROM " + r.readSource() + " WHERE (resource_type, resource_id) IN (" + strings.Join(placeholders, ", ") + ")"
+	found, err := r.queryRecords("get_by_keys", query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byKey := make(map[RecordKey]Record, len(found))
+	for _, record := range found {
+		byKey[RecordKey{ResourceType: record.ResourceType, ResourceID: record.ResourceID}] = record
+	}
+
+	for _, key := range uniqueKeys {
+		if record, ok := byKey[key]; ok {
+			records = append(records, record)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+
+	return records, missing, nil
+}
+
+// ExistingKeys returns the keys that are already stored, in the order of keys and
+// without duplicates, with a single IN query that reads no record content. It lets
+// an import preview its conflicts before writing anything.
+func (r *RecordRepository) ExistingKeys(keys []RecordKey) ([]RecordKey, error) {
+	existing := []RecordKey{}
+	if len(keys) == 0 {
+		return existing, nil
+	}
+
+	placeholders := make([]string, len(keys))
+	args := make([]any, 0, len(keys)*2)
+	for i, key := range keys {
+		placeholders[i] = "(?, ?)"
+		args = append(args, key.ResourceType, key.ResourceID)
+	}
+
+	start := time.Now()
+	query := "SELECT resource_type, resource_id FROM " + r.readSource() + " WHERE (resource_type, resource_id) IN (" + strings.Join(placeholders, ", ") + ")"
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		r.logQuery("existing_keys", start, 0, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := map[RecordKey]bool{}
+	for rows.Next() {
+		var key RecordKey
+		if err := rows.Scan(&key.ResourceType, &key.ResourceID); err != nil {
+			return nil, err
+		}
+		found[key] = true
+	}
+	r.logQuery("existing_keys", start, int64(len(found)), rows.Err())
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if found[key] {
+			existing = append(existing, key)
+			// Report a key listed twice once
+			delete(found, key)
+		}
+	}
+	return existing, nil
+}
+
+// EnableTokenEncryption switches continuation tokens from plaintext to AES-GCM
+// encrypted mode using the given server key, which must be 16, 24, or 32 bytes long.
+// Encrypted tokens are fully opaque to clients and any tampering is detected when
+// they are decoded. Without calling this, tokens stay in plaintext mode for debugging.
+func (r *RecordRepository) EnableTokenEncryption(key []byte) error {
+	aead, err := newTokenAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	r.update(func(s *settings) { s.tokenAEAD = aead })
+	return nil
+}
+
+// newTokenAEAD returns the AES-GCM cipher sealing continuation tokens under key.
+func newTokenAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token encryption key: %v", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token encryption key: %v", err)
+	}
+	return aead, nil
+}
+
+// cursor is the position carried inside a continuation token: the sort key of the
+// last record on the page just returned, plus the 1-based index of that page.
+// CreatedAt holds the value of the leading sort column named by Order, or Seq when
+// the listing is ordered by seq. Snapshot is the time of the first page request,
+// zero for tokens issued before snapshots and for seq listings.
+type cursor struct {
+	ResourceType string
+	ResourceID   string
+	CreatedAt    time.Time
+	Seq          int64
+	Page         int
+	Order        string
+	Snapshot     time.Time
+	// Backward marks a previous-page token, which reads the records preceding the
+	// cursor instead of those following it.
+	Backward bool
+	// Null marks a cursor whose record has NULL in the ordering's nullable column:
+	// the leading sort column, which CreatedAt cannot express, or the context of a
+	// context first ordering.
+	Null bool
+}
+
+// cursorPayload is the JSON wire format of a cursor. Field names are kept short
+// because the payload ends up in a URL.
+type cursorPayload struct {
+	ResourceType string `json:"t"`
+	ResourceID   string `json:"i"`
+	CreatedAt    int64  `json:"c"`
+	Seq          int64  `json:"q,omitempty"`
+	Page         int    `json:"p"`
+	Order        string `json:"o,omitempty"`
+	Snapshot     int64  `json:"s,omitempty"`
+	Backward     bool   `json:"b,omitempty"`
+	Null         bool   `json:"n,omitempty"`
+}
+
 // encodeContinuationToken creates a base64-encoded token from the last record's data.
-// The token contains the resource_type, resource_id, and timestamp (as Unix timestamp)
-// separated by pipe characters. This token is used for cursor-based pagination to
-// determine where the next page should start.
-func (r *RecordRepository) encodeContinuationToken(lastResourceType, lastResourceID string, lastCreatedAt time.Time) string {
-	tokenData := fmt.Sprintf("%s|%s|%d", lastResourceType, lastResourceID, lastCreatedAt.Unix())
-	return base64.URLEncoding.EncodeToString([]byte(tokenData))
-}
-
-// decodeContinuationToken parses a base64-encoded continuation token back into
-// resource_type, resource_id, and timestamp values. It validates the token format
-// and returns an error if the token is malformed or cannot be decoded. This is used
-// to determine the starting point for the next page of results.
-func (r *RecordRepository) decodeContinuationToken(token string) (string, string, time.Time, error) {
+// The token contains the resource_type, resource_id, timestamp (as Unix timestamp),
+// and page index as a small JSON object, so identifiers may contain any character.
+// This token is used for cursor-based pagination to determine where the next page
+// should start. When token encryption is enabled the payload is sealed with AES-GCM
+// under a random nonce before being encoded.
+func (r *RecordRepository) encodeContinuationToken(c cursor) string {
+	payload := cursorPayload{
+		ResourceType: c.ResourceType,
+		ResourceID:   c.ResourceID,
+		CreatedAt:    c.CreatedAt.Unix(),
+		Seq:          c.Seq,
+		Page:         c.Page,
+		Order:        c.Order,
+		Backward:     c.Backward,
+		Null:         c.Null,
+	}
+	if !c.Snapshot.IsZero() {
+		payload.Snapshot = c.Snapshot.Unix()
+	}
+
+	tokenData, err := json.Marshal(payload)
+	if err != nil {
+		panic(fmt.Sprintf("failed to encode continuation token: %v", err))
+	}
+
+	if aead := r.current().tokenAEAD; aead != nil {
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			panic(fmt.Sprintf("failed to generate token nonce: %v", err))
+		}
+		tokenData = aead.Seal(nonce, nonce, tokenData, nil)
+	}
+
+	return base64.URLEncoding.EncodeToString(tokenData)
+}
+
+// decodeContinuationToken parses a base64-encoded continuation token back into a
+// cursor. It validates the token format and returns an error if the token is
+// malformed or cannot be decoded. Encrypted tokens are decrypted first, so a tampered
+// ciphertext is rejected. This is used to determine the starting point for the next
+// page of results. Tokens longer than the configured maximum are rejected before
+// being decoded.
+func (r *RecordRepository) decodeContinuationToken(token string) (cursor, error) {
+	current := r.current()
+	if current.maxTokenLen > 0 && len(token) > current.maxTokenLen {
+		return cursor{}, fmt.Errorf("%w: %d bytes, the limit is %d", ErrTokenTooLong, len(token), current.maxTokenLen)
+	}
+
 	decoded, err := base64.URLEncoding.DecodeString(token)
 	if err != nil {
-		return "", "", time.Time{}, fmt.Errorf("invalid continuation token: %v", err)
+		return cursor{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if aead := current.tokenAEAD; aead != nil {
+		nonceSize := aead.NonceSize()
+		if len(decoded) < nonceSize {
+			return cursor{}, fmt.Errorf("%w: too short", ErrInvalidToken)
+		}
+		decoded, err = aead.Open(nil, decoded[:nonceSize], decoded[nonceSize:], nil)
+		if err != nil {
+			return cursor{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
 	}
 
-	parts := strings.Split(string(decoded), "|")
-	if len(parts) != 3 {
-		return "", "", time.Time{}, fmt.Errorf("invalid continuation token format")
+	if !bytes.HasPrefix(decoded, []byte("{")) {
+		return decodeLegacyCursor(string(decoded))
 	}
 
-	resourceType := parts[0]
-	resourceID := parts[1]
+	var payload cursorPayload
+	if err := json.Unmarshal(decoded, &payload); err != nil {
+		return cursor{}, fmt.Errorf("%w format", ErrInvalidToken)
+	}
+
+	if payload.Page < 1 {
+		return cursor{}, fmt.Errorf("%w: invalid page index", ErrInvalidToken)
+	}
+
+	last := cursor{
+		ResourceType: payload.ResourceType,
+		ResourceID:   payload.ResourceID,
+		CreatedAt:    time.Unix(payload.CreatedAt, 0),
+		Seq:          payload.Seq,
+		Page:         payload.Page,
+		Order:        payload.Order,
+		Backward:     payload.Backward,
+		Null:         payload.Null,
+	}
+	if payload.Snapshot != 0 {
+		if payload.Snapshot < minCursorTime || payload.Snapshot > maxCursorTime {
+			return cursor{}, fmt.Errorf("%w: invalid snapshot", ErrInvalidToken)
+		}
+		last.Snapshot = time.Unix(payload.Snapshot, 0).UTC()
+	}
+	return last, checkCursor(last, payload.CreatedAt)
+}
+
+// The range of the Unix timestamps a cursor may hold, the years 1 to 9999.
+// Zero times, which cursors of NULL keys carry, fall inside it.
+const (
+	minCursorTime = -62135596800
+	maxCursorTime = 253402300799
+)
+
+// checkCursor rejects a decoded cursor no page could have issued: keys that are not
+// valid UTF-8, which the utf8mb4 columns cannot hold and JSON does not round-trip,
+// a created_at outside the years 1 to 9999, and a page index whose successor
+// overflows.
+func checkCursor(c cursor, createdAt int64) error {
+	if !utf8.ValidString(c.ResourceType) || !utf8.ValidString(c.ResourceID) || !utf8.ValidString(c.Order) {
+		return fmt.Errorf("%w: keys are not valid UTF-8", ErrInvalidToken)
+	}
+	if createdAt < minCursorTime || createdAt > maxCursorTime {
+		return fmt.Errorf("%w: invalid timestamp", ErrInvalidToken)
+	}
+	if c.Page == math.MaxInt {
+		return fmt.Errorf("%w: invalid page index", ErrInvalidToken)
+	}
+	return nil
+}
+
+// decodeLegacyCursor parses the pipe-separated resource_type|resource_id|timestamp
+// payload used by tokens issued before the JSON format, optionally followed by a
+// page index. Such tokens are still accepted so in-flight pagination keeps working.
+func decodeLegacyCursor(payload string) (cursor, error) {
+	parts := strings.Split(payload, "|")
+	if len(parts) != 3 && len(parts) != 4 {
+		return cursor{}, fmt.Errorf("%w format", ErrInvalidToken)
+	}
 
 	timestamp, err := strconv.ParseInt(parts[2], 10, 64)
 	if err != nil {
-		return "", "", time.Time{}, fmt.Errorf("invalid timestamp in token: %v", err)
+		return cursor{}, fmt.Errorf("%w: invalid timestamp: %v", ErrInvalidToken, err)
+	}
+
+	page := 1
+	if len(parts) == 4 {
+		page, err = strconv.Atoi(parts[3])
+		if err != nil || page < 1 {
+			return cursor{}, fmt.Errorf("%w: invalid page index", ErrInvalidToken)
+		}
 	}
 
-	return resourceType, resourceID, time.Unix(timestamp, 0), nil
+	last := cursor{
+		ResourceType: parts[0],
+		ResourceID:   parts[1],
+		CreatedAt:    time.Unix(timestamp, 0),
+		Page:         page,
+	}
+	return last, checkCursor(last, timestamp)
 }
 
 // GetPaginated retrieves records using cursor-based pagination with continuation tokens.
@@ -137,54 +962,505 @@ func (r *RecordRepository) decodeContinuationToken(token string) (string, string
 // one extra record to determine if there are more pages available. Results are
 // ordered by created_at DESC, resource_type DESC, resource_id DESC for consistent pagination.
 func (r *RecordRepository) GetPaginated(continuationToken string, pageSize int) (*PaginatedResult, error) {
-	if pageSize <= 0 {
-		pageSize = DefaultPageSize
+	return r.getPaginated(continuationToken, pageSize, false)
+}
+
+// GetPaginatedLenient works like GetPaginated, but skips the rows that cannot be
+// scanned instead of failing, and describes each of them in the result's
+// Warnings. Skipped rows still count towards the page, so a page may hold fewer
+// than pageSize records without being the last, and the rows skipped at the end
+// of a page are read, and reported, again by the next page. A page whose rows all
+// fail to scan while more rows follow cannot be continued and fails.
+func (r *RecordRepository) GetPaginatedLenient(continuationToken string, pageSize int) (*PaginatedResult, error) {
+	return r.getPaginated(continuationToken, pageSize, true)
+}
+
+func (r *RecordRepository) getPaginated(continuationToken string, pageSize int, lenient bool) (*PaginatedResult, error) {
+	req, err := r.resumePage(byCreated, continuationToken)
+	if err != nil {
+		return nil, err
+	}
+	req.lenient = lenient
+
+	result, err := r.fetchPage(byCreated, r.readSource(), nil, nil, req, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if continuationToken == "" && len(result.Records) > 0 {
+		since := r.sinceToken(result.Records[0])
+		result.SinceToken = &since
+	}
+	return result, nil
+}
+
+// NewerResult is a page of records created after a since token, newest first.
+type NewerResult struct {
+	Records []Record `json:"records"`
+	// SinceToken marks the newest record seen so far; the next poll passes it back.
+	// It is the token that was polled with when no newer records exist.
+	SinceToken string `json:"since_token"`
+	// HasMore is true when even newer records exist beyond this page; polling again
+	// right away returns them.
+	HasMore bool `json:"has_more"`
+}
+
+// GetNewer returns the records that come strictly before the since token in the
+// GetPaginated listing, that is records newer than the one the token marks, newest
+// first. It complements walking the listing towards older records with
+// continuation tokens: the first page's SinceToken, and each GetNewer result's,
+// lets a client poll for what was added since. When more than pageSize newer
+// records exist, the oldest of them are returned first, so that polling repeatedly
+// never skips a record.
+func (r *RecordRepository) GetNewer(sinceToken string, pageSize int) (*NewerResult, error) {
+	since, err := r.decodeContinuationToken(sinceToken)
+	if err != nil {
+		return nil, err
+	}
+	if since.Order != byCreated.name {
+		return nil, fmt.Errorf("%w: since token issued for a different listing", ErrInvalidToken)
+	}
+
+	// Polling reads the live table, so no snapshot applies
+	page, err := r.fetchPage(byCreated, r.readSource(), nil, nil, pageRequest{after: &since, backward: true, page: 1}, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &NewerResult{Records: page.Records, SinceToken: sinceToken, HasMore: page.PrevContinuationToken != nil}
+	if len(page.Records) > 0 {
+		result.SinceToken = r.sinceToken(page.Records[0])
+	}
+	return result, nil
+}
+
+// SinceStart returns a since token preceding every record, for polling GetNewer
+// from an empty table, where GetPaginated has no newest record to mark. The
+// first poll with it returns the oldest records.
+func (r *RecordRepository) SinceStart() string {
+	return r.sinceToken(Record{CreatedAt: time.Unix(0, 0)})
+}
+
+// sinceToken returns the token GetNewer polls with for records newer than record.
+// It is a backward token without a snapshot, so it also works as a
+// continuation_token reading the page before record.
+func (r *RecordRepository) sinceToken(record Record) string {
+	return r.encodeContinuationToken(cursor{
+		ResourceType: record.ResourceType,
+		ResourceID:   record.ResourceID,
+		CreatedAt:    byCreated.value(record),
+		Page:         1,
+		Order:        byCreated.name,
+		Backward:     true,
+	})
+}
+
+// GetLastPage returns the final page of the GetPaginated listing, the oldest
+// records, still ordered newest first, without the caller knowing how many pages
+// precede it. The records are read with an ascending query and reversed. When
+// newer records exist the result carries a PrevContinuationToken; following it
+// with GetPaginated walks the listing backward, each page again offering the
+// previous and next tokens.
+func (r *RecordRepository) GetLastPage(pageSize int) (*PaginatedResult, error) {
+	return r.fetchPage(byCreated, r.readSource(), nil, nil, pageRequest{backward: true, page: 1, snapshot: time.Now().UTC()}, pageSize)
+}
+
+// GetPaginatedByType works like GetPaginated but only returns records of the given
+// resource_type. The query reads directly from the table storing that type, so a
+// sharded type never touches the other tables.
+func (r *RecordRepository) GetPaginatedByType(resourceType, continuationToken string, pageSize int) (*PaginatedResult, error) {
+	return r.GetPaginatedFiltered(PaginationFilter{ResourceType: resourceType}, continuationToken, pageSize)
+}
+
+// GetWithoutContext works like GetPaginated but only returns records whose context
+// is NULL, for data-quality sweeps.
+func (r *RecordRepository) GetWithoutContext(continuationToken string, pageSize int) (*PaginatedResult, error) {
+	return r.GetPaginatedFiltered(PaginationFilter{MissingContext: true}, continuationToken, pageSize)
+}
+
+// GetPaginatedFiltered works like GetPaginated but applies every non-empty field of
+// the filter, ANDed into a single WHERE clause. A resource_type filter reads directly
+// from the table storing that type; excluded types become a resource_type NOT IN
+// predicate; a metadata key filter uses JSON_CONTAINS_PATH on the metadata column.
+// Filter values are always bound as query arguments.
+func (r *RecordRepository) GetPaginatedFiltered(filter PaginationFilter, continuationToken string, pageSize int) (*PaginatedResult, error) {
+	from, filters, filterArgs := r.filterClauses(filter)
+	return r.paginate(byCreated, from, filters, filterArgs, continuationToken, pageSize)
+}
+
+// GetPaginatedSorted works like GetPaginatedFiltered but orders the records by the
+// given sort order instead of created_at descending. The sort column must be one of
+// SortColumns; anything else is rejected with ErrInvalidSortColumn. Continuation
+// tokens record the sort order and are only accepted for the same order.
+//
+// Every table numbers its records separately, so ordering by seq when resource
+// types are stored in separate tables requires a resource_type filter, which
+// reads a single table; without one it is rejected with ErrInvalidSortColumn.
+// So does ordering by claimed_at, which the union of the tables does not carry.
+func (r *RecordRepository) GetPaginatedSorted(sort SortOrder, filter PaginationFilter, continuationToken string, pageSize int) (*PaginatedResult, error) {
+	order, err := sort.ordering()
+	if err != nil {
+		return nil, err
+	}
+	if filter.ResourceType == "" && len(r.tables()) > 1 {
+		switch order.expr {
+		case seqColumn:
+			return nil, fmt.Errorf("%w '%s': resource types are stored in separate tables, which number their records separately, so a resource_type filter is required", ErrInvalidSortColumn, seqColumn)
+		case claimedColumn:
+			return nil, fmt.Errorf("%w '%s': resource types are stored in separate tables, whose union does not carry %s, so a resource_type filter is required", ErrInvalidSortColumn, claimedColumn, claimedColumn)
+		}
+	}
+
+	from, filters, filterArgs := r.filterClauses(filter)
+	return r.paginate(order, from, filters, filterArgs, continuationToken, pageSize)
+}
+
+// filterClauses translates a pagination filter into the FROM expression, the
+// predicates, and their arguments for paginate.
+func (r *RecordRepository) filterClauses(filter PaginationFilter) (string, []string, []any) {
+	from := r.readSource()
+	var filters []string
+	var filterArgs []any
+
+	if filter.ResourceType != "" {
+		from = r.tableFor(filter.ResourceType)
+		filters = append(filters, "resource_type = ?")
+		filterArgs = append(filterArgs, filter.ResourceType)
+	}
+
+	if len(filter.ExcludeTypes) > 0 {
+		placeholders := make([]string, len(filter.ExcludeTypes))
+		for i, resourceType := range filter.ExcludeTypes {
+			placeholders[i] = "?"
+			filterArgs = append(filterArgs, resourceType)
+		}
+		filters = append(filters, "resource_type NOT IN ("+strings.Join(placeholders, ", ")+")")
+	}
+
+	if filter.MetadataKey != "" {
+		filters = append(filters, "JSON_CONTAINS_PATH(metadata, 'one', ?)")
+		filterArgs = append(filterArgs, metadataKeyPath(filter.MetadataKey))
+	}
+
+	if filter.IDPrefix != "" {
+		filters = append(filters, "resource_id LIKE ?")
+		filterArgs = append(filterArgs, likePrefix(filter.IDPrefix))
 	}
 
-	var query string
-	var args []any
+	if filter.MissingContext {
+		filters = append(filters, "context IS NULL")
+	}
+
+	timeBounds := []struct {
+		predicate string
+		value     time.Time
+	}{
+		{"created_at > ?", filter.CreatedAfter},
+		{"created_at < ?", filter.CreatedBefore},
+		{"updated_at > ?", filter.UpdatedAfter},
+		{"updated_at < ?", filter.UpdatedBefore},
+	}
+	for _, bound := range timeBounds {
+		if !bound.value.IsZero() {
+			filters = append(filters, bound.predicate)
+			filterArgs = append(filterArgs, bound.value.UTC())
+		}
+	}
+
+	return from, filters, filterArgs
+}
+
+// GetActivityFeed pages through every record ordered by most recent activity, the
+// later of created_at and updated_at, so records that were recently updated surface
+// alongside newly created ones. Its continuation tokens carry the activity time and
+// are rejected by the created_at-ordered listings, and vice versa.
+func (r *RecordRepository) GetActivityFeed(pageSize int, continuationToken string) (*PaginatedResult, error) {
+	return r.paginate(byActivity, r.readSource(), nil, nil, continuationToken, pageSize)
+}
+
+// likePrefix returns a LIKE pattern matching values that start with prefix, with
+// the LIKE wildcards and escape character in prefix matched literally.
+func likePrefix(prefix string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix)
+	return escaped + "%"
+}
+
+// metadataKeyPath returns the JSON path addressing a top-level metadata key. The key
+// is quoted so that keys containing dots, spaces, or quotes are matched literally.
+func metadataKeyPath(key string) string {
+	quoted, _ := json.Marshal(key)
+	return "$." + string(quoted)
+}
+
+// paginate runs the keyset pagination query in the given ordering against the given
+// FROM expression, restricted by the optional filter predicates, which are ANDed
+// with the cursor predicate. It implements the shared logic behind the paginated
+// read methods. Whether another page exists is decided by the repository's
+// HasMoreStrategy.
+//
+// The first page records the current time as the listing's snapshot in its
+// continuation token, and later pages only return records created at or before the
+// snapshot, so records inserted while a client pages through do not shift pages.
+func (r *RecordRepository) paginate(order ordering, from string, filters []string, filterArgs []any, continuationToken string, pageSize int) (*PaginatedResult, error) {
+	req, err := r.resumePage(order, continuationToken)
+	if err != nil {
+		return nil, err
+	}
+	return r.fetchPage(order, from, filters, filterArgs, req, pageSize)
+}
 
+// resumePage returns the page a continuation token leads to in the listing with the
+// given order, or the first page when the token is empty.
+func (r *RecordRepository) resumePage(order ordering, continuationToken string) (pageRequest, error) {
 	if continuationToken == "" {
-		query = "SELECT resource_id, resource_type, context, created_at, updated_at FROM resource_context ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT ?"
-		args = []any{pageSize + 1}
-	} else {
-		lastResourceType, lastResourceID, lastCreatedAt, err := r.decodeContinuationToken(continuationToken)
-		if err != nil {
-			return nil, err
+		req := pageRequest{page: 1}
+		if order.snapshots() {
+			req.snapshot = time.Now().UTC()
 		}
+		return req, nil
+	}
 
-		query = `SELECT resource_id, resource_type, context, created_at, updated_at FROM resource_context
-				 WHERE (created_at < ? OR (created_at = ? AND resource_type < ?) OR (created_at = ? AND resource_type = ? AND resource_id < ?))
-				 ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT ?`
-		args = []any{lastCreatedAt, lastCreatedAt, lastResourceType, lastCreatedAt, lastResourceType, lastResourceID, pageSize + 1}
+	last, err := r.decodeContinuationToken(continuationToken)
+	if err != nil {
+		return pageRequest{}, err
 	}
 
-	rows, err := r.db.Query(query, args...)
+	if last.Order != order.name {
+		return pageRequest{}, fmt.Errorf("%w: issued for a different listing", ErrInvalidToken)
+	}
+
+	page := last.Page + 1
+	if maxPageDepth := r.current().maxPageDepth; maxPageDepth > 0 && page > maxPageDepth {
+		return pageRequest{}, ErrPaginationTooDeep
+	}
+
+	return pageRequest{after: &last, backward: last.Backward, page: page, snapshot: last.Snapshot}, nil
+}
+
+// ExplainedQuery is the SQL statement a listing would run, with its arguments in
+// placeholder order.
+type ExplainedQuery struct {
+	SQL  string `json:"sql"`
+	Args []any  `json:"args"`
+}
+
+// ExplainPaginated returns the query GetPaginated would run for the continuation
+// token and page size, without running it, so that it can be inspected with
+// EXPLAIN. Tokens are validated exactly as GetPaginated validates them. With the
+// HasMoreExists strategy a full page is followed by an EXISTS probe, which is not
+// included.
+func (r *RecordRepository) ExplainPaginated(continuationToken string, pageSize int) (*ExplainedQuery, error) {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	req, err := r.resumePage(byCreated, continuationToken)
 	if err != nil {
 		return nil, err
 	}
+
+	filters, filterArgs := req.snapshotFilters(nil, nil)
+	query, args, _ := r.pageQuery(byCreated, r.readSource(), filters, filterArgs, req, pageSize)
+	return &ExplainedQuery{SQL: query, Args: args}, nil
+}
+
+// PlanRow is one row of EXPLAIN output keyed by column name, such as "table",
+// "type", "key" and "rows". NULL columns are omitted.
+type PlanRow map[string]string
+
+// Explain runs EXPLAIN for the query and returns the database's plan for it, one
+// row per table access, so that deep pages can be checked for index use. The query
+// itself is not run.
+func (r *RecordRepository) Explain(query *ExplainedQuery) ([]PlanRow, error) {
+	start := time.Now()
+	rows, err := r.db.Query("EXPLAIN "+query.SQL, query.Args...)
+	if err != nil {
+		r.logQuery("explain", start, 0, err)
+		return nil, err
+	}
 	defer rows.Close()
 
-	var records []Record
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []PlanRow
 	for rows.Next() {
-		var record Record
-		err := rows.Scan(&record.ResourceID, &record.ResourceType, &record.Context, &record.CreatedAt, &record.UpdatedAt)
+		values := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row := make(PlanRow, len(columns))
+		for i, column := range columns {
+			if values[i].Valid {
+				row[column] = values[i].String
+			}
+		}
+		plan = append(plan, row)
+	}
+	r.logQuery("explain", start, int64(len(plan)), rows.Err())
+	return plan, rows.Err()
+}
+
+// pageRequest says which page fetchPage reads: the records following the after
+// cursor, or the first or last records of the listing when after is nil.
+type pageRequest struct {
+	after *cursor
+	// backward reads the records preceding after, or the last page when after is
+	// nil, by scanning the listing in reverse.
+	backward bool
+	page     int
+	snapshot time.Time
+	// lenient skips the rows that cannot be scanned, see GetPaginatedLenient.
+	lenient bool
+}
+
+// snapshotFilters adds the snapshot predicate to the filters: records created after
+// the snapshot are hidden from every page after the first. The given slices are
+// not modified.
+func (req pageRequest) snapshotFilters(filters []string, filterArgs []any) ([]string, []any) {
+	if req.after == nil || req.snapshot.IsZero() {
+		return filters, filterArgs
+	}
+	return append(filters[:len(filters):len(filters)], "created_at <= ?"),
+		append(filterArgs[:len(filterArgs):len(filterArgs)], req.snapshot)
+}
+
+// fetchPage reads one page of the listing. A backward page is read in reverse
+// order and flipped, so its records are returned in listing order like any other
+// page, with a previous token when earlier records exist and a next token leading
+// back towards the end of the listing.
+func (r *RecordRepository) fetchPage(order ordering, from string, filters []string, filterArgs []any, req pageRequest, pageSize int) (*PaginatedResult, error) {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	filters, filterArgs = req.snapshotFilters(filters, filterArgs)
+	query, args, scan := r.pageQuery(order, from, filters, filterArgs, req, pageSize)
+	var records []Record
+	var warnings []string
+	var err error
+	if req.lenient {
+		records, warnings, err = r.queryRecordsLenient("page_"+order.name, query, args...)
+	} else {
+		records, err = r.queryRecords("page_"+order.name, query, args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Skipped rows count towards the page, so that they cannot end the walk early
+	rows := len(records) + len(warnings)
+	if len(records) == 0 && rows >= pageSize {
+		return nil, fmt.Errorf("no row of the page could be scanned, so the next page cannot be found: %s", warnings[0])
+	}
+	hasMore := rows > pageSize
+	if hasMore {
+		records = records[:min(pageSize, len(records))]
+	} else if r.hasMoreStrategy == HasMoreExists && rows == pageSize {
+		hasMore, err = r.existsAfter(scan, from, filters, filterArgs, records[len(records)-1])
 		if err != nil {
 			return nil, err
 		}
-		records = append(records, record)
 	}
 
-	result := &PaginatedResult{
-		Records: records,
+	return r.pageResult(order, req, records, warnings, hasMore), nil
+}
+
+// pageResult assembles a page of the listing from the records read for req, in
+// scan order and at most a page of them, adding the tokens that lead to the
+// following pages when hasMore reports that more records were found.
+func (r *RecordRepository) pageResult(order ordering, req pageRequest, records []Record, warnings []string, hasMore bool) *PaginatedResult {
+	token := func(record Record, backward bool) *string {
+		token := r.encodeContinuationToken(cursor{
+			ResourceType: record.ResourceType,
+			ResourceID:   record.ResourceID,
+			CreatedAt:    order.value(record),
+			Seq:          record.seq,
+			Page:         req.page,
+			Order:        order.name,
+			Snapshot:     req.snapshot,
+			Backward:     backward,
+			Null:         order.isNull(record),
+		})
+		return &token
 	}
 
-	if len(records) > pageSize {
-		result.Records = records[:pageSize]
-		lastRecord := records[pageSize-1]
-		token := r.encodeContinuationToken(lastRecord.ResourceType, lastRecord.ResourceID, lastRecord.CreatedAt)
-		result.NextContinuationToken = &token
+	if !req.backward {
+		result := &PaginatedResult{Records: records, PageDepth: req.page, IsLastPage: !hasMore, Warnings: warnings}
+		if hasMore {
+			result.NextContinuationToken = token(records[len(records)-1], false)
+		}
+		return result
 	}
 
-	return result, nil
-}
\ No newline at end of file
+	slices.Reverse(records)
+	result := &PaginatedResult{Records: records, PageDepth: req.page, IsLastPage: req.after == nil, Warnings: warnings}
+	if hasMore {
+		result.PrevContinuationToken = token(records[0], true)
+	}
+	if req.after != nil && len(records) > 0 {
+		result.NextContinuationToken = token(records[len(records)-1], false)
+	}
+	return result
+}
+
+// pageQuery builds the query reading one page of the listing, returning it with its
+// arguments and the ordering it scans in, which is reversed for backward pages.
+// The snapshot predicate must already be part of filters, see snapshotFilters.
+func (r *RecordRepository) pageQuery(order ordering, from string, filters []string, filterArgs []any, req pageRequest, pageSize int) (string, []any, ordering) {
+	scan := order
+	if req.backward {
+		scan.asc = !order.asc
+		scan.nullsFirst = !order.nullsFirst
+	}
+
+	conditions := append([]string{}, filters...)
+	args := append([]any{}, filterArgs...)
+	if req.after != nil {
+		keyset, keysetArgs := keysetAfter(scan, *req.after)
+		conditions = append(conditions, keyset)
+		args = append(args, keysetArgs...)
+	}
+
+	limit := pageSize + 1
+	if r.hasMoreStrategy == HasMoreExists {
+		limit = pageSize
+	}
+
+	query := "SELECT " + order.selectColumns() + " FROM " + from
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY " + scan.orderBy() + " LIMIT ?"
+	args = append(args, limit)
+
+	return query, args, scan
+}
+
+// existsAfter runs a cheap EXISTS probe to check whether any record matching the
+// filters sorts after the given record. It is used by the HasMoreExists strategy
+// instead of fetching and discarding an extra, potentially wide, row.
+func (r *RecordRepository) existsAfter(order ordering, from string, filters []string, filterArgs []any, last Record) (bool, error) {
+	keyset, keysetArgs := keysetAfter(order, order.position(last))
+	conditions := append(append([]string{}, filters...), keyset)
+	args := append(append([]any{}, filterArgs...), keysetArgs...)
+
+	query := "SELECT EXISTS(SELECT 1 FROM " + from + " WHERE " + strings.Join(conditions, " AND ") + ")"
+
+	var exists bool
+	start := time.Now()
+	err := r.db.QueryRow(query, args...).Scan(&exists)
+	r.logQuery("exists_after", start, 1, err)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
@@ -2,13 +2,20 @@ package repository
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"tokenpagination/testutil"
 )
 
 // setupTestDB creates a mock database connection for testing
@@ -32,19 +39,27 @@ func TestCreateTable(t *testing.T) {
 	db, mock, repo := setupTestDB(t)
 	defer db.Close()
 
-	// Expect DROP TABLE query first
-	mock.ExpectExec("DROP TABLE IF EXISTS resource_context").WillReturnResult(sqlmock.NewResult(0, 0))
-
-	// Expect CREATE TABLE query
-	mock.ExpectExec(`CREATE TABLE resource_context \(
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS resource_context \(
 		resource_id varchar\(128\) not null,
 		resource_type varchar\(128\) not null,
 		context longtext default null,
 		created_at timestamp not null,
 		updated_at timestamp not null,
-		PRIMARY KEY \(resource_type, resource_id\)
+		metadata json default null,
+		seq bigint not null auto_increment,
+		claimed_at timestamp null default null,
+		PRIMARY KEY \(resource_type, resource_id\),
+		KEY idx_created_at \(created_at, resource_type, resource_id\),
+		KEY idx_updated_at \(updated_at, resource_type, resource_id\),
+		KEY idx_resource_id \(resource_id, resource_type\),
+		UNIQUE KEY idx_seq \(seq\),
+		KEY idx_claim \(resource_type, claimed_at, created_at, resource_id\)
 	\)`).WillReturnResult(sqlmock.NewResult(0, 0))
 
+	// The table is current, so nothing is altered
+	expectTableColumns(mock, "resource_context", tableColumnNames...)
+	expectTableIndexes(mock, "resource_context", currentIndexes())
+
 	err := repo.CreateTable()
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -54,17 +69,52 @@ func TestCreateTable_Error(t *testing.T) {
 	db, mock, repo := setupTestDB(t)
 	defer db.Close()
 
-	// Expect DROP TABLE to succeed
-	mock.ExpectExec("DROP TABLE IF EXISTS resource_context").WillReturnResult(sqlmock.NewResult(0, 0))
-
-	// Expect CREATE TABLE to fail
-	mock.ExpectExec(`CREATE TABLE resource_context`).WillReturnError(assert.AnError)
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS resource_context`).WillReturnError(assert.AnError)
 
 	err := repo.CreateTable()
 	assert.Error(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestSchemaStatements(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	require.NoError(t, repo.SetTypeTables(map[string]string{"task": "resource_context_task"}))
+
+	statements := repo.SchemaStatements()
+	require.Len(t, statements, 2)
+	assert.Contains(t, statements[0], "CREATE TABLE IF NOT EXISTS resource_context (")
+	assert.Contains(t, statements[1], "CREATE TABLE IF NOT EXISTS resource_context_task (")
+	for _, statement := range statements {
+		assert.NotContains(t, statement, "DROP")
+	}
+}
+
+func TestVerifySchema(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	expectDescribeTable(mock, "resource_context", currentColumns(), currentIndexes())
+
+	assert.NoError(t, repo.VerifySchema())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifySchema_MissingTable(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	expectDescribeTable(mock, "resource_context", nil, nil)
+
+	err := repo.VerifySchema()
+	var schemaErr *SchemaError
+	require.ErrorAs(t, err, &schemaErr)
+	assert.Equal(t, []string{"table resource_context does not exist"}, schemaErr.Discrepancies)
+	assert.EqualError(t, err, "schema does not match, run the migrate command:\n  - table resource_context does not exist")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestInsert(t *testing.T) {
 	db, mock, repo := setupTestDB(t)
 	defer db.Close()
@@ -73,8 +123,8 @@ func TestInsert(t *testing.T) {
 	resourceType := "user"
 	context := `{"action": "login"}`
 
-	mock.ExpectExec(`INSERT INTO resource_context \(resource_id, resource_type, context, created_at, updated_at\) VALUES \(\?, \?, \?, \?, \?\)`).
-		WithArgs(resourceID, resourceType, &context, sqlmock.AnyArg(), sqlmock.AnyArg()).
+	mock.ExpectExec(`INSERT INTO resource_context \(resource_id, resource_type, context, created_at, updated_at, metadata\) VALUES \(\?, \?, \?, \?, \?, \?\)`).
+		WithArgs(resourceID, resourceType, &context, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	err := repo.Insert(resourceID, resourceType, &context)
@@ -89,8 +139,8 @@ func TestInsert_WithNilContext(t *testing.T) {
 	resourceID := "doc-456"
 	resourceType := "document"
 
-	mock.ExpectExec(`INSERT INTO resource_context \(resource_id, resource_type, context, created_at, updated_at\) VALUES \(\?, \?, \?, \?, \?\)`).
-		WithArgs(resourceID, resourceType, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+	mock.ExpectExec(`INSERT INTO resource_context \(resource_id, resource_type, context, created_at, updated_at, metadata\) VALUES \(\?, \?, \?, \?, \?, \?\)`).
+		WithArgs(resourceID, resourceType, nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	err := repo.Insert(resourceID, resourceType, nil)
@@ -110,6 +160,188 @@ func TestInsert_Error(t *testing.T) {
 
 	err := repo.Insert(resourceID, resourceType, nil)
 	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrDuplicate)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsert_Duplicate(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectExec(`INSERT INTO resource_context`).
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'user-user-123' for key 'PRIMARY'"})
+
+	err := repo.Insert("user-123", "user", nil)
+	assert.ErrorIs(t, err, ErrDuplicate)
+	assert.ErrorContains(t, err, "Duplicate entry")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertWithMetadata(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectExec(`INSERT INTO resource_context \(resource_id, resource_type, context, created_at, updated_at, metadata\) VALUES \(\?, \?, \?, \?, \?, \?\)`).
+		WithArgs("user-123", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), `{"region":"eu","tier":"gold"}`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := repo.InsertWithMetadata("user-123", "user", nil, map[string]string{"tier": "gold", "region": "eu"})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertWithMetadata_EmptyMapStoresNull(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectExec(`INSERT INTO resource_context`).
+		WithArgs("user-123", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := repo.InsertWithMetadata("user-123", "user", nil, map[string]string{})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetByID_ReadsMetadata(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context WHERE resource_type = \? AND resource_id = \?`).
+		WithArgs("user", "user-123").
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+			AddRow("user-123", "user", nil, now, now, `{"tier":"gold"}`))
+
+	record, err := repo.GetByID("user-123", "user")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tier": "gold"}, record.Metadata)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetByID_InvalidMetadata(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`FROM resource_context WHERE resource_type = \? AND resource_id = \?`).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+			AddRow("user-123", "user", nil, now, now, `["not", "an", "object"]`))
+
+	_, err := repo.GetByID("user-123", "user")
+	assert.ErrorContains(t, err, "invalid metadata for user/user-123")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTouch(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectExec(`UPDATE resource_context SET updated_at = \? WHERE resource_type = \? AND resource_id = \?`).
+		WithArgs(sqlmock.AnyArg(), "user", "user-123").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.Touch("user-123", "user")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTouch_NotFound(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectExec(`UPDATE resource_context SET updated_at = \? WHERE resource_type = \? AND resource_id = \?`).
+		WithArgs(sqlmock.AnyArg(), "user", "missing").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repo.Touch("missing", "user")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTouch_Error(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectExec(`UPDATE resource_context SET updated_at`).WillReturnError(assert.AnError)
+
+	err := repo.Touch("user-123", "user")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTouchIfUnmodifiedSince(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	since := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	mock.ExpectExec(`UPDATE resource_context SET updated_at = \? WHERE resource_type = \? AND resource_id = \? AND updated_at <= \?`).
+		WithArgs(sqlmock.AnyArg(), "user", "user-123", since).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.TouchIfUnmodifiedSince("user-123", "user", since)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTouchIfUnmodifiedSince_Modified(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	since := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	mock.ExpectExec(`UPDATE resource_context SET updated_at = \? WHERE resource_type = \? AND resource_id = \? AND updated_at <= \?`).
+		WithArgs(sqlmock.AnyArg(), "user", "user-123", since).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+		AddRow("user-123", "user", nil, since, since.Add(time.Minute), nil)
+	mock.ExpectQuery(`SELECT .* FROM resource_context WHERE resource_type = \? AND resource_id = \?`).
+		WithArgs("user", "user-123").
+		WillReturnRows(rows)
+
+	err := repo.TouchIfUnmodifiedSince("user-123", "user", since)
+	assert.ErrorIs(t, err, ErrModified)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTouchIfUnmodifiedSince_NotFound(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	since := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	mock.ExpectExec(`UPDATE resource_context SET updated_at`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT .* FROM resource_context WHERE resource_type = \? AND resource_id = \?`).
+		WithArgs("user", "missing").
+		WillReturnError(sql.ErrNoRows)
+
+	err := repo.TouchIfUnmodifiedSince("missing", "user", since)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDelete(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectExec(`DELETE FROM resource_context WHERE resource_type = \? AND resource_id = \?`).
+		WithArgs("user", "user-123").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.Delete("user-123", "user")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDelete_NotFound(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectExec(`DELETE FROM resource_context WHERE resource_type = \? AND resource_id = \?`).
+		WithArgs("user", "missing").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repo.Delete("missing", "user")
+	assert.ErrorIs(t, err, ErrNotFound)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -120,15 +352,17 @@ func TestGetAll(t *testing.T) {
 	now := time.Now()
 	context1 := `{"action": "login"}`
 
-	rows := sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at"}).
-		AddRow("user-123", "user", &context1, now, now).
-		AddRow("doc-456", "document", nil, now, now)
+	rows := sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+		AddRow("user-123", "user", &context1, now, now, nil).
+		AddRow("doc-456", "document", nil, now, now, nil)
 
-	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at FROM resource_context ORDER BY created_at DESC`).
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs(DefaultGetAllLimit + 1).
 		WillReturnRows(rows)
 
-	records, err := repo.GetAll()
+	records, truncated, err := repo.GetAll()
 	assert.NoError(t, err)
+	assert.False(t, truncated)
 	assert.Len(t, records, 2)
 
 	assert.Equal(t, "user-123", records[0].ResourceID)
@@ -142,129 +376,1757 @@ func TestGetAll(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestGetAllContextFirst(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	context := `{"action": "login"}`
+
+	rows := sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+		AddRow("user-123", "user", &context, now.Add(-time.Hour), now, nil).
+		AddRow("doc-456", "document", nil, now, now, nil)
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context ORDER BY ISNULL\(context\) ASC, created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs(DefaultGetAllLimit + 1).
+		WillReturnRows(rows)
+
+	records, truncated, err := repo.GetAllContextFirst()
+	assert.NoError(t, err)
+	assert.False(t, truncated)
+	assert.Equal(t, []string{"user/user-123", "document/doc-456"}, recordKeys(records))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestGetAll_Error(t *testing.T) {
 	db, mock, repo := setupTestDB(t)
 	defer db.Close()
 
-	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at FROM resource_context`).
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context`).
 		WillReturnError(assert.AnError)
 
-	records, err := repo.GetAll()
+	records, _, err := repo.GetAll()
 	assert.Error(t, err)
 	assert.Nil(t, records)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestEncodeContinuationToken(t *testing.T) {
-	db, _, repo := setupTestDB(t)
+func TestGetAll_Truncated(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
 	defer db.Close()
 
-	resourceType := "user"
-	resourceID := "user-123"
-	createdAt := time.Unix(1234567890, 0)
+	repo.SetGetAllLimit(2)
+	now := time.Now()
 
-	token := repo.encodeContinuationToken(resourceType, resourceID, createdAt)
-	assert.NotEmpty(t, token)
+	rows := sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+		AddRow("user-3", "user", nil, now, now, nil).
+		AddRow("user-2", "user", nil, now, now, nil).
+		AddRow("user-1", "user", nil, now, now, nil)
 
-	// Verify we can decode it back
-	decodedType, decodedID, decodedTime, err := repo.decodeContinuationToken(token)
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs(3).
+		WillReturnRows(rows)
+
+	records, truncated, err := repo.GetAll()
 	assert.NoError(t, err)
-	assert.Equal(t, resourceType, decodedType)
-	assert.Equal(t, resourceID, decodedID)
-	assert.Equal(t, createdAt.Unix(), decodedTime.Unix())
+	assert.True(t, truncated)
+	assert.Len(t, records, 2)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestDecodeContinuationToken_InvalidBase64(t *testing.T) {
-	db, _, repo := setupTestDB(t)
+func TestGetGroupedByType(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
 	defer db.Close()
 
-	_, _, _, err := repo.decodeContinuationToken("invalid-base64!")
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "invalid continuation token")
+	older := time.Unix(1234567000, 0)
+	newer := time.Unix(1234567890, 0)
+	rows := sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+		AddRow("doc-1", "document", nil, newer, newer, nil).
+		AddRow("user-2", "user", nil, newer, newer, nil).
+		AddRow("user-3", "user", nil, older, older, nil).
+		AddRow("user-1", "user", nil, older, older, nil)
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context ORDER BY resource_type, created_at DESC, resource_id DESC$`).
+		WithArgs().
+		WillReturnRows(rows)
+
+	groups, err := repo.GetGroupedByType(0)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+
+	ids := func(records []Record) []string {
+		var ids []string
+		for _, record := range records {
+			ids = append(ids, record.ResourceID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"doc-1"}, ids(groups["document"]))
+	assert.Equal(t, []string{"user-2", "user-3", "user-1"}, ids(groups["user"]), "the database order is kept within a group")
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestDecodeContinuationToken_InvalidFormat(t *testing.T) {
-	db, _, repo := setupTestDB(t)
+func TestGetGroupedByType_PerTypeLimit(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
 	defer db.Close()
 
-	// Manually create invalid format (only 2 parts instead of 3)
-	invalidData := base64.URLEncoding.EncodeToString([]byte("user|only-two-parts"))
+	now := time.Now()
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM \(SELECT resource_id, resource_type, context, created_at, updated_at, metadata, ROW_NUMBER\(\) OVER \(PARTITION BY resource_type ORDER BY created_at DESC, resource_id DESC\) AS type_rank FROM resource_context\) AS ranked WHERE type_rank <= \? ORDER BY resource_type, created_at DESC, resource_id DESC`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+			AddRow("user-3", "user", nil, now, now, nil).
+			AddRow("user-2", "user", nil, now, now, nil))
+
+	groups, err := repo.GetGroupedByType(2)
+	require.NoError(t, err)
+	assert.Len(t, groups["user"], 2)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
 
-	_, _, _, err := repo.decodeContinuationToken(invalidData)
+func TestGetGroupedByType_Error(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT .* FROM resource_context ORDER BY resource_type`).WillReturnError(assert.AnError)
+
+	groups, err := repo.GetGroupedByType(0)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "invalid continuation token format")
+	assert.Nil(t, groups)
 }
 
-func TestGetPaginated_FirstPage(t *testing.T) {
+func TestForEach(t *testing.T) {
 	db, mock, repo := setupTestDB(t)
 	defer db.Close()
 
 	now := time.Now()
-	context1 := `{"action": "login"}`
+	rows := sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata", "claimed_at"}).
+		AddRow("doc-456", "document", nil, now, now, nil, now).
+		AddRow("user-123", "user", nil, now, now, nil, nil)
 
-	// Mock returns 6 rows (pageSize + 1) to test pagination
-	rows := sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at"}).
-		AddRow("user-1", "user", &context1, now, now).
-		AddRow("user-2", "user", nil, now, now).
-		AddRow("user-3", "user", nil, now, now).
-		AddRow("user-4", "user", nil, now, now).
-		AddRow("user-5", "user", nil, now, now).
-		AddRow("user-6", "user", nil, now, now)
-
-	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at FROM resource_context ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
-		WithArgs(6). // pageSize + 1
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata, claimed_at FROM resource_context ORDER BY resource_type, resource_id$`).
 		WillReturnRows(rows)
 
-	result, err := repo.GetPaginated("", 5)
+	var ids []string
+	var claimed []bool
+	err := repo.ForEach(func(record Record) error {
+		ids = append(ids, record.ResourceID)
+		claimed = append(claimed, record.ClaimedAt() != nil)
+		return nil
+	})
 	assert.NoError(t, err)
-	assert.Len(t, result.Records, 5) // Should return only pageSize records
-	assert.NotNil(t, result.NextContinuationToken) // Should have next token
+	assert.Equal(t, []string{"doc-456", "user-123"}, ids)
+	assert.Equal(t, []bool{true, false}, claimed)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestGetPaginated_WithToken(t *testing.T) {
+func TestForEach_StopsAtCallbackError(t *testing.T) {
 	db, mock, repo := setupTestDB(t)
 	defer db.Close()
 
-	// Use a fixed time to avoid precision issues
-	now := time.Unix(1234567890, 0)
-	token := repo.encodeContinuationToken("user", "user-5", now)
-
-	rows := sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at"}).
-		AddRow("user-6", "user", nil, now, now)
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata", "claimed_at"}).
+		AddRow("doc-456", "document", nil, now, now, nil, now).
+		AddRow("user-123", "user", nil, now, now, nil, nil)
 
-	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at FROM resource_context WHERE \(created_at < \? OR \(created_at = \? AND resource_type < \?\) OR \(created_at = \? AND resource_type = \? AND resource_id < \?\)\) ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
-		WithArgs(now, now, "user", now, "user", "user-5", 6).
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata, claimed_at FROM resource_context ORDER BY resource_type, resource_id$`).
 		WillReturnRows(rows)
 
-	result, err := repo.GetPaginated(token, 5)
+	calls := 0
+	err := repo.ForEach(func(record Record) error {
+		calls++
+		return assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 1, calls)
+}
+
+func TestGetAll_Unlimited(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	repo.SetGetAllLimit(0)
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context ORDER BY created_at DESC, resource_type DESC, resource_id DESC$`).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}))
+
+	_, truncated, err := repo.GetAll()
 	assert.NoError(t, err)
-	assert.Len(t, result.Records, 1)
-	assert.Nil(t, result.NextContinuationToken) // No more pages
+	assert.False(t, truncated)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestGetPaginated_InvalidToken(t *testing.T) {
-	db, _, repo := setupTestDB(t)
+func TestGetAllLenient(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
 	defer db.Close()
 
-	result, err := repo.GetPaginated("invalid-token", 5)
-	assert.Error(t, err)
-	assert.Nil(t, result)
+	now := time.Now()
+	// The second row's created_at is not a time and cannot be scanned
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(testutil.RecordColumns).
+			AddRow("user-3", "user", nil, now, now, nil).
+			AddRow("user-2", "user", nil, "not a time", now, nil).
+			AddRow("user-1", "user", nil, now, now, nil)
+	}
+	query := `SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`
+	mock.ExpectQuery(query).WithArgs(DefaultGetAllLimit + 1).WillReturnRows(rows())
+	mock.ExpectQuery(query).WithArgs(DefaultGetAllLimit + 1).WillReturnRows(rows())
+
+	// Strict reads still fail on the row
+	_, _, err := repo.GetAll()
+	assert.ErrorContains(t, err, "created_at")
+
+	records, truncated, warnings, err := repo.GetAllLenient()
+	require.NoError(t, err)
+	assert.False(t, truncated)
+	require.Len(t, records, 2)
+	assert.Equal(t, "user-3", records[0].ResourceID)
+	assert.Equal(t, "user-1", records[1].ResourceID)
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "row 2 skipped")
+	assert.Contains(t, warnings[0], "created_at")
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestGetPaginated_DefaultPageSize(t *testing.T) {
+func TestGetAllLenient_SkippedRowsCountTowardsLimit(t *testing.T) {
 	db, mock, repo := setupTestDB(t)
 	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at"})
+	repo.SetGetAllLimit(2)
+	now := time.Now()
+	mock.ExpectQuery(`SELECT .* FROM resource_context`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(testutil.RecordColumns).
+			AddRow("user-3", "user", nil, now, now, nil).
+			AddRow("user-2", "user", nil, now, now, "{not json").
+			AddRow("user-1", "user", nil, now, now, nil))
 
-	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at FROM resource_context ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
-		WithArgs(DefaultPageSize + 1).
-		WillReturnRows(rows)
+	records, truncated, warnings, err := repo.GetAllLenient()
+	require.NoError(t, err)
+	assert.True(t, truncated, "three rows exceed the limit of two")
+	assert.Len(t, records, 2)
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "invalid metadata for user/user-2")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
 
-	result, err := repo.GetPaginated("", 0) // Invalid page size should use default
+func TestCount(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM resource_context`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+
+	count, err := repo.Count()
 	assert.NoError(t, err)
-	assert.NotNil(t, result)
+	assert.Equal(t, int64(42), count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCountApproximate(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	require.NoError(t, repo.SetTypeTables(map[string]string{"user": "resource_context_user"}))
+
+	mock.ExpectQuery(`SELECT COALESCE\(SUM\(table_rows\), 0\) FROM information_schema.tables WHERE table_schema = DATABASE\(\) AND table_name IN \(\?, \?\)`).
+		WithArgs("resource_context", "resource_context_user").
+		WillReturnRows(sqlmock.NewRows([]string{"rows"}).AddRow(1250000))
+
+	count, err := repo.CountApproximate()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1250000), count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCountApproximate_Error(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM information_schema.tables`).WithArgs("resource_context").WillReturnError(assert.AnError)
+
+	_, err := repo.CountApproximate()
+	assert.ErrorIs(t, err, assert.AnError)
 	assert.NoError(t, mock.ExpectationsWereMet())
-}
\ No newline at end of file
+}
+
+func TestEncodeContinuationToken(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	resourceType := "user"
+	resourceID := "user-123"
+	createdAt := time.Unix(1234567890, 0)
+
+	token := repo.encodeContinuationToken(cursor{ResourceType: resourceType, ResourceID: resourceID, CreatedAt: createdAt, Page: 3})
+	assert.NotEmpty(t, token)
+
+	// Verify we can decode it back
+	decoded, err := repo.decodeContinuationToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, resourceType, decoded.ResourceType)
+	assert.Equal(t, resourceID, decoded.ResourceID)
+	assert.Equal(t, createdAt.Unix(), decoded.CreatedAt.Unix())
+	assert.Equal(t, 3, decoded.Page)
+}
+
+func TestDecodeContinuationToken_InvalidBase64(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	_, err := repo.decodeContinuationToken("invalid-base64!")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid continuation token")
+}
+
+func TestDecodeContinuationToken_InvalidFormat(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	// Manually create invalid format (only 2 parts instead of 3)
+	invalidData := base64.URLEncoding.EncodeToString([]byte("user|only-two-parts"))
+
+	_, err := repo.decodeContinuationToken(invalidData)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Contains(t, err.Error(), "invalid continuation token format")
+}
+
+func TestDecodeContinuationToken_LegacyWithoutPage(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	legacy := base64.URLEncoding.EncodeToString([]byte("user|user-123|1234567890"))
+
+	decoded, err := repo.decodeContinuationToken(legacy)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-123", decoded.ResourceID)
+	assert.Equal(t, 1, decoded.Page)
+}
+
+func TestDecodeContinuationToken_InvalidJSON(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	invalidData := base64.URLEncoding.EncodeToString([]byte(`{"t": "user", "i": `))
+
+	_, err := repo.decodeContinuationToken(invalidData)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Contains(t, err.Error(), "invalid continuation token format")
+}
+
+func TestDecodeContinuationToken_ImpossibleCursor(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	// Found by FuzzDecodeContinuationToken: none of these decode to a cursor that
+	// survives being encoded again
+	for _, payload := range []string{
+		"user|user-\xab|1234567890",
+		`{"t":"user","i":"user-1","c":9223372036854775807,"p":1}`,
+		`{"t":"user","i":"user-1","c":1234567890,"p":1,"s":-9223372036854775808}`,
+		`{"t":"user","i":"user-1","c":1234567890,"p":9223372036854775807}`,
+	} {
+		_, err := repo.decodeContinuationToken(base64.URLEncoding.EncodeToString([]byte(payload)))
+		assert.ErrorIs(t, err, ErrInvalidToken, payload)
+	}
+}
+
+func TestDecodeContinuationToken_MaxLength(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	token := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-123", CreatedAt: time.Unix(1234567890, 0), Page: 1})
+
+	repo.SetMaxTokenLength(len(token))
+	_, err := repo.decodeContinuationToken(token)
+	assert.NoError(t, err, "a token exactly at the limit is accepted")
+
+	repo.SetMaxTokenLength(len(token) - 1)
+	_, err = repo.decodeContinuationToken(token)
+	assert.ErrorIs(t, err, ErrTokenTooLong)
+	assert.EqualError(t, err, fmt.Sprintf("continuation token too long: %d bytes, the limit is %d", len(token), len(token)-1))
+
+	repo.SetMaxTokenLength(0)
+	_, err = repo.decodeContinuationToken(token)
+	assert.NoError(t, err, "a limit of 0 disables the check")
+}
+
+func TestDecodeContinuationToken_DefaultMaxLength(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	_, err := repo.decodeContinuationToken(strings.Repeat("A", DefaultMaxTokenLength+1))
+	assert.ErrorIs(t, err, ErrTokenTooLong)
+
+	// The longest keys a record can have still fit, even in an encrypted token
+	require.NoError(t, repo.EnableTokenEncryption(make([]byte, 32)))
+	longest := cursor{
+		ResourceType: strings.Repeat("t", 128),
+		ResourceID:   strings.Repeat("i", 128),
+		CreatedAt:    time.Unix(1234567890, 0),
+		Page:         DefaultMaxPageDepth,
+		Order:        "resource_type.desc",
+		Snapshot:     time.Unix(1234567890, 0),
+	}
+	_, err = repo.decodeContinuationToken(repo.encodeContinuationToken(longest))
+	assert.NoError(t, err)
+}
+
+func TestGetPaginated_TokenTooLong(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	_, err := repo.GetPaginated(strings.Repeat("A", 1<<20), 5)
+	assert.ErrorIs(t, err, ErrTokenTooLong)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestContinuationToken_PipeInIdentifiers(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	original := cursor{ResourceType: "weird|type", ResourceID: "id|with|pipes", CreatedAt: time.Unix(1234567890, 0), Page: 2}
+
+	decoded, err := repo.decodeContinuationToken(repo.encodeContinuationToken(original))
+	require.NoError(t, err)
+	assert.Equal(t, original.ResourceType, decoded.ResourceType)
+	assert.Equal(t, original.ResourceID, decoded.ResourceID)
+	assert.Equal(t, original.CreatedAt.Unix(), decoded.CreatedAt.Unix())
+	assert.Equal(t, original.Page, decoded.Page)
+}
+
+func TestGetPaginated_ResumesAfterIDWithPipe(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Unix(1234567890, 0)
+	columns := []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}
+
+	// Inserting an id containing the old separator must be accepted
+	mock.ExpectExec(`INSERT INTO resource_context`).
+		WithArgs("user|2", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	require.NoError(t, repo.Insert("user|2", "user", nil))
+
+	// First page ends on the record whose id contains a pipe
+	mock.ExpectQuery(`FROM resource_context ORDER BY .* LIMIT \?`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("user|3", "user", nil, now, now, nil).
+			AddRow("user|2", "user", nil, now, now, nil).
+			AddRow("user|1", "user", nil, now, now, nil))
+
+	first, err := repo.GetPaginated("", 2)
+	require.NoError(t, err)
+	require.NotNil(t, first.NextContinuationToken)
+
+	// The second page must resume strictly after "user|2"
+	mock.ExpectQuery(`FROM resource_context WHERE created_at <= \? AND \(created_at < \? OR .*\) ORDER BY .* LIMIT \?`).
+		WithArgs(sqlmock.AnyArg(), now, now, "user", now, "user", "user|2", 3).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("user|1", "user", nil, now, now, nil))
+
+	second, err := repo.GetPaginated(*first.NextContinuationToken, 2)
+	require.NoError(t, err)
+	require.Len(t, second.Records, 1)
+	assert.Equal(t, "user|1", second.Records[0].ResourceID)
+	assert.Nil(t, second.NextContinuationToken)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestContinuationToken_EncryptedRoundTrip(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	require.NoError(t, repo.EnableTokenEncryption([]byte("0123456789abcdef0123456789abcdef")))
+
+	createdAt := time.Unix(1234567890, 0)
+	token := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-123", CreatedAt: createdAt, Page: 1})
+
+	// The payload must not be readable by simply base64-decoding the token
+	raw, err := base64.URLEncoding.DecodeString(token)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "user-123")
+
+	decoded, err := repo.decodeContinuationToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", decoded.ResourceType)
+	assert.Equal(t, "user-123", decoded.ResourceID)
+	assert.Equal(t, createdAt.Unix(), decoded.CreatedAt.Unix())
+}
+
+func TestContinuationToken_EncryptedTamperedRejected(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	require.NoError(t, repo.EnableTokenEncryption([]byte("0123456789abcdef")))
+
+	token := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-123", CreatedAt: time.Unix(1234567890, 0), Page: 1})
+	raw, err := base64.URLEncoding.DecodeString(token)
+	require.NoError(t, err)
+
+	raw[len(raw)-1] ^= 0x01
+	tampered := base64.URLEncoding.EncodeToString(raw)
+
+	_, err = repo.decodeContinuationToken(tampered)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid continuation token")
+}
+
+func TestContinuationToken_EncryptedRejectsPlaintextToken(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	plaintext := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-123", CreatedAt: time.Unix(1234567890, 0), Page: 1})
+
+	require.NoError(t, repo.EnableTokenEncryption([]byte("0123456789abcdef")))
+
+	_, err := repo.decodeContinuationToken(plaintext)
+	assert.Error(t, err)
+}
+
+func TestEnableTokenEncryption_InvalidKey(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	err := repo.EnableTokenEncryption([]byte("short"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid token encryption key")
+}
+
+func TestGetPaginated_FirstPage(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	// Six records created within one second, as the database lists them
+	factory := testutil.NewRecordFactory(1)
+	factory.GroupSize = 6
+	factory.Types = []string{"user"}
+	records := factory.Records(6)
+	slices.Reverse(records)
+
+	// Mock returns 6 rows (pageSize + 1) to test pagination
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs(6). // pageSize + 1
+		WillReturnRows(testutil.MockRows(records...))
+
+	result, err := repo.GetPaginated("", 5)
+	assert.NoError(t, err)
+	assert.Len(t, result.Records, 5) // Should return only pageSize records
+	assert.False(t, result.IsLastPage)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// The next page resumes after the last record returned
+	require.NotNil(t, result.NextContinuationToken)
+	next, err := testutil.DecodeToken(*result.NextContinuationToken)
+	require.NoError(t, err)
+	assert.NotZero(t, next.Snapshot)
+	next.Snapshot = 0
+	assert.Equal(t, testutil.TokenAfter(records[4], 1, time.Time{}), next)
+}
+
+func TestGetPaginated_WithToken(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	factory := testutil.NewRecordFactory(1)
+	factory.Types = []string{"user"}
+	records := factory.Records(2)
+	last := testutil.TokenAfter(records[1], 1, time.Time{})
+
+	now := time.Unix(last.CreatedAt, 0)
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context WHERE \(created_at < \? OR \(created_at = \? AND resource_type < \?\) OR \(created_at = \? AND resource_type = \? AND resource_id < \?\)\) ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs(now, now, "user", now, "user", records[1].ResourceID, 6).
+		WillReturnRows(testutil.MockRows(records[0]))
+
+	result, err := repo.GetPaginated(last.Encode(), 5)
+	assert.NoError(t, err)
+	assert.Len(t, result.Records, 1)
+	assert.Nil(t, result.NextContinuationToken) // No more pages
+	assert.True(t, result.IsLastPage)           // Underfilled final page
+	assert.Equal(t, 2, result.PageDepth)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedLenient(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	factory := testutil.NewRecordFactory(1)
+	factory.Types = []string{"user"}
+	records := factory.Records(2)
+	slices.Reverse(records)
+
+	// The row between the two records has a created_at of the wrong type
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(testutil.RecordColumns).
+			AddRow(records[0].ResourceID, "user", nil, records[0].CreatedAt, records[0].UpdatedAt, nil).
+			AddRow("user-bad", "user", nil, 42, records[0].UpdatedAt, nil).
+			AddRow(records[1].ResourceID, "user", nil, records[1].CreatedAt, records[1].UpdatedAt, nil)
+	}
+	query := `SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`
+	mock.ExpectQuery(query).WithArgs(3).WillReturnRows(rows())
+	mock.ExpectQuery(query).WithArgs(3).WillReturnRows(rows())
+
+	// Strict reads fail on the row
+	_, err := repo.GetPaginated("", 2)
+	assert.ErrorContains(t, err, "created_at")
+
+	result, err := repo.GetPaginatedLenient("", 2)
+	require.NoError(t, err)
+	require.Len(t, result.Records, 2)
+	assert.Equal(t, records[0].ResourceID, result.Records[0].ResourceID)
+	assert.Equal(t, records[1].ResourceID, result.Records[1].ResourceID)
+	require.Len(t, result.Warnings, 1)
+	assert.Contains(t, result.Warnings[0], "row 2 skipped")
+	assert.NotNil(t, result.SinceToken)
+
+	// Three rows were read for a page of two, so another page follows the last
+	// record returned
+	assert.False(t, result.IsLastPage)
+	require.NotNil(t, result.NextContinuationToken)
+	next, err := testutil.DecodeToken(*result.NextContinuationToken)
+	require.NoError(t, err)
+	assert.Equal(t, records[1].ResourceID, next.ResourceID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedLenient_NoRowScanned(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT .* FROM resource_context ORDER BY`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(testutil.RecordColumns).
+			AddRow("user-3", "user", nil, "bad", now, nil).
+			AddRow("user-2", "user", nil, "bad", now, nil).
+			AddRow("user-1", "user", nil, "bad", now, nil))
+
+	// No record is left to continue the walk from
+	_, err := repo.GetPaginatedLenient("", 2)
+	assert.ErrorContains(t, err, "no row of the page could be scanned")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginated_HasMoreStrategies(t *testing.T) {
+	// Three records created within one second, newest first
+	factory := testutil.NewRecordFactory(1)
+	factory.GroupSize = 3
+	factory.Types = []string{"user"}
+	records := factory.Records(3)
+	slices.Reverse(records)
+	newRows := func(n int) *sqlmock.Rows { return testutil.MockRows(records[:n]...) }
+	now := records[1].CreatedAt
+
+	tests := []struct {
+		name      string
+		strategy  HasMoreStrategy
+		setup     func(mock sqlmock.Sqlmock)
+		wantCount int
+		wantToken bool
+	}{
+		{
+			name:     "fetch extra with more rows",
+			strategy: HasMoreFetchExtra,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM resource_context ORDER BY .* LIMIT \?`).WithArgs(3).WillReturnRows(newRows(3))
+			},
+			wantCount: 2,
+			wantToken: true,
+		},
+		{
+			name:     "fetch extra exact fit",
+			strategy: HasMoreFetchExtra,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM resource_context ORDER BY .* LIMIT \?`).WithArgs(3).WillReturnRows(newRows(2))
+			},
+			wantCount: 2,
+			wantToken: false,
+		},
+		{
+			name:     "exists with more rows",
+			strategy: HasMoreExists,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM resource_context ORDER BY .* LIMIT \?`).WithArgs(2).WillReturnRows(newRows(2))
+				mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM resource_context WHERE \(created_at < \? OR .*\)\)`).
+					WithArgs(now, now, "user", now, "user", records[1].ResourceID).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+			},
+			wantCount: 2,
+			wantToken: true,
+		},
+		{
+			name:     "exists exact fit",
+			strategy: HasMoreExists,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM resource_context ORDER BY .* LIMIT \?`).WithArgs(2).WillReturnRows(newRows(2))
+				mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM resource_context WHERE`).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			},
+			wantCount: 2,
+			wantToken: false,
+		},
+		{
+			name:     "exists skipped on short page",
+			strategy: HasMoreExists,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM resource_context ORDER BY .* LIMIT \?`).WithArgs(2).WillReturnRows(newRows(1))
+			},
+			wantCount: 1,
+			wantToken: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, repo := setupTestDB(t)
+			defer db.Close()
+
+			repo.SetHasMoreStrategy(tt.strategy)
+			tt.setup(mock)
+
+			result, err := repo.GetPaginated("", 2)
+			require.NoError(t, err)
+			assert.Len(t, result.Records, tt.wantCount)
+			assert.Equal(t, tt.wantToken, result.NextContinuationToken != nil)
+			assert.Equal(t, !tt.wantToken, result.IsLastPage)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetPaginated_TooDeep(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	repo.SetMaxPageDepth(3)
+	token := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-5", CreatedAt: time.Unix(1234567890, 0), Page: 3})
+
+	result, err := repo.GetPaginated(token, 5)
+	assert.ErrorIs(t, err, ErrPaginationTooDeep)
+	assert.Nil(t, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginated_SnapshotExcludesLaterRecords(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Unix(1234567890, 0)
+	columns := []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}
+
+	before := time.Now().Truncate(time.Second)
+	mock.ExpectQuery(`SELECT .* FROM resource_context ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("user-3", "user", nil, now, now, nil).
+			AddRow("user-2", "user", nil, now, now, nil))
+
+	first, err := repo.GetPaginated("", 1)
+	require.NoError(t, err)
+	require.NotNil(t, first.NextContinuationToken)
+
+	// The first page pins the snapshot to the time of the request
+	last, err := repo.decodeContinuationToken(*first.NextContinuationToken)
+	require.NoError(t, err)
+	snapshot := last.Snapshot
+	assert.False(t, snapshot.Before(before))
+	assert.False(t, snapshot.After(time.Now()))
+
+	// Later pages exclude records created after the snapshot and carry it forward
+	for page := 2; page <= 3; page++ {
+		mock.ExpectQuery(`FROM resource_context WHERE created_at <= \? AND \(created_at < \? OR .*\) ORDER BY`).
+			WithArgs(snapshot, now, now, "user", now, "user", sqlmock.AnyArg(), 2).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(fmt.Sprintf("user-%d", 3-page), "user", nil, now, now, nil).
+				AddRow("user-0", "user", nil, now, now, nil))
+
+		next, err := repo.GetPaginated(*first.NextContinuationToken, 1)
+		require.NoError(t, err)
+		require.NotNil(t, next.NextContinuationToken)
+
+		last, err := repo.decodeContinuationToken(*next.NextContinuationToken)
+		require.NoError(t, err)
+		assert.Equal(t, snapshot, last.Snapshot)
+		first = next
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginated_SnapshotAppliesToExistsProbe(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	repo.SetHasMoreStrategy(HasMoreExists)
+	now := time.Unix(1234567890, 0)
+	snapshot := time.Unix(1234569999, 0).UTC()
+	columns := []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}
+	token := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-5", CreatedAt: now, Page: 1, Snapshot: snapshot})
+
+	mock.ExpectQuery(`FROM resource_context WHERE created_at <= \? AND \(created_at < \? OR .*\) ORDER BY`).
+		WithArgs(snapshot, now, now, "user", now, "user", "user-5", 1).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("user-4", "user", nil, now, now, nil))
+	mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM resource_context WHERE created_at <= \? AND \(created_at < \? OR .*\)\)`).
+		WithArgs(snapshot, now, now, "user", now, "user", "user-4").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	result, err := repo.GetPaginated(token, 1)
+	require.NoError(t, err)
+	assert.True(t, result.IsLastPage)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginated_DepthLimitDisabled(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	repo.SetMaxPageDepth(0)
+	now := time.Unix(1234567890, 0)
+	token := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-5", CreatedAt: now, Page: DefaultMaxPageDepth + 10})
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context WHERE`).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}))
+
+	result, err := repo.GetPaginated(token, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultMaxPageDepth+11, result.PageDepth)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginated_TokenCarriesPageIndex(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Unix(1234567890, 0)
+	token := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-5", CreatedAt: now, Page: 4})
+
+	rows := sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+		AddRow("user-4", "user", nil, now, now, nil).
+		AddRow("user-3", "user", nil, now, now, nil)
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context WHERE`).
+		WillReturnRows(rows)
+
+	result, err := repo.GetPaginated(token, 1)
+	require.NoError(t, err)
+	require.NotNil(t, result.NextContinuationToken)
+
+	next, err := repo.decodeContinuationToken(*result.NextContinuationToken)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, next.Page)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginated_InvalidToken(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	result, err := repo.GetPaginated("invalid-token", 5)
+	assert.Error(t, err)
+	assert.Nil(t, result)
+}
+
+func TestGetPaginated_DefaultPageSize(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"})
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs(DefaultPageSize + 1).
+		WillReturnRows(rows)
+
+	result, err := repo.GetPaginated("", 0) // Invalid page size should use default
+	assert.NoError(t, err)
+	assert.NotNil(t, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedFiltered_MetadataKey(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Unix(1234567890, 0)
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context WHERE JSON_CONTAINS_PATH\(metadata, 'one', \?\) ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs(`$."tier"`, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+			AddRow("user-1", "user", nil, now, now, `{"tier":"gold"}`))
+
+	result, err := repo.GetPaginatedFiltered(PaginationFilter{MetadataKey: "tier"}, "", 2)
+	require.NoError(t, err)
+	require.Len(t, result.Records, 1)
+	assert.Equal(t, "gold", result.Records[0].Metadata["tier"])
+	assert.Nil(t, result.NextContinuationToken)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedFiltered_TypeAndMetadataKey(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM resource_context WHERE resource_type = \? AND JSON_CONTAINS_PATH\(metadata, 'one', \?\) ORDER BY`).
+		WithArgs("user", `$."a.b \"c\""`, 6).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}))
+
+	result, err := repo.GetPaginatedFiltered(PaginationFilter{ResourceType: "user", MetadataKey: `a.b "c"`}, "", 5)
+	require.NoError(t, err)
+	assert.Empty(t, result.Records)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedFiltered_ExcludeOneType(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM resource_context WHERE resource_type NOT IN \(\?\) ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs("audit", 6).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}))
+
+	result, err := repo.GetPaginatedFiltered(PaginationFilter{ExcludeTypes: []string{"audit"}}, "", 5)
+	require.NoError(t, err)
+	assert.Empty(t, result.Records)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedFiltered_ExcludeTypesAcrossPages(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Unix(1234567890, 0)
+	columns := []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}
+	filter := PaginationFilter{ExcludeTypes: []string{"audit", "internal"}}
+
+	mock.ExpectQuery(`FROM resource_context WHERE resource_type NOT IN \(\?, \?\) ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs("audit", "internal", 3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("user-3", "user", nil, now, now, nil).
+			AddRow("user-2", "user", nil, now, now, nil).
+			AddRow("user-1", "user", nil, now, now, nil))
+
+	first, err := repo.GetPaginatedFiltered(filter, "", 2)
+	require.NoError(t, err)
+	require.Len(t, first.Records, 2)
+	require.NotNil(t, first.NextContinuationToken)
+
+	last, err := repo.decodeContinuationToken(*first.NextContinuationToken)
+	require.NoError(t, err)
+
+	// The exclusion precedes the snapshot bound and the cursor predicate, so the
+	// second page resumes after user-2 among the same records
+	mock.ExpectQuery(`FROM resource_context WHERE resource_type NOT IN \(\?, \?\) AND created_at <= \? AND \(created_at < \? OR .*\) ORDER BY`).
+		WithArgs("audit", "internal", last.Snapshot, now, now, "user", now, "user", "user-2", 3).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("user-1", "user", nil, now, now, nil))
+
+	second, err := repo.GetPaginatedFiltered(filter, *first.NextContinuationToken, 2)
+	require.NoError(t, err)
+	require.Len(t, second.Records, 1)
+	assert.Equal(t, "user-1", second.Records[0].ResourceID)
+	assert.True(t, second.IsLastPage)
+	assert.Nil(t, second.NextContinuationToken)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaginationFilter_IsZero(t *testing.T) {
+	assert.True(t, PaginationFilter{}.IsZero())
+	assert.True(t, PaginationFilter{ExcludeTypes: []string{}}.IsZero())
+	assert.False(t, PaginationFilter{ExcludeTypes: []string{"audit"}}.IsZero())
+	assert.False(t, PaginationFilter{MissingContext: true}.IsZero())
+	assert.False(t, PaginationFilter{CreatedBefore: time.Unix(1, 0)}.IsZero())
+}
+
+func TestGetActivityFeed_OrdersByGreatest(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	created := time.Unix(1234567000, 0)
+	updated := time.Unix(1234567890, 0)
+	columns := []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context ORDER BY GREATEST\(created_at, updated_at\) DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("user-2", "user", nil, updated, updated, nil).
+			AddRow("user-1", "user", nil, created, updated, nil).
+			AddRow("user-0", "user", nil, created, created, nil))
+
+	first, err := repo.GetActivityFeed(2, "")
+	require.NoError(t, err)
+	require.Len(t, first.Records, 2)
+	require.NotNil(t, first.NextContinuationToken)
+	assert.False(t, first.IsLastPage)
+
+	// The token carries the activity time of user-1, i.e. its updated_at
+	last, err := repo.decodeContinuationToken(*first.NextContinuationToken)
+	require.NoError(t, err)
+	assert.Equal(t, updated.Unix(), last.CreatedAt.Unix())
+	assert.Equal(t, "activity", last.Order)
+
+	mock.ExpectQuery(`FROM resource_context WHERE created_at <= \? AND \(GREATEST\(created_at, updated_at\) < \? OR \(GREATEST\(created_at, updated_at\) = \? AND resource_type < \?\) OR \(GREATEST\(created_at, updated_at\) = \? AND resource_type = \? AND resource_id < \?\)\) ORDER BY GREATEST\(created_at, updated_at\) DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs(sqlmock.AnyArg(), updated, updated, "user", updated, "user", "user-1", 3).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("user-0", "user", nil, created, created, nil))
+
+	second, err := repo.GetActivityFeed(2, *first.NextContinuationToken)
+	require.NoError(t, err)
+	require.Len(t, second.Records, 1)
+	assert.True(t, second.IsLastPage)
+	assert.Equal(t, 2, second.PageDepth)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetActivityFeed_RejectsListingToken(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	listingToken := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-1", CreatedAt: time.Unix(1234567890, 0), Page: 1})
+	_, err := repo.GetActivityFeed(5, listingToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.ErrorContains(t, err, "issued for a different listing")
+
+	activityToken := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-1", CreatedAt: time.Unix(1234567890, 0), Page: 1, Order: "activity"})
+	_, err = repo.GetPaginated(activityToken, 5)
+	assert.ErrorContains(t, err, "issued for a different listing")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetLastPage(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	columns := []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}
+	at := func(sec int64) time.Time { return time.Unix(1234567890+sec, 0) }
+
+	// The tail is read oldest first
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context ORDER BY created_at ASC, resource_type ASC, resource_id ASC LIMIT \?`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("user-1", "user", nil, at(1), at(1), nil).
+			AddRow("user-2", "user", nil, at(2), at(2), nil).
+			AddRow("user-3", "user", nil, at(3), at(3), nil))
+
+	tail, err := repo.GetLastPage(2)
+	require.NoError(t, err)
+	require.Len(t, tail.Records, 2)
+	assert.Equal(t, "user-2", tail.Records[0].ResourceID)
+	assert.Equal(t, "user-1", tail.Records[1].ResourceID)
+	assert.True(t, tail.IsLastPage)
+	assert.Nil(t, tail.NextContinuationToken)
+	require.NotNil(t, tail.PrevContinuationToken)
+
+	prev, err := repo.decodeContinuationToken(*tail.PrevContinuationToken)
+	require.NoError(t, err)
+	assert.True(t, prev.Backward)
+	assert.Equal(t, "user-2", prev.ResourceID)
+	assert.Equal(t, at(2).Unix(), prev.CreatedAt.Unix())
+
+	// Following the prev token scans forward in time from the tail's newest record
+	mock.ExpectQuery(`FROM resource_context WHERE created_at <= \? AND \(created_at > \? OR \(created_at = \? AND resource_type > \?\) OR \(created_at = \? AND resource_type = \? AND resource_id > \?\)\) ORDER BY created_at ASC, resource_type ASC, resource_id ASC LIMIT \?`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "user", sqlmock.AnyArg(), "user", "user-2", 3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("user-3", "user", nil, at(3), at(3), nil).
+			AddRow("user-4", "user", nil, at(4), at(4), nil))
+
+	before, err := repo.GetPaginated(*tail.PrevContinuationToken, 2)
+	require.NoError(t, err)
+	require.Len(t, before.Records, 2)
+	assert.Equal(t, "user-4", before.Records[0].ResourceID)
+	assert.Equal(t, "user-3", before.Records[1].ResourceID)
+	assert.False(t, before.IsLastPage)
+	assert.Equal(t, 2, before.PageDepth)
+	assert.Nil(t, before.PrevContinuationToken, "user-4 is the newest record")
+	require.NotNil(t, before.NextContinuationToken)
+
+	next, err := repo.decodeContinuationToken(*before.NextContinuationToken)
+	require.NoError(t, err)
+	assert.False(t, next.Backward)
+	assert.Equal(t, "user-3", next.ResourceID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetLastPage_SinglePage(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Unix(1234567890, 0)
+	mock.ExpectQuery(`ORDER BY created_at ASC, resource_type ASC, resource_id ASC LIMIT \?`).
+		WithArgs(6).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+			AddRow("user-1", "user", nil, now, now, nil))
+
+	result, err := repo.GetLastPage(5)
+	require.NoError(t, err)
+	require.Len(t, result.Records, 1)
+	assert.True(t, result.IsLastPage)
+	assert.Nil(t, result.PrevContinuationToken)
+	assert.Nil(t, result.NextContinuationToken)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetNewer_LoadOlderAndPollNewer(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	columns := []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}
+	at := func(sec int64) time.Time { return time.Unix(1234567890+sec, 0) }
+
+	mock.ExpectQuery(`FROM resource_context ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("user-5", "user", nil, at(5), at(5), nil).
+			AddRow("user-4", "user", nil, at(4), at(4), nil).
+			AddRow("user-3", "user", nil, at(3), at(3), nil))
+
+	first, err := repo.GetPaginated("", 2)
+	require.NoError(t, err)
+	require.NotNil(t, first.NextContinuationToken)
+	require.NotNil(t, first.SinceToken)
+
+	since, err := repo.decodeContinuationToken(*first.SinceToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user-5", since.ResourceID)
+	assert.True(t, since.Backward)
+	assert.True(t, since.Snapshot.IsZero())
+
+	// Load older: the continuation token keeps paging towards older records
+	mock.ExpectQuery(`FROM resource_context WHERE created_at <= \? AND \(created_at < \?`).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("user-3", "user", nil, at(3), at(3), nil))
+
+	older, err := repo.GetPaginated(*first.NextContinuationToken, 2)
+	require.NoError(t, err)
+	require.Len(t, older.Records, 1)
+	assert.Equal(t, "user-3", older.Records[0].ResourceID)
+	assert.Nil(t, older.SinceToken, "only the first page marks the newest record")
+
+	// Poll newer: records after user-5, read oldest first without a snapshot
+	mock.ExpectQuery(`FROM resource_context WHERE \(created_at > \? OR \(created_at = \? AND resource_type > \?\) OR \(created_at = \? AND resource_type = \? AND resource_id > \?\)\) ORDER BY created_at ASC, resource_type ASC, resource_id ASC LIMIT \?`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "user", sqlmock.AnyArg(), "user", "user-5", 3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("user-6", "user", nil, at(6), at(6), nil).
+			AddRow("user-7", "user", nil, at(7), at(7), nil).
+			AddRow("user-8", "user", nil, at(8), at(8), nil))
+
+	newer, err := repo.GetNewer(*first.SinceToken, 2)
+	require.NoError(t, err)
+	require.Len(t, newer.Records, 2)
+	assert.Equal(t, "user-7", newer.Records[0].ResourceID)
+	assert.Equal(t, "user-6", newer.Records[1].ResourceID)
+	assert.True(t, newer.HasMore)
+
+	next, err := repo.decodeContinuationToken(newer.SinceToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user-7", next.ResourceID)
+
+	// Nothing newer: the since token is handed back unchanged
+	mock.ExpectQuery(`ORDER BY created_at ASC, resource_type ASC, resource_id ASC LIMIT \?`).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	empty, err := repo.GetNewer(newer.SinceToken, 2)
+	require.NoError(t, err)
+	assert.Empty(t, empty.Records)
+	assert.False(t, empty.HasMore)
+	assert.Equal(t, newer.SinceToken, empty.SinceToken)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetNewer_SinceStart(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	columns := []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}
+	at := time.Unix(1234567890, 0)
+	mock.ExpectQuery(`FROM resource_context WHERE \(created_at > \? OR .* ORDER BY created_at ASC, resource_type ASC, resource_id ASC LIMIT \?`).
+		WithArgs(time.Unix(0, 0), time.Unix(0, 0), "", time.Unix(0, 0), "", "", 6).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("user-1", "user", nil, at, at, nil))
+
+	newer, err := repo.GetNewer(repo.SinceStart(), 5)
+	require.NoError(t, err)
+	require.Len(t, newer.Records, 1)
+	assert.Equal(t, "user-1", newer.Records[0].ResourceID)
+	assert.False(t, newer.HasMore)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetNewer_RejectsTokenFromOtherListing(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	token := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-5", CreatedAt: time.Unix(1234567890, 0), Page: 1, Order: "activity"})
+
+	_, err := repo.GetNewer(token, 5)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.EqualError(t, err, "invalid continuation token: since token issued for a different listing")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedSorted_ByResourceTypeAscending(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Unix(1234567890, 0)
+	columns := []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}
+	sort := SortOrder{Column: "resource_type", Ascending: true}
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context ORDER BY resource_type ASC, resource_id ASC LIMIT \?`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("doc-1", "document", nil, now, now, nil).
+			AddRow("user-1", "user", nil, now, now, nil).
+			AddRow("user-2", "user", nil, now, now, nil))
+
+	first, err := repo.GetPaginatedSorted(sort, PaginationFilter{}, "", 2)
+	require.NoError(t, err)
+	require.Len(t, first.Records, 2)
+	require.NotNil(t, first.NextContinuationToken)
+
+	last, err := repo.decodeContinuationToken(*first.NextContinuationToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user", last.ResourceType)
+	assert.Equal(t, "user-1", last.ResourceID)
+	assert.Equal(t, "resource_type.asc", last.Order)
+
+	// The primary key is the whole sort key, so the keyset only compares it
+	mock.ExpectQuery(`FROM resource_context WHERE created_at <= \? AND \(resource_type > \? OR \(resource_type = \? AND resource_id > \?\)\) ORDER BY resource_type ASC, resource_id ASC LIMIT \?`).
+		WithArgs(sqlmock.AnyArg(), "user", "user", "user-1", 3).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("user-2", "user", nil, now, now, nil))
+
+	second, err := repo.GetPaginatedSorted(sort, PaginationFilter{}, *first.NextContinuationToken, 2)
+	require.NoError(t, err)
+	require.Len(t, second.Records, 1)
+	assert.Equal(t, "user-2", second.Records[0].ResourceID)
+	assert.True(t, second.IsLastPage)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedSorted_ByUpdatedAtWithFilter(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	created := time.Unix(1234567000, 0)
+	updated := time.Unix(1234567890, 0)
+	columns := []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}
+	token := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-5", CreatedAt: updated, Page: 1, Order: "updated_at.desc"})
+
+	mock.ExpectQuery(`FROM resource_context WHERE resource_type = \? AND \(updated_at < \? OR \(updated_at = \? AND resource_type < \?\) OR \(updated_at = \? AND resource_type = \? AND resource_id < \?\)\) ORDER BY updated_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs("user", updated, updated, "user", updated, "user", "user-5", 3).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("user-4", "user", nil, created, created, nil))
+
+	result, err := repo.GetPaginatedSorted(SortOrder{Column: "updated_at"}, PaginationFilter{ResourceType: "user"}, token, 2)
+	require.NoError(t, err)
+	require.Len(t, result.Records, 1)
+	assert.Equal(t, 2, result.PageDepth)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedSorted_RejectsTokenFromOtherOrder(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	listingToken := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-1", CreatedAt: time.Unix(1234567890, 0), Page: 1})
+	_, err := repo.GetPaginatedSorted(SortOrder{Column: "resource_id"}, PaginationFilter{}, listingToken, 5)
+	assert.ErrorContains(t, err, "issued for a different listing")
+
+	ascendingToken := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-1", CreatedAt: time.Unix(1234567890, 0), Page: 1, Order: "resource_id.asc"})
+	_, err = repo.GetPaginatedSorted(SortOrder{Column: "resource_id"}, PaginationFilter{}, ascendingToken, 5)
+	assert.ErrorContains(t, err, "issued for a different listing")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedSorted_BySeq(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	// Records stamped with the same created_at, as by a bulk import
+	now := time.Unix(1234567890, 0)
+	columns := []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata", "seq"}
+	sort := SortOrder{Column: "seq"}
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata, seq FROM resource_context ORDER BY seq DESC LIMIT \?$`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("user-9", "user", nil, now, now, nil, 42).
+			AddRow("doc-1", "document", nil, now, now, nil, 41).
+			AddRow("user-1", "user", nil, now, now, nil, 17))
+
+	first, err := repo.GetPaginatedSorted(sort, PaginationFilter{}, "", 2)
+	require.NoError(t, err)
+	require.Len(t, first.Records, 2)
+	require.NotNil(t, first.NextContinuationToken)
+
+	last, err := repo.decodeContinuationToken(*first.NextContinuationToken)
+	require.NoError(t, err)
+	assert.Equal(t, int64(41), last.Seq)
+	assert.Equal(t, "seq.desc", last.Order)
+	assert.True(t, last.Snapshot.IsZero(), "a seq listing needs no snapshot")
+
+	// The keyset is seq alone, with no snapshot predicate on created_at
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata, seq FROM resource_context WHERE \(seq < \?\) ORDER BY seq DESC LIMIT \?$`).
+		WithArgs(41, 3).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("user-1", "user", nil, now, now, nil, 17))
+
+	second, err := repo.GetPaginatedSorted(sort, PaginationFilter{}, *first.NextContinuationToken, 2)
+	require.NoError(t, err)
+	require.Len(t, second.Records, 1)
+	assert.Equal(t, "user-1", second.Records[0].ResourceID)
+	assert.True(t, second.IsLastPage)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedSorted_BySeqWithShards(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+	require.NoError(t, repo.SetTypeTables(map[string]string{"user": "resource_context_user"}))
+
+	_, err := repo.GetPaginatedSorted(SortOrder{Column: "seq"}, PaginationFilter{}, "", 5)
+	assert.ErrorIs(t, err, ErrInvalidSortColumn)
+	assert.ErrorContains(t, err, "a resource_type filter is required")
+
+	// A resource_type filter reads the single table numbering its records
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata, seq FROM resource_context_user WHERE resource_type = \? ORDER BY seq ASC LIMIT \?`).
+		WithArgs("user", 6).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata", "seq"}))
+
+	_, err = repo.GetPaginatedSorted(SortOrder{Column: "seq", Ascending: true}, PaginationFilter{ResourceType: "user"}, "", 5)
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedSorted_ByClaimedAtAcrossNulls(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	claimed := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	columns := []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata", "claimed_at"}
+	row := func(rows *sqlmock.Rows, id string, claimedAt driver.Value) *sqlmock.Rows {
+		return rows.AddRow(id, "job", nil, claimed, claimed, nil, claimedAt)
+	}
+
+	// Unclaimed records are listed last, after job-2, the only claimed one
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata, claimed_at FROM resource_context ORDER BY ISNULL\(claimed_at\) ASC, claimed_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs(2).
+		WillReturnRows(row(row(sqlmock.NewRows(columns), "job-2", claimed), "job-1", nil))
+	first, err := repo.GetPaginatedSorted(SortOrder{Column: "claimed_at"}, PaginationFilter{}, "", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"job/job-2"}, recordKeys(first.Records))
+
+	// After the last claimed record, the unclaimed ones follow
+	mock.ExpectQuery(`WHERE created_at <= \? AND \(\(claimed_at < \? OR \(claimed_at = \? AND resource_type < \?\) OR \(claimed_at = \? AND resource_type = \? AND resource_id < \?\)\) OR claimed_at IS NULL\) ORDER BY ISNULL\(claimed_at\) ASC`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "job", sqlmock.AnyArg(), "job", "job-2", 2).
+		WillReturnRows(row(row(sqlmock.NewRows(columns), "job-1", nil), "job-0", nil))
+	second, err := repo.GetPaginatedSorted(SortOrder{Column: "claimed_at"}, PaginationFilter{}, *first.NextContinuationToken, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"job/job-1"}, recordKeys(second.Records))
+
+	// After an unclaimed record, only the tiebreakers order the remaining NULLs
+	mock.ExpectQuery(`WHERE created_at <= \? AND \(claimed_at IS NULL AND \(resource_type < \? OR \(resource_type = \? AND resource_id < \?\)\)\) ORDER BY`).
+		WithArgs(sqlmock.AnyArg(), "job", "job", "job-1", 2).
+		WillReturnRows(row(sqlmock.NewRows(columns), "job-0", nil))
+	third, err := repo.GetPaginatedSorted(SortOrder{Column: "claimed_at"}, PaginationFilter{}, *second.NextContinuationToken, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"job/job-0"}, recordKeys(third.Records))
+	assert.True(t, third.IsLastPage)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedSorted_ByClaimedAtWithShards(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+	require.NoError(t, repo.SetTypeTables(map[string]string{"job": "resource_context_job"}))
+
+	_, err := repo.GetPaginatedSorted(SortOrder{Column: "claimed_at"}, PaginationFilter{}, "", 5)
+	assert.ErrorIs(t, err, ErrInvalidSortColumn)
+	assert.ErrorContains(t, err, "a resource_type filter is required")
+
+	// A resource_type filter reads the single table holding claimed_at
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata, claimed_at FROM resource_context_job WHERE resource_type = \? ORDER BY ISNULL\(claimed_at\) ASC, claimed_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs("job", 6).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata", "claimed_at"}))
+
+	_, err = repo.GetPaginatedSorted(SortOrder{Column: "claimed_at"}, PaginationFilter{ResourceType: "job"}, "", 5)
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKeysetAfter_NullsFirst(t *testing.T) {
+	// A listing with its NULLs last, scanned in reverse, meets them first
+	order := ordering{expr: claimedColumn, asc: true, nullsFirst: true}
+
+	keyset, args := keysetAfter(order, cursor{ResourceType: "job", ResourceID: "job-1", Null: true})
+	assert.Equal(t, "((claimed_at IS NULL AND (resource_type > ? OR (resource_type = ? AND resource_id > ?))) OR claimed_at IS NOT NULL)", keyset)
+	assert.Equal(t, []any{"job", "job", "job-1"}, args)
+
+	claimed := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	keyset, _ = keysetAfter(order, cursor{ResourceType: "job", ResourceID: "job-1", CreatedAt: claimed})
+	assert.Equal(t, "(claimed_at > ? OR (claimed_at = ? AND resource_type > ?) OR (claimed_at = ? AND resource_type = ? AND resource_id > ?))", keyset)
+	assert.Equal(t, "ISNULL(claimed_at) DESC, claimed_at ASC, resource_type ASC, resource_id ASC", order.orderBy())
+}
+
+func TestGetPaginatedSorted_ContextFirst(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Unix(1234567890, 0)
+	context := `{"action": "login"}`
+	columns := []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}
+	sort := SortOrder{Column: "created_at", ContextFirst: true}
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context ORDER BY ISNULL\(context\) ASC, created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("user-2", "user", &context, now, now, nil).
+			AddRow("user-1", "user", nil, now, now, nil))
+
+	first, err := repo.GetPaginatedSorted(sort, PaginationFilter{}, "", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user/user-2"}, recordKeys(first.Records))
+	require.NotNil(t, first.NextContinuationToken)
+
+	last, err := repo.decodeContinuationToken(*first.NextContinuationToken)
+	require.NoError(t, err)
+	assert.Equal(t, "context_first", last.Order)
+	assert.False(t, last.Null)
+
+	// After a record with a context, the rest of its group and every record without one follow
+	mock.ExpectQuery(`WHERE created_at <= \? AND \(\(context IS NOT NULL AND \(created_at < \? OR \(created_at = \? AND resource_type < \?\) OR \(created_at = \? AND resource_type = \? AND resource_id < \?\)\)\) OR context IS NULL\) ORDER BY ISNULL\(context\) ASC`).
+		WithArgs(sqlmock.AnyArg(), now, now, "user", now, "user", "user-2", 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("user-1", "user", nil, now, now, nil).
+			AddRow("user-0", "user", nil, now, now, nil))
+
+	second, err := repo.GetPaginatedSorted(sort, PaginationFilter{}, *first.NextContinuationToken, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user/user-1"}, recordKeys(second.Records))
+	last, err = repo.decodeContinuationToken(*second.NextContinuationToken)
+	require.NoError(t, err)
+	assert.True(t, last.Null)
+
+	// After a record without a context, only the rest of its group follows
+	mock.ExpectQuery(`WHERE created_at <= \? AND \(context IS NULL AND \(created_at < \? OR \(created_at = \? AND resource_type < \?\) OR \(created_at = \? AND resource_type = \? AND resource_id < \?\)\)\) ORDER BY ISNULL\(context\) ASC`).
+		WithArgs(sqlmock.AnyArg(), now, now, "user", now, "user", "user-1", 2).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("user-0", "user", nil, now, now, nil))
+
+	third, err := repo.GetPaginatedSorted(sort, PaginationFilter{}, *second.NextContinuationToken, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user/user-0"}, recordKeys(third.Records))
+	assert.True(t, third.IsLastPage)
+
+	// Tokens of the plain listing do not resume the context first one, nor the reverse
+	_, err = repo.GetPaginated(*first.NextContinuationToken, 1)
+	assert.ErrorContains(t, err, "issued for a different listing")
+	plainToken := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-1", CreatedAt: now, Page: 1})
+	_, err = repo.GetPaginatedSorted(sort, PaginationFilter{}, plainToken, 1)
+	assert.ErrorContains(t, err, "issued for a different listing")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedSorted_ContextFirstNames(t *testing.T) {
+	tests := []struct {
+		sort    SortOrder
+		name    string
+		orderBy string
+	}{
+		{sort: SortOrder{Column: "created_at", ContextFirst: true}, name: "context_first", orderBy: "ISNULL(context) ASC, created_at DESC, resource_type DESC, resource_id DESC"},
+		{sort: SortOrder{Column: "updated_at", Ascending: true, ContextFirst: true}, name: "updated_at.asc.context_first", orderBy: "ISNULL(context) ASC, updated_at ASC, resource_type ASC, resource_id ASC"},
+		{sort: SortOrder{Column: "seq", ContextFirst: true}, name: "seq.desc.context_first", orderBy: "ISNULL(context) ASC, seq DESC"},
+	}
+
+	for _, tt := range tests {
+		order, err := tt.sort.ordering()
+		require.NoError(t, err)
+		assert.Equal(t, tt.name, order.name)
+		assert.Equal(t, tt.orderBy, order.orderBy())
+	}
+
+	_, err := SortOrder{Column: "claimed_at", ContextFirst: true}.ordering()
+	assert.ErrorIs(t, err, ErrInvalidSortColumn)
+}
+
+func TestKeysetAfter_ContextFirstNullsFirst(t *testing.T) {
+	// A context first listing scanned in reverse meets the records without a context first
+	order := ordering{expr: seqColumn, asc: true, contextFirst: true, nullsFirst: true}
+
+	keyset, args := keysetAfter(order, cursor{Seq: 7, Null: true})
+	assert.Equal(t, "((context IS NULL AND (seq > ?)) OR context IS NOT NULL)", keyset)
+	assert.Equal(t, []any{int64(7)}, args)
+
+	keyset, _ = keysetAfter(order, cursor{Seq: 7})
+	assert.Equal(t, "(context IS NOT NULL AND (seq > ?))", keyset)
+	assert.Equal(t, "ISNULL(context) DESC, seq ASC", order.orderBy())
+}
+
+func TestGetPaginatedSorted_InvalidColumn(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	for _, column := range []string{"context", "metadata", "created_at; DROP TABLE resource_context", ""} {
+		_, err := repo.GetPaginatedSorted(SortOrder{Column: column}, PaginationFilter{}, "", 5)
+		assert.ErrorIs(t, err, ErrInvalidSortColumn, column)
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetWithoutContext(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Unix(1234567890, 0)
+	columns := []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context WHERE context IS NULL ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("user-3", "user", nil, now, now, nil).
+			AddRow("user-1", "user", nil, now, now, nil))
+
+	first, err := repo.GetWithoutContext("", 1)
+	require.NoError(t, err)
+	require.Len(t, first.Records, 1)
+	assert.Nil(t, first.Records[0].Context)
+	require.NotNil(t, first.NextContinuationToken)
+
+	// The null-context filter is kept alongside the keyset on the next page
+	mock.ExpectQuery(`FROM resource_context WHERE context IS NULL AND created_at <= \? AND \(created_at < \? OR \(created_at = \? AND resource_type < \?\) OR \(created_at = \? AND resource_type = \? AND resource_id < \?\)\) ORDER BY`).
+		WithArgs(sqlmock.AnyArg(), now, now, "user", now, "user", "user-3", 2).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("user-1", "user", nil, now, now, nil))
+
+	second, err := repo.GetWithoutContext(*first.NextContinuationToken, 1)
+	require.NoError(t, err)
+	require.Len(t, second.Records, 1)
+	assert.Equal(t, "user-1", second.Records[0].ResourceID)
+	assert.True(t, second.IsLastPage)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedFiltered_CombinedSearchFilters(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Unix(1705312800, 0)
+	after := time.Date(2024, 1, 15, 11, 0, 0, 0, time.FixedZone("CET", 3600))
+	columns := []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}
+	filter := PaginationFilter{ResourceType: "user", IDPrefix: "user_1%", CreatedAfter: after}
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context WHERE resource_type = \? AND resource_id LIKE \? AND created_at > \? ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs("user", `user\_1\%%`, after.UTC(), 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("user_1%b", "user", nil, now, now, nil).
+			AddRow("user_1%a", "user", nil, now, now, nil))
+
+	first, err := repo.GetPaginatedFiltered(filter, "", 1)
+	require.NoError(t, err)
+	require.Len(t, first.Records, 1)
+	require.NotNil(t, first.NextContinuationToken)
+
+	// The filters are combined with the keyset predicate on the next page
+	mock.ExpectQuery(`FROM resource_context WHERE resource_type = \? AND resource_id LIKE \? AND created_at > \? AND created_at <= \? AND \(created_at < \? OR .*\) ORDER BY`).
+		WithArgs("user", `user\_1\%%`, after.UTC(), sqlmock.AnyArg(), now, now, "user", now, "user", "user_1%b", 2).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("user_1%a", "user", nil, now, now, nil))
+
+	second, err := repo.GetPaginatedFiltered(filter, *first.NextContinuationToken, 1)
+	require.NoError(t, err)
+	require.Len(t, second.Records, 1)
+	assert.True(t, second.IsLastPage)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedFiltered_UpdatedBounds(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`FROM resource_context WHERE updated_at > \? AND updated_at < \? ORDER BY`).
+		WithArgs(from, to, 6).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}))
+
+	_, err := repo.GetPaginatedFiltered(PaginationFilter{UpdatedAfter: from, UpdatedBefore: to}, "", 5)
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetByKeys_OrderMissingAndDuplicates(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	keys := []RecordKey{
+		{ResourceType: "user", ResourceID: "u2"},
+		{ResourceType: "user", ResourceID: "u1"},
+		{ResourceType: "user", ResourceID: "u2"}, // duplicate
+		{ResourceType: "document", ResourceID: "d9"},
+	}
+
+	// The database returns rows in its own order
+	rows := sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+		AddRow("u1", "user", nil, now, now, nil).
+		AddRow("u2", "user", nil, now, now, nil)
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context WHERE \(resource_type, resource_id\) IN \(\(\?, \?\), \(\?, \?\), \(\?, \?\)\)`).
+		WithArgs("user", "u2", "user", "u1", "document", "d9").
+		WillReturnRows(rows)
+
+	records, missing, err := repo.GetByKeys(keys)
+	assert.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "u2", records[0].ResourceID)
+	assert.Equal(t, "u1", records[1].ResourceID)
+	assert.Equal(t, []RecordKey{{ResourceType: "document", ResourceID: "d9"}}, missing)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetByKeys_Empty(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	records, missing, err := repo.GetByKeys(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+	assert.Empty(t, missing)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetByKeys_Error(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context WHERE`).
+		WillReturnError(assert.AnError)
+
+	records, missing, err := repo.GetByKeys([]RecordKey{{ResourceType: "user", ResourceID: "u1"}})
+	assert.Error(t, err)
+	assert.Nil(t, records)
+	assert.Nil(t, missing)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExistingKeys(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	keys := []RecordKey{
+		{ResourceType: "user", ResourceID: "u2"},
+		{ResourceType: "user", ResourceID: "u1"},
+		{ResourceType: "user", ResourceID: "u2"}, // duplicate
+		{ResourceType: "user", ResourceID: "u3"},
+	}
+
+	mock.ExpectQuery(`SELECT resource_type, resource_id FROM resource_context WHERE \(resource_type, resource_id\) IN \(\(\?, \?\), \(\?, \?\), \(\?, \?\), \(\?, \?\)\)`).
+		WithArgs("user", "u2", "user", "u1", "user", "u2", "user", "u3").
+		WillReturnRows(sqlmock.NewRows([]string{"resource_type", "resource_id"}).AddRow("user", "u1").AddRow("user", "u2"))
+
+	existing, err := repo.ExistingKeys(keys)
+	require.NoError(t, err)
+	assert.Equal(t, []RecordKey{{ResourceType: "user", ResourceID: "u2"}, {ResourceType: "user", ResourceID: "u1"}}, existing)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExistingKeys_Empty(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	existing, err := repo.ExistingKeys(nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, existing)
+	assert.Empty(t, existing)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExistingKeys_Error(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT resource_type, resource_id FROM resource_context WHERE`).WillReturnError(assert.AnError)
+
+	existing, err := repo.ExistingKeys([]RecordKey{{ResourceType: "user", ResourceID: "u1"}})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Nil(t, existing)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExplainPaginated_MatchesExecutedQuery(t *testing.T) {
+	now := time.Unix(1234567890, 0).UTC()
+	probe := NewRecordRepository(nil)
+	tokens := map[string]string{
+		"tokenless": "",
+		"tokened":   probe.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-5", CreatedAt: now, Page: 1, Order: byCreated.name, Snapshot: now}),
+		"backward":  probe.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-5", CreatedAt: now, Page: 1, Order: byCreated.name, Backward: true}),
+	}
+
+	for name, token := range tokens {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			require.NoError(t, err)
+			defer db.Close()
+			repo := NewRecordRepository(db)
+
+			explained, err := repo.ExplainPaginated(token, 5)
+			require.NoError(t, err)
+
+			args := make([]driver.Value, len(explained.Args))
+			for i, arg := range explained.Args {
+				args[i] = arg
+			}
+			mock.ExpectQuery(explained.SQL).
+				WithArgs(args...).
+				WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}))
+
+			_, err = repo.GetPaginated(token, 5)
+			require.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestExplainPaginated_Tokenless(t *testing.T) {
+	repo := NewRecordRepository(nil)
+
+	explained, err := repo.ExplainPaginated("", 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT ?", explained.SQL)
+	assert.Equal(t, []any{DefaultPageSize + 1}, explained.Args)
+}
+
+func TestExplainPaginated_InvalidToken(t *testing.T) {
+	repo := NewRecordRepository(nil)
+
+	_, err := repo.ExplainPaginated("not-a-token", 5)
+	assert.Error(t, err)
+
+	_, err = repo.ExplainPaginated(repo.encodeContinuationToken(cursor{Order: byActivity.name, Page: 1}), 5)
+	assert.ErrorContains(t, err, "issued for a different listing")
+}
+
+func TestExplain(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	query := &ExplainedQuery{SQL: "SELECT resource_id FROM resource_context WHERE created_at < ? LIMIT ?", Args: []any{time.Unix(1234567890, 0), 6}}
+	mock.ExpectQuery(`EXPLAIN SELECT resource_id FROM resource_context WHERE created_at < \? LIMIT \?`).
+		WithArgs(time.Unix(1234567890, 0), 6).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "select_type", "table", "type", "possible_keys", "key", "rows", "Extra"}).
+			AddRow("1", "SIMPLE", "resource_context", "range", "idx_created", "idx_created", "6", nil))
+
+	plan, err := repo.Explain(query)
+
+	require.NoError(t, err)
+	assert.Equal(t, []PlanRow{{
+		"id": "1", "select_type": "SIMPLE", "table": "resource_context", "type": "range",
+		"possible_keys": "idx_created", "key": "idx_created", "rows": "6",
+	}}, plan)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExplain_Error(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`EXPLAIN SELECT`).WillReturnError(fmt.Errorf("connection refused"))
+
+	_, err := repo.Explain(&ExplainedQuery{SQL: "SELECT 1"})
+	assert.ErrorContains(t, err, "connection refused")
+}
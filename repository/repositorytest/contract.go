@@ -0,0 +1,258 @@
+// Package repositorytest checks that an implementation of
+// handler.RecordRepositoryInterface behaves like the SQL repository on the edge
+// cases the handlers depend on, so that implementations cannot quietly diverge.
+package repositorytest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tokenpagination/handler"
+	"tokenpagination/repository"
+)
+
+// contractRecords is the number of records the pagination checks store. It is
+// prime, so that no page size but 1 and itself divides it, and the pagination
+// checks add page sizes dividing the records they store on purpose.
+const contractRecords = 23
+
+// RunContract runs the behavioral contract of a record repository as subtests of
+// t. newRepo must return a repository over an empty store each time it is called;
+// it may use its t to skip or fail the subtest and to register cleanups.
+//
+// The contract covers insert and read round trips, duplicate keys, pagination of
+// an empty store and of stores holding an exact multiple of the page size, walking
+// every page in the listing order without skipping or repeating a record, reusing
+// a token, and the errors returned for duplicates, missing records and invalid
+// tokens.
+func RunContract(t *testing.T, newRepo func(t *testing.T) handler.RecordRepositoryInterface) {
+	t.Run("insert and get round trip", func(t *testing.T) {
+		repo := newRepo(t)
+
+		context := `{"name":"Alice"}`
+		require.NoError(t, repo.InsertWithMetadata("user-1", "user", &context, map[string]string{"source": "import"}))
+		require.NoError(t, repo.Insert("user-2", "user", nil))
+
+		record, err := repo.GetByID("user-1", "user")
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", record.ResourceID)
+		assert.Equal(t, "user", record.ResourceType)
+		require.NotNil(t, record.Context)
+		assert.Equal(t, context, *record.Context)
+		assert.Equal(t, map[string]string{"source": "import"}, record.Metadata)
+		assert.False(t, record.CreatedAt.IsZero(), "created_at is set")
+		assert.False(t, record.UpdatedAt.IsZero(), "updated_at is set")
+
+		record, err = repo.GetByID("user-2", "user")
+		require.NoError(t, err)
+		assert.Nil(t, record.Context, "a nil context stays nil")
+		assert.Empty(t, record.Metadata)
+
+		_, err = repo.GetByID("user-1", "task")
+		assert.ErrorIs(t, err, repository.ErrNotFound, "the key is the resource_id and resource_type together")
+	})
+
+	t.Run("duplicate keys", func(t *testing.T) {
+		repo := newRepo(t)
+
+		first, second := `{"v":1}`, `{"v":2}`
+		require.NoError(t, repo.Insert("user-1", "user", &first))
+		assert.ErrorIs(t, repo.Insert("user-1", "user", &second), repository.ErrDuplicate)
+		require.NoError(t, repo.Insert("user-1", "admin", &second), "the same resource_id under another type is a different record")
+
+		record, err := repo.GetByID("user-1", "user")
+		require.NoError(t, err)
+		assert.Equal(t, first, *record.Context, "the stored record is kept")
+
+		count, err := repo.Count()
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		repo := newRepo(t)
+
+		require.NoError(t, repo.Insert("user-1", "user", nil))
+		require.NoError(t, repo.Delete("user-1", "user"))
+
+		_, err := repo.GetByID("user-1", "user")
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		assert.ErrorIs(t, repo.Delete("user-1", "user"), repository.ErrNotFound)
+	})
+
+	t.Run("empty store", func(t *testing.T) {
+		repo := newRepo(t)
+
+		result, err := repo.GetPaginated("", 10)
+		require.NoError(t, err)
+		assert.Empty(t, result.Records)
+		assert.Nil(t, result.NextContinuationToken, "an empty store has no next page")
+		assert.True(t, result.IsLastPage)
+
+		all, truncated, err := repo.GetAll()
+		require.NoError(t, err)
+		assert.Empty(t, all)
+		assert.False(t, truncated)
+	})
+
+	t.Run("exact multiple of the page size", func(t *testing.T) {
+		repo := newRepo(t)
+		insertRecords(t, repo, 10)
+
+		result, err := repo.GetPaginated("", 10)
+		require.NoError(t, err)
+		assert.Len(t, result.Records, 10)
+		assert.Nil(t, result.NextContinuationToken, "a full page holding every record is the last")
+		assert.True(t, result.IsLastPage)
+
+		result, err = repo.GetPaginated("", 5)
+		require.NoError(t, err)
+		require.NotNil(t, result.NextContinuationToken)
+		assert.False(t, result.IsLastPage)
+
+		result, err = repo.GetPaginated(*result.NextContinuationToken, 5)
+		require.NoError(t, err)
+		assert.Len(t, result.Records, 5)
+		assert.Nil(t, result.NextContinuationToken, "no empty page follows the last full one")
+		assert.True(t, result.IsLastPage)
+	})
+
+	t.Run("pagination walk", func(t *testing.T) {
+		repo := newRepo(t)
+		insertRecords(t, repo, contractRecords)
+
+		all, _, err := repo.GetAll()
+		require.NoError(t, err)
+		require.Len(t, all, contractRecords)
+		requireListingOrder(t, all)
+
+		for _, pageSize := range []int{1, 4, contractRecords, contractRecords + 1} {
+			t.Run(fmt.Sprintf("page size %d", pageSize), func(t *testing.T) {
+				walked := walk(t, func(token string) (*repository.PaginatedResult, error) {
+					return repo.GetPaginated(token, pageSize)
+				}, pageSize)
+				assert.Equal(t, all, walked, "the pages concatenate to the full listing")
+			})
+		}
+	})
+
+	t.Run("pagination walk by type", func(t *testing.T) {
+		repo := newRepo(t)
+		insertRecords(t, repo, contractRecords)
+
+		walked := walk(t, func(token string) (*repository.PaginatedResult, error) {
+			return repo.GetPaginatedByType("task", token, 3)
+		}, 3)
+		assert.NotEmpty(t, walked)
+		for _, record := range walked {
+			assert.Equal(t, "task", record.ResourceType)
+		}
+		requireListingOrder(t, walked)
+	})
+
+	t.Run("token reuse", func(t *testing.T) {
+		repo := newRepo(t)
+		insertRecords(t, repo, contractRecords)
+
+		first, err := repo.GetPaginated("", 5)
+		require.NoError(t, err)
+		require.NotNil(t, first.NextContinuationToken)
+		token := *first.NextContinuationToken
+
+		second, err := repo.GetPaginated(token, 5)
+		require.NoError(t, err)
+		require.NotNil(t, second.NextContinuationToken)
+		_, err = repo.GetPaginated(*second.NextContinuationToken, 5)
+		require.NoError(t, err)
+
+		again, err := repo.GetPaginated(token, 5)
+		require.NoError(t, err)
+		assert.Equal(t, second.Records, again.Records, "a token leads to the same page every time it is used")
+
+		// A record inserted before the cursor's position does not shift the page
+		require.NoError(t, repo.Insert("zzz-late", "user", nil))
+		again, err = repo.GetPaginated(token, 5)
+		require.NoError(t, err)
+		assert.Equal(t, second.Records, again.Records)
+	})
+
+	t.Run("invalid tokens", func(t *testing.T) {
+		repo := newRepo(t)
+		insertRecords(t, repo, 3)
+
+		for _, token := range []string{"not base64!", "Z2FyYmFnZQ==", "e30="} {
+			_, err := repo.GetPaginated(token, 10)
+			assert.ErrorIs(t, err, repository.ErrInvalidToken, token)
+		}
+		_, err := repo.GetPaginated(strings.Repeat("A", repository.DefaultMaxTokenLength+4), 10)
+		assert.ErrorIs(t, err, repository.ErrTokenTooLong)
+	})
+}
+
+// insertRecords inserts n records of two resource types, numbered so that their
+// resource_ids sort in insertion order. Records inserted within the same second
+// share created_at, so the tiebreakers decide most of their order.
+func insertRecords(t *testing.T, repo handler.RecordRepositoryInterface, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		resourceType := []string{"user", "task"}[i%2]
+		require.NoError(t, repo.Insert(fmt.Sprintf("res-%03d", i), resourceType, nil))
+	}
+}
+
+// walk follows the continuation tokens of fetch from the first page to the last
+// and returns the records of every page, checking that only the last page is
+// short and that no record is listed twice.
+func walk(t *testing.T, fetch func(token string) (*repository.PaginatedResult, error), pageSize int) []repository.Record {
+	t.Helper()
+
+	var walked []repository.Record
+	token := ""
+	for pages := 1; ; pages++ {
+		result, err := fetch(token)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(result.Records), pageSize)
+		walked = append(walked, result.Records...)
+
+		if result.NextContinuationToken == nil {
+			assert.True(t, result.IsLastPage)
+			break
+		}
+		require.Len(t, result.Records, pageSize, "only the last page may be short")
+		require.LessOrEqual(t, pages, contractRecords, "the walk does not end")
+		token = *result.NextContinuationToken
+	}
+
+	requireListingOrder(t, walked)
+	return walked
+}
+
+// requireListingOrder checks records are ordered by created_at, resource_type
+// and resource_id, all descending, with no key listed twice.
+func requireListingOrder(t *testing.T, records []repository.Record) {
+	t.Helper()
+
+	seen := make(map[repository.RecordKey]bool, len(records))
+	for i, record := range records {
+		key := repository.RecordKey{ResourceID: record.ResourceID, ResourceType: record.ResourceType}
+		require.False(t, seen[key], "%s/%s listed twice", record.ResourceType, record.ResourceID)
+		seen[key] = true
+		if i == 0 {
+			continue
+		}
+
+		prev := records[i-1]
+		switch {
+		case !prev.CreatedAt.Equal(record.CreatedAt):
+			require.True(t, prev.CreatedAt.After(record.CreatedAt), "%s listed before older %s", record.ResourceID, prev.ResourceID)
+		case prev.ResourceType != record.ResourceType:
+			require.Greater(t, prev.ResourceType, record.ResourceType, "%s out of order after %s", record.ResourceID, prev.ResourceID)
+		default:
+			require.Greater(t, prev.ResourceID, record.ResourceID, "%s out of order after %s", record.ResourceID, prev.ResourceID)
+		}
+	}
+}
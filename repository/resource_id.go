@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// GenerateResourceID returns a random (version 4) UUID suitable for use as a
+// resource_id when the client has no natural identifier. The UUID is built from
+// crypto/rand output with the version and variant bits set per RFC 4122.
+func GenerateResourceID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate resource id: %v", err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var uuidV4Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestGenerateResourceID(t *testing.T) {
+	id, err := GenerateResourceID()
+	require.NoError(t, err)
+	assert.Regexp(t, uuidV4Pattern, id)
+}
+
+func TestGenerateResourceID_Unique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := GenerateResourceID()
+		require.NoError(t, err)
+		assert.False(t, seen[id], "duplicate id generated: %s", id)
+		seen[id] = true
+	}
+}
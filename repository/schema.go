@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SchemaVersion identifies the layout of the record tables described by
+// schemaColumns. It is recorded in backups and must be incremented whenever a
+// column is added or changed.
+const SchemaVersion = 3
+
+// schemaColumn is a column of a record table. addDefinition is used to add the
+// column to a table created before the column existed; it is empty for the key
+// columns, which cannot be added after the fact. types are the column types
+// information_schema reports for definition, the first being MySQL's; MariaDB
+// stores json as longtext. addIndex names an index of schemaIndexes that is added
+// in the same statement as the column: one MySQL requires for an auto_increment
+// column, or one covering a column that did not exist before.
+type schemaColumn struct {
+	name          string
+	definition    string
+	addDefinition string
+	addIndex      string
+	types         []string
+	nullable      bool
+}
+
+// schemaColumns are the columns of every record table, in table order.
+var schemaColumns = []schemaColumn{
+	{name: "resource_id", definition: "varchar(128) not null", types: []string{"varchar(128)"}},
+	{name: "resource_type", definition: "varchar(128) not null", types: []string{"varchar(128)"}},
+	{name: "context", definition: "longtext default null", addDefinition: "longtext default null", types: []string{"longtext"}, nullable: true},
+	{name: "created_at", definition: "timestamp not null", addDefinition: "timestamp not null default current_timestamp", types: []string{"timestamp"}},
+	{name: "updated_at", definition: "timestamp not null", addDefinition: "timestamp not null default current_timestamp", types: []string{"timestamp"}},
+	{name: "metadata", definition: "json default null", addDefinition: "json default null", types: []string{"json", "longtext"}, nullable: true},
+	{name: "seq", definition: "bigint not null auto_increment", addDefinition: "bigint not null auto_increment", addIndex: "idx_seq", types: []string{"bigint", "bigint(20)"}},
+	{name: "claimed_at", definition: "timestamp null default null", addDefinition: "timestamp null default null", addIndex: "idx_claim", types: []string{"timestamp"}, nullable: true},
+}
+
+// schemaIndex is an index of a record table; the primary key is named PRIMARY, as
+// in information_schema.
+type schemaIndex struct {
+	name    string
+	columns []string
+	unique  bool
+}
+
+// definition returns the index's definition in CREATE TABLE and ALTER TABLE.
+func (i schemaIndex) definition() string {
+	key := "KEY " + i.name
+	switch {
+	case i.name == "PRIMARY":
+		key = "PRIMARY KEY"
+	case i.unique:
+		key = "UNIQUE KEY " + i.name
+	}
+	return key + " (" + strings.Join(i.columns, ", ") + ")"
+}
+
+// schemaIndexes are the indexes of every record table. The pagination queries
+// rely on them to seek instead of scanning.
+var schemaIndexes = []schemaIndex{
+	{name: "PRIMARY", columns: []string{"resource_type", "resource_id"}},
+	{name: "idx_created_at", columns: []string{"created_at", "resource_type", "resource_id"}},
+	{name: "idx_updated_at", columns: []string{"updated_at", "resource_type", "resource_id"}},
+	{name: "idx_resource_id", columns: []string{"resource_id", "resource_type"}},
+	{name: "idx_seq", columns: []string{"seq"}, unique: true},
+	{name: "idx_claim", columns: []string{"resource_type", "claimed_at", "created_at", "resource_id"}},
+}
+
+// createTableStatement returns the CREATE TABLE IF NOT EXISTS statement for a
+// record table.
+func createTableStatement(table string) string {
+	var definitions []string
+	for _, column := range schemaColumns {
+		definitions = append(definitions, column.name+" "+column.definition)
+	}
+	for _, index := range schemaIndexes {
+		definitions = append(definitions, index.definition())
+	}
+
+	return `
+	CREATE TABLE IF NOT EXISTS ` + table + ` (
+		` + strings.Join(definitions, ",\n\t\t") + `
+	)`
+}
+
+// upgradeTable adds the columns missing from a table created by an older version,
+// as reported by information_schema, placing each after its predecessor, then the
+// indexes it still lacks, in a single ALTER TABLE so the table is rebuilt once.
+// Tables that are already current are left untouched.
+func (r *RecordRepository) upgradeTable(table string) error {
+	existing, err := r.tableColumns(table)
+	if err != nil {
+		return err
+	}
+	indexes, err := r.describeIndexes(table)
+	if err != nil {
+		return err
+	}
+
+	for i, column := range schemaColumns {
+		if existing[column.name] {
+			continue
+		}
+		if column.addDefinition == "" {
+			return fmt.Errorf("table %s has no %s column and cannot be upgraded", table, column.name)
+		}
+
+		statement := "ALTER TABLE " + table + " ADD COLUMN " + column.name + " " + column.addDefinition
+		if i > 0 {
+			statement += " AFTER " + schemaColumns[i-1].name
+		}
+		if column.addIndex != "" {
+			index := slices.IndexFunc(schemaIndexes, func(index schemaIndex) bool { return index.name == column.addIndex })
+			statement += ", ADD " + schemaIndexes[index].definition()
+			indexes[column.addIndex] = schemaIndexes[index].columns
+		}
+		if _, err := r.db.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	var missing []string
+	for _, index := range schemaIndexes {
+		if _, ok := indexes[index.name]; !ok {
+			missing = append(missing, "ADD "+index.definition())
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	_, err = r.db.Exec("ALTER TABLE " + table + " " + strings.Join(missing, ", "))
+	return err
+}
+
+// tableColumns returns the names of the columns of table in the current database.
+func (r *RecordRepository) tableColumns(table string) (map[string]bool, error) {
+	rows, err := r.db.Query("SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ?", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(name)] = true
+	}
+
+	return columns, rows.Err()
+}
+
+// SchemaError lists the differences between the tables in the database and the
+// schema the repository expects.
+type SchemaError struct {
+	Discrepancies []string
+}
+
+func (e *SchemaError) Error() string {
+	return "schema does not match, run the migrate command:\n  - " + strings.Join(e.Discrepancies, "\n  - ")
+}
+
+// tableColumn is a column of a table as reported by information_schema.
+type tableColumn struct {
+	columnType string
+	nullable   bool
+}
+
+// schemaDiscrepancies compares table's columns and indexes with schemaColumns and
+// schemaIndexes. Extra columns and indexes are not discrepancies.
+func (r *RecordRepository) schemaDiscrepancies(table string) ([]string, error) {
+	columns, err := r.describeColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return []string{fmt.Sprintf("table %s does not exist", table)}, nil
+	}
+
+	indexes, err := r.describeIndexes(table)
+	if err != nil {
+		return nil, err
+	}
+
+	var discrepancies []string
+	for _, expected := range schemaColumns {
+		column, ok := columns[expected.name]
+		switch {
+		case !ok:
+			discrepancies = append(discrepancies, fmt.Sprintf("table %s: column %s is missing", table, expected.name))
+			continue
+		case !slices.Contains(expected.types, column.columnType):
+			discrepancies = append(discrepancies, fmt.Sprintf("table %s: column %s has type %s, expected %s", table, expected.name, column.columnType, expected.types[0]))
+		}
+		if column.nullable != expected.nullable {
+			discrepancies = append(discrepancies, fmt.Sprintf("table %s: column %s is %s, expected %s", table, expected.name, nullability(column.nullable), nullability(expected.nullable)))
+		}
+	}
+
+	for _, expected := range schemaIndexes {
+		columns, ok := indexes[expected.name]
+		switch {
+		case !ok:
+			discrepancies = append(discrepancies, fmt.Sprintf("table %s: index %s is missing", table, expected.name))
+		case !slices.Equal(columns, expected.columns):
+			discrepancies = append(discrepancies, fmt.Sprintf("table %s: index %s covers (%s), expected (%s)", table, expected.name, strings.Join(columns, ", "), strings.Join(expected.columns, ", ")))
+		}
+	}
+
+	return discrepancies, nil
+}
+
+// nullability describes whether a column accepts NULL.
+func nullability(nullable bool) string {
+	if nullable {
+		return "nullable"
+	}
+	return "NOT NULL"
+}
+
+// describeColumns returns the columns of table in the current database by
+// lowercased name, or none when the table does not exist.
+func (r *RecordRepository) describeColumns(table string) (map[string]tableColumn, error) {
+	rows, err := r.db.Query("SELECT column_name, column_type, is_nullable FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ?", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]tableColumn{}
+	for rows.Next() {
+		var name, columnType, nullable string
+		if err := rows.Scan(&name, &columnType, &nullable); err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(name)] = tableColumn{columnType: strings.ToLower(columnType), nullable: nullable == "YES"}
+	}
+
+	return columns, rows.Err()
+}
+
+// describeIndexes returns the columns of every index of table in the current
+// database, in index order, by index name.
+func (r *RecordRepository) describeIndexes(table string) (map[string][]string, error) {
+	rows, err := r.db.Query("SELECT index_name, column_name FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? ORDER BY index_name, seq_in_index", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := map[string][]string{}
+	for rows.Next() {
+		var name, column string
+		if err := rows.Scan(&name, &column); err != nil {
+			return nil, err
+		}
+		indexes[name] = append(indexes[name], strings.ToLower(column))
+	}
+
+	return indexes, rows.Err()
+}
@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordColumnNames are the columns read into a record, recordColumns.
+var recordColumnNames = []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}
+
+// tableColumnNames are the columns of a current record table.
+var tableColumnNames = append(slices.Clone(recordColumnNames), "seq", "claimed_at")
+
+// expectTableColumns expects the information_schema lookup of table's columns and
+// answers it with columns.
+func expectTableColumns(mock sqlmock.Sqlmock, table string, columns ...string) {
+	rows := sqlmock.NewRows([]string{"column_name"})
+	for _, column := range columns {
+		rows.AddRow(column)
+	}
+	mock.ExpectQuery(`SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE\(\) AND table_name = \?`).
+		WithArgs(table).
+		WillReturnRows(rows)
+}
+
+// expectTableIndexes expects the information_schema lookup of table's indexes and
+// answers it with indexes.
+func expectTableIndexes(mock sqlmock.Sqlmock, table string, indexes []describedIndex) {
+	rows := sqlmock.NewRows([]string{"index_name", "column_name"})
+	for _, index := range indexes {
+		for _, column := range index.columns {
+			rows.AddRow(index.name, column)
+		}
+	}
+	mock.ExpectQuery(`SELECT index_name, column_name FROM information_schema.statistics WHERE table_schema = DATABASE\(\) AND table_name = \? ORDER BY index_name, seq_in_index`).
+		WithArgs(table).
+		WillReturnRows(rows)
+}
+
+func TestCreateTable_AlreadyCurrent(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS resource_context`).WillReturnResult(sqlmock.NewResult(0, 0))
+	// Column names are compared case-insensitively, as MySQL reports them
+	expectTableColumns(mock, "resource_context", "RESOURCE_ID", "RESOURCE_TYPE", "CONTEXT", "CREATED_AT", "UPDATED_AT", "METADATA", "SEQ", "CLAIMED_AT")
+	expectTableIndexes(mock, "resource_context", currentIndexes())
+
+	err := repo.CreateTable()
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateTable_AddsMissingColumns(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS resource_context`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectTableColumns(mock, "resource_context", "resource_id", "resource_type", "context", "created_at")
+	expectTableIndexes(mock, "resource_context", currentIndexes()[:4])
+	mock.ExpectExec(`ALTER TABLE resource_context ADD COLUMN updated_at timestamp not null default current_timestamp AFTER created_at`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE resource_context ADD COLUMN metadata json default null AFTER updated_at`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE resource_context ADD COLUMN seq bigint not null auto_increment AFTER metadata, ADD UNIQUE KEY idx_seq \(seq\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE resource_context ADD COLUMN claimed_at timestamp null default null AFTER seq, ADD KEY idx_claim \(resource_type, claimed_at, created_at, resource_id\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repo.CreateTable()
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateTable_AddsMissingIndexes(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	// A table created before the secondary indexes existed has only its primary key
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS resource_context`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectTableColumns(mock, "resource_context", "resource_id", "resource_type", "context", "created_at", "updated_at", "metadata")
+	expectTableIndexes(mock, "resource_context", currentIndexes()[:1])
+	mock.ExpectExec(`ALTER TABLE resource_context ADD COLUMN seq bigint not null auto_increment AFTER metadata, ADD UNIQUE KEY idx_seq \(seq\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE resource_context ADD COLUMN claimed_at timestamp null default null AFTER seq, ADD KEY idx_claim \(resource_type, claimed_at, created_at, resource_id\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^ALTER TABLE resource_context ADD KEY idx_created_at \(created_at, resource_type, resource_id\), ADD KEY idx_updated_at \(updated_at, resource_type, resource_id\), ADD KEY idx_resource_id \(resource_id, resource_type\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, repo.CreateTable())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// The upgraded table then passes the schema check
+	expectDescribeTable(mock, "resource_context", currentColumns(), currentIndexes())
+	assert.NoError(t, repo.VerifySchema())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateTable_MissingKeyColumn(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS resource_context`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectTableColumns(mock, "resource_context", "id", "context", "created_at", "updated_at", "metadata", "seq")
+	expectTableIndexes(mock, "resource_context", nil)
+
+	err := repo.CreateTable()
+	assert.EqualError(t, err, "failed to upgrade table resource_context: table resource_context has no resource_id column and cannot be upgraded")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateTable_AlterError(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS resource_context`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectTableColumns(mock, "resource_context", "resource_id", "resource_type", "context", "created_at", "updated_at")
+	expectTableIndexes(mock, "resource_context", currentIndexes()[:4])
+	mock.ExpectExec(`ALTER TABLE resource_context ADD COLUMN metadata`).WillReturnError(assert.AnError)
+
+	err := repo.CreateTable()
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// describedColumn is a row of information_schema.columns.
+type describedColumn struct {
+	name, columnType, nullable string
+}
+
+// describedIndex is an index as read from information_schema.statistics.
+type describedIndex struct {
+	name    string
+	columns []string
+}
+
+// currentColumns describes the columns of a table created by CreateTable, as
+// MySQL reports them.
+func currentColumns() []describedColumn {
+	return []describedColumn{
+		{"resource_id", "varchar(128)", "NO"},
+		{"resource_type", "varchar(128)", "NO"},
+		{"context", "longtext", "YES"},
+		{"created_at", "timestamp", "NO"},
+		{"updated_at", "timestamp", "NO"},
+		{"metadata", "json", "YES"},
+		{"seq", "bigint", "NO"},
+		{"claimed_at", "timestamp", "YES"},
+	}
+}
+
+// currentIndexes describes the indexes of a table created by CreateTable.
+func currentIndexes() []describedIndex {
+	return []describedIndex{
+		{"PRIMARY", []string{"resource_type", "resource_id"}},
+		{"idx_created_at", []string{"created_at", "resource_type", "resource_id"}},
+		{"idx_resource_id", []string{"resource_id", "resource_type"}},
+		{"idx_updated_at", []string{"updated_at", "resource_type", "resource_id"}},
+		{"idx_seq", []string{"seq"}},
+		{"idx_claim", []string{"resource_type", "claimed_at", "created_at", "resource_id"}},
+	}
+}
+
+// expectDescribeTable expects the information_schema lookups of VerifySchema for
+// table and answers them with columns and indexes. A table without columns does
+// not exist, and its indexes are not looked up.
+func expectDescribeTable(mock sqlmock.Sqlmock, table string, columns []describedColumn, indexes []describedIndex) {
+	columnRows := sqlmock.NewRows([]string{"column_name", "column_type", "is_nullable"})
+	for _, column := range columns {
+		columnRows.AddRow(column.name, column.columnType, column.nullable)
+	}
+	mock.ExpectQuery(`SELECT column_name, column_type, is_nullable FROM information_schema.columns WHERE table_schema = DATABASE\(\) AND table_name = \?`).
+		WithArgs(table).
+		WillReturnRows(columnRows)
+	if len(columns) == 0 {
+		return
+	}
+
+	indexRows := sqlmock.NewRows([]string{"index_name", "column_name"})
+	for _, index := range indexes {
+		for _, column := range index.columns {
+			indexRows.AddRow(index.name, column)
+		}
+	}
+	mock.ExpectQuery(`SELECT index_name, column_name FROM information_schema.statistics WHERE table_schema = DATABASE\(\) AND table_name = \? ORDER BY index_name, seq_in_index`).
+		WithArgs(table).
+		WillReturnRows(indexRows)
+}
+
+func TestVerifySchema_Drift(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	// A table altered by hand: context shrunk to text, updated_at made nullable,
+	// metadata dropped, an index lost and another rebuilt over the wrong columns.
+	// Extra columns and indexes are allowed.
+	columns := []describedColumn{
+		{"RESOURCE_ID", "VARCHAR(128)", "NO"},
+		{"resource_type", "varchar(128)", "NO"},
+		{"context", "text", "YES"},
+		{"created_at", "timestamp", "NO"},
+		{"updated_at", "timestamp", "YES"},
+		{"seq", "bigint(20)", "NO"},
+		{"claimed_at", "timestamp", "YES"},
+		{"notes", "varchar(255)", "YES"},
+	}
+	indexes := []describedIndex{
+		{"PRIMARY", []string{"resource_type", "resource_id"}},
+		{"idx_created_at", []string{"created_at"}},
+		{"idx_resource_id", []string{"resource_id", "resource_type"}},
+		{"idx_seq", []string{"seq"}},
+		{"idx_claim", []string{"resource_type", "claimed_at", "created_at", "resource_id"}},
+		{"idx_notes", []string{"notes"}},
+	}
+	expectDescribeTable(mock, "resource_context", columns, indexes)
+
+	err := repo.VerifySchema()
+	var schemaErr *SchemaError
+	require.ErrorAs(t, err, &schemaErr)
+	assert.Equal(t, []string{
+		"table resource_context: column context has type text, expected longtext",
+		"table resource_context: column updated_at is nullable, expected NOT NULL",
+		"table resource_context: column metadata is missing",
+		"table resource_context: index idx_created_at covers (created_at), expected (created_at, resource_type, resource_id)",
+		"table resource_context: index idx_updated_at is missing",
+	}, schemaErr.Discrepancies)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifySchema_MariaDBJSON(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	// MariaDB reports json columns as longtext
+	columns := currentColumns()
+	columns[5].columnType = "longtext"
+	expectDescribeTable(mock, "resource_context", columns, currentIndexes())
+
+	assert.NoError(t, repo.VerifySchema())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifySchema_ShardTables(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+	require.NoError(t, repo.SetTypeTables(map[string]string{"order": "order_context"}))
+
+	expectDescribeTable(mock, "resource_context", currentColumns(), currentIndexes())
+	expectDescribeTable(mock, "order_context", nil, nil)
+
+	err := repo.VerifySchema()
+	var schemaErr *SchemaError
+	require.ErrorAs(t, err, &schemaErr)
+	assert.Equal(t, []string{"table order_context does not exist"}, schemaErr.Discrepancies)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifySchema_QueryError(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM information_schema.columns`).WillReturnError(assert.AnError)
+
+	err := repo.VerifySchema()
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.ErrorContains(t, err, "failed to inspect table resource_context")
+	var schemaErr *SchemaError
+	assert.False(t, errors.As(err, &schemaErr))
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// seedStateTable records, per seed source, the hash of the records last loaded
+// completely.
+const seedStateTable = "seed_state"
+
+// createSeedStateStatement creates seedStateTable. A row whose source_hash is
+// empty has never been loaded completely.
+const createSeedStateStatement = `CREATE TABLE IF NOT EXISTS ` + seedStateTable + ` (
+	name VARCHAR(64) NOT NULL,
+	source_hash VARCHAR(64) NOT NULL,
+	seeded_at DATETIME NULL,
+	PRIMARY KEY (name)
+)`
+
+// SeedStrategy selects what Seed does with a seed record whose key is already
+// stored.
+type SeedStrategy string
+
+const (
+	// SeedMissing only adds the records whose key is not stored yet.
+	SeedMissing SeedStrategy = "missing"
+	// SeedRefresh also overwrites the context and metadata of stored records
+	// and bumps their updated_at.
+	SeedRefresh SeedStrategy = "refresh"
+)
+
+// seedDuplicateClauses resolve the duplicate keys of a seed as each strategy
+// selects.
+var seedDuplicateClauses = map[SeedStrategy]string{
+	SeedMissing: " ON DUPLICATE KEY UPDATE resource_id = resource_id",
+	SeedRefresh: " ON DUPLICATE KEY UPDATE context = VALUES(context), updated_at = VALUES(updated_at), metadata = VALUES(metadata)",
+}
+
+// ParseSeedStrategy parses a seed strategy name.
+func ParseSeedStrategy(value string) (SeedStrategy, error) {
+	strategy := SeedStrategy(value)
+	if _, ok := seedDuplicateClauses[strategy]; !ok {
+		return "", fmt.Errorf("invalid seed strategy '%s': must be missing or refresh", value)
+	}
+	return strategy, nil
+}
+
+// Seed loads the records of the seed source name unless the records hashing to
+// sourceHash were already loaded completely, and reports whether it loaded them.
+// Records are stamped with the current time, as with InsertBatch, and stored
+// records are kept or refreshed as strategy selects.
+//
+// The state of every source is a row of the seed_state table, which Seed creates
+// when missing. The row is locked for the whole load, and the records and the new
+// hash are written in the same transaction, so a failed or interrupted load
+// leaves the previous state and is retried by the next call, and replicas
+// starting together load a source once: the others wait for the lock and then
+// find the hash stored.
+func (r *RecordRepository) Seed(name, sourceHash string, records []Record, strategy SeedStrategy, progress func(inserted int)) (bool, error) {
+	if _, err := ParseSeedStrategy(string(strategy)); err != nil {
+		return false, err
+	}
+
+	if _, err := r.exec(r.db, "create_seed_state", createSeedStateStatement); err != nil {
+		return false, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	seeded, err := r.seed(tx, name, sourceHash, records, strategy, progress)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	return seeded, tx.Commit()
+}
+
+// seed runs the statements of Seed inside tx.
+func (r *RecordRepository) seed(tx *sql.Tx, name, sourceHash string, records []Record, strategy SeedStrategy, progress func(inserted int)) (bool, error) {
+	// Claim the state row first: a replica inserting it concurrently blocks
+	// here until the other's transaction ends
+	claim := "INSERT IGNORE INTO " + seedStateTable + " (name, source_hash) VALUES (?, '')"
+	if _, err := r.exec(tx, "claim_seed_state", claim, name); err != nil {
+		return false, err
+	}
+
+	start := time.Now()
+	var loadedHash string
+	err := tx.QueryRow("SELECT source_hash FROM "+seedStateTable+" WHERE name = ? FOR UPDATE", name).Scan(&loadedHash)
+	r.logQuery("lock_seed_state", start, 1, err)
+	if err != nil {
+		return false, err
+	}
+	if loadedHash == sourceHash {
+		return false, nil
+	}
+
+	write := batchWrite{name: "seed_batch", onDuplicate: seedDuplicateClauses[strategy]}
+	if err := r.insertRecords(tx, records, write, progress); err != nil {
+		return false, err
+	}
+
+	update := "UPDATE " + seedStateTable + " SET source_hash = ?, seeded_at = ? WHERE name = ?"
+	if _, err := r.exec(tx, "update_seed_state", update, sourceHash, time.Now().UTC(), name); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
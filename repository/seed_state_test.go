@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectSeedState expects Seed to create and lock the state row of the seed
+// named name, which holds loadedHash.
+func expectSeedState(mock sqlmock.Sqlmock, name, loadedHash string) {
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS seed_state`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT IGNORE INTO seed_state \(name, source_hash\) VALUES \(\?, ''\)`).
+		WithArgs(name).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT source_hash FROM seed_state WHERE name = \? FOR UPDATE`).
+		WithArgs(name).
+		WillReturnRows(sqlmock.NewRows([]string{"source_hash"}).AddRow(loadedHash))
+}
+
+func TestSeed_LoadsChangedSource(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	expectSeedState(mock, "sample_data", "old-hash")
+	mock.ExpectExec(`INSERT INTO resource_context \(resource_id, resource_type, context, created_at, updated_at, metadata\) VALUES \(\?, \?, \?, \?, \?, \?\), \(\?, \?, \?, \?, \?, \?\) ON DUPLICATE KEY UPDATE resource_id = resource_id$`).
+		WithArgs("user-1", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "user-2", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE seed_state SET source_hash = \?, seeded_at = \? WHERE name = \?`).
+		WithArgs("new-hash", sqlmock.AnyArg(), "sample_data").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	records := []Record{{ResourceID: "user-1", ResourceType: "user"}, {ResourceID: "user-2", ResourceType: "user"}}
+	seeded, err := repo.Seed("sample_data", "new-hash", records, SeedMissing, nil)
+
+	require.NoError(t, err)
+	assert.True(t, seeded)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSeed_SkipsLoadedSource(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	expectSeedState(mock, "sample_data", "same-hash")
+	mock.ExpectCommit()
+
+	seeded, err := repo.Seed("sample_data", "same-hash", []Record{{ResourceID: "user-1", ResourceType: "user"}}, SeedMissing, nil)
+
+	require.NoError(t, err)
+	assert.False(t, seeded)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSeed_Refresh(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	expectSeedState(mock, "sample_data", "")
+	mock.ExpectExec(`INSERT INTO resource_context .* ON DUPLICATE KEY UPDATE context = VALUES\(context\), updated_at = VALUES\(updated_at\), metadata = VALUES\(metadata\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE seed_state`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	seeded, err := repo.Seed("sample_data", "new-hash", []Record{{ResourceID: "user-1", ResourceType: "user"}}, SeedRefresh, nil)
+
+	require.NoError(t, err)
+	assert.True(t, seeded)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSeed_FailureKeepsPreviousState(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	expectSeedState(mock, "sample_data", "")
+	mock.ExpectExec(`INSERT INTO resource_context`).
+		WillReturnError(assert.AnError)
+	mock.ExpectExec(`INSERT INTO resource_context`).
+		WithArgs("user-1", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	seeded, err := repo.Seed("sample_data", "new-hash", []Record{{ResourceID: "user-1", ResourceType: "user"}}, SeedMissing, nil)
+
+	var batchErr *BatchInsertError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 0, batchErr.Index)
+	assert.False(t, seeded)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSeed_InvalidStrategy(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	_, err := repo.Seed("sample_data", "new-hash", nil, SeedStrategy("replace"), nil)
+
+	assert.EqualError(t, err, "invalid seed strategy 'replace': must be missing or refresh")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,59 @@
+package repository
+
+import "crypto/cipher"
+
+// Settings are the repository settings that may be changed while it serves
+// requests: the pagination limits and the continuation token key.
+type Settings struct {
+	MaxPageDepth   int // see SetMaxPageDepth
+	MaxTokenLength int // see SetMaxTokenLength
+	GetAllLimit    int // see SetGetAllLimit
+	// TokenEncryptionKey enables encrypted continuation tokens, see
+	// EnableTokenEncryption. When empty, tokens are issued in plaintext mode.
+	TokenEncryptionKey []byte
+}
+
+// settings is the applied form of Settings that requests read.
+type settings struct {
+	maxPageDepth int
+	maxTokenLen  int
+	getAllLimit  int
+	tokenAEAD    cipher.AEAD
+}
+
+// Reconfigure replaces all settings at once. The settings are held behind an
+// atomic pointer that is swapped as a whole, so requests in flight never observe
+// a partially applied change. Continuation tokens issued under a previous
+// encryption key are rejected once the key changes. When the key is invalid an
+// error is returned and the settings are left unchanged.
+func (r *RecordRepository) Reconfigure(s Settings) error {
+	next := settings{maxPageDepth: s.MaxPageDepth, maxTokenLen: s.MaxTokenLength, getAllLimit: s.GetAllLimit}
+	if len(s.TokenEncryptionKey) > 0 {
+		aead, err := newTokenAEAD(s.TokenEncryptionKey)
+		if err != nil {
+			return err
+		}
+		next.tokenAEAD = aead
+	}
+
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+	r.settings.Store(&next)
+	return nil
+}
+
+// update applies fn to a copy of the current settings and swaps the copy in.
+func (r *RecordRepository) update(fn func(s *settings)) {
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+
+	next := *r.settings.Load()
+	fn(&next)
+	r.settings.Store(&next)
+}
+
+// current returns the settings in effect. A request should read them once and
+// use the result throughout.
+func (r *RecordRepository) current() *settings {
+	return r.settings.Load()
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconfigure(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	oldKey := []byte("0123456789abcdef")
+	require.NoError(t, repo.Reconfigure(Settings{MaxPageDepth: 10, MaxTokenLength: 1024, GetAllLimit: 50, TokenEncryptionKey: oldKey}))
+	assert.Equal(t, &settings{maxPageDepth: 10, maxTokenLen: 1024, getAllLimit: 50, tokenAEAD: repo.current().tokenAEAD}, repo.current())
+	oldToken := repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-1", CreatedAt: time.Unix(1234567890, 0), Page: 1})
+
+	// Rotating the key rejects tokens sealed under the old one
+	require.NoError(t, repo.Reconfigure(Settings{MaxPageDepth: 10, MaxTokenLength: 1024, GetAllLimit: 50, TokenEncryptionKey: []byte("fedcba9876543210")}))
+	_, err := repo.decodeContinuationToken(oldToken)
+	assert.Error(t, err)
+
+	// Without a key tokens are in plaintext mode again
+	require.NoError(t, repo.Reconfigure(Settings{}))
+	assert.Nil(t, repo.current().tokenAEAD)
+	assert.Zero(t, repo.current().maxPageDepth)
+}
+
+func TestReconfigure_InvalidKeyKeepsSettings(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	before := repo.current()
+	err := repo.Reconfigure(Settings{MaxPageDepth: 1, TokenEncryptionKey: []byte("short")})
+	assert.ErrorContains(t, err, "invalid token encryption key")
+	assert.Same(t, before, repo.current())
+}
+
+func TestReconfigure_ConcurrentWithRequests(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	keys := [][]byte{[]byte("0123456789abcdef"), []byte("fedcba9876543210")}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			assert.NoError(t, repo.Reconfigure(Settings{MaxPageDepth: i, TokenEncryptionKey: keys[i%2]}))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			repo.SetGetAllLimit(i)
+			repo.encodeContinuationToken(cursor{ResourceType: "user", ResourceID: "user-1", Page: 1})
+		}
+	}()
+	wg.Wait()
+}
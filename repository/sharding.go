@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultTable is the physical table holding every resource_type that has not
+// been routed to a dedicated shard table.
+const defaultTable = "resource_context"
+
+// recordColumns is the standard column list selected for a Record.
+const recordColumns = "resource_id, resource_type, context, created_at, updated_at, metadata"
+
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// SetTypeTables routes the given resource types to dedicated physical tables,
+// e.g. {"user": "resource_context_user"}. Types without an entry keep using the
+// resource_context table. Table names are interpolated into SQL, so they must be
+// plain identifiers; an error is returned for anything else.
+func (r *RecordRepository) SetTypeTables(tables map[string]string) error {
+	routed := make(map[string]string, len(tables))
+	for resourceType, table := range tables {
+		if !tableNamePattern.MatchString(table) {
+			return fmt.Errorf("invalid table name %q for resource_type %q", table, resourceType)
+		}
+		routed[resourceType] = table
+	}
+
+	r.typeTables = routed
+	return nil
+}
+
+// tableFor returns the physical table that stores records of the given type.
+func (r *RecordRepository) tableFor(resourceType string) string {
+	if table, ok := r.typeTables[resourceType]; ok {
+		return table
+	}
+	return defaultTable
+}
+
+// tables returns every physical table in use, starting with the default table
+// followed by the shard tables in sorted order.
+func (r *RecordRepository) tables() []string {
+	seen := map[string]bool{defaultTable: true}
+	var shards []string
+	for _, table := range r.typeTables {
+		if !seen[table] {
+			seen[table] = true
+			shards = append(shards, table)
+		}
+	}
+	sort.Strings(shards)
+
+	return append([]string{defaultTable}, shards...)
+}
+
+// readSource returns the FROM expression for cross-type reads. Without shards it
+// is simply the resource_context table; with shards it is a UNION ALL of every
+// table aliased as resource_context, so the rest of a query is unaffected.
+func (r *RecordRepository) readSource() string {
+	return r.readSourceOf(recordColumns)
+}
+
+// readSourceOf is readSource for queries that select columns rather than
+// recordColumns.
+func (r *RecordRepository) readSourceOf(columns string) string {
+	tables := r.tables()
+	if len(tables) == 1 {
+		return defaultTable
+	}
+
+	selects := make([]string, len(tables))
+	for i, table := range tables {
+		selects[i] = "SELECT " + columns + " FROM " + table
+	}
+
+	return "(" + strings.Join(selects, " UNION ALL ") + ") AS " + defaultTable
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupShardedTestDB creates a mock database with the user type routed to its own table
+func setupShardedTestDB(t *testing.T) (sqlmock.Sqlmock, *RecordRepository) {
+	db, mock, repo := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+
+	require.NoError(t, repo.SetTypeTables(map[string]string{"user": "resource_context_user"}))
+	return mock, repo
+}
+
+func TestSetTypeTables_InvalidTableName(t *testing.T) {
+	db, _, repo := setupTestDB(t)
+	defer db.Close()
+
+	err := repo.SetTypeTables(map[string]string{"user": "users; DROP TABLE x"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid table name")
+}
+
+func TestCreateTable_CreatesShardTables(t *testing.T) {
+	mock, repo := setupShardedTestDB(t)
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS resource_context \(`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS resource_context_user \(`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectTableColumns(mock, "resource_context", tableColumnNames...)
+	expectTableIndexes(mock, "resource_context", currentIndexes())
+	expectTableColumns(mock, "resource_context_user", tableColumnNames...)
+	expectTableIndexes(mock, "resource_context_user", currentIndexes())
+
+	err := repo.CreateTable()
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsert_RoutesToShardTable(t *testing.T) {
+	mock, repo := setupShardedTestDB(t)
+
+	mock.ExpectExec(`INSERT INTO resource_context_user \(`).
+		WithArgs("user-1", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO resource_context \(`).
+		WithArgs("doc-1", "document", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	assert.NoError(t, repo.Insert("user-1", "user", nil))
+	assert.NoError(t, repo.Insert("doc-1", "document", nil))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetByID_RoutesToShardTable(t *testing.T) {
+	mock, repo := setupShardedTestDB(t)
+
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+		AddRow("user-1", "user", nil, now, now, nil)
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context_user WHERE resource_type = \? AND resource_id = \?`).
+		WithArgs("user", "user-1").
+		WillReturnRows(rows)
+
+	record, err := repo.GetByID("user-1", "user")
+	assert.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, "user-1", record.ResourceID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetByID_NotFound(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context WHERE resource_type = \? AND resource_id = \?`).
+		WithArgs("user", "missing").
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}))
+
+	record, err := repo.GetByID("missing", "user")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Nil(t, record)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedByType_RoutesToShardTable(t *testing.T) {
+	mock, repo := setupShardedTestDB(t)
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context_user WHERE resource_type = \? ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs("user", 6).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}))
+
+	result, err := repo.GetPaginatedByType("user", "", 5)
+	assert.NoError(t, err)
+	assert.NotNil(t, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginatedByType_WithTokenUnsharded(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Unix(1234567890, 0)
+	token := repo.encodeContinuationToken(cursor{ResourceType: "document", ResourceID: "doc-5", CreatedAt: now, Page: 1})
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context WHERE resource_type = \? AND \(created_at < \? OR .*\) ORDER BY created_at DESC, resource_type DESC, resource_id DESC LIMIT \?`).
+		WithArgs("document", now, now, "document", now, "document", "doc-5", 6).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}))
+
+	_, err := repo.GetPaginatedByType("document", token, 5)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPaginated_ReadsAcrossShards(t *testing.T) {
+	mock, repo := setupShardedTestDB(t)
+
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM \(SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context UNION ALL SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context_user\) AS resource_context ORDER BY created_at DESC`).
+		WithArgs(6).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}))
+
+	_, err := repo.GetPaginated("", 5)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
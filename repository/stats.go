@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// DateFormat is the layout of the dates reported by CountByDay.
+const DateFormat = "2006-01-02"
+
+// DayCount is the number of records created on one day.
+type DayCount struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// LastModified returns the newest updated_at across all tables, the zero time when
+// there are no records. Inserting or touching a record moves it forward; deleting
+// one does not. It reads the idx_updated_at index only, so it is cheap enough to
+// check before every poll.
+func (r *RecordRepository) LastModified() (time.Time, error) {
+	var last sql.NullTime
+	start := time.Now()
+	err := r.db.QueryRow("SELECT MAX(updated_at) FROM " + r.readSource()).Scan(&last)
+	r.logQuery("last_modified", start, 1, err)
+	if err != nil || !last.Valid {
+		return time.Time{}, err
+	}
+	return last.Time.UTC(), nil
+}
+
+// CountByDay returns the number of records created on each day with records
+// between from, inclusive, and to, exclusive, ordered by date. Days are calendar
+// days in the session time zone, UTC unless DB_LOC says otherwise; days without
+// records are omitted. Records of every shard table are counted.
+func (r *RecordRepository) CountByDay(from, to time.Time) ([]DayCount, error) {
+	query := "SELECT DATE(created_at) AS day, COUNT(*) FROM " + r.readSource() +
+		" WHERE created_at >= ? AND created_at < ? GROUP BY DATE(created_at) ORDER BY day"
+
+	start := time.Now()
+	rows, err := r.db.Query(query, from.UTC(), to.UTC())
+	if err != nil {
+		r.logQuery("count_by_day", start, 0, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []DayCount{}
+	for rows.Next() {
+		var day time.Time
+		var count int64
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, DayCount{Date: day.Format(DateFormat), Count: count})
+	}
+	r.logQuery("count_by_day", start, int64(len(counts)), rows.Err())
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
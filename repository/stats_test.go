@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountByDay(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`^SELECT DATE\(created_at\) AS day, COUNT\(\*\) FROM resource_context WHERE created_at >= \? AND created_at < \? GROUP BY DATE\(created_at\) ORDER BY day$`).
+		WithArgs(from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"day", "COUNT(*)"}).
+			AddRow(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 3).
+			AddRow(time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), 12))
+
+	counts, err := repo.CountByDay(from, to)
+	require.NoError(t, err)
+	assert.Equal(t, []DayCount{{Date: "2024-01-01", Count: 3}, {Date: "2024-01-03", Count: 12}}, counts)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCountByDay_Empty(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`GROUP BY DATE\(created_at\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"day", "COUNT(*)"}))
+
+	counts, err := repo.CountByDay(time.Now().Add(-time.Hour), time.Now())
+	require.NoError(t, err)
+	assert.NotNil(t, counts)
+	assert.Empty(t, counts)
+}
+
+func TestCountByDay_ShardTables(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+	require.NoError(t, repo.SetTypeTables(map[string]string{"user": "resource_context_user"}))
+
+	mock.ExpectQuery(`FROM \(SELECT .* FROM resource_context UNION ALL SELECT .* FROM resource_context_user\) AS resource_context WHERE created_at >= \?`).
+		WillReturnRows(sqlmock.NewRows([]string{"day", "COUNT(*)"}))
+
+	_, err := repo.CountByDay(time.Now().Add(-time.Hour), time.Now())
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCountByDay_QueryError(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`GROUP BY DATE\(created_at\)`).WillReturnError(assert.AnError)
+
+	_, err := repo.CountByDay(time.Now().Add(-time.Hour), time.Now())
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestLastModified(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	updated := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	mock.ExpectQuery(`^SELECT MAX\(updated_at\) FROM resource_context$`).
+		WillReturnRows(sqlmock.NewRows([]string{"MAX(updated_at)"}).AddRow(updated))
+
+	last, err := repo.LastModified()
+	require.NoError(t, err)
+	assert.Equal(t, updated, last)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLastModified_Empty(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT MAX\(updated_at\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"MAX(updated_at)"}).AddRow(nil))
+
+	last, err := repo.LastModified()
+	require.NoError(t, err)
+	assert.True(t, last.IsZero())
+}
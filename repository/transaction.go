@@ -0,0 +1,75 @@
+package repository
+
+import "database/sql"
+
+// execer is the part of *sql.DB and *sql.Tx used by the single-record write
+// methods, so that they run the same statements inside and outside a transaction.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// rowQueryer is the part of *sql.DB and *sql.Tx used by the single-record read
+// methods, so that a transaction can read back what it has written.
+type rowQueryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// RecordTx groups several writes into one database transaction. It offers the
+// write methods of RecordRepository, which take effect together on Commit or not
+// at all on Rollback. A RecordTx must not be used after Commit or Rollback.
+type RecordTx struct {
+	repo *RecordRepository
+	tx   *sql.Tx
+}
+
+// BeginTx starts a transaction. The caller must end it with Commit or Rollback;
+// deferring Rollback right after BeginTx is safe, as it does nothing once the
+// transaction has been committed.
+func (r *RecordRepository) BeginTx() (*RecordTx, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &RecordTx{repo: r, tx: tx}, nil
+}
+
+// Insert works like RecordRepository.Insert within the transaction.
+func (t *RecordTx) Insert(resourceID, resourceType string, context *string) error {
+	return t.InsertWithMetadata(resourceID, resourceType, context, nil)
+}
+
+// InsertWithMetadata works like RecordRepository.InsertWithMetadata within the
+// transaction.
+func (t *RecordTx) InsertWithMetadata(resourceID, resourceType string, context *string, metadata map[string]string) error {
+	return t.repo.insert(t.tx, resourceID, resourceType, context, metadata)
+}
+
+// GetByID works like RecordRepository.GetByID within the transaction, and sees
+// the transaction's own writes.
+func (t *RecordTx) GetByID(resourceID, resourceType string) (*Record, error) {
+	return t.repo.getByID(t.tx, resourceID, resourceType)
+}
+
+// Touch works like RecordRepository.Touch within the transaction.
+func (t *RecordTx) Touch(resourceID, resourceType string) error {
+	return t.repo.touch(t.tx, resourceID, resourceType)
+}
+
+// Delete works like RecordRepository.Delete within the transaction.
+func (t *RecordTx) Delete(resourceID, resourceType string) error {
+	return t.repo.delete(t.tx, resourceID, resourceType)
+}
+
+// Commit makes every write of the transaction permanent.
+func (t *RecordTx) Commit() error {
+	return t.tx.Commit()
+}
+
+// Rollback discards every write of the transaction. After a successful Commit it
+// does nothing and returns nil.
+func (t *RecordTx) Rollback() error {
+	if err := t.tx.Rollback(); err != nil && err != sql.ErrTxDone {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordTx_CommitsTwoInserts(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO resource_context`).
+		WithArgs("user-1", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO resource_context`).
+		WithArgs("user-2", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), `{"tier":"gold"}`).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	tx, err := repo.BeginTx()
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	require.NoError(t, tx.Insert("user-1", "user", nil))
+	require.NoError(t, tx.InsertWithMetadata("user-2", "user", nil, map[string]string{"tier": "gold"}))
+	require.NoError(t, tx.Commit())
+
+	assert.NoError(t, tx.Rollback(), "rollback after commit must be a no-op")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRecordTx_RollsBackOnError(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO resource_context`).
+		WithArgs("user-1", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE resource_context SET updated_at`).
+		WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	tx, err := repo.BeginTx()
+	require.NoError(t, err)
+
+	require.NoError(t, tx.Insert("user-1", "user", nil))
+	err = tx.Touch("user-2", "user")
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.NoError(t, tx.Rollback())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRecordTx_DeleteNotFound(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM resource_context_task WHERE resource_type = \? AND resource_id = \?`).
+		WithArgs("task", "task-1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	require.NoError(t, repo.SetTypeTables(map[string]string{"task": "resource_context_task"}))
+	tx, err := repo.BeginTx()
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, tx.Delete("task-1", "task"), ErrNotFound)
+	assert.NoError(t, tx.Rollback())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBeginTx_Error(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin().WillReturnError(assert.AnError)
+
+	tx, err := repo.BeginTx()
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Nil(t, tx)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertReturning(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO resource_context`).
+		WithArgs("user-1", "user", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), `{"tier":"gold"}`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT resource_id, resource_type, context, created_at, updated_at, metadata FROM resource_context WHERE resource_type = \? AND resource_id = \?`).
+		WithArgs("user", "user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}).
+			AddRow("user-1", "user", nil, created, created, `{"tier":"gold"}`))
+	mock.ExpectCommit()
+
+	record, err := repo.InsertReturning("user-1", "user", nil, map[string]string{"tier": "gold"})
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", record.ResourceID)
+	assert.Equal(t, created, record.CreatedAt)
+	assert.Equal(t, map[string]string{"tier": "gold"}, record.Metadata)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertReturning_InsertError(t *testing.T) {
+	db, mock, repo := setupTestDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO resource_context`).
+		WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	record, err := repo.InsertReturning("user-1", "user", nil, nil)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Nil(t, record)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
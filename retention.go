@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// retentionInterval is how often the records past RETENTION_DAYS are purged.
+const retentionInterval = time.Hour
+
+// retention purges the records created more than days ago, at startup and then
+// every interval, so that no record outlives the retention period by more than
+// interval. Replicas purging at the same time delete each record once.
+type retention struct {
+	purge    func(cutoff time.Time) (int64, error)
+	days     int
+	interval time.Duration
+	now      func() time.Time
+	logger   *slog.Logger
+}
+
+// purgeExpired deletes the records created before the retention period and logs
+// how many were deleted. A failure is logged and retried at the next interval.
+func (r *retention) purgeExpired() {
+	cutoff := r.now().UTC().AddDate(0, 0, -r.days)
+	deleted, err := r.purge(cutoff)
+	if err != nil {
+		r.logger.Error("retention purge failed", "cutoff", cutoff, "error", err)
+		return
+	}
+	if deleted > 0 {
+		r.logger.Info("retention purge deleted expired records", "cutoff", cutoff, "deleted", deleted)
+	}
+}
+
+// run purges the expired records right away and then every interval until ctx
+// is done.
+func (r *retention) run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.purgeExpired()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// purgeRecorder stands in for PurgeOlderThan, recording the cutoffs it is called
+// with and returning deleted and err.
+type purgeRecorder struct {
+	mu      sync.Mutex
+	cutoffs []time.Time
+	deleted int64
+	err     error
+}
+
+func (p *purgeRecorder) purge(cutoff time.Time) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cutoffs = append(p.cutoffs, cutoff)
+	return p.deleted, p.err
+}
+
+func (p *purgeRecorder) calls() []time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]time.Time{}, p.cutoffs...)
+}
+
+// testRetention returns a retention of days purging through p, and the buffer
+// its log is written to.
+func testRetention(days int, p *purgeRecorder) (*retention, *bytes.Buffer) {
+	var logs bytes.Buffer
+	return &retention{
+		purge:    p.purge,
+		days:     days,
+		interval: time.Hour,
+		now:      func() time.Time { return time.Date(2024, 3, 31, 12, 0, 0, 0, time.FixedZone("CEST", 2*3600)) },
+		logger:   slog.New(slog.NewTextHandler(&logs, nil)),
+	}, &logs
+}
+
+func TestRetention_PurgeExpired(t *testing.T) {
+	p := &purgeRecorder{deleted: 12}
+	r, logs := testRetention(30, p)
+
+	r.purgeExpired()
+
+	require.Len(t, p.calls(), 1)
+	assert.Equal(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), p.calls()[0])
+	assert.Contains(t, logs.String(), "deleted=12")
+}
+
+func TestRetention_NothingExpired(t *testing.T) {
+	p := &purgeRecorder{}
+	r, logs := testRetention(30, p)
+
+	r.purgeExpired()
+
+	assert.Len(t, p.calls(), 1)
+	assert.Empty(t, logs.String(), "a purge deleting nothing is not logged")
+}
+
+func TestRetention_PurgeFails(t *testing.T) {
+	r, logs := testRetention(30, &purgeRecorder{err: assert.AnError})
+
+	r.purgeExpired()
+
+	assert.Contains(t, logs.String(), "level=ERROR")
+	assert.Contains(t, logs.String(), "retention purge failed")
+}
+
+func TestRetention_Run(t *testing.T) {
+	p := &purgeRecorder{}
+	r, _ := testRetention(1, p)
+	r.interval = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		r.run(ctx)
+		close(done)
+	}()
+
+	// The first purge runs at once and the ticker repeats it
+	assert.Eventually(t, func() bool { return len(p.calls()) >= 3 }, time.Second, time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("run did not stop when the context was done")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"tokenpagination/config"
+	"tokenpagination/repository"
+	"tokenpagination/seed"
+)
+
+// embeddedSampleData is the default sample data in the pipe format. It is compiled
+// into the binary so that seeding works without any file next to it.
+//
+//go:embed sample_data.txt
+var embeddedSampleData string
+
+// embeddedSampleSource names the embedded sample data in messages.
+const embeddedSampleSource = "embedded sample data"
+
+// loadSampleRecords loads the sample records from filename, or the embedded sample
+// data when filename is empty. A file that does not exist only logs a warning and
+// falls back to the embedded data; any other problem with the file is an error. It
+// also returns where the records came from, for messages.
+func loadSampleRecords(filename string, format seed.Format) ([]seed.SampleRecord, string, error) {
+	if filename != "" {
+		records, err := seed.LoadFile(filename, format)
+		if err == nil {
+			return records, filename, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, filename, fmt.Errorf("failed to load sample data from %s:\n%v", filename, err)
+		}
+		slog.Warn("sample data file does not exist, using the embedded sample data instead", "file", filename)
+	}
+
+	records, err := seed.Parse(strings.NewReader(embeddedSampleData), seed.FormatPipe)
+	if err != nil {
+		return nil, embeddedSampleSource, fmt.Errorf("failed to load %s:\n%v", embeddedSampleSource, err)
+	}
+	return records, embeddedSampleSource, nil
+}
+
+// seedOnStartup loads sample data that has not been loaded yet unless seeding is
+// switched off with SEED_SAMPLE_DATA=false.
+func seedOnStartup(repo *repository.RecordRepository, features config.FeatureConfig) error {
+	if !features.SeedSampleData {
+		fmt.Println("Sample data seeding is disabled")
+		return nil
+	}
+	return populateSampleData(repo, features.SeedFile, features.SeedFormat, features.SeedStrategy)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tokenpagination/config"
+	"tokenpagination/repository"
+	"tokenpagination/seed"
+)
+
+func TestLoadSampleRecords_Embedded(t *testing.T) {
+	records, source, err := loadSampleRecords("", "")
+
+	require.NoError(t, err)
+	assert.Equal(t, embeddedSampleSource, source)
+	require.NotEmpty(t, records)
+	assert.Equal(t, "user-1001", records[0].ResourceID)
+}
+
+func TestLoadSampleRecords_ExternalFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "records.txt")
+	require.NoError(t, os.WriteFile(filename, []byte("doc-1|document|{\"title\": \"Plan\"}\n"), 0o600))
+
+	records, source, err := loadSampleRecords(filename, seed.FormatPipe)
+
+	require.NoError(t, err)
+	assert.Equal(t, filename, source)
+	require.Len(t, records, 1)
+	assert.Equal(t, "doc-1", records[0].ResourceID)
+	assert.Equal(t, "document", records[0].ResourceType)
+	require.NotNil(t, records[0].Context)
+	assert.JSONEq(t, `{"title": "Plan"}`, *records[0].Context)
+}
+
+func TestLoadSampleRecords_MissingFileFallsBack(t *testing.T) {
+	records, source, err := loadSampleRecords(filepath.Join(t.TempDir(), "missing.txt"), "")
+
+	require.NoError(t, err)
+	assert.Equal(t, embeddedSampleSource, source)
+	assert.NotEmpty(t, records)
+}
+
+func TestLoadSampleRecords_InvalidFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "records.txt")
+	require.NoError(t, os.WriteFile(filename, []byte("not a record\n"), 0o600))
+
+	_, _, err := loadSampleRecords(filename, seed.FormatPipe)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load sample data from "+filename)
+}
+
+func TestSeedOnStartup_Disabled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = seedOnStartup(repository.NewRecordRepository(db), config.FeatureConfig{SeedSampleData: false})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSeedOnStartup_SkipsLoadedSampleData(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	records, _, err := loadSampleRecords("", "")
+	require.NoError(t, err)
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS seed_state`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT IGNORE INTO seed_state`).
+		WithArgs(sampleDataSeed).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT source_hash FROM seed_state WHERE name = \? FOR UPDATE`).
+		WithArgs(sampleDataSeed).
+		WillReturnRows(sqlmock.NewRows([]string{"source_hash"}).AddRow(sampleDataHash(records)))
+	mock.ExpectCommit()
+
+	err = seedOnStartup(repository.NewRecordRepository(db), config.FeatureConfig{SeedSampleData: true, SeedStrategy: repository.SeedMissing})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSeedOnStartup_LoadsChangedSampleData(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	filename := filepath.Join(t.TempDir(), "records.txt")
+	require.NoError(t, os.WriteFile(filename, []byte("doc-1|document|\n"), 0o600))
+	records, _, err := loadSampleRecords(filename, seed.FormatPipe)
+	require.NoError(t, err)
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS seed_state`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT IGNORE INTO seed_state`).
+		WithArgs(sampleDataSeed).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT source_hash FROM seed_state WHERE name = \? FOR UPDATE`).
+		WithArgs(sampleDataSeed).
+		WillReturnRows(sqlmock.NewRows([]string{"source_hash"}).AddRow("hash-of-older-sample-data"))
+	mock.ExpectExec(`INSERT INTO resource_context .* ON DUPLICATE KEY UPDATE resource_id = resource_id`).
+		WithArgs("doc-1", "document", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE seed_state SET source_hash = \?, seeded_at = \? WHERE name = \?`).
+		WithArgs(sampleDataHash(records), sqlmock.AnyArg(), sampleDataSeed).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = seedOnStartup(repository.NewRecordRepository(db), config.FeatureConfig{SeedSampleData: true, SeedFile: filename, SeedStrategy: repository.SeedMissing})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSampleDataHash_IgnoresFileFormat(t *testing.T) {
+	dir := t.TempDir()
+	pipe := filepath.Join(dir, "records.txt")
+	require.NoError(t, os.WriteFile(pipe, []byte("doc-1|document|{\"title\": \"Plan\"}\n"), 0o600))
+	jsonFile := filepath.Join(dir, "records.json")
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`[{"resource_id": "doc-1", "resource_type": "document", "context": "{\"title\": \"Plan\"}"}]`), 0o600))
+
+	fromPipe, _, err := loadSampleRecords(pipe, "")
+	require.NoError(t, err)
+	fromJSON, _, err := loadSampleRecords(jsonFile, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, sampleDataHash(fromPipe), sampleDataHash(fromJSON))
+	assert.NotEqual(t, sampleDataHash(fromPipe), sampleDataHash(fromPipe[:0]))
+}
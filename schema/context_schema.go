@@ -0,0 +1,116 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// ValidationError reports why a context payload does not satisfy the JSON Schema
+// registered for its resource_type. Details holds one entry per failed constraint.
+type ValidationError struct {
+	ResourceType string
+	Details      []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("context does not match schema for resource_type '%s': %s", e.ResourceType, strings.Join(e.Details, "; "))
+}
+
+// ContextValidator validates record context payloads against per-type JSON Schemas.
+type ContextValidator struct {
+	schemas map[string]*jsonschema.Schema
+}
+
+// LoadDir compiles every <resource_type>.json file in dir into a schema for that
+// resource_type. Files with other extensions are ignored. An error is returned if
+// the directory cannot be read or any schema fails to compile.
+func LoadDir(dir string) (*ContextValidator, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("cannot read schema directory: %v", err)
+	}
+
+	validator := &ContextValidator{schemas: make(map[string]*jsonschema.Schema)}
+	for _, path := range paths {
+		resourceType := strings.TrimSuffix(filepath.Base(path), ".json")
+
+		compiled, err := jsonschema.Compile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile schema for resource_type '%s': %v", resourceType, err)
+		}
+		validator.schemas[resourceType] = compiled
+	}
+
+	return validator, nil
+}
+
+// ResourceTypes returns the sorted list of resource types that have a schema.
+func (v *ContextValidator) ResourceTypes() []string {
+	types := make([]string, 0, len(v.schemas))
+	for resourceType := range v.schemas {
+		types = append(types, resourceType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Validate checks context against the schema registered for resourceType. It is
+// a no-op when no schema exists for the type or when context is nil. A context
+// that is not a single valid JSON value, including one followed by trailing data,
+// or violates the schema yields a *ValidationError.
+func (v *ContextValidator) Validate(resourceType string, context *string) error {
+	compiled, ok := v.schemas[resourceType]
+	if !ok || context == nil {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(*context)))
+	decoder.UseNumber()
+
+	var payload any
+	if err := decoder.Decode(&payload); err != nil {
+		return &ValidationError{ResourceType: resourceType, Details: []string{"context is not valid JSON: " + err.Error()}}
+	}
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return &ValidationError{ResourceType: resourceType, Details: []string{"context is not valid JSON: unexpected data after the JSON value"}}
+	}
+
+	err := compiled.Validate(payload)
+	if err == nil {
+		return nil
+	}
+
+	var schemaErr *jsonschema.ValidationError
+	if !errors.As(err, &schemaErr) {
+		return err
+	}
+
+	var details []string
+	for _, unit := range schemaErr.BasicOutput().Errors {
+		if unit.Error == "" || strings.HasPrefix(unit.Error, "doesn't validate with") {
+			continue
+		}
+		location := unit.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		details = append(details, location+": "+unit.Error)
+	}
+	if len(details) == 0 {
+		details = []string{schemaErr.Message}
+	}
+
+	return &ValidationError{ResourceType: resourceType, Details: details}
+}
@@ -0,0 +1,93 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const userSchema = `{
+	"type": "object",
+	"properties": {
+		"action": {"type": "string", "enum": ["login", "logout"]},
+		"ip": {"type": "string"}
+	},
+	"required": ["action"],
+	"additionalProperties": false
+}`
+
+// setupSchemaDir writes a user.json schema into a temp directory and loads it
+func setupSchemaDir(t *testing.T) *ContextValidator {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "user.json"), []byte(userSchema), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.txt"), []byte("ignored"), 0o644))
+
+	validator, err := LoadDir(dir)
+	require.NoError(t, err)
+	return validator
+}
+
+func TestLoadDir(t *testing.T) {
+	validator := setupSchemaDir(t)
+	assert.Equal(t, []string{"user"}, validator.ResourceTypes())
+}
+
+func TestLoadDir_MissingDirectory(t *testing.T) {
+	_, err := LoadDir(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot read schema directory")
+}
+
+func TestLoadDir_InvalidSchema(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "user.json"), []byte(`{"type": 12}`), 0o644))
+
+	_, err := LoadDir(dir)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "resource_type 'user'")
+}
+
+func TestValidate(t *testing.T) {
+	validator := setupSchemaDir(t)
+
+	tests := []struct {
+		name         string
+		resourceType string
+		context      *string
+		wantValid    bool
+	}{
+		{"valid payload", "user", stringPtr(`{"action": "login", "ip": "10.0.0.1"}`), true},
+		{"missing required field", "user", stringPtr(`{"ip": "10.0.0.1"}`), false},
+		{"value not in enum", "user", stringPtr(`{"action": "delete"}`), false},
+		{"unexpected property", "user", stringPtr(`{"action": "login", "extra": 1}`), false},
+		{"not JSON", "user", stringPtr(`not json`), false},
+		{"trailing data", "user", stringPtr(`{"action": "login"} trailing-garbage`), false},
+		{"second JSON value", "user", stringPtr(`{"action": "login"} {"action": "logout"}`), false},
+		{"trailing whitespace", "user", stringPtr("{\"action\": \"login\"}\n"), true},
+		{"nil context", "user", nil, true},
+		{"type without schema", "document", stringPtr(`anything goes`), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.Validate(tt.resourceType, tt.context)
+			if tt.wantValid {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.resourceType, validationErr.ResourceType)
+			assert.NotEmpty(t, validationErr.Details)
+		})
+	}
+}
+
+// Helper function to create string pointers
+func stringPtr(s string) *string {
+	return &s
+}
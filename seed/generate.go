@@ -0,0 +1,23 @@
+package seed
+
+import "fmt"
+
+// generatedTypes are the resource types Generate cycles through.
+var generatedTypes = []string{"user", "document", "task"}
+
+// Generate returns count synthetic records for load testing. The records are
+// deterministic: the i-th record is always the same, with a resource_id such as
+// "user-000001" and a small JSON context, so repeated runs produce the same data.
+func Generate(count int) []SampleRecord {
+	records := make([]SampleRecord, count)
+	for i := range records {
+		resourceType := generatedTypes[i%len(generatedTypes)]
+		context := fmt.Sprintf(`{"generated": true, "sequence": %d}`, i+1)
+		records[i] = SampleRecord{
+			ResourceID:   fmt.Sprintf("%s-%06d", resourceType, i/len(generatedTypes)+1),
+			ResourceType: resourceType,
+			Context:      &context,
+		}
+	}
+	return records
+}
@@ -0,0 +1,30 @@
+package seed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	records := Generate(4)
+	require.Len(t, records, 4)
+
+	assert.Equal(t, "user-000001", records[0].ResourceID)
+	assert.Equal(t, "user", records[0].ResourceType)
+	assert.Equal(t, `{"generated": true, "sequence": 1}`, *records[0].Context)
+	assert.Equal(t, "document-000001", records[1].ResourceID)
+	assert.Equal(t, "task-000001", records[2].ResourceID)
+	assert.Equal(t, "user-000002", records[3].ResourceID)
+
+	keys := map[string]bool{}
+	for _, record := range Generate(1000) {
+		key := record.ResourceType + "/" + record.ResourceID
+		assert.False(t, keys[key], "duplicate key %s", key)
+		keys[key] = true
+	}
+
+	assert.Equal(t, Generate(10), Generate(10))
+	assert.Empty(t, Generate(0))
+}
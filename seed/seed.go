@@ -0,0 +1,285 @@
+// Package seed loads sample records from fixture files in the pipe, JSON, and CSV
+// formats.
+package seed
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SampleRecord represents a sample record to be loaded from a data file.
+type SampleRecord struct {
+	ResourceID   string
+	ResourceType string
+	Context      *string
+}
+
+// Format identifies the layout of a sample data file.
+type Format string
+
+const (
+	// FormatPipe is one resource_id|resource_type|context entry per line.
+	FormatPipe Format = "pipe"
+	// FormatJSON is an array of objects with resource_id, resource_type, and
+	// context fields.
+	FormatJSON Format = "json"
+	// FormatCSV is a CSV file whose header names the resource_id, resource_type,
+	// and optional context columns.
+	FormatCSV Format = "csv"
+)
+
+// ParseFormat parses a format name. An empty value is returned as is and means the
+// format is detected from the file extension.
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(value); format {
+	case "", FormatPipe, FormatJSON, FormatCSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid sample data format '%s': must be pipe, json, or csv", value)
+	}
+}
+
+// DetectFormat picks the format of a file from its extension: .json, .csv, or .txt
+// for the pipe format.
+func DetectFormat(filename string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".csv":
+		return FormatCSV, nil
+	case ".txt":
+		return FormatPipe, nil
+	default:
+		return "", fmt.Errorf("cannot detect the sample data format of %s: use a .txt, .json, or .csv extension or set the format explicitly", filename)
+	}
+}
+
+// LoadFile reads sample records from a file in the given format, or in the format
+// matching its extension when format is empty. See Parse for how malformed entries
+// are reported.
+func LoadFile(filename string, format Format) ([]SampleRecord, error) {
+	if format == "" {
+		var err error
+		if format, err = DetectFormat(filename); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Parse(file, format)
+}
+
+// Parse reads sample records in the given format. Malformed entries do not stop
+// parsing: the valid records are returned together with an error joining one
+// error per malformed entry, each naming its line (pipe and CSV) or record number
+// (JSON).
+func Parse(r io.Reader, format Format) ([]SampleRecord, error) {
+	switch format {
+	case FormatPipe:
+		return parsePipe(r)
+	case FormatJSON:
+		return parseJSON(r)
+	case FormatCSV:
+		return parseCSV(r)
+	default:
+		return nil, fmt.Errorf("invalid sample data format '%s': must be pipe, json, or csv", format)
+	}
+}
+
+// parsePipe reads one resource_id|resource_type|context entry per line. Empty lines
+// are skipped and the context may itself contain pipes.
+func parsePipe(r io.Reader) ([]SampleRecord, error) {
+	var records []SampleRecord
+	var errs []error
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		parts := strings.SplitN(text, "|", 3)
+		if len(parts) < 2 {
+			errs = append(errs, fmt.Errorf("line %d: invalid format '%s': expected resource_id|resource_type|context", line, text))
+			continue
+		}
+
+		var context string
+		if len(parts) == 3 {
+			context = parts[2]
+		}
+		record, err := newSampleRecord(parts[0], parts[1], context)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %v", line, err))
+			continue
+		}
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, errors.Join(errs...)
+}
+
+// jsonSampleRecord is one element of a JSON sample data file. The context may be a
+// JSON string holding the context or any other JSON value, which is stored as is.
+type jsonSampleRecord struct {
+	ResourceID   string          `json:"resource_id"`
+	ResourceType string          `json:"resource_type"`
+	Context      json.RawMessage `json:"context"`
+}
+
+// parseJSON reads a JSON array of sample record objects.
+func parseJSON(r io.Reader) ([]SampleRecord, error) {
+	var elements []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&elements); err != nil {
+		return nil, fmt.Errorf("invalid JSON sample data: expected an array of records: %v", err)
+	}
+
+	var records []SampleRecord
+	var errs []error
+
+	for i, element := range elements {
+		var entry jsonSampleRecord
+		if err := json.Unmarshal(element, &entry); err != nil {
+			errs = append(errs, fmt.Errorf("record %d: %v", i+1, err))
+			continue
+		}
+
+		context, err := jsonContext(entry.Context)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("record %d: %v", i+1, err))
+			continue
+		}
+
+		record, err := newSampleRecord(entry.ResourceID, entry.ResourceType, context)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("record %d: %v", i+1, err))
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, errors.Join(errs...)
+}
+
+// jsonContext returns the context text of a JSON sample record: the value of a
+// JSON string, or the compacted JSON of any other value. Null means no context.
+func jsonContext(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+
+	if raw[0] == '"' {
+		var context string
+		if err := json.Unmarshal(raw, &context); err != nil {
+			return "", err
+		}
+		return context, nil
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return "", err
+	}
+	return compact.String(), nil
+}
+
+// parseCSV reads a headered CSV file. The header must name the resource_id and
+// resource_type columns and may name a context column; other columns are ignored.
+func parseCSV(r io.Reader) ([]SampleRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV header: %v", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, required := range []string{"resource_id", "resource_type"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("invalid CSV header: missing %s column", required)
+		}
+	}
+
+	field := func(row []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return row[i]
+	}
+
+	var records []SampleRecord
+	var errs []error
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				errs = append(errs, fmt.Errorf("line %d: %v", parseErr.StartLine, parseErr.Err))
+				continue
+			}
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(row) != len(header) {
+			errs = append(errs, fmt.Errorf("line %d: expected %d fields, got %d", line, len(header), len(row)))
+			continue
+		}
+
+		record, err := newSampleRecord(field(row, "resource_id"), field(row, "resource_type"), field(row, "context"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %v", line, err))
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, errors.Join(errs...)
+}
+
+// newSampleRecord builds a sample record, requiring both key fields. An empty
+// context means the record has none.
+func newSampleRecord(resourceID, resourceType, context string) (SampleRecord, error) {
+	record := SampleRecord{ResourceID: resourceID, ResourceType: resourceType}
+	if record.ResourceID == "" {
+		return record, errors.New("resource_id is required")
+	}
+	if record.ResourceType == "" {
+		return record, errors.New("resource_type is required")
+	}
+
+	if context != "" {
+		record.Context = &context
+	}
+	return record, nil
+}
@@ -0,0 +1,148 @@
+package seed
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestParse_Pipe(t *testing.T) {
+	input := `user-1|user|{"action": "login"}
+
+doc-1|document
+task-1|task|{"note": "a|b"}
+broken
+|user|{}
+`
+
+	records, err := Parse(strings.NewReader(input), FormatPipe)
+
+	assert.Equal(t, []SampleRecord{
+		{ResourceID: "user-1", ResourceType: "user", Context: strPtr(`{"action": "login"}`)},
+		{ResourceID: "doc-1", ResourceType: "document"},
+		{ResourceID: "task-1", ResourceType: "task", Context: strPtr(`{"note": "a|b"}`)},
+	}, records)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "line 5: invalid format 'broken'")
+	assert.ErrorContains(t, err, "line 6: resource_id is required")
+}
+
+func TestParse_JSON(t *testing.T) {
+	input := `[
+		{"resource_id": "user-1", "resource_type": "user", "context": {"action": "login", "ip": "192.168.1.1"}},
+		{"resource_id": "doc-1", "resource_type": "document", "context": "{\"title\": \"Plan\"}"},
+		{"resource_id": "task-1", "resource_type": "task", "context": null},
+		{"resource_id": "task-2"},
+		{"resource_id": 7, "resource_type": "task"},
+		"not an object"
+	]`
+
+	records, err := Parse(strings.NewReader(input), FormatJSON)
+
+	assert.Equal(t, []SampleRecord{
+		{ResourceID: "user-1", ResourceType: "user", Context: strPtr(`{"action":"login","ip":"192.168.1.1"}`)},
+		{ResourceID: "doc-1", ResourceType: "document", Context: strPtr(`{"title": "Plan"}`)},
+		{ResourceID: "task-1", ResourceType: "task"},
+	}, records)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "record 4: resource_type is required")
+	assert.ErrorContains(t, err, "record 5:")
+	assert.ErrorContains(t, err, "record 6:")
+}
+
+func TestParse_JSONNotAnArray(t *testing.T) {
+	_, err := Parse(strings.NewReader(`{"resource_id": "user-1"}`), FormatJSON)
+	assert.ErrorContains(t, err, "expected an array of records")
+}
+
+func TestParse_CSV(t *testing.T) {
+	input := `resource_type,resource_id,context,source
+user,user-1,"{""action"": ""login"", ""ip"": ""192.168.1.1""}",crm
+document,doc-1,"a|b|c, with commas",crm
+task,task-1,,crm
+task,task-2
+,task-3,,crm
+file,file-1,"{""name"": ""report.pdf""}",crm
+`
+
+	records, err := Parse(strings.NewReader(input), FormatCSV)
+
+	assert.Equal(t, []SampleRecord{
+		{ResourceID: "user-1", ResourceType: "user", Context: strPtr(`{"action": "login", "ip": "192.168.1.1"}`)},
+		{ResourceID: "doc-1", ResourceType: "document", Context: strPtr("a|b|c, with commas")},
+		{ResourceID: "task-1", ResourceType: "task"},
+		{ResourceID: "file-1", ResourceType: "file", Context: strPtr(`{"name": "report.pdf"}`)},
+	}, records)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "line 5: expected 4 fields, got 2")
+	assert.ErrorContains(t, err, "line 6: resource_type is required")
+}
+
+func TestParse_CSVMalformedQuotes(t *testing.T) {
+	input := "resource_id,resource_type\nuser-1,user\nuser-2,us\"er\nuser-3,user\n"
+
+	records, err := Parse(strings.NewReader(input), FormatCSV)
+
+	assert.Equal(t, []SampleRecord{
+		{ResourceID: "user-1", ResourceType: "user"},
+		{ResourceID: "user-3", ResourceType: "user"},
+	}, records)
+	assert.ErrorContains(t, err, "line 3:")
+}
+
+func TestParse_CSVMissingColumn(t *testing.T) {
+	_, err := Parse(strings.NewReader("id,resource_type\nuser-1,user\n"), FormatCSV)
+	assert.ErrorContains(t, err, "missing resource_id column")
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     Format
+		wantErr  bool
+	}{
+		{filename: "sample_data.txt", want: FormatPipe},
+		{filename: "fixtures/records.JSON", want: FormatJSON},
+		{filename: "export.csv", want: FormatCSV},
+		{filename: "records.xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			got, err := DetectFormat(tt.filename)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoadFile_DetectsFormatFromExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.csv")
+	require.NoError(t, os.WriteFile(path, []byte("resource_id,resource_type\nuser-1,user\n"), 0o600))
+
+	records, err := LoadFile(path, "")
+	require.NoError(t, err)
+	assert.Equal(t, []SampleRecord{{ResourceID: "user-1", ResourceType: "user"}}, records)
+
+	// An explicit format overrides the extension
+	_, err = LoadFile(path, FormatPipe)
+	assert.ErrorContains(t, err, "line 1: invalid format")
+}
+
+func TestLoadFile_RepositorySampleData(t *testing.T) {
+	records, err := LoadFile("../sample_data.txt", "")
+	require.NoError(t, err)
+	assert.NotEmpty(t, records)
+}
@@ -0,0 +1,170 @@
+// Package server runs the HTTP listeners of the service: the API server, over
+// HTTPS when a certificate is configured, an optional HTTP to HTTPS redirect, an
+// optional Unix domain socket and an optional admin listener, with certificate
+// reloading and graceful shutdown.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"tokenpagination/config"
+)
+
+// Run serves handler as configured until ctx is cancelled, then shuts every
+// listener down gracefully, letting in-flight requests finish for up to
+// cfg.ShutdownTimeout, and removes the Unix socket file. When cfg.AdminAddr is set,
+// admin is served there over plain HTTP and shut down together with the others.
+// With TLS enabled the certificate is reloaded from disk on SIGHUP. Run returns
+// early with the error of a listener that fails to start.
+func Run(ctx context.Context, cfg config.ServerConfig, handler, admin http.Handler) error {
+	var servers []*http.Server
+	var serves []func() error
+
+	newServer := func(addr string, handler http.Handler) *http.Server {
+		srv := &http.Server{
+			Addr:         addr,
+			Handler:      handler,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+		}
+		servers = append(servers, srv)
+		return srv
+	}
+
+	if !cfg.SocketOnly {
+		api := newServer(cfg.Addr, handler)
+		serves = append(serves, api.ListenAndServe)
+
+		if cfg.TLSEnabled() {
+			reloader, err := NewCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+			if err != nil {
+				return err
+			}
+			api.TLSConfig = TLSConfig(reloader)
+			serves[0] = func() error { return api.ListenAndServeTLS("", "") }
+
+			stop := reloadOnSIGHUP(reloader)
+			defer stop()
+
+			if cfg.RedirectAddr != "" {
+				redirect := newServer(cfg.RedirectAddr, RedirectHandler(cfg.Addr))
+				serves = append(serves, redirect.ListenAndServe)
+			}
+		}
+	}
+
+	if cfg.Socket != "" {
+		ln, err := listenUnix(cfg.Socket, cfg.SocketMode)
+		if err != nil {
+			return err
+		}
+		defer removeSocket(cfg.Socket)
+
+		socket := newServer(cfg.Socket, handler)
+		serves = append(serves, func() error { return socket.Serve(ln) })
+	}
+
+	if cfg.AdminAddr != "" {
+		adminServer := newServer(cfg.AdminAddr, admin)
+		serves = append(serves, adminServer.ListenAndServe)
+	}
+
+	errs := make(chan error, len(serves))
+	for _, serve := range serves {
+		go func(serve func() error) {
+			err := serve()
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			}
+			errs <- err
+		}(serve)
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case runErr = <-errs:
+	}
+
+	shutdownCtx := context.Background()
+	if cfg.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, cfg.ShutdownTimeout)
+		defer cancel()
+	}
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil && runErr == nil {
+			runErr = err
+		}
+	}
+
+	return runErr
+}
+
+// listenUnix listens on a Unix domain socket at path with the given file mode. A
+// socket file left behind by a previous run is removed first; any other kind of
+// file at path is an error rather than being deleted.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != os.ModeSocket {
+			return nil, fmt.Errorf("cannot listen on %s: file exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("cannot remove stale socket %s: %v", path, err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("cannot set permissions of socket %s: %v", path, err)
+	}
+	return ln, nil
+}
+
+// removeSocket deletes the socket file after shutdown. Closing the listener
+// normally removes it already, so a missing file is not an error.
+func removeSocket(path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("cannot remove socket file", "path", path, "error", err)
+	}
+}
+
+// reloadOnSIGHUP reloads the certificate whenever the process receives SIGHUP,
+// until the returned function is called.
+func reloadOnSIGHUP(reloader *CertReloader) (stop func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-hup:
+				if err := reloader.Reload(); err != nil {
+					slog.Error("TLS certificate reload failed, keeping the previous certificate", "error", err)
+					continue
+				}
+				slog.Info("TLS certificate reloaded", "cert_file", reloader.certFile)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(hup)
+		close(done)
+	}
+}
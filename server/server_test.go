@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tokenpagination/config"
+)
+
+// writeCert writes a self-signed certificate for commonName and its key to dir.
+func writeCert(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, r *CertReloader) string {
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "first")
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, reloader))
+
+	writeCert(t, dir, "second")
+	require.NoError(t, reloader.Reload())
+	assert.Equal(t, "second", commonName(t, reloader))
+}
+
+func TestCertReloader_ReloadFailureKeepsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "first")
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0o600))
+	assert.Error(t, reloader.Reload())
+	assert.Equal(t, "first", commonName(t, reloader))
+}
+
+func TestNewCertReloader_MissingFile(t *testing.T) {
+	_, err := NewCertReloader("missing-cert.pem", "missing-key.pem")
+	assert.ErrorContains(t, err, "cannot load TLS certificate missing-cert.pem")
+}
+
+func TestTLSConfig(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir(), "localhost")
+	reloader, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	cfg := TLSConfig(reloader)
+	assert.Equal(t, uint16(tls.VersionTLS12), cfg.MinVersion)
+	assert.NotEmpty(t, cfg.CipherSuites)
+
+	insecure := map[uint16]bool{}
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.ID] = true
+	}
+	for _, id := range cfg.CipherSuites {
+		assert.False(t, insecure[id], "insecure cipher suite %s", tls.CipherSuiteName(id))
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsAddr string
+		target    string
+		want      string
+	}{
+		{name: "default port", httpsAddr: ":443", target: "http://example.com/api/v1/records?page_size=5", want: "https://example.com/api/v1/records?page_size=5"},
+		{name: "custom port", httpsAddr: ":8443", target: "http://example.com:8080/health", want: "https://example.com:8443/health"},
+		{name: "ipv6 host", httpsAddr: "[::]:8443", target: "http://[::1]:8080/health", want: "https://[::1]:8443/health"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			RedirectHandler(tt.httpsAddr).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+			assert.Equal(t, tt.want, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestRun_ShutsDownWhenContextIsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, config.ServerConfig{Addr: "127.0.0.1:0", ShutdownTimeout: time.Second}, http.NotFoundHandler(), nil)
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+}
+
+func TestRun_ListenError(t *testing.T) {
+	err := Run(context.Background(), config.ServerConfig{Addr: "127.0.0.1:-1"}, http.NotFoundHandler(), nil)
+	assert.Error(t, err)
+}
+
+func TestRun_InvalidCertificate(t *testing.T) {
+	err := Run(context.Background(), config.ServerConfig{
+		Addr:        "127.0.0.1:0",
+		TLSCertFile: "missing-cert.pem",
+		TLSKeyFile:  "missing-key.pem",
+	}, http.NotFoundHandler(), nil)
+	assert.ErrorContains(t, err, "cannot load TLS certificate")
+}
+
+// unixClient returns an HTTP client that dials the Unix socket at path for every
+// request, whatever the URL's host.
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestRun_UnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "api.sock")
+	// A socket file left behind by a crashed run must not block startup
+	stale, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, config.ServerConfig{Socket: socket, SocketMode: 0o600, SocketOnly: true, ShutdownTimeout: time.Second},
+			http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.Write([]byte("over the socket")) }), nil)
+	}()
+
+	client := unixClient(socket)
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		resp, err = client.Get("http://unix/health")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "over the socket", string(body))
+
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+	assert.NoFileExists(t, socket)
+}
+
+func TestRun_SocketPathIsRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	require.NoError(t, os.WriteFile(path, []byte("keep me"), 0o600))
+
+	err := Run(context.Background(), config.ServerConfig{Socket: path, SocketOnly: true}, http.NotFoundHandler(), nil)
+	assert.ErrorContains(t, err, "file exists and is not a socket")
+	assert.FileExists(t, path)
+}
+
+// freeAddr returns a loopback address with a port that was free a moment ago.
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// get returns the body of a GET request to url, retrying until the server is up.
+func get(t *testing.T, url string) string {
+	var resp *http.Response
+	var err error
+	require.Eventually(t, func() bool {
+		resp, err = http.Get(url)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestRun_AdminListener(t *testing.T) {
+	cfg := config.ServerConfig{Addr: freeAddr(t), AdminAddr: freeAddr(t), ShutdownTimeout: time.Second}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, cfg,
+			http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.Write([]byte("public")) }),
+			http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.Write([]byte("admin")) }))
+	}()
+
+	assert.Equal(t, "public", get(t, "http://"+cfg.Addr+"/"))
+	assert.Equal(t, "admin", get(t, "http://"+cfg.AdminAddr+"/"))
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+
+	// Both listeners are closed on shutdown
+	_, err := net.Dial("tcp", cfg.AdminAddr)
+	assert.Error(t, err)
+}
@@ -0,0 +1,132 @@
+// Package testutil holds fixtures shared by the tests of every package: a
+// deterministic record generator, expected continuation tokens and golden-file
+// comparison. It does not import the repository package, whose own tests use it,
+// so records are generated as Record values that mirror the stored columns.
+package testutil
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// DefaultStart is the created_at of the first record of a new RecordFactory.
+var DefaultStart = time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+
+// RecordColumns are the columns of a record as the repository selects them.
+var RecordColumns = []string{"resource_id", "resource_type", "context", "created_at", "updated_at", "metadata"}
+
+// Record is a generated record, with the columns of repository.Record.
+type Record struct {
+	ResourceID   string
+	ResourceType string
+	Context      *string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// RecordFactory generates records deterministically: a factory with the same seed
+// and settings generates the same records in the same order, so tests do not
+// depend on the clock. Records come in groups of GroupSize sharing a created_at
+// second, which declares how many timestamps collide; groups are Step apart.
+// Resource IDs number the records in generation order, so they sort the same way.
+//
+// The settings are fields, changed before the first record is generated.
+type RecordFactory struct {
+	// Start is the created_at of the first record.
+	Start time.Time
+	// Step is the time between the created_at of consecutive groups.
+	Step time.Duration
+	// GroupSize is the number of consecutive records sharing a created_at second.
+	GroupSize int
+	// Fractions gives the records of a group random sub-second parts of their
+	// created_at, as records inserted within the same second have. MySQL drops
+	// the fraction, so the stored timestamps still collide.
+	Fractions bool
+	// Types are the resource types, assigned to the records in turn.
+	Types []string
+	// IDPrefix starts every resource_id, which ends with the record's number.
+	IDPrefix string
+	// ContextSize pads the JSON context of every record with random letters to
+	// about this many bytes. Without padding the context is {"n":<number>}.
+	ContextSize int
+	// NullContextEvery gives every n-th record a NULL context; 0 gives none.
+	NullContextEvery int
+
+	rng  *rand.Rand
+	next int
+}
+
+// NewRecordFactory returns a factory of records one second apart, of the types
+// user, task and order, whose random parts are drawn from seed.
+func NewRecordFactory(seed int64) *RecordFactory {
+	return &RecordFactory{
+		Start:     DefaultStart,
+		Step:      time.Second,
+		GroupSize: 1,
+		Types:     []string{"user", "task", "order"},
+		IDPrefix:  "res-",
+		rng:       rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Next generates the next record.
+func (f *RecordFactory) Next() Record {
+	n := f.next
+	f.next++
+
+	created := f.Start.Add(time.Duration(n/max(f.GroupSize, 1)) * f.Step)
+	if f.Fractions {
+		created = created.Add(time.Duration(f.rng.Intn(1000)) * time.Millisecond)
+	}
+
+	record := Record{
+		ResourceID:   fmt.Sprintf("%s%07d", f.IDPrefix, n),
+		ResourceType: f.Types[n%len(f.Types)],
+		CreatedAt:    created,
+		UpdatedAt:    created,
+	}
+	if f.NullContextEvery == 0 || (n+1)%f.NullContextEvery != 0 {
+		context := f.context(n)
+		record.Context = &context
+	}
+	return record
+}
+
+// Records generates the next n records.
+func (f *RecordFactory) Records(n int) []Record {
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = f.Next()
+	}
+	return records
+}
+
+// context returns the JSON context of the n-th record.
+func (f *RecordFactory) context(n int) string {
+	context := fmt.Sprintf(`{"n":%d}`, n)
+	padding := f.ContextSize - len(context) - len(`,"pad":""`)
+	if padding <= 0 {
+		return context
+	}
+
+	var pad strings.Builder
+	pad.Grow(padding)
+	for i := 0; i < padding; i++ {
+		pad.WriteByte(byte('a' + f.rng.Intn(26)))
+	}
+	return fmt.Sprintf(`{"n":%d,"pad":"%s"}`, n, pad.String())
+}
+
+// MockRows returns the records as the rows of a query selecting RecordColumns,
+// with NULL metadata.
+func MockRows(records ...Record) *sqlmock.Rows {
+	rows := sqlmock.NewRows(RecordColumns)
+	for _, r := range records {
+		rows.AddRow(r.ResourceID, r.ResourceType, r.Context, r.CreatedAt, r.UpdatedAt, nil)
+	}
+	return rows
+}
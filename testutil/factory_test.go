@@ -0,0 +1,78 @@
+package testutil
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordFactory_Deterministic(t *testing.T) {
+	newFactory := func() *RecordFactory {
+		f := NewRecordFactory(42)
+		f.Fractions = true
+		f.ContextSize = 64
+		return f
+	}
+
+	assert.Equal(t, newFactory().Records(20), newFactory().Records(20))
+
+	other := NewRecordFactory(7)
+	other.Fractions = true
+	other.ContextSize = 64
+	assert.NotEqual(t, newFactory().Records(20), other.Records(20), "the seed drives the random parts")
+}
+
+func TestRecordFactory_Defaults(t *testing.T) {
+	records := NewRecordFactory(1).Records(4)
+
+	assert.Equal(t, "res-0000000", records[0].ResourceID)
+	assert.Equal(t, []string{"user", "task", "order", "user"}, []string{records[0].ResourceType, records[1].ResourceType, records[2].ResourceType, records[3].ResourceType})
+	assert.Equal(t, DefaultStart, records[0].CreatedAt)
+	assert.Equal(t, DefaultStart.Add(3*time.Second), records[3].CreatedAt)
+	assert.Equal(t, records[3].CreatedAt, records[3].UpdatedAt)
+	require.NotNil(t, records[2].Context)
+	assert.Equal(t, `{"n":2}`, *records[2].Context)
+}
+
+func TestRecordFactory_Collisions(t *testing.T) {
+	f := NewRecordFactory(1)
+	f.GroupSize = 3
+	f.Step = time.Minute
+	f.Fractions = true
+	records := f.Records(7)
+
+	seconds := make([]time.Time, len(records))
+	for i, record := range records {
+		seconds[i] = record.CreatedAt.Truncate(time.Second)
+	}
+	assert.Equal(t, []time.Time{
+		DefaultStart, DefaultStart, DefaultStart,
+		DefaultStart.Add(time.Minute), DefaultStart.Add(time.Minute), DefaultStart.Add(time.Minute),
+		DefaultStart.Add(2 * time.Minute),
+	}, seconds)
+}
+
+func TestRecordFactory_Contexts(t *testing.T) {
+	f := NewRecordFactory(1)
+	f.ContextSize = 300
+	f.NullContextEvery = 3
+	records := f.Records(6)
+
+	for i, record := range records {
+		if i%3 == 2 {
+			assert.Nil(t, record.Context, "record %d", i)
+			continue
+		}
+		require.NotNil(t, record.Context, "record %d", i)
+		assert.Len(t, *record.Context, 300)
+		assert.True(t, json.Valid([]byte(*record.Context)))
+	}
+}
+
+func TestMockRows(t *testing.T) {
+	records := NewRecordFactory(1).Records(2)
+	assert.NotNil(t, MockRows(records...))
+}
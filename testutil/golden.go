@@ -0,0 +1,41 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the actual output")
+
+// Golden compares got with the golden file testdata/<name>.golden of the package
+// under test. JSON is indented before it is compared and written, so that golden
+// files read well and compact and indented output compare equal. Run the tests
+// with -update to write the golden files from the actual output instead.
+func Golden(t testing.TB, name string, got []byte) {
+	t.Helper()
+
+	if json.Valid(got) {
+		var indented bytes.Buffer
+		require.NoError(t, json.Indent(&indented, got, "", "  "))
+		indented.WriteByte('\n')
+		got = indented.Bytes()
+	}
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, got, 0o644))
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	require.NoError(t, err, "run the test with -update to create the golden file")
+	assert.Equal(t, string(want), string(got), "output differs from %s; run the test with -update if the change is intended", path)
+}
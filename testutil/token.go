@@ -0,0 +1,55 @@
+package testutil
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// Token is the payload of a plain continuation token. It is written apart from
+// the repository's encoder, so that a test comparing tokens checks the wire
+// format rather than the encoder against itself.
+type Token struct {
+	ResourceType string `json:"t"`
+	ResourceID   string `json:"i"`
+	CreatedAt    int64  `json:"c"`
+	Seq          int64  `json:"q,omitempty"`
+	Page         int    `json:"p"`
+	Order        string `json:"o,omitempty"`
+	Snapshot     int64  `json:"s,omitempty"`
+	Backward     bool   `json:"b,omitempty"`
+	Null         bool   `json:"n,omitempty"`
+}
+
+// TokenAfter returns the token of the default listing, ordered by created_at,
+// that resumes after record and leads to page page+1. snapshot is the time of
+// the listing's first page.
+func TokenAfter(record Record, page int, snapshot time.Time) Token {
+	token := Token{ResourceType: record.ResourceType, ResourceID: record.ResourceID, CreatedAt: record.CreatedAt.Unix(), Page: page}
+	if !snapshot.IsZero() {
+		token.Snapshot = snapshot.Unix()
+	}
+	return token
+}
+
+// Encode returns the token as the repository issues it without encryption.
+func (t Token) Encode() string {
+	payload, err := json.Marshal(t)
+	if err != nil {
+		panic(err)
+	}
+	return base64.URLEncoding.EncodeToString(payload)
+}
+
+// DecodeToken returns the payload of a plain continuation token, for checking
+// the fields of a token carrying a snapshot taken at an unknown time.
+func DecodeToken(token string) (Token, error) {
+	payload, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return Token{}, err
+	}
+
+	var decoded Token
+	err = json.Unmarshal(payload, &decoded)
+	return decoded, err
+}
@@ -0,0 +1,31 @@
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToken_Encode(t *testing.T) {
+	token := Token{ResourceType: "user", ResourceID: "user-100", CreatedAt: 1705314600, Page: 1}
+	assert.Equal(t, "eyJ0IjoidXNlciIsImkiOiJ1c2VyLTEwMCIsImMiOjE3MDUzMTQ2MDAsInAiOjF9", token.Encode())
+
+	decoded, err := DecodeToken(token.Encode())
+	require.NoError(t, err)
+	assert.Equal(t, token, decoded)
+}
+
+func TestTokenAfter(t *testing.T) {
+	record := Record{ResourceID: "res-0000004", ResourceType: "task", CreatedAt: DefaultStart.Add(1500 * time.Millisecond)}
+	snapshot := DefaultStart.Add(time.Hour)
+
+	assert.Equal(t, Token{ResourceType: "task", ResourceID: "res-0000004", CreatedAt: DefaultStart.Unix() + 1, Page: 2, Snapshot: snapshot.Unix()}, TokenAfter(record, 2, snapshot))
+	assert.Zero(t, TokenAfter(record, 2, time.Time{}).Snapshot)
+}
+
+func TestDecodeToken_Invalid(t *testing.T) {
+	_, err := DecodeToken("not base64!")
+	assert.Error(t, err)
+}